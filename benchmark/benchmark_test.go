@@ -8,8 +8,10 @@
 package benchmark
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
@@ -32,6 +34,18 @@ func BenchmarkEncryptFile_100MB(b *testing.B) {
 	benchmarkEncryptFile(b, 100*1024*1024)
 }
 
+// BenchmarkEncryptFile_100MB_Pipeline benchmarks encryption of a 100MB file
+// with reads, sealing and writes overlapped by WithPipeline
+func BenchmarkEncryptFile_100MB_Pipeline(b *testing.B) {
+	benchmarkEncryptFile(b, 100*1024*1024, fileencrypt.WithPipeline(2))
+}
+
+// BenchmarkEncryptFile_100MB_ParallelismAuto benchmarks encryption of a 100MB
+// file with the sealing workers sized by ParallelismAuto
+func BenchmarkEncryptFile_100MB_ParallelismAuto(b *testing.B) {
+	benchmarkEncryptFile(b, 100*1024*1024, fileencrypt.WithPipeline(2), fileencrypt.WithParallelism(fileencrypt.ParallelismAuto))
+}
+
 // BenchmarkEncryptFile_1GB benchmarks encryption of a 1GB file
 // Target: <120s on Intel i5-8400 (6-core, 2.8GHz, circa 2018)
 func BenchmarkEncryptFile_1GB(b *testing.B) {
@@ -60,7 +74,7 @@ func BenchmarkDecryptFile_1GB(b *testing.B) {
 }
 
 // benchmarkEncryptFile is a helper function for encryption benchmarks
-func benchmarkEncryptFile(b *testing.B, size int64) {
+func benchmarkEncryptFile(b *testing.B, size int64, opts ...fileencrypt.Option) {
 	// Create temp directory
 	tmpDir := b.TempDir()
 
@@ -89,7 +103,7 @@ func benchmarkEncryptFile(b *testing.B, size int64) {
 	// Run benchmark
 	for i := 0; i < b.N; i++ {
 		encFile := filepath.Join(tmpDir, fmt.Sprintf("encrypted_%d.enc", i%10))
-		if err := fileencrypt.EncryptFile(ctx, srcFile, encFile, key); err != nil {
+		if err := fileencrypt.EncryptFile(ctx, srcFile, encFile, key, opts...); err != nil {
 			b.Fatalf("EncryptFile failed: %v", err)
 		}
 	}
@@ -225,3 +239,153 @@ func BenchmarkMemoryZero(b *testing.B) {
 
 	b.SetBytes(4096)
 }
+
+// BenchmarkSmallFiles_PerFile encrypts 1KB files, creating a new Encryptor per file
+func BenchmarkSmallFiles_PerFile(b *testing.B) {
+	tmpDir, key := setupSmallFile(b)
+	srcFile := filepath.Join(tmpDir, "small.bin")
+	encFile := filepath.Join(tmpDir, "small.enc")
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := fileencrypt.EncryptFile(ctx, srcFile, encFile, key); err != nil {
+			b.Fatalf("EncryptFile failed: %v", err)
+		}
+	}
+}
+
+// BenchmarkSmallFiles_Session encrypts 1KB files reusing one Encryptor
+func BenchmarkSmallFiles_Session(b *testing.B) {
+	tmpDir, key := setupSmallFile(b)
+	srcFile := filepath.Join(tmpDir, "small.bin")
+	encFile := filepath.Join(tmpDir, "small.enc")
+	ctx := context.Background()
+
+	enc, err := fileencrypt.NewEncryptor(key)
+	if err != nil {
+		b.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := enc.EncryptFile(ctx, srcFile, encFile); err != nil {
+			b.Fatalf("EncryptFile failed: %v", err)
+		}
+	}
+}
+
+// BenchmarkSmallFiles_Sizes compares the single-Seal path EncryptFile takes
+// for inputs below one chunk with the chunked stream path, for 1-64KB secrets
+func BenchmarkSmallFiles_Sizes(b *testing.B) {
+	key := make([]byte, 32)
+	ctx := context.Background()
+	for _, size := range []int{1024, 4 * 1024, 16 * 1024, 64 * 1024} {
+		data := make([]byte, size)
+		tmpDir := b.TempDir()
+		srcFile := filepath.Join(tmpDir, "small.bin")
+		encFile := filepath.Join(tmpDir, "small.enc")
+		if err := os.WriteFile(srcFile, data, 0600); err != nil {
+			b.Fatalf("Failed to create test file: %v", err)
+		}
+
+		b.Run(fmt.Sprintf("File_%dKB", size/1024), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				if err := fileencrypt.EncryptFile(ctx, srcFile, encFile, key); err != nil {
+					b.Fatalf("EncryptFile failed: %v", err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("Stream_%dKB", size/1024), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				f, err := os.Create(encFile)
+				if err != nil {
+					b.Fatalf("Create failed: %v", err)
+				}
+				err = fileencrypt.EncryptStream(ctx, bytes.NewReader(data), f, key)
+				f.Close()
+				if err != nil {
+					b.Fatalf("EncryptStream failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func setupSmallFile(b *testing.B) (string, []byte) {
+	tmpDir := b.TempDir()
+	data := make([]byte, 1024)
+	if err := os.WriteFile(filepath.Join(tmpDir, "small.bin"), data, 0600); err != nil {
+		b.Fatalf("Failed to create test file: %v", err)
+	}
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	return tmpDir, key
+}
+
+// readerOnly hides the io.WriterTo of a reader from io.Copy
+type readerOnly struct {
+	io.Reader
+}
+
+// BenchmarkStreamReaders_Copy compares io.Copy from EncryptReader and
+// DecryptReader to a writer through their WriteTo, which passes each chunk
+// to the writer as is, with copying through io.Copy's 32KB buffer
+func BenchmarkStreamReaders_Copy(b *testing.B) {
+	ctx := context.Background()
+	key := make([]byte, 32)
+	data := make([]byte, 10*1024*1024)
+	var ciphertext bytes.Buffer
+	if err := fileencrypt.EncryptStream(ctx, bytes.NewReader(data), &ciphertext, key); err != nil {
+		b.Fatalf("EncryptStream failed: %v", err)
+	}
+	enc, err := fileencrypt.NewEncryptor(key)
+	if err != nil {
+		b.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	dec, err := fileencrypt.NewDecryptor(key)
+	if err != nil {
+		b.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+
+	for _, bench := range []struct {
+		name string
+		open func() (io.Reader, error)
+	}{
+		{"Encrypt", func() (io.Reader, error) { return enc.EncryptReader(ctx, bytes.NewReader(data)) }},
+		{"Decrypt", func() (io.Reader, error) { return dec.DecryptReader(ctx, bytes.NewReader(ciphertext.Bytes())) }},
+	} {
+		for _, writerTo := range []bool{true, false} {
+			name := bench.name + "_WriterTo"
+			if !writerTo {
+				name = bench.name + "_Read"
+			}
+			b.Run(name, func(b *testing.B) {
+				b.ReportAllocs()
+				b.SetBytes(int64(len(data)))
+				for i := 0; i < b.N; i++ {
+					r, err := bench.open()
+					if err != nil {
+						b.Fatalf("open failed: %v", err)
+					}
+					if !writerTo {
+						r = readerOnly{r}
+					}
+					// A plain writer, so that io.Copy cannot use io.ReaderFrom.
+					if _, err := io.Copy(struct{ io.Writer }{io.Discard}, r); err != nil {
+						b.Fatalf("io.Copy failed: %v", err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,132 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// client.go: Shared default options for the package-level functions
+package fileencrypt
+
+import (
+	"context"
+	"io"
+	"slices"
+)
+
+// Client carries a set of default options, such as the chunk size, report,
+// audit sink or key limits, so that an application configures them once
+// instead of at every call site. Its methods are the package-level functions
+// with the defaults applied before the options passed to each call, which
+// therefore take precedence. A Client holds no key or cipher state; it is
+// safe for concurrent use and costs nothing to keep around.
+type Client struct {
+	defaults []Option
+}
+
+// NewClient returns a Client that applies defaultOpts to every operation.
+func NewClient(defaultOpts ...Option) *Client {
+	return &Client{defaults: slices.Clone(defaultOpts)}
+}
+
+// With returns a Client that applies opts after c's defaults, e.g. to give
+// one subsystem its own report or audit sink.
+func (c *Client) With(opts ...Option) *Client {
+	return &Client{defaults: c.options(opts)}
+}
+
+// options returns the defaults followed by opts.
+func (c *Client) options(opts []Option) []Option {
+	return append(slices.Clip(c.defaults), opts...)
+}
+
+// NewEncryptor creates a reusable Encryptor with the client's defaults.
+func (c *Client) NewEncryptor(key []byte, opts ...Option) (*Encryptor, error) {
+	return NewEncryptor(key, c.options(opts)...)
+}
+
+// NewDecryptor creates a reusable Decryptor with the client's defaults.
+func (c *Client) NewDecryptor(key []byte, opts ...Option) (*Decryptor, error) {
+	return NewDecryptor(key, c.options(opts)...)
+}
+
+// EncryptFile encrypts a file.
+func (c *Client) EncryptFile(ctx context.Context, srcPath, dstPath string, key []byte, opts ...Option) error {
+	return EncryptFile(ctx, srcPath, dstPath, key, c.options(opts)...)
+}
+
+// EncryptFileAsync starts encrypting a file in the background.
+func (c *Client) EncryptFileAsync(ctx context.Context, srcPath, dstPath string, key []byte, opts ...Option) (*Operation, error) {
+	return EncryptFileAsync(ctx, srcPath, dstPath, key, c.options(opts)...)
+}
+
+// DecryptFileAsync starts decrypting a file in the background.
+func (c *Client) DecryptFileAsync(ctx context.Context, srcPath, dstPath string, key []byte, opts ...Option) (*Operation, error) {
+	return DecryptFileAsync(ctx, srcPath, dstPath, key, c.options(opts)...)
+}
+
+// EncryptFileInPlace encrypts the file at path and atomically replaces it
+// with the encrypted version.
+func (c *Client) EncryptFileInPlace(ctx context.Context, path string, key []byte, opts ...Option) error {
+	return EncryptFileInPlace(ctx, path, key, c.options(opts)...)
+}
+
+// DecryptFile decrypts a file.
+func (c *Client) DecryptFile(ctx context.Context, srcPath, dstPath string, key []byte, opts ...Option) error {
+	return DecryptFile(ctx, srcPath, dstPath, key, c.options(opts)...)
+}
+
+// VerifyFile checks that an encrypted file authenticates with key without
+// writing any plaintext.
+func (c *Client) VerifyFile(ctx context.Context, path string, key []byte, opts ...Option) error {
+	return VerifyFile(ctx, path, key, c.options(opts)...)
+}
+
+// ScanFile reports the status of every chunk of an encrypted file.
+func (c *Client) ScanFile(ctx context.Context, path string, key []byte, opts ...Option) (*ScanReport, error) {
+	return ScanFile(ctx, path, key, c.options(opts)...)
+}
+
+// EncryptStream encrypts a stream.
+func (c *Client) EncryptStream(ctx context.Context, src io.Reader, dst io.Writer, key []byte, opts ...Option) error {
+	return EncryptStream(ctx, src, dst, key, c.options(opts)...)
+}
+
+// EncryptStreamTo encrypts a stream to several writers at once.
+func (c *Client) EncryptStreamTo(ctx context.Context, src io.Reader, dsts []io.Writer, key []byte, opts ...Option) error {
+	return EncryptStreamTo(ctx, src, dsts, key, c.options(opts)...)
+}
+
+// DecryptStream decrypts a stream.
+func (c *Client) DecryptStream(ctx context.Context, src io.Reader, dst io.Writer, key []byte, opts ...Option) error {
+	return DecryptStream(ctx, src, dst, key, c.options(opts)...)
+}
+
+// EncryptReader returns an io.Reader yielding the encrypted form of src.
+func (c *Client) EncryptReader(ctx context.Context, src io.Reader, key []byte, opts ...Option) (io.Reader, error) {
+	return EncryptReader(ctx, src, key, c.options(opts)...)
+}
+
+// DecryptReader returns an io.Reader yielding the decrypted form of src.
+func (c *Client) DecryptReader(ctx context.Context, src io.Reader, key []byte, opts ...Option) (io.Reader, error) {
+	return DecryptReader(ctx, src, key, c.options(opts)...)
+}
+
+// EncryptDir encrypts every regular file under srcDir into dstDir.
+func (c *Client) EncryptDir(ctx context.Context, srcDir, dstDir string, key []byte, opts ...Option) error {
+	return EncryptDir(ctx, srcDir, dstDir, key, c.options(opts)...)
+}
+
+// DecryptDir decrypts every encrypted file under srcDir into dstDir.
+func (c *Client) DecryptDir(ctx context.Context, srcDir, dstDir string, key []byte, opts ...Option) error {
+	return DecryptDir(ctx, srcDir, dstDir, key, c.options(opts)...)
+}
+
+// EncryptRecord encrypts one small message.
+func (c *Client) EncryptRecord(plaintext, aad, key []byte, opts ...Option) ([]byte, error) {
+	return EncryptRecord(plaintext, aad, key, c.options(opts)...)
+}
+
+// DecryptRecord opens a record produced by EncryptRecord.
+func (c *Client) DecryptRecord(record, aad, key []byte, opts ...Option) ([]byte, error) {
+	return DecryptRecord(record, aad, key, c.options(opts)...)
+}
@@ -0,0 +1,80 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package fileencrypt_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gitrgoliveira/go-fileencrypt"
+)
+
+func TestClient_Defaults(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	tmpDir := t.TempDir()
+	srcPath := filepath.Join(tmpDir, "src.txt")
+	encPath := filepath.Join(tmpDir, "src.txt.enc")
+	dstPath := filepath.Join(tmpDir, "dst.txt")
+	data := bytes.Repeat([]byte("client defaults "), 1000)
+	if err := os.WriteFile(srcPath, data, 0600); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+
+	chunkSize, err := fileencrypt.WithChunkSize(4096)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	var report fileencrypt.OperationReport
+	client := fileencrypt.NewClient(chunkSize, fileencrypt.WithReport(&report))
+
+	ctx := context.Background()
+	if err := client.EncryptFile(ctx, srcPath, encPath, key); err != nil {
+		t.Fatalf("EncryptFile failed: %v", err)
+	}
+	if report.Operation != "encrypt" || report.Chunks != 4 {
+		t.Errorf("defaults not applied: report %+v", report)
+	}
+
+	// Options passed to a call come after the defaults.
+	var callReport fileencrypt.OperationReport
+	if err := client.DecryptFile(ctx, encPath, dstPath, key, fileencrypt.WithReport(&callReport)); err != nil {
+		t.Fatalf("DecryptFile failed: %v", err)
+	}
+	if callReport.Operation != "decrypt" || report.Operation != "encrypt" {
+		t.Errorf("call option did not override the default: %+v, %+v", callReport, report)
+	}
+	got, err := os.ReadFile(dstPath)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("decrypted data does not match")
+	}
+
+	// With derives a client without changing the original.
+	var derived fileencrypt.OperationReport
+	sub := client.With(fileencrypt.WithReport(&derived))
+	if err := sub.VerifyFile(ctx, encPath, key); err != nil {
+		t.Fatalf("VerifyFile failed: %v", err)
+	}
+	if derived.Operation != "verify" || derived.Chunks != 4 {
+		t.Errorf("derived client report %+v", derived)
+	}
+	if err := client.VerifyFile(ctx, encPath, key); err != nil {
+		t.Fatalf("VerifyFile failed: %v", err)
+	}
+	if report.Operation != "verify" {
+		t.Errorf("original client report %+v", report)
+	}
+}
@@ -0,0 +1,139 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// Command fileencrypt-sfx is the stub of self-extracting files written by
+// fileencrypt.WriteSelfExtracting. Build it for the recipient's system:
+//
+//	GOOS=windows GOARCH=amd64 go build -o stub.exe ./cmd/fileencrypt-sfx
+//
+// When run, it asks for the password and decrypts the file appended to its
+// own executable next to it, refusing to overwrite an existing file.
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/gitrgoliveira/go-fileencrypt"
+	"github.com/gitrgoliveira/go-fileencrypt/secure"
+	"golang.org/x/term"
+)
+
+func main() {
+	err := run()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+	// A double-clicked executable gets a console that closes on exit.
+	if runtime.GOOS == "windows" && term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprint(os.Stderr, "Press Enter to exit.")
+		_, _ = bufio.NewReader(os.Stdin).ReadString('\n')
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(exe)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	sfx, err := fileencrypt.OpenSelfExtracting(f, fi.Size())
+	if err != nil {
+		return fmt.Errorf("this program has no encrypted file attached: %w", err)
+	}
+	dst := filepath.Join(filepath.Dir(exe), sfx.Name)
+	if _, err := os.Lstat(dst); err == nil {
+		return fmt.Errorf("%s already exists; move it away and run again", dst)
+	}
+
+	var key *secure.SecureBuffer
+	stdin := bufio.NewReader(os.Stdin)
+	u := &fileencrypt.Unlocker{
+		Prompt: func(ctx context.Context, attempt int) ([]byte, error) {
+			fmt.Fprintf(os.Stderr, "Password for %s: ", sfx.Name)
+			if term.IsTerminal(int(os.Stdin.Fd())) {
+				defer fmt.Fprintln(os.Stderr)
+				return term.ReadPassword(int(os.Stdin.Fd()))
+			}
+			line, err := stdin.ReadBytes('\n')
+			if err != nil && len(line) == 0 {
+				return nil, err
+			}
+			for len(line) > 0 && (line[len(line)-1] == '\n' || line[len(line)-1] == '\r') {
+				line = line[:len(line)-1]
+			}
+			return line, nil
+		},
+		OnFailure: func(attempt, remaining int, delay time.Duration) {
+			fmt.Fprintf(os.Stderr, "Wrong password, %d attempts left.\n", remaining)
+		},
+	}
+	err = u.Unlock(ctx, func(password []byte) error {
+		var err error
+		key, err = sfx.Unlock(password)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	defer key.Destroy()
+	return decrypt(ctx, sfx, key, dst)
+}
+
+// decrypt writes the file to a temporary file next to dst and renames it
+// once decryption has succeeded, so no partial plaintext is left behind.
+func decrypt(ctx context.Context, sfx *fileencrypt.SelfExtracting, key *secure.SecureBuffer, dst string) error {
+	dec, err := fileencrypt.NewDecryptorFromSecureBuffer(key)
+	if err != nil {
+		return err
+	}
+	defer dec.Destroy()
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".fileencrypt-sfx-*")
+	if err != nil {
+		return err
+	}
+	err = dec.DecryptStream(ctx, sfx.Payload(), tmp)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		if _, serr := os.Lstat(dst); serr == nil {
+			err = fmt.Errorf("%s already exists", dst)
+		} else if !errors.Is(serr, os.ErrNotExist) {
+			err = serr
+		}
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), dst)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Decrypted %s\n", dst)
+	return nil
+}
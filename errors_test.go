@@ -8,8 +8,11 @@
 package fileencrypt_test
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
@@ -225,3 +228,82 @@ func TestDecryptFile_NonExistentSource(t *testing.T) {
 
 	t.Logf("Got expected error: %v", err)
 }
+
+func TestSentinelErrors(t *testing.T) {
+	ctx := context.Background()
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	wrongKey := make([]byte, 32)
+	if _, err := rand.Read(wrongKey); err != nil {
+		t.Fatalf("failed to generate wrong key: %v", err)
+	}
+
+	chunkOpt, err := fileencrypt.WithChunkSize(16)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	var encrypted bytes.Buffer
+	plaintext := bytes.Repeat([]byte("sentinel"), 8)
+	if err := fileencrypt.EncryptStream(ctx, bytes.NewReader(plaintext), &encrypted, key, chunkOpt); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+	ciphertext := encrypted.Bytes()
+
+	decrypt := func(data, k []byte) error {
+		return fileencrypt.DecryptStream(ctx, bytes.NewReader(data), io.Discard, k)
+	}
+
+	t.Run("wrong key", func(t *testing.T) {
+		err := decrypt(ciphertext, wrongKey)
+		if !errors.Is(err, fileencrypt.ErrWrongKey) || !errors.Is(err, fileencrypt.ErrAuthenticationFailed) {
+			t.Fatalf("expected ErrWrongKey and ErrAuthenticationFailed, got %v", err)
+		}
+	})
+
+	t.Run("corrupted later chunk", func(t *testing.T) {
+		tampered := append([]byte(nil), ciphertext...)
+		tampered[len(tampered)-40] ^= 0x01 // inside the last chunk, before the trailer
+		err := decrypt(tampered, key)
+		if !errors.Is(err, fileencrypt.ErrCorruptedFile) || !errors.Is(err, fileencrypt.ErrAuthenticationFailed) {
+			t.Fatalf("expected ErrCorruptedFile and ErrAuthenticationFailed, got %v", err)
+		}
+		if errors.Is(err, fileencrypt.ErrWrongKey) {
+			t.Fatalf("corruption after the first chunk must not report ErrWrongKey: %v", err)
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		err := decrypt(ciphertext[:len(ciphertext)-10], key)
+		if !errors.Is(err, fileencrypt.ErrCorruptedFile) {
+			t.Fatalf("expected ErrCorruptedFile, got %v", err)
+		}
+	})
+
+	t.Run("bad magic", func(t *testing.T) {
+		err := decrypt([]byte("not an encrypted file at all"), key)
+		if !errors.Is(err, fileencrypt.ErrCorruptedFile) {
+			t.Fatalf("expected ErrCorruptedFile, got %v", err)
+		}
+	})
+
+	t.Run("unsupported version", func(t *testing.T) {
+		future := append([]byte(nil), ciphertext...)
+		future[3] = 0xFF
+		err := decrypt(future, key)
+		if !errors.Is(err, fileencrypt.ErrUnsupportedVersion) {
+			t.Fatalf("expected ErrUnsupportedVersion, got %v", err)
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		err := fileencrypt.DecryptStream(canceled, bytes.NewReader(ciphertext), io.Discard, key)
+		if !errors.Is(err, fileencrypt.ErrContextCanceled) || !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected ErrContextCanceled and context.Canceled, got %v", err)
+		}
+	})
+}
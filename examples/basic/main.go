@@ -9,7 +9,6 @@ package main
 
 import (
 	"context"
-	"crypto/rand"
 	"fmt"
 	"log"
 	"os"
@@ -22,8 +21,8 @@ func main() {
 	fmt.Println()
 
 	// Step 1: Generate a random 32-byte key for AES-256
-	key := make([]byte, 32)
-	if _, err := rand.Read(key); err != nil {
+	key, err := fileencrypt.GenerateKey()
+	if err != nil {
 		log.Fatalf("Failed to generate key: %v", err)
 	}
 	defer fileencrypt.ZeroKey(key) // Always zero sensitive data
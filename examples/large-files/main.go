@@ -9,7 +9,7 @@ package main
 
 import (
 	"context"
-	"crypto/rand"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -23,8 +23,8 @@ func main() {
 	fmt.Println()
 
 	// Step 1: Generate encryption key
-	key := make([]byte, 32)
-	if _, err := rand.Read(key); err != nil {
+	key, err := fileencrypt.GenerateKey()
+	if err != nil {
 		log.Fatalf("Failed to generate key: %v", err)
 	}
 	defer fileencrypt.ZeroKey(key) // Always zero sensitive data
@@ -52,7 +52,15 @@ func main() {
 	fmt.Println("\nEncrypting (with 5 minute timeout)...")
 	startTime := time.Now()
 
-	chunkOpt, err := fileencrypt.WithChunkSize(1 * 1024 * 1024)
+	// Pick the chunk size that is fastest on this machine with a quick
+	// benchmark of a 16MB sample, instead of hardcoding one.
+	chunkSize, err := fileencrypt.TuneChunkSize(ctx, 16*1024*1024)
+	if err != nil {
+		log.Fatalf("Failed to tune chunk size: %v", err)
+	}
+	fmt.Printf("  Tuned chunk size: %dKB\n", chunkSize/1024)
+
+	chunkOpt, err := fileencrypt.WithChunkSize(chunkSize)
 	if err != nil {
 		log.Fatalf("Invalid chunk size: %v", err)
 	}
@@ -63,11 +71,11 @@ func main() {
 			bar := progressBar(progress, 40)
 			fmt.Printf("\r  Progress: %s %.1f%%", bar, percent)
 		}),
-		chunkOpt, // 1MB chunks
+		chunkOpt,
 	)
 
 	if err != nil {
-		if err == context.DeadlineExceeded {
+		if errors.Is(err, context.DeadlineExceeded) {
 			log.Fatalf("\nEncryption timed out - file too large or system too slow")
 		}
 		log.Fatalf("\nEncryption failed: %v", err)
@@ -0,0 +1,44 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// Command test-vectors writes the canonical go-fileencrypt test vectors as
+// JSON, to the file named by the first argument or to standard output.
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/gitrgoliveira/go-fileencrypt"
+)
+
+func main() {
+	var out io.WriteCloser = os.Stdout
+	if len(os.Args) > 1 {
+		f, err := os.Create(os.Args[1])
+		if err != nil {
+			log.Fatalf("create output: %v", err)
+		}
+		out = f
+	}
+
+	if err := fileencrypt.WriteTestVectors(out); err != nil {
+		log.Fatalf("write test vectors: %v", err)
+	}
+	if err := out.Close(); err != nil {
+		log.Fatalf("close output: %v", err)
+	}
+
+	vectors, err := fileencrypt.GenerateTestVectors()
+	if err != nil {
+		log.Fatalf("generate test vectors: %v", err)
+	}
+	for _, v := range vectors {
+		fmt.Fprintf(os.Stderr, "%-16s %3d plaintext bytes, %d chunks\n", v.Name, len(v.Plaintext)/2, len(v.Fields.Chunks))
+	}
+}
@@ -8,7 +8,6 @@ package main
 
 import (
 	"context"
-	"crypto/rand"
 	"fmt"
 	"log"
 	"os"
@@ -21,7 +20,7 @@ func main() {
 	tmp := os.TempDir()
 	src := filepath.Join(tmp, "example.txt")
 	enc := filepath.Join(tmp, "example.txt.enc")
-	sha := filepath.Join(tmp, "example.txt.sha256")
+	sha := enc + fileencrypt.SidecarExt
 
 	plaintext := []byte("Example data for checksum demo")
 	if err := os.WriteFile(src, plaintext, 0600); err != nil {
@@ -29,36 +28,28 @@ func main() {
 	}
 
 	// Generate key
-	key := make([]byte, 32)
-	if _, err := rand.Read(key); err != nil {
+	key, err := fileencrypt.GenerateKey()
+	if err != nil {
 		log.Fatalf("generate key: %v", err)
 	}
 	defer fileencrypt.ZeroKey(key)
 
 	ctx := context.Background()
 
-	// Encrypt file
-	if err := fileencrypt.EncryptFile(ctx, src, enc, key); err != nil {
+	// Encrypt file, writing the plaintext checksum sidecar in the same pass
+	if err := fileencrypt.EncryptFile(ctx, src, enc, key,
+		fileencrypt.WithChecksumSidecar(fileencrypt.SidecarPlaintext),
+	); err != nil {
 		log.Fatalf("encrypt: %v", err)
 	}
-
-	// Calculate checksum and save sidecar
-	sumHex, err := fileencrypt.CalculateChecksumHex(src)
-	if err != nil {
-		log.Fatalf("calculate checksum: %v", err)
-	}
-	if err := os.WriteFile(sha, []byte(sumHex), 0600); err != nil {
-		log.Fatalf("save checksum: %v", err)
-	}
 	fmt.Printf("Encrypted %s and saved checksum %s\n", enc, sha)
 
 	// Later: verify checksum
-	loadedBytes, err := os.ReadFile(sha) // #nosec G304: example reading a local checksum sidecar file (no user input)
+	sum, err := fileencrypt.ReadChecksumFile(sha)
 	if err != nil {
 		log.Fatalf("load checksum: %v", err)
 	}
-	loaded := string(loadedBytes)
-	ok, err := fileencrypt.VerifyChecksumHex(src, loaded)
+	ok, err := fileencrypt.VerifyChecksum(src, sum)
 	if err != nil {
 		log.Fatalf("verify checksum: %v", err)
 	}
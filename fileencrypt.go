@@ -27,14 +27,15 @@
 //
 //	import (
 //	    "context"
-//	    "crypto/rand"
 //	    "github.com/gitrgoliveira/go-fileencrypt"
 //	    "github.com/gitrgoliveira/go-fileencrypt/secure"
 //	)
 //
 //	// Generate a 32-byte encryption key
-//	key := make([]byte, 32)
-//	rand.Read(key)
+//	key, err := fileencrypt.GenerateKey()
+//	if err != nil {
+//	    return err
+//	}
 //	defer secure.Zero(key) // Always zero sensitive data
 //
 //	ctx := context.Background()
@@ -83,7 +84,7 @@
 // # Security Considerations
 //
 // Key Management:
-//   - Always use crypto/rand for key generation
+//   - Generate keys with GenerateKey or GenerateKeyInto (crypto/rand)
 //   - Never hardcode keys in source code
 //   - Always call secure.Zero(key) to clear keys from memory
 //   - Store keys securely (HSM, KMS, encrypted storage)
@@ -105,6 +106,8 @@ package fileencrypt
 import (
 	"context"
 	"io"
+	"os/exec"
+	"time"
 
 	"github.com/gitrgoliveira/go-fileencrypt/internal/core"
 	"github.com/gitrgoliveira/go-fileencrypt/secure"
@@ -113,21 +116,402 @@ import (
 // Option defines functional options for encryption/decryption (re-exported from internal/core).
 type Option = core.Option
 
+// Config holds the settings options apply; see Validate and FromEnv
+// (re-exported from internal/core).
+type Config = core.Config
+
+// KDFParams are the password-based key derivation parameters of a Config
+// (re-exported from internal/core).
+type KDFParams = core.KDFParams
+
+// DefaultConfig returns the default settings (re-exported from internal/core).
+var DefaultConfig = core.DefaultConfig
+
+// WithConfig replaces all settings with a Config (re-exported from internal/core).
+var WithConfig = core.WithConfig
+
 // WithChunkSize sets the chunk size for streaming operations (re-exported from internal/core).
 var WithChunkSize = core.WithChunkSize
 
+// OptionsBuilder collects settings and validates them together in Build
+// (re-exported from internal/core).
+type OptionsBuilder = core.OptionsBuilder
+
+// NewOptionsBuilder returns an empty OptionsBuilder (re-exported from
+// internal/core).
+var NewOptionsBuilder = core.NewOptionsBuilder
+
+// WithMaxChunkSizeLimit lowers the largest allowed chunk size (re-exported
+// from internal/core).
+var WithMaxChunkSizeLimit = core.WithMaxChunkSizeLimit
+
+// WithMaxAcceptedChunkSize caps the chunk size a Decryptor accepts from files
+// (re-exported from internal/core).
+var WithMaxAcceptedChunkSize = core.WithMaxAcceptedChunkSize
+
+// WithMaxChunks limits the chunks a Decryptor reads per operation
+// (re-exported from internal/core).
+var WithMaxChunks = core.WithMaxChunks
+
+// WithMaxInputSize limits the encrypted bytes a Decryptor reads per
+// operation (re-exported from internal/core).
+var WithMaxInputSize = core.WithMaxInputSize
+
 // WithProgress sets a progress callback (re-exported from internal/core).
 var WithProgress = core.WithProgress
 
+// WithChunkCallback sets a callback called after every chunk (re-exported
+// from internal/core).
+var WithChunkCallback = core.WithChunkCallback
+
+// ChunkInfo describes one processed chunk (re-exported from internal/core).
+type ChunkInfo = core.ChunkInfo
+
 // Re-export checksum helpers from internal/core so callers can compute/verify checksums.
 var CalculateChecksum = core.CalculateChecksum
 var CalculateChecksumHex = core.CalculateChecksumHex
 var VerifyChecksum = core.VerifyChecksum
 var VerifyChecksumHex = core.VerifyChecksumHex
+var CalculateFileHash = core.CalculateFileHash
+var CalculateChecksums = core.CalculateChecksums
+var ReadChecksumFile = core.ReadChecksumFile
+
+// ChecksumResult is the outcome of hashing one file with CalculateChecksums
+// (re-exported from internal/core).
+type ChecksumResult = core.ChecksumResult
+
+// NewBLAKE2b256 returns a BLAKE2b-256 hash, usually faster than SHA-256 on
+// CPUs without SHA extensions (re-exported from internal/core).
+var NewBLAKE2b256 = core.NewBLAKE2b256
 
-// WithAlgorithm sets the encryption algorithm (re-exported from internal/core).
+// WithChecksum computes the checksum of the output file and returns it in
+// OperationReport.Checksum (re-exported from internal/core).
+var WithChecksum = core.WithChecksum
+
+// WithChecksumHash selects the hash used by WithChecksum
+// (re-exported from internal/core).
+var WithChecksumHash = core.WithChecksumHash
+
+// WithChecksumSidecar writes a SHA-256 sidecar of the plaintext or the
+// output next to each encrypted file, hashed in the same pass
+// (re-exported from internal/core).
+var WithChecksumSidecar = core.WithChecksumSidecar
+
+// SidecarSource selects the data a checksum sidecar covers
+// (re-exported from internal/core).
+type SidecarSource = core.SidecarSource
+
+// Checksum sidecar sources (re-exported from internal/core).
+const (
+	SidecarNone       = core.SidecarNone
+	SidecarPlaintext  = core.SidecarPlaintext
+	SidecarCiphertext = core.SidecarCiphertext
+)
+
+// SidecarExt is the extension of checksum sidecars, ".sha256"
+// (re-exported from internal/core).
+const SidecarExt = core.SidecarExt
+
+// TuneChunkSize benchmarks candidate chunk sizes on this machine and returns
+// the fastest (re-exported from internal/core).
+var TuneChunkSize = core.TuneChunkSize
+
+// EstimateEncryptedSize returns the exact size of the encrypted output for a
+// plaintext size (re-exported from internal/core).
+var EstimateEncryptedSize = core.EstimateEncryptedSize
+
+// WithAlgorithm sets the encryption algorithm and restricts the algorithms a
+// Decryptor accepts (re-exported from internal/core).
 var WithAlgorithm = core.WithAlgorithm
 
+// WithAllowedAlgorithms restricts a Decryptor to files sealed with the listed
+// algorithms (re-exported from internal/core).
+var WithAllowedAlgorithms = core.WithAllowedAlgorithms
+
+// AlgorithmError reports a file sealed with an algorithm the Decryptor does
+// not accept (re-exported from internal/core).
+type AlgorithmError = core.AlgorithmError
+
+// Algorithm identifies a cipher (re-exported from internal/core).
+type Algorithm = core.Algorithm
+
+// Algorithms for WithAlgorithm.
+const (
+	// AlgorithmAESGCM is AES-256-GCM (default, currently supported).
+	AlgorithmAESGCM = core.AlgorithmAESGCM
+	// AlgorithmChaCha20Poly1305 is ChaCha20-Poly1305 (reserved for future).
+	AlgorithmChaCha20Poly1305 = core.AlgorithmChaCha20Poly1305
+	// AlgorithmMLKEMHybrid is ML-KEM hybrid post-quantum (reserved for future).
+	AlgorithmMLKEMHybrid = core.AlgorithmMLKEMHybrid
+)
+
+// CPUCapabilities reports hardware support for AES and GCM on the running
+// machine (re-exported from internal/core).
+type CPUCapabilities = core.CPUCapabilities
+
+// Capabilities detects AES-NI/PMULL and related CPU features
+// (re-exported from internal/core).
+var Capabilities = core.Capabilities
+
+// RecommendedAlgorithm returns the best supported algorithm for the running
+// machine (re-exported from internal/core).
+var RecommendedAlgorithm = core.RecommendedAlgorithm
+
+// WithChunkIndex appends an authenticated chunk index for random access with
+// NewIndexedReader (re-exported from internal/core).
+var WithChunkIndex = core.WithChunkIndex
+
+// WithChunkDigests adds a chunk index that also records the SHA-256 of every
+// chunk record, for verifying copies chunk by chunk (re-exported from
+// internal/core).
+var WithChunkDigests = core.WithChunkDigests
+
+// WithPadding pads plaintext so the encrypted size does not reveal the exact
+// plaintext size (re-exported from internal/core).
+var WithPadding = core.WithPadding
+
+// PaddingScheme chooses the padded size for WithPadding (re-exported from
+// internal/core).
+type PaddingScheme = core.PaddingScheme
+
+// PaddingPadme is the Padmé padding scheme (re-exported from internal/core).
+var PaddingPadme = core.PaddingPadme
+
+// PaddingBucket pads sizes to multiples of a bucket size (re-exported from
+// internal/core).
+var PaddingBucket = core.PaddingBucket
+
+// WithPipeline overlaps source reads, sealing and output writes in separate
+// goroutines during encryption (re-exported from internal/core).
+var WithPipeline = core.WithPipeline
+
+// ParallelismAuto sizes the sealing workers of a pipeline to the bottleneck
+// it measures (re-exported from internal/core).
+const ParallelismAuto = core.ParallelismAuto
+
+// WithParallelism seals the chunks of a pipelined encryption in several
+// goroutines (re-exported from internal/core).
+var WithParallelism = core.WithParallelism
+
+// WithCPUAffinity pins the sealing workers of a pipeline to CPUs
+// (re-exported from internal/core).
+var WithCPUAffinity = core.WithCPUAffinity
+
+// NodeCPUs lists the CPUs of a NUMA node for WithCPUAffinity (re-exported
+// from internal/core).
+var NodeCPUs = core.NodeCPUs
+
+// Priority controls how an operation competes with other work on the host
+// (re-exported from internal/core).
+type Priority = core.Priority
+
+// Priorities for WithPriority.
+const (
+	// PriorityNormal leaves scheduling unchanged (default).
+	PriorityNormal = core.PriorityNormal
+	// PriorityLow uses the lowest CPU and best-effort I/O priority.
+	PriorityLow = core.PriorityLow
+	// PriorityIdle additionally only uses the disk when it is otherwise idle (Linux).
+	PriorityIdle = core.PriorityIdle
+)
+
+// WithPriority lowers the CPU and I/O priority of operations
+// (re-exported from internal/core).
+var WithPriority = core.WithPriority
+
+// WithTimeout limits the duration of each operation (re-exported from
+// internal/core).
+var WithTimeout = core.WithTimeout
+
+// WithChunkDeadline fails operations in which no chunk completes in time
+// (re-exported from internal/core).
+var WithChunkDeadline = core.WithChunkDeadline
+
+// WithPreallocate reserves the space of output files before writing them
+// (re-exported from internal/core).
+var WithPreallocate = core.WithPreallocate
+
+// WithBackupHeader appends a copy of the header to encrypted files so that a
+// damaged header can be recovered (re-exported from internal/core).
+var WithBackupHeader = core.WithBackupHeader
+
+// WithHeaderCRC adds a checksum to the header of encrypted files so that a
+// damaged header is reported as ErrHeaderCorrupted (re-exported from
+// internal/core).
+var WithHeaderCRC = core.WithHeaderCRC
+
+// WithMultiSegment makes decryptors read several concatenated encrypted
+// files or streams as one input (re-exported from internal/core).
+var WithMultiSegment = core.WithMultiSegment
+
+// WithMasking makes encryptors mask their output so that it cannot be told
+// from random data (re-exported from internal/core).
+var WithMasking = core.WithMasking
+
+// MaskIVSize is the number of bytes WithMasking adds to a file
+// (re-exported from internal/core).
+const MaskIVSize = core.MaskIVSize
+
+// WithChunkDelay pauses between chunks to spread out I/O
+// (re-exported from internal/core).
+var WithChunkDelay = core.WithChunkDelay
+
+// ErrorDetail controls how much context returned errors carry (re-exported from internal/core).
+type ErrorDetail = core.ErrorDetail
+
+// Error detail levels for WithErrorDetail.
+const (
+	// ErrorDetailStandard returns errors with operational context but no file paths (default).
+	ErrorDetailStandard = core.ErrorDetailStandard
+	// ErrorDetailSanitized returns generic, user-safe messages.
+	ErrorDetailSanitized = core.ErrorDetailSanitized
+	// ErrorDetailVerbose returns *EncryptionError values with operation, path and chunk number.
+	ErrorDetailVerbose = core.ErrorDetailVerbose
+)
+
+// WithErrorDetail sets the error detail level (re-exported from internal/core).
+var WithErrorDetail = core.WithErrorDetail
+
+// EncryptionError carries the operation, path and chunk number of a failure
+// when ErrorDetailVerbose is selected (re-exported from internal/core).
+type EncryptionError = core.EncryptionError
+
+// DestinationError reports which writer passed to EncryptStreamTo failed
+// (re-exported from internal/core).
+type DestinationError = core.DestinationError
+
+// SanitizeError converts an error into a generic, user-safe message that still
+// matches its category with errors.Is (re-exported from internal/core).
+var SanitizeError = core.SanitizeError
+
+// OperationReport summarizes a completed encryption or decryption
+// (re-exported from internal/core).
+type OperationReport = core.OperationReport
+
+// WithReport fills the given OperationReport when an operation returns
+// (re-exported from internal/core).
+var WithReport = core.WithReport
+
+// WithPlaintextHash computes a digest of the plaintext in the same pass as
+// encryption or decryption and returns it in OperationReport.PlaintextHash
+// (re-exported from internal/core).
+var WithPlaintextHash = core.WithPlaintextHash
+
+// TestVector is one canonical encryption with a per-field breakdown of the
+// ciphertext (re-exported from internal/core).
+type TestVector = core.TestVector
+
+// TestVectorFields, TestVectorChunk and TestVectorTrailer describe the fields
+// of a TestVector's ciphertext (re-exported from internal/core).
+type (
+	TestVectorFields  = core.TestVectorFields
+	TestVectorChunk   = core.TestVectorChunk
+	TestVectorTrailer = core.TestVectorTrailer
+)
+
+// GenerateTestVectors returns the canonical test vector suite for the current
+// format version (re-exported from internal/core).
+var GenerateTestVectors = core.GenerateTestVectors
+
+// WriteTestVectors writes the canonical test vector suite to w as JSON, for
+// validating implementations of the format in other languages
+// (re-exported from internal/core).
+var WriteTestVectors = core.WriteTestVectors
+
+// Sentinel errors for branching on failure categories with errors.Is
+// (re-exported from internal/core).
+var (
+	// ErrAuthenticationFailed reports that encrypted data failed authentication.
+	ErrAuthenticationFailed = core.ErrAuthenticationFailed
+	// ErrWrongKey accompanies ErrAuthenticationFailed when the very first chunk
+	// fails to authenticate, which almost always means the key is wrong.
+	ErrWrongKey = core.ErrWrongKey
+	// ErrCorruptedFile reports malformed, truncated or tampered encrypted data.
+	ErrCorruptedFile = core.ErrCorruptedFile
+	// ErrUnsupportedVersion reports an unknown file format version.
+	ErrUnsupportedVersion = core.ErrUnsupportedVersion
+	// ErrUnsupportedFeature reports a file using an incompatible header flag
+	// this version cannot read, such as compression.
+	ErrUnsupportedFeature = core.ErrUnsupportedFeature
+	// ErrHeaderCorrupted reports a header whose WithHeaderCRC checksum does
+	// not match. It also matches ErrCorruptedFile.
+	ErrHeaderCorrupted = core.ErrHeaderCorrupted
+	// ErrContextCanceled reports that the context was canceled or timed out.
+	// The returned error also matches context.Canceled or context.DeadlineExceeded.
+	ErrContextCanceled = core.ErrContextCanceled
+	// ErrDestroyed reports use of an Encryptor or Decryptor after Destroy.
+	ErrDestroyed = core.ErrDestroyed
+	// ErrKeyExhausted reports that the message limit configured for a key has
+	// been reached.
+	ErrKeyExhausted = core.ErrKeyExhausted
+	// ErrTimeout reports that an operation exceeded WithTimeout or stalled
+	// past WithChunkDeadline. It also matches context.DeadlineExceeded, but
+	// not ErrContextCanceled.
+	ErrTimeout = core.ErrTimeout
+	// ErrNoSpace reports that the destination disk or quota is full. The
+	// partial output file has been removed.
+	ErrNoSpace = core.ErrNoSpace
+	// ErrTooManyAttempts reports that an Unlocker ran out of password
+	// attempts.
+	ErrTooManyAttempts = core.ErrTooManyAttempts
+	// ErrPartMismatch reports that the parts given to JoinParts are not the
+	// complete set of one split, in order.
+	ErrPartMismatch = core.ErrPartMismatch
+	// ErrOutputExists reports that an output name was already taken under
+	// CollisionFail.
+	ErrOutputExists = core.ErrOutputExists
+	// ErrSameFile reports that the output path of EncryptFile or
+	// DecryptFile names the input file. Use EncryptFileInPlace instead.
+	ErrSameFile = core.ErrSameFile
+	// ErrKeyExpired reports use of an Encryptor or Decryptor whose key
+	// expired with WithKeyContext or WithKeyDeadline. It matches
+	// ErrDestroyed.
+	ErrKeyExpired = core.ErrKeyExpired
+	// ErrSecretExpired reports a string sealed by EncryptString whose
+	// expiry has passed.
+	ErrSecretExpired = core.ErrSecretExpired
+	// ErrReadBack reports that the output read back with WithReadBack does
+	// not match what was written.
+	ErrReadBack = core.ErrReadBack
+	// ErrAlgorithmNotAllowed reports a file sealed with an algorithm outside
+	// WithAllowedAlgorithms or WithAlgorithm. It matches
+	// ErrUnsupportedFeature.
+	ErrAlgorithmNotAllowed = core.ErrAlgorithmNotAllowed
+	// ErrLimitExceeded reports an input that exceeds WithMaxChunks or
+	// WithMaxInputSize.
+	ErrLimitExceeded = core.ErrLimitExceeded
+)
+
+// Encryptor encrypts files and streams with one initialized key and cipher
+// (re-exported from internal/core). Reuse one Encryptor to process many files
+// efficiently, and call Destroy when done.
+type Encryptor = core.Encryptor
+
+// Decryptor decrypts files and streams with one initialized key and cipher
+// (re-exported from internal/core). Call Destroy when done.
+type Decryptor = core.Decryptor
+
+// NewEncryptor creates a reusable Encryptor (re-exported from internal/core).
+var NewEncryptor = core.NewEncryptor
+
+// NewDecryptor creates a reusable Decryptor (re-exported from internal/core).
+var NewDecryptor = core.NewDecryptor
+
+// NewEncryptorFromSecureBuffer creates a reusable Encryptor from a key held in
+// a SecureBuffer (re-exported from internal/core).
+var NewEncryptorFromSecureBuffer = core.NewEncryptorFromSecureBuffer
+
+// NewDecryptorFromSecureBuffer creates a reusable Decryptor from a key held in
+// a SecureBuffer (re-exported from internal/core).
+var NewDecryptorFromSecureBuffer = core.NewDecryptorFromSecureBuffer
+
+// BatchItem names one source/destination pair for Encryptor.EncryptFiles and
+// Decryptor.DecryptFiles (re-exported from internal/core).
+type BatchItem = core.BatchItem
+
+// BatchResult is the outcome of one BatchItem (re-exported from internal/core).
+type BatchResult = core.BatchResult
+
 // EncryptFile encrypts a file.
 func EncryptFile(ctx context.Context, srcPath, dstPath string, key []byte, opts ...Option) error {
 	// Convert public options to internal core options
@@ -140,9 +524,26 @@ func EncryptFile(ctx context.Context, srcPath, dstPath string, key []byte, opts
 	if err != nil {
 		return err
 	}
+	defer enc.Destroy()
 	return enc.EncryptFile(ctx, srcPath, dstPath)
 }
 
+// EncryptFileInPlace encrypts the file at path and atomically replaces it with
+// the encrypted version. It needs free space for one full encrypted copy in the
+// same directory until the replacement completes.
+func EncryptFileInPlace(ctx context.Context, path string, key []byte, opts ...Option) error {
+	coreOpts := make([]core.Option, len(opts))
+	for i, opt := range opts {
+		coreOpts[i] = core.Option(opt)
+	}
+	enc, err := core.NewEncryptor(key, coreOpts...)
+	if err != nil {
+		return err
+	}
+	defer enc.Destroy()
+	return enc.EncryptFileInPlace(ctx, path)
+}
+
 // DecryptFile decrypts a file.
 func DecryptFile(ctx context.Context, srcPath, dstPath string, key []byte, opts ...Option) error {
 	coreOpts := make([]core.Option, len(opts))
@@ -153,9 +554,175 @@ func DecryptFile(ctx context.Context, srcPath, dstPath string, key []byte, opts
 	if err != nil {
 		return err
 	}
+	defer dec.Destroy()
 	return dec.DecryptFile(ctx, srcPath, dstPath)
 }
 
+// Operation controls a background file operation started with
+// EncryptFileAsync or DecryptFileAsync (re-exported from internal/core).
+type Operation = core.Operation
+
+// JobManager tracks background operations by ID and reports their status
+// (re-exported from internal/core).
+type JobManager = core.JobManager
+
+// NewJobManager returns an empty JobManager (re-exported from internal/core).
+var NewJobManager = core.NewJobManager
+
+// JobID, JobState and JobStatus describe the jobs of a JobManager
+// (re-exported from internal/core).
+type (
+	JobID     = core.JobID
+	JobState  = core.JobState
+	JobStatus = core.JobStatus
+)
+
+// Job states (re-exported from internal/core).
+const (
+	JobRunning   = core.JobRunning
+	JobPaused    = core.JobPaused
+	JobSucceeded = core.JobSucceeded
+	JobFailed    = core.JobFailed
+	JobCanceled  = core.JobCanceled
+	JobQueued    = core.JobQueued
+)
+
+// ErrJobNotFound is returned by JobManager for an unknown or removed job
+// (re-exported from internal/core).
+var ErrJobNotFound = core.ErrJobNotFound
+
+// PartSet describes the split of a plaintext into independently encrypted
+// parts, written with Encryptor.EncryptPart and joined with
+// Decryptor.JoinParts (re-exported from internal/core).
+type PartSet = core.PartSet
+
+// NewPartSet returns a PartSet with a new random ID (re-exported from
+// internal/core).
+var NewPartSet = core.NewPartSet
+
+// EncryptFileAsync starts encrypting srcPath to dstPath in the background
+// and returns an Operation that can pause, resume or cancel it and reports
+// its progress. The key is released when the operation finishes.
+func EncryptFileAsync(ctx context.Context, srcPath, dstPath string, key []byte, opts ...Option) (*Operation, error) {
+	coreOpts := make([]core.Option, len(opts))
+	for i, opt := range opts {
+		coreOpts[i] = core.Option(opt)
+	}
+	enc, err := core.NewEncryptor(key, coreOpts...)
+	if err != nil {
+		return nil, err
+	}
+	op := enc.EncryptFileAsync(ctx, srcPath, dstPath)
+	go func() {
+		<-op.Done()
+		enc.Destroy()
+	}()
+	return op, nil
+}
+
+// DecryptFileAsync starts decrypting srcPath to dstPath in the background;
+// see EncryptFileAsync.
+func DecryptFileAsync(ctx context.Context, srcPath, dstPath string, key []byte, opts ...Option) (*Operation, error) {
+	coreOpts := make([]core.Option, len(opts))
+	for i, opt := range opts {
+		coreOpts[i] = core.Option(opt)
+	}
+	dec, err := core.NewDecryptor(key, coreOpts...)
+	if err != nil {
+		return nil, err
+	}
+	op := dec.DecryptFileAsync(ctx, srcPath, dstPath)
+	go func() {
+		<-op.Done()
+		dec.Destroy()
+	}()
+	return op, nil
+}
+
+// VerifyFile checks that an encrypted file authenticates with key without
+// writing any plaintext, e.g. to smoke-test backups in CI. WithProgress and
+// WithReport are honored.
+func VerifyFile(ctx context.Context, path string, key []byte, opts ...Option) error {
+	coreOpts := make([]core.Option, len(opts))
+	for i, opt := range opts {
+		coreOpts[i] = core.Option(opt)
+	}
+	dec, err := core.NewDecryptor(key, coreOpts...)
+	if err != nil {
+		return err
+	}
+	defer dec.Destroy()
+	return dec.VerifyFile(ctx, path)
+}
+
+// ScanFile authenticates every chunk of an encrypted file and reports the
+// status and byte ranges of each one, without stopping at damaged chunks, so
+// that the recoverable parts of a damaged file can be shown.
+func ScanFile(ctx context.Context, path string, key []byte, opts ...Option) (*ScanReport, error) {
+	coreOpts := make([]core.Option, len(opts))
+	for i, opt := range opts {
+		coreOpts[i] = core.Option(opt)
+	}
+	dec, err := core.NewDecryptor(key, coreOpts...)
+	if err != nil {
+		return nil, err
+	}
+	defer dec.Destroy()
+	return dec.ScanFile(ctx, path)
+}
+
+// ScanReport is the per-chunk result of ScanFile (re-exported from
+// internal/core).
+type ScanReport = core.ScanReport
+
+// ChunkScan describes one chunk record in a ScanReport (re-exported from
+// internal/core).
+type ChunkScan = core.ChunkScan
+
+// ChunkStatus is the state of a chunk found by ScanFile (re-exported from
+// internal/core).
+type ChunkStatus = core.ChunkStatus
+
+// Chunk states reported by ScanFile.
+const (
+	// ChunkOK marks a chunk that authenticated.
+	ChunkOK = core.ChunkOK
+	// ChunkAuthFailed marks a chunk that is present but damaged.
+	ChunkAuthFailed = core.ChunkAuthFailed
+	// ChunkTruncated marks a chunk cut short by the end of the file.
+	ChunkTruncated = core.ChunkTruncated
+)
+
+// MigrateFile upgrades a version 1 file to the current format in place,
+// authenticating every chunk and atomically replacing the file. Files already
+// in the current format are left untouched.
+func MigrateFile(ctx context.Context, path string, key []byte, opts ...Option) error {
+	coreOpts := make([]core.Option, len(opts))
+	for i, opt := range opts {
+		coreOpts[i] = core.Option(opt)
+	}
+	dec, err := core.NewDecryptor(key, coreOpts...)
+	if err != nil {
+		return err
+	}
+	defer dec.Destroy()
+	return dec.MigrateFile(ctx, path)
+}
+
+// MigrateDir runs MigrateFile on every version 1 file under dir.
+func MigrateDir(ctx context.Context, dir string, key []byte, opts ...Option) error {
+	coreOpts := make([]core.Option, len(opts))
+	for i, opt := range opts {
+		coreOpts[i] = core.Option(opt)
+	}
+	dec, err := core.NewDecryptor(key, coreOpts...)
+	if err != nil {
+		return err
+	}
+	defer dec.Destroy()
+	return dec.MigrateDir(ctx, dir)
+}
+
 // EncryptStream encrypts a stream.
 func EncryptStream(ctx context.Context, src io.Reader, dst io.Writer, key []byte, opts ...Option) error {
 	coreOpts := make([]core.Option, len(opts))
@@ -166,9 +733,26 @@ func EncryptStream(ctx context.Context, src io.Reader, dst io.Writer, key []byte
 	if err != nil {
 		return err
 	}
+	defer enc.Destroy()
 	return enc.EncryptStream(ctx, src, dst)
 }
 
+// EncryptStreamTo encrypts a stream once and writes the ciphertext to every
+// writer in dsts. A failing writer is dropped and reported as a
+// *DestinationError after the others have received the complete ciphertext.
+func EncryptStreamTo(ctx context.Context, src io.Reader, dsts []io.Writer, key []byte, opts ...Option) error {
+	coreOpts := make([]core.Option, len(opts))
+	for i, opt := range opts {
+		coreOpts[i] = core.Option(opt)
+	}
+	enc, err := core.NewEncryptor(key, coreOpts...)
+	if err != nil {
+		return err
+	}
+	defer enc.Destroy()
+	return enc.EncryptStreamTo(ctx, src, dsts)
+}
+
 // DecryptStream decrypts a stream.
 func DecryptStream(ctx context.Context, src io.Reader, dst io.Writer, key []byte, opts ...Option) error {
 	coreOpts := make([]core.Option, len(opts))
@@ -179,9 +763,541 @@ func DecryptStream(ctx context.Context, src io.Reader, dst io.Writer, key []byte
 	if err != nil {
 		return err
 	}
+	defer dec.Destroy()
 	return dec.DecryptStream(ctx, src, dst)
 }
 
+// EncryptFromCommand runs cmd and encrypts its standard output to dst, such
+// as a database dump. A command that exits unsuccessfully is reported and
+// leaves dst without a trailer, so the partial output cannot be decrypted.
+func EncryptFromCommand(ctx context.Context, cmd *exec.Cmd, dst io.Writer, key []byte, opts ...Option) error {
+	coreOpts := make([]core.Option, len(opts))
+	for i, opt := range opts {
+		coreOpts[i] = core.Option(opt)
+	}
+	enc, err := core.NewEncryptor(key, coreOpts...)
+	if err != nil {
+		return err
+	}
+	defer enc.Destroy()
+	return enc.EncryptFromCommand(ctx, cmd, dst)
+}
+
+// DecryptToCommand runs cmd and decrypts src into its standard input, such
+// as a database restore. The command is killed instead of seeing the end of
+// its input if src fails to decrypt.
+func DecryptToCommand(ctx context.Context, src io.Reader, cmd *exec.Cmd, key []byte, opts ...Option) error {
+	coreOpts := make([]core.Option, len(opts))
+	for i, opt := range opts {
+		coreOpts[i] = core.Option(opt)
+	}
+	dec, err := core.NewDecryptor(key, coreOpts...)
+	if err != nil {
+		return err
+	}
+	defer dec.Destroy()
+	return dec.DecryptToCommand(ctx, src, cmd)
+}
+
+// StreamWriter encrypts what is written to it; create one with
+// Encryptor.EncryptWriter (re-exported from internal/core).
+type StreamWriter = core.StreamWriter
+
+// ZipWriter is a zip.Writer whose output is encrypted; create one with
+// Encryptor.NewZipWriter (re-exported from internal/core).
+type ZipWriter = core.ZipWriter
+
+// TarWriter is a tar.Writer whose output is encrypted; create one with
+// Encryptor.NewTarWriter (re-exported from internal/core).
+type TarWriter = core.TarWriter
+
+// EncryptingCommandRunner runs dump commands and encrypts each one's output
+// to a file, recording it in the Encryptor's manifest. Create one with
+// Encryptor.NewCommandRunner (re-exported from internal/core).
+type EncryptingCommandRunner = core.EncryptingCommandRunner
+
+// EncryptReader returns an io.Reader yielding the encrypted form of src, for
+// use with APIs that take a reader, such as http.Request bodies or object
+// storage uploads. Data is encrypted lazily as it is read.
+func EncryptReader(ctx context.Context, src io.Reader, key []byte, opts ...Option) (io.Reader, error) {
+	coreOpts := make([]core.Option, len(opts))
+	for i, opt := range opts {
+		coreOpts[i] = core.Option(opt)
+	}
+	enc, err := core.NewEncryptor(key, coreOpts...)
+	if err != nil {
+		return nil, err
+	}
+	// The reader holds its own initialized cipher, so the key copy can go now.
+	defer enc.Destroy()
+	return enc.EncryptReader(ctx, src)
+}
+
+// DecryptReader returns an io.Reader yielding the decrypted form of src.
+// Only io.EOF proves the stream was complete; any other error invalidates the
+// data read so far.
+func DecryptReader(ctx context.Context, src io.Reader, key []byte, opts ...Option) (io.Reader, error) {
+	coreOpts := make([]core.Option, len(opts))
+	for i, opt := range opts {
+		coreOpts[i] = core.Option(opt)
+	}
+	dec, err := core.NewDecryptor(key, coreOpts...)
+	if err != nil {
+		return nil, err
+	}
+	// The reader holds its own initialized cipher, so the key copy can go now.
+	defer dec.Destroy()
+	return dec.DecryptReader(ctx, src)
+}
+
+// IndexedReader provides random access to the plaintext of a file encrypted
+// with WithChunkIndex (re-exported from internal/core).
+type IndexedReader = core.IndexedReader
+
+// NewIndexedReader returns an io.ReaderAt over the plaintext of the encrypted
+// file src of size bytes, which must have been encrypted with WithChunkIndex.
+// Only the chunks overlapping each read are decrypted.
+func NewIndexedReader(src io.ReaderAt, size int64, key []byte, opts ...Option) (*IndexedReader, error) {
+	coreOpts := make([]core.Option, len(opts))
+	for i, opt := range opts {
+		coreOpts[i] = core.Option(opt)
+	}
+	dec, err := core.NewDecryptor(key, coreOpts...)
+	if err != nil {
+		return nil, err
+	}
+	// The reader holds its own initialized cipher, so the key copy can go now.
+	defer dec.Destroy()
+	return dec.NewIndexedReader(src, size)
+}
+
+// ChunkDigest is the digest of one chunk record, returned by
+// IndexedReader.ChunkDigests (re-exported from internal/core).
+type ChunkDigest = core.ChunkDigest
+
+// CompareChunkDigests returns the chunks of a copy of an encrypted file whose
+// bytes do not match their digests. It needs no key (re-exported from
+// internal/core).
+var CompareChunkDigests = core.CompareChunkDigests
+
+// LogWriter appends encrypted records to a log file (re-exported from
+// internal/core).
+type LogWriter = core.LogWriter
+
+// OpenLog opens the encrypted log at path for appending, creating it if it
+// does not exist. Each Write on the returned LogWriter is sealed as an
+// independent authenticated record; DecryptFile reads the whole log.
+func OpenLog(path string, key []byte, opts ...Option) (*LogWriter, error) {
+	coreOpts := make([]core.Option, len(opts))
+	for i, opt := range opts {
+		coreOpts[i] = core.Option(opt)
+	}
+	enc, err := core.NewEncryptor(key, coreOpts...)
+	if err != nil {
+		return nil, err
+	}
+	// The writer holds its own initialized cipher, so the key copy can go now.
+	defer enc.Destroy()
+	return enc.OpenLog(path)
+}
+
+// Follow decrypts the encrypted log at path and calls fn with each record as
+// it is completely written, like tail -f, until ctx is done or fn returns an
+// error. The record slice is only valid during the call.
+func Follow(ctx context.Context, path string, key []byte, fn func(record []byte) error, opts ...Option) error {
+	coreOpts := make([]core.Option, len(opts))
+	for i, opt := range opts {
+		coreOpts[i] = core.Option(opt)
+	}
+	dec, err := core.NewDecryptor(key, coreOpts...)
+	if err != nil {
+		return err
+	}
+	defer dec.Destroy()
+	return dec.Follow(ctx, path, fn)
+}
+
+// RecordOverhead is the number of bytes EncryptRecord adds to a message
+// (re-exported from internal/core).
+const RecordOverhead = core.RecordOverhead
+
+// EncryptRecord seals a small message, such as a database field, as one
+// authenticated record bound to aad (e.g. its row key). For many records,
+// create an Encryptor once and use its EncryptRecord method.
+func EncryptRecord(plaintext, aad, key []byte, opts ...Option) ([]byte, error) {
+	coreOpts := make([]core.Option, len(opts))
+	for i, opt := range opts {
+		coreOpts[i] = core.Option(opt)
+	}
+	enc, err := core.NewEncryptor(key, coreOpts...)
+	if err != nil {
+		return nil, err
+	}
+	defer enc.Destroy()
+	return enc.EncryptRecord(plaintext, aad)
+}
+
+// DecryptRecord opens a record produced by EncryptRecord with the same aad.
+func DecryptRecord(record, aad, key []byte, opts ...Option) ([]byte, error) {
+	coreOpts := make([]core.Option, len(opts))
+	for i, opt := range opts {
+		coreOpts[i] = core.Option(opt)
+	}
+	dec, err := core.NewDecryptor(key, coreOpts...)
+	if err != nil {
+		return nil, err
+	}
+	defer dec.Destroy()
+	return dec.DecryptRecord(record, aad)
+}
+
+// EncryptString seals a short secret as a string that expires ttl from now
+// (never if zero), bound to aad, and zeroes secret. For many secrets, create
+// an Encryptor once and use its EncryptString method.
+func EncryptString(secret []byte, ttl time.Duration, aad, key []byte, opts ...Option) (string, error) {
+	defer secure.Zero(secret)
+	enc, err := core.NewEncryptor(key, opts...)
+	if err != nil {
+		return "", err
+	}
+	defer enc.Destroy()
+	return enc.EncryptString(secret, ttl, aad)
+}
+
+// DecryptString opens a string sealed by EncryptString with the same aad.
+// The caller must Destroy the returned buffer.
+func DecryptString(s string, aad, key []byte, opts ...Option) (*secure.SecureBuffer, error) {
+	dec, err := core.NewDecryptor(key, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer dec.Destroy()
+	return dec.DecryptString(s, aad)
+}
+
+// EncryptedFileSuffix is appended to file names by EncryptDir and removed by
+// DecryptDir (re-exported from internal/core).
+const EncryptedFileSuffix = core.EncryptedFileSuffix
+
+// Manifest lists the files written by EncryptDir (re-exported from internal/core).
+type Manifest = core.Manifest
+
+// ManifestEntry describes one file in a Manifest (re-exported from internal/core).
+type ManifestEntry = core.ManifestEntry
+
+// ManifestVerdict is the outcome of checking one manifest entry with
+// VerifyManifestFiles (re-exported from internal/core).
+type ManifestVerdict = core.ManifestVerdict
+
+// WithManifest makes EncryptDir write a signed manifest to path
+// (re-exported from internal/core).
+var WithManifest = core.WithManifest
+
+// ManifestTrust selects the public-key signatures a manifest must carry
+// (re-exported from internal/core).
+type ManifestTrust = core.ManifestTrust
+
+// WithManifestSigner makes EncryptDir sign its manifest with an Ed25519,
+// ECDSA or RSA key, optionally with its X.509 certificate chain
+// (re-exported from internal/core).
+var WithManifestSigner = core.WithManifestSigner
+
+// WithManifestTrust makes decryptors reject manifests without a signature
+// that trust accepts (re-exported from internal/core).
+var WithManifestTrust = core.WithManifestTrust
+
+// VerifyManifestSignature checks the public-key signature of a manifest
+// without the encryption key (re-exported from internal/core).
+var VerifyManifestSignature = core.VerifyManifestSignature
+
+// NonceManager hands out counter-based base nonces persisted in a file
+// (re-exported from internal/core).
+type NonceManager = core.NonceManager
+
+// OpenNonceManager opens or creates a nonce counter file with a message limit
+// (re-exported from internal/core).
+var OpenNonceManager = core.OpenNonceManager
+
+// WithNonceManager draws base nonces from a NonceManager instead of
+// crypto/rand (re-exported from internal/core).
+var WithNonceManager = core.WithNonceManager
+
+// WithKeyContext destroys the key once ctx is done; later operations fail
+// with ErrKeyExpired (re-exported from internal/core).
+var WithKeyContext = core.WithKeyContext
+
+// WithKeyDeadline destroys the key at a deadline; later operations fail
+// with ErrKeyExpired (re-exported from internal/core).
+var WithKeyDeadline = core.WithKeyDeadline
+
+// ReadBackOpener opens an uploaded object for WithReadBack (re-exported from
+// internal/core).
+type ReadBackOpener = core.ReadBackOpener
+
+// WithReadBack verifies streamed output by reading it back from where it was
+// uploaded (re-exported from internal/core).
+var WithReadBack = core.WithReadBack
+
+// WithRand draws base nonces from r instead of crypto/rand, e.g. a hardware
+// RNG or FIPS DRBG (re-exported from internal/core).
+var WithRand = core.WithRand
+
+// KeyUsage is the amount of data encrypted under a key (re-exported from
+// internal/core).
+type KeyUsage = core.KeyUsage
+
+// KeyLimits configures usage limits for WithKeyLimits (re-exported from
+// internal/core).
+type KeyLimits = core.KeyLimits
+
+// Default key usage limits for AES-GCM (re-exported from internal/core).
+const (
+	DefaultMessageLimit = core.DefaultMessageLimit
+	DefaultByteLimit    = core.DefaultByteLimit
+)
+
+// WithKeyLimits enforces message and byte limits on the encryption key
+// (re-exported from internal/core).
+var WithKeyLimits = core.WithKeyLimits
+
+// AuditEvent describes one completed operation (re-exported from internal/core).
+type AuditEvent = core.AuditEvent
+
+// AuditSink receives audit events (re-exported from internal/core).
+type AuditSink = core.AuditSink
+
+// AuditFunc adapts a function to an AuditSink (re-exported from internal/core).
+type AuditFunc = core.AuditFunc
+
+// WithAuditSink sends an AuditEvent for every operation to a sink
+// (re-exported from internal/core).
+var WithAuditSink = core.WithAuditSink
+
+// KeyFingerprintSize is the length of a key fingerprint in hex characters.
+const KeyFingerprintSize = core.KeyFingerprintSize
+
+// KeyFingerprint returns a short, stable identifier of a key, the KeyID of
+// audit events (re-exported from internal/core).
+var KeyFingerprint = core.KeyFingerprint
+
+// KeyFingerprintMatches reports in constant time whether a fingerprint
+// belongs to a key (re-exported from internal/core).
+var KeyFingerprintMatches = core.KeyFingerprintMatches
+
+// ContextWithActor attributes the operations run with a context to an actor
+// in audit events (re-exported from internal/core).
+var ContextWithActor = core.ContextWithActor
+
+// DryRunPlan lists what an encryption would do (re-exported from
+// internal/core).
+type DryRunPlan = core.DryRunPlan
+
+// PlannedFile is one entry of a DryRunPlan (re-exported from internal/core).
+type PlannedFile = core.PlannedFile
+
+// WithDryRun fills a DryRunPlan instead of encrypting (re-exported from
+// internal/core).
+var WithDryRun = core.WithDryRun
+
+// WithObfuscatedNames makes EncryptDir write HMAC-derived file names and keep
+// the real names in the encrypted manifest (re-exported from internal/core).
+var WithObfuscatedNames = core.WithObfuscatedNames
+
+// WithInclude limits batch and directory operations to files matching at least
+// one glob pattern (re-exported from internal/core).
+var WithInclude = core.WithInclude
+
+// WithExclude skips files and directories matching any glob pattern in batch
+// and directory operations (re-exported from internal/core).
+var WithExclude = core.WithExclude
+
+// WithFilter skips files for which pred returns false in batch and directory
+// operations (re-exported from internal/core).
+var WithFilter = core.WithFilter
+
+// SymlinkPolicy controls how directory operations treat symbolic links
+// (re-exported from internal/core).
+type SymlinkPolicy = core.SymlinkPolicy
+
+// Symlink policies for WithSymlinkPolicy.
+const (
+	// SymlinkSkip ignores symbolic links (default).
+	SymlinkSkip = core.SymlinkSkip
+	// SymlinkFollow processes link targets as part of the tree, without revisiting directories.
+	SymlinkFollow = core.SymlinkFollow
+	// SymlinkPreserve recreates links with the same (unencrypted) target.
+	SymlinkPreserve = core.SymlinkPreserve
+)
+
+// WithSymlinkPolicy sets how EncryptDir and DecryptDir treat symbolic links
+// (re-exported from internal/core).
+var WithSymlinkPolicy = core.WithSymlinkPolicy
+
+// CollisionPolicy controls what directory operations and the batch planning
+// helpers do when an output name is already taken (re-exported from
+// internal/core).
+type CollisionPolicy = core.CollisionPolicy
+
+// Collision policies for WithCollisionPolicy.
+const (
+	// CollisionOverwrite replaces existing outputs (default).
+	CollisionOverwrite = core.CollisionOverwrite
+	// CollisionFail fails with ErrOutputExists.
+	CollisionFail = core.CollisionFail
+	// CollisionRename numbers the plaintext name, "report-1.pdf", until the
+	// output name is free.
+	CollisionRename = core.CollisionRename
+)
+
+// WithCollisionPolicy sets what happens when an output name is already taken
+// (re-exported from internal/core).
+var WithCollisionPolicy = core.WithCollisionPolicy
+
+// WithSuffix sets the suffix appended to encrypted file names instead of
+// EncryptedFileSuffix (re-exported from internal/core).
+var WithSuffix = core.WithSuffix
+
+// EncryptDir encrypts every regular file under srcDir into dstDir, keeping the
+// relative layout and appending EncryptedFileSuffix. Use WithManifest to record
+// a signed manifest for later auditing with VerifyManifest.
+func EncryptDir(ctx context.Context, srcDir, dstDir string, key []byte, opts ...Option) error {
+	coreOpts := make([]core.Option, len(opts))
+	for i, opt := range opts {
+		coreOpts[i] = core.Option(opt)
+	}
+	enc, err := core.NewEncryptor(key, coreOpts...)
+	if err != nil {
+		return err
+	}
+	defer enc.Destroy()
+	return enc.EncryptDir(ctx, srcDir, dstDir)
+}
+
+// DecryptDir decrypts every file ending in EncryptedFileSuffix under srcDir
+// into dstDir, keeping the relative layout.
+func DecryptDir(ctx context.Context, srcDir, dstDir string, key []byte, opts ...Option) error {
+	coreOpts := make([]core.Option, len(opts))
+	for i, opt := range opts {
+		coreOpts[i] = core.Option(opt)
+	}
+	dec, err := core.NewDecryptor(key, coreOpts...)
+	if err != nil {
+		return err
+	}
+	defer dec.Destroy()
+	return dec.DecryptDir(ctx, srcDir, dstDir)
+}
+
+// SnapshotInfo identifies the run that wrote a manifest (re-exported from
+// internal/core).
+type SnapshotInfo = core.SnapshotInfo
+
+// Snapshot is a snapshot found by ListSnapshots (re-exported from
+// internal/core).
+type Snapshot = core.Snapshot
+
+// RetentionPolicy selects the snapshots PruneSnapshots keeps (re-exported
+// from internal/core).
+type RetentionPolicy = core.RetentionPolicy
+
+// SnapshotManifestExt is the extension of the manifests ListSnapshots reads
+// (re-exported from internal/core).
+const SnapshotManifestExt = core.SnapshotManifestExt
+
+// WithSnapshot records a snapshot ID, time and labels in the manifests
+// EncryptDir and SyncDir write (re-exported from internal/core).
+var WithSnapshot = core.WithSnapshot
+
+// ApplyRetention splits snapshots into those a policy keeps and those it
+// prunes (re-exported from internal/core).
+var ApplyRetention = core.ApplyRetention
+
+// ListSnapshots returns the snapshots recorded by the manifests in dir,
+// oldest first, verifying each with key.
+func ListSnapshots(dir string, key []byte, opts ...Option) ([]Snapshot, error) {
+	coreOpts := make([]core.Option, len(opts))
+	for i, opt := range opts {
+		coreOpts[i] = core.Option(opt)
+	}
+	dec, err := core.NewDecryptor(key, coreOpts...)
+	if err != nil {
+		return nil, err
+	}
+	defer dec.Destroy()
+	return dec.ListSnapshots(dir)
+}
+
+// PruneSnapshots removes the manifests in dir of the snapshots policy does
+// not keep and returns those snapshots; their encrypted files are left to
+// the caller.
+func PruneSnapshots(dir string, policy RetentionPolicy, key []byte, opts ...Option) ([]Snapshot, error) {
+	coreOpts := make([]core.Option, len(opts))
+	for i, opt := range opts {
+		coreOpts[i] = core.Option(opt)
+	}
+	dec, err := core.NewDecryptor(key, coreOpts...)
+	if err != nil {
+		return nil, err
+	}
+	defer dec.Destroy()
+	return dec.PruneSnapshots(dir, policy)
+}
+
+// SyncResult lists what SyncDir did (re-exported from internal/core).
+type SyncResult = core.SyncResult
+
+// WithTombstones makes SyncDir keep the encrypted files of removed sources
+// and mark them deleted in the manifest (re-exported from internal/core).
+var WithTombstones = core.WithTombstones
+
+// SyncDir mirrors srcDir into dstDir incrementally: only files that are new
+// or whose size or modification time changed since the manifest named by
+// WithManifest was written are encrypted, and the encrypted files of removed
+// sources are deleted, or tombstoned with WithTombstones.
+func SyncDir(ctx context.Context, srcDir, dstDir string, key []byte, opts ...Option) (*SyncResult, error) {
+	coreOpts := make([]core.Option, len(opts))
+	for i, opt := range opts {
+		coreOpts[i] = core.Option(opt)
+	}
+	enc, err := core.NewEncryptor(key, coreOpts...)
+	if err != nil {
+		return nil, err
+	}
+	defer enc.Destroy()
+	return enc.SyncDir(ctx, srcDir, dstDir)
+}
+
+// VerifyManifest checks the manifest signature and that every listed file in
+// encDir matches its recorded ciphertext hash, size and plaintext hash.
+func VerifyManifest(ctx context.Context, manifestPath, encDir string, key []byte, opts ...Option) error {
+	coreOpts := make([]core.Option, len(opts))
+	for i, opt := range opts {
+		coreOpts[i] = core.Option(opt)
+	}
+	dec, err := core.NewDecryptor(key, coreOpts...)
+	if err != nil {
+		return err
+	}
+	defer dec.Destroy()
+	return dec.VerifyManifest(ctx, manifestPath, encDir)
+}
+
+// VerifyManifestFiles checks the manifest signature and then every listed
+// file in encDir concurrently, returning one verdict per file instead of
+// stopping at the first mismatch.
+func VerifyManifestFiles(ctx context.Context, manifestPath, encDir string, key []byte, workers int, opts ...Option) ([]ManifestVerdict, error) {
+	coreOpts := make([]core.Option, len(opts))
+	for i, opt := range opts {
+		coreOpts[i] = core.Option(opt)
+	}
+	dec, err := core.NewDecryptor(key, coreOpts...)
+	if err != nil {
+		return nil, err
+	}
+	defer dec.Destroy()
+	return dec.VerifyManifestFiles(ctx, manifestPath, encDir, workers)
+}
+
 // Re-export key derivation constants from internal/core
 const (
 	DefaultPBKDF2Iterations = core.DefaultPBKDF2Iterations
@@ -214,8 +1330,87 @@ func DeriveKeyArgon2(password, salt []byte, time, memory uint32, threads uint8,
 	return core.DeriveKeyArgon2(password, salt, time, memory, threads, keyLen)
 }
 
+// GenerateKey returns a new random 32-byte AES-256 key. Zero it with
+// secure.Zero when done.
+// Re-exported from internal/core for public API.
+func GenerateKey() ([]byte, error) {
+	return core.GenerateKey()
+}
+
+// GenerateKeyInto fills a 32-byte SecureBuffer with a new random key, so the
+// key is created in locked memory.
+// Re-exported from internal/core for public API.
+func GenerateKeyInto(buf *secure.SecureBuffer) error {
+	return core.GenerateKeyInto(buf)
+}
+
 // GenerateSalt generates a random salt of the specified size.
 // Re-exported from internal/core for public API.
 func GenerateSalt(size int) ([]byte, error) {
 	return core.GenerateSalt(size)
 }
+
+// GenerateSaltFrom generates a salt of the specified size read from random.
+// Re-exported from internal/core for public API.
+func GenerateSaltFrom(random io.Reader, size int) ([]byte, error) {
+	return core.GenerateSaltFrom(random, size)
+}
+
+// KeyFileInfo is the authenticated metadata of a key container file
+// (re-exported from internal/core).
+type KeyFileInfo = core.KeyFileInfo
+
+// SaveKeyFile writes a 32-byte key to a container file encrypted under a
+// password, with an Argon2id-derived key encryption key.
+// Re-exported from internal/core for public API.
+func SaveKeyFile(path string, key, password []byte, info KeyFileInfo) error {
+	return core.SaveKeyFile(path, key, password, info)
+}
+
+// LoadKeyFile decrypts the key in a container file written by SaveKeyFile.
+// The caller must Destroy the returned buffer.
+// Re-exported from internal/core for public API.
+func LoadKeyFile(path string, password []byte) (*secure.SecureBuffer, KeyFileInfo, error) {
+	return core.LoadKeyFile(path, password)
+}
+
+// MarshalKeyFile returns a key container as SaveKeyFile writes it.
+// Re-exported from internal/core for public API.
+func MarshalKeyFile(key, password []byte, info KeyFileInfo) ([]byte, error) {
+	return core.MarshalKeyFile(key, password, info)
+}
+
+// UnmarshalKeyFile decrypts the key in a container returned by
+// MarshalKeyFile. The caller must Destroy the returned buffer.
+// Re-exported from internal/core for public API.
+func UnmarshalKeyFile(data, password []byte) (*secure.SecureBuffer, KeyFileInfo, error) {
+	return core.UnmarshalKeyFile(data, password)
+}
+
+// Unlocker prompts for passwords with an attempt limit and growing delays
+// between wrong ones (re-exported from internal/core).
+type Unlocker = core.Unlocker
+
+// Defaults of an Unlocker (re-exported from internal/core).
+const (
+	DefaultUnlockAttempts = core.DefaultUnlockAttempts
+	DefaultUnlockDelay    = core.DefaultUnlockDelay
+	DefaultUnlockMaxDelay = core.DefaultUnlockMaxDelay
+)
+
+// SelfExtracting is a self-extracting file opened with OpenSelfExtracting
+// (re-exported from internal/core).
+type SelfExtracting = core.SelfExtracting
+
+// WriteSelfExtracting writes src encrypted under password after an
+// executable stub, so the recipient can run the file to decrypt it.
+// Re-exported from internal/core for public API.
+func WriteSelfExtracting(ctx context.Context, dst io.Writer, stub, src io.Reader, name string, password []byte, opts ...Option) error {
+	return core.WriteSelfExtracting(ctx, dst, stub, src, name, password, opts...)
+}
+
+// OpenSelfExtracting reads the footer of a self-extracting file.
+// Re-exported from internal/core for public API.
+func OpenSelfExtracting(r io.ReaderAt, size int64) (*SelfExtracting, error) {
+	return core.OpenSelfExtracting(r, size)
+}
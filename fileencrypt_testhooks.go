@@ -0,0 +1,17 @@
+//go:build testhooks
+// +build testhooks
+
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package fileencrypt
+
+import "github.com/gitrgoliveira/go-fileencrypt/internal/core"
+
+// WithDeterministicNonce makes encryption output reproducible from seed, for
+// generating known-answer test vectors only (re-exported from internal/core).
+// It is compiled only with the 'testhooks' build tag; never use it for real data.
+var WithDeterministicNonce = core.WithDeterministicNonce
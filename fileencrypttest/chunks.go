@@ -0,0 +1,139 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// chunks.go: Corruptors aware of the chunk layout
+package fileencrypttest
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/gitrgoliveira/go-fileencrypt/format"
+)
+
+// span is the position of one chunk record, length prefix included.
+type span struct {
+	start, end int
+}
+
+// chunkSpans locates the chunk records of ciphertext. It stops at the first
+// record that is structurally damaged, so corruptors can be chained; it
+// panics if the header cannot be read, since no chunk can be found then.
+func chunkSpans(ciphertext []byte) (headerLen int, spans []span) {
+	r, err := format.NewReader(bytes.NewReader(ciphertext))
+	if err != nil {
+		panic(fmt.Sprintf("fileencrypttest: cannot locate chunks: %v", err))
+	}
+	for {
+		c, err := r.Next()
+		if err != nil {
+			break
+		}
+		start := int(c.Offset)
+		spans = append(spans, span{start, start + format.LengthSize + len(c.Sealed)})
+	}
+	return r.Header().Len(), spans
+}
+
+// chunkSpan returns the span of chunk index, counting back from the last
+// chunk if index is negative. It panics if there is no such chunk.
+func chunkSpan(spans []span, index int) span {
+	if index < 0 {
+		index += len(spans)
+	}
+	if index < 0 || index >= len(spans) {
+		panic(fmt.Sprintf("fileencrypttest: no chunk %d in a file of %d chunks", index, len(spans)))
+	}
+	return spans[index]
+}
+
+// chunksEnd returns the offset just past the last chunk record.
+func chunksEnd(headerLen int, spans []span) int {
+	if len(spans) == 0 {
+		return headerLen
+	}
+	return spans[len(spans)-1].end
+}
+
+// ChunkCount returns the number of chunk records in ciphertext, for
+// choosing the indices passed to the chunk corruptors.
+func ChunkCount(ciphertext []byte) int {
+	_, spans := chunkSpans(ciphertext)
+	return len(spans)
+}
+
+// FlipChunkBit returns a Corruptor that inverts bit number bit of the sealed
+// data of chunk index (its ciphertext and tag, not the length prefix).
+// Negative values count back from the last chunk and the last bit, so
+// FlipChunkBit(-1, -1) damages the tag of the final chunk. Like every chunk
+// corruptor it panics if the chunk does not exist.
+func FlipChunkBit(index, bit int) Corruptor {
+	return func(ciphertext []byte) []byte {
+		_, spans := chunkSpans(ciphertext)
+		s := chunkSpan(spans, index)
+		out := append([]byte(nil), ciphertext...)
+		copy(out[s.start+format.LengthSize:], FlipBit(bit)(ciphertext[s.start+format.LengthSize:s.end]))
+		return out
+	}
+}
+
+// TruncateChunks returns a Corruptor that keeps the header and the first n
+// chunk records and drops everything after them, as when a copy stops at a
+// chunk boundary. A negative n drops -n chunks from the end.
+func TruncateChunks(n int) Corruptor {
+	return func(ciphertext []byte) []byte {
+		headerLen, spans := chunkSpans(ciphertext)
+		keep := n
+		if keep < 0 {
+			keep += len(spans)
+		}
+		keep = max(0, min(keep, len(spans)))
+		return append([]byte(nil), ciphertext[:chunksEnd(headerLen, spans[:keep])]...)
+	}
+}
+
+// SwapChunks returns a Corruptor that exchanges chunk records i and j, each
+// still intact, as when blocks are written back out of order.
+func SwapChunks(i, j int) Corruptor {
+	return func(ciphertext []byte) []byte {
+		_, spans := chunkSpans(ciphertext)
+		a, b := chunkSpan(spans, i), chunkSpan(spans, j)
+		if a == b {
+			return append([]byte(nil), ciphertext...)
+		}
+		if a.start > b.start {
+			a, b = b, a
+		}
+		out := make([]byte, 0, len(ciphertext))
+		out = append(out, ciphertext[:a.start]...)
+		out = append(out, ciphertext[b.start:b.end]...)
+		out = append(out, ciphertext[a.end:b.start]...)
+		out = append(out, ciphertext[a.start:a.end]...)
+		return append(out, ciphertext[b.end:]...)
+	}
+}
+
+// DropChunk returns a Corruptor that removes chunk record index, leaving the
+// records around it intact.
+func DropChunk(index int) Corruptor {
+	return func(ciphertext []byte) []byte {
+		_, spans := chunkSpans(ciphertext)
+		s := chunkSpan(spans, index)
+		out := append([]byte(nil), ciphertext[:s.start]...)
+		return append(out, ciphertext[s.end:]...)
+	}
+}
+
+// StripTrailer returns a Corruptor that removes everything after the last
+// chunk record: the end marker, the chunk index, the trailer and the backup
+// header, whichever the file has. Every chunk still authenticates, so only
+// the missing trailer reveals the damage.
+func StripTrailer() Corruptor {
+	return func(ciphertext []byte) []byte {
+		headerLen, spans := chunkSpans(ciphertext)
+		return append([]byte(nil), ciphertext[:chunksEnd(headerLen, spans)]...)
+	}
+}
@@ -0,0 +1,98 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// chunks_test.go: Tests for the chunk-aware corruptors
+package fileencrypttest_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gitrgoliveira/go-fileencrypt"
+	"github.com/gitrgoliveira/go-fileencrypt/fileencrypttest"
+)
+
+func TestChunkCorruptors(t *testing.T) {
+	opt, err := fileencrypt.WithChunkSize(100)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	data := bytes.Repeat([]byte("0123456789"), 45) // five chunks, the last partial
+	key, ciphertext := fileencrypttest.RoundTrip(t, data, opt, fileencrypt.WithChunkIndex(true))
+	if n := fileencrypttest.ChunkCount(ciphertext); n != 5 {
+		t.Fatalf("ChunkCount = %d, want 5", n)
+	}
+
+	for name, tc := range map[string]struct {
+		c      fileencrypttest.Corruptor
+		chunks int
+	}{
+		"flip chunk bit":  {fileencrypttest.FlipChunkBit(1, 0), 5},
+		"flip last tag":   {fileencrypttest.FlipChunkBit(-1, -1), 5},
+		"truncate chunks": {fileencrypttest.TruncateChunks(3), 3},
+		"drop last chunk": {fileencrypttest.TruncateChunks(-1), 4},
+		"swap chunks":     {fileencrypttest.SwapChunks(0, 2), 5},
+		"drop chunk":      {fileencrypttest.DropChunk(2), 4},
+		"strip trailer":   {fileencrypttest.StripTrailer(), 5},
+	} {
+		t.Run(name, func(t *testing.T) {
+			damaged := tc.c(ciphertext)
+			if bytes.Equal(damaged, ciphertext) {
+				t.Fatal("corruptor did not change the ciphertext")
+			}
+			if n := fileencrypttest.ChunkCount(damaged); n != tc.chunks {
+				t.Errorf("ChunkCount = %d, want %d", n, tc.chunks)
+			}
+			err := fileencrypttest.ExpectRejected(t, key, damaged, opt)
+			if !errors.Is(err, fileencrypt.ErrAuthenticationFailed) && !errors.Is(err, fileencrypt.ErrCorruptedFile) {
+				t.Errorf("error = %v, want ErrAuthenticationFailed or ErrCorruptedFile", err)
+			}
+		})
+	}
+
+	// A corruptor can be applied more than once.
+	drop := fileencrypttest.TruncateChunks(-1)
+	if !bytes.Equal(drop(ciphertext), drop(ciphertext)) {
+		t.Error("TruncateChunks gave different results on the same input")
+	}
+
+	// Swapping a chunk with itself is the identity.
+	if !bytes.Equal(fileencrypttest.SwapChunks(1, 1)(ciphertext), ciphertext) {
+		t.Error("SwapChunks(1, 1) changed the ciphertext")
+	}
+}
+
+func TestChunkCorruptors_Salvage(t *testing.T) {
+	opt, err := fileencrypt.WithChunkSize(100)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	key, ciphertext := fileencrypttest.RoundTrip(t, make([]byte, 450), opt)
+	path := filepath.Join(t.TempDir(), "data.enc")
+	if err := os.WriteFile(path, ciphertext, 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	// Damage one chunk and lose the trailer: ScanFile still recovers the
+	// other chunks.
+	fileencrypttest.CorruptFile(t, path, fileencrypttest.FlipChunkBit(2, 40).Then(fileencrypttest.StripTrailer()))
+	report, err := fileencrypt.ScanFile(t.Context(), path, key, opt)
+	if err != nil {
+		t.Fatalf("ScanFile failed: %v", err)
+	}
+	if report.OK() || report.Trailer != fileencrypt.ChunkTruncated {
+		t.Errorf("report = %+v, want a missing trailer", report)
+	}
+	if len(report.Chunks) != 5 || report.Chunks[2].Status != fileencrypt.ChunkAuthFailed {
+		t.Fatalf("chunks = %+v, want chunk 2 damaged", report.Chunks)
+	}
+	if report.Recoverable != 350 {
+		t.Errorf("Recoverable = %d, want 350", report.Recoverable)
+	}
+}
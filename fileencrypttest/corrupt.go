@@ -0,0 +1,69 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// corrupt.go: Corruptors that damage ciphertext
+package fileencrypttest
+
+import (
+	"os"
+	"testing"
+)
+
+// Corruptor returns a damaged copy of an encrypted file. It never modifies
+// its argument.
+type Corruptor func(ciphertext []byte) []byte
+
+// Then returns a Corruptor applying c and then next.
+func (c Corruptor) Then(next Corruptor) Corruptor {
+	return func(ciphertext []byte) []byte {
+		return next(c(ciphertext))
+	}
+}
+
+// FlipBit returns a Corruptor that inverts bit number bit, counting from the
+// most significant bit of the first byte. A negative bit counts back from the
+// end, so -1 is the last bit of the file. A bit outside the data is left
+// alone.
+func FlipBit(bit int) Corruptor {
+	return func(ciphertext []byte) []byte {
+		out := append([]byte(nil), ciphertext...)
+		i := bit
+		if i < 0 {
+			i += 8 * len(out)
+		}
+		if i >= 0 && i < 8*len(out) {
+			out[i/8] ^= 0x80 >> (i % 8)
+		}
+		return out
+	}
+}
+
+// Truncate returns a Corruptor that keeps the first size bytes. A negative
+// size drops -size bytes from the end instead.
+func Truncate(size int) Corruptor {
+	return func(ciphertext []byte) []byte {
+		keep := size
+		if keep < 0 {
+			keep += len(ciphertext)
+		}
+		keep = max(0, min(keep, len(ciphertext)))
+		return append([]byte(nil), ciphertext[:keep]...)
+	}
+}
+
+// CorruptFile rewrites the file at path with c applied to its contents,
+// failing t on I/O errors. It is the on-disk counterpart of calling c, for
+// testing EncryptFile and DecryptFile.
+func CorruptFile(t testing.TB, path string, c Corruptor) {
+	t.Helper()
+	data, err := os.ReadFile(path) // #nosec G304 -- File path provided by caller
+	if err != nil {
+		t.Fatalf("fileencrypttest: %v", err)
+	}
+	if err := os.WriteFile(path, c(data), 0o600); err != nil {
+		t.Fatalf("fileencrypttest: %v", err)
+	}
+}
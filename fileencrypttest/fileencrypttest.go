@@ -0,0 +1,85 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// Package fileencrypttest provides helpers for testing code built on
+// fileencrypt: in-memory round trips, encryption of testing/fstest file
+// systems, and corruptors that damage ciphertext the way storage and
+// networks do. It mirrors net/http/httptest and is meant for use in tests
+// only.
+//
+//	func TestUpload(t *testing.T) {
+//	    key, ciphertext := fileencrypttest.RoundTrip(t, []byte("payload"))
+//	    damaged := fileencrypttest.FlipBit(-1)(ciphertext)
+//	    err := fileencrypttest.ExpectRejected(t, key, damaged)
+//	    // check how the integration reports err
+//	}
+package fileencrypttest
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/gitrgoliveira/go-fileencrypt"
+)
+
+// Key returns a new random 32-byte key, failing t if none can be generated.
+func Key(t testing.TB) []byte {
+	t.Helper()
+	key, err := fileencrypt.GenerateKey()
+	if err != nil {
+		t.Fatalf("fileencrypttest: failed to generate key: %v", err)
+	}
+	return key
+}
+
+// Encrypt encrypts data with key and opts in memory, failing t on error.
+func Encrypt(t testing.TB, key, data []byte, opts ...fileencrypt.Option) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := fileencrypt.EncryptStream(context.Background(), bytes.NewReader(data), &buf, key, opts...); err != nil {
+		t.Fatalf("fileencrypttest: encrypt failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// Decrypt decrypts ciphertext with key and opts in memory. Unlike the other
+// helpers it returns the error, since tests of damaged input expect one.
+func Decrypt(key, ciphertext []byte, opts ...fileencrypt.Option) ([]byte, error) {
+	var buf bytes.Buffer
+	err := fileencrypt.DecryptStream(context.Background(), bytes.NewReader(ciphertext), &buf, key, opts...)
+	return buf.Bytes(), err
+}
+
+// RoundTrip encrypts data under a new random key with opts, decrypts it with
+// the same options and fails t unless the result equals data. It returns the
+// key and the ciphertext for further checks, such as decrypting a corrupted
+// copy.
+func RoundTrip(t testing.TB, data []byte, opts ...fileencrypt.Option) (key, ciphertext []byte) {
+	t.Helper()
+	key = Key(t)
+	ciphertext = Encrypt(t, key, data, opts...)
+	got, err := Decrypt(key, ciphertext, opts...)
+	if err != nil {
+		t.Fatalf("fileencrypttest: decrypt failed: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("fileencrypttest: round trip returned %d bytes that do not match the %d bytes encrypted", len(got), len(data))
+	}
+	return key, ciphertext
+}
+
+// ExpectRejected decrypts ciphertext with key and opts and fails t if it
+// succeeds. It returns the decryption error so the caller can check its
+// kind with errors.Is.
+func ExpectRejected(t testing.TB, key, ciphertext []byte, opts ...fileencrypt.Option) error {
+	t.Helper()
+	_, err := Decrypt(key, ciphertext, opts...)
+	if err == nil {
+		t.Fatal("fileencrypttest: damaged ciphertext decrypted without error")
+	}
+	return err
+}
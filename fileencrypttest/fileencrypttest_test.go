@@ -0,0 +1,98 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// fileencrypttest_test.go: Tests for the fileencrypttest helpers
+package fileencrypttest_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gitrgoliveira/go-fileencrypt"
+	"github.com/gitrgoliveira/go-fileencrypt/fileencrypttest"
+	"github.com/gitrgoliveira/go-fileencrypt/format"
+)
+
+func TestRoundTrip(t *testing.T) {
+	opt, err := fileencrypt.WithChunkSize(64)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	data := bytes.Repeat([]byte("round trip "), 50)
+	key, ciphertext := fileencrypttest.RoundTrip(t, data, opt)
+
+	for name, c := range map[string]fileencrypttest.Corruptor{
+		"first bit":   fileencrypttest.FlipBit(0),
+		"last bit":    fileencrypttest.FlipBit(-1),
+		"truncated":   fileencrypttest.Truncate(-1),
+		"header only": fileencrypttest.Truncate(format.HeaderSize),
+		"combined":    fileencrypttest.FlipBit(200 * 8).Then(fileencrypttest.Truncate(-20)),
+	} {
+		damaged := c(ciphertext)
+		if bytes.Equal(damaged, ciphertext) {
+			t.Fatalf("%s: corruptor did not change the ciphertext", name)
+		}
+		if err := fileencrypttest.ExpectRejected(t, key, damaged, opt); !errors.Is(err, fileencrypt.ErrAuthenticationFailed) && !errors.Is(err, fileencrypt.ErrCorruptedFile) {
+			t.Errorf("%s: unexpected error %v", name, err)
+		}
+	}
+
+	// Corruptors copy their input.
+	if got, _ := fileencrypttest.Decrypt(key, ciphertext, opt); !bytes.Equal(got, data) {
+		t.Error("corruptors modified the original ciphertext")
+	}
+}
+
+func TestCorruptFile(t *testing.T) {
+	key := fileencrypttest.Key(t)
+	path := filepath.Join(t.TempDir(), "data.enc")
+	if err := os.WriteFile(path, fileencrypttest.Encrypt(t, key, []byte("on disk")), 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	fileencrypttest.CorruptFile(t, path, fileencrypttest.FlipBit(-8))
+	err := fileencrypt.DecryptFile(t.Context(), path, path+".out", key)
+	if !errors.Is(err, fileencrypt.ErrAuthenticationFailed) {
+		t.Errorf("DecryptFile error = %v, want ErrAuthenticationFailed", err)
+	}
+}
+
+func TestRoundTripFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.txt":          {Data: []byte("alpha")},
+		"sub/b.bin":      {Data: bytes.Repeat([]byte{0xAB}, 5000)},
+		"sub/deep/c.txt": {Data: []byte{}},
+	}
+	key, encrypted := fileencrypttest.RoundTripFS(t, fsys)
+	if len(encrypted) != len(fsys) {
+		t.Fatalf("encrypted %d files, want %d", len(encrypted), len(fsys))
+	}
+	if _, ok := encrypted["sub/b.bin"+fileencrypt.EncryptedFileSuffix]; !ok {
+		t.Error("encrypted file system does not keep the EncryptDir layout")
+	}
+
+	// The encrypted layout decrypts with DecryptDir once written to disk.
+	src, dst := t.TempDir(), t.TempDir()
+	for name, file := range encrypted {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatalf("MkdirAll failed: %v", err)
+		}
+		if err := os.WriteFile(path, file.Data, 0o600); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+	if err := fileencrypt.DecryptDir(t.Context(), src, dst, key); err != nil {
+		t.Fatalf("DecryptDir failed: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(dst, "a.txt"))
+	if err != nil || string(got) != "alpha" {
+		t.Errorf("a.txt = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,101 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// fstest.go: Encryption of in-memory file systems
+package fileencrypttest
+
+import (
+	"bytes"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gitrgoliveira/go-fileencrypt"
+)
+
+// EncryptFS encrypts every regular file in fsys with key and opts into a new
+// fstest.MapFS, with the layout EncryptDir writes: each file keeps its path
+// with EncryptedFileSuffix appended. It fails t on error.
+func EncryptFS(t testing.TB, fsys fs.FS, key []byte, opts ...fileencrypt.Option) fstest.MapFS {
+	t.Helper()
+	out := fstest.MapFS{}
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+		out[path+fileencrypt.EncryptedFileSuffix] = &fstest.MapFile{Data: Encrypt(t, key, data, opts...), Mode: 0o600}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("fileencrypttest: %v", err)
+	}
+	return out
+}
+
+// DecryptFS decrypts every file ending in EncryptedFileSuffix in fsys with
+// key and opts into a new fstest.MapFS, removing the suffix. Other files are
+// ignored, as DecryptDir does. It fails t on error.
+func DecryptFS(t testing.TB, fsys fs.FS, key []byte, opts ...fileencrypt.Option) fstest.MapFS {
+	t.Helper()
+	out := fstest.MapFS{}
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() || !strings.HasSuffix(path, fileencrypt.EncryptedFileSuffix) {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+		plain, err := Decrypt(key, data, opts...)
+		if err != nil {
+			t.Fatalf("fileencrypttest: decrypt %s: %v", path, err)
+		}
+		out[strings.TrimSuffix(path, fileencrypt.EncryptedFileSuffix)] = &fstest.MapFile{Data: plain, Mode: 0o600}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("fileencrypttest: %v", err)
+	}
+	return out
+}
+
+// RoundTripFS encrypts fsys under a new random key with opts, decrypts the
+// result and fails t unless it holds exactly the regular files of fsys with
+// the same contents. The decrypted file system is also checked with
+// fstest.TestFS. It returns the key and the encrypted file system.
+func RoundTripFS(t testing.TB, fsys fstest.MapFS, opts ...fileencrypt.Option) (key []byte, encrypted fstest.MapFS) {
+	t.Helper()
+	key = Key(t)
+	encrypted = EncryptFS(t, fsys, key, opts...)
+	decrypted := DecryptFS(t, encrypted, key, opts...)
+
+	var names []string
+	for name, file := range fsys {
+		if !file.Mode.IsRegular() {
+			continue
+		}
+		names = append(names, name)
+		got, ok := decrypted[name]
+		if !ok {
+			t.Fatalf("fileencrypttest: %s missing after round trip", name)
+		}
+		if !bytes.Equal(got.Data, file.Data) {
+			t.Fatalf("fileencrypttest: %s does not match after round trip", name)
+		}
+	}
+	if len(decrypted) != len(names) {
+		t.Fatalf("fileencrypttest: round trip returned %d files, want %d", len(decrypted), len(names))
+	}
+	if err := fstest.TestFS(decrypted, names...); err != nil {
+		t.Fatalf("fileencrypttest: %v", err)
+	}
+	return key, encrypted
+}
@@ -0,0 +1,56 @@
+//go:build go1.25
+// +build go1.25
+
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package fileencrypttest_test
+
+import (
+	"testing"
+
+	"github.com/gitrgoliveira/go-fileencrypt"
+	"github.com/gitrgoliveira/go-fileencrypt/fileencrypttest"
+)
+
+func FuzzRoundTrip(f *testing.F) {
+	key := fileencrypttest.Key(f)
+	opt, err := fileencrypt.WithChunkSize(16)
+	if err != nil {
+		f.Fatalf("WithChunkSize failed: %v", err)
+	}
+	f.Add([]byte(""))
+	f.Add([]byte("test"))
+	f.Add(make([]byte, 16))
+	f.Add(make([]byte, 100))
+	f.Fuzz(fileencrypttest.FuzzRoundTrip(key, opt, fileencrypt.WithChecksum(true)))
+}
+
+func FuzzDifferential(f *testing.F) {
+	key := fileencrypttest.Key(f)
+	opt, err := fileencrypt.WithChunkSize(16)
+	if err != nil {
+		f.Fatalf("WithChunkSize failed: %v", err)
+	}
+	// Files with optional features are read by a default decryptor.
+	encrypt := []fileencrypt.Option{opt, fileencrypt.WithChunkIndex(true), fileencrypt.WithHeaderCRC(true), fileencrypt.WithBackupHeader(true)}
+	f.Add([]byte(""))
+	f.Add(make([]byte, 40))
+	f.Fuzz(fileencrypttest.FuzzDifferential(key, encrypt, nil))
+}
+
+func FuzzDecrypt(f *testing.F) {
+	key := fileencrypttest.Key(f)
+	opt, err := fileencrypt.WithChunkSize(16)
+	if err != nil {
+		f.Fatalf("WithChunkSize failed: %v", err)
+	}
+	_, ciphertext := fileencrypttest.RoundTrip(f, []byte("test data spanning chunks"), opt)
+	f.Add(ciphertext)
+	f.Add(fileencrypttest.StripTrailer()(ciphertext))
+	f.Add([]byte{})
+	f.Fuzz(fileencrypttest.FuzzDecrypt(key, opt))
+}
@@ -0,0 +1,190 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// soak.go: Long-running encryption soak tests with leak detection
+package fileencrypttest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gitrgoliveira/go-fileencrypt"
+	"github.com/gitrgoliveira/go-fileencrypt/secure"
+)
+
+// SoakEnv is the environment variable the soak test of this repository
+// reads its duration from, such as "2h". The test is skipped when it is
+// unset.
+const SoakEnv = "FILEENCRYPT_SOAK"
+
+// SoakConfig configures Soak. Zero fields take the defaults shown.
+type SoakConfig struct {
+	// Duration is how long to keep encrypting (1 minute).
+	Duration time.Duration
+	// Interval is the time between samples (Duration / 20).
+	Interval time.Duration
+	// Size is the plaintext size of each round trip (1 MiB).
+	Size int
+	// Workers is the number of concurrent round-trip loops (GOMAXPROCS).
+	Workers int
+	// Options are passed to every encryptor and decryptor.
+	Options []fileencrypt.Option
+	// MaxHeapGrowth is how far the heap in use may grow between the first
+	// and the last sample (16 MiB).
+	MaxHeapGrowth uint64
+}
+
+// SoakSample is a measurement taken by Soak after a garbage collection.
+type SoakSample struct {
+	Elapsed    time.Duration
+	Iterations int64
+	// HeapInuse is runtime.MemStats.HeapInuse.
+	HeapInuse uint64
+	// SecureBuffers is secure.LiveBuffers.
+	SecureBuffers int64
+	Goroutines    int
+}
+
+// SoakReport is the outcome of Soak.
+type SoakReport struct {
+	// Samples holds one sample per interval, and a final one taken once
+	// every worker has stopped.
+	Samples    []SoakSample
+	Iterations int64
+}
+
+// Soak creates encryptors and decryptors and round-trips data through them
+// continuously for cfg.Duration, sampling the heap, the live SecureBuffers
+// and the goroutines, to catch the gradual leaks of pooled buffers and keys
+// that only show in long-running servers. It fails t on a round-trip error,
+// if SecureBuffers or goroutines outlive the workers, or if the heap grew
+// by more than cfg.MaxHeapGrowth.
+func Soak(t testing.TB, cfg SoakConfig) SoakReport {
+	t.Helper()
+	if cfg.Duration <= 0 {
+		cfg.Duration = time.Minute
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = cfg.Duration / 20
+	}
+	if cfg.Size <= 0 {
+		cfg.Size = 1 << 20
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = runtime.GOMAXPROCS(0)
+	}
+	if cfg.MaxHeapGrowth == 0 {
+		cfg.MaxHeapGrowth = 16 << 20
+	}
+	key := Key(t)
+	data := make([]byte, cfg.Size)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("fileencrypttest: failed to generate data: %v", err)
+	}
+
+	var report SoakReport
+	var iterations atomic.Int64
+	start := time.Now()
+	sample := func() SoakSample {
+		runtime.GC()
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+		return SoakSample{
+			Elapsed:       time.Since(start),
+			Iterations:    iterations.Load(),
+			HeapInuse:     ms.HeapInuse,
+			SecureBuffers: secure.LiveBuffers(),
+			Goroutines:    runtime.NumGoroutine(),
+		}
+	}
+	before := sample()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Duration)
+	defer cancel()
+	var wg sync.WaitGroup
+	var failed atomic.Pointer[error]
+	for range cfg.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var ciphertext, plaintext bytes.Buffer
+			for ctx.Err() == nil {
+				ciphertext.Reset()
+				plaintext.Reset()
+				if err := soakRoundTrip(key, data, &ciphertext, &plaintext, cfg.Options); err != nil {
+					failed.CompareAndSwap(nil, &err)
+					cancel()
+					return
+				}
+				iterations.Add(1)
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(cfg.Interval)
+	for ctx.Err() == nil {
+		select {
+		case <-ticker.C:
+			report.Samples = append(report.Samples, sample())
+		case <-ctx.Done():
+		}
+	}
+	ticker.Stop()
+	wg.Wait()
+	if err := failed.Load(); err != nil {
+		t.Fatalf("fileencrypttest: soak round trip failed after %d iterations: %v", iterations.Load(), *err)
+	}
+	after := sample()
+	report.Samples = append(report.Samples, after)
+	report.Iterations = after.Iterations
+
+	if after.SecureBuffers > before.SecureBuffers {
+		t.Errorf("fileencrypttest: %d SecureBuffers leaked over %d iterations", after.SecureBuffers-before.SecureBuffers, after.Iterations)
+	}
+	// Allow for goroutines of the runtime and the testing package that come
+	// and go on their own.
+	if after.Goroutines > before.Goroutines+2 {
+		t.Errorf("fileencrypttest: goroutines grew from %d to %d", before.Goroutines, after.Goroutines)
+	}
+	if first := report.Samples[0]; after.HeapInuse > first.HeapInuse+cfg.MaxHeapGrowth {
+		t.Errorf("fileencrypttest: heap in use grew from %d to %d bytes", first.HeapInuse, after.HeapInuse)
+	}
+	return report
+}
+
+// soakRoundTrip encrypts data into ciphertext and decrypts it into plaintext
+// with a new encryptor and decryptor.
+func soakRoundTrip(key, data []byte, ciphertext, plaintext *bytes.Buffer, opts []fileencrypt.Option) error {
+	enc, err := fileencrypt.NewEncryptor(key, opts...)
+	if err != nil {
+		return err
+	}
+	err = enc.EncryptStream(context.Background(), bytes.NewReader(data), ciphertext)
+	enc.Destroy()
+	if err != nil {
+		return err
+	}
+	dec, err := fileencrypt.NewDecryptor(key, opts...)
+	if err != nil {
+		return err
+	}
+	err = dec.DecryptStream(context.Background(), ciphertext, plaintext)
+	dec.Destroy()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(plaintext.Bytes(), data) {
+		return fmt.Errorf("decrypted data does not match")
+	}
+	return nil
+}
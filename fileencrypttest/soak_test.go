@@ -0,0 +1,55 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// soak_test.go: Soak tests for go-fileencrypt
+package fileencrypttest_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gitrgoliveira/go-fileencrypt"
+	"github.com/gitrgoliveira/go-fileencrypt/fileencrypttest"
+)
+
+// TestSoak runs for the duration in FILEENCRYPT_SOAK, for example
+// FILEENCRYPT_SOAK=2h go test -run TestSoak -timeout 0 ./fileencrypttest.
+func TestSoak(t *testing.T) {
+	env := os.Getenv(fileencrypttest.SoakEnv)
+	if env == "" {
+		t.Skipf("set %s to a duration to run the soak test", fileencrypttest.SoakEnv)
+	}
+	d, err := time.ParseDuration(env)
+	if err != nil {
+		t.Fatalf("invalid %s: %v", fileencrypttest.SoakEnv, err)
+	}
+	report := fileencrypttest.Soak(t, fileencrypttest.SoakConfig{Duration: d, Interval: time.Minute})
+	for _, s := range report.Samples {
+		t.Logf("%v: %d iterations, heap %d bytes, %d SecureBuffers, %d goroutines",
+			s.Elapsed.Round(time.Second), s.Iterations, s.HeapInuse, s.SecureBuffers, s.Goroutines)
+	}
+}
+
+func TestSoak_Short(t *testing.T) {
+	opt, err := fileencrypt.WithChunkSize(4096)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	report := fileencrypttest.Soak(t, fileencrypttest.SoakConfig{
+		Duration: 300 * time.Millisecond,
+		Interval: 50 * time.Millisecond,
+		Size:     64 * 1024,
+		Workers:  2,
+		Options:  []fileencrypt.Option{opt},
+	})
+	if report.Iterations == 0 {
+		t.Fatal("no round trips ran")
+	}
+	if len(report.Samples) < 2 {
+		t.Errorf("took %d samples, want at least 2", len(report.Samples))
+	}
+}
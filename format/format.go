@@ -0,0 +1,479 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// Package format describes the binary layout of go-fileencrypt files and
+// parses it, so tools such as forensics or migration utilities can work with
+// encrypted files without reimplementing the layout. The full specification
+// is in docs/FORMAT.md.
+//
+// A file is a Header, a sequence of chunk records and, when FlagTrailer is
+// set, a Trailer, preceded by the chunk index when FlagChunkIndex is set and
+// followed by a copy of the header when FlagBackupHeader is set:
+//
+//	[3 bytes magic "GFE"][1 byte version][4 bytes flags (version 2 only)]
+//	[12 bytes base nonce][8 bytes size][4 bytes CRC-32C (FlagHeaderCRC only)]
+//	[24 bytes Part (FlagPart only)]
+//	[4 bytes length][ciphertext + tag] ... (one record per chunk)
+//	[4 bytes 0][sealed index + tag (FlagChunkIndex only)][sealed Trailer + tag]
+//	[header copy (FlagBackupHeader only)]
+//
+// Parsing needs no key. Opening chunks and the trailer takes a cipher.AEAD
+// built from the file key with the algorithm recorded in the flags (see
+// Flags.Algorithm).
+package format
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"strings"
+)
+
+const (
+	// Magic is the file signature "GFE" (Go File Encrypt).
+	Magic = "GFE"
+	// Version is the current format version.
+	Version = 2
+	// VersionV1 is the legacy format version without a trailer.
+	VersionV1 = 1
+	// NonceSize is the size of the AES-GCM nonce.
+	NonceSize = 12
+	// TagSize is the size of the GCM authentication tag of every sealed record.
+	TagSize = 16
+	// FlagsSize is the size of the capability flags of a version 2 header.
+	FlagsSize = 4
+	// HeaderSize is the size of a current (version 2) file header, without the
+	// checksum of FlagHeaderCRC.
+	HeaderSize = len(Magic) + 1 + FlagsSize + NonceSize + 8
+	// HeaderSizeV1 is the size of a version 1 header, which has no flags.
+	HeaderSizeV1 = len(Magic) + 1 + NonceSize + 8
+	// HeaderCRCSize is the size of the header checksum that follows the
+	// header fields with FlagHeaderCRC.
+	HeaderCRCSize = 4
+	// PartSize is the size of the Part descriptor that ends the header with
+	// FlagPart.
+	PartSize = 16 + 4 + 4
+	// LengthSize is the size of the length prefix of every record.
+	LengthSize = 4
+	// MaxChunkSize is the largest plaintext chunk a file may contain.
+	MaxChunkSize = 10 * 1024 * 1024
+	// TrailerPayloadSize is the plaintext size of the trailer.
+	TrailerPayloadSize = 16
+	// TrailerSize is the on-disk size of the trailer, including its end marker.
+	TrailerSize = LengthSize + TrailerPayloadSize + TagSize
+)
+
+// RecordTrailer is the metadata record type of the trailer (see RecordNonce).
+const RecordTrailer uint32 = 1
+
+var (
+	// ErrCorrupted reports malformed, truncated or tampered data.
+	ErrCorrupted = errors.New("corrupted file")
+	// ErrUnsupportedVersion reports an unknown format version.
+	ErrUnsupportedVersion = errors.New("unsupported file version")
+	// ErrAuthenticationFailed reports a record that failed GCM authentication.
+	ErrAuthenticationFailed = errors.New("authentication failed")
+	// ErrUnsupportedFeature reports a file using an incompatible feature the
+	// reader does not implement.
+	ErrUnsupportedFeature = errors.New("unsupported file feature")
+	// ErrHeaderCorrupted reports a header whose checksum does not match its
+	// fields. It matches ErrCorrupted.
+	ErrHeaderCorrupted = fmt.Errorf("%w: header checksum mismatch", ErrCorrupted)
+)
+
+// crcTable is the Castagnoli table of header checksums.
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Flags are the capability bits of a version 2 header. The low 16 bits are
+// compatible features: readers that do not know them can still read the file
+// and ignore them. The high 16 bits are incompatible features: a reader must
+// refuse a file that sets one it does not implement.
+type Flags uint32
+
+const (
+	// FlagLog marks an append-only log: records are added one write at a
+	// time and the file never gets a trailer, so it is read as a stream of
+	// unknown size.
+	FlagLog Flags = 1 << 0
+
+	// FlagTrailer marks a stream that ends with an authenticated Trailer.
+	FlagTrailer Flags = 1 << 16
+	// FlagHeaderAAD marks a file whose records authenticate the whole header
+	// instead of only its size field, so flags cannot be altered.
+	FlagHeaderAAD Flags = 1 << 17
+	// FlagCompressed marks plaintext that was compressed before encryption.
+	FlagCompressed Flags = 1 << 18
+	// FlagChunkIndex marks a file with a sealed chunk index between the end
+	// marker and the trailer (see OpenIndex).
+	FlagChunkIndex Flags = 1 << 19
+	// FlagRecord marks a single sealed record instead of a chunked stream:
+	// the header is followed directly by the ciphertext and tag of Size
+	// plaintext bytes, with no length prefix or trailer.
+	FlagRecord Flags = 1 << 20
+	// FlagPadded marks a stream whose plaintext is followed by zero bytes
+	// that hide its exact size. The header records size 0 and the trailer
+	// the size without padding; readers must drop the padding.
+	FlagPadded Flags = 1 << 21
+	// FlagBackupHeader marks a file that ends with a copy of its header after
+	// the trailer, from which readers can recover a damaged first header.
+	FlagBackupHeader Flags = 1 << 22
+	// FlagHeaderCRC marks a header followed by a CRC-32C of its fields, so
+	// readers can tell a damaged header from a wrong key or damaged chunks
+	// before decrypting anything.
+	FlagHeaderCRC Flags = 1 << 23
+	// FlagChunkDigests marks a file whose chunk index carries the
+	// ChunkDigest of every record, so that a copy can be checked chunk by
+	// chunk without the key. It requires FlagChunkIndex.
+	FlagChunkDigests Flags = 1 << 24
+	// FlagPart marks one part of a plaintext split into several files. The
+	// header ends with a Part descriptor linking it to the others; it is
+	// authenticated only through FlagHeaderAAD, which it requires.
+	FlagPart Flags = 1 << 25
+
+	// AlgorithmFlags selects the AlgorithmID in the top four incompatible
+	// bits; see Flags.Algorithm.
+	AlgorithmFlags Flags = 0xF << algorithmShift
+
+	// IncompatibleFlags selects the bits a reader must understand.
+	IncompatibleFlags Flags = 0xFFFF0000
+)
+
+// algorithmShift is the position of the AlgorithmID in the flags.
+const algorithmShift = 28
+
+// AlgorithmID identifies the AEAD a file is sealed with. AES-256-GCM is 0,
+// so files written before the algorithm was recorded, and every version 1
+// file, are AES-256-GCM files. The other IDs set incompatible bits, so
+// readers that do not implement an algorithm refuse its files.
+type AlgorithmID uint8
+
+const (
+	// AlgorithmAES256GCM is AES-256-GCM.
+	AlgorithmAES256GCM AlgorithmID = 0
+	// AlgorithmChaCha20Poly1305 is ChaCha20-Poly1305.
+	AlgorithmChaCha20Poly1305 AlgorithmID = 1
+	// AlgorithmMLKEMHybrid is an ML-KEM hybrid post-quantum construction.
+	AlgorithmMLKEMHybrid AlgorithmID = 2
+)
+
+// String returns the algorithm name.
+func (id AlgorithmID) String() string {
+	switch id {
+	case AlgorithmAES256GCM:
+		return "AES-256-GCM"
+	case AlgorithmChaCha20Poly1305:
+		return "ChaCha20-Poly1305"
+	case AlgorithmMLKEMHybrid:
+		return "ML-KEM-Hybrid"
+	default:
+		return fmt.Sprintf("algorithm-%d", uint8(id))
+	}
+}
+
+// Flags returns the flag bits recording id. It panics if id does not fit in
+// AlgorithmFlags.
+func (id AlgorithmID) Flags() Flags {
+	if id > 0xF {
+		panic(fmt.Sprintf("format: algorithm ID %d out of range", id))
+	}
+	return Flags(id) << algorithmShift
+}
+
+// Algorithm returns the algorithm the file is sealed with.
+func (f Flags) Algorithm() AlgorithmID {
+	return AlgorithmID((f & AlgorithmFlags) >> algorithmShift)
+}
+
+var flagNames = []struct {
+	flag Flags
+	name string
+}{
+	{FlagLog, "log"},
+	{FlagTrailer, "trailer"},
+	{FlagHeaderAAD, "header-aad"},
+	{FlagCompressed, "compressed"},
+	{FlagChunkIndex, "chunk-index"},
+	{FlagRecord, "record"},
+	{FlagPadded, "padded"},
+	{FlagBackupHeader, "backup-header"},
+	{FlagHeaderCRC, "header-crc"},
+	{FlagChunkDigests, "chunk-digests"},
+	{FlagPart, "part"},
+}
+
+// String returns the flag names joined by "|", with unknown bits in hex. A
+// known algorithm other than AES-256-GCM is named as "algorithm=NAME".
+func (f Flags) String() string {
+	var names []string
+	for _, n := range flagNames {
+		if f&n.flag != 0 {
+			names = append(names, n.name)
+			f &^= n.flag
+		}
+	}
+	if id := f.Algorithm(); id != AlgorithmAES256GCM && id <= AlgorithmMLKEMHybrid {
+		names = append(names, "algorithm="+id.String())
+		f &^= AlgorithmFlags
+	}
+	if f != 0 {
+		names = append(names, fmt.Sprintf("%#08x", uint32(f)))
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// Check returns an ErrUnsupportedFeature error naming the incompatible flags
+// of f that are not in supported. Unknown compatible flags are ignored.
+func (f Flags) Check(supported Flags) error {
+	if missing := f & IncompatibleFlags &^ supported; missing != 0 {
+		return fmt.Errorf("%w: %s", ErrUnsupportedFeature, missing)
+	}
+	return nil
+}
+
+// Header is the file header.
+type Header struct {
+	Version uint8
+	// Flags are the capabilities the file uses; always 0 for version 1.
+	Flags Flags
+	// Nonce is the base nonce from which every record nonce is derived.
+	Nonce [NonceSize]byte
+	// Size is the plaintext size, or 0 if it was unknown when encrypting.
+	Size uint64
+	// Part links the file to the other parts of its set with FlagPart.
+	Part Part
+}
+
+// Part identifies one part of a plaintext split into Count files, each a
+// complete file of the format. Joining the parts of a set in Index order
+// gives back the plaintext.
+type Part struct {
+	// Set is a random identifier shared by the parts of one split.
+	Set [16]byte
+	// Index is the position of the part, from 0.
+	Index uint32
+	// Count is the number of parts in the set.
+	Count uint32
+}
+
+// ParseHeader parses the header at the start of b. Headers with
+// FlagHeaderCRC whose checksum does not match fail with ErrHeaderCorrupted.
+func ParseHeader(b []byte) (Header, error) {
+	if len(b) < len(Magic)+1 {
+		return Header{}, fmt.Errorf("%w: header is %d bytes", ErrCorrupted, len(b))
+	}
+	if string(b[:len(Magic)]) != Magic {
+		return Header{}, fmt.Errorf("%w: invalid magic bytes %q", ErrCorrupted, b[:len(Magic)])
+	}
+	h := Header{Version: b[len(Magic)]}
+	if h.Version != Version && h.Version != VersionV1 {
+		return Header{}, fmt.Errorf("%w: %d", ErrUnsupportedVersion, h.Version)
+	}
+	if len(b) < h.Len() {
+		return Header{}, fmt.Errorf("%w: header is %d bytes, want %d", ErrCorrupted, len(b), h.Len())
+	}
+	fields := b[len(Magic)+1 : h.Len()]
+	if h.Version >= 2 {
+		h.Flags = Flags(binary.BigEndian.Uint32(fields))
+		fields = fields[FlagsSize:]
+		if len(b) < h.Len() {
+			return Header{}, fmt.Errorf("%w: header is %d bytes, want %d", ErrCorrupted, len(b), h.Len())
+		}
+		if h.Flags&FlagHeaderCRC != 0 && crc32.Checksum(b[:HeaderSize], crcTable) != binary.BigEndian.Uint32(b[HeaderSize:]) {
+			return Header{}, ErrHeaderCorrupted
+		}
+		if h.Flags&FlagPart != 0 {
+			var err error
+			if h.Part, err = ParsePart(b[h.Len()-PartSize : h.Len()]); err != nil {
+				return Header{}, err
+			}
+		}
+	}
+	copy(h.Nonce[:], fields)
+	h.Size = binary.BigEndian.Uint64(fields[NonceSize:])
+	if h.Size > math.MaxInt64 {
+		return Header{}, fmt.Errorf("%w: size %d out of range", ErrCorrupted, h.Size)
+	}
+	return h, nil
+}
+
+// ReadHeader reads and parses a header from r.
+func ReadHeader(r io.Reader) (Header, error) {
+	b := make([]byte, HeaderSize+HeaderCRCSize+PartSize)
+	if _, err := io.ReadFull(r, b[:len(Magic)+1]); err != nil {
+		return Header{}, fmt.Errorf("%w: read header: %w", ErrCorrupted, err)
+	}
+	n := HeaderSize
+	if b[len(Magic)] == VersionV1 {
+		n = HeaderSizeV1
+	}
+	if _, err := io.ReadFull(r, b[len(Magic)+1:n]); err != nil {
+		if string(b[:len(Magic)]) != Magic {
+			return ParseHeader(b[:len(Magic)+1])
+		}
+		return Header{}, fmt.Errorf("%w: read header: %w", ErrCorrupted, err)
+	}
+	if n == HeaderSize {
+		flags := Flags(binary.BigEndian.Uint32(b[len(Magic)+1:]))
+		if flags&FlagHeaderCRC != 0 {
+			if _, err := io.ReadFull(r, b[n:n+HeaderCRCSize]); err != nil {
+				return Header{}, fmt.Errorf("%w: read header checksum: %w", ErrCorrupted, err)
+			}
+			n += HeaderCRCSize
+		}
+		if flags&FlagPart != 0 {
+			if _, err := io.ReadFull(r, b[n:n+PartSize]); err != nil {
+				return Header{}, fmt.Errorf("%w: read part: %w", ErrCorrupted, err)
+			}
+			n += PartSize
+		}
+	}
+	return ParseHeader(b[:n])
+}
+
+// Len returns the encoded size of the header: HeaderSize, plus HeaderCRCSize
+// with FlagHeaderCRC and PartSize with FlagPart, or HeaderSizeV1 for
+// version 1.
+func (h Header) Len() int {
+	if h.Version == VersionV1 {
+		return HeaderSizeV1
+	}
+	n := HeaderSize
+	if h.Flags&FlagHeaderCRC != 0 {
+		n += HeaderCRCSize
+	}
+	if h.Flags&FlagPart != 0 {
+		n += PartSize
+	}
+	return n
+}
+
+// Marshal returns the encoded header.
+func (h Header) Marshal() []byte {
+	b := make([]byte, 0, h.Len())
+	b = append(b, Magic...)
+	b = append(b, h.Version)
+	if h.Version >= 2 {
+		b = binary.BigEndian.AppendUint32(b, uint32(h.Flags))
+	}
+	b = append(b, h.Nonce[:]...)
+	b = binary.BigEndian.AppendUint64(b, h.Size)
+	if h.Version >= 2 && h.Flags&FlagHeaderCRC != 0 {
+		b = binary.BigEndian.AppendUint32(b, crc32.Checksum(b, crcTable))
+	}
+	if h.Version >= 2 && h.Flags&FlagPart != 0 {
+		b = h.Part.Append(b)
+	}
+	return b
+}
+
+// ParsePart parses an encoded Part descriptor. Descriptors with no parts or
+// an index outside the set fail with ErrCorrupted.
+func ParsePart(b []byte) (Part, error) {
+	if len(b) != PartSize {
+		return Part{}, fmt.Errorf("%w: part is %d bytes, want %d", ErrCorrupted, len(b), PartSize)
+	}
+	var p Part
+	copy(p.Set[:], b)
+	p.Index = binary.BigEndian.Uint32(b[16:])
+	p.Count = binary.BigEndian.Uint32(b[20:])
+	if p.Index >= p.Count {
+		return Part{}, fmt.Errorf("%w: part %d of %d", ErrCorrupted, p.Index, p.Count)
+	}
+	return p, nil
+}
+
+// Append appends the encoded descriptor to b.
+func (p Part) Append(b []byte) []byte {
+	b = append(b, p.Set[:]...)
+	b = binary.BigEndian.AppendUint32(b, p.Index)
+	return binary.BigEndian.AppendUint32(b, p.Count)
+}
+
+// AAD returns the additional authenticated data of every record: the encoded
+// header with FlagHeaderAAD, otherwise only the encoded size field.
+func (h Header) AAD() []byte {
+	if h.Flags&FlagHeaderAAD != 0 {
+		return h.Marshal()
+	}
+	return binary.BigEndian.AppendUint64(nil, h.Size)
+}
+
+// HasTrailer reports whether the file ends with a Trailer.
+func (h Header) HasTrailer() bool {
+	return h.Flags&FlagTrailer != 0
+}
+
+// ChunkNonce returns the nonce of chunk index: the base nonce with its last
+// four bytes replaced by the big-endian index.
+func (h Header) ChunkNonce(index uint32) []byte {
+	nonce := append([]byte(nil), h.Nonce[:]...)
+	binary.BigEndian.PutUint32(nonce[8:], index)
+	return nonce
+}
+
+// RecordNonce returns the nonce of a metadata record such as RecordTrailer:
+// the base nonce with the top bit of the first byte inverted, so it never
+// collides with a chunk nonce, and the record type in the last four bytes.
+func (h Header) RecordNonce(record uint32) []byte {
+	nonce := append([]byte(nil), h.Nonce[:]...)
+	nonce[0] ^= 0x80
+	binary.BigEndian.PutUint32(nonce[8:], record)
+	return nonce
+}
+
+// Trailer is the authenticated end-of-stream record of version 2 files.
+type Trailer struct {
+	// Size is the total plaintext size.
+	Size uint64
+	// Chunks is the number of chunk records.
+	Chunks uint64
+}
+
+// ParseTrailer parses a decrypted trailer payload.
+func ParseTrailer(payload []byte) (Trailer, error) {
+	if len(payload) != TrailerPayloadSize {
+		return Trailer{}, fmt.Errorf("%w: trailer payload is %d bytes, want %d", ErrCorrupted, len(payload), TrailerPayloadSize)
+	}
+	t := Trailer{
+		Size:   binary.BigEndian.Uint64(payload[0:8]),
+		Chunks: binary.BigEndian.Uint64(payload[8:16]),
+	}
+	if t.Size > math.MaxInt64 {
+		return Trailer{}, fmt.Errorf("%w: trailer size %d out of range", ErrCorrupted, t.Size)
+	}
+	return t, nil
+}
+
+// Marshal returns the trailer payload (before sealing).
+func (t Trailer) Marshal() []byte {
+	b := make([]byte, 0, TrailerPayloadSize)
+	b = binary.BigEndian.AppendUint64(b, t.Size)
+	return binary.BigEndian.AppendUint64(b, t.Chunks)
+}
+
+// Seal returns the on-disk trailer of a file with header h: the end marker
+// followed by the sealed payload.
+func (t Trailer) Seal(aead cipher.AEAD, h Header) []byte {
+	out := make([]byte, LengthSize, TrailerSize)
+	return aead.Seal(out, h.RecordNonce(RecordTrailer), t.Marshal(), h.AAD())
+}
+
+// OpenTrailer authenticates and parses a sealed trailer (without the end
+// marker) of a file with header h.
+func OpenTrailer(aead cipher.AEAD, h Header, sealed []byte) (Trailer, error) {
+	payload, err := aead.Open(nil, h.RecordNonce(RecordTrailer), sealed, h.AAD())
+	if err != nil {
+		return Trailer{}, fmt.Errorf("trailer: %w", ErrAuthenticationFailed)
+	}
+	return ParseTrailer(payload)
+}
@@ -0,0 +1,366 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package format_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/gitrgoliveira/go-fileencrypt"
+	"github.com/gitrgoliveira/go-fileencrypt/format"
+)
+
+func newGCM(t *testing.T, key []byte) cipher.AEAD {
+	t.Helper()
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatalf("aes.NewCipher failed: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatalf("cipher.NewGCM failed: %v", err)
+	}
+	return gcm
+}
+
+func TestHeader_MarshalRoundTrip(t *testing.T) {
+	v2 := format.Header{Version: format.Version, Flags: format.FlagTrailer | format.FlagHeaderAAD, Size: 12345}
+	copy(v2.Nonce[:], "0123456789ab")
+	v1 := format.Header{Version: format.VersionV1, Size: 12345}
+	copy(v1.Nonce[:], "0123456789ab")
+
+	for _, h := range []format.Header{v2, v1} {
+		b := h.Marshal()
+		if len(b) != h.Len() {
+			t.Fatalf("v%d: Marshal returned %d bytes, want %d", h.Version, len(b), h.Len())
+		}
+		got, err := format.ParseHeader(b)
+		if err != nil {
+			t.Fatalf("v%d: ParseHeader failed: %v", h.Version, err)
+		}
+		if got != h {
+			t.Errorf("v%d: ParseHeader = %+v, want %+v", h.Version, got, h)
+		}
+		got, err = format.ReadHeader(bytes.NewReader(append(b, 0xff)))
+		if err != nil || got != h {
+			t.Errorf("v%d: ReadHeader = %+v, %v, want %+v", h.Version, got, err, h)
+		}
+	}
+	if v1.Len() != format.HeaderSizeV1 || v2.Len() != format.HeaderSize {
+		t.Errorf("unexpected header sizes %d and %d", v1.Len(), v2.Len())
+	}
+	if !bytes.Equal(v2.AAD(), v2.Marshal()) || len(v1.AAD()) != 8 {
+		t.Error("AAD does not follow FlagHeaderAAD")
+	}
+}
+
+func TestFlags(t *testing.T) {
+	f := format.FlagTrailer | format.FlagCompressed | 1<<3 | 1<<30
+	if got, want := f.String(), "trailer|compressed|0x40000008"; got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+	if got := format.Flags(0).String(); got != "none" {
+		t.Errorf("String = %q, want none", got)
+	}
+
+	supported := format.FlagTrailer | format.FlagHeaderAAD
+	if err := (format.FlagTrailer | 1<<3).Check(supported); err != nil {
+		t.Errorf("unknown compatible flag rejected: %v", err)
+	}
+	err := f.Check(supported)
+	if !errors.Is(err, format.ErrUnsupportedFeature) {
+		t.Fatalf("expected ErrUnsupportedFeature, got %v", err)
+	}
+	if want := "unsupported file feature: compressed|0x40000000"; err.Error() != want {
+		t.Errorf("error = %q, want %q", err, want)
+	}
+
+	alg := format.FlagTrailer | format.AlgorithmChaCha20Poly1305.Flags()
+	if got := alg.Algorithm(); got != format.AlgorithmChaCha20Poly1305 {
+		t.Errorf("Algorithm = %v, want ChaCha20-Poly1305", got)
+	}
+	if got := format.FlagTrailer.Algorithm(); got != format.AlgorithmAES256GCM {
+		t.Errorf("Algorithm without algorithm bits = %v, want AES-256-GCM", got)
+	}
+	if got, want := alg.String(), "trailer|algorithm=ChaCha20-Poly1305"; got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+	if err := alg.Check(format.FlagTrailer); !errors.Is(err, format.ErrUnsupportedFeature) {
+		t.Errorf("unimplemented algorithm accepted: %v", err)
+	}
+}
+
+func TestHeader_CRC(t *testing.T) {
+	h := format.Header{Version: format.Version, Flags: format.FlagTrailer | format.FlagHeaderAAD | format.FlagHeaderCRC, Size: 12345}
+	copy(h.Nonce[:], "0123456789ab")
+	b := h.Marshal()
+	if len(b) != format.HeaderSize+format.HeaderCRCSize || h.Len() != len(b) {
+		t.Fatalf("Marshal returned %d bytes, Len %d, want %d", len(b), h.Len(), format.HeaderSize+format.HeaderCRCSize)
+	}
+	got, err := format.ReadHeader(bytes.NewReader(append(b, 0xff)))
+	if err != nil || got != h {
+		t.Fatalf("ReadHeader = %+v, %v, want %+v", got, err, h)
+	}
+	if !bytes.Equal(h.AAD(), b) {
+		t.Error("AAD does not cover the checksum")
+	}
+
+	for i := range b {
+		damaged := bytes.Clone(b)
+		damaged[i] ^= 0x01
+		_, err := format.ParseHeader(damaged)
+		switch {
+		case i < len(format.Magic)+1:
+			// Magic and version are checked before the checksum.
+			if err == nil {
+				t.Errorf("byte %d: damaged header accepted", i)
+			}
+		default:
+			if !errors.Is(err, format.ErrHeaderCorrupted) || !errors.Is(err, format.ErrCorrupted) {
+				t.Errorf("byte %d: expected ErrHeaderCorrupted, got %v", i, err)
+			}
+		}
+	}
+	if _, err := format.ReadHeader(bytes.NewReader(b[:format.HeaderSize])); !errors.Is(err, format.ErrCorrupted) {
+		t.Errorf("missing checksum: expected ErrCorrupted, got %v", err)
+	}
+}
+
+func TestHeader_Part(t *testing.T) {
+	h := format.Header{
+		Version: format.Version,
+		Flags:   format.FlagTrailer | format.FlagHeaderAAD | format.FlagHeaderCRC | format.FlagPart,
+		Size:    4096,
+		Part:    format.Part{Index: 2, Count: 3},
+	}
+	copy(h.Part.Set[:], "set-id-0123456789")
+	b := h.Marshal()
+	if len(b) != format.HeaderSize+format.HeaderCRCSize+format.PartSize || h.Len() != len(b) {
+		t.Fatalf("Marshal returned %d bytes, Len %d", len(b), h.Len())
+	}
+	got, err := format.ReadHeader(bytes.NewReader(append(b, 0xff)))
+	if err != nil || got != h {
+		t.Fatalf("ReadHeader = %+v, %v, want %+v", got, err, h)
+	}
+	if !bytes.Equal(h.AAD(), b) {
+		t.Error("AAD does not cover the part")
+	}
+	if _, err := format.ReadHeader(bytes.NewReader(b[:len(b)-1])); !errors.Is(err, format.ErrCorrupted) {
+		t.Errorf("truncated part: expected ErrCorrupted, got %v", err)
+	}
+
+	h.Part.Index = 3
+	if _, err := format.ParseHeader(h.Marshal()); !errors.Is(err, format.ErrCorrupted) {
+		t.Errorf("index outside the set: expected ErrCorrupted, got %v", err)
+	}
+}
+
+func TestParseHeader_Invalid(t *testing.T) {
+	valid := format.Header{Version: format.Version}.Marshal()
+	tests := []struct {
+		name   string
+		data   []byte
+		target error
+	}{
+		{"short", valid[:10], format.ErrCorrupted},
+		{"magic", append([]byte("XYZ"), valid[3:]...), format.ErrCorrupted},
+		{"version", append(append([]byte(format.Magic), 9), valid[4:]...), format.ErrUnsupportedVersion},
+	}
+	for _, tt := range tests {
+		if _, err := format.ParseHeader(tt.data); !errors.Is(err, tt.target) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.target, err)
+		}
+	}
+}
+
+func TestReader_TestVectors(t *testing.T) {
+	vectors, err := fileencrypt.GenerateTestVectors()
+	if err != nil {
+		t.Fatalf("GenerateTestVectors failed: %v", err)
+	}
+	for _, v := range vectors {
+		t.Run(v.Name, func(t *testing.T) {
+			key, _ := hex.DecodeString(v.Key)
+			ciphertext, _ := hex.DecodeString(v.Ciphertext)
+			plaintext, _ := hex.DecodeString(v.Plaintext)
+			gcm := newGCM(t, key)
+
+			r, err := format.NewReader(bytes.NewReader(ciphertext))
+			if err != nil {
+				t.Fatalf("NewReader failed: %v", err)
+			}
+			h := r.Header()
+			if hex.EncodeToString(h.Nonce[:]) != v.Fields.Nonce || h.Size != v.Fields.Size {
+				t.Errorf("unexpected header %+v", h)
+			}
+
+			var got []byte
+			for {
+				c, err := r.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Next failed: %v", err)
+				}
+				want := v.Fields.Chunks[c.Index]
+				if c.Offset != int64(want.Offset) || hex.EncodeToString(c.Sealed) != want.Ciphertext+want.Tag {
+					t.Errorf("chunk %d does not match the vector breakdown", c.Index)
+				}
+				if got, err = c.Open(gcm, h, got); err != nil {
+					t.Fatalf("Open failed: %v", err)
+				}
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Errorf("plaintext mismatch")
+			}
+			if r.Offset() != int64(len(ciphertext)) {
+				t.Errorf("Offset = %d, want %d", r.Offset(), len(ciphertext))
+			}
+
+			sealed, ok := r.Trailer()
+			if !ok {
+				t.Fatal("expected a trailer")
+			}
+			tr, err := format.OpenTrailer(gcm, h, sealed)
+			if err != nil {
+				t.Fatalf("OpenTrailer failed: %v", err)
+			}
+			if tr.Size != uint64(len(plaintext)) || tr.Chunks != uint64(r.Chunks()) {
+				t.Errorf("unexpected trailer %+v", tr)
+			}
+			if !bytes.Equal(tr.Seal(gcm, h), ciphertext[len(ciphertext)-format.TrailerSize:]) {
+				t.Error("Seal does not reproduce the trailer")
+			}
+		})
+	}
+}
+
+func TestReader_Corrupted(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	data := bytes.Repeat([]byte("x"), 100)
+	var buf bytes.Buffer
+	if err := fileencrypt.EncryptStream(context.Background(), bytes.NewReader(data), &buf, key); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+	ciphertext := buf.Bytes()
+
+	readAll := func(b []byte) error {
+		r, err := format.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return err
+		}
+		for {
+			if _, err := r.Next(); err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+		}
+	}
+
+	if err := readAll(ciphertext); err != nil {
+		t.Fatalf("valid file failed to parse: %v", err)
+	}
+	tests := map[string][]byte{
+		"missing trailer": ciphertext[:len(ciphertext)-format.TrailerSize],
+		"truncated chunk": ciphertext[:format.HeaderSize+10],
+		"trailing data":   append(append([]byte(nil), ciphertext...), 0),
+	}
+	for name, b := range tests {
+		if err := readAll(b); !errors.Is(err, format.ErrCorrupted) {
+			t.Errorf("%s: expected ErrCorrupted, got %v", name, err)
+		}
+	}
+
+	// Format errors are the same values the top-level package returns.
+	if !errors.Is(format.ErrCorrupted, fileencrypt.ErrCorruptedFile) {
+		t.Error("format.ErrCorrupted does not match fileencrypt.ErrCorruptedFile")
+	}
+}
+
+func TestReader_ChunkIndex(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	chunkOpt, err := fileencrypt.WithChunkSize(64)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	data := bytes.Repeat([]byte("x"), 200)
+	for _, digests := range []bool{false, true} {
+		layout := fileencrypt.WithChunkIndex(true)
+		if digests {
+			layout = fileencrypt.WithChunkDigests(true)
+		}
+		var buf bytes.Buffer
+		if err := fileencrypt.EncryptStream(context.Background(), bytes.NewReader(data), &buf, key, chunkOpt, layout); err != nil {
+			t.Fatalf("EncryptStream failed: %v", err)
+		}
+		gcm := newGCM(t, key)
+
+		r, err := format.NewReader(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("NewReader failed: %v", err)
+		}
+		h := r.Header()
+		if h.Flags&format.FlagChunkIndex == 0 || (h.Flags&format.FlagChunkDigests != 0) != digests {
+			t.Fatalf("header flags %s do not match the layout (digests %v)", h.Flags, digests)
+		}
+		var want []format.IndexEntry
+		for {
+			c, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("Next failed: %v", err)
+			}
+			e := format.IndexEntry{Offset: c.Offset, Length: uint32(len(c.Sealed))}
+			if h.Flags&format.FlagChunkDigests != 0 {
+				e.Digest = format.ChunkDigest(append(binary.BigEndian.AppendUint32(nil, e.Length), c.Sealed...))
+			}
+			want = append(want, e)
+		}
+
+		sealed, ok := r.Index()
+		if !ok {
+			t.Fatal("expected an index")
+		}
+		entries, err := format.OpenIndex(gcm, h, sealed)
+		if err != nil {
+			t.Fatalf("OpenIndex failed: %v", err)
+		}
+		if len(entries) != len(want) {
+			t.Fatalf("index has %d entries, want %d", len(entries), len(want))
+		}
+		for i := range want {
+			if entries[i] != want[i] {
+				t.Errorf("entry %d = %+v, want %+v", i, entries[i], want[i])
+			}
+		}
+		if !bytes.Equal(format.SealIndex(gcm, h, entries), sealed) {
+			t.Error("SealIndex does not reproduce the index")
+		}
+		if _, ok := r.Trailer(); !ok || r.Offset() != int64(buf.Len()) {
+			t.Errorf("trailer not read after index: offset %d of %d", r.Offset(), buf.Len())
+		}
+	}
+}
@@ -0,0 +1,118 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package format
+
+import (
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+// RecordIndex is the metadata record type of the chunk index (see RecordNonce).
+const RecordIndex uint32 = 2
+
+// IndexEntrySize is the encoded size of one IndexEntry:
+// [8 bytes record offset][4 bytes record length].
+const IndexEntrySize = 12
+
+// ChunkDigestSize is the size of the record digest that follows each index
+// entry of a file with FlagChunkDigests.
+const ChunkDigestSize = sha256.Size
+
+// IndexEntry locates one chunk record of a file with FlagChunkIndex.
+type IndexEntry struct {
+	// Offset is the position of the record's length prefix in the file.
+	Offset int64
+	// Length is the value of the length prefix: ciphertext plus tag.
+	Length uint32
+	// Digest is the ChunkDigest of the record with FlagChunkDigests, and
+	// zero otherwise.
+	Digest [ChunkDigestSize]byte
+}
+
+// IndexSize returns the sealed size of the index of a file without
+// FlagChunkDigests with chunks records. The index follows the end marker and
+// precedes the sealed trailer.
+func IndexSize(chunks uint64) int64 {
+	return int64(chunks)*IndexEntrySize + TagSize // #nosec G115 -- chunk counts are bounded by the 32-bit counter
+}
+
+// IndexSize returns the sealed size of the index of a file with header h and
+// chunks records.
+func (h Header) IndexSize(chunks uint64) int64 {
+	return int64(chunks)*int64(h.indexEntrySize()) + TagSize // #nosec G115 -- chunk counts are bounded by the 32-bit counter
+}
+
+// indexEntrySize returns the encoded size of one index entry of h.
+func (h Header) indexEntrySize() int {
+	if h.Flags&FlagChunkDigests != 0 {
+		return IndexEntrySize + ChunkDigestSize
+	}
+	return IndexEntrySize
+}
+
+// ChunkDigest returns the SHA-256 of a chunk record as stored in the file:
+// its length prefix, ciphertext and tag. It needs no key, so the holder of a
+// copy can compute it for comparison with the digests in the index.
+func ChunkDigest(record []byte) [ChunkDigestSize]byte {
+	return sha256.Sum256(record)
+}
+
+// AppendIndexEntry appends the encoding of e to b. With FlagChunkDigests,
+// e.Digest follows it.
+func AppendIndexEntry(b []byte, e IndexEntry) []byte {
+	b = binary.BigEndian.AppendUint64(b, uint64(e.Offset)) // #nosec G115 -- offsets are never negative
+	return binary.BigEndian.AppendUint32(b, e.Length)
+}
+
+// SealIndex returns the sealed index of a file with header h.
+func SealIndex(aead cipher.AEAD, h Header, entries []IndexEntry) []byte {
+	payload := make([]byte, 0, len(entries)*h.indexEntrySize())
+	for _, e := range entries {
+		payload = AppendIndexEntry(payload, e)
+		if h.Flags&FlagChunkDigests != 0 {
+			payload = append(payload, e.Digest[:]...)
+		}
+	}
+	return aead.Seal(nil, h.RecordNonce(RecordIndex), payload, h.AAD())
+}
+
+// OpenIndex authenticates and parses a sealed index of a file with header h.
+// The entries are checked to describe contiguous records starting right
+// after the header.
+func OpenIndex(aead cipher.AEAD, h Header, sealed []byte) ([]IndexEntry, error) {
+	payload, err := aead.Open(nil, h.RecordNonce(RecordIndex), sealed, h.AAD())
+	if err != nil {
+		return nil, fmt.Errorf("index: %w", ErrAuthenticationFailed)
+	}
+	size := h.indexEntrySize()
+	if len(payload)%size != 0 {
+		return nil, fmt.Errorf("%w: index payload is %d bytes", ErrCorrupted, len(payload))
+	}
+	entries := make([]IndexEntry, len(payload)/size)
+	next := int64(h.Len())
+	for i := range entries {
+		b := payload[i*size : (i+1)*size]
+		e := IndexEntry{
+			Offset: int64(binary.BigEndian.Uint64(b)), // #nosec G115 -- checked against next below
+			Length: binary.BigEndian.Uint32(b[8:]),
+		}
+		if size > IndexEntrySize {
+			copy(e.Digest[:], b[IndexEntrySize:])
+		}
+		if e.Offset != next {
+			return nil, fmt.Errorf("%w: index entry %d at offset %d, want %d", ErrCorrupted, i, e.Offset, next)
+		}
+		if e.Length < TagSize || e.Length > MaxChunkSize+TagSize {
+			return nil, fmt.Errorf("%w: index entry %d has invalid length %d", ErrCorrupted, i, e.Length)
+		}
+		entries[i] = e
+		next += LengthSize + int64(e.Length)
+	}
+	return entries, nil
+}
@@ -0,0 +1,171 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package format
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Chunk is one chunk record as stored in the file.
+type Chunk struct {
+	// Index is the chunk number, starting at 0.
+	Index uint32
+	// Offset is the position of the record's length prefix in the file.
+	Offset int64
+	// Sealed is the ciphertext followed by the tag. It is only valid until
+	// the next call to Reader.Next.
+	Sealed []byte
+}
+
+// Open authenticates and decrypts the chunk of a file with header h,
+// appending the plaintext to dst.
+func (c Chunk) Open(aead cipher.AEAD, h Header, dst []byte) ([]byte, error) {
+	plaintext, err := aead.Open(dst, h.ChunkNonce(c.Index), c.Sealed, h.AAD())
+	if err != nil {
+		return dst, fmt.Errorf("chunk %d: %w", c.Index, ErrAuthenticationFailed)
+	}
+	return plaintext, nil
+}
+
+// Reader iterates over the records of an encrypted file without decrypting
+// them.
+type Reader struct {
+	src     io.Reader
+	header  Header
+	offset  int64
+	index   uint32
+	buf     []byte
+	sealIdx []byte
+	trailer []byte
+	done    bool
+}
+
+// NewReader reads the header from r and returns a Reader positioned at the
+// first chunk record.
+func NewReader(r io.Reader) (*Reader, error) {
+	h, err := ReadHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{src: r, header: h, offset: int64(h.Len())}, nil
+}
+
+// Header returns the file header.
+func (r *Reader) Header() Header {
+	return r.header
+}
+
+// Next returns the next chunk record. It returns io.EOF after the last chunk,
+// once the trailer (if the header has FlagTrailer) has been read and no data
+// follows it.
+// Records are checked for structure only; use Chunk.Open and OpenTrailer to
+// authenticate them.
+func (r *Reader) Next() (Chunk, error) {
+	if r.done {
+		return Chunk{}, io.EOF
+	}
+
+	var length [LengthSize]byte
+	if _, err := io.ReadFull(r.src, length[:]); err != nil {
+		if err == io.EOF && !r.header.HasTrailer() {
+			r.done = true
+			return Chunk{}, io.EOF
+		}
+		return Chunk{}, r.errorf("read record length: %w", err)
+	}
+	n := binary.BigEndian.Uint32(length[:])
+
+	if n == 0 {
+		if !r.header.HasTrailer() {
+			return Chunk{}, r.errorf("zero-length record")
+		}
+		return Chunk{}, r.readTrailer()
+	}
+	if n < TagSize || n > MaxChunkSize+TagSize {
+		return Chunk{}, r.errorf("invalid record length %d", n)
+	}
+
+	if cap(r.buf) < int(n) {
+		r.buf = make([]byte, n)
+	}
+	sealed := r.buf[:n]
+	if _, err := io.ReadFull(r.src, sealed); err != nil {
+		return Chunk{}, r.errorf("read chunk %d: %w", r.index, err)
+	}
+
+	c := Chunk{Index: r.index, Offset: r.offset, Sealed: sealed}
+	r.offset += LengthSize + int64(n)
+	r.index++
+	if r.index == 0 {
+		return Chunk{}, r.errorf("too many chunks")
+	}
+	return c, nil
+}
+
+func (r *Reader) readTrailer() error {
+	if r.header.Flags&FlagChunkIndex != 0 {
+		index := make([]byte, r.header.IndexSize(uint64(r.index)))
+		if _, err := io.ReadFull(r.src, index); err != nil {
+			return r.errorf("read index: %w", err)
+		}
+		r.sealIdx = index
+		r.offset += int64(len(index))
+	}
+	sealed := make([]byte, TrailerSize-LengthSize)
+	if _, err := io.ReadFull(r.src, sealed); err != nil {
+		return r.errorf("read trailer: %w", err)
+	}
+	r.offset += TrailerSize
+	if r.header.Flags&FlagBackupHeader != 0 {
+		backup := make([]byte, r.header.Len())
+		if _, err := io.ReadFull(r.src, backup); err != nil {
+			return r.errorf("read backup header: %w", err)
+		}
+		if !bytes.Equal(backup, r.header.Marshal()) {
+			return r.errorf("backup header does not match the header")
+		}
+		r.offset += int64(len(backup))
+	}
+	var extra [1]byte
+	if n, _ := io.ReadFull(r.src, extra[:]); n > 0 {
+		return r.errorf("data after trailer")
+	}
+	r.trailer = sealed
+	r.done = true
+	return io.EOF
+}
+
+// errorf returns an ErrCorrupted error annotated with the current offset.
+func (r *Reader) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w: offset %d: "+format, append([]any{ErrCorrupted, r.offset}, args...)...)
+}
+
+// Chunks returns the number of chunk records read so far.
+func (r *Reader) Chunks() uint32 {
+	return r.index
+}
+
+// Trailer returns the sealed trailer (without the end marker) once Next has
+// returned io.EOF on a file with FlagTrailer, for use with OpenTrailer.
+func (r *Reader) Trailer() ([]byte, bool) {
+	return r.trailer, r.trailer != nil
+}
+
+// Index returns the sealed chunk index once Next has returned io.EOF on a
+// file with FlagChunkIndex, for use with OpenIndex.
+func (r *Reader) Index() ([]byte, bool) {
+	return r.sealIdx, r.sealIdx != nil
+}
+
+// Offset returns the number of bytes consumed so far.
+func (r *Reader) Offset() int64 {
+	return r.offset
+}
@@ -5,6 +5,7 @@ go 1.25.4
 require (
 	github.com/dustin/go-humanize v1.0.1
 	golang.org/x/crypto v0.46.0
+	golang.org/x/sys v0.39.0
+	golang.org/x/term v0.38.0
+	rsc.io/qr v0.2.0
 )
-
-require golang.org/x/sys v0.39.0 // indirect
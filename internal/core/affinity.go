@@ -0,0 +1,114 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// affinity.go: Pinning pipeline workers to CPUs
+package core
+
+import (
+	"fmt"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// WithCPUAffinity pins the goroutines sealing chunks in a pipelined
+// encryption (see WithPipeline and WithParallelism) to the given CPUs, so
+// that dedicated encryption gateways keep AES-GCM on the cores of the socket
+// whose memory and network card hold the data instead of paying for
+// cross-socket traffic. NodeCPUs lists the CPUs of a NUMA node.
+//
+// Each worker runs on its own OS thread, which is discarded when the worker
+// exits, and is pinned to the listed CPU with the fewest workers, so workers
+// spread across the CPUs before any CPU runs two. ParallelismAuto then stops
+// adding workers at one per listed CPU. CPU affinity is applied on Linux
+// only; other platforms ignore it.
+func WithCPUAffinity(cpus ...int) Option {
+	return func(cfg *Config) {
+		cfg.CPUAffinity = slices.Clone(cpus)
+	}
+}
+
+// checkCPUAffinity reports whether every CPU in cpus exists and is available
+// to the process.
+func checkCPUAffinity(cpus []int) error {
+	for _, cpu := range cpus {
+		if cpu < 0 {
+			return fmt.Errorf("invalid CPU %d", cpu)
+		}
+	}
+	return checkCPUs(cpus)
+}
+
+// cpuPinner assigns pipeline workers to CPUs, least used first.
+type cpuPinner struct {
+	mu   sync.Mutex
+	cpus []int
+	used []int
+}
+
+// newCPUPinner returns a pinner for cpus, or nil if cpus is empty.
+func newCPUPinner(cpus []int) *cpuPinner {
+	if len(cpus) == 0 {
+		return nil
+	}
+	return &cpuPinner{cpus: cpus, used: make([]int, len(cpus))}
+}
+
+// pin wires the calling goroutine to its OS thread for the rest of its life
+// and the thread to the least used CPU, and returns a function releasing the
+// CPU once the goroutine is done with it. Failures leave the thread
+// unpinned: the CPUs were checked when the Encryptor was created.
+func (p *cpuPinner) pin() (release func()) {
+	if p == nil {
+		return func() {}
+	}
+	p.mu.Lock()
+	i := 0
+	for j, n := range p.used {
+		if n < p.used[i] {
+			i = j
+		}
+	}
+	p.used[i]++
+	p.mu.Unlock()
+
+	// Never unlocked: the thread exits together with the goroutine.
+	runtime.LockOSThread()
+	_ = setThreadAffinity(p.cpus[i])
+	return func() {
+		p.mu.Lock()
+		p.used[i]--
+		p.mu.Unlock()
+	}
+}
+
+// parseCPUList parses a Linux CPU list such as "0-3,8,10-11".
+func parseCPUList(s string) ([]int, error) {
+	var cpus []int
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		lo, hi, isRange := strings.Cut(part, "-")
+		first, err := strconv.Atoi(lo)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CPU list %q", s)
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.Atoi(hi); err != nil || last < first {
+				return nil, fmt.Errorf("invalid CPU list %q", s)
+			}
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
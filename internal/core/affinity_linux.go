@@ -0,0 +1,51 @@
+//go:build linux
+
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// NodeCPUs returns the CPUs of NUMA node node, as listed in sysfs, to pass
+// to WithCPUAffinity. Machines without NUMA have a single node 0.
+func NodeCPUs(node int) ([]int, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/sys/devices/system/node/node%d/cpulist", node))
+	if err != nil {
+		return nil, WrapError(fmt.Sprintf("read CPUs of NUMA node %d", node), err)
+	}
+	return parseCPUList(string(data))
+}
+
+// checkCPUs reports whether the process may run on every CPU in cpus.
+func checkCPUs(cpus []int) error {
+	if len(cpus) == 0 {
+		return nil
+	}
+	var allowed unix.CPUSet
+	if err := unix.SchedGetaffinity(0, &allowed); err != nil {
+		return WrapError("read CPU affinity", err)
+	}
+	for _, cpu := range cpus {
+		if !allowed.IsSet(cpu) {
+			return fmt.Errorf("CPU %d is not available to the process", cpu)
+		}
+	}
+	return nil
+}
+
+// setThreadAffinity restricts the calling thread to cpu. On Linux
+// sched_setaffinity(2) with pid 0 applies to the calling thread only.
+func setThreadAffinity(cpu int) error {
+	var set unix.CPUSet
+	set.Set(cpu)
+	return unix.SchedSetaffinity(0, &set)
+}
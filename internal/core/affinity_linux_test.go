@@ -0,0 +1,50 @@
+//go:build linux
+
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestCPUPinner_PinsThread(t *testing.T) {
+	cpus, err := NodeCPUs(0)
+	if err != nil {
+		t.Skipf("no NUMA topology: %v", err)
+	}
+	if len(cpus) == 0 {
+		t.Skip("node 0 has no CPUs")
+	}
+	var allowed unix.CPUSet
+	if err := unix.SchedGetaffinity(0, &allowed); err != nil || !allowed.IsSet(cpus[0]) {
+		t.Skipf("CPU %d is not available", cpus[0])
+	}
+	p := newCPUPinner(cpus[:1])
+	done := make(chan unix.CPUSet)
+	// The goroutine's thread is discarded when it exits.
+	go func() {
+		defer p.pin()()
+		var set unix.CPUSet
+		_ = unix.SchedGetaffinity(0, &set)
+		done <- set
+	}()
+	if set := <-done; set.Count() != 1 || !set.IsSet(cpus[0]) {
+		t.Errorf("worker thread affinity has %d CPUs, want only CPU %d", set.Count(), cpus[0])
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	if _, err := NewEncryptor(key, WithPipeline(2), WithCPUAffinity(1023)); err == nil {
+		t.Error("expected error for a CPU unavailable to the process")
+	}
+}
@@ -0,0 +1,30 @@
+//go:build !linux
+
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"errors"
+	"fmt"
+)
+
+// NodeCPUs returns the CPUs of NUMA node node to pass to WithCPUAffinity.
+// It is only supported on Linux.
+func NodeCPUs(node int) ([]int, error) {
+	return nil, fmt.Errorf("NUMA topology: %w", errors.ErrUnsupported)
+}
+
+// checkCPUs accepts any CPU on platforms without thread affinity.
+func checkCPUs(cpus []int) error {
+	return nil
+}
+
+// setThreadAffinity is a no-op on platforms without thread affinity.
+func setThreadAffinity(cpu int) error {
+	return nil
+}
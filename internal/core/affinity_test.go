@@ -0,0 +1,105 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestParseCPUList(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []int
+		ok   bool
+	}{
+		{"0", []int{0}, true},
+		{"0-3,8,10-11\n", []int{0, 1, 2, 3, 8, 10, 11}, true},
+		{"", nil, true},
+		{"3-1", nil, false},
+		{"a", nil, false},
+		{"0,", nil, false},
+	}
+	for _, tt := range tests {
+		got, err := parseCPUList(tt.in)
+		if (err == nil) != tt.ok || !slices.Equal(got, tt.want) {
+			t.Errorf("parseCPUList(%q) = %v, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestCPUPinner_SpreadsWorkers(t *testing.T) {
+	// CPUs the process cannot use leave the threads unpinned, so only the
+	// bookkeeping is checked here.
+	p := newCPUPinner([]int{1022, 1023})
+	used := func() []int {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return slices.Clone(p.used)
+	}
+	// Pinned goroutines lock their threads, which are discarded on exit.
+	var wg sync.WaitGroup
+	pinned, release := make(chan struct{}), make(chan struct{})
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer p.pin()()
+			pinned <- struct{}{}
+			<-release
+		}()
+		<-pinned
+	}
+	if got := used(); !slices.Equal(got, []int{2, 1}) && !slices.Equal(got, []int{1, 2}) {
+		t.Errorf("used = %v, want workers spread over both CPUs", got)
+	}
+	close(release)
+	wg.Wait()
+	if got := used(); !slices.Equal(got, []int{0, 0}) {
+		t.Errorf("used = %v after release, want none", got)
+	}
+	if newCPUPinner(nil) != nil {
+		t.Error("expected no pinner without CPUs")
+	}
+}
+
+func TestWithCPUAffinity(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	data := make([]byte, 100*1024)
+	enc, err := NewEncryptor(key, WithPipeline(2), WithParallelism(ParallelismAuto), WithCPUAffinity(0))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	var buf bytes.Buffer
+	if err := enc.EncryptStream(context.Background(), bytes.NewReader(data), &buf); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	var out bytes.Buffer
+	if err := dec.DecryptStream(context.Background(), &buf, &out); err != nil || !bytes.Equal(out.Bytes(), data) {
+		t.Errorf("round trip failed: %v", err)
+	}
+
+	if _, err := NewEncryptor(key, WithCPUAffinity(0)); err == nil {
+		t.Error("expected error for CPU affinity without a pipeline")
+	}
+	if _, err := NewEncryptor(key, WithPipeline(2), WithCPUAffinity(-1)); err == nil {
+		t.Error("expected error for a negative CPU")
+	}
+}
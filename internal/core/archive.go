@@ -0,0 +1,127 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// archive.go: Push-based encryption for archive/zip and archive/tar writers
+package core
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+// StreamWriter encrypts what is written to it into a stream, like
+// EncryptStream reading from a pipe. Data is sealed a chunk at a time, so it
+// reaches the destination once a chunk is full; Close seals the last chunk
+// and writes the trailer. A stream that is not closed is incomplete and
+// fails to decrypt.
+type StreamWriter struct {
+	pw   *io.PipeWriter
+	done chan struct{}
+	stop func() bool
+	// err is the result of encryption, set when done is closed.
+	err error
+}
+
+// EncryptWriter returns a writer encrypting to dst, for APIs that produce
+// their output by writing, such as archive/tar and archive/zip, compressors
+// and encoders. If ctx is done before Close, writes and Close fail with its
+// error. The destination must be discarded if Write or Close fails.
+func (e *Encryptor) EncryptWriter(ctx context.Context, dst io.Writer) *StreamWriter {
+	pr, pw := io.Pipe()
+	w := &StreamWriter{pw: pw, done: make(chan struct{})}
+	w.stop = context.AfterFunc(ctx, func() { pr.CloseWithError(contextError(ctx)) })
+	go func() {
+		defer close(w.done)
+		err := e.EncryptStream(ctx, pr, dst)
+		if err != nil && ctx.Err() != nil {
+			err = withDetail(e.errDetail, "encrypt", "stream", contextError(ctx))
+		}
+		w.err = err
+		// Unblock writers if encryption stopped early.
+		pr.CloseWithError(err)
+	}()
+	return w
+}
+
+// Write encrypts p. It blocks until encryption has taken p, and fails with
+// the encryption error if encryption has stopped.
+func (w *StreamWriter) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+// Close seals the stream with its trailer, waits for it to be written and
+// returns the encryption error, if any. Calling Close again returns the same
+// error.
+func (w *StreamWriter) Close() error {
+	return w.CloseWithError(nil)
+}
+
+// CloseWithError ends the stream without sealing it if err is not nil,
+// such as when the producer failed, so the output fails to decrypt instead
+// of passing for a complete stream. It returns the encryption error, which
+// then wraps err. With a nil err it is Close.
+func (w *StreamWriter) CloseWithError(err error) error {
+	w.pw.CloseWithError(err)
+	<-w.done
+	w.stop()
+	if err != nil && !errors.Is(w.err, err) {
+		return errors.Join(err, w.err)
+	}
+	return w.err
+}
+
+// ZipWriter is a zip.Writer whose output is encrypted with EncryptWriter.
+// Its Close finishes the archive, writing the central directory, before
+// sealing the stream, so the archive is complete when decrypted; an archive
+// whose zip.Writer fails is left unsealed.
+type ZipWriter struct {
+	*zip.Writer
+	w     *StreamWriter
+	once  sync.Once
+	close error
+}
+
+// NewZipWriter returns a zip.Writer writing an encrypted archive to dst.
+// Read the archive back with zip.NewReader over NewIndexedReader if it was
+// written with WithChunkIndex, or by decrypting it to a file first.
+func (e *Encryptor) NewZipWriter(ctx context.Context, dst io.Writer) *ZipWriter {
+	w := e.EncryptWriter(ctx, dst)
+	return &ZipWriter{Writer: zip.NewWriter(w), w: w}
+}
+
+// Close finishes the archive and seals the encrypted stream.
+func (z *ZipWriter) Close() error {
+	z.once.Do(func() { z.close = z.w.CloseWithError(z.Writer.Close()) })
+	return z.close
+}
+
+// TarWriter is a tar.Writer whose output is encrypted with EncryptWriter.
+// Its Close writes the archive's end-of-archive blocks before sealing the
+// stream, so the archive is complete when decrypted; an archive whose
+// tar.Writer fails is left unsealed.
+type TarWriter struct {
+	*tar.Writer
+	w     *StreamWriter
+	once  sync.Once
+	close error
+}
+
+// NewTarWriter returns a tar.Writer writing an encrypted archive to dst.
+// Read the archive back with tar.NewReader over DecryptReader.
+func (e *Encryptor) NewTarWriter(ctx context.Context, dst io.Writer) *TarWriter {
+	w := e.EncryptWriter(ctx, dst)
+	return &TarWriter{Writer: tar.NewWriter(w), w: w}
+}
+
+// Close finishes the archive and seals the encrypted stream.
+func (t *TarWriter) Close() error {
+	t.once.Do(func() { t.close = t.w.CloseWithError(t.Writer.Close()) })
+	return t.close
+}
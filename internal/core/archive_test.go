@@ -0,0 +1,130 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestArchiveWriters(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	chunkOpt, err := WithChunkSize(4096)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	enc, err := NewEncryptor(key, chunkOpt, WithChunkIndex(true))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	ctx := context.Background()
+	content := make([]byte, 10000)
+	if _, err := rand.Read(content); err != nil {
+		t.Fatalf("failed to generate content: %v", err)
+	}
+
+	// A tar archive ends with two zero blocks written by Close, which must
+	// reach the stream before it is sealed.
+	var tarOut bytes.Buffer
+	tw := enc.NewTarWriter(ctx, &tarOut)
+	if err := tw.WriteHeader(&tar.Header{Name: "data.bin", Mode: 0600, Size: int64(len(content))}); err != nil {
+		t.Fatalf("WriteHeader failed: %v", err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	r, err := dec.DecryptReader(ctx, bytes.NewReader(tarOut.Bytes()))
+	if err != nil {
+		t.Fatalf("DecryptReader failed: %v", err)
+	}
+	tr := tar.NewReader(r)
+	if hdr, err := tr.Next(); err != nil || hdr.Name != "data.bin" {
+		t.Fatalf("tar Next = %v, %v", hdr, err)
+	}
+	if got, err := io.ReadAll(tr); err != nil || !bytes.Equal(got, content) {
+		t.Errorf("tar entry read %d bytes, %v", len(got), err)
+	}
+	if _, err := tr.Next(); err != io.EOF {
+		t.Errorf("tar Next at end = %v, want io.EOF", err)
+	}
+
+	// A zip archive ends with its central directory, and is read back at
+	// random through the chunk index.
+	var zipOut bytes.Buffer
+	zw := enc.NewZipWriter(ctx, &zipOut)
+	f, err := zw.Create("data.bin")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if _, err := f.Write(content); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	ir, err := dec.NewIndexedReader(bytes.NewReader(zipOut.Bytes()), int64(zipOut.Len()))
+	if err != nil {
+		t.Fatalf("NewIndexedReader failed: %v", err)
+	}
+	zr, err := zip.NewReader(ir, ir.Size())
+	if err != nil {
+		t.Fatalf("zip.NewReader failed: %v", err)
+	}
+	rc, err := zr.Open("data.bin")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if got, err := io.ReadAll(rc); err != nil || !bytes.Equal(got, content) {
+		t.Errorf("zip entry read %d bytes, %v", len(got), err)
+	}
+
+	// A producer that fails leaves the stream unsealed.
+	var failed bytes.Buffer
+	w := enc.EncryptWriter(ctx, &failed)
+	if _, err := w.Write(content); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	producerErr := errors.New("producer failed")
+	if err := w.CloseWithError(producerErr); !errors.Is(err, producerErr) {
+		t.Errorf("CloseWithError = %v, want the producer's error", err)
+	}
+	if err := dec.DecryptStream(ctx, bytes.NewReader(failed.Bytes()), io.Discard); !errors.Is(err, ErrCorruptedFile) {
+		t.Errorf("DecryptStream of an unsealed stream: error = %v, want ErrCorruptedFile", err)
+	}
+
+	// Cancellation unblocks writes.
+	cctx, cancel := context.WithCancel(ctx)
+	w = enc.EncryptWriter(cctx, io.Discard)
+	cancel()
+	for err = nil; err == nil; {
+		_, err = w.Write(content)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Write after cancel: error = %v, want context.Canceled", err)
+	}
+	if err := w.Close(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Close after cancel: error = %v, want context.Canceled", err)
+	}
+}
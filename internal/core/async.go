@@ -0,0 +1,199 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// async.go: Background file operations that can be paused and resumed
+package core
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Operation controls a file encryption or decryption running in the
+// background, started with EncryptFileAsync or DecryptFileAsync. Its methods
+// are safe for concurrent use, for example from a UI goroutine.
+type Operation struct {
+	cancel   context.CancelFunc
+	done     chan struct{}
+	err      error
+	finished time.Time
+	progress chan float64
+	// fraction holds the bits of the latest progress value.
+	fraction atomic.Uint64
+
+	// throttled counts the bytes already charged to a JobManager's
+	// BytesPerSecond limit; only the operation's goroutine uses it.
+	throttled int64
+
+	mu     sync.Mutex
+	paused bool
+	// resume is closed when a paused operation is resumed or canceled.
+	resume chan struct{}
+}
+
+// operationKey carries the Operation of a background run in its context.
+type operationKey struct{}
+
+// EncryptFileAsync starts encrypting srcPath to dstPath in the background
+// and returns at once. The operation can be paused between chunks and later
+// resumed where it stopped, so a long encryption need not be restarted from
+// scratch; while paused it holds its files open and does no I/O. Paused time
+// counts toward WithTimeout but not toward WithChunkDeadline.
+func (e *Encryptor) EncryptFileAsync(ctx context.Context, srcPath, dstPath string) *Operation {
+	return startOperation(ctx, func(ctx context.Context) error {
+		return e.EncryptFile(ctx, srcPath, dstPath)
+	})
+}
+
+// DecryptFileAsync starts decrypting srcPath to dstPath in the background;
+// see EncryptFileAsync.
+func (d *Decryptor) DecryptFileAsync(ctx context.Context, srcPath, dstPath string) *Operation {
+	return startOperation(ctx, func(ctx context.Context) error {
+		return d.DecryptFile(ctx, srcPath, dstPath)
+	})
+}
+
+func startOperation(ctx context.Context, run func(context.Context) error) *Operation {
+	ctx, cancel := context.WithCancel(ctx)
+	op := &Operation{
+		cancel:   cancel,
+		done:     make(chan struct{}),
+		progress: make(chan float64, 1),
+	}
+	go func() {
+		defer cancel()
+		err := run(context.WithValue(ctx, operationKey{}, op))
+		if err == nil {
+			op.report(1)
+		}
+		op.err, op.finished = err, time.Now()
+		close(op.progress)
+		close(op.done)
+	}()
+	return op
+}
+
+// Pause stops the operation after the chunk in progress. It has no effect
+// on a paused or finished operation.
+func (op *Operation) Pause() {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if !op.paused {
+		op.paused = true
+		op.resume = make(chan struct{})
+	}
+}
+
+// Resume continues a paused operation.
+func (op *Operation) Resume() {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if op.paused {
+		op.paused = false
+		close(op.resume)
+	}
+}
+
+// Paused reports whether the operation is paused.
+func (op *Operation) Paused() bool {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	return op.paused
+}
+
+// Cancel stops the operation, paused or not; Wait then returns an error
+// matching ErrContextCanceled and the partial output is removed.
+func (op *Operation) Cancel() {
+	op.cancel()
+}
+
+// Progress returns a channel receiving the fraction done, between 0.0 and
+// 1.0, after each chunk of a file whose size is known. Only the latest value
+// is kept, so a slow reader skips intermediate ones and never holds up the
+// operation. The channel is closed when the operation finishes.
+func (op *Operation) Progress() <-chan float64 {
+	return op.progress
+}
+
+// Done returns a channel that is closed when the operation finishes.
+func (op *Operation) Done() <-chan struct{} {
+	return op.done
+}
+
+// Wait blocks until the operation finishes and returns its error.
+func (op *Operation) Wait() error {
+	<-op.done
+	return op.err
+}
+
+// Fraction returns the latest progress value, as last sent on Progress.
+func (op *Operation) Fraction() float64 {
+	return math.Float64frombits(op.fraction.Load())
+}
+
+// report publishes fraction, replacing a value not yet received.
+func (op *Operation) report(fraction float64) {
+	op.fraction.Store(math.Float64bits(fraction))
+	select {
+	case <-op.progress:
+	default:
+	}
+	op.progress <- fraction
+}
+
+// checkpoint is called between the chunks of an operation with the bytes
+// done so far out of total (0 if unknown). In a background operation it
+// reports progress, waits for the I/O limit of its JobManager, if any, and
+// blocks while the operation is paused.
+func checkpoint(ctx context.Context, done, total int64) error {
+	op, ok := ctx.Value(operationKey{}).(*Operation)
+	if !ok {
+		return nil
+	}
+	if total > 0 {
+		op.report(progressFraction(done, total))
+	}
+	if limit, ok := ctx.Value(rateLimitKey{}).(*rateLimit); ok {
+		next := limit.reserve(done - op.throttled)
+		op.throttled = done
+		if err := idle(ctx, func() error { return pause(ctx, time.Until(next)) }); err != nil {
+			return err
+		}
+	}
+	op.mu.Lock()
+	paused, resume := op.paused, op.resume
+	op.mu.Unlock()
+	if !paused {
+		return nil
+	}
+	return idle(ctx, func() error {
+		select {
+		case <-resume:
+			return nil
+		case <-ctx.Done():
+			return contextError(ctx)
+		}
+	})
+}
+
+// idle runs wait with the chunk deadline of ctx, if any, stopped, so time
+// spent deliberately waiting is not mistaken for a stall.
+func idle(ctx context.Context, wait func() error) error {
+	w, _ := ctx.Value(chunkWatchKey{}).(*chunkWatch)
+	if w != nil {
+		w.timer.Stop()
+	}
+	if err := wait(); err != nil {
+		return err
+	}
+	if w != nil {
+		w.timer.Reset(w.d)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// async_test.go: Tests for pausable background operations
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// pausedAsync starts encrypting a 64-chunk file and pauses it after its
+// third chunk.
+func pausedAsync(t *testing.T, key, data []byte, dir string) (*Operation, string) {
+	t.Helper()
+	src := filepath.Join(dir, "src.bin")
+	if err := os.WriteFile(src, data, 0o600); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+	chunkOpt, err := WithChunkSize(1024)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	third, paused := make(chan struct{}), make(chan struct{})
+	enc, err := NewEncryptor(key, chunkOpt, WithChunkCallback(func(c ChunkInfo) {
+		if c.Index == 2 {
+			close(third)
+			<-paused
+		}
+	}))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	t.Cleanup(enc.Destroy)
+
+	dst := filepath.Join(dir, "dst.enc")
+	op := enc.EncryptFileAsync(context.Background(), src, dst)
+	<-third
+	op.Pause()
+	close(paused)
+	return op, dst
+}
+
+func TestEncryptFileAsync_PauseResume(t *testing.T) {
+	key := make([]byte, 32)
+	data := make([]byte, 64*1024)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("failed to generate data: %v", err)
+	}
+	dir := t.TempDir()
+	op, dst := pausedAsync(t, key, data, dir)
+
+	if !op.Paused() {
+		t.Fatal("operation not paused")
+	}
+	select {
+	case <-op.Done():
+		t.Fatal("paused operation finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if p := <-op.Progress(); p != 3.0/64 {
+		t.Errorf("progress while paused = %v, want %v", p, 3.0/64)
+	}
+
+	op.Resume()
+	if err := op.Wait(); err != nil {
+		t.Fatalf("operation failed: %v", err)
+	}
+	var last float64
+	for p := range op.Progress() {
+		last = p
+	}
+	if last != 1 {
+		t.Errorf("final progress = %v, want 1", last)
+	}
+
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	out := filepath.Join(dir, "out.bin")
+	if err := dec.DecryptFileAsync(context.Background(), dst, out).Wait(); err != nil {
+		t.Fatalf("DecryptFileAsync failed: %v", err)
+	}
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("round trip mismatch")
+	}
+}
+
+func TestEncryptFileAsync_CancelWhilePaused(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	op, dst := pausedAsync(t, key, make([]byte, 64*1024), t.TempDir())
+	op.Cancel()
+	if err := op.Wait(); !errors.Is(err, ErrContextCanceled) {
+		t.Fatalf("Wait = %v, want ErrContextCanceled", err)
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Errorf("partial output left behind: %v", err)
+	}
+}
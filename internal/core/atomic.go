@@ -0,0 +1,54 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// atomic.go: Crash-safe file replacement for go-fileencrypt
+package core
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// writeFileAtomic replaces path with the output of write. The data goes to a
+// temporary file in the same directory, which is synced and then renamed over
+// path, so readers see either the old or the new contents and never a partial
+// file. On failure the temporary file is removed and path is left untouched.
+// The directory needs enough free space for the complete new file; running
+// out of it fails with ErrNoSpace.
+func writeFileAtomic(path string, perm os.FileMode, write func(f *os.File) error) (err error) {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return WrapError("create temporary file", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+			err = noSpace(err)
+		}
+	}()
+
+	if err = tmp.Chmod(perm); err != nil {
+		return WrapError("set temporary file permissions", err)
+	}
+	if err = write(tmp); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return WrapError("sync temporary file", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return WrapError("close temporary file", err)
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return WrapError("replace file", err)
+	}
+	// The rename itself is durable only once the directory is synced. This is
+	// best effort: the new contents are already complete at this point.
+	_ = syncDir(dir)
+	return nil
+}
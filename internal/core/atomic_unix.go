@@ -0,0 +1,23 @@
+//go:build unix || darwin
+
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"os"
+)
+
+// syncDir fsyncs a directory so that renames within it are durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir) // #nosec G304 -- Directory of a caller-provided path
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,15 @@
+//go:build windows
+
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+// syncDir is a no-op on Windows, where directories cannot be opened for sync
+// and MoveFileEx already makes the rename durable.
+func syncDir(dir string) error {
+	return nil
+}
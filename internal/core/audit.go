@@ -0,0 +1,111 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// audit.go: Structured audit events for crypto operations
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"time"
+)
+
+// AuditEvent describes one completed operation for an AuditSink. It carries
+// no plaintext, key material or file names.
+type AuditEvent struct {
+	// Time is when the operation finished.
+	Time time.Time
+	// Operation is "encrypt", "decrypt", "verify" or "migrate".
+	Operation string
+	// Actor is the value attached to the context with ContextWithActor, if any.
+	Actor string
+	// PathHash is the hex SHA-256 of the absolute path of the file or
+	// directory operated on, so access to a known file can be proven without
+	// the audit trail naming any file. It is empty for streams and records.
+	PathHash string
+	// KeyID is the KeyFingerprint of the key, which identifies it without
+	// revealing it.
+	KeyID string
+	// Algorithm is the cipher used.
+	Algorithm Algorithm
+	// PlaintextBytes is the number of plaintext bytes processed.
+	PlaintextBytes int64
+	// Duration is the wall-clock time of the operation.
+	Duration time.Duration
+	// Err is nil on success. Otherwise it is the sanitized error (see
+	// SanitizeError), which still matches its category with errors.Is.
+	Err error
+}
+
+// AuditSink receives an AuditEvent for every file, stream, directory and
+// record operation of an Encryptor or Decryptor configured with
+// WithAuditSink. Audit is called synchronously before the operation returns
+// and may be called concurrently.
+type AuditSink interface {
+	Audit(AuditEvent)
+}
+
+// AuditFunc adapts a function to an AuditSink.
+type AuditFunc func(AuditEvent)
+
+// Audit calls f(event).
+func (f AuditFunc) Audit(event AuditEvent) {
+	f(event)
+}
+
+type actorKey struct{}
+
+// ContextWithActor returns a context whose operations are attributed to actor
+// (a user, service account or request ID) in audit events.
+func ContextWithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// auditor sends the events of one Encryptor or Decryptor to its sink.
+type auditor struct {
+	sink  AuditSink
+	keyID string
+}
+
+// newAuditor returns an auditor for key, or nil without a sink.
+func newAuditor(sink AuditSink, key []byte) (*auditor, error) {
+	if sink == nil {
+		return nil, nil
+	}
+	id, err := KeyFingerprint(key)
+	if err != nil {
+		return nil, err
+	}
+	return &auditor{sink: sink, keyID: id}, nil
+}
+
+// audit reports an operation on path ("" for streams and records) to the
+// sink, if any.
+func (a *auditor) audit(ctx context.Context, op, path string, alg Algorithm, plaintext int64, start time.Time, err error) {
+	if a == nil {
+		return
+	}
+	event := AuditEvent{
+		Time:           time.Now(),
+		Operation:      op,
+		KeyID:          a.keyID,
+		Algorithm:      alg,
+		PlaintextBytes: plaintext,
+		Duration:       time.Since(start),
+		Err:            SanitizeError(err),
+	}
+	event.Actor, _ = ctx.Value(actorKey{}).(string)
+	if path != "" {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		sum := sha256.Sum256([]byte(path))
+		event.PathHash = hex.EncodeToString(sum[:])
+	}
+	a.sink.Audit(event)
+}
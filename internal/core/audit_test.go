@@ -0,0 +1,108 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestAuditSink(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	var (
+		mu     sync.Mutex
+		events []AuditEvent
+	)
+	sink := AuditFunc(func(e AuditEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	})
+
+	tmpDir := t.TempDir()
+	srcPath := filepath.Join(tmpDir, "report.txt")
+	encPath := filepath.Join(tmpDir, "report.txt.enc")
+	if err := os.WriteFile(srcPath, []byte("quarterly numbers"), 0600); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+
+	enc, err := NewEncryptor(key, WithAuditSink(sink))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	dec, err := NewDecryptor(key, WithAuditSink(sink))
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+
+	ctx := ContextWithActor(context.Background(), "alice")
+	if err := enc.EncryptFile(ctx, srcPath, encPath); err != nil {
+		t.Fatalf("EncryptFile failed: %v", err)
+	}
+	if err := dec.DecryptFile(context.Background(), encPath, filepath.Join(tmpDir, "out.txt")); err != nil {
+		t.Fatalf("DecryptFile failed: %v", err)
+	}
+	if _, err := dec.DecryptRecord([]byte("not a record"), nil); err == nil {
+		t.Fatal("DecryptRecord accepted garbage")
+	}
+
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d: %+v", len(events), events)
+	}
+	abs, err := filepath.Abs(srcPath)
+	if err != nil {
+		t.Fatalf("Abs failed: %v", err)
+	}
+	sum := sha256.Sum256([]byte(abs))
+	e := events[0]
+	if e.Operation != "encrypt" || e.Actor != "alice" || e.PathHash != hex.EncodeToString(sum[:]) || e.PlaintextBytes != 17 || e.Err != nil {
+		t.Errorf("unexpected encrypt event: %+v", e)
+	}
+	if len(e.KeyID) != 16 || events[1].KeyID != e.KeyID {
+		t.Errorf("key IDs %q and %q should be equal 16-character fingerprints", e.KeyID, events[1].KeyID)
+	}
+	if e.Time.IsZero() || e.Algorithm != AlgorithmAESGCM {
+		t.Errorf("unexpected encrypt event: %+v", e)
+	}
+	if e := events[1]; e.Operation != "decrypt" || e.Actor != "" || e.Err != nil {
+		t.Errorf("unexpected decrypt event: %+v", e)
+	}
+	if e := events[2]; e.Operation != "decrypt" || e.PathHash != "" || !errors.Is(e.Err, ErrCorruptedFile) {
+		t.Errorf("unexpected record event: %+v", e)
+	}
+	for _, e := range events {
+		if strings.Contains(e.KeyID, hex.EncodeToString(key[:8])) {
+			t.Errorf("key ID %q reveals the key", e.KeyID)
+		}
+	}
+
+	// A different key has a different fingerprint.
+	other := make([]byte, 32)
+	if _, err := rand.Read(other); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	id, err := KeyFingerprint(other)
+	if err != nil {
+		t.Fatalf("KeyFingerprint failed: %v", err)
+	}
+	if id == events[0].KeyID {
+		t.Error("different keys share a key ID")
+	}
+}
@@ -0,0 +1,83 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// backup.go: Recovering damaged headers from the backup copy at the end of a file
+package core
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"os"
+
+	"github.com/gitrgoliveira/go-fileencrypt/format"
+)
+
+// fileSource returns the reader to decrypt f from together with the header it
+// starts with, or nil if the header cannot be read. When the header at the
+// start of f is damaged and the backup copy at its end is intact, the reader
+// yields the copy in place of the damaged bytes. Concatenated segments are
+// read as they are.
+func (d *Decryptor) fileSource(f *os.File) (io.Reader, []byte) {
+	if d.multiSegment {
+		// The end of the file belongs to the last segment.
+		return f, nil
+	}
+	if backup := d.backupHeader(f); backup != nil {
+		rest := io.NewSectionReader(f, int64(len(backup)), math.MaxInt64-int64(len(backup)))
+		return io.MultiReader(bytes.NewReader(backup), rest), backup
+	}
+	h, err := format.ReadHeader(io.NewSectionReader(f, 0, math.MaxInt64))
+	if err != nil {
+		return f, nil
+	}
+	return f, h.Marshal()
+}
+
+// backupHeader returns the backup header at the end of f if it differs from
+// the header at the start and authenticates the trailer, or nil. Every record
+// is bound to the exact header bytes, so at most one of two differing headers
+// authenticates and a damaged copy never replaces an intact header.
+func (d *Decryptor) backupHeader(f *os.File) []byte {
+	stat, err := f.Stat()
+	if err != nil || !stat.Mode().IsRegular() {
+		return nil
+	}
+	// The copy is HeaderSize bytes, or more with FlagHeaderCRC and
+	// FlagPart; the last bytes of the file hold any of them.
+	tail := make([]byte, maxHeaderSize)
+	if stat.Size() < int64(2*HeaderSize+TrailerSize) {
+		return nil
+	}
+	if _, err := f.ReadAt(tail, stat.Size()-int64(len(tail))); err != nil {
+		return nil
+	}
+	for _, n := range []int{HeaderSize, HeaderSize + format.HeaderCRCSize, HeaderSize + format.PartSize, maxHeaderSize} {
+		backup := tail[len(tail)-n:]
+		h, err := format.ParseHeader(backup)
+		if err != nil || h.Len() != n || h.Flags&format.FlagBackupHeader == 0 || !h.HasTrailer() || h.Flags.Check(supportedFlags) != nil {
+			continue
+		}
+		header := make([]byte, n)
+		if _, err := f.ReadAt(header, 0); err != nil || bytes.Equal(header, backup) {
+			return nil
+		}
+		end := stat.Size() - int64(n)
+		trailer := make([]byte, TrailerSize-format.LengthSize)
+		if _, err := f.ReadAt(trailer, end-int64(len(trailer))); err != nil {
+			return nil
+		}
+		gcm, err := d.newAEAD()
+		if err != nil {
+			return nil
+		}
+		if _, _, err := openTrailer(gcm, h.Nonce[:], h.AAD(), trailer); err != nil {
+			return nil
+		}
+		return backup
+	}
+	return nil
+}
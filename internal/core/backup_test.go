@@ -0,0 +1,197 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gitrgoliveira/go-fileencrypt/format"
+)
+
+func TestWithBackupHeader_RoundTrip(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	chunkOpt, err := WithChunkSize(1024)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	enc, err := NewEncryptor(key, chunkOpt, WithBackupHeader(true), WithChunkIndex(true))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+
+	data := make([]byte, 5000)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("failed to generate data: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := enc.EncryptStream(context.Background(), bytes.NewReader(data), &buf, int64(len(data))); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+	ciphertext := buf.Bytes()
+
+	h, err := format.ParseHeader(ciphertext)
+	if err != nil {
+		t.Fatalf("ParseHeader failed: %v", err)
+	}
+	if h.Flags&format.FlagBackupHeader == 0 {
+		t.Fatalf("header flags %v lack the backup-header flag", h.Flags)
+	}
+	if backup := ciphertext[len(ciphertext)-HeaderSize:]; !bytes.Equal(backup, ciphertext[:HeaderSize]) {
+		t.Fatal("file does not end with a copy of its header")
+	}
+	want, err := EstimateEncryptedSize(int64(len(data)), 1024, WithBackupHeader(true), WithChunkIndex(true))
+	if err != nil {
+		t.Fatalf("EstimateEncryptedSize failed: %v", err)
+	}
+	if int64(len(ciphertext)) != want {
+		t.Errorf("encrypted size = %d, want %d", len(ciphertext), want)
+	}
+
+	var out bytes.Buffer
+	if err := dec.DecryptStream(context.Background(), bytes.NewReader(ciphertext), &out); err != nil {
+		t.Fatalf("DecryptStream failed: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Fatal("decrypted data does not match")
+	}
+
+	r, err := dec.NewIndexedReader(bytes.NewReader(ciphertext), int64(len(ciphertext)))
+	if err != nil {
+		t.Fatalf("NewIndexedReader failed: %v", err)
+	}
+	part := make([]byte, 100)
+	if _, err := r.ReadAt(part, 3000); err != nil {
+		t.Fatalf("ReadAt failed: %v", err)
+	}
+	if !bytes.Equal(part, data[3000:3100]) {
+		t.Error("indexed read does not match")
+	}
+
+	fr, err := format.NewReader(bytes.NewReader(ciphertext))
+	if err != nil {
+		t.Fatalf("format.NewReader failed: %v", err)
+	}
+	for {
+		if _, err := fr.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("format.Reader.Next failed: %v", err)
+		}
+	}
+	if fr.Offset() != int64(len(ciphertext)) {
+		t.Errorf("format.Reader consumed %d bytes, want %d", fr.Offset(), len(ciphertext))
+	}
+}
+
+func TestWithBackupHeader_Recovery(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	enc, err := NewEncryptor(key, WithBackupHeader(true))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+
+	dir := t.TempDir()
+	data := make([]byte, 3000)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("failed to generate data: %v", err)
+	}
+	srcPath := filepath.Join(dir, "plain")
+	if err := os.WriteFile(srcPath, data, 0o600); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+	encPath := filepath.Join(dir, "plain.enc")
+	if err := enc.EncryptFile(context.Background(), srcPath, encPath); err != nil {
+		t.Fatalf("EncryptFile failed: %v", err)
+	}
+	original, err := os.ReadFile(encPath)
+	if err != nil {
+		t.Fatalf("failed to read encrypted file: %v", err)
+	}
+
+	damage := func(t *testing.T, offsets ...int) string {
+		t.Helper()
+		ciphertext := bytes.Clone(original)
+		for _, off := range offsets {
+			if off < 0 {
+				off += len(ciphertext)
+			}
+			ciphertext[off] ^= 0xFF
+		}
+		path := filepath.Join(t.TempDir(), "damaged.enc")
+		if err := os.WriteFile(path, ciphertext, 0o600); err != nil {
+			t.Fatalf("failed to write damaged file: %v", err)
+		}
+		return path
+	}
+
+	// Magic, version, flags, nonce and size of the first header.
+	for _, off := range []int{0, 3, 5, 10, 25} {
+		path := damage(t, off)
+		outPath := filepath.Join(t.TempDir(), "out")
+		if err := dec.DecryptFile(context.Background(), path, outPath); err != nil {
+			t.Fatalf("DecryptFile with header byte %d damaged failed: %v", off, err)
+		}
+		got, err := os.ReadFile(outPath)
+		if err != nil {
+			t.Fatalf("failed to read output: %v", err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("decrypted data does not match with header byte %d damaged", off)
+		}
+		if err := dec.VerifyFile(context.Background(), path); err != nil {
+			t.Errorf("VerifyFile with header byte %d damaged failed: %v", off, err)
+		}
+
+		// Streams cannot seek to the copy.
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("failed to open damaged file: %v", err)
+		}
+		err = dec.DecryptStream(context.Background(), f, io.Discard)
+		f.Close()
+		if err == nil {
+			t.Errorf("DecryptStream with header byte %d damaged succeeded", off)
+		}
+	}
+
+	// A damaged copy is detected but never replaces the intact header.
+	if err := dec.VerifyFile(context.Background(), damage(t, -5)); !errors.Is(err, ErrCorruptedFile) {
+		t.Errorf("VerifyFile with a damaged backup header = %v, want ErrCorruptedFile", err)
+	}
+	if err := dec.VerifyFile(context.Background(), damage(t, 10, -5)); err == nil {
+		t.Error("VerifyFile with both headers damaged succeeded")
+	}
+	// The copy does not help with damaged chunks.
+	if err := dec.VerifyFile(context.Background(), damage(t, 10, HeaderSize+10)); err == nil {
+		t.Error("VerifyFile with a damaged header and chunk succeeded")
+	}
+}
@@ -0,0 +1,123 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// batch.go: Encrypting and decrypting many files with one session
+package core
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// BatchItem names one source/destination pair of a batch operation.
+type BatchItem struct {
+	Src string
+	Dst string
+}
+
+// BatchResult is the outcome of one BatchItem. Err is nil on success.
+// Skipped is set when the item was rejected by WithInclude, WithExclude or
+// WithFilter and left untouched.
+type BatchResult struct {
+	Item    BatchItem
+	Err     error
+	Skipped bool
+	// Checksum is the checksum of Dst when WithChecksum is enabled.
+	Checksum []byte
+}
+
+// EncryptFiles encrypts each item in order with the same initialized cipher
+// and buffer pools, which is considerably cheaper than creating an Encryptor
+// per file when processing many small files. A failing item does not stop the
+// batch; once ctx is done, the remaining items fail with the context error.
+// Items rejected by WithInclude, WithExclude or WithFilter are marked Skipped;
+// patterns are matched against Src.
+//
+// With WithChecksum, finished outputs are hashed in parallel with the
+// encryption of the next items and the checksums are returned in the results
+// rather than in the OperationReport.
+func (e *Encryptor) EncryptFiles(ctx context.Context, items []BatchItem) []BatchResult {
+	op := func(ctx context.Context, src, dst string) error {
+		return e.runEncryptFile(ctx, src, dst, false)
+	}
+	return runBatch(ctx, items, e.filter, op, e.batchChecksum())
+}
+
+// DecryptFiles decrypts each item in order with the same initialized cipher
+// and buffer pools. It follows the same rules as EncryptFiles.
+func (d *Decryptor) DecryptFiles(ctx context.Context, items []BatchItem) []BatchResult {
+	op := func(ctx context.Context, src, dst string) error {
+		return d.runDecryptFile(ctx, src, dst, false)
+	}
+	return runBatch(ctx, items, d.filter, op, d.batchChecksum())
+}
+
+// batchChecksum returns the function hashing batch outputs, or nil when
+// checksums are disabled.
+func (e *Encryptor) batchChecksum() func(BatchItem) ([]byte, error) {
+	if !e.checksum || e.plan != nil {
+		return nil
+	}
+	return func(item BatchItem) ([]byte, error) {
+		sum, err := fileChecksum(item.Dst, e.checksumHash)
+		return sum, withDetail(e.errDetail, "encrypt", item.Src, err)
+	}
+}
+
+func (d *Decryptor) batchChecksum() func(BatchItem) ([]byte, error) {
+	if !d.checksum {
+		return nil
+	}
+	return func(item BatchItem) ([]byte, error) {
+		sum, err := fileChecksum(item.Dst, d.checksumHash)
+		return sum, withDetail(d.errDetail, "decrypt", item.Src, err)
+	}
+}
+
+// runBatch applies op to each allowed item in order. When checksum is set,
+// each successful output is hashed in a separate goroutine, with at most
+// GOMAXPROCS hashes running at once, and runBatch waits for them all.
+func runBatch(ctx context.Context, items []BatchItem, filter fileFilter, op func(ctx context.Context, src, dst string) error, checksum func(BatchItem) ([]byte, error)) []BatchResult {
+	results := make([]BatchResult, len(items))
+	var hashing sync.WaitGroup
+	slots := make(chan struct{}, runtime.GOMAXPROCS(0))
+	for i, item := range items {
+		results[i].Item = item
+		if ctx.Err() != nil {
+			results[i].Err = contextError(ctx)
+			continue
+		}
+		var info fs.FileInfo
+		if filter.pred != nil {
+			var err error
+			if info, err = os.Stat(item.Src); err != nil {
+				results[i].Err = WrapError("stat source file", err)
+				continue
+			}
+		}
+		if !filter.allows(filepath.ToSlash(item.Src), info) {
+			results[i].Skipped = true
+			continue
+		}
+		results[i].Err = op(ctx, item.Src, item.Dst)
+		if checksum == nil || results[i].Err != nil {
+			continue
+		}
+		slots <- struct{}{}
+		hashing.Add(1)
+		go func(r *BatchResult) {
+			defer hashing.Done()
+			defer func() { <-slots }()
+			r.Checksum, r.Err = checksum(r.Item)
+		}(&results[i])
+	}
+	hashing.Wait()
+	return results
+}
@@ -0,0 +1,158 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptFiles_RoundTrip(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	enc, err := NewEncryptor(key)
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+
+	tmpDir := t.TempDir()
+	var encItems, decItems []BatchItem
+	for i := 0; i < 20; i++ {
+		src := filepath.Join(tmpDir, fmt.Sprintf("file%d.txt", i))
+		if err := os.WriteFile(src, bytes.Repeat([]byte{byte(i)}, i*10), 0600); err != nil {
+			t.Fatalf("failed to write source: %v", err)
+		}
+		encItems = append(encItems, BatchItem{Src: src, Dst: src + ".enc"})
+		decItems = append(decItems, BatchItem{Src: src + ".enc", Dst: src + ".dec"})
+	}
+	// A missing source fails on its own without stopping the batch.
+	missing := filepath.Join(tmpDir, "missing.txt")
+	encItems = append(encItems[:5], append([]BatchItem{{Src: missing, Dst: missing + ".enc"}}, encItems[5:]...)...)
+
+	results := enc.EncryptFiles(context.Background(), encItems)
+	if len(results) != len(encItems) {
+		t.Fatalf("expected %d results, got %d", len(encItems), len(results))
+	}
+	for _, r := range results {
+		if r.Item.Src == missing {
+			if !errors.Is(r.Err, os.ErrNotExist) {
+				t.Errorf("expected os.ErrNotExist for missing source, got %v", r.Err)
+			}
+			continue
+		}
+		if r.Err != nil {
+			t.Errorf("encrypt %s failed: %v", r.Item.Src, r.Err)
+		}
+	}
+
+	for _, r := range dec.DecryptFiles(context.Background(), decItems) {
+		if r.Err != nil {
+			t.Errorf("decrypt %s failed: %v", r.Item.Src, r.Err)
+		}
+	}
+	for i, item := range encItems {
+		if item.Src == missing {
+			continue
+		}
+		want, _ := os.ReadFile(item.Src)
+		got, err := os.ReadFile(item.Src + ".dec")
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("item %d: decrypted data does not match", i)
+		}
+	}
+}
+
+func TestEncryptFiles_Canceled(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	enc, err := NewEncryptor(key)
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tmpDir := t.TempDir()
+	items := []BatchItem{
+		{Src: filepath.Join(tmpDir, "a"), Dst: filepath.Join(tmpDir, "a.enc")},
+		{Src: filepath.Join(tmpDir, "b"), Dst: filepath.Join(tmpDir, "b.enc")},
+	}
+	for _, r := range enc.EncryptFiles(ctx, items) {
+		if !errors.Is(r.Err, ErrContextCanceled) || !errors.Is(r.Err, context.Canceled) {
+			t.Errorf("expected cancellation error for %s, got %v", r.Item.Src, r.Err)
+		}
+	}
+}
+
+func TestEncryptFiles_ParallelChecksums(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	for _, newHash := range []func() hash.Hash{nil, NewBLAKE2b256} {
+		opts := []Option{WithChecksum(true)}
+		if newHash != nil {
+			opts = append(opts, WithChecksumHash(newHash))
+		} else {
+			newHash = sha256.New
+		}
+		enc, err := NewEncryptor(key, opts...)
+		if err != nil {
+			t.Fatalf("NewEncryptor failed: %v", err)
+		}
+		dec, err := NewDecryptor(key, opts...)
+		if err != nil {
+			t.Fatalf("NewDecryptor failed: %v", err)
+		}
+
+		tmpDir := t.TempDir()
+		var encItems, decItems []BatchItem
+		for i := 0; i < 20; i++ {
+			src := filepath.Join(tmpDir, fmt.Sprintf("file%d.txt", i))
+			if err := os.WriteFile(src, bytes.Repeat([]byte{byte(i)}, i*100), 0600); err != nil {
+				t.Fatalf("failed to write source: %v", err)
+			}
+			encItems = append(encItems, BatchItem{Src: src, Dst: src + ".enc"})
+			decItems = append(decItems, BatchItem{Src: src + ".enc", Dst: src + ".dec"})
+		}
+
+		for _, results := range [][]BatchResult{
+			enc.EncryptFiles(context.Background(), encItems),
+			dec.DecryptFiles(context.Background(), decItems),
+		} {
+			for _, r := range results {
+				want, err := CalculateFileHash(r.Item.Dst, newHash)
+				if r.Err != nil || err != nil || !bytes.Equal(r.Checksum, want) {
+					t.Errorf("%s: checksum %x, want %x (%v, %v)", r.Item.Dst, r.Checksum, want, r.Err, err)
+				}
+			}
+		}
+		enc.Destroy()
+		dec.Destroy()
+	}
+}
@@ -0,0 +1,57 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// bufpool.go: Reusable buffered I/O for file operations
+package core
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"sync"
+)
+
+// ioPools recycles the bufio readers and writers used by file operations so
+// repeated calls on one Encryptor or Decryptor do not reallocate chunk-sized
+// buffers for every file.
+type ioPools struct {
+	readers sync.Pool
+	writers sync.Pool
+}
+
+func newIOPools(size int) *ioPools {
+	return &ioPools{
+		readers: sync.Pool{New: func() interface{} { return bufio.NewReaderSize(nil, size) }},
+		writers: sync.Pool{New: func() interface{} { return bufio.NewWriterSize(nil, size) }},
+	}
+}
+
+// reader returns a pooled reader buffering r, which stops reading once ctx
+// is done.
+func (p *ioPools) reader(ctx context.Context, r io.Reader) *bufio.Reader {
+	br := p.readers.Get().(*bufio.Reader)
+	br.Reset(newCtxReader(ctx, r))
+	return br
+}
+
+func (p *ioPools) putReader(br *bufio.Reader) {
+	br.Reset(nil)
+	p.readers.Put(br)
+}
+
+// writer returns a pooled writer buffering w, which stops writing once ctx
+// is done.
+func (p *ioPools) writer(ctx context.Context, w io.Writer) *bufio.Writer {
+	bw := p.writers.Get().(*bufio.Writer)
+	bw.Reset(newCtxWriter(ctx, w))
+	return bw
+}
+
+// putWriter returns bw to the pool, discarding any unflushed data.
+func (p *ioPools) putWriter(bw *bufio.Writer) {
+	bw.Reset(nil)
+	p.writers.Put(bw)
+}
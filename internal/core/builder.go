@@ -0,0 +1,148 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// builder.go: Fluent construction of validated options
+package core
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// OptionsBuilder collects settings with chainable methods and checks them
+// together in Build, so a misconfiguration is reported once, with every
+// problem listed, instead of at the first option that happens to return an
+// error:
+//
+//	opt, err := NewOptionsBuilder().ChunkSize(4 << 20).Checksum(true).Build()
+//
+// Setter methods never fail; the zero OptionsBuilder is ready to use.
+type OptionsBuilder struct {
+	opts []Option
+}
+
+// NewOptionsBuilder returns an empty OptionsBuilder.
+func NewOptionsBuilder() *OptionsBuilder {
+	return &OptionsBuilder{}
+}
+
+// set records opt and returns b for chaining.
+func (b *OptionsBuilder) set(opt Option) *OptionsBuilder {
+	b.opts = append(b.opts, opt)
+	return b
+}
+
+// ChunkSize sets the chunk size; see WithChunkSize.
+func (b *OptionsBuilder) ChunkSize(size int) *OptionsBuilder {
+	return b.set(func(cfg *Config) { cfg.ChunkSize = size })
+}
+
+// MaxChunkSizeLimit caps the chunk size; see WithMaxChunkSizeLimit.
+func (b *OptionsBuilder) MaxChunkSizeLimit(limit int) *OptionsBuilder {
+	return b.set(WithMaxChunkSizeLimit(limit))
+}
+
+// Progress sets the progress callback; see WithProgress.
+func (b *OptionsBuilder) Progress(cb func(float64)) *OptionsBuilder {
+	return b.set(WithProgress(cb))
+}
+
+// Checksum enables output checksums; see WithChecksum.
+func (b *OptionsBuilder) Checksum(enable bool) *OptionsBuilder {
+	return b.set(WithChecksum(enable))
+}
+
+// Algorithm sets the encryption algorithm; see WithAlgorithm.
+func (b *OptionsBuilder) Algorithm(alg Algorithm) *OptionsBuilder {
+	return b.set(WithAlgorithm(alg))
+}
+
+// ErrorDetail sets the error detail level; see WithErrorDetail.
+func (b *OptionsBuilder) ErrorDetail(level ErrorDetail) *OptionsBuilder {
+	return b.set(WithErrorDetail(level))
+}
+
+// Report sets the operation report; see WithReport.
+func (b *OptionsBuilder) Report(r *OperationReport) *OptionsBuilder {
+	return b.set(WithReport(r))
+}
+
+// ChunkIndex enables the chunk index; see WithChunkIndex.
+func (b *OptionsBuilder) ChunkIndex(enable bool) *OptionsBuilder {
+	return b.set(WithChunkIndex(enable))
+}
+
+// Pipeline sets the encryption pipeline depth; see WithPipeline.
+func (b *OptionsBuilder) Pipeline(depth int) *OptionsBuilder {
+	return b.set(WithPipeline(depth))
+}
+
+// Priority sets the scheduling priority; see WithPriority.
+func (b *OptionsBuilder) Priority(p Priority) *OptionsBuilder {
+	return b.set(WithPriority(p))
+}
+
+// ChunkDelay sets the pause between chunks; see WithChunkDelay.
+func (b *OptionsBuilder) ChunkDelay(d time.Duration) *OptionsBuilder {
+	return b.set(WithChunkDelay(d))
+}
+
+// Manifest sets the directory manifest path; see WithManifest.
+func (b *OptionsBuilder) Manifest(path string) *OptionsBuilder {
+	return b.set(WithManifest(path))
+}
+
+// AuditSink sets the audit sink; see WithAuditSink.
+func (b *OptionsBuilder) AuditSink(sink AuditSink) *OptionsBuilder {
+	return b.set(WithAuditSink(sink))
+}
+
+// KeyLimits sets key usage limits; see WithKeyLimits.
+func (b *OptionsBuilder) KeyLimits(limits KeyLimits) *OptionsBuilder {
+	return b.set(WithKeyLimits(limits))
+}
+
+// With adds options that have no builder method.
+func (b *OptionsBuilder) With(opts ...Option) *OptionsBuilder {
+	for _, opt := range opts {
+		if opt != nil {
+			b.opts = append(b.opts, opt)
+		}
+	}
+	return b
+}
+
+// Build applies the collected settings to the defaults and validates the
+// result as NewEncryptor would, and also rejects algorithms that are not
+// implemented yet. Every problem is reported, joined with errors.Join. The
+// returned Option applies the settings in the order they were made.
+func (b *OptionsBuilder) Build() (Option, error) {
+	opts := append([]Option(nil), b.opts...)
+	cfg := &Config{
+		ChunkSize: DefaultChunkSize,
+		Algorithm: AlgorithmAESGCM,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	var errs []error
+	if !cfg.Algorithm.IsSupported() {
+		errs = append(errs, fmt.Errorf("unsupported algorithm: %s (only AES-256-GCM is currently supported)", cfg.Algorithm))
+	}
+	if err := cfg.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return func(cfg *Config) {
+		for _, opt := range opts {
+			opt(cfg)
+		}
+	}, nil
+}
@@ -0,0 +1,54 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"crypto/rand"
+	"strings"
+	"testing"
+)
+
+func TestOptionsBuilder(t *testing.T) {
+	var report OperationReport
+	opt, err := NewOptionsBuilder().ChunkSize(4096).Checksum(true).Report(&report).Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	enc, err := NewEncryptor(key, opt)
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	if enc.chunkSize != 4096 || !enc.checksum || enc.report != &report {
+		t.Errorf("settings not applied: chunk size %d, checksum %v", enc.chunkSize, enc.checksum)
+	}
+
+	// Every problem is reported at once.
+	_, err = NewOptionsBuilder().
+		ChunkSize(0).
+		Pipeline(-1).
+		Algorithm(AlgorithmChaCha20Poly1305).
+		With(WithObfuscatedNames(true)).
+		Build()
+	if err == nil {
+		t.Fatal("Build accepted invalid settings")
+	}
+	for _, want := range []string{"invalid chunk size", "invalid pipeline depth", "unsupported algorithm", "obfuscated names require WithManifest"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+
+	// A limit set after the chunk size still applies to it.
+	if _, err := NewOptionsBuilder().ChunkSize(1 << 20).MaxChunkSizeLimit(64 << 10).Build(); err == nil {
+		t.Error("expected chunk size above the limit to be rejected")
+	}
+}
@@ -0,0 +1,65 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// capabilities.go: CPU feature detection and algorithm advice
+package core
+
+import (
+	"runtime"
+
+	"golang.org/x/sys/cpu"
+)
+
+// CPUCapabilities reports the hardware support for the ciphers of this
+// package on the running machine.
+type CPUCapabilities struct {
+	// Arch is the architecture the program was built for (runtime.GOARCH).
+	Arch string
+	// AES reports AES instructions (AES-NI on x86, the AES extension on ARM64).
+	AES bool
+	// CarrylessMultiply reports the carry-less multiplication used by GCM
+	// (PCLMULQDQ on x86, PMULL on ARM64).
+	CarrylessMultiply bool
+	// AESGCMAccelerated reports whether AES-GCM runs on dedicated hardware
+	// rather than Go's slower, table-free software fallback.
+	AESGCMAccelerated bool
+}
+
+// Capabilities detects the hardware cryptography support of the running
+// machine.
+func Capabilities() CPUCapabilities {
+	c := CPUCapabilities{Arch: runtime.GOARCH}
+	switch runtime.GOARCH {
+	case "amd64", "386":
+		c.AES, c.CarrylessMultiply = cpu.X86.HasAES, cpu.X86.HasPCLMULQDQ
+		c.AESGCMAccelerated = c.AES && c.CarrylessMultiply
+	case "arm64":
+		c.AES, c.CarrylessMultiply = cpu.ARM64.HasAES, cpu.ARM64.HasPMULL
+		c.AESGCMAccelerated = c.AES && c.CarrylessMultiply
+	case "s390x":
+		c.AES, c.CarrylessMultiply = cpu.S390X.HasAES, cpu.S390X.HasGHASH
+		c.AESGCMAccelerated = cpu.S390X.HasAESGCM
+	case "ppc64le":
+		// Go requires POWER8, whose vector crypto instructions back AES-GCM.
+		c.AES, c.CarrylessMultiply, c.AESGCMAccelerated = true, true, true
+	}
+	return c
+}
+
+// RecommendedAlgorithm returns the algorithm best suited to this machine:
+// AES-256-GCM where it is hardware accelerated, and ChaCha20-Poly1305
+// elsewhere once that algorithm is supported. Until then it always returns
+// AlgorithmAESGCM, so the result can be passed to WithAlgorithm unchecked.
+func RecommendedAlgorithm() Algorithm {
+	return recommendAlgorithm(Capabilities())
+}
+
+func recommendAlgorithm(c CPUCapabilities) Algorithm {
+	if !c.AESGCMAccelerated && AlgorithmChaCha20Poly1305.IsSupported() {
+		return AlgorithmChaCha20Poly1305
+	}
+	return AlgorithmAESGCM
+}
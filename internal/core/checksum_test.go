@@ -8,7 +8,13 @@
 package core
 
 import (
+	"bytes"
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
 	"os"
 	"path/filepath"
 	"testing"
@@ -179,3 +185,57 @@ func TestVerifyChecksumHex(t *testing.T) {
 		t.Error("hex checksum verification succeeded for wrong checksum")
 	}
 }
+
+func TestCalculateChecksums(t *testing.T) {
+	tmpDir := t.TempDir()
+	var paths []string
+	for i := 0; i < 10; i++ {
+		path := filepath.Join(tmpDir, fmt.Sprintf("file%d.bin", i))
+		data := make([]byte, i*1000)
+		if _, err := rand.Read(data); err != nil {
+			t.Fatalf("failed to generate test data: %v", err)
+		}
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+		paths = append(paths, path)
+	}
+	missing := filepath.Join(tmpDir, "missing.bin")
+	paths = append(paths, missing)
+
+	for _, newHash := range []func() hash.Hash{sha256.New, NewBLAKE2b256} {
+		results := CalculateChecksums(context.Background(), paths, newHash, 3)
+		if len(results) != len(paths) {
+			t.Fatalf("expected %d results, got %d", len(paths), len(results))
+		}
+		for i, r := range results {
+			if r.Path != paths[i] {
+				t.Errorf("result %d is for %s, want %s", i, r.Path, paths[i])
+			}
+			if r.Path == missing {
+				if !errors.Is(r.Err, os.ErrNotExist) {
+					t.Errorf("expected os.ErrNotExist for missing file, got %v", r.Err)
+				}
+				continue
+			}
+			want, err := CalculateFileHash(r.Path, newHash)
+			if r.Err != nil || err != nil || !bytes.Equal(r.Sum, want) {
+				t.Errorf("%s: sum %x, want %x (%v, %v)", r.Path, r.Sum, want, r.Err, err)
+			}
+		}
+	}
+
+	// SHA-256 through CalculateFileHash matches CalculateChecksum.
+	sum, _ := CalculateChecksum(paths[5])
+	if want := CalculateChecksums(context.Background(), paths[5:6], sha256.New, 0)[0].Sum; !bytes.Equal(sum, want) {
+		t.Errorf("CalculateChecksum %x does not match %x", sum, want)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, r := range CalculateChecksums(ctx, paths, sha256.New, 2) {
+		if !errors.Is(r.Err, ErrContextCanceled) {
+			t.Errorf("%s: expected ErrContextCanceled, got %v", r.Path, r.Err)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// command.go: Piping streams into and out of external commands
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os/exec"
+	"path/filepath"
+)
+
+// DecryptToCommand starts cmd, decrypts src into its standard input and
+// waits for it to exit, e.g. to restore an encrypted database dump with psql
+// or mysql without writing the plaintext to disk. cmd must not have been
+// started and its Stdin must be nil; its Stdout and Stderr are left to the
+// caller.
+//
+// The command's input is closed only once the whole stream has been
+// authenticated, so a command never reads a truncated or tampered dump to
+// its end: if decryption fails or ctx is done first, the command is killed
+// and the decryption error returned. Commands that apply their input as it
+// arrives may have applied a prefix by then, so run restores in a single
+// transaction where possible. If the command exits unsuccessfully its error
+// is returned, prefixed with its name, and matches *exec.ExitError with
+// errors.As; the write error it causes by exiting early is joined to it.
+func (d *Decryptor) DecryptToCommand(ctx context.Context, src io.Reader, cmd *exec.Cmd) error {
+	if cmd.Stdin != nil {
+		return errors.New("command standard input is already set")
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return WrapError("open command input", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return WrapError("start command", err)
+	}
+	return finishCommand(cmd, stdin, d.DecryptStream(ctx, src, stdin))
+}
+
+// EncryptFromCommand starts cmd, encrypts its standard output to dst and
+// waits for it to exit, e.g. to write an encrypted dump from pg_dump or
+// mysqldump without the plaintext touching disk. cmd must not have been
+// started and its Stdout must be nil; its Stdin and Stderr are left to the
+// caller.
+//
+// The command's exit status is checked before the stream is sealed with its
+// trailer: if the command exits unsuccessfully its error is returned,
+// prefixed with its name and matching *exec.ExitError with errors.As, and
+// dst is left without a trailer, so the output of a dump that was cut short
+// cannot be decrypted as if it were complete. If encryption fails or ctx is
+// done first, the command is killed. dst must be discarded on any error.
+func (e *Encryptor) EncryptFromCommand(ctx context.Context, cmd *exec.Cmd, dst io.Writer) error {
+	_, err := e.encryptFromCommand(ctx, cmd, dst, nil)
+	return err
+}
+
+// encryptFromCommand is EncryptFromCommand, also hashing the command's
+// output with plainHash if it is not nil. It returns the size of the output.
+func (e *Encryptor) encryptFromCommand(ctx context.Context, cmd *exec.Cmd, dst io.Writer, plainHash hash.Hash) (int64, error) {
+	if cmd.Stdout != nil {
+		return 0, errors.New("command standard output is already set")
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return 0, WrapError("open command output", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return 0, WrapError("start command", err)
+	}
+	out := &commandOutput{r: stdout, cmd: cmd, hash: plainHash}
+	err = e.EncryptStream(ctx, out, dst)
+	if out.waited {
+		return out.size, err
+	}
+	return out.size, finishCommand(cmd, stdout, err)
+}
+
+// commandOutput reads the output of cmd and, at its end, waits for cmd so
+// that a failed command stops encryption before the trailer is written.
+type commandOutput struct {
+	r      io.Reader
+	cmd    *exec.Cmd
+	waited bool
+	// size counts the output read and hash, if set, hashes it.
+	size int64
+	hash hash.Hash
+}
+
+func (c *commandOutput) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.size += int64(n)
+	if c.hash != nil {
+		c.hash.Write(p[:n])
+	}
+	if err == io.EOF && !c.waited {
+		c.waited = true
+		if werr := c.cmd.Wait(); werr != nil {
+			return n, commandError(c.cmd, werr)
+		}
+	}
+	return n, err
+}
+
+// finishCommand ends cmd after the stream through pipe, its standard input
+// or output, finished with err. The command is killed first if err is set,
+// so that it never takes a failed stream for a complete one, then the pipe
+// is closed and the command waited for.
+func finishCommand(cmd *exec.Cmd, pipe io.Closer, err error) error {
+	killed := false
+	if err != nil {
+		killed = cmd.Process.Kill() == nil
+	}
+	pipe.Close()
+	waitErr := cmd.Wait()
+	var exitErr *exec.ExitError
+	if killed && errors.As(waitErr, &exitErr) && exitErr.ExitCode() == -1 {
+		// Killed above; err says why.
+		waitErr = nil
+	}
+	if waitErr != nil {
+		waitErr = commandError(cmd, waitErr)
+	}
+	return errors.Join(waitErr, err)
+}
+
+// commandError prefixes err, returned by cmd.Wait, with the command name.
+func commandError(cmd *exec.Cmd, err error) error {
+	return fmt.Errorf("command %s: %w", filepath.Base(cmd.Path), err)
+}
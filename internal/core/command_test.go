@@ -0,0 +1,95 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestCommandPipes(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no shell available")
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	enc, err := NewEncryptor(key)
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// A dump is encrypted from the command's output.
+	var dump bytes.Buffer
+	if err := enc.EncryptFromCommand(ctx, exec.Command(sh, "-c", "printf 'dump data'"), &dump); err != nil {
+		t.Fatalf("EncryptFromCommand failed: %v", err)
+	}
+
+	// It is restored into the input of another command.
+	restored := filepath.Join(dir, "restored")
+	if err := dec.DecryptToCommand(ctx, bytes.NewReader(dump.Bytes()), exec.Command(sh, "-c", `cat > "$0"`, restored)); err != nil {
+		t.Fatalf("DecryptToCommand failed: %v", err)
+	}
+	if got, err := os.ReadFile(restored); err != nil || string(got) != "dump data" {
+		t.Errorf("restored %q, %v", got, err)
+	}
+
+	// A failing dump is reported and its output cannot be decrypted.
+	var partial bytes.Buffer
+	err = enc.EncryptFromCommand(ctx, exec.Command(sh, "-c", "printf partial; exit 3"), &partial)
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Errorf("EncryptFromCommand error = %v, want exit status 3", err)
+	}
+	if err := dec.DecryptStream(ctx, bytes.NewReader(partial.Bytes()), &bytes.Buffer{}); !errors.Is(err, ErrCorruptedFile) {
+		t.Errorf("DecryptStream of a failed dump: error = %v, want ErrCorruptedFile", err)
+	}
+
+	// A truncated dump kills the restore before it sees the end of input.
+	done := filepath.Join(dir, "done")
+	truncated := dump.Bytes()[:dump.Len()-1]
+	err = dec.DecryptToCommand(ctx, bytes.NewReader(truncated), exec.Command(sh, "-c", `cat > /dev/null && touch "$0"`, done))
+	if !errors.Is(err, ErrCorruptedFile) || errors.As(err, &exitErr) {
+		t.Errorf("DecryptToCommand of a truncated dump: error = %v, want ErrCorruptedFile only", err)
+	}
+	if _, err := os.Stat(done); !os.IsNotExist(err) {
+		t.Errorf("restore ran to completion on a truncated dump: %v", err)
+	}
+
+	// A restore that fails early is reported.
+	big := make([]byte, 4<<20)
+	var large bytes.Buffer
+	if err := enc.EncryptStream(ctx, bytes.NewReader(big), &large); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+	err = dec.DecryptToCommand(ctx, bytes.NewReader(large.Bytes()), exec.Command(sh, "-c", "exit 1"))
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		t.Errorf("DecryptToCommand error = %v, want exit status 1", err)
+	}
+
+	cmd := exec.Command(sh, "-c", "true")
+	cmd.Stdin = bytes.NewReader(nil)
+	if err := dec.DecryptToCommand(ctx, bytes.NewReader(dump.Bytes()), cmd); err == nil {
+		t.Error("DecryptToCommand accepted a command with its input set")
+	}
+}
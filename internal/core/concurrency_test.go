@@ -7,8 +7,12 @@
 package core
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sync"
@@ -17,47 +21,120 @@ import (
 	"github.com/gitrgoliveira/go-fileencrypt/secure"
 )
 
-func TestEncryptor_ConcurrentUseDetection(t *testing.T) {
-	t.Skip("Encryptors are not designed for concurrent use - test documents expected failure")
-
+func TestEncryptor_ConcurrentUse(t *testing.T) {
 	key := make([]byte, 32)
-	rand.Read(key)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
 	defer secure.Zero(key)
 
-	enc, err := NewEncryptor(key)
+	var encReport, decReport OperationReport
+	enc, err := NewEncryptor(key, WithReport(&encReport))
 	if err != nil {
 		t.Fatalf("NewEncryptor failed: %v", err)
 	}
+	defer enc.Destroy()
+	dec, err := NewDecryptor(key, WithReport(&decReport))
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
 
+	tmpDir := t.TempDir()
 	var wg sync.WaitGroup
-	errors := make(chan error, 10)
+	errs := make(chan error, 10)
 
 	for i := 0; i < 10; i++ {
 		wg.Add(1)
-		go func() {
+		go func(i int) {
 			defer wg.Done()
-			tmpDir := t.TempDir()
-			srcPath := filepath.Join(tmpDir, "test.txt")
-			dstPath := filepath.Join(tmpDir, "test.enc")
-			os.WriteFile(srcPath, []byte("test"), 0644)
-			err := enc.EncryptFile(context.Background(), srcPath, dstPath)
+			data := bytes.Repeat([]byte{byte(i)}, 1000+i)
+			srcPath := filepath.Join(tmpDir, fmt.Sprintf("test%d.txt", i))
+			encPath := filepath.Join(tmpDir, fmt.Sprintf("test%d.enc", i))
+			decPath := filepath.Join(tmpDir, fmt.Sprintf("test%d.dec", i))
+			if err := os.WriteFile(srcPath, data, 0600); err != nil {
+				errs <- err
+				return
+			}
+			if err := enc.EncryptFile(context.Background(), srcPath, encPath); err != nil {
+				errs <- err
+				return
+			}
+			if err := dec.DecryptFile(context.Background(), encPath, decPath); err != nil {
+				errs <- err
+				return
+			}
+			got, err := os.ReadFile(decPath)
 			if err != nil {
-				errors <- err
+				errs <- err
+				return
 			}
-		}()
+			if !bytes.Equal(got, data) {
+				errs <- fmt.Errorf("file %d: decrypted data does not match", i)
+			}
+			// Reports may be read while other calls are running.
+			if r := enc.Report(); r.Operation != "encrypt" {
+				errs <- fmt.Errorf("file %d: encryptor report for %q", i, r.Operation)
+			}
+			if r := dec.Report(); r.Operation != "decrypt" {
+				errs <- fmt.Errorf("file %d: decryptor report for %q", i, r.Operation)
+			}
+		}(i)
 	}
 
 	wg.Wait()
-	close(errors)
+	close(errs)
+	for err := range errs {
+		t.Errorf("concurrent use failed: %v", err)
+	}
+	if encReport.PlaintextBytes < 1000 || decReport.PlaintextBytes < 1000 {
+		t.Errorf("reports %+v and %+v do not describe a whole call", encReport, decReport)
+	}
+}
 
-	errorCount := 0
-	for err := range errors {
-		t.Logf("Got expected error from concurrent use: %v", err)
-		errorCount++
+func TestEncryptor_UseAfterDestroy(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
 	}
+	defer secure.Zero(key)
 
-	if errorCount == 0 {
-		t.Error("Expected errors from concurrent use, got none - this is unsafe!")
+	enc, err := NewEncryptor(key)
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+
+	var ciphertext bytes.Buffer
+	if err := enc.EncryptStream(context.Background(), bytes.NewReader([]byte("data")), &ciphertext); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+
+	// Destroy while other goroutines are mid-call must not race; every call
+	// either succeeds or reports ErrDestroyed.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := enc.EncryptStream(context.Background(), bytes.NewReader([]byte("data")), io.Discard)
+			if err != nil && !errors.Is(err, ErrDestroyed) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	enc.Destroy()
+	dec.Destroy()
+	wg.Wait()
+
+	if err := enc.EncryptStream(context.Background(), bytes.NewReader([]byte("data")), io.Discard); !errors.Is(err, ErrDestroyed) {
+		t.Errorf("expected ErrDestroyed from destroyed Encryptor, got %v", err)
+	}
+	if err := dec.DecryptStream(context.Background(), bytes.NewReader(ciphertext.Bytes()), io.Discard); !errors.Is(err, ErrDestroyed) {
+		t.Errorf("expected ErrDestroyed from destroyed Decryptor, got %v", err)
 	}
 }
 
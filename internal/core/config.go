@@ -0,0 +1,284 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// config.go: Config defaults, validation and loading from the environment
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+)
+
+// KDFParams are the password-based key derivation parameters of a Config,
+// for applications that derive keys with DeriveKeyArgon2 or DeriveKeyPBKDF2.
+// Encryptors and Decryptors do not use them.
+type KDFParams struct {
+	// Argon2Time, Argon2Memory (KiB) and Argon2Threads are the Argon2id costs.
+	Argon2Time    uint32
+	Argon2Memory  uint32
+	Argon2Threads uint8
+	// PBKDF2Iterations is the PBKDF2-HMAC-SHA256 iteration count.
+	PBKDF2Iterations int
+}
+
+// DefaultConfig returns the library defaults NewEncryptor and NewDecryptor
+// start from, plus the recommended KDF parameters.
+func DefaultConfig() Config {
+	return Config{
+		ChunkSize: DefaultChunkSize,
+		Algorithm: AlgorithmAESGCM,
+		KDF: KDFParams{
+			Argon2Time:       DefaultArgon2Time,
+			Argon2Memory:     DefaultArgon2Memory,
+			Argon2Threads:    DefaultArgon2Threads,
+			PBKDF2Iterations: DefaultPBKDF2Iterations,
+		},
+	}
+}
+
+// WithConfig replaces the whole configuration with c, e.g. one loaded with
+// FromEnv. Options after it adjust c; options before it are discarded.
+func WithConfig(c Config) Option {
+	return func(cfg *Config) {
+		*cfg = c
+	}
+}
+
+// Validate reports every invalid setting of cfg, joined with errors.Join.
+// NewEncryptor and NewDecryptor run it after applying their options. A zero
+// KDF is not checked.
+func (cfg *Config) Validate() error {
+	var errs []error
+	// Only known algorithms have a header ID; the others would not fit in
+	// the header flags.
+	if cfg.Algorithm < AlgorithmAESGCM || cfg.Algorithm > AlgorithmMLKEMHybrid {
+		errs = append(errs, fmt.Errorf("invalid algorithm %d", cfg.Algorithm))
+	}
+	if err := checkAlgorithms(cfg.Algorithms); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.MaxChunkSizeLimit < 0 {
+		errs = append(errs, fmt.Errorf("invalid chunk size limit %d", cfg.MaxChunkSizeLimit))
+	}
+	if cfg.MaxAcceptedChunkSize < 0 {
+		errs = append(errs, fmt.Errorf("invalid accepted chunk size %d", cfg.MaxAcceptedChunkSize))
+	}
+	if cfg.MaxChunks < 0 || cfg.MaxInputSize < 0 {
+		errs = append(errs, fmt.Errorf("invalid input limits: chunks %d and size %d must not be negative", cfg.MaxChunks, cfg.MaxInputSize))
+	}
+	if limit := cfg.maxChunkSize(); cfg.ChunkSize < MinChunkSize || cfg.ChunkSize > limit {
+		errs = append(errs, fmt.Errorf("invalid chunk size: must be between %d and %d bytes, got %d", MinChunkSize, limit, cfg.ChunkSize))
+	}
+	if cfg.ErrorDetail > ErrorDetailVerbose {
+		errs = append(errs, fmt.Errorf("invalid error detail level %d", cfg.ErrorDetail))
+	}
+	if _, err := newFileFilter(cfg); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Symlinks > SymlinkPreserve {
+		errs = append(errs, fmt.Errorf("invalid symlink policy %d", cfg.Symlinks))
+	}
+	if cfg.Priority > PriorityIdle {
+		errs = append(errs, fmt.Errorf("invalid priority %d", cfg.Priority))
+	}
+	if cfg.ChunkDelay < 0 {
+		errs = append(errs, fmt.Errorf("invalid chunk delay %v", cfg.ChunkDelay))
+	}
+	if cfg.Timeout < 0 || cfg.ChunkDeadline < 0 {
+		errs = append(errs, fmt.Errorf("invalid timeout %v or chunk deadline %v", cfg.Timeout, cfg.ChunkDeadline))
+	}
+	if cfg.Pipeline < 0 {
+		errs = append(errs, fmt.Errorf("invalid pipeline depth %d", cfg.Pipeline))
+	}
+	if cfg.Parallelism < ParallelismAuto {
+		errs = append(errs, fmt.Errorf("invalid parallelism %d", cfg.Parallelism))
+	} else if cfg.Parallelism != 0 && cfg.Pipeline == 0 {
+		errs = append(errs, fmt.Errorf("parallelism requires WithPipeline"))
+	}
+	if err := checkCPUAffinity(cfg.CPUAffinity); err != nil {
+		errs = append(errs, err)
+	} else if len(cfg.CPUAffinity) > 0 && cfg.Pipeline == 0 {
+		errs = append(errs, fmt.Errorf("CPU affinity requires WithPipeline"))
+	}
+	if err := checkPadding(cfg.Padding); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Padding != nil && (cfg.ChunkIndex || cfg.ChunkDigests) {
+		errs = append(errs, fmt.Errorf("padding cannot be combined with a chunk index"))
+	}
+	if err := checkManifestSigner(cfg.ManifestSigner, cfg.ManifestChain); err != nil {
+		errs = append(errs, err)
+	}
+	if err := checkSuffix(cfg.Suffix); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Collisions > CollisionRename {
+		errs = append(errs, fmt.Errorf("invalid collision policy %d", cfg.Collisions))
+	}
+	if err := checkReadBack(cfg.ReadBack); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Snapshot != nil && cfg.Manifest == "" {
+		errs = append(errs, fmt.Errorf("snapshots require WithManifest"))
+	}
+	if cfg.ObfuscateNames && cfg.Manifest == "" {
+		errs = append(errs, fmt.Errorf("obfuscated names require WithManifest"))
+	}
+	if kdf := cfg.KDF; kdf != (KDFParams{}) {
+		if kdf.Argon2Time < 1 {
+			errs = append(errs, fmt.Errorf("argon2 time cost must be at least 1, got %d", kdf.Argon2Time))
+		}
+		if kdf.Argon2Memory < MinArgon2Memory {
+			errs = append(errs, fmt.Errorf("argon2 memory cost must be at least %d KiB, got %d", MinArgon2Memory, kdf.Argon2Memory))
+		}
+		if kdf.Argon2Threads < 1 {
+			errs = append(errs, fmt.Errorf("argon2 threads must be at least 1, got %d", kdf.Argon2Threads))
+		}
+		if kdf.PBKDF2Iterations < MinPBKDF2Iterations {
+			errs = append(errs, fmt.Errorf("PBKDF2 iterations must be at least %d, got %d", MinPBKDF2Iterations, kdf.PBKDF2Iterations))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// maxChunkSize returns the largest chunk size cfg allows.
+func (cfg *Config) maxChunkSize() int {
+	if cfg.MaxChunkSizeLimit > 0 {
+		return min(cfg.MaxChunkSizeLimit, MaxChunkSize)
+	}
+	return MaxChunkSize
+}
+
+// acceptedChunkSize returns the largest chunk size a Decryptor with cfg
+// accepts from files.
+func (cfg *Config) acceptedChunkSize() int {
+	if cfg.MaxAcceptedChunkSize > 0 {
+		return min(cfg.MaxAcceptedChunkSize, cfg.maxChunkSize())
+	}
+	return cfg.maxChunkSize()
+}
+
+// envSettings maps the environment variables read by FromEnv to the settings
+// they override.
+var envSettings = []struct {
+	name string
+	set  func(cfg *Config, value string) error
+}{
+	{"FILEENCRYPT_CHUNK_SIZE", func(cfg *Config, v string) error {
+		size, err := humanize.ParseBytes(v)
+		if err != nil {
+			return err
+		}
+		if size > math.MaxInt {
+			return fmt.Errorf("%d bytes exceeds int max value", size)
+		}
+		cfg.ChunkSize = int(size)
+		return nil
+	}},
+	{"FILEENCRYPT_CHUNKSIZE_LIMIT", func(cfg *Config, v string) error {
+		limit, err := humanize.ParseBytes(v)
+		if err != nil {
+			return err
+		}
+		if limit > math.MaxInt {
+			return fmt.Errorf("%d bytes exceeds int max value", limit)
+		}
+		cfg.MaxChunkSizeLimit = int(limit)
+		return nil
+	}},
+	{"FILEENCRYPT_ALGORITHM", func(cfg *Config, v string) error {
+		for _, alg := range []Algorithm{AlgorithmAESGCM, AlgorithmChaCha20Poly1305, AlgorithmMLKEMHybrid} {
+			if strings.EqualFold(v, alg.String()) {
+				cfg.Algorithm, cfg.Algorithms = alg, []Algorithm{alg}
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown algorithm %q", v)
+	}},
+	{"FILEENCRYPT_CHECKSUM", func(cfg *Config, v string) (err error) {
+		cfg.Checksum, err = strconv.ParseBool(v)
+		return err
+	}},
+	{"FILEENCRYPT_CHUNK_INDEX", func(cfg *Config, v string) (err error) {
+		cfg.ChunkIndex, err = strconv.ParseBool(v)
+		return err
+	}},
+	{"FILEENCRYPT_ERROR_DETAIL", func(cfg *Config, v string) error {
+		levels := map[string]ErrorDetail{"standard": ErrorDetailStandard, "sanitized": ErrorDetailSanitized, "verbose": ErrorDetailVerbose}
+		level, ok := levels[strings.ToLower(v)]
+		if !ok {
+			return fmt.Errorf("unknown error detail level %q", v)
+		}
+		cfg.ErrorDetail = level
+		return nil
+	}},
+	{"FILEENCRYPT_PRIORITY", func(cfg *Config, v string) error {
+		for _, p := range []Priority{PriorityNormal, PriorityLow, PriorityIdle} {
+			if strings.EqualFold(v, p.String()) {
+				cfg.Priority = p
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown priority %q", v)
+	}},
+	{"FILEENCRYPT_ARGON2_TIME", func(cfg *Config, v string) error {
+		n, err := strconv.ParseUint(v, 10, 32)
+		cfg.KDF.Argon2Time = uint32(n) // #nosec G115 -- ParseUint limits n to 32 bits
+		return err
+	}},
+	{"FILEENCRYPT_ARGON2_MEMORY", func(cfg *Config, v string) error {
+		n, err := strconv.ParseUint(v, 10, 32)
+		cfg.KDF.Argon2Memory = uint32(n) // #nosec G115 -- ParseUint limits n to 32 bits
+		return err
+	}},
+	{"FILEENCRYPT_ARGON2_THREADS", func(cfg *Config, v string) error {
+		n, err := strconv.ParseUint(v, 10, 8)
+		cfg.KDF.Argon2Threads = uint8(n) // #nosec G115 -- ParseUint limits n to 8 bits
+		return err
+	}},
+	{"FILEENCRYPT_PBKDF2_ITERATIONS", func(cfg *Config, v string) (err error) {
+		cfg.KDF.PBKDF2Iterations, err = strconv.Atoi(v)
+		return err
+	}},
+}
+
+// FromEnv overrides the settings of cfg from the FILEENCRYPT_* environment
+// variables that are set and non-empty:
+//
+//	FILEENCRYPT_CHUNK_SIZE         chunk size, e.g. 4MiB
+//	FILEENCRYPT_CHUNKSIZE_LIMIT    largest allowed chunk size, e.g. 1MiB
+//	FILEENCRYPT_ALGORITHM          algorithm name, e.g. AES-256-GCM
+//	FILEENCRYPT_CHECKSUM           true or false
+//	FILEENCRYPT_CHUNK_INDEX        true or false
+//	FILEENCRYPT_ERROR_DETAIL       standard, sanitized or verbose
+//	FILEENCRYPT_PRIORITY           normal, low or idle
+//	FILEENCRYPT_ARGON2_TIME        Argon2id time cost
+//	FILEENCRYPT_ARGON2_MEMORY      Argon2id memory cost in KiB
+//	FILEENCRYPT_ARGON2_THREADS     Argon2id parallelism
+//	FILEENCRYPT_PBKDF2_ITERATIONS  PBKDF2 iteration count
+//
+// Every malformed value is reported, joined with errors.Join; the values
+// themselves are only checked by Validate. The library reads no environment
+// variables other than through FromEnv.
+func (cfg *Config) FromEnv() error {
+	var errs []error
+	for _, s := range envSettings {
+		v, ok := os.LookupEnv(s.name)
+		if !ok || v == "" {
+			continue
+		}
+		if err := s.set(cfg, v); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,94 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"crypto/rand"
+	"strings"
+	"testing"
+)
+
+func TestConfig_FromEnv(t *testing.T) {
+	t.Setenv("FILEENCRYPT_CHUNK_SIZE", "64KiB")
+	t.Setenv("FILEENCRYPT_CHECKSUM", "true")
+	t.Setenv("FILEENCRYPT_ERROR_DETAIL", "Sanitized")
+	t.Setenv("FILEENCRYPT_PRIORITY", "low")
+	t.Setenv("FILEENCRYPT_ARGON2_MEMORY", "131072")
+	t.Setenv("FILEENCRYPT_ALGORITHM", "")
+
+	cfg := DefaultConfig()
+	if err := cfg.FromEnv(); err != nil {
+		t.Fatalf("FromEnv failed: %v", err)
+	}
+	if cfg.ChunkSize != 64*1024 || !cfg.Checksum || cfg.ErrorDetail != ErrorDetailSanitized || cfg.Priority != PriorityLow {
+		t.Errorf("settings not loaded: %+v", cfg)
+	}
+	if cfg.KDF.Argon2Memory != 131072 || cfg.KDF.Argon2Time != DefaultArgon2Time {
+		t.Errorf("KDF settings not loaded: %+v", cfg.KDF)
+	}
+	if cfg.Algorithm != AlgorithmAESGCM {
+		t.Errorf("empty variable changed the algorithm to %v", cfg.Algorithm)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate failed: %v", err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	enc, err := NewEncryptor(key, WithConfig(cfg), WithChecksum(false))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	if enc.chunkSize != 64*1024 || enc.checksum {
+		t.Errorf("config not applied: chunk size %d, checksum %v", enc.chunkSize, enc.checksum)
+	}
+
+	t.Setenv("FILEENCRYPT_CHECKSUM", "maybe")
+	t.Setenv("FILEENCRYPT_ARGON2_THREADS", "1000")
+	err = cfg.FromEnv()
+	if err == nil || !strings.Contains(err.Error(), "FILEENCRYPT_CHECKSUM") || !strings.Contains(err.Error(), "FILEENCRYPT_ARGON2_THREADS") {
+		t.Errorf("expected both malformed variables to be reported, got %v", err)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.ChunkSize = 0
+	cfg.Pipeline = -1
+	cfg.KDF.PBKDF2Iterations = 1000
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate accepted an invalid config")
+	}
+	for _, want := range []string{"invalid chunk size", "invalid pipeline depth", "PBKDF2 iterations"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+
+	// A zero KDF is left to the application.
+	if err := (&Config{ChunkSize: DefaultChunkSize, Algorithm: AlgorithmAESGCM}).Validate(); err != nil {
+		t.Errorf("Validate rejected a config without KDF parameters: %v", err)
+	}
+
+	// Algorithms without a header ID fail instead of panicking.
+	key := make([]byte, 32)
+	for _, alg := range []Algorithm{0, AlgorithmMLKEMHybrid + 1, 17, 255} {
+		if _, err := NewEncryptor(key, WithAlgorithm(alg)); err == nil || !strings.Contains(err.Error(), "invalid algorithm") {
+			t.Errorf("NewEncryptor with algorithm %d: error = %v, want invalid algorithm", alg, err)
+		}
+		if _, err := NewDecryptor(key, WithAlgorithm(alg)); err == nil {
+			t.Errorf("NewDecryptor accepted algorithm %d", alg)
+		}
+	}
+	if _, err := NewEncryptor(key, WithConfig(Config{ChunkSize: DefaultChunkSize})); err == nil || !strings.Contains(err.Error(), "invalid algorithm") {
+		t.Errorf("NewEncryptor with a zero Config algorithm: error = %v, want invalid algorithm", err)
+	}
+}
@@ -0,0 +1,82 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// ctxio.go: Context-aware reads and writes
+package core
+
+import (
+	"context"
+	"io"
+)
+
+// ioSlice is the most a context-aware reader or writer moves per call to
+// the underlying reader or writer, so a cancelled operation stops within one
+// slice of I/O rather than after a whole chunk of up to MaxChunkSize bytes on
+// a slow disk or network filesystem.
+const ioSlice = 256 * 1024
+
+// ctxReader checks its context between slices of every Read. Reads are
+// split, not shortened: a Read returns fewer bytes than requested only when
+// the underlying reader does, so chunk boundaries are unchanged.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// newCtxReader returns r wrapped to observe ctx, or r itself if ctx can
+// never be cancelled.
+func newCtxReader(ctx context.Context, r io.Reader) io.Reader {
+	if ctx.Done() == nil {
+		return r
+	}
+	return &ctxReader{ctx: ctx, r: r}
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	var n int
+	for n < len(p) {
+		if r.ctx.Err() != nil {
+			return n, contextError(r.ctx)
+		}
+		want := min(len(p)-n, ioSlice)
+		m, err := r.r.Read(p[n : n+want])
+		n += m
+		if err != nil || m < want {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// ctxWriter checks its context between slices of every Write.
+type ctxWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+// newCtxWriter returns w wrapped to observe ctx, or w itself if ctx can
+// never be cancelled.
+func newCtxWriter(ctx context.Context, w io.Writer) io.Writer {
+	if ctx.Done() == nil {
+		return w
+	}
+	return &ctxWriter{ctx: ctx, w: w}
+}
+
+func (w *ctxWriter) Write(p []byte) (int, error) {
+	var n int
+	for n < len(p) {
+		if w.ctx.Err() != nil {
+			return n, contextError(w.ctx)
+		}
+		m, err := w.w.Write(p[n : n+min(len(p)-n, ioSlice)])
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
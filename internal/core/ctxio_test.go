@@ -0,0 +1,82 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+// cancelingReader cancels its context on the second read, as a user would
+// while a large chunk is still being read from slow storage.
+type cancelingReader struct {
+	cancel context.CancelFunc
+	calls  int
+	read   int
+}
+
+func (r *cancelingReader) Read(p []byte) (int, error) {
+	r.calls++
+	if r.calls == 2 {
+		r.cancel()
+	}
+	r.read += len(p)
+	return len(p), nil
+}
+
+func TestCancellationMidChunk(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	chunkOpt, err := WithChunkSize(MaxChunkSize)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	enc, err := NewEncryptor(key, chunkOpt)
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	src := &cancelingReader{cancel: cancel}
+	err = enc.EncryptStream(ctx, src, io.Discard)
+	if !errors.Is(err, ErrContextCanceled) {
+		t.Fatalf("expected ErrContextCanceled, got %v", err)
+	}
+	if src.read >= MaxChunkSize {
+		t.Errorf("read %d bytes after cancellation, want less than one chunk", src.read)
+	}
+}
+
+func TestCtxReader_KeepsChunkBoundaries(t *testing.T) {
+	data := make([]byte, 3*ioSlice+5)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := newCtxReader(ctx, bytes.NewReader(data))
+
+	buf := make([]byte, 2*ioSlice+1)
+	if n, err := r.Read(buf); n != len(buf) || err != nil {
+		t.Errorf("Read = %d, %v; want a full read of %d bytes", n, err, len(buf))
+	}
+	if n, err := r.Read(buf); n != ioSlice+4 || err != nil {
+		t.Errorf("Read = %d, %v; want the remaining %d bytes", n, err, ioSlice+4)
+	}
+
+	var out bytes.Buffer
+	w := newCtxWriter(ctx, &out)
+	cancel()
+	if n, err := w.Write(data); n != 0 || !errors.Is(err, ErrContextCanceled) {
+		t.Errorf("Write after cancel = %d, %v", n, err)
+	}
+}
@@ -8,32 +8,89 @@
 package core
 
 import (
-	"bufio"
 	"context"
-	"crypto/aes"
 	"crypto/cipher"
-	"encoding/binary"
 	"fmt"
+	"hash"
 	"io"
+	"math"
 	"os"
 	"sync"
+	"time"
 
+	"github.com/gitrgoliveira/go-fileencrypt/format"
 	"github.com/gitrgoliveira/go-fileencrypt/secure"
 )
 
 // Decryptor handles chunked decryption of files and streams.
+// Like Encryptor, it is safe for concurrent use, and a report set with
+// WithReport should be read with Report while calls are running.
 type Decryptor struct {
+	// mu guards keyBuf and aead against Destroy, and the report against
+	// concurrent calls and Report.
+	mu         sync.RWMutex
+	destroyed  bool
 	keyBuf     *secure.SecureBuffer
+	aead       cipher.AEAD
 	chunkSize  int
 	progress   func(float64)
 	checksum   bool
-	algorithm  Algorithm
 	bufferPool *sync.Pool
+	ioPools    *ioPools
+	errDetail  ErrorDetail
+	report     *OperationReport
+	plainHash  func() hash.Hash
+	filter     fileFilter
+	symlinks   SymlinkPolicy
+	// checksumHash creates the hash of output checksums (SHA-256 by default).
+	checksumHash func() hash.Hash
+	priority     Priority
+	chunkDelay   time.Duration
+	// manifest, if set, is read by DecryptDir to restore obfuscated names.
+	manifest string
+	// audit reports operations to the audit sink; nil without one.
+	audit *auditor
+	// timeout and chunkDeadline bound each operation and each chunk.
+	timeout       time.Duration
+	chunkDeadline time.Duration
+	// preallocate reserves the space of output files before writing them.
+	preallocate bool
+	// maxChunk is the largest record plaintext accepted from a file.
+	maxChunk int
+	// algorithms, if set, are the algorithms accepted in file headers.
+	algorithms []Algorithm
+	// maxChunks and maxInput, if positive, bound each operation's input.
+	maxChunks int64
+	maxInput  int64
+	// multiSegment accepts concatenated encrypted streams.
+	multiSegment bool
+	// chunkCallback, if set, is called after every chunk.
+	chunkCallback func(ChunkInfo)
+	// manifestTrust, if set, is the signature manifests must carry.
+	manifestTrust *ManifestTrust
+	// mask unmasks input written with WithMasking.
+	mask *masker
+	// naming is the suffix and collision policy of output names.
+	naming naming
+	// stopExpiry cancels the key expiry set with WithKeyContext or
+	// WithKeyDeadline; expired is set once the key expired.
+	stopExpiry func()
+	expired    bool
+}
+
+// NewDecryptorFromSecureBuffer is NewDecryptor for a key held in a
+// SecureBuffer. As with NewEncryptorFromSecureBuffer, the key is copied
+// between locked buffers and key stays owned by the caller.
+func NewDecryptorFromSecureBuffer(key *secure.SecureBuffer, opts ...Option) (*Decryptor, error) {
+	if key == nil {
+		return nil, fmt.Errorf("%w: nil key buffer", ErrInvalidKey)
+	}
+	return NewDecryptor(key.Data(), opts...)
 }
 
 func NewDecryptor(key []byte, opts ...Option) (*Decryptor, error) {
 	if len(key) != 32 {
-		return nil, fmt.Errorf("invalid key length: must be 32 bytes for AES-256, got %d", len(key))
+		return nil, fmt.Errorf("%w: must be 32 bytes for AES-256, got %d", ErrInvalidKey, len(key))
 	}
 	cfg := &Config{
 		ChunkSize: DefaultChunkSize, // default 1MB
@@ -42,189 +99,313 @@ func NewDecryptor(key []byte, opts ...Option) (*Decryptor, error) {
 	for _, opt := range opts {
 		opt(cfg)
 	}
-	// Validate chunk size only once, using WithChunkSize logic
-	if cfg.ChunkSize < MinChunkSize || cfg.ChunkSize > MaxChunkSize {
-		return nil, fmt.Errorf("invalid chunk size: must be between %d and %d bytes, got %d", MinChunkSize, MaxChunkSize, cfg.ChunkSize)
+	// A decryptor's chunk size only sizes its buffers, so a lower limit
+	// shrinks the default instead of conflicting with it.
+	if (cfg.MaxChunkSizeLimit > 0 || cfg.MaxAcceptedChunkSize > 0) && cfg.ChunkSize == DefaultChunkSize {
+		cfg.ChunkSize = max(min(cfg.ChunkSize, cfg.acceptedChunkSize()), MinChunkSize)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	filter, err := newFileFilter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	audit, err := newAuditor(cfg.AuditSink, key)
+	if err != nil {
+		return nil, err
 	}
 	keyBuf, err := secure.NewSecureBufferFromBytes(key)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create SecureBuffer for key: %w", err)
 	}
-	return &Decryptor{
+	aead, err := newAESGCM(keyBuf.Data())
+	if err != nil {
+		keyBuf.Destroy()
+		return nil, err
+	}
+	// Decryptors only unmask, so they need no IV source.
+	mask, err := newMasker(keyBuf.Data(), nil)
+	if err != nil {
+		keyBuf.Destroy()
+		return nil, err
+	}
+	d := &Decryptor{
 		keyBuf:    keyBuf,
+		aead:      aead,
 		chunkSize: cfg.ChunkSize,
 		progress:  cfg.Progress,
 		checksum:  cfg.Checksum,
-		algorithm: cfg.Algorithm,
+		errDetail: cfg.ErrorDetail,
+		report:    cfg.Report,
+		plainHash: cfg.PlaintextHash,
+		filter:    filter,
+		symlinks:  cfg.Symlinks,
 		bufferPool: &sync.Pool{
 			New: func() interface{} {
 				buf := make([]byte, cfg.ChunkSize)
 				return &buf
 			},
 		},
-	}, nil
+		ioPools:      newIOPools(cfg.ChunkSize),
+		checksumHash: checksumHash(cfg),
+		priority:     cfg.Priority,
+		chunkDelay:   cfg.ChunkDelay,
+		manifest:     cfg.Manifest,
+		audit:        audit,
+
+		timeout:       cfg.Timeout,
+		chunkDeadline: cfg.ChunkDeadline,
+		preallocate:   cfg.Preallocate,
+		maxChunk:      cfg.acceptedChunkSize(),
+		algorithms:    cfg.Algorithms,
+		maxChunks:     cfg.MaxChunks,
+		maxInput:      cfg.MaxInputSize,
+		multiSegment:  cfg.MultiSegment,
+		chunkCallback: cfg.ChunkCallback,
+		manifestTrust: cfg.ManifestTrust,
+		mask:          mask,
+		naming:        newNaming(cfg),
+	}
+	if d.stopExpiry, err = startKeyExpiry(cfg, d.expire); err != nil {
+		d.Destroy()
+		return nil, err
+	}
+	return d, nil
 }
 
 // DecryptFile performs chunked decryption of a file.
 func (d *Decryptor) DecryptFile(ctx context.Context, srcPath, dstPath string) error {
-	if !d.algorithm.IsSupported() {
-		return fmt.Errorf("unsupported algorithm: %s (only AES-256-GCM is currently supported)", d.algorithm)
+	return d.runDecryptFile(ctx, srcPath, dstPath, d.checksum)
+}
+
+// runDecryptFile decrypts one file and fills the report, computing the output
+// checksum only when checksum is set.
+func (d *Decryptor) runDecryptFile(ctx context.Context, srcPath, dstPath string, checksum bool) error {
+	ctx, release := d.deadlines(ctx)
+	defer release()
+	start := time.Now()
+	st := newStreamStats(d.plainHash)
+	err := d.decryptFile(ctx, srcPath, dstPath, &st)
+	if err == nil && checksum {
+		st.checksum, err = fileChecksum(dstPath, d.checksumHash)
 	}
+	d.fillReport(ctx, "decrypt", srcPath, st, start, err)
+	return withDetail(d.errDetail, "decrypt", srcPath, err)
+}
 
+func (d *Decryptor) decryptFile(ctx context.Context, srcPath, dstPath string, st *streamStats) (err error) {
 	srcFile, err := os.Open(srcPath) // #nosec G304 -- File path provided by caller, library purpose is file decryption
 	if err != nil {
 		return WrapError("open source file", err)
 	}
 	defer srcFile.Close()
 
-	dstFile, err := os.Create(dstPath) // #nosec G304 -- File path provided by caller, library purpose is file decryption
+	src, header := d.fileSource(srcFile)
+	if err := d.preflight(srcFile, header); err != nil {
+		return err
+	}
+	var sizeHint []int64
+	size, ok := d.trailerSize(srcFile, header)
+	if ok {
+		sizeHint = append(sizeHint, size)
+	} else if d.preallocate {
+		size = headerSize(header)
+	}
+
+	dstFile, err := createOutput(srcFile, dstPath, size, d.preallocate)
 	if err != nil {
-		return WrapError("create destination file", err)
+		return err
 	}
-	defer dstFile.Close()
+	defer func() { err = closeOutput(dstFile, err) }()
 
-	bufferedReader := bufio.NewReaderSize(srcFile, d.chunkSize)
-	bufferedWriter := bufio.NewWriterSize(dstFile, d.chunkSize)
-	defer func() {
-		if flushErr := bufferedWriter.Flush(); flushErr != nil && err == nil {
-			err = WrapError("flush buffer", flushErr)
-		}
-	}()
+	bufferedReader := d.ioPools.reader(ctx, src)
+	defer d.ioPools.putReader(bufferedReader)
+	bufferedWriter := d.ioPools.writer(ctx, dstFile)
+	defer d.ioPools.putWriter(bufferedWriter)
 
-	if err := d.DecryptStream(ctx, bufferedReader, bufferedWriter); err != nil {
+	if err := d.decryptStream(ctx, bufferedReader, bufferedWriter, st, sizeHint...); err != nil {
 		return err
 	}
-
-	if d.checksum {
-		if _, err := CalculateChecksum(dstPath); err != nil {
-			return WrapError("calculate checksum", err)
-		}
+	// Flush so the output is complete before it is checksummed.
+	if err := bufferedWriter.Flush(); err != nil {
+		return WrapError("flush buffer", err)
 	}
-
 	return nil
 }
 
 // DecryptStream performs chunked decryption of a stream.
 func (d *Decryptor) DecryptStream(ctx context.Context, src io.Reader, dst io.Writer, sizeHint ...int64) error {
-	if !d.algorithm.IsSupported() {
-		return fmt.Errorf("unsupported algorithm: %s (only AES-256-GCM is currently supported)", d.algorithm)
-	}
+	ctx, release := d.deadlines(ctx)
+	defer release()
+	start := time.Now()
+	st := newStreamStats(d.plainHash)
+	err := d.decryptStream(ctx, newCtxReader(ctx, src), newCtxWriter(ctx, dst), &st, sizeHint...)
+	d.fillReport(ctx, "decrypt", "", st, start, err)
+	return withDetail(d.errDetail, "decrypt", "stream", err)
+}
 
-	key := d.keyBuf.Data()
-	if len(key) != 32 {
-		return fmt.Errorf("invalid key length: must be 32 bytes for AES-256")
-	}
+func (d *Decryptor) decryptStream(ctx context.Context, src io.Reader, dst io.Writer, st *streamStats, sizeHint ...int64) error {
+	return runAtPriority(d.priority, func() error {
+		return d.decryptChunks(ctx, src, dst, st, sizeHint...)
+	})
+}
 
-	block, err := aes.NewCipher(key)
+func (d *Decryptor) decryptChunks(ctx context.Context, src io.Reader, dst io.Writer, st *streamStats, sizeHint ...int64) error {
+	gcm, err := d.newAEAD()
 	if err != nil {
-		return WrapError("create cipher", err)
+		return err
 	}
 
-	gcm, err := cipher.NewGCM(block)
+	opener, err := d.newOpener(gcm, src, st, sizeHint...)
 	if err != nil {
-		return WrapError("create GCM", err)
-	}
-
-	magic := make([]byte, len(MagicBytes))
-	if _, err := io.ReadFull(src, magic); err != nil {
-		return WrapError("read magic bytes", err)
-	}
-	if string(magic) != MagicBytes {
-		return fmt.Errorf("invalid file format: expected magic bytes %q, got %q", MagicBytes, magic)
-	}
-
-	version := make([]byte, 1)
-	if _, err := io.ReadFull(src, version); err != nil {
-		return WrapError("read version byte", err)
-	}
-	if version[0] != byte(Version) { // #nosec G602 -- version is size 1, ReadFull ensures it's filled
-		return fmt.Errorf("unsupported file version: expected %d, got %d", Version, version[0])
-	}
-
-	baseNonce := make([]byte, NonceSize)
-	if _, err := io.ReadFull(src, baseNonce); err != nil {
-		return WrapError("read nonce", err)
-	}
-
-	sizeBytes := make([]byte, 8)
-	if _, err := io.ReadFull(src, sizeBytes); err != nil {
-		return WrapError("read size", err)
-	}
-
-	aad := sizeBytes
-
-	fileSizeUint64 := binary.BigEndian.Uint64(sizeBytes)
-	var totalSize int64
-	if fileSizeUint64 > 0 {
-		totalSize = int64(fileSizeUint64) // #nosec G115 -- uint64 to int64 conversion safe for file sizes (validated in header)
-	} else if len(sizeHint) > 0 {
-		totalSize = sizeHint[0]
+		return err
 	}
 
-	var written int64
-	var chunkCounter uint32
-
+	timer := newChunkTimer(d.chunkCallback, "decrypt")
+	progress := newProgressReporter(d.progress, opener.totalSize)
 	for {
 		if ctx.Err() != nil {
-			return ErrContextCanceled
+			return contextError(ctx)
 		}
 
-		chunkSizeBytes := make([]byte, 4)
-		_, err := io.ReadFull(src, chunkSizeBytes)
+		timer.begin()
+		read := st.ciphertext
+		plaintext, err := opener.next()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			return WrapError("read chunk size", err)
+			return err
 		}
 
-		chunkSize := binary.BigEndian.Uint32(chunkSizeBytes)
-
-		// #nosec G115 -- int to uint32 conversion safe (MaxChunkSize is 10MB)
-		if chunkSize == 0 || chunkSize > uint32(MaxChunkSize+gcm.Overhead()) {
-			return ErrChunkSize
+		if _, err := dst.Write(plaintext); err != nil {
+			return atChunk(int(opener.counter-1), WrapError("write plaintext chunk", err))
 		}
+		st.addPlaintext(plaintext)
+		st.plaintext += int64(len(plaintext))
 
-		ciphertext := make([]byte, chunkSize)
-		if _, err := io.ReadFull(src, ciphertext); err != nil {
-			return WrapError("read encrypted chunk", err)
+		progress.update(opener.written)
+		timer.done(len(plaintext), int(st.ciphertext-read))
+		if err := pause(ctx, d.chunkDelay); err != nil {
+			return err
+		}
+		chunkDone(ctx)
+		if err := checkpoint(ctx, opener.written, opener.totalSize); err != nil {
+			return err
 		}
+	}
 
-		nonce := make([]byte, NonceSize)
-		copy(nonce, baseNonce)
-		binary.BigEndian.PutUint32(nonce[8:], chunkCounter)
-		chunkCounter++
+	st.complete = true
+	progress.finish()
 
-		plaintext, err := gcm.Open(nil, nonce, ciphertext, aad)
-		if err != nil {
-			return WrapError("decrypt chunk (authentication failed)", err)
-		}
+	return nil
+}
 
-		if _, err := dst.Write(plaintext); err != nil {
-			return WrapError("write plaintext chunk", err)
-		}
+// newOpener reads the header of src and returns an opener for its records
+// configured with the decryptor's limits.
+func (d *Decryptor) newOpener(gcm cipher.AEAD, src io.Reader, st *streamStats, sizeHint ...int64) (*chunkOpener, error) {
+	if d.multiSegment {
+		// Hints describe the whole input, not its first segment.
+		sizeHint = nil
+	}
+	opener, err := newChunkOpener(gcm, d.mask.reader(src, st), st, d.algorithms, sizeHint...)
+	if err != nil {
+		return nil, err
+	}
+	opener.maxChunk = d.maxChunk
+	opener.maxChunks, opener.maxInput = d.maxChunks, d.maxInput
+	opener.multiSegment = d.multiSegment
+	return opener, nil
+}
 
-		written += int64(len(plaintext))
+// headerSize returns the plaintext size recorded in header, or 0.
+func headerSize(header []byte) int64 {
+	h, err := format.ParseHeader(header)
+	if err != nil || h.Size > math.MaxInt64 {
+		return 0
+	}
+	return int64(h.Size)
+}
 
-		if d.progress != nil && totalSize > 0 {
-			progress := float64(written) / float64(totalSize)
-			d.progress(progress)
-		}
+// trailerSize looks ahead at the trailer of a v2 file whose header does not
+// record the plaintext size (e.g. one encrypted from a pipe) so progress can be
+// reported. header is the header f is decrypted with. Any failure simply
+// disables the look-ahead; DecryptStream performs the authoritative checks.
+func (d *Decryptor) trailerSize(f *os.File, header []byte) (int64, bool) {
+	stat, err := f.Stat()
+	if err != nil || !stat.Mode().IsRegular() || stat.Size() < int64(HeaderSize+TrailerSize) {
+		return 0, false
+	}
+	h, err := format.ParseHeader(header)
+	if err != nil || !h.HasTrailer() || h.Size != 0 || h.Flags.Check(supportedFlags) != nil {
+		return 0, false
+	}
+	end := stat.Size()
+	if h.Flags&format.FlagBackupHeader != 0 {
+		end -= int64(h.Len())
+	}
+	trailer := make([]byte, TrailerSize)
+	if _, err := f.ReadAt(trailer, end-TrailerSize); err != nil {
+		return 0, false
 	}
+	gcm, err := d.newAEAD()
+	if err != nil {
+		return 0, false
+	}
+	size, _, err := openTrailer(gcm, h.Nonce[:], h.AAD(), trailer[4:])
+	if err != nil || size == 0 {
+		return 0, false
+	}
+	return size, true
+}
 
-	if totalSize > 0 && written != totalSize {
-		return fmt.Errorf("unexpected EOF: decrypted %d bytes, expected %d", written, totalSize)
+// newAEAD returns the decryptor's cached AES-256-GCM cipher.
+func (d *Decryptor) newAEAD() (cipher.AEAD, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.destroyed {
+		return nil, d.errDestroyed()
 	}
+	return d.aead, nil
+}
 
-	if d.progress != nil {
-		d.progress(1.0)
+// fillReport records st in the configured report, if any, and reports the
+// operation on path to the audit sink. As for Encryptor, concurrent calls
+// each leave a whole report and the last to finish wins.
+func (d *Decryptor) fillReport(ctx context.Context, op, path string, st streamStats, start time.Time, err error) {
+	d.audit.audit(ctx, op, path, st.algorithm, st.plaintext, start, err)
+	if d.report == nil {
+		return
 	}
+	var r OperationReport
+	st.fill(&r, op, st.algorithm, start)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	*d.report = r
+}
 
-	return nil
+// Report returns a copy of the WithReport report; see Encryptor.Report.
+func (d *Decryptor) Report() OperationReport {
+	if d.report == nil {
+		return OperationReport{}
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return *d.report
 }
 
-// Destroy zeroes key material and unlocks memory
+// Destroy zeroes key material, unlocks memory and releases the cached
+// cipher. Operations already past
+// cipher setup run to completion; later calls fail with ErrDestroyed.
 func (d *Decryptor) Destroy() {
+	if d.stopExpiry != nil {
+		d.stopExpiry()
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.destroyed = true
+	d.aead = nil
 	if d.keyBuf != nil {
 		d.keyBuf.Destroy()
 	}
@@ -0,0 +1,27 @@
+//go:build testhooks
+// +build testhooks
+
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// deterministic_testhooks.go: Reproducible nonces for known-answer test vectors
+package core
+
+import "io"
+
+// WithDeterministicNonce derives base nonces from seed instead of crypto/rand,
+// making output byte-for-byte reproducible for known-answer test vectors.
+// Each Encryptor starts the same nonce sequence, so two encryptors with the
+// same key and seed reuse nonces. Test-only; compiled with the 'testhooks'
+// build tag and never safe for real data.
+func WithDeterministicNonce(seed []byte) Option {
+	seed = append([]byte(nil), seed...)
+	return func(cfg *Config) {
+		cfg.nonceSource = func() io.Reader {
+			return &deterministicReader{seed: seed}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// digest.go: Chunk digests for verifying copies without downloading them
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"github.com/gitrgoliveira/go-fileencrypt/format"
+)
+
+// ChunkDigest is the digest of one chunk record, as recorded in the chunk
+// index of a file written with WithChunkDigests.
+type ChunkDigest struct {
+	// Index is the chunk number, starting at 0.
+	Index int
+	// Offset and Length give the byte range of the record in the encrypted
+	// file, including its length prefix and tag.
+	Offset int64
+	Length int64
+	// Sum is the SHA-256 of the bytes in that range.
+	Sum [sha256.Size]byte
+}
+
+// ChunkDigests returns the digest of every chunk record. They were
+// authenticated together with the index when the reader was created, which
+// reads only the header, index and trailer, so opening the reader over
+// ranged requests to a remote copy costs little bandwidth. Comparing the
+// digests with those of the copy's byte ranges, computed where the copy is
+// stored with CompareChunkDigests, verifies it without downloading it.
+// Files written without WithChunkDigests fail with ErrUnsupportedFeature.
+func (r *IndexedReader) ChunkDigests() ([]ChunkDigest, error) {
+	if r.header.Flags&format.FlagChunkDigests == 0 {
+		return nil, fmt.Errorf("%w: file has no chunk digests", ErrUnsupportedFeature)
+	}
+	digests := make([]ChunkDigest, len(r.entries))
+	for i, e := range r.entries {
+		digests[i] = ChunkDigest{Index: i, Offset: e.Offset, Length: format.LengthSize + int64(e.Length), Sum: e.Digest}
+	}
+	return digests, nil
+}
+
+// CompareChunkDigests reads the byte range of each digest from src, a copy of
+// the encrypted file, and returns the chunk numbers whose bytes do not match,
+// in order. It needs no key, so it can run next to the copy, and src may also
+// fetch the ranges remotely; each record is read once. Ranges that extend
+// past the end of src do not match.
+func CompareChunkDigests(ctx context.Context, src io.ReaderAt, digests []ChunkDigest) ([]int, error) {
+	var mismatched []int
+	var buf []byte
+	for _, d := range digests {
+		if ctx.Err() != nil {
+			return mismatched, contextError(ctx)
+		}
+		if d.Length < format.LengthSize+TagSize || d.Length > format.LengthSize+MaxChunkSize+TagSize || d.Offset < 0 {
+			return mismatched, fmt.Errorf("chunk %d: invalid digest range %d+%d", d.Index, d.Offset, d.Length)
+		}
+		if int64(cap(buf)) < d.Length {
+			buf = make([]byte, d.Length)
+		}
+		record := buf[:d.Length]
+		if _, err := src.ReadAt(record, d.Offset); err == io.EOF || err == io.ErrUnexpectedEOF {
+			mismatched = append(mismatched, d.Index)
+			continue
+		} else if err != nil {
+			return mismatched, atChunk(d.Index, WrapError("read encrypted chunk", err))
+		}
+		if format.ChunkDigest(record) != d.Sum {
+			mismatched = append(mismatched, d.Index)
+		}
+	}
+	return mismatched, nil
+}
@@ -0,0 +1,143 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/gitrgoliveira/go-fileencrypt/format"
+)
+
+func TestWithChunkDigests(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	chunkOpt, err := WithChunkSize(1024)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	opts := []Option{chunkOpt, WithChunkDigests(true), WithBackupHeader(true)}
+	enc, err := NewEncryptor(key, opts...)
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+
+	data := make([]byte, 4500)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("failed to generate data: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := enc.EncryptStream(context.Background(), bytes.NewReader(data), &buf, int64(len(data))); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+	ciphertext := buf.Bytes()
+
+	h, err := format.ParseHeader(ciphertext)
+	if err != nil {
+		t.Fatalf("ParseHeader failed: %v", err)
+	}
+	if want := format.FlagChunkIndex | format.FlagChunkDigests; h.Flags&want != want {
+		t.Fatalf("header flags %v lack chunk-index and chunk-digests", h.Flags)
+	}
+	want, err := EstimateEncryptedSize(int64(len(data)), 0, opts...)
+	if err != nil {
+		t.Fatalf("EstimateEncryptedSize failed: %v", err)
+	}
+	if int64(len(ciphertext)) != want {
+		t.Errorf("encrypted size = %d, want %d", len(ciphertext), want)
+	}
+
+	var out bytes.Buffer
+	if err := dec.DecryptStream(context.Background(), bytes.NewReader(ciphertext), &out); err != nil {
+		t.Fatalf("DecryptStream failed: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Fatal("decrypted data does not match")
+	}
+	fr, err := format.NewReader(bytes.NewReader(ciphertext))
+	if err != nil {
+		t.Fatalf("format.NewReader failed: %v", err)
+	}
+	for {
+		if _, err := fr.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("format.Reader.Next failed: %v", err)
+		}
+	}
+
+	r, err := dec.NewIndexedReader(bytes.NewReader(ciphertext), int64(len(ciphertext)))
+	if err != nil {
+		t.Fatalf("NewIndexedReader failed: %v", err)
+	}
+	part := make([]byte, 100)
+	if _, err := r.ReadAt(part, 3000); err != nil || !bytes.Equal(part, data[3000:3100]) {
+		t.Errorf("indexed read failed: %v", err)
+	}
+	digests, err := r.ChunkDigests()
+	if err != nil {
+		t.Fatalf("ChunkDigests failed: %v", err)
+	}
+	if len(digests) != 5 {
+		t.Fatalf("got %d digests, want 5", len(digests))
+	}
+	for i, d := range digests {
+		if d.Index != i || d.Sum != sha256.Sum256(ciphertext[d.Offset:d.Offset+d.Length]) {
+			t.Errorf("digest %d does not match the record at %d+%d", i, d.Offset, d.Length)
+		}
+	}
+
+	ctx := context.Background()
+	if bad, err := CompareChunkDigests(ctx, bytes.NewReader(ciphertext), digests); err != nil || len(bad) != 0 {
+		t.Errorf("CompareChunkDigests on an intact copy = %v, %v", bad, err)
+	}
+	damaged := bytes.Clone(ciphertext)
+	damaged[digests[2].Offset+10] ^= 0x01
+	if bad, err := CompareChunkDigests(ctx, bytes.NewReader(damaged), digests); err != nil || !slices.Equal(bad, []int{2}) {
+		t.Errorf("CompareChunkDigests on a damaged copy = %v, %v; want [2]", bad, err)
+	}
+	truncated := ciphertext[:digests[3].Offset+5]
+	if bad, err := CompareChunkDigests(ctx, bytes.NewReader(truncated), digests); err != nil || !slices.Equal(bad, []int{3, 4}) {
+		t.Errorf("CompareChunkDigests on a truncated copy = %v, %v; want [3 4]", bad, err)
+	}
+
+	// Files with only a chunk index have no digests.
+	plain, err := NewEncryptor(key, WithChunkIndex(true))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer plain.Destroy()
+	buf.Reset()
+	if err := plain.EncryptStream(ctx, bytes.NewReader(data), &buf); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+	r, err = dec.NewIndexedReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("NewIndexedReader failed: %v", err)
+	}
+	if _, err := r.ChunkDigests(); !errors.Is(err, ErrUnsupportedFeature) {
+		t.Errorf("ChunkDigests without digests = %v, want ErrUnsupportedFeature", err)
+	}
+
+	if _, err := NewEncryptor(key, WithChunkDigests(true), WithPadding(PaddingPadme)); err == nil {
+		t.Error("WithChunkDigests with padding was accepted")
+	}
+}
@@ -0,0 +1,434 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTree creates files (slash-separated relative paths) under root.
+func writeTree(t *testing.T, root string, files map[string][]byte) {
+	t.Helper()
+	for name, data := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatalf("MkdirAll failed: %v", err)
+		}
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+}
+
+func TestEncryptDir_ManifestRoundTrip(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	files := map[string][]byte{
+		"a.txt":           []byte("alpha"),
+		"sub/b.bin":       bytes.Repeat([]byte{0xAB}, 5000),
+		"sub/deep/c.txt":  {},
+		"other/d.log.txt": []byte("delta"),
+	}
+
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	encDir := filepath.Join(tmpDir, "enc")
+	decDir := filepath.Join(tmpDir, "dec")
+	manifestPath := filepath.Join(tmpDir, "manifest.json")
+	writeTree(t, srcDir, files)
+
+	var report OperationReport
+	enc, err := NewEncryptor(key, WithManifest(manifestPath), WithReport(&report))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	if err := enc.EncryptDir(context.Background(), srcDir, encDir); err != nil {
+		t.Fatalf("EncryptDir failed: %v", err)
+	}
+	if report.Operation != "encrypt" || report.PlaintextBytes != 5000+5+5 {
+		t.Errorf("unexpected aggregate report: %+v", report)
+	}
+
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+
+	m, err := dec.ReadManifest(manifestPath)
+	if err != nil {
+		t.Fatalf("ReadManifest failed: %v", err)
+	}
+	if len(m.Files) != len(files) {
+		t.Fatalf("manifest lists %d files, want %d", len(m.Files), len(files))
+	}
+	for _, entry := range m.Files {
+		if int64(len(files[entry.Path])) != entry.Size {
+			t.Errorf("%s: manifest size %d, want %d", entry.Path, entry.Size, len(files[entry.Path]))
+		}
+	}
+
+	if err := dec.VerifyManifest(context.Background(), manifestPath, encDir); err != nil {
+		t.Fatalf("VerifyManifest failed: %v", err)
+	}
+
+	if err := dec.DecryptDir(context.Background(), encDir, decDir); err != nil {
+		t.Fatalf("DecryptDir failed: %v", err)
+	}
+	for name, want := range files {
+		got, err := os.ReadFile(filepath.Join(decDir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: decrypted data does not match", name)
+		}
+	}
+
+	// Tampering with a listed file is caught.
+	encB := filepath.Join(encDir, "sub", "b.bin"+EncryptedFileSuffix)
+	if err := os.WriteFile(encB, []byte("not the original"), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := dec.VerifyManifest(context.Background(), manifestPath, encDir); !errors.Is(err, ErrCorruptedFile) {
+		t.Errorf("expected ErrCorruptedFile for replaced file, got %v", err)
+	}
+}
+
+func TestEncryptDir_ObfuscatedNames(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	files := map[string][]byte{
+		"salaries.txt":            []byte("alpha"),
+		"reports/merger.pdf":      bytes.Repeat([]byte{0xAB}, 5000),
+		"reports/merger/plan.txt": []byte("delta"),
+		"other/merger.pdf":        {},
+	}
+
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	encDir := filepath.Join(tmpDir, "enc")
+	decDir := filepath.Join(tmpDir, "dec")
+	manifestPath := filepath.Join(tmpDir, "manifest")
+	writeTree(t, srcDir, files)
+
+	if _, err := NewEncryptor(key, WithObfuscatedNames(true)); err == nil {
+		t.Error("expected error for obfuscated names without a manifest")
+	}
+	enc, err := NewEncryptor(key, WithManifest(manifestPath), WithObfuscatedNames(true))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	if err := enc.EncryptDir(context.Background(), srcDir, encDir); err != nil {
+		t.Fatalf("EncryptDir failed: %v", err)
+	}
+
+	// Neither the encrypted tree nor the manifest reveals a name.
+	var count int
+	err = filepath.WalkDir(encDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || path == encDir {
+			return err
+		}
+		for _, leak := range []string{"salaries", "reports", "merger", "plan", "other"} {
+			if bytes.Contains([]byte(d.Name()), []byte(leak)) {
+				t.Errorf("encrypted tree leaks name %q", path)
+			}
+		}
+		if !d.IsDir() {
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkDir failed: %v", err)
+	}
+	if count != len(files) {
+		t.Errorf("encrypted tree holds %d files, want %d", count, len(files))
+	}
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if bytes.Contains(data, []byte("merger")) {
+		t.Error("manifest is not encrypted")
+	}
+
+	dec, err := NewDecryptor(key, WithManifest(manifestPath))
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	if err := dec.VerifyManifest(context.Background(), manifestPath, encDir); err != nil {
+		t.Fatalf("VerifyManifest failed: %v", err)
+	}
+	if err := dec.DecryptDir(context.Background(), encDir, decDir); err != nil {
+		t.Fatalf("DecryptDir failed: %v", err)
+	}
+	for name, want := range files {
+		got, err := os.ReadFile(filepath.Join(decDir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: decrypted data does not match", name)
+		}
+	}
+
+	// The encrypted manifest cannot be read with another key.
+	other, err := NewDecryptor(make([]byte, 32))
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer other.Destroy()
+	if _, err := other.ReadManifest(manifestPath); !errors.Is(err, ErrAuthenticationFailed) {
+		t.Errorf("expected ErrAuthenticationFailed for wrong key, got %v", err)
+	}
+}
+
+func TestManifest_SignatureChecked(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	data, err := signManifest(key, &Manifest{Version: ManifestVersion, Files: []ManifestEntry{{Path: "a.txt", Size: 1}}}, nil)
+	if err != nil {
+		t.Fatalf("signManifest failed: %v", err)
+	}
+	if _, err := openManifest(key, data, nil); err != nil {
+		t.Fatalf("openManifest failed: %v", err)
+	}
+
+	tampered := bytes.Replace(data, []byte(`"size": 1`), []byte(`"size": 2`), 1)
+	if bytes.Equal(tampered, data) {
+		t.Fatal("test did not modify the manifest")
+	}
+	if _, err := openManifest(key, tampered, nil); !errors.Is(err, ErrAuthenticationFailed) {
+		t.Errorf("expected ErrAuthenticationFailed for tampered manifest, got %v", err)
+	}
+
+	otherKey := make([]byte, 32)
+	if _, err := openManifest(otherKey, data, nil); !errors.Is(err, ErrAuthenticationFailed) {
+		t.Errorf("expected ErrAuthenticationFailed for wrong key, got %v", err)
+	}
+}
+
+func TestVerifyManifestFiles(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	encDir := filepath.Join(tmpDir, "enc")
+	manifestPath := filepath.Join(tmpDir, "manifest.json")
+	writeTree(t, srcDir, map[string][]byte{
+		"a.txt":     []byte("alpha"),
+		"b.txt":     []byte("bravo"),
+		"sub/c.bin": bytes.Repeat([]byte{0xCD}, 5000),
+		"sub/d.txt": []byte("delta"),
+	})
+	enc, err := NewEncryptor(key, WithManifest(manifestPath))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	if err := enc.EncryptDir(context.Background(), srcDir, encDir); err != nil {
+		t.Fatalf("EncryptDir failed: %v", err)
+	}
+
+	// Damage one file and remove another.
+	damaged := filepath.Join(encDir, "sub", "c.bin.enc")
+	data, err := os.ReadFile(damaged)
+	if err != nil {
+		t.Fatalf("failed to read encrypted file: %v", err)
+	}
+	data[len(data)/2] ^= 0x01
+	if err := os.WriteFile(damaged, data, 0o600); err != nil {
+		t.Fatalf("failed to damage file: %v", err)
+	}
+	if err := os.Remove(filepath.Join(encDir, "b.txt.enc")); err != nil {
+		t.Fatalf("failed to remove file: %v", err)
+	}
+
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	verdicts, err := dec.VerifyManifestFiles(context.Background(), manifestPath, encDir, 2)
+	if err != nil {
+		t.Fatalf("VerifyManifestFiles failed: %v", err)
+	}
+	got := make(map[string]ManifestVerdict)
+	for _, v := range verdicts {
+		got[v.Path] = v
+	}
+	if len(got) != 4 || !got["a.txt"].OK || !got["sub/d.txt"].OK {
+		t.Fatalf("verdicts = %+v", verdicts)
+	}
+	if v := got["sub/c.bin"]; v.OK || !errors.Is(v.Err, ErrAuthenticationFailed) || v.Error == "" {
+		t.Errorf("damaged file verdict = %+v", v)
+	}
+	if v := got["b.txt"]; v.OK || !errors.Is(v.Err, os.ErrNotExist) {
+		t.Errorf("missing file verdict = %+v", v)
+	}
+
+	report, err := json.Marshal(got["b.txt"])
+	if err != nil || !bytes.Contains(report, []byte(`"ok":false`)) || !bytes.Contains(report, []byte(`"error":`)) {
+		t.Errorf("JSON verdict = %s, %v", report, err)
+	}
+
+	if _, err := dec.VerifyManifestFiles(context.Background(), filepath.Join(tmpDir, "missing.json"), encDir, 0); err == nil {
+		t.Error("VerifyManifestFiles succeeded without a manifest")
+	}
+}
+
+func TestEncryptDir_NestedDestinationSkipped(t *testing.T) {
+	key := make([]byte, 32)
+	srcDir := t.TempDir()
+	writeTree(t, srcDir, map[string][]byte{"a.txt": []byte("alpha")})
+
+	enc, err := NewEncryptor(key)
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+
+	encDir := filepath.Join(srcDir, "encrypted")
+	if err := enc.EncryptDir(context.Background(), srcDir, encDir); err != nil {
+		t.Fatalf("EncryptDir failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(encDir, "encrypted")); !os.IsNotExist(err) {
+		t.Errorf("destination directory was encrypted into itself")
+	}
+	if _, err := os.Stat(filepath.Join(encDir, "a.txt"+EncryptedFileSuffix)); err != nil {
+		t.Errorf("expected encrypted file: %v", err)
+	}
+}
+
+func TestEncryptDir_SymlinkPolicy(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	srcDir := filepath.Join(t.TempDir(), "src")
+	writeTree(t, srcDir, map[string][]byte{"a.txt": []byte("alpha"), "dir/b.txt": []byte("bravo")})
+	links := map[string]string{
+		"file-link":    "a.txt",
+		"dir-link":     "dir",
+		"dir/loop":     "..",
+		"dangling.txt": "missing",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(srcDir, filepath.FromSlash(name))); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+
+	encryptWith := func(policy SymlinkPolicy) (string, error) {
+		encDir := filepath.Join(t.TempDir(), "enc")
+		enc, err := NewEncryptor(key, WithSymlinkPolicy(policy), WithExclude("dangling.txt"))
+		if err != nil {
+			t.Fatalf("NewEncryptor failed: %v", err)
+		}
+		defer enc.Destroy()
+		return encDir, enc.EncryptDir(context.Background(), srcDir, encDir)
+	}
+	exists := func(path string) bool {
+		_, err := os.Lstat(path)
+		return err == nil
+	}
+
+	t.Run("skip", func(t *testing.T) {
+		encDir, err := encryptWith(SymlinkSkip)
+		if err != nil {
+			t.Fatalf("EncryptDir failed: %v", err)
+		}
+		if !exists(filepath.Join(encDir, "a.txt.enc")) || !exists(filepath.Join(encDir, "dir", "b.txt.enc")) {
+			t.Error("regular files were not encrypted")
+		}
+		if exists(filepath.Join(encDir, "file-link.enc")) || exists(filepath.Join(encDir, "dir-link")) {
+			t.Error("symlinks were not skipped")
+		}
+	})
+
+	t.Run("follow", func(t *testing.T) {
+		encDir, err := encryptWith(SymlinkFollow)
+		if err != nil {
+			t.Fatalf("EncryptDir failed: %v", err)
+		}
+		for _, name := range []string{"file-link.enc", "dir-link/b.txt.enc"} {
+			if !exists(filepath.Join(encDir, filepath.FromSlash(name))) {
+				t.Errorf("%s: expected link target to be encrypted", name)
+			}
+		}
+		if exists(filepath.Join(encDir, "dir", "loop")) || exists(filepath.Join(encDir, "dir-link", "loop")) {
+			t.Error("link back to an ancestor was followed")
+		}
+	})
+
+	t.Run("follow dangling", func(t *testing.T) {
+		enc, err := NewEncryptor(key, WithSymlinkPolicy(SymlinkFollow))
+		if err != nil {
+			t.Fatalf("NewEncryptor failed: %v", err)
+		}
+		defer enc.Destroy()
+		if err := enc.EncryptDir(context.Background(), srcDir, filepath.Join(t.TempDir(), "enc")); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected os.ErrNotExist for dangling link, got %v", err)
+		}
+	})
+
+	t.Run("preserve", func(t *testing.T) {
+		encDir, err := encryptWith(SymlinkPreserve)
+		if err != nil {
+			t.Fatalf("EncryptDir failed: %v", err)
+		}
+		dec, err := NewDecryptor(key, WithSymlinkPolicy(SymlinkPreserve))
+		if err != nil {
+			t.Fatalf("NewDecryptor failed: %v", err)
+		}
+		defer dec.Destroy()
+		decDir := filepath.Join(t.TempDir(), "dec")
+		if err := dec.DecryptDir(context.Background(), encDir, decDir); err != nil {
+			t.Fatalf("DecryptDir failed: %v", err)
+		}
+		for name, target := range links {
+			got, err := os.Readlink(filepath.Join(decDir, filepath.FromSlash(name)))
+			if name == "dangling.txt" {
+				if err == nil {
+					t.Errorf("%s: excluded link was preserved", name)
+				}
+				continue
+			}
+			if err != nil || got != target {
+				t.Errorf("%s: link target = %q (%v), want %q", name, got, err, target)
+			}
+		}
+		data, err := os.ReadFile(filepath.Join(decDir, "file-link"))
+		if err != nil || string(data) != "alpha" {
+			t.Errorf("restored link does not resolve to the restored file: %q, %v", data, err)
+		}
+	})
+
+	if _, err := NewEncryptor(key, WithSymlinkPolicy(SymlinkPreserve+1)); err == nil {
+		t.Error("expected error for invalid symlink policy")
+	}
+}
@@ -0,0 +1,70 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// dryrun.go: Encryption plans computed without writing anything
+package core
+
+import (
+	"fmt"
+	"os"
+)
+
+// PlannedFile is one file a dry run would encrypt.
+type PlannedFile struct {
+	Src string
+	Dst string
+	// Size is the plaintext size and EstimatedSize the size of the encrypted
+	// file.
+	Size          int64
+	EstimatedSize int64
+	// Exists is set when Dst already exists and would be overwritten.
+	Exists bool
+}
+
+// DryRunPlan is what EncryptFile, EncryptFiles and EncryptDir would do, as
+// filled in by WithDryRun.
+type DryRunPlan struct {
+	// Files lists the files in the order they would be encrypted.
+	Files []PlannedFile
+	// Bytes and EstimatedBytes are the total plaintext and encrypted sizes.
+	Bytes          int64
+	EstimatedBytes int64
+	// Conflicts is the number of files whose destination already exists.
+	Conflicts int
+}
+
+// add records f in the plan.
+func (p *DryRunPlan) add(f PlannedFile) {
+	p.Files = append(p.Files, f)
+	p.Bytes += f.Size
+	p.EstimatedBytes += f.EstimatedSize
+	if f.Exists {
+		p.Conflicts++
+	}
+}
+
+// planFile adds srcPath to the dry-run plan, checking that it exists and is
+// a regular file as encryption would.
+func (e *Encryptor) planFile(srcPath, dstPath string) error {
+	info, err := os.Stat(srcPath)
+	if err != nil {
+		return WrapError("open source file", err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("cannot plan %s: not a regular file", info.Mode().Type())
+	}
+	_, err = os.Lstat(dstPath)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.plan.add(PlannedFile{
+		Src:           srcPath,
+		Dst:           dstPath,
+		Size:          info.Size(),
+		EstimatedSize: e.fileSize(info.Size()),
+		Exists:        err == nil,
+	})
+	return nil
+}
@@ -0,0 +1,77 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithDryRun(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	srcDir := filepath.Join(t.TempDir(), "src")
+	dstDir := filepath.Join(t.TempDir(), "dst")
+	for name, size := range map[string]int{"a.txt": 100, "sub/b.txt": 5000} {
+		path := filepath.Join(srcDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatalf("MkdirAll failed: %v", err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0600); err != nil {
+			t.Fatalf("failed to write source: %v", err)
+		}
+	}
+
+	var plan DryRunPlan
+	var report OperationReport
+	enc, err := NewEncryptor(key, WithDryRun(&plan), WithReport(&report), WithManifest(filepath.Join(dstDir, "manifest.json")))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+
+	if err := enc.EncryptDir(context.Background(), srcDir, dstDir); err != nil {
+		t.Fatalf("EncryptDir failed: %v", err)
+	}
+	if _, err := os.Stat(dstDir); !os.IsNotExist(err) {
+		t.Errorf("dry run created the destination: %v", err)
+	}
+	if report.Operation != "" {
+		t.Errorf("dry run filled the report: %+v", report)
+	}
+	if len(plan.Files) != 2 || plan.Bytes != 5100 || plan.Conflicts != 0 {
+		t.Fatalf("unexpected plan: %+v", plan)
+	}
+	if want := encryptedSize(100, DefaultChunkSize, false) + encryptedSize(5000, DefaultChunkSize, false); plan.EstimatedBytes != want {
+		t.Errorf("EstimatedBytes = %d, want %d", plan.EstimatedBytes, want)
+	}
+
+	// Existing destinations are reported as conflicts and left alone.
+	existing := filepath.Join(t.TempDir(), "a.txt.enc")
+	if err := os.WriteFile(existing, []byte("keep"), 0600); err != nil {
+		t.Fatalf("failed to write destination: %v", err)
+	}
+	plan = DryRunPlan{}
+	results := enc.EncryptFiles(context.Background(), []BatchItem{
+		{Src: filepath.Join(srcDir, "a.txt"), Dst: existing},
+		{Src: filepath.Join(srcDir, "missing.txt"), Dst: existing + "2"},
+	})
+	if results[0].Err != nil || results[1].Err == nil {
+		t.Errorf("unexpected results: %+v", results)
+	}
+	if len(plan.Files) != 1 || !plan.Files[0].Exists || plan.Conflicts != 1 {
+		t.Errorf("unexpected plan: %+v", plan)
+	}
+	if data, err := os.ReadFile(existing); err != nil || string(data) != "keep" {
+		t.Errorf("dry run modified the destination: %q, %v", data, err)
+	}
+}
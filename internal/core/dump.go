@@ -0,0 +1,153 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// dump.go: Encrypted output of long-running dump commands
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stderrTail is the number of bytes at the end of a command's standard
+// error that EncryptingCommandRunner adds to its error.
+const stderrTail = 4096
+
+// EncryptingCommandRunner runs dump commands such as pg_dump or mysqldump
+// and encrypts each one's output to a file under a directory, recording the
+// files in the manifest set with WithManifest, if any, so the set of dumps
+// can be audited with VerifyManifest and restored with DecryptToCommand.
+//
+// A dump only replaces its file once the command has exited successfully and
+// its output has been encrypted and synced: a command that fails, is killed
+// or is cancelled through ctx leaves the previous file and manifest entry in
+// place and no partial output behind. Its error matches *exec.ExitError with
+// errors.As and, unless the command's Stderr was set by the caller, ends
+// with the last lines the command wrote to standard error.
+//
+// Run is safe for concurrent use. Each manifest should be written by one
+// runner at a time.
+type EncryptingCommandRunner struct {
+	enc *Encryptor
+	dir string
+
+	mu       sync.Mutex
+	manifest *Manifest
+}
+
+// NewCommandRunner returns a runner writing encrypted dumps under dir. If
+// WithManifest is set, entries already in the manifest are kept. Obfuscated
+// names are not supported.
+func (e *Encryptor) NewCommandRunner(dir string) (*EncryptingCommandRunner, error) {
+	if e.obfuscateNames {
+		return nil, fmt.Errorf("%w: obfuscated names for command output", ErrUnsupportedFeature)
+	}
+	r := &EncryptingCommandRunner{enc: e, dir: dir}
+	if e.manifest != "" {
+		m, err := e.readManifest()
+		if err != nil {
+			return nil, WrapError("read manifest", err)
+		}
+		r.manifest = m
+	}
+	return r, nil
+}
+
+// Run starts cmd and encrypts its standard output to name, a slash-separated
+// path relative to the runner's directory, with the configured suffix
+// (EncryptedFileSuffix by default) appended. cmd must not have been started
+// and its Stdout must be nil. It returns the entry recorded for the dump.
+func (r *EncryptingCommandRunner) Run(ctx context.Context, name string, cmd *exec.Cmd) (ManifestEntry, error) {
+	if !filepath.IsLocal(filepath.FromSlash(name)) {
+		return ManifestEntry{}, fmt.Errorf("invalid dump name %q", name)
+	}
+	e := r.enc
+	dst := filepath.Join(r.dir, filepath.FromSlash(name)) + e.naming.suffix
+	if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return ManifestEntry{}, WrapError("create output directory", err)
+	}
+
+	var stderr *tailWriter
+	if cmd.Stderr == nil {
+		stderr = &tailWriter{}
+		cmd.Stderr = stderr
+	}
+	start := time.Now()
+	plainHash := sha256.New()
+	ctHash := sha256.New()
+	var size int64
+	err := writeFileAtomic(dst, 0600, func(f *os.File) error {
+		var err error
+		size, err = e.encryptFromCommand(ctx, cmd, io.MultiWriter(f, ctHash), plainHash)
+		return err
+	})
+	if err != nil {
+		var exitErr *exec.ExitError
+		if stderr != nil && errors.As(err, &exitErr) {
+			if msg := stderr.String(); msg != "" {
+				err = fmt.Errorf("%w: %s", err, msg)
+			}
+		}
+		return ManifestEntry{}, fmt.Errorf("%s: %w", name, err)
+	}
+
+	entry := ManifestEntry{
+		Path:             filepath.ToSlash(filepath.Clean(filepath.FromSlash(name))),
+		Size:             size,
+		PlaintextSHA256:  hex.EncodeToString(plainHash.Sum(nil)),
+		CiphertextSHA256: hex.EncodeToString(ctHash.Sum(nil)),
+		ModTime:          start,
+	}
+	if r.manifest == nil {
+		return entry, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m := r.manifest
+	if i := slices.IndexFunc(m.Files, func(f ManifestEntry) bool { return f.Path == entry.Path }); i >= 0 {
+		m.Files[i] = entry
+	} else {
+		m.Files = append(m.Files, entry)
+	}
+	if e.naming.suffix != EncryptedFileSuffix {
+		m.Suffix = e.naming.suffix
+	}
+	return entry, e.writeManifest(m)
+}
+
+// tailWriter keeps the last stderrTail bytes written to it.
+type tailWriter struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (w *tailWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	if len(w.buf) > stderrTail {
+		w.buf = append(w.buf[:0], w.buf[len(w.buf)-stderrTail:]...)
+	}
+	return len(p), nil
+}
+
+// String returns the text kept, trimmed of surrounding white space.
+func (w *tailWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return strings.TrimSpace(string(w.buf))
+}
@@ -0,0 +1,118 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncryptingCommandRunner(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no shell available")
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	dir := t.TempDir()
+	manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+	enc, err := NewEncryptor(key, WithManifest(manifestPath))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	ctx := context.Background()
+
+	runner, err := enc.NewCommandRunner(dir)
+	if err != nil {
+		t.Fatalf("NewCommandRunner failed: %v", err)
+	}
+	entry, err := runner.Run(ctx, "db/users.sql", exec.Command(sh, "-c", "printf 'users dump'"))
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if entry.Path != "db/users.sql" || entry.Size != int64(len("users dump")) {
+		t.Errorf("entry = %+v", entry)
+	}
+	if err := dec.VerifyManifest(ctx, manifestPath, dir); err != nil {
+		t.Errorf("VerifyManifest failed: %v", err)
+	}
+	good, err := os.ReadFile(filepath.Join(dir, "db", "users.sql.enc"))
+	if err != nil {
+		t.Fatalf("reading dump: %v", err)
+	}
+	manifest, err := os.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatalf("reading manifest: %v", err)
+	}
+
+	// A failing dump reports its standard error and leaves the previous
+	// dump, the manifest and no partial output behind.
+	_, err = runner.Run(ctx, "db/users.sql", exec.Command(sh, "-c", "printf partial; echo boom >&2; exit 2"))
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 2 || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("Run error = %v, want exit status 2 with the command's error output", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(dir, "db", "users.sql.enc")); err != nil || !bytes.Equal(got, good) {
+		t.Errorf("failed dump replaced the previous one: %v", err)
+	}
+	if got, err := os.ReadFile(manifestPath); err != nil || !bytes.Equal(got, manifest) {
+		t.Errorf("failed dump changed the manifest: %v", err)
+	}
+	if files, _ := os.ReadDir(filepath.Join(dir, "db")); len(files) != 1 {
+		t.Errorf("output directory holds %d files, want 1", len(files))
+	}
+
+	// A new runner keeps the dumps already in the manifest.
+	runner, err = enc.NewCommandRunner(dir)
+	if err != nil {
+		t.Fatalf("NewCommandRunner failed: %v", err)
+	}
+	if _, err := runner.Run(ctx, "orders.sql", exec.Command(sh, "-c", "printf 'orders dump'")); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	m, err := dec.ReadManifest(manifestPath)
+	if err != nil {
+		t.Fatalf("ReadManifest failed: %v", err)
+	}
+	if len(m.Files) != 2 {
+		t.Errorf("manifest lists %d files, want 2", len(m.Files))
+	}
+	if err := dec.VerifyManifest(ctx, manifestPath, dir); err != nil {
+		t.Errorf("VerifyManifest failed: %v", err)
+	}
+
+	var restored bytes.Buffer
+	cmd := exec.Command(sh, "-c", "cat")
+	cmd.Stdout = &restored
+	f, err := os.Open(filepath.Join(dir, "orders.sql.enc"))
+	if err != nil {
+		t.Fatalf("opening dump: %v", err)
+	}
+	defer f.Close()
+	if err := dec.DecryptToCommand(ctx, f, cmd); err != nil || restored.String() != "orders dump" {
+		t.Errorf("restored %q, %v", restored.String(), err)
+	}
+
+	if _, err := runner.Run(ctx, "../escape.sql", exec.Command(sh, "-c", "true")); err == nil {
+		t.Error("Run accepted a name outside the directory")
+	}
+}
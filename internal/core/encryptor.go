@@ -8,36 +8,116 @@
 package core
 
 import (
-	"bufio"
 	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
-	"encoding/binary"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 	"sync"
+	"time"
 
+	"github.com/gitrgoliveira/go-fileencrypt/format"
 	"github.com/gitrgoliveira/go-fileencrypt/secure"
 )
 
 // Encryptor handles chunked encryption of files and streams.
+// It is safe for concurrent use: the cipher is initialized once and each call
+// keeps its own stream state, so one Encryptor can efficiently process many
+// files. A progress callback set with WithProgress may be invoked from several
+// goroutines at once and must be safe for concurrent use itself. A report
+// set with WithReport is shared by every call; read it with Report while
+// calls are running.
 type Encryptor struct {
+	// mu guards keyBuf and aead against Destroy, and the report against
+	// concurrent calls and Report.
+	mu         sync.RWMutex
+	destroyed  bool
 	keyBuf     *secure.SecureBuffer
+	aead       cipher.AEAD
 	chunkSize  int
 	progress   func(float64)
 	checksum   bool
 	algorithm  Algorithm
 	bufferPool *sync.Pool
+	ioPools    *ioPools
+	errDetail  ErrorDetail
+	report     *OperationReport
+	plainHash  func() hash.Hash
+	filter     fileFilter
+	symlinks   SymlinkPolicy
+	manifest   string
+	pipeline   int
+	// parallelism is the number of pipeline workers, or ParallelismAuto.
+	parallelism int
+	// cpus lists the CPUs pipeline workers are pinned to.
+	cpus []int
+	// checksumHash creates the hash of output checksums (SHA-256 by default).
+	checksumHash func() hash.Hash
+	priority     Priority
+	chunkDelay   time.Duration
+	// obfuscateNames hashes the names EncryptDir writes.
+	obfuscateNames bool
+	// usage accounts the messages and bytes encrypted under the key.
+	usage *keyUsage
+	// audit reports operations to the audit sink; nil without one.
+	audit *auditor
+	// plan, if set, receives the dry-run plan instead of files being encrypted.
+	plan *DryRunPlan
+	// timeout and chunkDeadline bound each operation and each chunk.
+	timeout       time.Duration
+	chunkDeadline time.Duration
+	// preallocate reserves the space of output files before writing them.
+	preallocate bool
+	// padding, if set, pads the plaintext of every stream.
+	padding PaddingScheme
+	// flags are the layout flags of the options, added to headerFlags.
+	flags format.Flags
+	// nonceSource supplies base nonces; crypto/rand unless replaced by the
+	// testhooks-only WithDeterministicNonce.
+	nonceSource io.Reader
+	// chunkCallback, if set, is called after every chunk.
+	chunkCallback func(ChunkInfo)
+	// sidecar selects the checksum sidecar EncryptFile writes.
+	sidecar SidecarSource
+	// manifestSigner, if set, signs the manifest EncryptDir writes.
+	manifestSigner *manifestSigner
+	// mask, if set, masks the output so it cannot be told from random data.
+	mask *masker
+	// naming is the suffix and collision policy of output names.
+	naming naming
+	// tombstones makes SyncDir keep the encrypted files of removed sources.
+	tombstones bool
+	// snapshot, if set, is recorded in manifests.
+	snapshot *SnapshotInfo
+	// stopExpiry cancels the key expiry set with WithKeyContext or
+	// WithKeyDeadline; expired is set once the key expired.
+	stopExpiry func()
+	expired    bool
+	// readBack, if set, verifies the output of streams once written.
+	readBack *readBack
 	// startChunkCounter is a test hook to initialize the per-stream chunk counter.
 	// It remains zero in normal use; tests may set it to trigger edge cases.
 	startChunkCounter uint32
 }
 
+// NewEncryptorFromSecureBuffer creates an Encryptor from a key held in a
+// SecureBuffer, such as one filled by GenerateKeyInto, so the key never
+// passes through an ordinary byte slice. The key is copied into the
+// Encryptor's own locked buffer and key remains owned by the caller, who may
+// destroy it once this returns.
+func NewEncryptorFromSecureBuffer(key *secure.SecureBuffer, opts ...Option) (*Encryptor, error) {
+	if key == nil {
+		return nil, fmt.Errorf("%w: nil key buffer", ErrInvalidKey)
+	}
+	return NewEncryptor(key.Data(), opts...)
+}
+
 func NewEncryptor(key []byte, opts ...Option) (*Encryptor, error) {
 	if len(key) != 32 {
-		return nil, fmt.Errorf("invalid key length: must be 32 bytes for AES-256, got %d", len(key))
+		return nil, fmt.Errorf("%w: must be 32 bytes for AES-256, got %d", ErrInvalidKey, len(key))
 	}
 	cfg := &Config{
 		ChunkSize: DefaultChunkSize, // default 1MB
@@ -46,31 +126,141 @@ func NewEncryptor(key []byte, opts ...Option) (*Encryptor, error) {
 	for _, opt := range opts {
 		opt(cfg)
 	}
-	// Validate chunk size only once, using WithChunkSize logic
-	if cfg.ChunkSize < MinChunkSize || cfg.ChunkSize > MaxChunkSize {
-		return nil, fmt.Errorf("invalid chunk size: must be between %d and %d bytes, got %d", MinChunkSize, MaxChunkSize, cfg.ChunkSize)
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	filter, err := newFileFilter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	random := rand.Reader
+	if cfg.Rand != nil {
+		random = &lockedReader{r: cfg.Rand}
+	}
+	nonceSource := random
+	switch {
+	case cfg.nonceSource != nil:
+		nonceSource = cfg.nonceSource()
+	case cfg.NonceManager != nil:
+		nonceSource = nonceCounter{cfg.NonceManager}
+	}
+	var limits KeyLimits
+	if cfg.KeyLimits != nil {
+		limits = *cfg.KeyLimits
 	}
+	audit, err := newAuditor(cfg.AuditSink, key)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := newKeyUsage(limits, cfg.KeyLimits != nil)
+	if err != nil {
+		return nil, err
+	}
+	nonceSource = usageNonces{src: nonceSource, usage: usage}
 	keyBuf, err := secure.NewSecureBufferFromBytes(key)
 	if err != nil {
+		_ = usage.close()
 		return nil, fmt.Errorf("failed to create SecureBuffer for key: %w", err)
 	}
-	return &Encryptor{
-		keyBuf:    keyBuf,
-		chunkSize: cfg.ChunkSize,
-		progress:  cfg.Progress,
-		checksum:  cfg.Checksum,
-		algorithm: cfg.Algorithm,
+	aead, err := newAESGCM(keyBuf.Data())
+	if err != nil {
+		keyBuf.Destroy()
+		_ = usage.close()
+		return nil, err
+	}
+	var mask *masker
+	if cfg.Masking {
+		if mask, err = newMasker(keyBuf.Data(), random); err != nil {
+			keyBuf.Destroy()
+			_ = usage.close()
+			return nil, err
+		}
+	}
+	e := &Encryptor{
+		keyBuf:      keyBuf,
+		aead:        usageAEAD{AEAD: aead, usage: usage},
+		chunkSize:   cfg.ChunkSize,
+		progress:    cfg.Progress,
+		checksum:    cfg.Checksum,
+		algorithm:   cfg.Algorithm,
+		errDetail:   cfg.ErrorDetail,
+		report:      cfg.Report,
+		plainHash:   cfg.PlaintextHash,
+		filter:      filter,
+		symlinks:    cfg.Symlinks,
+		manifest:    cfg.Manifest,
+		pipeline:    cfg.Pipeline,
+		parallelism: cfg.Parallelism,
+		cpus:        cfg.CPUAffinity,
+		nonceSource: nonceSource,
 		bufferPool: &sync.Pool{
 			New: func() interface{} {
 				buf := make([]byte, cfg.ChunkSize)
 				return &buf
 			},
 		},
-	}, nil
+		ioPools:      newIOPools(cfg.ChunkSize),
+		checksumHash: checksumHash(cfg),
+		priority:     cfg.Priority,
+		chunkDelay:   cfg.ChunkDelay,
+
+		obfuscateNames: cfg.ObfuscateNames,
+		chunkCallback:  cfg.ChunkCallback,
+		usage:          usage,
+		audit:          audit,
+		plan:           cfg.DryRun,
+		timeout:        cfg.Timeout,
+		chunkDeadline:  cfg.ChunkDeadline,
+		preallocate:    cfg.Preallocate,
+		flags:          cfg.streamFlags(),
+		padding:        cfg.Padding,
+		sidecar:        cfg.Sidecar,
+		manifestSigner: newManifestSigner(cfg),
+		mask:           mask,
+		naming:         newNaming(cfg),
+		tombstones:     cfg.Tombstones,
+		snapshot:       cfg.Snapshot,
+		readBack:       cfg.ReadBack,
+	}
+	if e.stopExpiry, err = startKeyExpiry(cfg, e.expire); err != nil {
+		e.Destroy()
+		return nil, err
+	}
+	return e, nil
 }
 
 // EncryptFile performs chunked encryption of a file.
 func (e *Encryptor) EncryptFile(ctx context.Context, srcPath, dstPath string) error {
+	return e.runEncryptFile(ctx, srcPath, dstPath, e.checksum)
+}
+
+// runEncryptFile encrypts one file and fills the report. The output checksum
+// is computed only when checksum is set; batches hash outputs concurrently
+// instead.
+func (e *Encryptor) runEncryptFile(ctx context.Context, srcPath, dstPath string, checksum bool) error {
+	if e.plan != nil {
+		return withDetail(e.errDetail, "encrypt", srcPath, e.planFile(srcPath, dstPath))
+	}
+	ctx, release := e.deadlines(ctx)
+	defer release()
+	start := time.Now()
+	st := newStreamStats(e.plainHash)
+	st.addSidecar(e.sidecar)
+	if checksum {
+		st.outSum = e.checksumHash()
+	}
+	err := e.encryptFile(ctx, srcPath, dstPath, &st)
+	if err == nil && checksum {
+		st.checksum = st.outSum.Sum(nil)
+	}
+	if err == nil && e.sidecar != SidecarNone {
+		err = st.writeSidecar(srcPath, dstPath)
+	}
+	e.fillReport(ctx, srcPath, st, start, err)
+	return withDetail(e.errDetail, "encrypt", srcPath, err)
+}
+
+func (e *Encryptor) encryptFile(ctx context.Context, srcPath, dstPath string, st *streamStats) (err error) {
 	if !e.algorithm.IsSupported() {
 		return fmt.Errorf("unsupported algorithm: %s (only AES-256-GCM is currently supported)", e.algorithm)
 	}
@@ -85,42 +275,170 @@ func (e *Encryptor) EncryptFile(ctx context.Context, srcPath, dstPath string) er
 	}
 	defer srcFile.Close()
 
-	dstFile, err := os.Create(dstPath) // #nosec G304 -- File path provided by caller, library purpose is file encryption
+	dstFile, err := createOutput(srcFile, dstPath, e.outputSize(srcFile), e.preallocate)
 	if err != nil {
-		return WrapError("create destination file", err)
+		return err
 	}
-	defer dstFile.Close()
+	defer func() { err = closeOutput(dstFile, err) }()
 
-	bufferedReader := bufio.NewReaderSize(srcFile, e.chunkSize)
-	bufferedWriter := bufio.NewWriterSize(dstFile, e.chunkSize)
-	defer func() {
-		if flushErr := bufferedWriter.Flush(); flushErr != nil && err == nil {
-			err = WrapError("flush buffer", flushErr)
-		}
-	}()
+	return e.encryptOpenFile(ctx, srcFile, st.outputWriter(dstFile), st)
+}
 
+// outputSize returns the size the encryption of srcFile will have, or 0 if
+// srcFile is not a regular file.
+func (e *Encryptor) outputSize(srcFile *os.File) int64 {
+	stat, err := srcFile.Stat()
+	if err != nil || !stat.Mode().IsRegular() {
+		return 0
+	}
+	return e.fileSize(stat.Size())
+}
+
+// fileSize returns the size of the encryption of size plaintext bytes.
+func (e *Encryptor) fileSize(size int64) int64 {
+	out := fileSize(size, e.chunkSize, e.flags, e.padding)
+	if e.mask != nil {
+		out += MaskIVSize
+	}
+	return out
+}
+
+// encryptOpenFile encrypts srcFile into dst through pooled buffers and
+// flushes the output, so dst is complete when it returns successfully.
+func (e *Encryptor) encryptOpenFile(ctx context.Context, srcFile *os.File, dst io.Writer, st *streamStats) error {
+	return runAtPriority(e.priority, func() error {
+		return e.encryptFileTo(ctx, srcFile, dst, st)
+	})
+}
+
+func (e *Encryptor) encryptFileTo(ctx context.Context, srcFile *os.File, dst io.Writer, st *streamStats) error {
 	stat, err := srcFile.Stat()
 	if err != nil {
 		return WrapError("stat source file", err)
 	}
-	totalSize := stat.Size()
+	// Pipes, sockets and devices report no meaningful size up front; the true
+	// size is recorded in the authenticated trailer instead.
+	var totalSize int64
+	if stat.Mode().IsRegular() {
+		totalSize = stat.Size()
+		if totalSize < int64(e.chunkSize) && e.padding == nil {
+			return e.encryptSmall(ctx, newCtxReader(ctx, srcFile), newCtxWriter(ctx, dst), totalSize, st)
+		}
+	}
+
+	bufferedReader := e.ioPools.reader(ctx, srcFile)
+	defer e.ioPools.putReader(bufferedReader)
+	bufferedWriter := e.ioPools.writer(ctx, dst)
+	defer e.ioPools.putWriter(bufferedWriter)
 
-	if err := e.EncryptStream(ctx, bufferedReader, bufferedWriter, totalSize); err != nil {
+	if err := e.encryptStream(ctx, bufferedReader, bufferedWriter, totalSize, nil, st); err != nil {
 		return err
 	}
+	// Flush so the checksum covers the complete output.
+	if err := bufferedWriter.Flush(); err != nil {
+		return WrapError("flush buffer", err)
+	}
+	return nil
+}
 
-	if e.checksum {
-		if _, err := CalculateChecksum(dstPath); err != nil {
-			return WrapError("calculate checksum", err)
+// encryptSmall encrypts a source of size bytes, smaller than one chunk, into
+// a single output buffer with one Seal and one Write. It skips the pooled
+// chunk and I/O buffers, which dominate the cost of encrypting small files,
+// and produces the same output as encryptStream.
+func (e *Encryptor) encryptSmall(ctx context.Context, src io.Reader, dst io.Writer, size int64, st *streamStats) error {
+	if ctx.Err() != nil {
+		return contextError(ctx)
+	}
+	if !e.algorithm.IsSupported() {
+		return fmt.Errorf("unsupported algorithm: %s (only AES-256-GCM is currently supported)", e.algorithm)
+	}
+	gcm, err := e.newAEAD()
+	if err != nil {
+		return err
+	}
+	sealer, header, err := newChunkSealer(gcm, size, e.startChunkCounter, e.nonceSource, e.flags, nil)
+	if err != nil {
+		return err
+	}
+	if e.mask != nil {
+		if dst, err = e.mask.writer(dst, st); err != nil {
+			return err
 		}
 	}
 
+	// The plaintext is read to where its ciphertext goes and sealed in
+	// place. The capacity also covers the probe byte, tag and trailer.
+	n := int(size) // #nosec G115 -- size is below the chunk size
+	at := len(header) + format.LengthSize
+	out := make([]byte, at+n+1, at+n+TagSize+TrailerSize+int(format.IndexSize(1))+format.ChunkDigestSize)
+	copy(out, header)
+	plaintext := out[at : at+n]
+	if m, err := io.ReadFull(src, plaintext); err != nil {
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			return fmt.Errorf("source size changed during encryption: read %d bytes, expected %d", m, size)
+		}
+		return atChunk(min(m, 1), WrapError("read source stream", err))
+	}
+	if m, err := src.Read(out[at+n:]); m > 0 {
+		return fmt.Errorf("source size changed during encryption: read more than %d bytes", size)
+	} else if err != nil && err != io.EOF {
+		return atChunk(min(n, 1), WrapError("read source stream", err))
+	}
+	st.addPlaintext(plaintext)
+
+	out = out[:len(header)]
+	if n > 0 {
+		if out, err = sealer.seal(out, plaintext); err != nil {
+			return err
+		}
+		st.chunks++
+	}
+	out = sealer.trailer(out, size)
+	if _, err := dst.Write(out); err != nil {
+		return WrapError("write encrypted data", err)
+	}
+	st.plaintext = size
+	st.ciphertext += int64(len(out))
+	st.complete = true
+
+	progress := newProgressReporter(e.progress, size)
+	progress.finish()
 	return nil
 }
 
 // EncryptStream performs chunked encryption of a stream.
-// If sizeHint > 0, it is used for progress reporting only.
+// If sizeHint > 0, it is recorded in the header and used for progress reporting;
+// the stream must then contain exactly sizeHint bytes. The true size is always
+// recorded in the authenticated trailer.
 func (e *Encryptor) EncryptStream(ctx context.Context, src io.Reader, dst io.Writer, sizeHint ...int64) error {
+	var totalSize int64
+	if len(sizeHint) > 0 {
+		totalSize = sizeHint[0]
+	}
+	return e.runEncryptStream(ctx, src, dst, totalSize, nil)
+}
+
+// runEncryptStream encrypts src to dst as EncryptStream does, recording the
+// part descriptor in the header if part is non-nil, and fills the report.
+func (e *Encryptor) runEncryptStream(ctx context.Context, src io.Reader, dst io.Writer, totalSize int64, part *format.Part) error {
+	ctx, release := e.deadlines(ctx)
+	defer release()
+	start := time.Now()
+	st := newStreamStats(e.plainHash)
+	dst, rb := e.readBack.wrap(dst, e.chunkSize)
+	err := runAtPriority(e.priority, func() error {
+		return e.encryptStream(ctx, newCtxReader(ctx, src), newCtxWriter(ctx, dst), totalSize, part, &st)
+	})
+	if err == nil && rb != nil {
+		err = rb.verify(ctx)
+	}
+	e.fillReport(ctx, "", st, start, err)
+	return withDetail(e.errDetail, "encrypt", "stream", err)
+}
+
+// encryptStream encrypts src to dst. part, if non-nil, is the descriptor of
+// the EncryptPart part being written, recorded in the header.
+func (e *Encryptor) encryptStream(ctx context.Context, src io.Reader, dst io.Writer, totalSize int64, part *format.Part, st *streamStats) error {
 	if !e.algorithm.IsSupported() {
 		return fmt.Errorf("unsupported algorithm: %s (only AES-256-GCM is currently supported)", e.algorithm)
 	}
@@ -129,95 +447,102 @@ func (e *Encryptor) EncryptStream(ctx context.Context, src io.Reader, dst io.Wri
 		return fmt.Errorf("invalid chunk size: must be between 1 and %d bytes", MaxChunkSize)
 	}
 
-	key := e.keyBuf.Data()
-	if len(key) != 32 {
-		return fmt.Errorf("invalid key length: must be 32 bytes for AES-256")
-	}
-
-	block, err := aes.NewCipher(key)
+	gcm, err := e.newAEAD()
 	if err != nil {
-		return WrapError("create cipher", err)
+		return err
 	}
 
-	gcm, err := cipher.NewGCM(block)
+	sealer, header, err := newChunkSealer(gcm, totalSize, e.startChunkCounter, e.nonceSource, e.flags, part)
 	if err != nil {
-		return WrapError("create GCM", err)
-	}
-
-	baseNonce := make([]byte, NonceSize)
-	if _, err := rand.Read(baseNonce); err != nil {
-		return WrapError("generate nonce", err)
+		return err
 	}
-
-	if _, err := dst.Write([]byte(MagicBytes)); err != nil {
-		return WrapError("write magic bytes", err)
+	if e.mask != nil {
+		if dst, err = e.mask.writer(dst, st); err != nil {
+			return err
+		}
 	}
-	if _, err := dst.Write([]byte{Version}); err != nil {
-		return WrapError("write version byte", err)
+	if _, err := dst.Write(header); err != nil {
+		return WrapError("write header", err)
 	}
-
-	if _, err := dst.Write(baseNonce); err != nil {
-		return WrapError("write nonce", err)
+	st.ciphertext += int64(len(header))
+
+	// With padding, the records carry the padded plaintext; padded counts
+	// it, and written only the data.
+	var padding *paddingReader
+	var padded int64
+	if e.padding != nil {
+		padding = newPaddingReader(src, e.padding)
+		src = padding
 	}
 
-	var totalSize int64
-	if len(sizeHint) > 0 {
-		totalSize = sizeHint[0]
-	}
-	sizeBytes := make([]byte, 8)
-	binary.BigEndian.PutUint64(sizeBytes, uint64(totalSize)) // #nosec G115 -- int64 to uint64 conversion safe for file sizes
-	if _, err := dst.Write(sizeBytes); err != nil {
-		return WrapError("write file size", err)
+	// next reads and seals the next chunk. The error, if any, follows the
+	// returned data.
+	var next func() (plaintext, record []byte, err error)
+	stop := func() {}
+	if e.pipeline > 0 {
+		p := newSealPipeline(ctx, src, sealer, e.chunkSize, e.pipeline, e.parallelism, e.cpus, e.priority)
+		defer p.close()
+		defer func() { st.sealWorkers = p.sealWorkers() }()
+		next, stop = p.next, p.close
+	} else {
+		bufPtr := e.bufferPool.Get().(*[]byte)
+		defer e.bufferPool.Put(bufPtr)
+		buf := *bufPtr
+
+		var record []byte
+		next = func() ([]byte, []byte, error) {
+			n, err := src.Read(buf)
+			if err != nil && err != io.EOF {
+				err = atChunk(int(sealer.chunks())+min(n, 1), WrapError("read source stream", err))
+			}
+			if n == 0 {
+				return nil, nil, err
+			}
+			var sealErr error
+			if record, sealErr = sealer.seal(record[:0], buf[:n]); sealErr != nil {
+				return nil, nil, sealErr
+			}
+			return buf[:n], record, err
+		}
 	}
 
-	aad := sizeBytes
-
-	bufPtr := e.bufferPool.Get().(*[]byte)
-	defer e.bufferPool.Put(bufPtr)
-	buf := *bufPtr
-
 	var written int64
-	chunkCounter := e.startChunkCounter
-	progressNext := int64(0)
-	var progressStep int64
-	if totalSize > 0 {
-		progressStep = totalSize / 5 // 20% intervals
-	}
+	var chunks int
+	progress := newProgressReporter(e.progress, totalSize)
 
+	timer := newChunkTimer(e.chunkCallback, "encrypt")
 	for {
 		if ctx.Err() != nil {
-			return ErrContextCanceled
+			return contextError(ctx)
 		}
 
-		n, err := src.Read(buf)
-		if n > 0 {
-			nonce := make([]byte, NonceSize)
-			copy(nonce, baseNonce)
-			binary.BigEndian.PutUint32(nonce[8:], chunkCounter)
-			chunkCounter++
-
-			if chunkCounter == 0 {
-				return fmt.Errorf("nonce overflow: stream too large for single encryption")
+		timer.begin()
+		plaintext, record, err := next()
+		if len(plaintext) > 0 {
+			if _, err := dst.Write(record); err != nil {
+				return atChunk(chunks, WrapError("write encrypted chunk", err))
 			}
+			chunks++
 
-			ciphertext := gcm.Seal(nil, nonce, buf[:n], aad) // #nosec G407 -- Nonce is randomly generated per file, not hardcoded
-
-			chunkSizeBytes := make([]byte, 4)
-			binary.BigEndian.PutUint32(chunkSizeBytes, uint32(len(ciphertext))) // #nosec G115 -- len() result fits in uint32 (max chunk is 10MB)
-			if _, err := dst.Write(chunkSizeBytes); err != nil {
-				return WrapError("write chunk size", err)
+			if padding != nil {
+				n := len(plaintext)
+				plaintext = plaintext[:padding.dataLen(padded, n)]
+				padded += int64(n)
 			}
-
-			if _, err := dst.Write(ciphertext); err != nil {
-				return WrapError("write encrypted chunk", err)
+			st.addPlaintext(plaintext)
+			written += int64(len(plaintext))
+			st.plaintext = written
+			st.ciphertext += int64(len(record))
+			st.chunks++
+
+			progress.update(written)
+			timer.done(len(plaintext), len(record))
+			if err := pause(ctx, e.chunkDelay); err != nil {
+				return err
 			}
-
-			written += int64(n)
-
-			if e.progress != nil && totalSize > 0 && written >= progressNext {
-				progress := float64(written) / float64(totalSize)
-				e.progress(progress)
-				progressNext += progressStep
+			chunkDone(ctx)
+			if err := checkpoint(ctx, written, totalSize); err != nil {
+				return err
 			}
 		}
 
@@ -225,20 +550,101 @@ func (e *Encryptor) EncryptStream(ctx context.Context, src io.Reader, dst io.Wri
 			break
 		}
 		if err != nil {
-			return WrapError("read source stream", err)
+			return err
 		}
 	}
+	stop()
+
+	if totalSize > 0 && written != totalSize {
+		return fmt.Errorf("source size changed during encryption: read %d bytes, expected %d", written, totalSize)
+	}
 
-	if e.progress != nil {
-		e.progress(1.0)
+	trailer := sealer.trailer(nil, written)
+	if _, err := dst.Write(trailer); err != nil {
+		return WrapError("write trailer", err)
 	}
+	st.ciphertext += int64(len(trailer))
+	st.complete = true
+	progress.finish()
 
 	return nil
 }
 
-// Destroy zeroes key material and unlocks memory
+// newAEAD returns the encryptor's cached AES-256-GCM cipher. Go's GCM
+// implementation keeps no per-call state, so it may be shared across calls.
+func (e *Encryptor) newAEAD() (cipher.AEAD, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.destroyed {
+		return nil, e.errDestroyed()
+	}
+	return e.aead, nil
+}
+
+// newAESGCM builds the AES-256-GCM cipher for key.
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("%w: must be 32 bytes for AES-256", ErrInvalidKey)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, WrapError("create cipher", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, WrapError("create GCM", err)
+	}
+	return gcm, nil
+}
+
+// fillReport records st in the configured report, if any, and reports the
+// operation on path to the audit sink. The report is built first and copied
+// in under mu, so concurrent calls each leave a whole report and the last to
+// finish wins.
+func (e *Encryptor) fillReport(ctx context.Context, path string, st streamStats, start time.Time, err error) {
+	if e.plan != nil {
+		return
+	}
+	e.audit.audit(ctx, "encrypt", path, e.algorithm, st.plaintext, start, err)
+	if e.report == nil {
+		return
+	}
+	var r OperationReport
+	st.fill(&r, "encrypt", e.algorithm, start)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	*e.report = r
+}
+
+// Report returns a copy of the WithReport report, which describes the call
+// that finished last. Unlike the report itself, it may be read while other
+// calls are running. Without WithReport it returns the zero report.
+func (e *Encryptor) Report() OperationReport {
+	if e.report == nil {
+		return OperationReport{}
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return *e.report
+}
+
+// Destroy zeroes key material, unlocks memory and releases the cached
+// cipher. Operations already past
+// cipher setup run to completion; later calls fail with ErrDestroyed.
 func (e *Encryptor) Destroy() {
+	if e.stopExpiry != nil {
+		e.stopExpiry()
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.destroyed = true
+	e.aead = nil
 	if e.keyBuf != nil {
 		e.keyBuf.Destroy()
 	}
+	if e.usage != nil {
+		_ = e.usage.close()
+	}
 }
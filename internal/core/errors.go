@@ -7,12 +7,20 @@
 package core
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strings"
+
+	"github.com/gitrgoliveira/go-fileencrypt/format"
 )
 
-// SanitizeError removes sensitive details for external consumption
+// SanitizeError removes sensitive details for external consumption.
+// The returned error still matches its failure category (e.g. ErrWrongKey,
+// ErrCorruptedFile, os.ErrNotExist) with errors.Is, but carries no paths,
+// chunk numbers or underlying messages.
 func SanitizeError(err error) error {
 	if err == nil {
 		return nil
@@ -20,16 +28,107 @@ func SanitizeError(err error) error {
 
 	switch {
 	case errors.Is(err, ErrInvalidKey):
-		return fmt.Errorf("invalid encryption key")
+		return &sanitizedError{msg: "invalid encryption key", category: ErrInvalidKey}
+	case errors.Is(err, ErrWrongKey):
+		return &sanitizedError{msg: "incorrect decryption key", category: ErrWrongKey}
+	case errors.Is(err, ErrHeaderCorrupted):
+		return &sanitizedError{msg: "corrupted file header", category: ErrHeaderCorrupted}
 	case errors.Is(err, ErrChunkSize):
-		return fmt.Errorf("corrupted encrypted file")
+		return &sanitizedError{msg: "corrupted encrypted file", category: ErrCorruptedFile}
+	case errors.Is(err, ErrCorruptedFile), errors.Is(err, ErrAuthenticationFailed):
+		return &sanitizedError{msg: "corrupted encrypted file", category: ErrCorruptedFile}
+	case errors.Is(err, ErrUnsupportedVersion):
+		return &sanitizedError{msg: "unsupported file version", category: ErrUnsupportedVersion}
+	case errors.Is(err, ErrUnsupportedFeature):
+		return &sanitizedError{msg: "unsupported file feature", category: ErrUnsupportedFeature}
+	case errors.Is(err, ErrKeyExhausted):
+		return &sanitizedError{msg: "key usage limit reached", category: ErrKeyExhausted}
+	case errors.Is(err, ErrLimitExceeded):
+		return &sanitizedError{msg: "input limit exceeded", category: ErrLimitExceeded}
+	case errors.Is(err, ErrNoSpace):
+		return &sanitizedError{msg: "no space left on device", category: ErrNoSpace}
+	case errors.Is(err, ErrSameFile):
+		return &sanitizedError{msg: "source and destination are the same file", category: ErrSameFile}
+	case errors.Is(err, ErrTimeout):
+		return &sanitizedError{msg: "operation timed out", category: ErrTimeout}
+	case errors.Is(err, ErrContextCanceled):
+		return &sanitizedError{msg: "operation canceled", category: ErrContextCanceled}
 	case errors.Is(err, os.ErrPermission):
-		return fmt.Errorf("insufficient permissions")
+		return &sanitizedError{msg: "insufficient permissions", category: os.ErrPermission}
 	case errors.Is(err, os.ErrNotExist):
-		return fmt.Errorf("file not found")
+		return &sanitizedError{msg: "file not found", category: os.ErrNotExist}
 	default:
 		// Generic error for unknown cases
-		return fmt.Errorf("encryption operation failed")
+		return &sanitizedError{msg: "encryption operation failed"}
+	}
+}
+
+// sanitizedError is a user-safe error that only exposes its category.
+type sanitizedError struct {
+	msg      string
+	category error
+}
+
+func (e *sanitizedError) Error() string {
+	return e.msg
+}
+
+func (e *sanitizedError) Unwrap() error {
+	return e.category
+}
+
+// ErrorDetail controls how much context errors returned by Encryptor and
+// Decryptor carry.
+type ErrorDetail uint8
+
+const (
+	// ErrorDetailStandard returns errors with their operational context but
+	// without file paths (default).
+	ErrorDetailStandard ErrorDetail = iota
+	// ErrorDetailSanitized returns generic, user-safe messages (see SanitizeError).
+	ErrorDetailSanitized
+	// ErrorDetailVerbose returns *EncryptionError values carrying the operation,
+	// file path and chunk number for diagnostics.
+	ErrorDetailVerbose
+)
+
+// chunkError records the chunk a streaming failure occurred in. It is
+// transparent: its message and errors.Is behavior are those of the wrapped error.
+type chunkError struct {
+	chunk int
+	err   error
+}
+
+func (e *chunkError) Error() string {
+	return e.err.Error()
+}
+
+func (e *chunkError) Unwrap() error {
+	return e.err
+}
+
+// atChunk annotates err with the index of the chunk being processed.
+func atChunk(chunk int, err error) error {
+	return &chunkError{chunk: chunk, err: err}
+}
+
+// withDetail shapes err according to level for the public API boundary.
+func withDetail(level ErrorDetail, op, path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	switch level {
+	case ErrorDetailSanitized:
+		return SanitizeError(err)
+	case ErrorDetailVerbose:
+		chunk := -1
+		var ce *chunkError
+		if errors.As(err, &ce) {
+			chunk = ce.chunk
+		}
+		return NewEncryptionError(op, path, chunk, err)
+	default:
+		return err
 	}
 }
 
@@ -40,8 +139,146 @@ var (
 	ErrChunkSize       = fmt.Errorf("invalid chunk size")
 	ErrChecksum        = fmt.Errorf("checksum mismatch")
 	ErrContextCanceled = fmt.Errorf("context canceled")
+
+	// ErrAuthenticationFailed is returned when a chunk or trailer fails GCM authentication.
+	// It is the same value as format.ErrAuthenticationFailed.
+	ErrAuthenticationFailed = format.ErrAuthenticationFailed
+	// ErrWrongKey accompanies ErrAuthenticationFailed when the first authenticated
+	// record of a file cannot be opened. AES-GCM cannot tell a wrong key apart from
+	// a corrupted first chunk, but in practice this almost always means the key is wrong.
+	ErrWrongKey = fmt.Errorf("wrong key")
+	// ErrCorruptedFile is returned for malformed, truncated or tampered encrypted data.
+	// It is the same value as format.ErrCorrupted.
+	ErrCorruptedFile = format.ErrCorrupted
+	// ErrUnsupportedVersion is returned when a file uses an unknown format version.
+	ErrUnsupportedVersion = format.ErrUnsupportedVersion
+	// ErrUnsupportedFeature is returned when a file sets an incompatible header
+	// flag (such as compression) that this version cannot read.
+	ErrUnsupportedFeature = format.ErrUnsupportedFeature
+	// ErrHeaderCorrupted is returned when the header checksum written with
+	// WithHeaderCRC does not match, telling a damaged header apart from a
+	// wrong key or damaged chunks. It matches ErrCorruptedFile and is the
+	// same value as format.ErrHeaderCorrupted.
+	ErrHeaderCorrupted = format.ErrHeaderCorrupted
+	// ErrDestroyed is returned when an Encryptor or Decryptor is used after Destroy.
+	ErrDestroyed = fmt.Errorf("use of destroyed encryptor")
+	// ErrKeyExpired is returned when an Encryptor or Decryptor is used after
+	// its key expired with WithKeyContext or WithKeyDeadline. It matches
+	// ErrDestroyed.
+	ErrKeyExpired = fmt.Errorf("key expired: %w", ErrDestroyed)
+	// ErrSecretExpired is returned by DecryptString for a string sealed by
+	// EncryptString whose expiry has passed.
+	ErrSecretExpired = fmt.Errorf("secret expired")
+	// ErrKeyExhausted is returned when the configured message limit for a key
+	// has been reached; encrypt further data under a new key.
+	ErrKeyExhausted = fmt.Errorf("key usage limit reached")
+	// ErrTimeout is returned when an operation exceeds WithTimeout or a chunk
+	// exceeds WithChunkDeadline. It does not match ErrContextCanceled, so
+	// stalls can be told apart from cancellations by the caller.
+	ErrTimeout = fmt.Errorf("operation timed out")
+	// ErrNoSpace is returned when the destination disk or quota is full, either
+	// up front with WithPreallocate or in the middle of writing. The partial
+	// output file is removed.
+	ErrNoSpace = fmt.Errorf("no space left on device")
+	// ErrTooManyAttempts is returned by Unlocker when every password it was
+	// allowed to try was wrong.
+	ErrTooManyAttempts = fmt.Errorf("too many failed attempts")
+	// ErrPartMismatch is returned by JoinParts when the parts given are not
+	// the complete set of one split, in order.
+	ErrPartMismatch = fmt.Errorf("parts do not form a complete set")
+	// ErrOutputExists is returned under CollisionFail when an output name is
+	// already taken.
+	ErrOutputExists = fmt.Errorf("output already exists")
+	// ErrReadBack is returned when the output read back with WithReadBack
+	// does not match what was written.
+	ErrReadBack = fmt.Errorf("read-back verification failed")
+	// ErrAlgorithmNotAllowed is matched by the *AlgorithmError of files
+	// sealed with an algorithm the decryptor does not accept. It matches
+	// ErrUnsupportedFeature.
+	ErrAlgorithmNotAllowed = fmt.Errorf("%w: algorithm not allowed", ErrUnsupportedFeature)
+	// ErrLimitExceeded is returned when decrypting an input would exceed
+	// WithMaxChunks or WithMaxInputSize.
+	ErrLimitExceeded = fmt.Errorf("input limit exceeded")
+	// ErrSameFile is returned when the output path of EncryptFile or
+	// DecryptFile names the input file, under any name, as creating the
+	// output would truncate the input before it was read. Use
+	// EncryptFileInPlace to replace a file with its encryption.
+	ErrSameFile = fmt.Errorf("source and destination are the same file")
 )
 
+// authError classifies a GCM authentication failure. Failures on the first
+// authenticated record are reported as ErrWrongKey, later ones as ErrCorruptedFile
+// since the key has already been proven correct.
+func authError(what string, first bool) error {
+	if first {
+		return fmt.Errorf("%s: %w: %w", what, ErrAuthenticationFailed, ErrWrongKey)
+	}
+	return fmt.Errorf("%s: %w: %w", what, ErrAuthenticationFailed, ErrCorruptedFile)
+}
+
+// corruptedError wraps err as ErrCorruptedFile with context.
+func corruptedError(what string, err error) error {
+	return fmt.Errorf("%w: %s: %w", ErrCorruptedFile, what, err)
+}
+
+// readError reports a failed read of encrypted data. Short reads mean the file
+// is truncated and are reported as ErrCorruptedFile; anything else is an I/O error.
+func readError(what string, err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return corruptedError(what, io.ErrUnexpectedEOF)
+	}
+	return WrapError(what, err)
+}
+
+// canceledError reports a canceled operation. It matches both ErrContextCanceled
+// and the context's own error (context.Canceled or context.DeadlineExceeded).
+type canceledError struct {
+	cause error
+}
+
+func (e *canceledError) Error() string {
+	return e.cause.Error()
+}
+
+func (e *canceledError) Is(target error) bool {
+	return target == ErrContextCanceled
+}
+
+func (e *canceledError) Unwrap() error {
+	return e.cause
+}
+
+// contextError returns the error for a canceled ctx: the ErrTimeout cause
+// set by withDeadlines, or a canceledError.
+func contextError(ctx context.Context) error {
+	if cause := context.Cause(ctx); errors.Is(cause, ErrTimeout) {
+		return cause
+	}
+	return &canceledError{cause: ctx.Err()}
+}
+
+// AlgorithmError reports a file sealed with an algorithm outside those
+// accepted with WithAllowedAlgorithms or WithAlgorithm. It matches
+// ErrAlgorithmNotAllowed.
+type AlgorithmError struct {
+	// Algorithm is the algorithm recorded in the file header.
+	Algorithm Algorithm
+	// Allowed are the algorithms the decryptor accepts.
+	Allowed []Algorithm
+}
+
+func (e *AlgorithmError) Error() string {
+	names := make([]string, len(e.Allowed))
+	for i, alg := range e.Allowed {
+		names[i] = alg.String()
+	}
+	return fmt.Sprintf("%v: file is encrypted with %s, allowed: %s", ErrAlgorithmNotAllowed, e.Algorithm, strings.Join(names, ", "))
+}
+
+func (e *AlgorithmError) Unwrap() error {
+	return ErrAlgorithmNotAllowed
+}
+
 // EncryptionError represents an encryption/decryption error with context
 type EncryptionError struct {
 	Op       string // Operation: "encrypt", "decrypt", "generate_key", etc.
@@ -7,9 +7,11 @@
 package core
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -247,6 +249,11 @@ func TestErrorConstants(t *testing.T) {
 		{"ErrChunkSize", ErrChunkSize},
 		{"ErrChecksum", ErrChecksum},
 		{"ErrContextCanceled", ErrContextCanceled},
+		{"ErrAuthenticationFailed", ErrAuthenticationFailed},
+		{"ErrWrongKey", ErrWrongKey},
+		{"ErrCorruptedFile", ErrCorruptedFile},
+		{"ErrUnsupportedVersion", ErrUnsupportedVersion},
+		{"ErrUnsupportedFeature", ErrUnsupportedFeature},
 	}
 
 	for _, tt := range tests {
@@ -260,3 +267,80 @@ func TestErrorConstants(t *testing.T) {
 		})
 	}
 }
+
+func TestWithErrorDetail(t *testing.T) {
+	key := make([]byte, 32)
+	opt, err := WithChunkSize(8)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	enc, err := NewEncryptor(key, opt)
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+
+	tmpDir := t.TempDir()
+	srcPath := filepath.Join(tmpDir, "plain.txt")
+	encPath := filepath.Join(tmpDir, "plain.enc")
+	decPath := filepath.Join(tmpDir, "plain.dec")
+	if err := os.WriteFile(srcPath, []byte("0123456789abcdef01234567"), 0600); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+	if err := enc.EncryptFile(context.Background(), srcPath, encPath); err != nil {
+		t.Fatalf("EncryptFile failed: %v", err)
+	}
+
+	// Corrupt the third chunk (index 2): each chunk is 4 + 8 + 16 bytes.
+	data, err := os.ReadFile(encPath)
+	if err != nil {
+		t.Fatalf("failed to read encrypted file: %v", err)
+	}
+	data[HeaderSize+2*(4+8+TagSize)+10] ^= 0x01
+	if err := os.WriteFile(encPath, data, 0600); err != nil {
+		t.Fatalf("failed to write tampered file: %v", err)
+	}
+
+	decryptWith := func(level ErrorDetail) error {
+		dec, err := NewDecryptor(key, WithErrorDetail(level))
+		if err != nil {
+			t.Fatalf("NewDecryptor failed: %v", err)
+		}
+		defer dec.Destroy()
+		return dec.DecryptFile(context.Background(), encPath, decPath)
+	}
+
+	t.Run("standard", func(t *testing.T) {
+		err := decryptWith(ErrorDetailStandard)
+		if !errors.Is(err, ErrCorruptedFile) {
+			t.Fatalf("expected ErrCorruptedFile, got %v", err)
+		}
+		if strings.Contains(err.Error(), encPath) {
+			t.Errorf("standard errors must not contain the path: %v", err)
+		}
+	})
+
+	t.Run("sanitized", func(t *testing.T) {
+		err := decryptWith(ErrorDetailSanitized)
+		if err == nil || err.Error() != "corrupted encrypted file" {
+			t.Fatalf("expected sanitized message, got %v", err)
+		}
+		if !errors.Is(err, ErrCorruptedFile) {
+			t.Errorf("sanitized error should still match ErrCorruptedFile")
+		}
+	})
+
+	t.Run("verbose", func(t *testing.T) {
+		err := decryptWith(ErrorDetailVerbose)
+		var encErr *EncryptionError
+		if !errors.As(err, &encErr) {
+			t.Fatalf("expected *EncryptionError, got %T: %v", err, err)
+		}
+		if encErr.Op != "decrypt" || encErr.Path != encPath || encErr.ChunkNum != 2 {
+			t.Errorf("unexpected error context: op=%q path=%q chunk=%d", encErr.Op, encErr.Path, encErr.ChunkNum)
+		}
+		if !errors.Is(err, ErrAuthenticationFailed) {
+			t.Errorf("verbose error should still match ErrAuthenticationFailed")
+		}
+	})
+}
@@ -0,0 +1,71 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// estimate.go: Predicting the size of encrypted output
+package core
+
+import (
+	"fmt"
+
+	"github.com/gitrgoliveira/go-fileencrypt/format"
+)
+
+// EstimateEncryptedSize returns the exact size of the file or stream that
+// encrypting plaintextSize bytes with chunkSize chunks produces, so callers
+// can check quotas or show the output size before encrypting. A chunkSize of
+// 0 uses the chunk size set in opts, or DefaultChunkSize. Options that change
+// the layout, such as WithChunkIndex and WithPadding, are taken into account;
+// the options are validated as NewEncryptor would.
+func EstimateEncryptedSize(plaintextSize int64, chunkSize int, opts ...Option) (int64, error) {
+	if plaintextSize < 0 {
+		return 0, fmt.Errorf("invalid plaintext size %d", plaintextSize)
+	}
+	cfg := &Config{
+		ChunkSize: DefaultChunkSize,
+		Algorithm: AlgorithmAESGCM,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if chunkSize != 0 {
+		cfg.ChunkSize = chunkSize
+	}
+	if err := cfg.Validate(); err != nil {
+		return 0, err
+	}
+	size := fileSize(plaintextSize, cfg.ChunkSize, cfg.streamFlags(), cfg.Padding)
+	if cfg.Masking {
+		size += MaskIVSize
+	}
+	return size, nil
+}
+
+// fileSize returns the size of the encrypted form of size plaintext bytes
+// written with chunkSize chunks, the layout flags and padding.
+func fileSize(size int64, chunkSize int, flags format.Flags, padding PaddingScheme) int64 {
+	out := encryptedSize(paddedSize(padding, size), chunkSize, flags&format.FlagChunkIndex != 0)
+	header := int64(format.Header{Version: Version, Flags: flags}.Len())
+	out += header - int64(HeaderSize)
+	if flags&format.FlagBackupHeader != 0 {
+		out += header
+	}
+	if flags&format.FlagChunkDigests != 0 {
+		chunks := (paddedSize(padding, size) + int64(chunkSize) - 1) / int64(chunkSize)
+		out += chunks * format.ChunkDigestSize
+	}
+	return out
+}
+
+// encryptedSize returns the size of the encrypted form of size plaintext
+// bytes written with chunkSize chunks.
+func encryptedSize(size int64, chunkSize int, indexed bool) int64 {
+	chunks := (size + int64(chunkSize) - 1) / int64(chunkSize)
+	out := int64(HeaderSize) + chunks*(format.LengthSize+TagSize) + size + TrailerSize
+	if indexed {
+		out += format.IndexSize(uint64(chunks)) // #nosec G115 -- chunk counts are never negative
+	}
+	return out
+}
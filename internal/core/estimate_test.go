@@ -0,0 +1,89 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptedSize(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	tmpDir := t.TempDir()
+	const chunkSize = 1024
+	chunkOpt, err := WithChunkSize(chunkSize)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	for _, indexed := range []bool{false, true} {
+		enc, err := NewEncryptor(key, chunkOpt, WithChunkIndex(indexed))
+		if err != nil {
+			t.Fatalf("NewEncryptor failed: %v", err)
+		}
+		defer enc.Destroy()
+		for _, size := range []int64{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 5*chunkSize + 7} {
+			src := filepath.Join(tmpDir, "src")
+			dst := filepath.Join(tmpDir, "dst")
+			if err := os.WriteFile(src, make([]byte, size), 0600); err != nil {
+				t.Fatalf("failed to write source: %v", err)
+			}
+			if err := enc.EncryptFile(context.Background(), src, dst); err != nil {
+				t.Fatalf("EncryptFile failed: %v", err)
+			}
+			info, err := os.Stat(dst)
+			if err != nil {
+				t.Fatalf("Stat failed: %v", err)
+			}
+			if got := encryptedSize(size, chunkSize, indexed); got != info.Size() {
+				t.Errorf("size %d, indexed %v: estimated %d, actual %d", size, indexed, got, info.Size())
+			}
+		}
+	}
+}
+
+func TestEstimateEncryptedSize(t *testing.T) {
+	got, err := EstimateEncryptedSize(5000, 1024)
+	if err != nil {
+		t.Fatalf("EstimateEncryptedSize failed: %v", err)
+	}
+	if want := encryptedSize(5000, 1024, false); got != want {
+		t.Errorf("got %d, want %d", got, want)
+	}
+
+	// A zero chunk size falls back to the options, then to the default.
+	chunkOpt, err := WithChunkSize(2048)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	got, err = EstimateEncryptedSize(5000, 0, chunkOpt, WithChunkIndex(true))
+	if err != nil {
+		t.Fatalf("EstimateEncryptedSize failed: %v", err)
+	}
+	if want := encryptedSize(5000, 2048, true); got != want {
+		t.Errorf("with options: got %d, want %d", got, want)
+	}
+	got, err = EstimateEncryptedSize(0, 0)
+	if err != nil {
+		t.Fatalf("EstimateEncryptedSize failed: %v", err)
+	}
+	if want := encryptedSize(0, DefaultChunkSize, false); got != want {
+		t.Errorf("empty: got %d, want %d", got, want)
+	}
+
+	if _, err := EstimateEncryptedSize(-1, 1024); err == nil {
+		t.Error("expected error for negative size")
+	}
+	if _, err := EstimateEncryptedSize(100, MaxChunkSize+1); err == nil {
+		t.Error("expected error for oversized chunks")
+	}
+}
@@ -8,10 +8,17 @@
 package core
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/gitrgoliveira/go-fileencrypt/format"
 )
 
 func TestAlgorithmType(t *testing.T) {
@@ -147,13 +154,24 @@ func TestWithAlgorithm_Stream(t *testing.T) {
 		t.Fatal("Expected error for unsupported algorithm in EncryptStream, got nil")
 	}
 
+	// A Decryptor takes the algorithm from the file; WithAlgorithm only
+	// restricts the files it accepts.
+	aes, err := NewEncryptor(key)
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer aes.Destroy()
+	var buf bytes.Buffer
+	if err := aes.EncryptStream(ctx, strings.NewReader("data"), &buf); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
 	dec, err := NewDecryptor(key, WithAlgorithm(AlgorithmMLKEMHybrid))
 	if err != nil {
 		t.Fatalf("NewDecryptor failed: %v", err)
 	}
-	err2 := dec.DecryptStream(ctx, nil, nil)
-	if err2 == nil {
-		t.Fatal("Expected error for unsupported algorithm in DecryptStream, got nil")
+	err2 := dec.DecryptStream(ctx, &buf, io.Discard)
+	if !errors.Is(err2, ErrAlgorithmNotAllowed) {
+		t.Fatalf("DecryptStream error = %v, want ErrAlgorithmNotAllowed", err2)
 	}
 
 	t.Log("Stream APIs correctly reject unsupported algorithms")
@@ -220,3 +238,117 @@ func TestDefaultAlgorithm(t *testing.T) {
 
 	t.Log("Default algorithm (AES-256-GCM) works correctly")
 }
+
+func TestAlgorithmHeader(t *testing.T) {
+	ctx := context.Background()
+	key := make([]byte, 32)
+
+	enc, err := NewEncryptor(key)
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	var buf bytes.Buffer
+	if err := enc.EncryptStream(ctx, strings.NewReader("algorithm"), &buf); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+	h, err := format.ParseHeader(buf.Bytes())
+	if err != nil {
+		t.Fatalf("ParseHeader failed: %v", err)
+	}
+	if got := algorithmOf(h.Flags); got != AlgorithmAESGCM {
+		t.Errorf("header algorithm = %v, want %v", got, AlgorithmAESGCM)
+	}
+
+	// WithAlgorithm only restricts what a decryptor accepts.
+	dec, err := NewDecryptor(key, WithAlgorithm(AlgorithmAESGCM))
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	var out bytes.Buffer
+	if err := dec.DecryptStream(ctx, bytes.NewReader(buf.Bytes()), &out); err != nil || out.String() != "algorithm" {
+		t.Errorf("DecryptStream = %q, %v", out.String(), err)
+	}
+	if err := checkAlgorithm(h, []Algorithm{AlgorithmChaCha20Poly1305}); !errors.Is(err, ErrUnsupportedFeature) {
+		t.Errorf("checkAlgorithm with a disallowed algorithm: error = %v, want ErrUnsupportedFeature", err)
+	}
+
+	// A file sealed with an algorithm that is not implemented is refused
+	// by name before any record is opened.
+	chacha := bytes.Clone(buf.Bytes())
+	flags := binary.BigEndian.Uint32(chacha[len(MagicBytes)+1:])
+	binary.BigEndian.PutUint32(chacha[len(MagicBytes)+1:], flags|uint32(AlgorithmChaCha20Poly1305.id().Flags()))
+	err = dec.DecryptStream(ctx, bytes.NewReader(chacha), &out)
+	if !errors.Is(err, ErrUnsupportedFeature) || !strings.Contains(err.Error(), "ChaCha20-Poly1305") {
+		t.Errorf("DecryptStream of a ChaCha20-Poly1305 file: error = %v, want ErrUnsupportedFeature naming the algorithm", err)
+	}
+}
+
+func TestWithAllowedAlgorithms(t *testing.T) {
+	ctx := context.Background()
+	key := make([]byte, 32)
+
+	enc, err := NewEncryptor(key)
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	var buf bytes.Buffer
+	if err := enc.EncryptStream(ctx, strings.NewReader("policy"), &buf); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+	record, err := enc.EncryptRecord([]byte("policy"), nil)
+	if err != nil {
+		t.Fatalf("EncryptRecord failed: %v", err)
+	}
+
+	dec, err := NewDecryptor(key, WithAllowedAlgorithms([]Algorithm{AlgorithmChaCha20Poly1305, AlgorithmAESGCM}))
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	if err := dec.DecryptStream(ctx, bytes.NewReader(buf.Bytes()), io.Discard); err != nil {
+		t.Errorf("DecryptStream of an allowed algorithm failed: %v", err)
+	}
+
+	dec, err = NewDecryptor(key, WithAllowedAlgorithms([]Algorithm{AlgorithmChaCha20Poly1305}))
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	var out bytes.Buffer
+	err = dec.DecryptStream(ctx, bytes.NewReader(buf.Bytes()), &out)
+	var algErr *AlgorithmError
+	if !errors.As(err, &algErr) || !errors.Is(err, ErrAlgorithmNotAllowed) || !errors.Is(err, ErrUnsupportedFeature) {
+		t.Fatalf("DecryptStream error = %v, want *AlgorithmError", err)
+	}
+	if algErr.Algorithm != AlgorithmAESGCM || len(algErr.Allowed) != 1 || algErr.Allowed[0] != AlgorithmChaCha20Poly1305 {
+		t.Errorf("AlgorithmError = %+v", algErr)
+	}
+	if out.Len() != 0 {
+		t.Errorf("DecryptStream wrote %d bytes of a refused file", out.Len())
+	}
+	if _, err := dec.DecryptRecord(record, nil); !errors.Is(err, ErrAlgorithmNotAllowed) {
+		t.Errorf("DecryptRecord error = %v, want ErrAlgorithmNotAllowed", err)
+	}
+
+	if _, err := NewDecryptor(key, WithAllowedAlgorithms([]Algorithm{})); err == nil {
+		t.Error("NewDecryptor accepted an empty allow-list")
+	}
+
+	// The report names the algorithm of the file, not the configured one.
+	var report OperationReport
+	dec, err = NewDecryptor(key, WithAlgorithm(AlgorithmChaCha20Poly1305),
+		WithAllowedAlgorithms([]Algorithm{AlgorithmChaCha20Poly1305, AlgorithmAESGCM}), WithReport(&report))
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	if err := dec.DecryptStream(ctx, bytes.NewReader(buf.Bytes()), io.Discard); err != nil {
+		t.Fatalf("DecryptStream failed: %v", err)
+	}
+	if report.Algorithm != AlgorithmAESGCM {
+		t.Errorf("report algorithm = %s, want %s", report.Algorithm, AlgorithmAESGCM)
+	}
+}
@@ -0,0 +1,103 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// filter.go: Include/exclude filtering for batch and directory operations
+package core
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// fileFilter selects the files processed by batch and directory operations.
+type fileFilter struct {
+	include []string
+	exclude []string
+	pred    func(fs.FileInfo) bool
+}
+
+func newFileFilter(cfg *Config) (fileFilter, error) {
+	for _, pattern := range append(append([]string(nil), cfg.Include...), cfg.Exclude...) {
+		if _, err := path.Match(strings.ReplaceAll(pattern, "**", "*"), ""); err != nil {
+			return fileFilter{}, fmt.Errorf("invalid filter pattern %q: %w", pattern, err)
+		}
+	}
+	return fileFilter{include: cfg.Include, exclude: cfg.Exclude, pred: cfg.Filter}, nil
+}
+
+// excludes reports whether rel (slash-separated) matches an exclude pattern.
+// It prunes directories and symlinks before they are read or resolved.
+func (f fileFilter) excludes(rel string) bool {
+	return matchAny(f.exclude, rel)
+}
+
+// allows reports whether the file at rel (slash-separated) should be processed.
+func (f fileFilter) allows(rel string, info fs.FileInfo) bool {
+	if len(f.include) > 0 && !matchAny(f.include, rel) {
+		return false
+	}
+	if matchAny(f.exclude, rel) {
+		return false
+	}
+	return f.pred == nil || f.pred(info)
+}
+
+// allowsEntry is allows for a directory entry, statting it only when a
+// predicate needs the file info.
+func (f fileFilter) allowsEntry(rel string, d fs.DirEntry) (bool, error) {
+	if f.pred == nil {
+		return f.allows(rel, nil), nil
+	}
+	info, err := d.Info()
+	if err != nil {
+		return false, err
+	}
+	return f.allows(rel, info), nil
+}
+
+func matchAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		if matchGlob(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob matches a slash-separated path against a .gitignore-like pattern:
+// a pattern without a slash matches the base name at any depth, "**" matches
+// any number of path segments, and other segments follow path.Match.
+func matchGlob(pattern, rel string) bool {
+	pattern = strings.TrimPrefix(pattern, "/")
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
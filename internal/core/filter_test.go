@@ -0,0 +1,120 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*.tmp", "a.tmp", true},
+		{"*.tmp", "dir/sub/a.tmp", true},
+		{"*.tmp", "a.txt", false},
+		{"docs/*.md", "docs/a.md", true},
+		{"docs/*.md", "docs/sub/a.md", false},
+		{"docs/**/*.md", "docs/a.md", true},
+		{"docs/**/*.md", "docs/x/y/a.md", true},
+		{"/docs/*.md", "docs/a.md", true},
+		{"**/cache", "a/b/cache", true},
+		{"**/cache", "cache", true},
+		{"node_modules", "web/node_modules", true},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestNewEncryptor_InvalidPattern(t *testing.T) {
+	if _, err := NewEncryptor(make([]byte, 32), WithInclude("[")); err == nil {
+		t.Fatal("expected error for malformed pattern")
+	}
+}
+
+func TestEncryptDir_Filters(t *testing.T) {
+	key := make([]byte, 32)
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	encDir := filepath.Join(tmpDir, "enc")
+	writeTree(t, srcDir, map[string][]byte{
+		"keep.txt":          []byte("keep this file"),
+		"small.txt":         []byte("x"),
+		"scratch.tmp":       []byte("temporary data"),
+		"build/out.txt":     []byte("build output"),
+		"notes/readme.md":   []byte("markdown notes"),
+		"notes/draft.txt":   []byte("draft notes here"),
+		"notes/old/old.txt": []byte("archived notes"),
+	})
+
+	enc, err := NewEncryptor(key,
+		WithInclude("*.txt", "*.md"),
+		WithExclude("*.tmp", "build", "notes/old"),
+		WithFilter(func(info fs.FileInfo) bool { return info.Size() > 1 }),
+	)
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	if err := enc.EncryptDir(context.Background(), srcDir, encDir); err != nil {
+		t.Fatalf("EncryptDir failed: %v", err)
+	}
+
+	want := map[string]bool{
+		"keep.txt":          true,
+		"small.txt":         false,
+		"scratch.tmp":       false,
+		"build/out.txt":     false,
+		"notes/readme.md":   true,
+		"notes/draft.txt":   true,
+		"notes/old/old.txt": false,
+	}
+	for name, present := range want {
+		_, err := os.Stat(filepath.Join(encDir, filepath.FromSlash(name)) + EncryptedFileSuffix)
+		if present && err != nil {
+			t.Errorf("%s: expected encrypted file: %v", name, err)
+		}
+		if !present && err == nil {
+			t.Errorf("%s: expected file to be filtered out", name)
+		}
+	}
+}
+
+func TestEncryptFiles_Filters(t *testing.T) {
+	key := make([]byte, 32)
+	tmpDir := t.TempDir()
+	writeTree(t, tmpDir, map[string][]byte{"a.txt": []byte("alpha"), "b.tmp": []byte("beta")})
+
+	enc, err := NewEncryptor(key, WithExclude("*.tmp"))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+
+	results := enc.EncryptFiles(context.Background(), []BatchItem{
+		{Src: filepath.Join(tmpDir, "a.txt"), Dst: filepath.Join(tmpDir, "a.txt.enc")},
+		{Src: filepath.Join(tmpDir, "b.tmp"), Dst: filepath.Join(tmpDir, "b.tmp.enc")},
+	})
+	if results[0].Err != nil || results[0].Skipped {
+		t.Errorf("a.txt: expected to be encrypted, got %+v", results[0])
+	}
+	if !results[1].Skipped || results[1].Err != nil {
+		t.Errorf("b.tmp: expected to be skipped, got %+v", results[1])
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "b.tmp.enc")); err == nil {
+		t.Error("skipped item was encrypted")
+	}
+}
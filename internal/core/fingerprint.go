@@ -0,0 +1,72 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// fingerprint.go: Identifying keys without revealing them
+package core
+
+import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+)
+
+// keyIDInfo separates the key fingerprint from the keys derived for files,
+// manifests and names.
+const keyIDInfo = "go-fileencrypt key id v1"
+
+// KeyFingerprintSize is the length of a key fingerprint in hex characters.
+const KeyFingerprintSize = 16
+
+// KeyFingerprint returns a short, stable identifier of key: 16 hex
+// characters derived from it with HKDF-SHA256. It tells operators which key
+// a file, log line or audit event refers to without exposing the key, and is
+// the KeyID of audit events. 64 bits are enough to tell apart the keys of an
+// installation, not to resist an attacker searching for a collision, so a
+// matching fingerprint identifies a key but does not authenticate it.
+func KeyFingerprint(key []byte) (string, error) {
+	if len(key) == 0 {
+		return "", fmt.Errorf("%w: empty key", ErrInvalidKey)
+	}
+	id, err := hkdf.Key(sha256.New, key, nil, keyIDInfo, KeyFingerprintSize/2)
+	if err != nil {
+		return "", WrapError("derive key fingerprint", err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// KeyFingerprintMatches reports whether fingerprint is the fingerprint of
+// key, comparing in constant time.
+func KeyFingerprintMatches(key []byte, fingerprint string) bool {
+	id, err := KeyFingerprint(key)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(id), []byte(fingerprint)) == 1
+}
+
+// KeyFingerprint returns the fingerprint of the encryptor's key, or
+// ErrDestroyed after Destroy.
+func (e *Encryptor) KeyFingerprint() (string, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.destroyed {
+		return "", e.errDestroyed()
+	}
+	return KeyFingerprint(e.keyBuf.Data())
+}
+
+// KeyFingerprint returns the fingerprint of the decryptor's key, or
+// ErrDestroyed after Destroy.
+func (d *Decryptor) KeyFingerprint() (string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.destroyed {
+		return "", d.errDestroyed()
+	}
+	return KeyFingerprint(d.keyBuf.Data())
+}
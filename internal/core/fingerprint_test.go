@@ -0,0 +1,71 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// fingerprint_test.go: Tests for key fingerprints
+package core
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestKeyFingerprint(t *testing.T) {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	fp, err := KeyFingerprint(key)
+	if err != nil {
+		t.Fatalf("KeyFingerprint failed: %v", err)
+	}
+	if len(fp) != KeyFingerprintSize {
+		t.Fatalf("fingerprint %q has %d characters, want %d", fp, len(fp), KeyFingerprintSize)
+	}
+	// The fingerprint is part of audit trails, so it must never change.
+	if want := "20c5fc2170d4389d"; fp != want {
+		t.Errorf("fingerprint %s, want %s", fp, want)
+	}
+	if !KeyFingerprintMatches(key, fp) || KeyFingerprintMatches(key, strings.ToUpper(fp)) || KeyFingerprintMatches(nil, fp) {
+		t.Error("KeyFingerprintMatches gave a wrong answer")
+	}
+	other := append([]byte(nil), key...)
+	other[31] ^= 1
+	if KeyFingerprintMatches(other, fp) {
+		t.Error("a different key matches the fingerprint")
+	}
+	if _, err := KeyFingerprint(nil); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("KeyFingerprint(nil) = %v, want ErrInvalidKey", err)
+	}
+
+	// Encryptors, decryptors and audit events report the same fingerprint.
+	var events []AuditEvent
+	enc, err := NewEncryptor(key, WithAuditSink(AuditFunc(func(e AuditEvent) { events = append(events, e) })))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	if got, err := enc.KeyFingerprint(); err != nil || got != fp {
+		t.Errorf("Encryptor.KeyFingerprint = %q, %v, want %q", got, err, fp)
+	}
+	if got, err := dec.KeyFingerprint(); err != nil || got != fp {
+		t.Errorf("Decryptor.KeyFingerprint = %q, %v, want %q", got, err, fp)
+	}
+	if _, err := enc.EncryptRecord([]byte("x"), nil); err != nil {
+		t.Fatalf("EncryptRecord failed: %v", err)
+	}
+	if len(events) != 1 || events[0].KeyID != fp {
+		t.Errorf("audit events %+v, want one with KeyID %q", events, fp)
+	}
+	enc.Destroy()
+	if _, err := enc.KeyFingerprint(); !errors.Is(err, ErrDestroyed) {
+		t.Errorf("KeyFingerprint after Destroy = %v, want ErrDestroyed", err)
+	}
+}
@@ -7,16 +7,87 @@
 // format.go: File format constants and algorithm ID support for go-fileencrypt
 package core
 
+import (
+	"fmt"
+	"slices"
+
+	"github.com/gitrgoliveira/go-fileencrypt/format"
+)
+
+// The layout constants are defined by the public format package.
 const (
 	// MagicBytes is the file signature "GFE" (Go File Encrypt).
-	MagicBytes = "GFE"
-	// Version is the current file format version (1).
-	Version = 1
+	MagicBytes = format.Magic
+	// Version is the current file format version (2).
+	Version = format.Version
+	// VersionV1 is the legacy file format version without an end-of-stream trailer.
+	VersionV1 = format.VersionV1
 	// NonceSize is the size of the nonce for AES-GCM.
-	NonceSize = 12
+	NonceSize = format.NonceSize
+	// TagSize is the size of the GCM authentication tag appended to every sealed record.
+	TagSize = format.TagSize
 	// HeaderSize is the total size of the file header.
-	// File format: [3 bytes magic][1 byte version][12 bytes nonce][8 bytes file size][chunks...]
-	HeaderSize = len(MagicBytes) + 1 + NonceSize + 8
+	// File format: [3 bytes magic][1 byte version][4 bytes flags][12 bytes nonce][8 bytes file size][chunks...][trailer]
+	HeaderSize = format.HeaderSize
+	// HeaderSizeV1 is the size of the legacy v1 header, which has no flags.
+	HeaderSizeV1 = format.HeaderSizeV1
 	// MaxChunkSize is the maximum size for a single chunk of data.
-	MaxChunkSize = 10 * 1024 * 1024
+	MaxChunkSize = format.MaxChunkSize
+	// TrailerPayloadSize is the plaintext size of the v2 trailer:
+	// [8 bytes total plaintext size][8 bytes chunk count].
+	TrailerPayloadSize = format.TrailerPayloadSize
+	// TrailerSize is the on-disk size of the v2 end-of-stream trailer:
+	// [4 bytes end marker (0)][sealed trailer payload + tag].
+	TrailerSize = format.TrailerSize
 )
+
+// headerFlags are the capability flags set on every file this package writes.
+// WithChunkIndex adds format.FlagChunkIndex.
+const headerFlags = format.FlagTrailer | format.FlagHeaderAAD
+
+// supportedFlags are the incompatible header flags this package can read.
+// Files using any other incompatible flag fail with ErrUnsupportedFeature;
+// unknown compatible flags are ignored. Only the chunk stream readers remove
+// padding, so the other readers check for unpaddedFlags instead.
+const supportedFlags = format.FlagTrailer | format.FlagHeaderAAD | format.FlagChunkIndex | format.FlagPadded | format.FlagBackupHeader | format.FlagHeaderCRC | format.FlagChunkDigests | format.FlagPart
+
+// unpaddedFlags are supportedFlags without format.FlagPadded.
+const unpaddedFlags = supportedFlags &^ format.FlagPadded
+
+// basicFlags are unpaddedFlags without the layout flags logs and records
+// never carry.
+const basicFlags = unpaddedFlags &^ (format.FlagBackupHeader | format.FlagHeaderCRC | format.FlagChunkDigests | format.FlagPart)
+
+// id returns the format.AlgorithmID recording a in file headers.
+func (a Algorithm) id() format.AlgorithmID {
+	return format.AlgorithmID(a - 1)
+}
+
+// algorithmOf returns the algorithm recorded in the header flags f.
+func algorithmOf(f format.Flags) Algorithm {
+	return Algorithm(f.Algorithm()) + 1
+}
+
+// checkAlgorithm returns an *AlgorithmError if the file with header h is
+// sealed with an algorithm outside allowed, and ErrUnsupportedFeature if
+// this package does not implement it. A nil allowed accepts every
+// algorithm. The decision rests on the file, not on WithAlgorithm.
+func checkAlgorithm(h format.Header, allowed []Algorithm) error {
+	alg := algorithmOf(h.Flags)
+	if allowed != nil && !slices.Contains(allowed, alg) {
+		return &AlgorithmError{Algorithm: alg, Allowed: allowed}
+	}
+	if !alg.IsSupported() {
+		return fmt.Errorf("%w: unsupported algorithm: %s (only AES-256-GCM is currently supported)", ErrUnsupportedFeature, alg)
+	}
+	return nil
+}
+
+// checkAlgorithms reports whether allowed is a usable allow-list: one that
+// is unset or names at least one algorithm.
+func checkAlgorithms(allowed []Algorithm) error {
+	if allowed != nil && len(allowed) == 0 {
+		return fmt.Errorf("invalid allowed algorithms: at least one algorithm is required")
+	}
+	return nil
+}
@@ -7,17 +7,120 @@
 package core
 
 import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
 	"testing"
+
+	"github.com/gitrgoliveira/go-fileencrypt/format"
 )
 
 func TestFormatConstants(t *testing.T) {
 	if NonceSize != 12 {
 		t.Fatalf("unexpected NonceSize: %d", NonceSize)
 	}
-	if HeaderSize != len(MagicBytes)+1+NonceSize+8 {
+	if HeaderSize != len(MagicBytes)+1+4+NonceSize+8 {
 		t.Fatalf("unexpected HeaderSize: %d", HeaderSize)
 	}
+	if HeaderSizeV1 != len(MagicBytes)+1+NonceSize+8 {
+		t.Fatalf("unexpected HeaderSizeV1: %d", HeaderSizeV1)
+	}
 	if MaxChunkSize <= 0 {
 		t.Fatalf("MaxChunkSize must be positive")
 	}
 }
+
+// sealWithFlags encrypts data as a single-chunk v2 stream whose header sets
+// flags, as a writer supporting other features would.
+func sealWithFlags(t *testing.T, key, data []byte, flags format.Flags) []byte {
+	t.Helper()
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatalf("aes.NewCipher failed: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatalf("cipher.NewGCM failed: %v", err)
+	}
+	h := format.Header{Version: Version, Flags: flags, Size: uint64(len(data))}
+	if _, err := rand.Read(h.Nonce[:]); err != nil {
+		t.Fatalf("failed to generate nonce: %v", err)
+	}
+	out := h.Marshal()
+	out = binary.BigEndian.AppendUint32(out, uint32(len(data)+TagSize))
+	out = gcm.Seal(out, h.ChunkNonce(0), data, h.AAD())
+	if h.HasTrailer() {
+		out = append(out, format.Trailer{Size: uint64(len(data)), Chunks: 1}.Seal(gcm, h)...)
+	}
+	return out
+}
+
+func TestHeaderFlags_Negotiation(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	data := []byte("capability flags")
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+
+	tests := []struct {
+		name   string
+		flags  format.Flags
+		target error
+	}{
+		{"current", headerFlags, nil},
+		{"unknown compatible flag", headerFlags | 1<<3, nil},
+		{"no trailer", format.FlagHeaderAAD, nil},
+		{"compressed", headerFlags | format.FlagCompressed, ErrUnsupportedFeature},
+		{"unknown incompatible flag", headerFlags | 1<<30, ErrUnsupportedFeature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := dec.DecryptStream(context.Background(), bytes.NewReader(sealWithFlags(t, key, data, tt.flags)), &out)
+			if tt.target == nil {
+				if err != nil {
+					t.Fatalf("DecryptStream failed: %v", err)
+				}
+				if !bytes.Equal(out.Bytes(), data) {
+					t.Fatal("decrypted data does not match")
+				}
+				return
+			}
+			if !errors.Is(err, tt.target) {
+				t.Fatalf("expected %v, got %v", tt.target, err)
+			}
+			if out.Len() != 0 {
+				t.Error("data was written for an unsupported file")
+			}
+		})
+	}
+}
+
+func TestHeaderFlags_Authenticated(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	ciphertext := sealWithFlags(t, key, []byte("capability flags"), headerFlags)
+	// Clearing FlagHeaderAAD (or any other flag) must not go unnoticed.
+	ciphertext[len(MagicBytes)+2] &^= byte(format.FlagHeaderAAD >> 16)
+
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	err = dec.DecryptStream(context.Background(), bytes.NewReader(ciphertext), &bytes.Buffer{})
+	if !errors.Is(err, ErrAuthenticationFailed) {
+		t.Fatalf("expected ErrAuthenticationFailed, got %v", err)
+	}
+}
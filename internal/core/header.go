@@ -0,0 +1,133 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// header.go: Reading and validating stream headers
+package core
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/gitrgoliveira/go-fileencrypt/format"
+)
+
+// maxHeaderSize is the largest encoded header: a version 2 header with a
+// checksum and a part descriptor.
+const maxHeaderSize = HeaderSize + format.HeaderCRCSize + format.PartSize
+
+// headerCRCTable is the CRC-32C table of format.FlagHeaderCRC checksums.
+var headerCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// headerBuf holds an encoded header while it is read and parsed.
+type headerBuf [maxHeaderSize]byte
+
+// readHeader reads the header at the start of src into buf and returns it
+// parsed together with its encoded bytes, which alias buf. The fields shared
+// by every version are read in one call and the version and flag dependent
+// remainder in at most three more, so no read stops inside a field and nothing
+// is allocated.
+func readHeader(src io.Reader, buf *headerBuf) (format.Header, []byte, error) {
+	n, err := io.ReadFull(src, buf[:HeaderSizeV1])
+	if err != nil {
+		// A short file that does not start like a header is reported as
+		// such rather than as truncated.
+		if n >= len(MagicBytes)+1 {
+			if _, perr := parseHeader(buf[:n]); !errors.Is(perr, io.ErrUnexpectedEOF) {
+				return format.Header{}, nil, perr
+			}
+		}
+		return format.Header{}, nil, readError("read header", err)
+	}
+	if buf[len(MagicBytes)] == byte(Version) {
+		if _, err := io.ReadFull(src, buf[n:HeaderSize]); err != nil {
+			return format.Header{}, nil, readError("read header", err)
+		}
+		n = HeaderSize
+		flags := format.Flags(binary.BigEndian.Uint32(buf[len(MagicBytes)+1:]))
+		if flags&format.FlagHeaderCRC != 0 {
+			if _, err := io.ReadFull(src, buf[n:n+format.HeaderCRCSize]); err != nil {
+				return format.Header{}, nil, readError("read header checksum", err)
+			}
+			n += format.HeaderCRCSize
+		}
+		if flags&format.FlagPart != 0 {
+			if _, err := io.ReadFull(src, buf[n:n+format.PartSize]); err != nil {
+				return format.Header{}, nil, readError("read part", err)
+			}
+			n += format.PartSize
+		}
+	}
+	h, err := parseHeader(buf[:n])
+	if err != nil {
+		return format.Header{}, nil, err
+	}
+	return h, buf[:n], nil
+}
+
+// parseHeader parses an encoded header without allocating. Every check is
+// computed before any of them is acted on, and the magic bytes and checksum
+// are compared in constant time, so the work done does not depend on which
+// header bytes are wrong. A checksum mismatch is reported before the other
+// fields are trusted, so a damaged header is not mistaken for an unsupported
+// version or feature.
+func parseHeader(b []byte) (format.Header, error) {
+	if len(b) < len(MagicBytes)+1 {
+		return format.Header{}, readError("read header", io.ErrUnexpectedEOF)
+	}
+	var h format.Header
+	h.Version = b[len(MagicBytes)]
+	magicOK := subtle.ConstantTimeCompare(b[:len(MagicBytes)], []byte(MagicBytes))
+	versionOK := subtle.ConstantTimeByteEq(h.Version, byte(Version)) | subtle.ConstantTimeByteEq(h.Version, byte(VersionV1))
+
+	crcOK, sizeOK, partOK := 1, 1, 1
+	if magicOK&versionOK == 1 {
+		if len(b) < h.Len() {
+			return format.Header{}, readError("read header", io.ErrUnexpectedEOF)
+		}
+		fields := b[len(MagicBytes)+1:]
+		if h.Version == byte(Version) {
+			h.Flags = format.Flags(binary.BigEndian.Uint32(fields))
+			fields = fields[format.FlagsSize:]
+			if len(b) < h.Len() {
+				return format.Header{}, readError("read header", io.ErrUnexpectedEOF)
+			}
+		}
+		copy(h.Nonce[:], fields)
+		h.Size = binary.BigEndian.Uint64(fields[NonceSize:])
+		if h.Flags&format.FlagHeaderCRC != 0 {
+			sum := crc32.Checksum(b[:HeaderSize], headerCRCTable)
+			crcOK = subtle.ConstantTimeEq(int32(sum), int32(binary.BigEndian.Uint32(b[HeaderSize:]))) // #nosec G115 -- bit-for-bit comparison
+		}
+		sizeOK = int(h.Size>>63) ^ 1 // sizes must fit in an int64
+		if h.Flags&format.FlagPart != 0 {
+			part := b[h.Len()-format.PartSize : h.Len()]
+			copy(h.Part.Set[:], part)
+			h.Part.Index = binary.BigEndian.Uint32(part[16:])
+			h.Part.Count = binary.BigEndian.Uint32(part[20:])
+			if h.Part.Index >= h.Part.Count {
+				partOK = 0
+			}
+		}
+	}
+
+	switch {
+	case magicOK == 0:
+		return format.Header{}, fmt.Errorf("%w: invalid file format: expected magic bytes %q, got %q", ErrCorruptedFile, MagicBytes, b[:len(MagicBytes)])
+	case crcOK == 0:
+		return format.Header{}, ErrHeaderCorrupted
+	case versionOK == 0:
+		return format.Header{}, fmt.Errorf("%w: expected %d or %d, got %d", ErrUnsupportedVersion, VersionV1, Version, h.Version)
+	case sizeOK == 0:
+		return format.Header{}, fmt.Errorf("%w: invalid file format: size %d out of range", ErrCorruptedFile, h.Size)
+	case partOK == 0:
+		return format.Header{}, fmt.Errorf("%w: invalid file format: part %d of %d", ErrCorruptedFile, h.Part.Index, h.Part.Count)
+	}
+	return h, nil
+}
@@ -0,0 +1,79 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/gitrgoliveira/go-fileencrypt/format"
+)
+
+func TestReadHeader(t *testing.T) {
+	h := format.Header{Version: byte(Version), Flags: format.FlagTrailer | format.FlagHeaderCRC, Size: 12345}
+	for i := range h.Nonce {
+		h.Nonce[i] = byte(i)
+	}
+	v1 := format.Header{Version: byte(VersionV1), Nonce: h.Nonce, Size: 99}
+
+	for _, want := range []format.Header{h, v1, {Version: byte(Version), Flags: format.FlagTrailer, Nonce: h.Nonce}} {
+		encoded := want.Marshal()
+		var buf headerBuf
+		got, header, err := readHeader(bytes.NewReader(append(bytes.Clone(encoded), 0, 0, 0, 0)), &buf)
+		if err != nil {
+			t.Fatalf("readHeader(version %d, flags %v) failed: %v", want.Version, want.Flags, err)
+		}
+		if got != want || !bytes.Equal(header, encoded) {
+			t.Errorf("readHeader = %+v, %x; want %+v, %x", got, header, want, encoded)
+		}
+	}
+
+	encoded := h.Marshal()
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := parseHeader(encoded); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("parseHeader allocated %v times, want 0", allocs)
+	}
+
+	damaged := func(off int, b byte) []byte {
+		d := bytes.Clone(encoded)
+		d[off] = b
+		return d
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, ErrCorruptedFile},
+		{"short magic", []byte("GF"), ErrCorruptedFile},
+		{"short garbage", []byte("PK\x03\x04 not encrypted"), ErrCorruptedFile},
+		{"bad magic", damaged(0, 'X'), ErrCorruptedFile},
+		{"bad version", damaged(3, 9), ErrUnsupportedVersion},
+		{"truncated", encoded[:HeaderSize-3], ErrCorruptedFile},
+		{"truncated checksum", encoded[:HeaderSize+2], ErrCorruptedFile},
+		{"bad checksum", damaged(HeaderSize, encoded[HeaderSize]^1), ErrHeaderCorrupted},
+		{"damaged size", damaged(HeaderSize-8, 0x80), ErrHeaderCorrupted},
+	}
+	for _, tt := range tests {
+		var buf headerBuf
+		_, _, err := readHeader(bytes.NewReader(tt.data), &buf)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: readHeader error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	// Without a checksum an out-of-range size is still rejected.
+	big := format.Header{Version: byte(Version), Size: 1 << 63}
+	if _, err := parseHeader(big.Marshal()); !errors.Is(err, ErrCorruptedFile) {
+		t.Errorf("parseHeader with size 2^63 = %v, want ErrCorruptedFile", err)
+	}
+}
@@ -0,0 +1,133 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gitrgoliveira/go-fileencrypt/format"
+)
+
+func TestWithHeaderCRC_Triage(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	chunkOpt, err := WithChunkSize(1024)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	opts := []Option{chunkOpt, WithHeaderCRC(true), WithChunkIndex(true), WithBackupHeader(true)}
+	enc, err := NewEncryptor(key, opts...)
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+
+	data := make([]byte, 5000)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("failed to generate data: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := enc.EncryptStream(context.Background(), bytes.NewReader(data), &buf, int64(len(data))); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+	ciphertext := buf.Bytes()
+	const headerLen = HeaderSize + format.HeaderCRCSize
+
+	h, err := format.ParseHeader(ciphertext)
+	if err != nil {
+		t.Fatalf("ParseHeader failed: %v", err)
+	}
+	if h.Flags&format.FlagHeaderCRC == 0 || h.Len() != headerLen {
+		t.Fatalf("header flags %v, length %d: want header-crc and %d bytes", h.Flags, h.Len(), headerLen)
+	}
+	want, err := EstimateEncryptedSize(int64(len(data)), 0, opts...)
+	if err != nil {
+		t.Fatalf("EstimateEncryptedSize failed: %v", err)
+	}
+	if int64(len(ciphertext)) != want {
+		t.Errorf("encrypted size = %d, want %d", len(ciphertext), want)
+	}
+
+	var out bytes.Buffer
+	if err := dec.DecryptStream(context.Background(), bytes.NewReader(ciphertext), &out); err != nil {
+		t.Fatalf("DecryptStream failed: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Fatal("decrypted data does not match")
+	}
+	r, err := dec.NewIndexedReader(bytes.NewReader(ciphertext), int64(len(ciphertext)))
+	if err != nil {
+		t.Fatalf("NewIndexedReader failed: %v", err)
+	}
+	part := make([]byte, 100)
+	if _, err := r.ReadAt(part, 4000); err != nil || !bytes.Equal(part, data[4000:4100]) {
+		t.Errorf("indexed read failed: %v", err)
+	}
+
+	decrypt := func(d *Decryptor, ciphertext []byte) error {
+		return d.DecryptStream(context.Background(), bytes.NewReader(ciphertext), io.Discard)
+	}
+	damage := func(offset int) []byte {
+		damaged := bytes.Clone(ciphertext)
+		damaged[offset] ^= 0x01
+		return damaged
+	}
+
+	// Flags (including a flip to an unknown incompatible flag), nonce, size
+	// and the checksum itself.
+	for _, off := range []int{4, 5, 10, 25, headerLen - 1} {
+		err := decrypt(dec, damage(off))
+		if !errors.Is(err, ErrHeaderCorrupted) || !errors.Is(err, ErrCorruptedFile) || errors.Is(err, ErrWrongKey) {
+			t.Errorf("header byte %d damaged: expected ErrHeaderCorrupted, got %v", off, err)
+		}
+		if !errors.Is(SanitizeError(err), ErrHeaderCorrupted) {
+			t.Errorf("header byte %d damaged: sanitized error %v lost its category", off, SanitizeError(err))
+		}
+	}
+
+	otherKey := make([]byte, 32)
+	if _, err := rand.Read(otherKey); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	other, err := NewDecryptor(otherKey)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer other.Destroy()
+	if err := decrypt(other, ciphertext); !errors.Is(err, ErrWrongKey) || errors.Is(err, ErrHeaderCorrupted) {
+		t.Errorf("wrong key: expected ErrWrongKey, got %v", err)
+	}
+
+	// Damage to the second chunk is neither a header problem nor a wrong key.
+	err = decrypt(dec, damage(headerLen+format.LengthSize+1024+TagSize+10))
+	if !errors.Is(err, ErrCorruptedFile) || errors.Is(err, ErrHeaderCorrupted) || errors.Is(err, ErrWrongKey) {
+		t.Errorf("chunk damaged: expected ErrCorruptedFile, got %v", err)
+	}
+
+	// Files still recover a damaged header from the backup copy.
+	path := filepath.Join(t.TempDir(), "damaged.enc")
+	if err := os.WriteFile(path, damage(10), 0o600); err != nil {
+		t.Fatalf("failed to write damaged file: %v", err)
+	}
+	if err := dec.VerifyFile(context.Background(), path); err != nil {
+		t.Errorf("VerifyFile with a damaged header and a backup failed: %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// index.go: Random access to files encrypted with a chunk index
+package core
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/gitrgoliveira/go-fileencrypt/format"
+)
+
+// IndexedReader provides random access to the plaintext of a file encrypted
+// with WithChunkIndex. It implements io.ReaderAt; wrap it with
+// io.NewSectionReader(r, 0, r.Size()) for an io.ReadSeeker.
+//
+// Every chunk is authenticated before any of its plaintext is returned, and
+// the index and trailer are authenticated when the reader is created, so a
+// truncated or reordered file is rejected up front. It is safe for concurrent
+// use and keeps working if the Decryptor is destroyed.
+type IndexedReader struct {
+	src       io.ReaderAt
+	gcm       cipher.AEAD
+	header    format.Header
+	aad       []byte
+	entries   []format.IndexEntry
+	starts    []int64 // plaintext offset of each chunk
+	size      int64
+	chunkSize int64 // plaintext size of every chunk but the last, or 0 if they differ
+	errDetail ErrorDetail
+
+	mu     sync.Mutex
+	cached int // chunk held in plain, or -1
+	plain  []byte
+	sealed []byte
+}
+
+// NewIndexedReader reads the header, chunk index and trailer of the encrypted
+// file src of size bytes and returns a reader of its plaintext. Files without
+// a chunk index fail with ErrUnsupportedFeature.
+func (d *Decryptor) NewIndexedReader(src io.ReaderAt, size int64) (*IndexedReader, error) {
+	r, err := d.newIndexedReader(src, size)
+	return r, withDetail(d.errDetail, "decrypt", "stream", err)
+}
+
+func (d *Decryptor) newIndexedReader(src io.ReaderAt, size int64) (*IndexedReader, error) {
+	gcm, err := d.newAEAD()
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := format.ReadHeader(io.NewSectionReader(src, 0, size))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAlgorithm(h, d.algorithms); err != nil {
+		return nil, err
+	}
+	if err := h.Flags.Check(unpaddedFlags); err != nil {
+		return nil, err
+	}
+	if h.Flags&format.FlagChunkIndex == 0 || !h.HasTrailer() {
+		return nil, fmt.Errorf("%w: file has no chunk index", ErrUnsupportedFeature)
+	}
+	aad := h.AAD()
+	if h.Flags&format.FlagBackupHeader != 0 {
+		size -= int64(h.Len())
+		backup := make([]byte, h.Len())
+		if _, err := src.ReadAt(backup, size); err != nil {
+			return nil, readError("read backup header", err)
+		}
+		if !bytes.Equal(backup, h.Marshal()) {
+			return nil, fmt.Errorf("%w: backup header does not match the header", ErrCorruptedFile)
+		}
+	}
+
+	// The sealed trailer is the last record and records the chunk count,
+	// which gives the size and position of the index in front of it.
+	if size < int64(h.Len())+TrailerSize+TagSize {
+		return nil, fmt.Errorf("%w: file is %d bytes, too short for a chunk index", ErrCorruptedFile, size)
+	}
+	trailer := make([]byte, TrailerSize-format.LengthSize)
+	if _, err := src.ReadAt(trailer, size-int64(len(trailer))); err != nil {
+		return nil, readError("read trailer", err)
+	}
+	total, chunks, err := openTrailer(gcm, h.Nonce[:], aad, trailer)
+	if err != nil {
+		return nil, authError("decrypt trailer", true)
+	}
+	if chunks > uint64(size)/(format.LengthSize+TagSize) {
+		return nil, fmt.Errorf("%w: trailer records %d chunks in %d bytes", ErrCorruptedFile, chunks, size)
+	}
+	indexEnd := size - int64(len(trailer))
+	indexStart := indexEnd - h.IndexSize(chunks)
+	if indexStart-format.LengthSize < int64(h.Len()) {
+		return nil, fmt.Errorf("%w: chunk index of %d chunks does not fit in %d bytes", ErrCorruptedFile, chunks, size)
+	}
+	sealed := make([]byte, indexEnd-indexStart+format.LengthSize)
+	if _, err := src.ReadAt(sealed, indexStart-format.LengthSize); err != nil {
+		return nil, readError("read chunk index", err)
+	}
+	if binary.BigEndian.Uint32(sealed) != 0 {
+		return nil, fmt.Errorf("%w: missing end marker before chunk index", ErrCorruptedFile)
+	}
+	entries, err := format.OpenIndex(gcm, h, sealed[format.LengthSize:])
+	if err != nil {
+		return nil, err
+	}
+
+	r := &IndexedReader{
+		src:       src,
+		gcm:       gcm,
+		header:    h,
+		aad:       aad,
+		entries:   entries,
+		starts:    make([]int64, len(entries)),
+		errDetail: d.errDetail,
+		cached:    -1,
+	}
+	end := int64(h.Len())
+	for i, e := range entries {
+		r.starts[i] = r.size
+		n := int64(e.Length) - TagSize
+		if d.maxChunk > 0 && n > int64(d.maxChunk) {
+			return nil, atChunk(i, fmt.Errorf("%w: record of %d bytes exceeds the limit of %d", ErrChunkSize, n, d.maxChunk))
+		}
+		r.size += n
+		end = e.Offset + format.LengthSize + int64(e.Length)
+		if i == 0 {
+			r.chunkSize = n
+		} else if r.chunkSize != r.starts[i]-r.starts[i-1] {
+			r.chunkSize = 0
+		}
+	}
+	if end != indexStart-format.LengthSize {
+		return nil, fmt.Errorf("%w: chunk index ends at offset %d, end marker is at %d", ErrCorruptedFile, end, indexStart-format.LengthSize)
+	}
+	if r.size != total || (h.Size > 0 && uint64(r.size) != h.Size) {
+		return nil, fmt.Errorf("%w: chunk index records %d bytes, trailer records %d", ErrCorruptedFile, r.size, total)
+	}
+	return r, nil
+}
+
+// Size returns the plaintext size.
+func (r *IndexedReader) Size() int64 {
+	return r.size
+}
+
+// ReadAt reads len(p) plaintext bytes starting at off, decrypting only the
+// chunks that overlap them.
+func (r *IndexedReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for n < len(p) && off < r.size {
+		i := r.chunkAt(off)
+		if err := r.load(i); err != nil {
+			return n, withDetail(r.errDetail, "decrypt", "stream", atChunk(i, err))
+		}
+		c := copy(p[n:], r.plain[off-r.starts[i]:])
+		n += c
+		off += int64(c)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// chunkAt returns the index of the chunk holding plaintext offset off.
+func (r *IndexedReader) chunkAt(off int64) int {
+	if r.chunkSize > 0 {
+		return min(int(off/r.chunkSize), len(r.starts)-1)
+	}
+	return sort.Search(len(r.starts), func(i int) bool { return r.starts[i] > off }) - 1
+}
+
+// load decrypts chunk i into r.plain unless it is already there.
+func (r *IndexedReader) load(i int) error {
+	if r.cached == i {
+		return nil
+	}
+	e := r.entries[i]
+	record := int(format.LengthSize + e.Length)
+	if cap(r.sealed) < record {
+		r.sealed = make([]byte, record)
+	}
+	buf := r.sealed[:record]
+	if _, err := r.src.ReadAt(buf, e.Offset); err != nil {
+		return readError("read encrypted chunk", err)
+	}
+	if binary.BigEndian.Uint32(buf) != e.Length {
+		return fmt.Errorf("%w: chunk length %d does not match the index", ErrCorruptedFile, binary.BigEndian.Uint32(buf))
+	}
+	r.cached = -1
+	plain, err := r.gcm.Open(r.plain[:0], r.header.ChunkNonce(uint32(i)), buf[format.LengthSize:], r.aad) // #nosec G115 -- i is bounded by the 32-bit chunk counter
+	if err != nil {
+		return authError(fmt.Sprintf("decrypt chunk %d", i), false)
+	}
+	r.plain = plain
+	r.cached = i
+	return nil
+}
@@ -0,0 +1,161 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+// encryptIndexed encrypts data with a chunk index, reading it through src.
+func encryptIndexed(t *testing.T, key []byte, src io.Reader, chunkSize int) []byte {
+	t.Helper()
+	opt, err := WithChunkSize(chunkSize)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	enc, err := NewEncryptor(key, opt, WithChunkIndex(true))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	var buf bytes.Buffer
+	if err := enc.EncryptStream(context.Background(), src, &buf); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestIndexedReader_ReadAt(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+
+	for _, size := range []int{0, 1, 100, 1000, 1001, 5000} {
+		data := make([]byte, size)
+		if _, err := rand.Read(data); err != nil {
+			t.Fatalf("failed to generate data: %v", err)
+		}
+		split := min(size, 37)
+		sources := map[string]io.Reader{
+			"uniform": iotest.HalfReader(bytes.NewReader(data)),
+			// A short read at the boundary produces chunks of different sizes.
+			"varying": io.MultiReader(bytes.NewReader(data[:split]), bytes.NewReader(data[split:])),
+		}
+		for name, src := range sources {
+			ciphertext := encryptIndexed(t, key, src, 100)
+
+			// The index does not get in the way of sequential decryption.
+			var out bytes.Buffer
+			if err := dec.DecryptStream(context.Background(), bytes.NewReader(ciphertext), &out); err != nil {
+				t.Fatalf("%s/%d: DecryptStream failed: %v", name, size, err)
+			}
+			if !bytes.Equal(out.Bytes(), data) {
+				t.Fatalf("%s/%d: DecryptStream data mismatch", name, size)
+			}
+
+			r, err := dec.NewIndexedReader(bytes.NewReader(ciphertext), int64(len(ciphertext)))
+			if err != nil {
+				t.Fatalf("%s/%d: NewIndexedReader failed: %v", name, size, err)
+			}
+			if uniform := r.chunkSize > 0; size > 100 && uniform != (name == "uniform") {
+				t.Errorf("%s/%d: chunk size %d", name, size, r.chunkSize)
+			}
+			if r.Size() != int64(size) {
+				t.Fatalf("%s/%d: Size = %d", name, size, r.Size())
+			}
+			for _, span := range [][2]int{{0, size}, {size / 2, 150}, {size - 1, 1}, {size / 3, 1}, {0, 99}} {
+				off, n := max(span[0], 0), span[1]
+				want := data[off:min(off+n, size)]
+				got := make([]byte, n)
+				m, err := r.ReadAt(got, int64(off))
+				if m != len(want) || !bytes.Equal(got[:m], want) {
+					t.Errorf("%s/%d: ReadAt(%d, %d) returned %d bytes that do not match", name, size, off, n, m)
+				}
+				if (m < n) != (err == io.EOF) || (err != nil && err != io.EOF) {
+					t.Errorf("%s/%d: ReadAt(%d, %d) returned %d bytes and %v", name, size, off, n, m, err)
+				}
+			}
+
+			// Seeking works through io.SectionReader.
+			sr := io.NewSectionReader(r, 0, r.Size())
+			if _, err := sr.Seek(int64(size/2), io.SeekStart); err != nil {
+				t.Fatalf("Seek failed: %v", err)
+			}
+			rest, err := io.ReadAll(sr)
+			if err != nil || !bytes.Equal(rest, data[size/2:]) {
+				t.Errorf("%s/%d: reading after Seek failed: %v", name, size, err)
+			}
+		}
+	}
+}
+
+func TestIndexedReader_Errors(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	data := make([]byte, 1000)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("failed to generate data: %v", err)
+	}
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	open := func(b []byte) error {
+		_, err := dec.NewIndexedReader(bytes.NewReader(b), int64(len(b)))
+		return err
+	}
+
+	if err := open(encryptUnsized(t, key, data, 100)); !errors.Is(err, ErrUnsupportedFeature) {
+		t.Errorf("file without index: expected ErrUnsupportedFeature, got %v", err)
+	}
+
+	ciphertext := encryptIndexed(t, key, bytes.NewReader(data), 100)
+	indexAt := len(ciphertext) - (TrailerSize - 4) - 10*12 - TagSize
+
+	tampered := append([]byte(nil), ciphertext...)
+	tampered[indexAt+3] ^= 1
+	if err := open(tampered); !errors.Is(err, ErrAuthenticationFailed) {
+		t.Errorf("tampered index: expected ErrAuthenticationFailed, got %v", err)
+	}
+	if err := dec.DecryptStream(context.Background(), bytes.NewReader(tampered), io.Discard); !errors.Is(err, ErrAuthenticationFailed) {
+		t.Errorf("tampered index: DecryptStream expected ErrAuthenticationFailed, got %v", err)
+	}
+
+	if err := open(ciphertext[:len(ciphertext)-1]); err == nil {
+		t.Error("truncated file: expected an error")
+	}
+
+	// A corrupted chunk is only detected when it is read.
+	tampered = append([]byte(nil), ciphertext...)
+	tampered[HeaderSize+3*(4+100+TagSize)+10] ^= 1
+	r, err := dec.NewIndexedReader(bytes.NewReader(tampered), int64(len(tampered)))
+	if err != nil {
+		t.Fatalf("NewIndexedReader failed: %v", err)
+	}
+	buf := make([]byte, 100)
+	if _, err := r.ReadAt(buf, 0); err != nil {
+		t.Errorf("ReadAt of intact chunk failed: %v", err)
+	}
+	if _, err := r.ReadAt(buf, 300); !errors.Is(err, ErrCorruptedFile) {
+		t.Errorf("corrupted chunk: expected ErrCorruptedFile, got %v", err)
+	}
+}
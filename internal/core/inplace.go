@@ -0,0 +1,76 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// inplace.go: In-place file encryption for go-fileencrypt
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// EncryptFileInPlace encrypts the file at path and replaces it with the
+// encrypted version, keeping its permissions.
+//
+// The ciphertext is written to a temporary file in the same directory, synced
+// and atomically renamed over path, so a crash or error leaves either the
+// original or the complete encrypted file, never a mix. This needs free space
+// for one full encrypted copy (the file size plus 20 bytes per chunk and 64
+// bytes of header and trailer) until the rename. The original plaintext blocks
+// are released by the filesystem, not overwritten; use full-disk encryption if
+// remnants on disk are a concern.
+func (e *Encryptor) EncryptFileInPlace(ctx context.Context, path string) error {
+	ctx, release := e.deadlines(ctx)
+	defer release()
+	start := time.Now()
+	st := newStreamStats(e.plainHash)
+	err := e.encryptFileInPlace(ctx, path, &st)
+	e.fillReport(ctx, path, st, start, err)
+	return withDetail(e.errDetail, "encrypt", path, err)
+}
+
+func (e *Encryptor) encryptFileInPlace(ctx context.Context, path string, st *streamStats) error {
+	if !e.algorithm.IsSupported() {
+		return fmt.Errorf("unsupported algorithm: %s (only AES-256-GCM is currently supported)", e.algorithm)
+	}
+
+	// Renaming over a symlink would replace the link rather than its target.
+	info, err := os.Lstat(path)
+	if err != nil {
+		return WrapError("stat source file", err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("encrypt in place: %s is not a regular file", info.Mode().Type())
+	}
+
+	srcFile, err := os.Open(path) // #nosec G304 -- File path provided by caller, library purpose is file encryption
+	if err != nil {
+		return WrapError("open source file", err)
+	}
+	defer srcFile.Close()
+
+	if e.checksum {
+		st.outSum = e.checksumHash()
+	}
+	err = writeFileAtomic(path, info.Mode().Perm(), func(dstFile *os.File) error {
+		if e.preallocate {
+			if err := allocate(dstFile, e.outputSize(srcFile)); err != nil {
+				return WrapError("preallocate temporary file", err)
+			}
+		}
+		return e.encryptOpenFile(ctx, srcFile, st.outputWriter(dstFile), st)
+	})
+	if err != nil {
+		return err
+	}
+
+	if e.checksum {
+		st.checksum = st.outSum.Sum(nil)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestEncryptFileInPlace(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	data := make([]byte, 100*1024)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("failed to generate data: %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "secret.bin")
+	decPath := filepath.Join(tmpDir, "secret.dec")
+	if err := os.WriteFile(path, data, 0640); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+
+	enc, err := NewEncryptor(key)
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+
+	if err := enc.EncryptFileInPlace(context.Background(), path); err != nil {
+		t.Fatalf("EncryptFileInPlace failed: %v", err)
+	}
+
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected only the encrypted file to remain, found %d entries", len(entries))
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("stat failed: %v", err)
+		}
+		if info.Mode().Perm() != 0640 {
+			t.Errorf("expected permissions 0640 to be kept, got %v", info.Mode().Perm())
+		}
+	}
+
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	if err := dec.DecryptFile(context.Background(), path, decPath); err != nil {
+		t.Fatalf("DecryptFile failed: %v", err)
+	}
+	got, err := os.ReadFile(decPath)
+	if err != nil {
+		t.Fatalf("failed to read decrypted file: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("decrypted data does not match")
+	}
+}
+
+func TestEncryptFileInPlace_FailureKeepsOriginal(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	data := []byte("must survive a failed encryption")
+
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "secret.txt")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+
+	enc, err := NewEncryptor(key)
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := enc.EncryptFileInPlace(ctx, path); err == nil {
+		t.Fatal("expected error for canceled context")
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read original: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("original file was modified by a failed in-place encryption")
+	}
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected temporary file to be removed, found %d entries", len(entries))
+	}
+}
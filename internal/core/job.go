@@ -0,0 +1,370 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// job.go: Tracking background operations by ID
+package core
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrJobNotFound is returned by JobManager for an unknown or removed job.
+var ErrJobNotFound = errors.New("job not found")
+
+// JobID identifies a job of a JobManager.
+type JobID uint64
+
+// JobState is the state of a job.
+type JobState int
+
+const (
+	// JobRunning is a job that is processing chunks.
+	JobRunning JobState = iota
+	// JobPaused is a job paused with JobManager.Pause.
+	JobPaused
+	// JobSucceeded is a job that completed.
+	JobSucceeded
+	// JobFailed is a job that ended with an error.
+	JobFailed
+	// JobCanceled is a job stopped with JobManager.Cancel or by its context.
+	JobCanceled
+	// JobQueued is a job added with JobManager.Schedule that waits for a
+	// free slot.
+	JobQueued
+)
+
+func (s JobState) String() string {
+	switch s {
+	case JobRunning:
+		return "running"
+	case JobPaused:
+		return "paused"
+	case JobSucceeded:
+		return "succeeded"
+	case JobFailed:
+		return "failed"
+	case JobCanceled:
+		return "canceled"
+	case JobQueued:
+		return "queued"
+	default:
+		return fmt.Sprintf("JobState(%d)", int(s))
+	}
+}
+
+// Finished reports whether the job has ended.
+func (s JobState) Finished() bool {
+	return s == JobSucceeded || s == JobFailed || s == JobCanceled
+}
+
+// JobStatus is a snapshot of a job.
+type JobStatus struct {
+	ID    JobID
+	State JobState
+	// Progress is the fraction done, between 0.0 and 1.0; it stays 0 for
+	// inputs of unknown size until the job succeeds.
+	Progress float64
+	// Err is the error of a failed or canceled job.
+	Err error
+	// Started is when the job was started, or zero while it is queued;
+	// Finished when it ended, or zero.
+	Started  time.Time
+	Finished time.Time
+}
+
+// JobManager keeps track of background operations by ID, so services that
+// embed the library can expose the status of encryption jobs over their own
+// APIs. Jobs are kept until removed with Remove. It is safe for concurrent
+// use; the zero value is ready to use.
+//
+// Jobs added with Schedule are also scheduled: they wait in a queue ordered
+// by priority until fewer than MaxConcurrent jobs run, and all running jobs
+// share the BytesPerSecond limit, so interactive requests are not starved by
+// bulk backups in the same process.
+type JobManager struct {
+	// MaxConcurrent is the number of jobs that may run at once; zero means
+	// no limit. Jobs registered with Start count toward it but are never
+	// held back. Set it before adding jobs.
+	MaxConcurrent int
+	// BytesPerSecond limits the combined plaintext throughput of the jobs
+	// added with Schedule; zero means no limit. Set it before adding jobs.
+	BytesPerSecond int64
+
+	mu      sync.Mutex
+	next    JobID
+	jobs    map[JobID]*job
+	queue   []*job
+	running int
+	limit   *rateLimit
+}
+
+type job struct {
+	id      JobID
+	op      *Operation
+	started time.Time
+
+	// Jobs added with Schedule keep what they need to start while queued.
+	ctx      context.Context
+	start    func(context.Context) *Operation
+	priority int
+	// held is set for a queued job that was paused.
+	held bool
+	// err and finished are set for a job canceled while queued.
+	err      error
+	finished time.Time
+}
+
+// NewJobManager returns an empty JobManager.
+func NewJobManager() *JobManager {
+	return &JobManager{}
+}
+
+// Start registers op, as returned by EncryptFileAsync or DecryptFileAsync,
+// and returns its ID. Starting the operation first keeps the manager
+// independent of how it is configured:
+//
+//	id := jobs.Start(enc.EncryptFileAsync(ctx, src, dst))
+func (m *JobManager) Start(op *Operation) JobID {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j := m.add()
+	m.run(j, op)
+	return j.id
+}
+
+// Schedule queues a job and returns its ID. Once a slot is free and no
+// queued job has a higher priority, start is called with ctx, which carries
+// the manager's I/O limit, to start the operation; jobs of equal priority
+// start in the order they were scheduled. start must return promptly, as
+// EncryptFileAsync and DecryptFileAsync do, and must not call the manager:
+//
+//	id := jobs.Schedule(ctx, 10, func(ctx context.Context) *Operation {
+//		return enc.EncryptFileAsync(ctx, src, dst)
+//	})
+//
+// A job whose ctx is done before it starts is canceled.
+func (m *JobManager) Schedule(ctx context.Context, priority int, start func(context.Context) *Operation) JobID {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j := m.add()
+	j.ctx, j.start, j.priority = ctx, start, priority
+	m.queue = append(m.queue, j)
+	m.dispatch()
+	return j.id
+}
+
+// add creates a job with the next ID; m.mu must be held.
+func (m *JobManager) add() *job {
+	if m.jobs == nil {
+		m.jobs = make(map[JobID]*job)
+	}
+	m.next++
+	j := &job{id: m.next}
+	m.jobs[j.id] = j
+	return j
+}
+
+// run marks j as running op and frees its slot when op finishes; m.mu must
+// be held.
+func (m *JobManager) run(j *job, op *Operation) {
+	j.op, j.started = op, time.Now()
+	m.running++
+	go func() {
+		<-op.Done()
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.running--
+		m.dispatch()
+	}()
+}
+
+// dispatch starts queued jobs while slots are free; m.mu must be held.
+func (m *JobManager) dispatch() {
+	for m.MaxConcurrent <= 0 || m.running < m.MaxConcurrent {
+		i := -1
+		for k, j := range m.queue {
+			if j.held {
+				continue
+			}
+			if i < 0 || j.priority > m.queue[i].priority {
+				i = k
+			}
+		}
+		if i < 0 {
+			return
+		}
+		j := m.queue[i]
+		m.queue = slices.Delete(m.queue, i, i+1)
+		if j.ctx.Err() != nil {
+			j.err, j.finished = contextError(j.ctx), time.Now()
+			continue
+		}
+		ctx := j.ctx
+		if m.BytesPerSecond > 0 {
+			if m.limit == nil {
+				m.limit = &rateLimit{rate: m.BytesPerSecond}
+			}
+			ctx = context.WithValue(ctx, rateLimitKey{}, m.limit)
+		}
+		start := j.start
+		j.ctx, j.start = nil, nil
+		m.run(j, start(ctx))
+	}
+}
+
+// Status returns a snapshot of the job, or ErrJobNotFound.
+func (m *JobManager) Status(id JobID) (JobStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return JobStatus{}, fmt.Errorf("%w: %d", ErrJobNotFound, id)
+	}
+	return j.status(), nil
+}
+
+// Jobs returns a snapshot of every job, in the order they were started.
+func (m *JobManager) Jobs() []JobStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	statuses := make([]JobStatus, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		statuses = append(statuses, j.status())
+	}
+	slices.SortFunc(statuses, func(a, b JobStatus) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return statuses
+}
+
+// Pause pauses the job after the chunk in progress. A queued job stays
+// queued until resumed.
+func (m *JobManager) Pause(id JobID) error {
+	return m.with(id, func(j *job) {
+		if j.op == nil {
+			j.held = true
+			return
+		}
+		j.op.Pause()
+	})
+}
+
+// Resume continues a paused job.
+func (m *JobManager) Resume(id JobID) error {
+	return m.with(id, func(j *job) {
+		if j.op == nil {
+			j.held = false
+			m.dispatch()
+			return
+		}
+		j.op.Resume()
+	})
+}
+
+// Cancel stops the job; its partial output is removed. A queued job is
+// canceled without being started.
+func (m *JobManager) Cancel(id JobID) error {
+	return m.with(id, m.cancel)
+}
+
+// Remove forgets a job, canceling it first if it has not finished.
+func (m *JobManager) Remove(id JobID) error {
+	return m.with(id, func(j *job) {
+		m.cancel(j)
+		delete(m.jobs, j.id)
+	})
+}
+
+// cancel cancels j; m.mu must be held.
+func (m *JobManager) cancel(j *job) {
+	if j.op != nil {
+		j.op.Cancel()
+		return
+	}
+	if i := slices.Index(m.queue, j); i >= 0 {
+		m.queue = slices.Delete(m.queue, i, i+1)
+		j.err, j.finished = &canceledError{cause: context.Canceled}, time.Now()
+	}
+}
+
+// with calls f with the job id under m.mu, or returns ErrJobNotFound.
+func (m *JobManager) with(id JobID, f func(*job)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrJobNotFound, id)
+	}
+	f(j)
+	return nil
+}
+
+// status returns the snapshot of j; m.mu must be held.
+func (j *job) status() JobStatus {
+	st := JobStatus{ID: j.id, Started: j.started}
+	if j.op == nil {
+		switch {
+		case j.err != nil:
+			st.State, st.Err, st.Finished = JobCanceled, j.err, j.finished
+		case j.held:
+			st.State = JobPaused
+		default:
+			st.State = JobQueued
+		}
+		return st
+	}
+	st.Progress = j.op.Fraction()
+	select {
+	case <-j.op.Done():
+		st.Err = j.op.err
+		st.Finished = j.op.finished
+		switch {
+		case st.Err == nil:
+			st.State = JobSucceeded
+		case errors.Is(st.Err, ErrContextCanceled):
+			st.State = JobCanceled
+		default:
+			st.State = JobFailed
+		}
+	default:
+		st.State = JobRunning
+		if j.op.Paused() {
+			st.State = JobPaused
+		}
+	}
+	return st
+}
+
+// rateLimitKey carries the rateLimit of a JobManager in the context of the
+// operations it starts.
+type rateLimitKey struct{}
+
+// rateLimit spaces out the chunks of several operations so that together
+// they process at most rate bytes per second.
+type rateLimit struct {
+	mu   sync.Mutex
+	rate int64
+	next time.Time
+}
+
+// reserve charges n bytes to the limit and returns when the caller may
+// continue.
+func (l *rateLimit) reserve(n int64) time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(float64(n) / float64(l.rate) * float64(time.Second)))
+	return l.next
+}
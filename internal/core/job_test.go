@@ -0,0 +1,203 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// job_test.go: Tests for JobManager
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestJobManager(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	dir := t.TempDir()
+	var jobs JobManager
+
+	paused, _ := pausedAsync(t, key, make([]byte, 64*1024), dir)
+	id := jobs.Start(paused)
+	// Wait for the operation to reach the pause after its third chunk.
+	for p := range paused.Progress() {
+		if p == 3.0/64 {
+			break
+		}
+	}
+	st, err := jobs.Status(id)
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if st.State != JobPaused || st.Progress != 3.0/64 || st.Started.IsZero() || !st.Finished.IsZero() {
+		t.Errorf("paused job status %+v", st)
+	}
+	if err := jobs.Resume(id); err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+	if err := paused.Wait(); err != nil {
+		t.Fatalf("job failed: %v", err)
+	}
+	if st, _ := jobs.Status(id); st.State != JobSucceeded || st.Progress != 1 || st.Err != nil || st.Finished.IsZero() {
+		t.Errorf("succeeded job status %+v", st)
+	}
+
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	failed := jobs.Start(dec.DecryptFileAsync(context.Background(), filepath.Join(dir, "missing.enc"), filepath.Join(dir, "out")))
+	canceled, _ := pausedAsync(t, key, make([]byte, 64*1024), t.TempDir())
+	canceledID := jobs.Start(canceled)
+	if err := jobs.Cancel(canceledID); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	_ = canceled.Wait()
+
+	all := jobs.Jobs()
+	if len(all) != 3 || all[0].ID != id || all[1].ID != failed || all[2].ID != canceledID {
+		t.Fatalf("Jobs = %+v", all)
+	}
+	<-jobs.jobs[failed].op.Done()
+	if st, _ := jobs.Status(failed); st.State != JobFailed || st.Err == nil {
+		t.Errorf("failed job status %+v", st)
+	}
+	if st, _ := jobs.Status(canceledID); st.State != JobCanceled || !errors.Is(st.Err, ErrContextCanceled) {
+		t.Errorf("canceled job status %+v", st)
+	}
+
+	if err := jobs.Remove(id); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if _, err := jobs.Status(id); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Status of a removed job = %v, want ErrJobNotFound", err)
+	}
+	if err := jobs.Pause(id); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Pause of a removed job = %v, want ErrJobNotFound", err)
+	}
+}
+
+func TestJobManager_Schedule(t *testing.T) {
+	jobs := &JobManager{MaxConcurrent: 1}
+	var order []string
+	release := make(map[string]chan struct{})
+	job := func(name string) func(context.Context) *Operation {
+		done := make(chan struct{})
+		release[name] = done
+		return func(ctx context.Context) *Operation {
+			order = append(order, name)
+			return startOperation(ctx, func(ctx context.Context) error {
+				select {
+				case <-done:
+					return nil
+				case <-ctx.Done():
+					return contextError(ctx)
+				}
+			})
+		}
+	}
+	ctx := context.Background()
+	first := jobs.Schedule(ctx, 0, job("first"))
+	low := jobs.Schedule(ctx, 0, job("low"))
+	high := jobs.Schedule(ctx, 10, job("high"))
+	held := jobs.Schedule(ctx, 20, job("held"))
+	dropped := jobs.Schedule(ctx, 30, job("dropped"))
+
+	if err := jobs.Pause(held); err != nil {
+		t.Fatalf("Pause failed: %v", err)
+	}
+	if err := jobs.Cancel(dropped); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	for id, want := range map[JobID]JobState{first: JobRunning, low: JobQueued, high: JobQueued, held: JobPaused, dropped: JobCanceled} {
+		if st, _ := jobs.Status(id); st.State != want {
+			t.Errorf("job %d is %v, want %v", id, st.State, want)
+		}
+	}
+
+	started := func(id JobID) *Operation {
+		// The job starts once the previous one has freed its slot.
+		for {
+			jobs.mu.Lock()
+			op := jobs.jobs[id].op
+			jobs.mu.Unlock()
+			if op != nil {
+				return op
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	wait := func(id JobID) {
+		t.Helper()
+		if err := started(id).Wait(); err != nil {
+			t.Fatalf("job %d failed: %v", id, err)
+		}
+	}
+	close(release["first"])
+	wait(first)
+	// Resumed, held outranks high, which has already taken the slot.
+	started(high)
+	if err := jobs.Resume(held); err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+	close(release["high"])
+	wait(high)
+	close(release["held"])
+	wait(held)
+	close(release["low"])
+	wait(low)
+
+	jobs.mu.Lock()
+	got := append([]string(nil), order...)
+	jobs.mu.Unlock()
+	if want := []string{"first", "high", "held", "low"}; !slices.Equal(got, want) {
+		t.Errorf("jobs started in order %v, want %v", got, want)
+	}
+}
+
+func TestJobManager_BytesPerSecond(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.bin")
+	if err := os.WriteFile(src, make([]byte, 16*1024), 0o600); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+	chunkOpt, err := WithChunkSize(1024)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	enc, err := NewEncryptor(key, chunkOpt, WithChunkDeadline(100*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+
+	// 16KiB at 64KiB/s takes about 250ms; waiting for the limit does not
+	// trip the chunk deadline.
+	jobs := &JobManager{BytesPerSecond: 64 * 1024}
+	start := time.Now()
+	var op *Operation
+	jobs.Schedule(context.Background(), 0, func(ctx context.Context) *Operation {
+		op = enc.EncryptFileAsync(ctx, src, filepath.Join(dir, "dst.enc"))
+		return op
+	})
+	if err := op.Wait(); err != nil {
+		t.Fatalf("job failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("16KiB at 64KiB/s took %v", elapsed)
+	}
+}
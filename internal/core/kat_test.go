@@ -0,0 +1,154 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// decodeTestVector returns the decoded byte fields of v.
+func decodeTestVector(t *testing.T, v TestVector) (key, seed, plaintext, ciphertext []byte) {
+	t.Helper()
+	var err error
+	for _, f := range []struct {
+		dst *[]byte
+		src string
+	}{{&key, v.Key}, {&seed, v.NonceSeed}, {&plaintext, v.Plaintext}, {&ciphertext, v.Ciphertext}} {
+		if *f.dst, err = hex.DecodeString(f.src); err != nil {
+			t.Fatalf("invalid hex in vector %s: %v", v.Name, err)
+		}
+	}
+	return key, seed, plaintext, ciphertext
+}
+
+func loadKnownAnswerVectors(t *testing.T) []TestVector {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "kat.json"))
+	if err != nil {
+		t.Fatalf("failed to read vectors: %v", err)
+	}
+	var file struct {
+		Vectors []TestVector `json:"vectors"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatalf("failed to parse vectors: %v", err)
+	}
+	if len(file.Vectors) == 0 {
+		t.Fatal("no vectors found")
+	}
+	return file.Vectors
+}
+
+// TestKnownAnswerVectors_Decrypt checks that the published vectors decrypt to
+// their plaintexts. Encryption is checked by the testhooks-only
+// TestKnownAnswerVectors_Encrypt.
+func TestKnownAnswerVectors_Decrypt(t *testing.T) {
+	for _, v := range loadKnownAnswerVectors(t) {
+		t.Run(v.Name, func(t *testing.T) {
+			key, _, plaintext, ciphertext := decodeTestVector(t, v)
+			if got := hex.EncodeToString(ciphertext[HeaderSize-8-NonceSize : HeaderSize-8]); got != v.Fields.Nonce {
+				t.Errorf("header nonce = %s, want %s", got, v.Fields.Nonce)
+			}
+			dec, err := NewDecryptor(key)
+			if err != nil {
+				t.Fatalf("NewDecryptor failed: %v", err)
+			}
+			defer dec.Destroy()
+			var got bytes.Buffer
+			if err := dec.DecryptStream(context.Background(), bytes.NewReader(ciphertext), &got); err != nil {
+				t.Fatalf("DecryptStream failed: %v", err)
+			}
+			if !bytes.Equal(got.Bytes(), plaintext) {
+				t.Errorf("plaintext mismatch: got %x, want %x", got.Bytes(), plaintext)
+			}
+		})
+	}
+}
+
+// TestWriteTestVectors_MatchesPublished keeps testdata/kat.json in sync with
+// the suite returned by GenerateTestVectors.
+func TestWriteTestVectors_MatchesPublished(t *testing.T) {
+	want, err := os.ReadFile(filepath.Join("testdata", "kat.json"))
+	if err != nil {
+		t.Fatalf("failed to read vectors: %v", err)
+	}
+	var got bytes.Buffer
+	if err := WriteTestVectors(&got); err != nil {
+		t.Fatalf("WriteTestVectors failed: %v", err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Error("testdata/kat.json is out of date; regenerate it with WriteTestVectors")
+	}
+}
+
+func TestGenerateTestVectors_Breakdown(t *testing.T) {
+	vectors, err := GenerateTestVectors()
+	if err != nil {
+		t.Fatalf("GenerateTestVectors failed: %v", err)
+	}
+	for _, v := range vectors {
+		_, _, plaintext, ciphertext := decodeTestVector(t, v)
+		f := v.Fields
+		if f.Magic != hex.EncodeToString([]byte(MagicBytes)) || f.Version != Version {
+			t.Errorf("%s: unexpected magic/version %s/%d", v.Name, f.Magic, f.Version)
+		}
+		if (v.Sized && f.Size != uint64(len(plaintext))) || (!v.Sized && f.Size != 0) {
+			t.Errorf("%s: header size %d does not match sized=%v", v.Name, f.Size, v.Sized)
+		}
+
+		if f.Flags != uint32(headerFlags) {
+			t.Errorf("%s: unexpected flags %#x", v.Name, f.Flags)
+		}
+
+		// Reassembling the fields must reproduce the ciphertext.
+		rebuilt := append([]byte(MagicBytes), byte(f.Version))
+		rebuilt = binary.BigEndian.AppendUint32(rebuilt, f.Flags)
+		rebuilt = append(rebuilt, mustHex(t, f.Nonce)...)
+		rebuilt = binary.BigEndian.AppendUint64(rebuilt, f.Size)
+		if !bytes.Equal(rebuilt, mustHex(t, f.AAD)) {
+			t.Errorf("%s: AAD is not the encoded header", v.Name)
+		}
+		var pt []byte
+		for _, c := range f.Chunks {
+			if c.Offset != len(rebuilt) {
+				t.Errorf("%s: chunk offset %d, want %d", v.Name, c.Offset, len(rebuilt))
+			}
+			rebuilt = binary.BigEndian.AppendUint32(rebuilt, c.Length)
+			rebuilt = append(rebuilt, mustHex(t, c.Ciphertext)...)
+			rebuilt = append(rebuilt, mustHex(t, c.Tag)...)
+			pt = append(pt, mustHex(t, c.Plaintext)...)
+		}
+		if f.Trailer.Offset != len(rebuilt) {
+			t.Errorf("%s: trailer offset %d, want %d", v.Name, f.Trailer.Offset, len(rebuilt))
+		}
+		rebuilt = append(rebuilt, 0, 0, 0, 0)
+		rebuilt = append(rebuilt, mustHex(t, f.Trailer.Ciphertext)...)
+		rebuilt = append(rebuilt, mustHex(t, f.Trailer.Tag)...)
+		if !bytes.Equal(rebuilt, ciphertext) {
+			t.Errorf("%s: fields do not reassemble to the ciphertext", v.Name)
+		}
+		if !bytes.Equal(pt, plaintext) {
+			t.Errorf("%s: chunk plaintexts do not reassemble to the plaintext", v.Name)
+		}
+	}
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("invalid hex %q: %v", s, err)
+	}
+	return b
+}
@@ -11,7 +11,9 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"fmt"
+	"io"
 
+	"github.com/gitrgoliveira/go-fileencrypt/secure"
 	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/pbkdf2"
 )
@@ -87,14 +89,48 @@ func DeriveKeyPBKDF2(password, salt []byte, iterations, keyLen int) ([]byte, err
 	return key, nil
 }
 
+// GenerateKey returns a new random 32-byte AES-256 key read from crypto/rand.
+// The caller should zero it with secure.Zero when done, or use
+// GenerateKeyInto to keep it in locked memory.
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, DefaultKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	return key, nil
+}
+
+// GenerateKeyInto fills buf, which must hold exactly 32 bytes, with a new
+// random AES-256 key, so the key is created inside locked memory and never
+// exists in an ordinary slice.
+func GenerateKeyInto(buf *secure.SecureBuffer) error {
+	if buf == nil || len(buf.Data()) != DefaultKeySize {
+		size := 0
+		if buf != nil {
+			size = len(buf.Data())
+		}
+		return fmt.Errorf("%w: buffer must be %d bytes, got %d", ErrInvalidKey, DefaultKeySize, size)
+	}
+	if _, err := rand.Read(buf.Data()); err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+	return nil
+}
+
 // GenerateSalt generates a cryptographically secure random salt.
 func GenerateSalt(size int) ([]byte, error) {
+	return GenerateSaltFrom(rand.Reader, size)
+}
+
+// GenerateSaltFrom generates a salt of size bytes read from random, such as
+// a hardware RNG or a FIPS DRBG, instead of crypto/rand.
+func GenerateSaltFrom(random io.Reader, size int) ([]byte, error) {
 	if size < 16 {
 		return nil, fmt.Errorf("salt size must be at least 16 bytes, got %d", size)
 	}
 
 	salt := make([]byte, size)
-	if _, err := rand.Read(salt); err != nil {
+	if _, err := io.ReadFull(random, salt); err != nil {
 		return nil, fmt.Errorf("failed to generate salt: %w", err)
 	}
 
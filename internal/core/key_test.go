@@ -10,6 +10,7 @@ package core
 import (
 	"bytes"
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -166,6 +167,51 @@ func TestGenerateSalt_Success(t *testing.T) {
 	t.Logf("Successfully generated %d-byte random salt", len(salt))
 }
 
+func TestGenerateKey(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	defer secure.Zero(key)
+	key2, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey second call failed: %v", err)
+	}
+	defer secure.Zero(key2)
+	if len(key) != DefaultKeySize || bytes.Equal(key, key2) {
+		t.Errorf("GenerateKey returned %d bytes, identical keys %v", len(key), bytes.Equal(key, key2))
+	}
+
+	buf, err := secure.NewSecureBuffer(DefaultKeySize)
+	if err != nil {
+		t.Fatalf("NewSecureBuffer failed: %v", err)
+	}
+	defer buf.Destroy()
+	if err := GenerateKeyInto(buf); err != nil {
+		t.Fatalf("GenerateKeyInto failed: %v", err)
+	}
+	if bytes.Equal(buf.Data(), make([]byte, DefaultKeySize)) {
+		t.Error("GenerateKeyInto left the buffer zeroed")
+	}
+	enc, err := NewEncryptor(buf.Data())
+	if err != nil {
+		t.Fatalf("NewEncryptor with a generated key failed: %v", err)
+	}
+	enc.Destroy()
+
+	small, err := secure.NewSecureBuffer(16)
+	if err != nil {
+		t.Fatalf("NewSecureBuffer failed: %v", err)
+	}
+	defer small.Destroy()
+	if err := GenerateKeyInto(small); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("GenerateKeyInto with a 16-byte buffer = %v, want ErrInvalidKey", err)
+	}
+	if err := GenerateKeyInto(nil); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("GenerateKeyInto(nil) = %v, want ErrInvalidKey", err)
+	}
+}
+
 func TestGenerateSalt_InvalidSize(t *testing.T) {
 	_, err := GenerateSalt(8) // Too small
 	if err == nil {
@@ -231,3 +277,44 @@ func TestPBKDF2_EncryptionIntegration(t *testing.T) {
 
 	t.Log("Successfully encrypted and decrypted with PBKDF2-derived key")
 }
+
+func TestNewFromSecureBuffer(t *testing.T) {
+	buf, err := secure.NewSecureBuffer(DefaultKeySize)
+	if err != nil {
+		t.Fatalf("NewSecureBuffer failed: %v", err)
+	}
+	if err := GenerateKeyInto(buf); err != nil {
+		t.Fatalf("GenerateKeyInto failed: %v", err)
+	}
+	enc, err := NewEncryptorFromSecureBuffer(buf)
+	if err != nil {
+		t.Fatalf("NewEncryptorFromSecureBuffer failed: %v", err)
+	}
+	defer enc.Destroy()
+	dec, err := NewDecryptorFromSecureBuffer(buf)
+	if err != nil {
+		t.Fatalf("NewDecryptorFromSecureBuffer failed: %v", err)
+	}
+	defer dec.Destroy()
+	// The caller's buffer may be destroyed once the constructors return.
+	buf.Destroy()
+
+	plaintext := []byte("keys that never leave locked memory")
+	var ct, pt bytes.Buffer
+	if err := enc.EncryptStream(context.Background(), bytes.NewReader(plaintext), &ct); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+	if err := dec.DecryptStream(context.Background(), &ct, &pt); err != nil {
+		t.Fatalf("DecryptStream failed: %v", err)
+	}
+	if !bytes.Equal(pt.Bytes(), plaintext) {
+		t.Fatalf("round trip mismatch: got %q", pt.Bytes())
+	}
+
+	if _, err := NewEncryptorFromSecureBuffer(nil); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("NewEncryptorFromSecureBuffer(nil) = %v, want ErrInvalidKey", err)
+	}
+	if _, err := NewDecryptorFromSecureBuffer(buf); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("NewDecryptorFromSecureBuffer with a destroyed buffer = %v, want ErrInvalidKey", err)
+	}
+}
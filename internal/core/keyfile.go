@@ -0,0 +1,234 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// keyfile.go: Password-protected key container files
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"github.com/gitrgoliveira/go-fileencrypt/secure"
+)
+
+const (
+	// KeyFileMagic is the signature of key container files, "GFK".
+	KeyFileMagic = "GFK"
+	// KeyFileVersion is the current key container version.
+	KeyFileVersion = 1
+
+	// keyFileKDFArgon2id identifies Argon2id as the container's KDF.
+	keyFileKDFArgon2id = 1
+	// keyFileFixedSize is the size of a container's fields before the label:
+	// magic, version, KDF, time, memory, threads, salt, nonce, creation time
+	// and label length.
+	keyFileFixedSize = 3 + 1 + 1 + 4 + 4 + 1 + DefaultSaltSize + NonceSize + 8 + 2
+	// maxKeyFileArgon2Time and maxKeyFileArgon2Memory bound the work a
+	// container can demand, so a crafted file cannot stall LoadKeyFile.
+	maxKeyFileArgon2Time   = 64
+	maxKeyFileArgon2Memory = 4 * 1024 * 1024 // 4 GiB
+	// maxKeyFileSize is the largest container: the longest label and a key.
+	maxKeyFileSize = keyFileFixedSize + math.MaxUint16 + DefaultKeySize + TagSize
+)
+
+// KeyFileInfo is the metadata stored with a key in a container file. It is
+// authenticated but not encrypted.
+type KeyFileInfo struct {
+	// Version is the container version; it is set when a file is read.
+	Version int
+	// Label describes the key, for example its purpose; up to 65535 bytes.
+	Label string
+	// Created is when the container was written, to the second. A zero time
+	// is replaced by the current time when saving.
+	Created time.Time
+	// Argon2Time, Argon2Memory (KiB) and Argon2Threads are the Argon2id
+	// parameters deriving the key encryption key from the password. Zero
+	// values select DefaultArgon2Time, DefaultArgon2Memory and
+	// DefaultArgon2Threads.
+	Argon2Time    uint32
+	Argon2Memory  uint32
+	Argon2Threads uint8
+}
+
+// MarshalKeyFile encrypts a 32-byte key under password and returns the
+// container. The key encryption key is derived with Argon2id from password
+// and a random salt, and seals key with AES-256-GCM; the metadata in info is
+// authenticated with it, so it cannot be altered without the password.
+func MarshalKeyFile(key, password []byte, info KeyFileInfo) ([]byte, error) {
+	if len(key) != DefaultKeySize {
+		return nil, fmt.Errorf("%w: must be 32 bytes for AES-256, got %d", ErrInvalidKey, len(key))
+	}
+	if len(info.Label) > math.MaxUint16 {
+		return nil, fmt.Errorf("key file label too long: %d bytes, maximum %d", len(info.Label), math.MaxUint16)
+	}
+	if info.Argon2Time == 0 {
+		info.Argon2Time = DefaultArgon2Time
+	}
+	if info.Argon2Memory == 0 {
+		info.Argon2Memory = DefaultArgon2Memory
+	}
+	if info.Argon2Threads == 0 {
+		info.Argon2Threads = DefaultArgon2Threads
+	}
+	if info.Argon2Time > maxKeyFileArgon2Time || info.Argon2Memory > maxKeyFileArgon2Memory {
+		return nil, fmt.Errorf("key file Argon2id parameters too large: time %d (maximum %d), memory %d KiB (maximum %d)",
+			info.Argon2Time, maxKeyFileArgon2Time, info.Argon2Memory, maxKeyFileArgon2Memory)
+	}
+	if info.Created.IsZero() {
+		info.Created = time.Now()
+	}
+	if info.Created.Unix() < 0 {
+		return nil, fmt.Errorf("key file creation time %v before 1970", info.Created)
+	}
+
+	salt, err := GenerateSalt(DefaultSaltSize)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, NonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	out := make([]byte, 0, keyFileFixedSize+len(info.Label)+DefaultKeySize+TagSize)
+	out = append(out, KeyFileMagic...)
+	out = append(out, KeyFileVersion, keyFileKDFArgon2id)
+	out = binary.BigEndian.AppendUint32(out, info.Argon2Time)
+	out = binary.BigEndian.AppendUint32(out, info.Argon2Memory)
+	out = append(out, info.Argon2Threads)
+	out = append(out, salt...)
+	out = append(out, nonce...)
+	out = binary.BigEndian.AppendUint64(out, uint64(info.Created.Unix())) // #nosec G115 -- checked non-negative above
+	out = binary.BigEndian.AppendUint16(out, uint16(len(info.Label)))     // #nosec G115 -- checked above
+	out = append(out, info.Label...)
+
+	kek, err := DeriveKeyArgon2(password, salt, info.Argon2Time, info.Argon2Memory, info.Argon2Threads, DefaultKeySize)
+	if err != nil {
+		return nil, err
+	}
+	defer secure.Zero(kek)
+	aead, err := newAESGCM(kek)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(out, nonce, key, out), nil
+}
+
+// UnmarshalKeyFile decrypts a container written by MarshalKeyFile with
+// password. The key is returned in a SecureBuffer, ready for
+// NewEncryptorFromSecureBuffer; the caller must Destroy it. A wrong password
+// or an altered container fails with ErrAuthenticationFailed and ErrWrongKey.
+func UnmarshalKeyFile(data, password []byte) (*secure.SecureBuffer, KeyFileInfo, error) {
+	info, salt, nonce, err := parseKeyFile(data)
+	if err != nil {
+		return nil, KeyFileInfo{}, err
+	}
+	aad := data[:keyFileFixedSize+len(info.Label)]
+	sealed := data[len(aad):]
+	if len(sealed) != DefaultKeySize+TagSize {
+		return nil, KeyFileInfo{}, fmt.Errorf("%w: key file: sealed key is %d bytes, want %d", ErrCorruptedFile, len(sealed), DefaultKeySize+TagSize)
+	}
+
+	kek, err := DeriveKeyArgon2(password, salt, info.Argon2Time, info.Argon2Memory, info.Argon2Threads, DefaultKeySize)
+	if err != nil {
+		return nil, KeyFileInfo{}, err
+	}
+	defer secure.Zero(kek)
+	aead, err := newAESGCM(kek)
+	if err != nil {
+		return nil, KeyFileInfo{}, err
+	}
+	key, err := secure.NewSecureBuffer(DefaultKeySize)
+	if err != nil {
+		return nil, KeyFileInfo{}, err
+	}
+	// Open writes the key straight into the locked buffer.
+	if _, err := aead.Open(key.Data()[:0], nonce, sealed, aad); err != nil {
+		key.Destroy()
+		return nil, KeyFileInfo{}, fmt.Errorf("open key file: %w: %w", ErrAuthenticationFailed, ErrWrongKey)
+	}
+	return key, info, nil
+}
+
+// parseKeyFile decodes the unencrypted fields of a container.
+func parseKeyFile(data []byte) (info KeyFileInfo, salt, nonce []byte, err error) {
+	if len(data) < keyFileFixedSize {
+		return KeyFileInfo{}, nil, nil, fmt.Errorf("%w: key file truncated: %d bytes", ErrCorruptedFile, len(data))
+	}
+	if !bytes.Equal(data[:len(KeyFileMagic)], []byte(KeyFileMagic)) {
+		return KeyFileInfo{}, nil, nil, fmt.Errorf("%w: not a key file: expected magic bytes %q, got %q", ErrCorruptedFile, KeyFileMagic, data[:len(KeyFileMagic)])
+	}
+	b := data[len(KeyFileMagic):]
+	if b[0] != KeyFileVersion {
+		return KeyFileInfo{}, nil, nil, fmt.Errorf("%w: key file version %d, expected %d", ErrUnsupportedVersion, b[0], KeyFileVersion)
+	}
+	if b[1] != keyFileKDFArgon2id {
+		return KeyFileInfo{}, nil, nil, fmt.Errorf("%w: key file KDF %d", ErrUnsupportedFeature, b[1])
+	}
+	info.Version = int(b[0])
+	b = b[2:]
+	info.Argon2Time = binary.BigEndian.Uint32(b)
+	info.Argon2Memory = binary.BigEndian.Uint32(b[4:])
+	info.Argon2Threads = b[8]
+	b = b[9:]
+	if info.Argon2Time > maxKeyFileArgon2Time || info.Argon2Memory > maxKeyFileArgon2Memory {
+		return KeyFileInfo{}, nil, nil, fmt.Errorf("%w: key file Argon2id parameters out of range: time %d, memory %d KiB", ErrCorruptedFile, info.Argon2Time, info.Argon2Memory)
+	}
+	salt, b = b[:DefaultSaltSize], b[DefaultSaltSize:]
+	nonce, b = b[:NonceSize], b[NonceSize:]
+	created := binary.BigEndian.Uint64(b)
+	if created > math.MaxInt64 {
+		return KeyFileInfo{}, nil, nil, fmt.Errorf("%w: key file creation time out of range", ErrCorruptedFile)
+	}
+	info.Created = time.Unix(int64(created), 0) // #nosec G115 -- checked above
+	labelLen := int(binary.BigEndian.Uint16(b[8:]))
+	b = b[10:]
+	if len(b) < labelLen {
+		return KeyFileInfo{}, nil, nil, fmt.Errorf("%w: key file truncated in label", ErrCorruptedFile)
+	}
+	info.Label = string(b[:labelLen])
+	return info, salt, nonce, nil
+}
+
+// SaveKeyFile writes key to a container file at path, encrypted under
+// password as MarshalKeyFile describes. The file is created with mode 0600
+// and replaced atomically if it exists.
+func SaveKeyFile(path string, key, password []byte, info KeyFileInfo) error {
+	data, err := MarshalKeyFile(key, password, info)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, 0o600, func(f *os.File) error {
+		if _, err := f.Write(data); err != nil {
+			return WrapError("write key file", err)
+		}
+		return nil
+	})
+}
+
+// LoadKeyFile reads the container file at path and decrypts its key with
+// password, as UnmarshalKeyFile does.
+func LoadKeyFile(path string, password []byte) (*secure.SecureBuffer, KeyFileInfo, error) {
+	f, err := os.Open(path) // #nosec G304 -- Key file path provided by caller
+	if err != nil {
+		return nil, KeyFileInfo{}, WrapError("open key file", err)
+	}
+	defer func() { _ = f.Close() }()
+	data, err := io.ReadAll(io.LimitReader(f, maxKeyFileSize+1))
+	if err != nil {
+		return nil, KeyFileInfo{}, WrapError("read key file", err)
+	}
+	if len(data) > maxKeyFileSize {
+		return nil, KeyFileInfo{}, fmt.Errorf("%w: key file larger than %d bytes", ErrCorruptedFile, maxKeyFileSize)
+	}
+	return UnmarshalKeyFile(data, password)
+}
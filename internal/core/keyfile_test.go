@@ -0,0 +1,100 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// keyfile_test.go: Tests for password-protected key container files
+package core
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// fastKeyFile keeps Argon2id cheap in tests.
+var fastKeyFile = KeyFileInfo{Label: "backup key", Argon2Time: 1, Argon2Memory: MinArgon2Memory, Argon2Threads: 1}
+
+func TestKeyFile_RoundTrip(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	password := []byte("correct horse battery staple")
+	path := filepath.Join(t.TempDir(), "backup.key")
+	info := fastKeyFile
+	info.Created = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := SaveKeyFile(path, key, password, info); err != nil {
+		t.Fatalf("SaveKeyFile failed: %v", err)
+	}
+	if fi, err := os.Stat(path); err != nil {
+		t.Fatalf("stat key file: %v", err)
+	} else if runtime.GOOS != "windows" && fi.Mode().Perm()&0o077 != 0 {
+		t.Errorf("key file mode %v, want no group or other access", fi.Mode().Perm())
+	}
+
+	buf, got, err := LoadKeyFile(path, password)
+	if err != nil {
+		t.Fatalf("LoadKeyFile failed: %v", err)
+	}
+	defer buf.Destroy()
+	if !bytes.Equal(buf.Data(), key) {
+		t.Fatal("loaded key differs from the saved one")
+	}
+	if got.Version != KeyFileVersion || got.Label != info.Label || !got.Created.Equal(info.Created) ||
+		got.Argon2Time != 1 || got.Argon2Memory != MinArgon2Memory || got.Argon2Threads != 1 {
+		t.Errorf("loaded info %+v, want %+v", got, info)
+	}
+
+	if _, _, err := LoadKeyFile(path, []byte("wrong password")); !errors.Is(err, ErrAuthenticationFailed) || !errors.Is(err, ErrWrongKey) {
+		t.Errorf("LoadKeyFile with a wrong password = %v, want ErrAuthenticationFailed and ErrWrongKey", err)
+	}
+}
+
+func TestKeyFile_Rejects(t *testing.T) {
+	key := make([]byte, DefaultKeySize)
+	password := []byte("password")
+	data, err := MarshalKeyFile(key, password, fastKeyFile)
+	if err != nil {
+		t.Fatalf("MarshalKeyFile failed: %v", err)
+	}
+	labelAt := keyFileFixedSize
+
+	tests := []struct {
+		name   string
+		mutate func([]byte) []byte
+		want   error
+	}{
+		{"truncated", func(b []byte) []byte { return b[:len(b)-1] }, ErrCorruptedFile},
+		{"short", func(b []byte) []byte { return b[:10] }, ErrCorruptedFile},
+		{"magic", func(b []byte) []byte { b[0] = 'X'; return b }, ErrCorruptedFile},
+		{"version", func(b []byte) []byte { b[3] = 9; return b }, ErrUnsupportedVersion},
+		{"kdf", func(b []byte) []byte { b[4] = 9; return b }, ErrUnsupportedFeature},
+		{"memory", func(b []byte) []byte { b[9] = 0xff; return b }, ErrCorruptedFile},
+		{"label", func(b []byte) []byte { b[labelAt] ^= 1; return b }, ErrAuthenticationFailed},
+		{"sealed key", func(b []byte) []byte { b[len(b)-1] ^= 1; return b }, ErrAuthenticationFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, _, err := UnmarshalKeyFile(tt.mutate(bytes.Clone(data)), password)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("UnmarshalKeyFile = %v, want %v", err, tt.want)
+			}
+			if buf != nil {
+				buf.Destroy()
+			}
+		})
+	}
+
+	if _, err := MarshalKeyFile(key[:16], password, fastKeyFile); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("MarshalKeyFile with a 16-byte key = %v, want ErrInvalidKey", err)
+	}
+	if _, err := MarshalKeyFile(key, nil, fastKeyFile); err == nil {
+		t.Error("MarshalKeyFile with an empty password succeeded")
+	}
+}
@@ -0,0 +1,92 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// keylife.go: Bounding how long keys stay in memory
+package core
+
+import (
+	"context"
+	"time"
+)
+
+// WithKeyContext ties the key to ctx: once ctx is done, the Encryptor or
+// Decryptor destroys its key as Destroy does, and later operations fail
+// with ErrKeyExpired. Use the context of a request or a session so that a
+// long-running service cannot keep a key in memory longer than the work
+// that needed it, even if Destroy is never called. Creating an Encryptor or
+// Decryptor with a context that is already done fails with ErrKeyExpired.
+func WithKeyContext(ctx context.Context) Option {
+	return func(cfg *Config) {
+		cfg.KeyContext = ctx
+	}
+}
+
+// WithKeyDeadline destroys the key at t, as WithKeyContext does when its
+// context is done. Both can be combined; the key expires at whichever comes
+// first.
+func WithKeyDeadline(t time.Time) Option {
+	return func(cfg *Config) {
+		cfg.KeyDeadline = t
+	}
+}
+
+// startKeyExpiry arranges for expire to run once the key lifetime set by cfg
+// ends and returns a function that cancels it. It fails with ErrKeyExpired
+// if the lifetime has already ended.
+func startKeyExpiry(cfg *Config, expire func()) (func(), error) {
+	ctx := cfg.KeyContext
+	if ctx == nil && cfg.KeyDeadline.IsZero() {
+		return func() {}, nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	cancel := context.CancelFunc(func() {})
+	if !cfg.KeyDeadline.IsZero() {
+		ctx, cancel = context.WithDeadline(ctx, cfg.KeyDeadline)
+	}
+	if ctx.Err() != nil {
+		cancel()
+		return nil, ErrKeyExpired
+	}
+	stop := context.AfterFunc(ctx, expire)
+	return func() {
+		stop()
+		cancel()
+	}, nil
+}
+
+// expire destroys the key at the end of its lifetime.
+func (e *Encryptor) expire() {
+	e.mu.Lock()
+	e.expired = !e.destroyed
+	e.mu.Unlock()
+	e.Destroy()
+}
+
+// errDestroyed is the error of operations after Destroy or key expiry.
+func (e *Encryptor) errDestroyed() error {
+	if e.expired {
+		return ErrKeyExpired
+	}
+	return ErrDestroyed
+}
+
+// expire destroys the key at the end of its lifetime.
+func (d *Decryptor) expire() {
+	d.mu.Lock()
+	d.expired = !d.destroyed
+	d.mu.Unlock()
+	d.Destroy()
+}
+
+// errDestroyed is the error of operations after Destroy or key expiry.
+func (d *Decryptor) errDestroyed() error {
+	if d.expired {
+		return ErrKeyExpired
+	}
+	return ErrDestroyed
+}
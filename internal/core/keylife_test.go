@@ -0,0 +1,77 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestKeyLifetime(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	ctx := context.Background()
+
+	keyCtx, cancel := context.WithCancel(ctx)
+	enc, err := NewEncryptor(key, WithKeyContext(keyCtx))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	if err := enc.EncryptStream(ctx, bytes.NewReader([]byte("data")), io.Discard); err != nil {
+		t.Fatalf("EncryptStream before expiry failed: %v", err)
+	}
+	cancel()
+	// The key is destroyed by a goroutine once the context is done.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		err = enc.EncryptStream(ctx, bytes.NewReader([]byte("data")), io.Discard)
+		if err != nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if !errors.Is(err, ErrKeyExpired) || !errors.Is(err, ErrDestroyed) {
+		t.Errorf("EncryptStream after expiry: error = %v, want ErrKeyExpired", err)
+	}
+	if enc.keyBuf.Data() != nil {
+		t.Error("key buffer was not destroyed")
+	}
+
+	dec, err := NewDecryptor(key, WithKeyDeadline(time.Now().Add(20*time.Millisecond)))
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	for _, err = dec.KeyFingerprint(); err == nil && time.Now().Before(deadline); _, err = dec.KeyFingerprint() {
+		time.Sleep(time.Millisecond)
+	}
+	if !errors.Is(err, ErrKeyExpired) {
+		t.Errorf("KeyFingerprint after deadline: error = %v, want ErrKeyExpired", err)
+	}
+
+	if _, err := NewDecryptor(key, WithKeyContext(keyCtx)); !errors.Is(err, ErrKeyExpired) {
+		t.Errorf("NewDecryptor with a done context: error = %v, want ErrKeyExpired", err)
+	}
+
+	// Destroy before expiry reports ErrDestroyed only.
+	enc, err = NewEncryptor(key, WithKeyDeadline(time.Now().Add(time.Hour)))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	enc.Destroy()
+	if _, err := enc.KeyFingerprint(); !errors.Is(err, ErrDestroyed) || errors.Is(err, ErrKeyExpired) {
+		t.Errorf("KeyFingerprint after Destroy: error = %v, want ErrDestroyed", err)
+	}
+}
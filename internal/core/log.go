@@ -0,0 +1,352 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// log.go: Append-only encrypted logs
+package core
+
+import (
+	"context"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gitrgoliveira/go-fileencrypt/format"
+)
+
+// logFlags are the header flags of an encrypted log. There is no trailer:
+// the log can always grow, and it is read as a stream of unknown size.
+const logFlags = format.FlagLog | format.FlagHeaderAAD
+
+// LogWriter appends encrypted records to a log file. Each Write is sealed as
+// one or more independent authenticated records (one per chunk size of data)
+// and written with a single write call, so a crash loses at most the record
+// being written. The records continue the chunk counter of the file, which
+// prevents records from being reordered or replayed within the log.
+//
+// A log is a regular encrypted stream without a trailer: DecryptFile,
+// DecryptStream and VerifyFile read it, and Decryptor.Follow reads it as it
+// grows. Since the log has no end, removing
+// records from its tail is not detected. Only one LogWriter may append to a
+// file at a time. It is safe for concurrent use and keeps working if the
+// Encryptor is destroyed.
+type LogWriter struct {
+	mu        sync.Mutex
+	f         *os.File
+	path      string
+	sealer    *chunkSealer
+	chunkSize int
+	buf       []byte
+	errDetail ErrorDetail
+	// err is the first write error; the file may end in a partial record
+	// after it, so later writes are refused.
+	err error
+}
+
+// OpenLog opens the encrypted log at path for appending, creating it with
+// mode 0600 if it does not exist. The last record of an existing log is
+// authenticated to check the key before anything is appended.
+func (e *Encryptor) OpenLog(path string) (*LogWriter, error) {
+	w, err := e.openLog(path)
+	return w, withDetail(e.errDetail, "encrypt", path, err)
+}
+
+func (e *Encryptor) openLog(path string) (*LogWriter, error) {
+	if !e.algorithm.IsSupported() {
+		return nil, fmt.Errorf("unsupported algorithm: %s (only AES-256-GCM is currently supported)", e.algorithm)
+	}
+	gcm, err := e.newAEAD()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600) // #nosec G304 -- File path provided by caller
+	if err != nil {
+		return nil, WrapError("open log", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, WrapError("stat log", err)
+	}
+
+	var sealer *chunkSealer
+	if fi.Size() == 0 {
+		sealer, err = e.createLog(f, gcm)
+	} else {
+		sealer, err = resumeLog(f, fi.Size(), gcm)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &LogWriter{
+		f:         f,
+		path:      path,
+		sealer:    sealer,
+		chunkSize: e.chunkSize,
+		errDetail: e.errDetail,
+	}, nil
+}
+
+// createLog writes the header of a new log to f.
+func (e *Encryptor) createLog(f *os.File, gcm cipher.AEAD) (*chunkSealer, error) {
+	h := format.Header{Version: Version, Flags: logFlags | e.algorithm.id().Flags()}
+	if _, err := io.ReadFull(e.nonceSource, h.Nonce[:]); err != nil {
+		return nil, WrapError("generate nonce", err)
+	}
+	if _, err := f.Write(h.Marshal()); err != nil {
+		return nil, WrapError("write header", err)
+	}
+	return newLogSealer(gcm, h, 0, int64(h.Len())), nil
+}
+
+// resumeLog reads the header of the existing log f of size bytes, walks the
+// record lengths to find the next chunk counter, and authenticates the last
+// record.
+func resumeLog(f *os.File, size int64, gcm cipher.AEAD) (*chunkSealer, error) {
+	h, err := format.ReadHeader(io.NewSectionReader(f, 0, size))
+	if err != nil {
+		return nil, err
+	}
+	if err := h.Flags.Check(basicFlags); err != nil {
+		return nil, err
+	}
+	if h.Version != Version || h.Flags&format.FlagLog == 0 || h.HasTrailer() {
+		return nil, fmt.Errorf("%w: file is not an encrypted log", ErrUnsupportedFeature)
+	}
+
+	var counter uint32
+	var length [format.LengthSize]byte
+	offset, last := int64(h.Len()), int64(-1)
+	for offset < size {
+		if _, err := f.ReadAt(length[:], offset); err != nil {
+			return nil, atChunk(int(counter), readError("read record length", err))
+		}
+		n := binary.BigEndian.Uint32(length[:])
+		// #nosec G115 -- int to uint32 conversion safe (MaxChunkSize is 10MB)
+		if n < TagSize || n > uint32(MaxChunkSize+TagSize) || offset+format.LengthSize+int64(n) > size {
+			return nil, atChunk(int(counter), fmt.Errorf("%w: incomplete or invalid record at offset %d", ErrCorruptedFile, offset))
+		}
+		last = offset
+		offset += format.LengthSize + int64(n)
+		counter++
+		if counter == 0 {
+			return nil, fmt.Errorf("log is full: chunk counter exhausted")
+		}
+	}
+
+	if last >= 0 {
+		sealed := make([]byte, offset-last-format.LengthSize)
+		if _, err := f.ReadAt(sealed, last+format.LengthSize); err != nil {
+			return nil, readError("read last record", err)
+		}
+		if _, err := gcm.Open(sealed[:0], h.ChunkNonce(counter-1), sealed, h.AAD()); err != nil {
+			return nil, atChunk(int(counter-1), authError(fmt.Sprintf("decrypt chunk %d", counter-1), counter == 1))
+		}
+	}
+	return newLogSealer(gcm, h, counter, offset), nil
+}
+
+// newLogSealer returns a sealer continuing the log with header h at chunk
+// counter and file offset.
+func newLogSealer(gcm cipher.AEAD, h format.Header, counter uint32, offset int64) *chunkSealer {
+	return &chunkSealer{
+		gcm:       gcm,
+		baseNonce: h.Nonce[:],
+		aad:       h.AAD(),
+		nonce:     make([]byte, NonceSize),
+		counter:   counter,
+		offset:    offset,
+	}
+}
+
+// Write seals p as one or more records and appends them to the log. Empty
+// writes are ignored.
+func (w *LogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		return 0, os.ErrClosed
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	w.buf = w.buf[:0]
+	for rest := p; len(rest) > 0; {
+		n := min(len(rest), w.chunkSize)
+		out, err := w.sealer.seal(w.buf, rest[:n])
+		if err != nil {
+			w.err = withDetail(w.errDetail, "encrypt", w.path, err)
+			return 0, w.err
+		}
+		w.buf = out
+		rest = rest[n:]
+	}
+	if _, err := w.f.Write(w.buf); err != nil {
+		w.err = withDetail(w.errDetail, "encrypt", w.path, WrapError("write log", err))
+		return 0, w.err
+	}
+	return len(p), nil
+}
+
+// Records returns the number of records in the log.
+func (w *LogWriter) Records() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.sealer.chunks()
+}
+
+// Sync commits the records written so far to stable storage.
+func (w *LogWriter) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		return os.ErrClosed
+	}
+	return withDetail(w.errDetail, "encrypt", w.path, WrapError("sync log", w.f.Sync()))
+}
+
+// Close closes the log file. A closed log can be reopened with OpenLog to
+// append more records.
+func (w *LogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Close()
+	w.f = nil
+	return withDetail(w.errDetail, "encrypt", w.path, WrapError("close log", err))
+}
+
+// followInterval is how often Follow checks a log for new records.
+var followInterval = 250 * time.Millisecond
+
+// Follow decrypts the encrypted log at path and calls fn with the plaintext
+// of every record, in order, then keeps watching the file and calls fn again
+// as each new record is completely written, like tail -f. A record is only
+// passed on once it has been authenticated; partially written records are
+// waited for. The record slice is only valid during the call.
+//
+// Follow runs until ctx is done, returning ErrContextCanceled, or until fn
+// returns an error, which is returned as is. A log that shrinks while being
+// followed fails with ErrCorruptedFile. The file must already exist but may
+// still be empty.
+func (d *Decryptor) Follow(ctx context.Context, path string, fn func(record []byte) error) error {
+	err := d.follow(ctx, path, fn)
+	var fnErr followError
+	if errors.As(err, &fnErr) {
+		return fnErr.err
+	}
+	return withDetail(d.errDetail, "decrypt", path, err)
+}
+
+// followError carries an error returned by the Follow callback past the
+// error detail handling.
+type followError struct {
+	err error
+}
+
+func (e followError) Error() string { return e.err.Error() }
+
+func (d *Decryptor) follow(ctx context.Context, path string, fn func(record []byte) error) error {
+	gcm, err := d.newAEAD()
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path) // #nosec G304 -- File path provided by caller
+	if err != nil {
+		return WrapError("open log", err)
+	}
+	defer f.Close()
+
+	var (
+		h       format.Header
+		aad     []byte
+		offset  int64
+		counter uint32
+		sealed  []byte
+		length  [format.LengthSize]byte
+	)
+	for {
+		fi, err := f.Stat()
+		if err != nil {
+			return WrapError("stat log", err)
+		}
+		size := fi.Size()
+		if size < offset {
+			return fmt.Errorf("%w: log shrank from %d to %d bytes while followed", ErrCorruptedFile, offset, size)
+		}
+
+		if offset == 0 && size >= int64(HeaderSize) {
+			if h, err = format.ReadHeader(io.NewSectionReader(f, 0, size)); err != nil {
+				return err
+			}
+			if err := checkAlgorithm(h, d.algorithms); err != nil {
+				return err
+			}
+			if err := h.Flags.Check(basicFlags); err != nil {
+				return err
+			}
+			if h.Version != Version || h.Flags&format.FlagLog == 0 || h.HasTrailer() {
+				return fmt.Errorf("%w: file is not an encrypted log", ErrUnsupportedFeature)
+			}
+			aad, offset = h.AAD(), int64(h.Len())
+		}
+
+		// Pass on every complete record, then wait for more.
+		for offset > 0 && offset+format.LengthSize <= size {
+			if ctx.Err() != nil {
+				return contextError(ctx)
+			}
+			if _, err := f.ReadAt(length[:], offset); err != nil {
+				return atChunk(int(counter), readError("read record length", err))
+			}
+			n := binary.BigEndian.Uint32(length[:])
+			// #nosec G115 -- int to uint32 conversion safe (MaxChunkSize is 10MB)
+			if n < TagSize || n > uint32(MaxChunkSize+TagSize) {
+				return atChunk(int(counter), fmt.Errorf("%w: %w: %d bytes", ErrCorruptedFile, ErrChunkSize, n))
+			}
+			if d.maxChunk > 0 && int(n)-TagSize > d.maxChunk {
+				return atChunk(int(counter), fmt.Errorf("%w: record of %d bytes exceeds the limit of %d", ErrChunkSize, int(n)-TagSize, d.maxChunk))
+			}
+			if offset+format.LengthSize+int64(n) > size {
+				break
+			}
+			if cap(sealed) < int(n) {
+				sealed = make([]byte, n)
+			}
+			if _, err := f.ReadAt(sealed[:n], offset+format.LengthSize); err != nil {
+				return atChunk(int(counter), readError("read encrypted chunk", err))
+			}
+			plaintext, err := gcm.Open(sealed[:0], h.ChunkNonce(counter), sealed[:n], aad)
+			if err != nil {
+				return atChunk(int(counter), authError(fmt.Sprintf("decrypt chunk %d", counter), counter == 0))
+			}
+			if err := fn(plaintext); err != nil {
+				return followError{err}
+			}
+			offset += format.LengthSize + int64(n)
+			counter++
+			if counter == 0 {
+				return fmt.Errorf("log is full: chunk counter exhausted")
+			}
+		}
+
+		if err := pause(ctx, followInterval); err != nil {
+			return err
+		}
+	}
+}
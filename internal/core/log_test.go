@@ -0,0 +1,210 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLogWriter_AppendAndResume(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	chunkOpt, err := WithChunkSize(100)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	enc, err := NewEncryptor(key, chunkOpt)
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	var want bytes.Buffer
+	lines := [][]byte{[]byte("login alice\n"), {}, bytes.Repeat([]byte("x"), 250), []byte("logout alice\n")}
+	for session := 0; session < 2; session++ {
+		w, err := enc.OpenLog(path)
+		if err != nil {
+			t.Fatalf("OpenLog failed: %v", err)
+		}
+		for _, line := range lines {
+			if n, err := w.Write(line); err != nil || n != len(line) {
+				t.Fatalf("Write returned %d, %v", n, err)
+			}
+			want.Write(line)
+		}
+		if err := w.Sync(); err != nil {
+			t.Fatalf("Sync failed: %v", err)
+		}
+		// Two single-record lines and three records for 250 bytes.
+		if got := w.Records(); got != uint64(5*(session+1)) {
+			t.Errorf("session %d: Records() = %d, want %d", session, got, 5*(session+1))
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+		if _, err := w.Write([]byte("late")); !errors.Is(err, os.ErrClosed) {
+			t.Errorf("expected os.ErrClosed after Close, got %v", err)
+		}
+	}
+
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	var got bytes.Buffer
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+	if err := dec.DecryptStream(context.Background(), f, &got); err != nil {
+		t.Fatalf("DecryptStream failed: %v", err)
+	}
+	if !bytes.Equal(got.Bytes(), want.Bytes()) {
+		t.Errorf("decrypted log does not match the writes")
+	}
+
+	// Appending with another key is refused before anything is written.
+	other, err := NewEncryptor(make([]byte, 32))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer other.Destroy()
+	if _, err := other.OpenLog(path); !errors.Is(err, ErrWrongKey) && !errors.Is(err, ErrAuthenticationFailed) {
+		t.Errorf("expected authentication failure for wrong key, got %v", err)
+	}
+
+	// A torn final record is reported rather than appended after.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if err := os.WriteFile(path, data[:len(data)-3], 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if _, err := enc.OpenLog(path); !errors.Is(err, ErrCorruptedFile) {
+		t.Errorf("expected ErrCorruptedFile for torn record, got %v", err)
+	}
+
+	// A regular encrypted file is not a log.
+	plain := filepath.Join(t.TempDir(), "plain")
+	if err := os.WriteFile(plain, []byte("data"), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := enc.EncryptFile(context.Background(), plain, plain+".enc"); err != nil {
+		t.Fatalf("EncryptFile failed: %v", err)
+	}
+	if _, err := enc.OpenLog(plain + ".enc"); !errors.Is(err, ErrUnsupportedFeature) {
+		t.Errorf("expected ErrUnsupportedFeature for a regular file, got %v", err)
+	}
+}
+
+func TestDecryptor_Follow(t *testing.T) {
+	defer func(d time.Duration) { followInterval = d }(followInterval)
+	followInterval = 5 * time.Millisecond
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	enc, err := NewEncryptor(key)
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+
+	path := filepath.Join(t.TempDir(), "app.log")
+	w, err := enc.OpenLog(path)
+	if err != nil {
+		t.Fatalf("OpenLog failed: %v", err)
+	}
+	defer w.Close()
+	if _, err := w.Write([]byte("first")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	records := make(chan string)
+	done := make(chan error, 1)
+	go func() {
+		done <- dec.Follow(ctx, path, func(record []byte) error {
+			records <- string(record)
+			return nil
+		})
+	}()
+	next := func() string {
+		t.Helper()
+		select {
+		case r := <-records:
+			return r
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a record")
+			return ""
+		}
+	}
+
+	if got := next(); got != "first" {
+		t.Errorf("got record %q, want %q", got, "first")
+	}
+	// Records written after Follow started are picked up.
+	for _, line := range []string{"second", "third"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		if got := next(); got != line {
+			t.Errorf("got record %q, want %q", got, line)
+		}
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, ErrContextCanceled) {
+		t.Errorf("expected ErrContextCanceled, got %v", err)
+	}
+
+	// Callback errors are returned unchanged.
+	stop := errors.New("stop")
+	err = dec.Follow(context.Background(), path, func([]byte) error { return stop })
+	if err != stop {
+		t.Errorf("expected callback error, got %v", err)
+	}
+
+	// A half-written record is not passed on until it is complete.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	partial := filepath.Join(t.TempDir(), "partial.log")
+	if err := os.WriteFile(partial, data[:len(data)-5], 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	var got []string
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = dec.Follow(ctx, partial, func(record []byte) error {
+		got = append(got, string(record))
+		return nil
+	})
+	if !errors.Is(err, ErrContextCanceled) || len(got) != 2 {
+		t.Errorf("partial log: got records %q and %v, want 2 records and ErrContextCanceled", got, err)
+	}
+}
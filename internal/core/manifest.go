@@ -0,0 +1,245 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// manifest.go: Signed manifests for directory encryption
+package core
+
+import (
+	"bytes"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/gitrgoliveira/go-fileencrypt/secure"
+)
+
+// ManifestVersion is the current manifest format version.
+const ManifestVersion = 1
+
+// manifestKeyInfo separates the manifest signing key from the file key.
+const manifestKeyInfo = "go-fileencrypt manifest v1"
+
+// Manifest lists the files written by EncryptDir so an entire encrypted set
+// can later be audited with VerifyManifest.
+type Manifest struct {
+	Version int `json:"version"`
+	// Suffix is the suffix of the encrypted files when it is not
+	// EncryptedFileSuffix.
+	Suffix string `json:"suffix,omitempty"`
+	// Snapshot is set when the manifest was written with WithSnapshot.
+	Snapshot *SnapshotInfo   `json:"snapshot,omitempty"`
+	Files    []ManifestEntry `json:"files"`
+}
+
+// ManifestEntry describes one encrypted file.
+type ManifestEntry struct {
+	// Path is the slash-separated path of the plaintext file relative to the
+	// directory root. The encrypted file is Path + the suffix.
+	Path string `json:"path"`
+	// EncryptedPath is set instead when names are obfuscated with
+	// WithObfuscatedNames or numbered by CollisionRename: the encrypted file
+	// is EncryptedPath + the suffix.
+	EncryptedPath string `json:"encrypted_path,omitempty"`
+	// Size is the plaintext size in bytes.
+	Size int64 `json:"size"`
+	// PlaintextSHA256 and CiphertextSHA256 are hex-encoded SHA-256 digests.
+	PlaintextSHA256  string `json:"plaintext_sha256"`
+	CiphertextSHA256 string `json:"ciphertext_sha256"`
+	// ModTime is the modification time of the plaintext file when it was
+	// encrypted; SyncDir re-encrypts files whose size or ModTime changed.
+	ModTime time.Time `json:"mod_time,omitzero"`
+	// DeletedAt is set on tombstones: files SyncDir found removed from the
+	// source with WithTombstones, whose encrypted files are kept.
+	DeletedAt time.Time `json:"deleted_at,omitzero"`
+}
+
+// signedManifest is the on-disk form: the manifest JSON and an HMAC-SHA256
+// over its compact encoding with a key derived from the file key. Signing the
+// compact form keeps the signature valid when the file is pretty-printed.
+// With WithManifestSigner it also carries a public-key signature over the
+// same bytes and the signer's certificate chain, both base64-encoded.
+type signedManifest struct {
+	Manifest     json.RawMessage `json:"manifest"`
+	HMAC         string          `json:"hmac_sha256"`
+	Signature    string          `json:"signature,omitempty"`
+	Certificates []string        `json:"certificates,omitempty"`
+}
+
+// manifestMAC computes the manifest HMAC with a key derived via HKDF, so the
+// file encryption key is never used directly for signing.
+func manifestMAC(key, body []byte) ([]byte, error) {
+	macKey, err := hkdf.Key(sha256.New, key, nil, manifestKeyInfo, 32)
+	if err != nil {
+		return nil, WrapError("derive manifest key", err)
+	}
+	defer secure.Zero(macKey)
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(body)
+	return mac.Sum(nil), nil
+}
+
+// signManifest serializes and signs m, adding a public-key signature if
+// signer is not nil.
+func signManifest(key []byte, m *Manifest, signer *manifestSigner) ([]byte, error) {
+	body, err := json.Marshal(m)
+	if err != nil {
+		return nil, WrapError("encode manifest", err)
+	}
+	sum, err := manifestMAC(key, body)
+	if err != nil {
+		return nil, err
+	}
+	signed := signedManifest{Manifest: body, HMAC: hex.EncodeToString(sum)}
+	if signer != nil {
+		if err := signer.sign(&signed, body); err != nil {
+			return nil, err
+		}
+	}
+	return json.MarshalIndent(signed, "", "  ")
+}
+
+// openManifest verifies the signature of a serialized manifest and decodes it.
+// The HMAC is checked unless key is nil; the public-key signature is checked
+// if trust is not nil.
+func openManifest(key, data []byte, trust *ManifestTrust) (*Manifest, error) {
+	var signed signedManifest
+	if err := json.Unmarshal(data, &signed); err != nil {
+		return nil, fmt.Errorf("%w: invalid manifest: %w", ErrCorruptedFile, err)
+	}
+	var body bytes.Buffer
+	if err := json.Compact(&body, signed.Manifest); err != nil {
+		return nil, fmt.Errorf("%w: invalid manifest: %w", ErrCorruptedFile, err)
+	}
+	if key != nil {
+		got, err := hex.DecodeString(signed.HMAC)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid manifest signature encoding", ErrCorruptedFile)
+		}
+		want, err := manifestMAC(key, body.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		if !hmac.Equal(got, want) {
+			return nil, fmt.Errorf("manifest: %w", ErrAuthenticationFailed)
+		}
+	}
+	if trust != nil {
+		if err := trust.verify(&signed, body.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(body.Bytes(), &m); err != nil {
+		return nil, fmt.Errorf("%w: invalid manifest: %w", ErrCorruptedFile, err)
+	}
+	if m.Version != ManifestVersion {
+		return nil, fmt.Errorf("%w: manifest version %d", ErrUnsupportedVersion, m.Version)
+	}
+	return &m, nil
+}
+
+// suffix returns the suffix of the encrypted files m lists.
+func (m *Manifest) suffix() string {
+	if m.Suffix != "" {
+		return m.Suffix
+	}
+	return EncryptedFileSuffix
+}
+
+// tombstones returns the slash-separated paths of the encrypted files
+// of the tombstones in m.
+func (m *Manifest) tombstones() map[string]bool {
+	files := make(map[string]bool)
+	for _, entry := range m.Files {
+		if !entry.DeletedAt.IsZero() {
+			files[entry.encryptedFile(m.suffix())] = true
+		}
+	}
+	return files
+}
+
+// encryptedFile returns the path of the encrypted file relative to the
+// directory root.
+func (entry ManifestEntry) encryptedFile(suffix string) string {
+	if entry.EncryptedPath != "" {
+		return entry.EncryptedPath + suffix
+	}
+	return entry.Path + suffix
+}
+
+// sealManifest encrypts a serialized manifest in the file format, so the
+// paths it lists cannot be read without the key.
+func (e *Encryptor) sealManifest(data []byte) ([]byte, error) {
+	gcm, err := e.newAEAD()
+	if err != nil {
+		return nil, err
+	}
+	sealer, out, err := newChunkSealer(gcm, int64(len(data)), 0, e.nonceSource, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	for rest := data; len(rest) > 0; {
+		n := min(len(rest), e.chunkSize)
+		if out, err = sealer.seal(out, rest[:n]); err != nil {
+			return nil, err
+		}
+		rest = rest[n:]
+	}
+	return sealer.trailer(out, int64(len(data))), nil
+}
+
+// openSealedManifest decrypts a manifest written by sealManifest.
+func (d *Decryptor) openSealedManifest(data []byte) ([]byte, error) {
+	gcm, err := d.newAEAD()
+	if err != nil {
+		return nil, err
+	}
+	st := newStreamStats(nil)
+	opener, err := newChunkOpener(gcm, bytes.NewReader(data), &st, d.algorithms)
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	for {
+		plaintext, err := opener.next()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("manifest: %w", err)
+		}
+		out = append(out, plaintext...)
+	}
+}
+
+// ReadManifest reads the manifest at path, decrypting it if it was written
+// with WithObfuscatedNames, and verifies its signature with the decryptor's
+// key and, with WithManifestTrust, its public-key signature.
+func (d *Decryptor) ReadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- File path provided by caller
+	if err != nil {
+		return nil, WrapError("read manifest", err)
+	}
+	// A signed manifest is JSON; an encrypted one starts with the file magic.
+	if bytes.HasPrefix(data, []byte(MagicBytes)) {
+		if data, err = d.openSealedManifest(data); err != nil {
+			return nil, err
+		}
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.destroyed {
+		return nil, d.errDestroyed()
+	}
+	return openManifest(d.keyBuf.Data(), data, d.manifestTrust)
+}
@@ -0,0 +1,159 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// mask.go: Masking encrypted output so it cannot be told from random data
+package core
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"github.com/gitrgoliveira/go-fileencrypt/secure"
+)
+
+// MaskIVSize is the size of the random IV that starts a file written with
+// WithMasking.
+const MaskIVSize = aes.BlockSize
+
+// maskKeyInfo separates the masking key from the file key.
+const maskKeyInfo = "go-fileencrypt mask v1"
+
+// masker masks the encrypted form of a file with AES-256-CTR under a key
+// derived from the file key and a random IV written in front of it. The
+// masked file has no magic bytes, header fields or record lengths in the
+// clear; the records inside stay authenticated by GCM as before.
+type masker struct {
+	block cipher.Block
+	// random supplies IVs: crypto/rand or the WithRand source.
+	random io.Reader
+}
+
+// WithMasking makes encryptors mask their output so that it is
+// indistinguishable from random data: the magic bytes, version, flags and
+// record lengths that identify an encrypted file are hidden under a keyed
+// stream, at a cost of MaskIVSize bytes. Decryptors detect masked input by
+// themselves with the key, so the option is only needed when encrypting.
+//
+// Masking applies to EncryptFile, EncryptStream, EncryptReader and the
+// functions built on them; DecryptFile, DecryptStream, DecryptReader,
+// VerifyFile and JoinParts read masked files. Tools that parse the format
+// without the key, such as format.NewReader, need Decryptor.Unmask first,
+// and random access, scanning and migration need unmasked files.
+func WithMasking(enable bool) Option {
+	return func(cfg *Config) {
+		cfg.Masking = enable
+	}
+}
+
+// newMasker derives the masking key from key. IVs are read from random,
+// which may be nil for a masker that only unmasks.
+func newMasker(key []byte, random io.Reader) (*masker, error) {
+	maskKey, err := hkdf.Key(sha256.New, key, nil, maskKeyInfo, 32)
+	if err != nil {
+		return nil, WrapError("derive mask key", err)
+	}
+	defer secure.Zero(maskKey)
+	block, err := aes.NewCipher(maskKey)
+	if err != nil {
+		return nil, WrapError("create mask cipher", err)
+	}
+	return &masker{block: block, random: random}, nil
+}
+
+// newStream returns a fresh IV and the keystream it starts. The IV never
+// begins with the magic bytes, so input that does is never masked.
+func (m *masker) newStream() ([]byte, cipher.Stream, error) {
+	iv := make([]byte, MaskIVSize)
+	for {
+		if _, err := io.ReadFull(m.random, iv); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate mask IV: %w", err)
+		}
+		if !bytes.HasPrefix(iv, []byte(MagicBytes)) {
+			return iv, cipher.NewCTR(m.block, iv), nil
+		}
+	}
+}
+
+// writer writes a fresh IV to dst and returns a writer that masks what is
+// written to it into dst.
+func (m *masker) writer(dst io.Writer, st *streamStats) (io.Writer, error) {
+	iv, stream, err := m.newStream()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dst.Write(iv); err != nil {
+		return nil, WrapError("write mask IV", err)
+	}
+	st.ciphertext += MaskIVSize
+	return &maskWriter{stream: stream, dst: dst}, nil
+}
+
+// maskWriter masks data on its way to dst.
+type maskWriter struct {
+	stream cipher.Stream
+	dst    io.Writer
+	buf    []byte
+}
+
+func (w *maskWriter) Write(p []byte) (int, error) {
+	if cap(w.buf) < len(p) {
+		w.buf = make([]byte, len(p))
+	}
+	buf := w.buf[:len(p)]
+	w.stream.XORKeyStream(buf, p)
+	return w.dst.Write(buf)
+}
+
+// reader returns src as an unmasked stream. Input that starts with the magic
+// bytes is returned as it is. Otherwise its first bytes are taken as an IV,
+// and if the bytes after it unmask to the magic bytes the rest is unmasked;
+// if they do not, the input is returned as it is so the header is reported
+// as damaged exactly as for any other file.
+func (m *masker) reader(src io.Reader, st *streamStats) io.Reader {
+	raw := make([]byte, MaskIVSize+len(MagicBytes))
+	n, err := io.ReadFull(src, raw[:len(MagicBytes)])
+	if err == nil && !bytes.Equal(raw[:n], []byte(MagicBytes)) {
+		var k int
+		k, err = io.ReadFull(src, raw[n:])
+		n += k
+		if err == nil {
+			stream := cipher.NewCTR(m.block, raw[:MaskIVSize])
+			magic := make([]byte, len(MagicBytes))
+			stream.XORKeyStream(magic, raw[MaskIVSize:])
+			if bytes.Equal(magic, []byte(MagicBytes)) {
+				st.ciphertext += MaskIVSize
+				return io.MultiReader(bytes.NewReader(magic), &cipher.StreamReader{S: stream, R: src})
+			}
+		}
+	}
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return io.MultiReader(bytes.NewReader(raw[:n]), failedReader{err})
+	}
+	return io.MultiReader(bytes.NewReader(raw[:n]), src)
+}
+
+// failedReader returns err from every Read.
+type failedReader struct {
+	err error
+}
+
+func (r failedReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+// Unmask returns src as the plain encrypted format, removing the masking of
+// a file written with WithMasking, so tools that parse the format without
+// the key, such as format.NewReader, can read it. Unmasked input is returned
+// unchanged.
+func (d *Decryptor) Unmask(src io.Reader) io.Reader {
+	st := newStreamStats(nil)
+	return d.mask.reader(src, &st)
+}
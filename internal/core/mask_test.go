@@ -0,0 +1,178 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// mask_test.go: Tests for masked output
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gitrgoliveira/go-fileencrypt/format"
+)
+
+func TestWithMasking(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	data := make([]byte, 10*1024+7)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("failed to generate data: %v", err)
+	}
+	chunk, err := WithChunkSize(1024)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	enc, err := NewEncryptor(key, chunk, WithMasking(true), WithHeaderCRC(true))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	ctx := context.Background()
+
+	var masked bytes.Buffer
+	if err := enc.EncryptStream(ctx, bytes.NewReader(data), &masked); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+	if bytes.HasPrefix(masked.Bytes(), []byte(MagicBytes)) {
+		t.Error("masked output starts with the magic bytes")
+	}
+	// No record length prefix of a full chunk appears in the clear.
+	if bytes.Contains(masked.Bytes(), []byte{0, 0, 0x04, 0x10}) {
+		t.Error("masked output contains a record length")
+	}
+	want, err := EstimateEncryptedSize(int64(len(data)), 1024, WithMasking(true), WithHeaderCRC(true))
+	if err != nil || want != int64(masked.Len()) {
+		t.Errorf("EstimateEncryptedSize = %d, %v; output is %d bytes", want, err, masked.Len())
+	}
+
+	var plain bytes.Buffer
+	if err := dec.DecryptStream(ctx, bytes.NewReader(masked.Bytes()), &plain); err != nil {
+		t.Fatalf("DecryptStream failed: %v", err)
+	}
+	if !bytes.Equal(plain.Bytes(), data) {
+		t.Fatal("masked round trip does not match")
+	}
+
+	// Unmask gives the plain format back for keyless tools.
+	h, err := format.ReadHeader(dec.Unmask(bytes.NewReader(masked.Bytes())))
+	if err != nil || h.Flags&format.FlagHeaderCRC == 0 {
+		t.Errorf("header of unmasked stream = %+v, %v", h, err)
+	}
+
+	// EncryptReader and small files are masked the same way.
+	r, err := enc.EncryptReader(ctx, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("EncryptReader failed: %v", err)
+	}
+	fromReader, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading EncryptReader failed: %v", err)
+	}
+	if bytes.HasPrefix(fromReader, []byte(MagicBytes)) || len(fromReader) != masked.Len() {
+		t.Error("EncryptReader output is not masked")
+	}
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "small"), filepath.Join(dir, "small.enc")
+	if err := os.WriteFile(src, data[:100], 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := enc.EncryptFile(ctx, src, dst); err != nil {
+		t.Fatalf("EncryptFile failed: %v", err)
+	}
+	if err := dec.DecryptFile(ctx, dst, src+".out"); err != nil {
+		t.Fatalf("DecryptFile failed: %v", err)
+	}
+	if got, err := os.ReadFile(src + ".out"); err != nil || !bytes.Equal(got, data[:100]) {
+		t.Errorf("decrypted small file does not match: %v", err)
+	}
+	var fromStream bytes.Buffer
+	if err := dec.DecryptStream(ctx, bytes.NewReader(fromReader), &fromStream); err != nil || !bytes.Equal(fromStream.Bytes(), data) {
+		t.Errorf("decrypting EncryptReader output failed: %v", err)
+	}
+
+	// Unmasked files are still read, and another key cannot unmask.
+	plainEnc, err := NewEncryptor(key, chunk)
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer plainEnc.Destroy()
+	var unmasked bytes.Buffer
+	if err := plainEnc.EncryptStream(ctx, bytes.NewReader(data), &unmasked); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+	if err := dec.VerifyStream(ctx, &unmasked); err != nil {
+		t.Errorf("VerifyStream of an unmasked stream failed: %v", err)
+	}
+	other, err := NewDecryptor(make([]byte, 32))
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer other.Destroy()
+	if err := other.VerifyStream(ctx, bytes.NewReader(masked.Bytes())); !errors.Is(err, ErrCorruptedFile) {
+		t.Errorf("wrong key: error = %v, want ErrCorruptedFile", err)
+	}
+
+	// Records stay authenticated under the mask.
+	damaged := bytes.Clone(masked.Bytes())
+	damaged[len(damaged)/2] ^= 0x01
+	if err := dec.VerifyStream(ctx, bytes.NewReader(damaged)); !errors.Is(err, ErrAuthenticationFailed) {
+		t.Errorf("damaged: error = %v, want ErrAuthenticationFailed", err)
+	}
+}
+
+func TestWithMasking_Rand(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	entropy := make([]byte, NonceSize+MaskIVSize)
+	for i := range entropy {
+		entropy[i] = byte(i + 1)
+	}
+	ctx := context.Background()
+
+	// The IV comes from the WithRand source, so the same source gives the
+	// same masked output.
+	var outputs [2]bytes.Buffer
+	for i := range outputs {
+		enc, err := NewEncryptor(key, WithMasking(true), WithRand(bytes.NewReader(entropy)))
+		if err != nil {
+			t.Fatalf("NewEncryptor failed: %v", err)
+		}
+		err = enc.EncryptStream(ctx, bytes.NewReader([]byte("masked data")), &outputs[i])
+		enc.Destroy()
+		if err != nil {
+			t.Fatalf("EncryptStream failed: %v", err)
+		}
+	}
+	if !bytes.Equal(outputs[0].Bytes(), outputs[1].Bytes()) {
+		t.Error("masked output differs for the same WithRand source")
+	}
+	if iv := outputs[0].Bytes()[:MaskIVSize]; !bytes.Contains(entropy, iv) {
+		t.Errorf("mask IV %x was not read from the WithRand source", iv)
+	}
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	if err := dec.VerifyStream(ctx, &outputs[0]); err != nil {
+		t.Errorf("VerifyStream failed: %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// migrate.go: Upgrading encrypted files to the current format version
+package core
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gitrgoliveira/go-fileencrypt/format"
+)
+
+// MigrateFile upgrades the version 1 file at path to the current format in
+// place. Every chunk is authenticated and copied unchanged, and the header
+// version is updated and a trailer appended, so the plaintext never leaves the
+// decryption buffer. Files already in the current format are left untouched.
+//
+// Migration upgrades keyed files only. It adds the trailer but neither a
+// chunk index nor KDF parameters: it works from the key alone, so it does
+// not know the password, salt or cost a key was derived with, and the header
+// has no field for them; keep them in a key file written with SaveKeyFile.
+// Files that need an index should be decrypted and encrypted again.
+//
+// Like EncryptFileInPlace, the new file is written next to the original and
+// atomically renamed over it, so a failure leaves the original intact. A
+// file that fails authentication is reported and not modified.
+func (d *Decryptor) MigrateFile(ctx context.Context, path string) error {
+	ctx, release := d.deadlines(ctx)
+	defer release()
+	start := time.Now()
+	st := newStreamStats(d.plainHash)
+	err := d.migrateFile(ctx, path, &st)
+	d.fillReport(ctx, "migrate", path, st, start, err)
+	return withDetail(d.errDetail, "migrate", path, err)
+}
+
+// MigrateDir runs MigrateFile on every regular file under dir that starts
+// with a version 1 header, honoring WithInclude, WithExclude and WithFilter.
+// Other files are skipped. It stops at the first failure; files migrated
+// before it remain migrated. The report, if any, aggregates all files.
+func (d *Decryptor) MigrateDir(ctx context.Context, dir string) error {
+	ctx, release := d.deadlines(ctx)
+	defer release()
+	start := time.Now()
+	total := newStreamStats(nil)
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return contextError(ctx)
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != dir && d.filter.excludes(filepath.ToSlash(rel)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		if ok, err := d.filter.allowsEntry(filepath.ToSlash(rel), entry); err != nil || !ok {
+			return err
+		}
+
+		st := newStreamStats(nil)
+		err = d.migrateFile(ctx, path, &st)
+		total.add(st)
+		if err != nil && !errors.Is(err, errNotGFE) {
+			return fmt.Errorf("%s: %w", filepath.ToSlash(rel), err)
+		}
+		return nil
+	})
+	total.complete = err == nil
+	d.fillReport(ctx, "migrate", dir, total, start, err)
+	return withDetail(d.errDetail, "migrate", dir, err)
+}
+
+// errNotGFE marks files MigrateDir skips because they are not encrypted files.
+var errNotGFE = errors.New("not an encrypted file")
+
+// migrateFile upgrades the file at path if it is a version 1 file.
+func (d *Decryptor) migrateFile(ctx context.Context, path string, st *streamStats) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return WrapError("stat encrypted file", err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("migrate: %s is not a regular file", info.Mode().Type())
+	}
+
+	srcFile, err := os.Open(path) // #nosec G304 -- File path provided by caller
+	if err != nil {
+		return WrapError("open encrypted file", err)
+	}
+	defer srcFile.Close()
+
+	h, err := format.ReadHeader(srcFile)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errNotGFE, err)
+	}
+	st.algorithm = algorithmOf(h.Flags)
+	if h.Version == Version {
+		st.complete = true
+		return nil
+	}
+	if _, err := srcFile.Seek(0, io.SeekStart); err != nil {
+		return WrapError("seek encrypted file", err)
+	}
+
+	br := d.ioPools.reader(ctx, srcFile)
+	defer d.ioPools.putReader(br)
+	err = writeFileAtomic(path, info.Mode().Perm(), func(dstFile *os.File) error {
+		bw := d.ioPools.writer(ctx, dstFile)
+		defer d.ioPools.putWriter(bw)
+		if err := d.migrateStream(ctx, br, bw, st); err != nil {
+			return err
+		}
+		return WrapError("flush output", bw.Flush())
+	})
+	return err
+}
+
+// migrateStream copies a version 1 stream to dst as the current version,
+// authenticating each chunk and appending the trailer.
+func (d *Decryptor) migrateStream(ctx context.Context, src io.Reader, dst io.Writer, st *streamStats) error {
+	gcm, err := d.newAEAD()
+	if err != nil {
+		return err
+	}
+	r, err := format.NewReader(src)
+	if err != nil {
+		return err
+	}
+	h := r.Header()
+	if h.Version != VersionV1 {
+		return fmt.Errorf("%w: cannot migrate from version %d", ErrUnsupportedVersion, h.Version)
+	}
+
+	// Version 1 records authenticate only the size field, so the chunks stay
+	// valid as they are as long as the new header does not set FlagHeaderAAD.
+	h.Version = Version
+	h.Flags = format.FlagTrailer
+	if _, err := dst.Write(h.Marshal()); err != nil {
+		return WrapError("write header", err)
+	}
+	st.ciphertext += int64(h.Len())
+
+	var plaintext []byte
+	var length [format.LengthSize]byte
+	progress := newProgressReporter(d.progress, int64(h.Size)) // #nosec G115 -- a size above MaxInt64 reports no progress
+	for {
+		if ctx.Err() != nil {
+			return contextError(ctx)
+		}
+		c, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return atChunk(int(r.Chunks()), err)
+		}
+		if plaintext, err = c.Open(gcm, h, plaintext[:0]); err != nil {
+			return atChunk(int(c.Index), authError(fmt.Sprintf("decrypt chunk %d", c.Index), c.Index == 0))
+		}
+		st.addPlaintext(plaintext)
+		st.plaintext += int64(len(plaintext))
+
+		binary.BigEndian.PutUint32(length[:], uint32(len(c.Sealed))) // #nosec G115 -- bounded by MaxChunkSize
+		if _, err := dst.Write(length[:]); err != nil {
+			return atChunk(int(c.Index), WrapError("write chunk", err))
+		}
+		if _, err := dst.Write(c.Sealed); err != nil {
+			return atChunk(int(c.Index), WrapError("write chunk", err))
+		}
+		st.ciphertext += int64(len(length) + len(c.Sealed))
+		st.chunks++
+
+		progress.update(st.plaintext)
+		chunkDone(ctx)
+	}
+
+	if h.Size > 0 && uint64(st.plaintext) != h.Size {
+		return fmt.Errorf("%w: file truncated: expected %d bytes, got %d", ErrCorruptedFile, h.Size, st.plaintext)
+	}
+	trailer := format.Trailer{Size: uint64(st.plaintext), Chunks: st.chunks}.Seal(gcm, h)
+	if _, err := dst.Write(trailer); err != nil {
+		return WrapError("write trailer", err)
+	}
+	st.ciphertext += int64(len(trailer))
+	st.complete = true
+	progress.finish()
+	return nil
+}
@@ -0,0 +1,175 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gitrgoliveira/go-fileencrypt/format"
+)
+
+// encryptV1 returns data encrypted in the legacy v1 format: a header without
+// flags or size, and chunks authenticating only the size field, with no trailer.
+func encryptV1(t *testing.T, key, data []byte, chunkSize int) []byte {
+	t.Helper()
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatalf("aes.NewCipher failed: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatalf("cipher.NewGCM failed: %v", err)
+	}
+	h := format.Header{Version: VersionV1}
+	if _, err := rand.Read(h.Nonce[:]); err != nil {
+		t.Fatalf("failed to generate nonce: %v", err)
+	}
+	v1 := h.Marshal()
+	for i := 0; i*chunkSize < len(data); i++ {
+		chunk := data[i*chunkSize : min((i+1)*chunkSize, len(data))]
+		v1 = binary.BigEndian.AppendUint32(v1, uint32(len(chunk)+TagSize))
+		v1 = gcm.Seal(v1, h.ChunkNonce(uint32(i)), chunk, h.AAD())
+	}
+	return v1
+}
+
+func TestMigrateFile(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	data := make([]byte, 100)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("failed to generate data: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "legacy.enc")
+	v1 := encryptV1(t, key, data, 16)
+	if err := os.WriteFile(path, v1, 0640); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	var report OperationReport
+	dec, err := NewDecryptor(key, WithReport(&report))
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	if err := dec.MigrateFile(context.Background(), path); err != nil {
+		t.Fatalf("MigrateFile failed: %v", err)
+	}
+
+	migrated, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if migrated[len(MagicBytes)] != Version || len(migrated) != len(v1)+format.FlagsSize+TrailerSize {
+		t.Fatalf("file was not upgraded: version %d, %d bytes", migrated[len(MagicBytes)], len(migrated))
+	}
+	if !bytes.Equal(migrated[HeaderSize:len(migrated)-TrailerSize], v1[HeaderSizeV1:]) {
+		t.Error("chunks were not copied unchanged")
+	}
+	if report.Operation != "migrate" || report.Chunks != 7 || report.PlaintextBytes != int64(len(data)) {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("permissions not preserved: %v, %v", info.Mode().Perm(), err)
+	}
+
+	var out bytes.Buffer
+	if err := dec.DecryptStream(context.Background(), bytes.NewReader(migrated), &out); err != nil {
+		t.Fatalf("DecryptStream of migrated file failed: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Error("migrated file does not decrypt to the original data")
+	}
+
+	// A file that is already current is left as is.
+	if err := dec.MigrateFile(context.Background(), path); err != nil {
+		t.Fatalf("MigrateFile of current file failed: %v", err)
+	}
+	if again, _ := os.ReadFile(path); !bytes.Equal(again, migrated) {
+		t.Error("current file was rewritten")
+	}
+}
+
+func TestMigrateFile_WrongKeyLeavesOriginal(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "legacy.enc")
+	v1 := encryptV1(t, key, []byte("legacy data"), 16)
+	if err := os.WriteFile(path, v1, 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	dec, err := NewDecryptor(make([]byte, 32))
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	if err := dec.MigrateFile(context.Background(), path); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("expected ErrWrongKey, got %v", err)
+	}
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, v1) {
+		t.Error("original file was modified")
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("temporary file left behind: %d entries", len(entries))
+	}
+}
+
+func TestMigrateDir(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	dir := t.TempDir()
+	writeTree(t, dir, map[string][]byte{
+		"a.enc":         encryptV1(t, key, []byte("alpha"), 16),
+		"sub/b.enc":     encryptV1(t, key, []byte("bravo"), 16),
+		"skip/c.enc":    encryptV1(t, key, []byte("charlie"), 16),
+		"notes.txt":     []byte("plain text file"),
+		"sub/empty.bin": {},
+	})
+
+	dec, err := NewDecryptor(key, WithExclude("skip"))
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	if err := dec.MigrateDir(context.Background(), dir); err != nil {
+		t.Fatalf("MigrateDir failed: %v", err)
+	}
+
+	version := func(name string) byte {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+		return data[len(MagicBytes)]
+	}
+	if version("a.enc") != Version || version("sub/b.enc") != Version {
+		t.Error("files were not migrated")
+	}
+	if version("skip/c.enc") != VersionV1 {
+		t.Error("excluded file was migrated")
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "notes.txt")); string(data) != "plain text file" {
+		t.Error("non-encrypted file was modified")
+	}
+}
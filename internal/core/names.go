@@ -0,0 +1,98 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// names.go: Filename obfuscation for directory encryption
+package core
+
+import (
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gitrgoliveira/go-fileencrypt/secure"
+)
+
+// nameKeyInfo separates the filename key from the file and manifest keys.
+const nameKeyInfo = "go-fileencrypt names v1"
+
+// obfuscatedNameSize is the number of HMAC bytes kept per name component,
+// hex-encoded to 32 characters.
+const obfuscatedNameSize = 16
+
+// nameObfuscator maps relative paths to HMAC-derived names one component at
+// a time, so the tree keeps its shape but reveals no names. Each component is
+// derived from its whole path, so equal names in different directories
+// differ, and the mapping is deterministic for a key.
+type nameObfuscator struct {
+	key []byte
+}
+
+// newNameObfuscator derives the filename key from the encryptor's key.
+func (e *Encryptor) newNameObfuscator() (*nameObfuscator, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.destroyed {
+		return nil, e.errDestroyed()
+	}
+	key, err := hkdf.Key(sha256.New, e.keyBuf.Data(), nil, nameKeyInfo, 32)
+	if err != nil {
+		return nil, WrapError("derive filename key", err)
+	}
+	return &nameObfuscator{key: key}, nil
+}
+
+// name returns the obfuscated form of the relative path rel.
+func (o *nameObfuscator) name(rel string) string {
+	if rel == "." {
+		return rel
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	names := make([]string, len(parts))
+	for i := range parts {
+		mac := hmac.New(sha256.New, o.key)
+		mac.Write([]byte(strings.Join(parts[:i+1], "/")))
+		names[i] = hex.EncodeToString(mac.Sum(nil)[:obfuscatedNameSize])
+	}
+	return filepath.Join(names...)
+}
+
+func (o *nameObfuscator) destroy() {
+	secure.Zero(o.key)
+}
+
+// manifestNames returns a function mapping the obfuscated paths recorded in
+// m, and each of their parent directories, back to the plaintext paths.
+// Other paths are returned unchanged.
+func manifestNames(m *Manifest) (func(rel string) string, error) {
+	names := make(map[string]string)
+	for _, entry := range m.Files {
+		if entry.EncryptedPath == "" {
+			continue
+		}
+		if !filepath.IsLocal(filepath.FromSlash(entry.Path)) || !filepath.IsLocal(filepath.FromSlash(entry.EncryptedPath)) {
+			return nil, fmt.Errorf("%w: manifest path escapes directory", ErrCorruptedFile)
+		}
+		plain := strings.Split(path.Clean(entry.Path), "/")
+		enc := strings.Split(path.Clean(entry.EncryptedPath), "/")
+		if len(plain) != len(enc) {
+			return nil, fmt.Errorf("%w: manifest paths %q and %q differ in depth", ErrCorruptedFile, entry.Path, entry.EncryptedPath)
+		}
+		for i := range enc {
+			names[strings.Join(enc[:i+1], "/")] = strings.Join(plain[:i+1], "/")
+		}
+	}
+	return func(rel string) string {
+		if name, ok := names[filepath.ToSlash(rel)]; ok {
+			return filepath.FromSlash(name)
+		}
+		return rel
+	}, nil
+}
@@ -0,0 +1,211 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// naming.go: Output naming shared by directory and batch operations
+package core
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// CollisionPolicy controls what EncryptDir, DecryptDir and the batch
+// planning helpers do when an output name is already taken.
+type CollisionPolicy uint8
+
+const (
+	// CollisionOverwrite replaces existing outputs (default).
+	CollisionOverwrite CollisionPolicy = iota
+	// CollisionFail fails with ErrOutputExists when an output exists or was
+	// already assigned to another input of the same operation.
+	CollisionFail
+	// CollisionRename numbers the plaintext name, "report-1.pdf",
+	// "report-2.pdf" and so on, until the output name is free. Encrypted
+	// outputs are numbered before the suffix is appended, so decrypting them
+	// restores the numbered name.
+	CollisionRename
+)
+
+// maxCollisionRenames bounds the numbered names CollisionRename tries.
+const maxCollisionRenames = 10000
+
+// WithSuffix sets the suffix EncryptDir appends to encrypted file names and
+// DecryptDir removes (EncryptedFileSuffix by default). It must be non-empty
+// and must not contain a path separator. The suffix is recorded in the
+// manifest, so DecryptDir and VerifyManifest use the one a manifest was
+// written with.
+func WithSuffix(suffix string) Option {
+	return func(cfg *Config) {
+		cfg.Suffix = suffix
+	}
+}
+
+// WithCollisionPolicy sets what happens when an output name is already
+// taken: overwrite it (default), fail, or pick a numbered name.
+func WithCollisionPolicy(policy CollisionPolicy) Option {
+	return func(cfg *Config) {
+		cfg.Collisions = policy
+	}
+}
+
+// checkSuffix reports whether suffix can be appended to file names.
+func checkSuffix(suffix string) error {
+	if suffix == "" {
+		return nil
+	}
+	if strings.ContainsAny(suffix, `/\`) || strings.Trim(suffix, ".") == "" {
+		return fmt.Errorf("invalid suffix %q", suffix)
+	}
+	return nil
+}
+
+// naming holds the output naming conventions of an Encryptor or Decryptor.
+type naming struct {
+	suffix     string
+	collisions CollisionPolicy
+}
+
+func newNaming(cfg *Config) naming {
+	n := naming{suffix: cfg.Suffix, collisions: cfg.Collisions}
+	if n.suffix == "" {
+		n.suffix = EncryptedFileSuffix
+	}
+	return n
+}
+
+// outputNames assigns the output paths of one operation, resolving
+// collisions with existing files and with the paths it assigned before.
+type outputNames struct {
+	policy CollisionPolicy
+	// taken holds the assigned paths, case-folded so that names differing
+	// only in case collide as they would on case-insensitive file systems.
+	taken map[string]bool
+}
+
+func (n naming) newOutputNames() *outputNames {
+	return &outputNames{policy: n.collisions, taken: make(map[string]bool)}
+}
+
+// assign returns the output path of the plaintext name name, where output
+// maps a plaintext name to its path, and the plaintext name it was assigned
+// under, which differs from name when CollisionRename numbered it.
+func (o *outputNames) assign(name string, output func(name string) string) (string, string, error) {
+	candidate := name
+	for i := 1; ; i++ {
+		dst := output(candidate)
+		if o.policy == CollisionOverwrite || !o.isTaken(dst) {
+			o.reserve(dst)
+			return dst, candidate, nil
+		}
+		if o.policy == CollisionFail {
+			return "", "", fmt.Errorf("%w: %s", ErrOutputExists, dst)
+		}
+		if i > maxCollisionRenames {
+			return "", "", fmt.Errorf("%w: no free name for %s", ErrOutputExists, dst)
+		}
+		candidate = numberedName(name, i)
+	}
+}
+
+// reserve marks dst as taken by an earlier operation.
+func (o *outputNames) reserve(dst string) {
+	o.taken[strings.ToLower(dst)] = true
+}
+
+func (o *outputNames) isTaken(dst string) bool {
+	if o.taken[strings.ToLower(dst)] {
+		return true
+	}
+	_, err := os.Lstat(dst)
+	return err == nil
+}
+
+// numberedName inserts -i before the extension of the last element of name.
+func numberedName(name string, i int) string {
+	dir, base := filepath.Split(name)
+	ext := path.Ext(base)
+	if ext == base {
+		ext = ""
+	}
+	return dir + strings.TrimSuffix(base, ext) + "-" + strconv.Itoa(i) + ext
+}
+
+// EncryptedName returns the name EncryptDir gives the file at the relative
+// path rel: rel with the suffix appended, after replacing every element with
+// its HMAC-derived name if WithObfuscatedNames is set.
+func (e *Encryptor) EncryptedName(rel string) (string, error) {
+	if !e.obfuscateNames {
+		return rel + e.naming.suffix, nil
+	}
+	names, err := e.newNameObfuscator()
+	if err != nil {
+		return "", err
+	}
+	defer names.destroy()
+	return names.name(rel) + e.naming.suffix, nil
+}
+
+// DecryptedName returns the name DecryptDir gives the encrypted file at the
+// relative path rel, which is rel without the suffix, and whether rel has
+// the suffix at all. Obfuscated names are only restored by DecryptDir, from
+// the manifest.
+func (d *Decryptor) DecryptedName(rel string) (string, bool) {
+	name, ok := strings.CutSuffix(rel, d.naming.suffix)
+	return name, ok && name != "" && !strings.HasSuffix(name, string(filepath.Separator))
+}
+
+// PlanEncryptFiles returns batch items encrypting each of srcs into dstDir
+// under the name EncryptedName gives its base name, resolving collisions
+// between them and with existing files according to WithCollisionPolicy.
+// Pass the items to EncryptFiles.
+func (e *Encryptor) PlanEncryptFiles(srcs []string, dstDir string) ([]BatchItem, error) {
+	output := func(name string) string { return filepath.Join(dstDir, name) + e.naming.suffix }
+	if e.obfuscateNames {
+		names, err := e.newNameObfuscator()
+		if err != nil {
+			return nil, err
+		}
+		defer names.destroy()
+		output = func(name string) string { return filepath.Join(dstDir, names.name(name)) + e.naming.suffix }
+	}
+	return planFiles(srcs, e.naming.newOutputNames(), func(src string) (string, error) {
+		return filepath.Base(src), nil
+	}, output)
+}
+
+// PlanDecryptFiles returns batch items decrypting each of srcs into dstDir
+// under the name DecryptedName gives its base name, resolving collisions as
+// PlanEncryptFiles does. Sources without the suffix are rejected. Pass the
+// items to DecryptFiles.
+func (d *Decryptor) PlanDecryptFiles(srcs []string, dstDir string) ([]BatchItem, error) {
+	return planFiles(srcs, d.naming.newOutputNames(), func(src string) (string, error) {
+		name, ok := d.DecryptedName(filepath.Base(src))
+		if !ok {
+			return "", fmt.Errorf("%s: name does not end in %q", src, d.naming.suffix)
+		}
+		return name, nil
+	}, func(name string) string { return filepath.Join(dstDir, name) })
+}
+
+func planFiles(srcs []string, names *outputNames, name func(src string) (string, error), output func(name string) string) ([]BatchItem, error) {
+	items := make([]BatchItem, len(srcs))
+	for i, src := range srcs {
+		n, err := name(src)
+		if err != nil {
+			return nil, err
+		}
+		dst, _, err := names.assign(n, output)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = BatchItem{Src: src, Dst: dst}
+	}
+	return items, nil
+}
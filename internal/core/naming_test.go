@@ -0,0 +1,157 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlanFiles(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	dstDir := t.TempDir()
+	srcs := []string{filepath.Join("a", "x.txt"), filepath.Join("b", "x.txt"), filepath.Join("b", "X.TXT"), "y"}
+	if err := os.WriteFile(filepath.Join(dstDir, "y.gfe"), nil, 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	cases := []struct {
+		policy CollisionPolicy
+		want   []string
+	}{
+		{CollisionOverwrite, []string{"x.txt.gfe", "x.txt.gfe", "X.TXT.gfe", "y.gfe"}},
+		{CollisionRename, []string{"x.txt.gfe", "x-1.txt.gfe", "X-2.TXT.gfe", "y-1.gfe"}},
+	}
+	for _, tc := range cases {
+		enc, err := NewEncryptor(key, WithSuffix(".gfe"), WithCollisionPolicy(tc.policy))
+		if err != nil {
+			t.Fatalf("NewEncryptor failed: %v", err)
+		}
+		defer enc.Destroy()
+		items, err := enc.PlanEncryptFiles(srcs, dstDir)
+		if err != nil {
+			t.Fatalf("policy %d: PlanEncryptFiles failed: %v", tc.policy, err)
+		}
+		for i, item := range items {
+			if item.Src != srcs[i] || item.Dst != filepath.Join(dstDir, tc.want[i]) {
+				t.Errorf("policy %d: item %d = %+v, want %s", tc.policy, i, item, tc.want[i])
+			}
+		}
+	}
+
+	enc, err := NewEncryptor(key, WithSuffix(".gfe"), WithCollisionPolicy(CollisionFail))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	if _, err := enc.PlanEncryptFiles(srcs[:2], dstDir); !errors.Is(err, ErrOutputExists) {
+		t.Errorf("duplicate name: error = %v, want ErrOutputExists", err)
+	}
+	if _, err := enc.PlanEncryptFiles(srcs[3:], dstDir); !errors.Is(err, ErrOutputExists) {
+		t.Errorf("existing output: error = %v, want ErrOutputExists", err)
+	}
+
+	dec, err := NewDecryptor(key, WithSuffix(".gfe"))
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	if name, ok := dec.DecryptedName("x-1.txt.gfe"); !ok || name != "x-1.txt" {
+		t.Errorf("DecryptedName = %q, %v", name, ok)
+	}
+	if _, ok := dec.DecryptedName(".gfe"); ok {
+		t.Error("DecryptedName accepted a bare suffix")
+	}
+	if _, err := dec.PlanDecryptFiles([]string{"x.txt.enc"}, dstDir); err == nil {
+		t.Error("PlanDecryptFiles accepted a name without the suffix")
+	}
+
+	if _, err := NewEncryptor(key, WithSuffix("a/b")); err == nil {
+		t.Error("NewEncryptor accepted a suffix with a separator")
+	}
+	if _, err := NewEncryptor(key, WithCollisionPolicy(CollisionRename+1)); err == nil {
+		t.Error("NewEncryptor accepted an invalid collision policy")
+	}
+}
+
+func TestEncryptDir_Naming(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	encDir := filepath.Join(tmpDir, "enc")
+	decDir := filepath.Join(tmpDir, "dec")
+	manifestPath := filepath.Join(tmpDir, "manifest.json")
+	writeTree(t, srcDir, map[string][]byte{"a.txt": []byte("alpha"), "sub/b": []byte("beta")})
+	ctx := context.Background()
+
+	enc, err := NewEncryptor(key, WithSuffix(".gfe"), WithCollisionPolicy(CollisionRename), WithManifest(manifestPath))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	if err := enc.EncryptDir(ctx, srcDir, encDir); err != nil {
+		t.Fatalf("EncryptDir failed: %v", err)
+	}
+	// A second run keeps the first outputs and numbers the new ones.
+	writeTree(t, srcDir, map[string][]byte{"a.txt": []byte("alpha 2")})
+	if err := enc.EncryptDir(ctx, srcDir, encDir); err != nil {
+		t.Fatalf("second EncryptDir failed: %v", err)
+	}
+	for _, name := range []string{"a.txt.gfe", "a-1.txt.gfe", "sub/b.gfe", "sub/b-1.gfe"} {
+		if _, err := os.Stat(filepath.Join(encDir, filepath.FromSlash(name))); err != nil {
+			t.Errorf("missing output %s: %v", name, err)
+		}
+	}
+
+	// The manifest records the suffix and numbered names, so a decryptor
+	// with default naming verifies and restores the second run.
+	dec, err := NewDecryptor(key, WithManifest(manifestPath))
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	if err := dec.VerifyManifest(ctx, manifestPath, encDir); err != nil {
+		t.Fatalf("VerifyManifest failed: %v", err)
+	}
+	m, err := dec.ReadManifest(manifestPath)
+	if err != nil || m.Suffix != ".gfe" {
+		t.Fatalf("manifest suffix = %v, %v", m, err)
+	}
+	if err := os.Remove(filepath.Join(encDir, "a.txt.gfe")); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if err := os.Remove(filepath.Join(encDir, "sub", "b.gfe")); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if err := dec.DecryptDir(ctx, encDir, decDir); err != nil {
+		t.Fatalf("DecryptDir failed: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(decDir, "a.txt")); err != nil || !bytes.Equal(got, []byte("alpha 2")) {
+		t.Errorf("a.txt = %q, %v", got, err)
+	}
+
+	// CollisionFail refuses to replace the decrypted files.
+	strict, err := NewDecryptor(key, WithManifest(manifestPath), WithCollisionPolicy(CollisionFail))
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer strict.Destroy()
+	if err := strict.DecryptDir(ctx, encDir, decDir); !errors.Is(err, ErrOutputExists) {
+		t.Errorf("DecryptDir error = %v, want ErrOutputExists", err)
+	}
+}
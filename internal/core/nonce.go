@@ -0,0 +1,189 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// nonce.go: Persisted nonce counters shared between processes
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+)
+
+// nonceBlock is how many counter values a NonceManager reserves from its file
+// at a time. Values reserved but unused when a process exits are skipped.
+const nonceBlock = 1024
+
+// maxNonceCounter bounds the counter: the top bit of a base nonce is inverted
+// for metadata records and must stay clear.
+const maxNonceCounter = math.MaxInt64
+
+// NonceManager hands out base nonces from a counter persisted in a file, so
+// long-lived services and cooperating processes encrypting many streams with
+// one key never repeat a nonce, and stop once a message limit for the key is
+// reached. Without it, base nonces are random and their uniqueness is only
+// probabilistic.
+//
+// Each base nonce is the 8-byte big-endian counter followed by the 4 bytes
+// the chunk counter fills in. Processes reserve blocks of counters under an
+// exclusive file lock (flock on Unix, LockFileEx on Windows; other platforms
+// have no cross-process lock and must use one file per process).
+//
+// Use one counter file per key, and never delete or restore it while the key
+// is in use. A NonceManager is safe for concurrent use and can be shared by
+// any number of Encryptors for the same key.
+type NonceManager struct {
+	mu    sync.Mutex
+	f     *os.File
+	path  string
+	limit uint64
+	// next and end delimit the block of counter values reserved from the file.
+	next, end uint64
+}
+
+// OpenNonceManager opens or creates the counter file at path. Once limit
+// base nonces have been handed out across all users of the file, encryption
+// fails with ErrKeyExhausted; 0 means no limit other than the counter range.
+func OpenNonceManager(path string, limit uint64) (*NonceManager, error) {
+	if limit == 0 || limit > maxNonceCounter {
+		limit = maxNonceCounter
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600) // #nosec G304 -- File path provided by caller
+	if err != nil {
+		return nil, WrapError("open nonce counter", err)
+	}
+	m := &NonceManager{f: f, path: path, limit: limit}
+	if _, err := m.load(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// Used returns the number of counter values reserved from the file by all
+// of its users, which bounds the number of nonces handed out under the key.
+func (m *NonceManager) Used() (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.f == nil {
+		return 0, os.ErrClosed
+	}
+	if err := lockFile(m.f); err != nil {
+		return 0, WrapError("lock nonce counter", err)
+	}
+	defer unlockFile(m.f)
+	return m.load()
+}
+
+// Close closes the counter file. Counter values reserved but not used are
+// not returned to the file.
+func (m *NonceManager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.f == nil {
+		return nil
+	}
+	err := m.f.Close()
+	m.f = nil
+	return WrapError("close nonce counter", err)
+}
+
+// nextNonce writes the next base nonce to nonce.
+func (m *NonceManager) nextNonce(nonce []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.f == nil {
+		return os.ErrClosed
+	}
+	if m.next == m.end {
+		if err := m.reserve(); err != nil {
+			return err
+		}
+	}
+	binary.BigEndian.PutUint64(nonce, m.next)
+	clear(nonce[8:])
+	m.next++
+	return nil
+}
+
+// reserve takes the next block of counter values from the file.
+func (m *NonceManager) reserve() error {
+	if err := lockFile(m.f); err != nil {
+		return WrapError("lock nonce counter", err)
+	}
+	defer unlockFile(m.f)
+
+	start, err := m.load()
+	if err != nil {
+		return err
+	}
+	if start >= m.limit {
+		return fmt.Errorf("%w: %d nonces used, limit is %d", ErrKeyExhausted, start, m.limit)
+	}
+	end := start + min(nonceBlock, m.limit-start)
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], end)
+	if _, err := m.f.WriteAt(buf[:], 0); err != nil {
+		return WrapError("write nonce counter", err)
+	}
+	if err := m.f.Sync(); err != nil {
+		return WrapError("sync nonce counter", err)
+	}
+	m.next, m.end = start, end
+	return nil
+}
+
+// load reads the counter from the file; an empty file holds 0.
+func (m *NonceManager) load() (uint64, error) {
+	var buf [8]byte
+	n, err := m.f.ReadAt(buf[:], 0)
+	if err != nil && err != io.EOF {
+		return 0, WrapError("read nonce counter", err)
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	if n < len(buf) {
+		return 0, fmt.Errorf("%w: nonce counter %s is %d bytes", ErrCorruptedFile, m.path, n)
+	}
+	v := binary.BigEndian.Uint64(buf[:])
+	if v > maxNonceCounter {
+		return 0, fmt.Errorf("%w: nonce counter %s out of range", ErrCorruptedFile, m.path)
+	}
+	return v, nil
+}
+
+// nonceCounter adapts a NonceManager to the io.Reader base nonces are read
+// from.
+type nonceCounter struct {
+	m *NonceManager
+}
+
+func (r nonceCounter) Read(p []byte) (int, error) {
+	if len(p) != NonceSize {
+		return 0, fmt.Errorf("%w: nonce manager asked for %d bytes", ErrInvalidNonce, len(p))
+	}
+	if err := r.m.nextNonce(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// lockedReader serializes reads from a WithRand source, so each base nonce
+// is read whole even when an Encryptor is shared across goroutines.
+type lockedReader struct {
+	mu sync.Mutex
+	r  io.Reader
+}
+
+func (r *lockedReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return io.ReadFull(r.r, p)
+}
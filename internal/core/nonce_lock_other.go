@@ -0,0 +1,17 @@
+//go:build !unix && !windows
+
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import "os"
+
+// lockFile is a no-op where no file locking is available; the NonceManager
+// mutex still serializes users within the process.
+func lockFile(*os.File) error { return nil }
+
+func unlockFile(*os.File) error { return nil }
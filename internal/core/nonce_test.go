@@ -0,0 +1,151 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/gitrgoliveira/go-fileencrypt/format"
+)
+
+func TestNonceManager_UniqueAcrossManagers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nonces")
+	// Two managers on one file stand in for two processes.
+	a, err := OpenNonceManager(path, 0)
+	if err != nil {
+		t.Fatalf("OpenNonceManager failed: %v", err)
+	}
+	defer a.Close()
+	b, err := OpenNonceManager(path, 0)
+	if err != nil {
+		t.Fatalf("OpenNonceManager failed: %v", err)
+	}
+	defer b.Close()
+
+	seen := make(map[[NonceSize]byte]bool)
+	for i := 0; i < 3*nonceBlock; i++ {
+		for _, m := range []*NonceManager{a, b} {
+			var nonce [NonceSize]byte
+			if _, err := io.ReadFull(nonceCounter{m}, nonce[:]); err != nil {
+				t.Fatalf("nonce %d: %v", i, err)
+			}
+			if seen[nonce] {
+				t.Fatalf("nonce %x handed out twice", nonce)
+			}
+			seen[nonce] = true
+		}
+	}
+	if used, err := a.Used(); err != nil || used != 6*nonceBlock {
+		t.Errorf("Used() = %d, %v; want %d", used, err, 6*nonceBlock)
+	}
+}
+
+func TestWithNonceManager_Limit(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	m, err := OpenNonceManager(filepath.Join(t.TempDir(), "nonces"), 2)
+	if err != nil {
+		t.Fatalf("OpenNonceManager failed: %v", err)
+	}
+	defer m.Close()
+	enc, err := NewEncryptor(key, WithNonceManager(m))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+
+	data := []byte("counter nonces")
+	for i := uint64(0); i < 2; i++ {
+		var buf bytes.Buffer
+		if err := enc.EncryptStream(context.Background(), bytes.NewReader(data), &buf); err != nil {
+			t.Fatalf("EncryptStream failed: %v", err)
+		}
+		h, err := format.ReadHeader(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("ReadHeader failed: %v", err)
+		}
+		if want := (format.Header{Nonce: [NonceSize]byte{7: byte(i)}}).Nonce; h.Nonce != want {
+			t.Errorf("stream %d: base nonce %x, want %x", i, h.Nonce, want)
+		}
+		var out bytes.Buffer
+		if err := dec.DecryptStream(context.Background(), &buf, &out); err != nil || !bytes.Equal(out.Bytes(), data) {
+			t.Errorf("stream %d: round trip failed: %v", i, err)
+		}
+	}
+
+	err = enc.EncryptStream(context.Background(), bytes.NewReader(data), io.Discard)
+	if !errors.Is(err, ErrKeyExhausted) {
+		t.Errorf("expected ErrKeyExhausted past the limit, got %v", err)
+	}
+	if _, err := enc.EncryptRecord(data, nil); !errors.Is(err, ErrKeyExhausted) {
+		t.Errorf("expected ErrKeyExhausted for a record past the limit, got %v", err)
+	}
+}
+
+func TestWithRand(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	entropy := make([]byte, 2*NonceSize)
+	for i := range entropy {
+		entropy[i] = byte(i + 1)
+	}
+	enc, err := NewEncryptor(key, WithRand(bytes.NewReader(entropy)))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+
+	// Each stream takes its base nonce from the next bytes of the source.
+	for i := 0; i < 2; i++ {
+		var buf bytes.Buffer
+		if err := enc.EncryptStream(context.Background(), bytes.NewReader([]byte("data")), &buf); err != nil {
+			t.Fatalf("EncryptStream %d failed: %v", i, err)
+		}
+		h, err := format.ParseHeader(buf.Bytes())
+		if err != nil {
+			t.Fatalf("ParseHeader failed: %v", err)
+		}
+		if want := entropy[i*NonceSize : (i+1)*NonceSize]; !bytes.Equal(h.Nonce[:], want) {
+			t.Errorf("stream %d nonce = %x, want %x", i, h.Nonce, want)
+		}
+		if err := dec.DecryptStream(context.Background(), &buf, io.Discard); err != nil {
+			t.Errorf("DecryptStream %d failed: %v", i, err)
+		}
+	}
+	// An exhausted source fails encryption instead of reusing a nonce.
+	if err := enc.EncryptStream(context.Background(), bytes.NewReader([]byte("data")), io.Discard); !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("EncryptStream with an exhausted source = %v, want EOF", err)
+	}
+
+	salt, err := GenerateSaltFrom(bytes.NewReader(entropy), 16)
+	if err != nil || !bytes.Equal(salt, entropy[:16]) {
+		t.Errorf("GenerateSaltFrom = %x, %v; want %x", salt, err, entropy[:16])
+	}
+	if _, err := GenerateSaltFrom(bytes.NewReader(entropy[:8]), 16); err == nil {
+		t.Error("GenerateSaltFrom with a short source succeeded")
+	}
+}
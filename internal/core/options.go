@@ -8,10 +8,16 @@
 package core
 
 import (
-	"errors"
-	"github.com/dustin/go-humanize"
-	"math"
-	"os"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"time"
+
+	"github.com/gitrgoliveira/go-fileencrypt/format"
 )
 
 // Algorithm represents a cryptographic algorithm
@@ -47,11 +53,131 @@ func (a Algorithm) IsSupported() bool {
 	return a == AlgorithmAESGCM
 }
 
+// SymlinkPolicy controls how directory operations treat symbolic links.
+type SymlinkPolicy uint8
+
+const (
+	// SymlinkSkip ignores symbolic links (default).
+	SymlinkSkip SymlinkPolicy = iota
+	// SymlinkFollow processes the files and directories links point to as if
+	// they were part of the tree. Links that would revisit a directory being
+	// walked, or lead into the destination, are skipped.
+	SymlinkFollow
+	// SymlinkPreserve recreates links with the same target in the destination.
+	// Link targets are not encrypted.
+	SymlinkPreserve
+)
+
 type Config struct {
-	ChunkSize int
-	Progress  func(float64)
-	Checksum  bool
-	Algorithm Algorithm
+	ChunkSize   int
+	Progress    func(float64)
+	Checksum    bool
+	Algorithm   Algorithm
+	ErrorDetail ErrorDetail
+	Report      *OperationReport
+	// ChecksumHash, if set, creates the hash used for output checksums
+	// instead of SHA-256.
+	ChecksumHash func() hash.Hash
+	// PlaintextHash, if set, creates the hash computed over the plaintext.
+	PlaintextHash func() hash.Hash
+	// Manifest is the path EncryptDir writes its signed manifest to.
+	Manifest string
+	// Include, Exclude and Filter select files for batch and directory operations.
+	Include []string
+	Exclude []string
+	Filter  func(fs.FileInfo) bool
+	// Symlinks is the symbolic link policy for directory operations.
+	Symlinks SymlinkPolicy
+	// ChunkIndex appends a chunk index to encrypted files for random access.
+	ChunkIndex bool
+	// Pipeline is the queue depth of the threaded encryption pipeline; 0
+	// disables it.
+	Pipeline int
+	// Parallelism is the number of goroutines sealing chunks in the
+	// pipeline, or ParallelismAuto; 0 means one.
+	Parallelism int
+	// CPUAffinity lists the CPUs pipeline workers are pinned to.
+	CPUAffinity []int
+	// Priority is the scheduling priority of operations.
+	Priority Priority
+	// ChunkDelay is the pause between chunks.
+	ChunkDelay time.Duration
+	// NonceManager, if set, supplies counter-based base nonces.
+	NonceManager *NonceManager
+	// KeyLimits, if set, enforces usage limits on the encryption key.
+	KeyLimits *KeyLimits
+	// AuditSink, if set, receives an event for every operation.
+	AuditSink AuditSink
+	// MaxChunkSizeLimit, if positive, caps ChunkSize below MaxChunkSize.
+	MaxChunkSizeLimit int
+	// MaxAcceptedChunkSize, if positive, caps the chunk size a Decryptor
+	// accepts from files.
+	MaxAcceptedChunkSize int
+	// MaxChunks and MaxInputSize, if positive, bound the chunks and the
+	// encrypted bytes a Decryptor reads per operation.
+	MaxChunks    int64
+	MaxInputSize int64
+	// Algorithms, if set, are the algorithms a Decryptor accepts in file
+	// headers. WithAlgorithm sets it to its algorithm and
+	// WithAllowedAlgorithms to its list.
+	Algorithms []Algorithm
+	// Timeout and ChunkDeadline, if positive, bound each operation and the
+	// time between chunks.
+	Timeout       time.Duration
+	ChunkDeadline time.Duration
+	// Padding, if set, pads the plaintext to hide its exact size.
+	Padding PaddingScheme
+	// Preallocate reserves the space of output files before writing them.
+	Preallocate bool
+	// BackupHeader appends a copy of the header to encrypted files.
+	BackupHeader bool
+	// HeaderCRC adds a checksum to the header of encrypted files.
+	HeaderCRC bool
+	// ChunkDigests records a digest of every chunk record in the chunk index.
+	ChunkDigests bool
+	// MultiSegment makes decryptors read concatenated encrypted streams.
+	MultiSegment bool
+	// Rand, if set, replaces crypto/rand as the source of base nonces.
+	Rand io.Reader
+	// ChunkCallback, if set, is called after every chunk with its details.
+	ChunkCallback func(ChunkInfo)
+	// Sidecar selects the data EncryptFile writes a SHA-256 checksum
+	// sidecar for; SidecarNone writes none.
+	Sidecar SidecarSource
+	// ManifestSigner, if set, signs directory manifests, with the
+	// certificate chain in ManifestChain stored alongside.
+	ManifestSigner crypto.Signer
+	ManifestChain  []*x509.Certificate
+	// ManifestTrust, if set, is the public-key signature directory manifests
+	// must carry.
+	ManifestTrust *ManifestTrust
+	// Masking hides the encrypted format of the output under a keyed stream.
+	Masking bool
+	// DryRun, if set, receives the plan of encryptions instead of running them.
+	DryRun *DryRunPlan
+	// KDF holds password-based key derivation parameters for the
+	// application; it is validated but not used by the library.
+	KDF KDFParams
+	// ObfuscateNames replaces file and directory names in EncryptDir output
+	// with HMAC-derived names.
+	ObfuscateNames bool
+	// Suffix is appended to encrypted names (EncryptedFileSuffix if empty),
+	// and Collisions is the policy for output names already taken.
+	Suffix     string
+	Collisions CollisionPolicy
+	// Tombstones makes SyncDir keep the encrypted files of removed sources.
+	Tombstones bool
+	// Snapshot, if set, is recorded in the manifests EncryptDir and SyncDir
+	// write.
+	Snapshot *SnapshotInfo
+	// KeyContext and KeyDeadline bound the lifetime of the key in memory.
+	KeyContext  context.Context
+	KeyDeadline time.Time
+	// ReadBack, if set, verifies the output of streams once written.
+	ReadBack *readBack
+	// nonceSource, if set, creates the reader base nonces are drawn from. It
+	// can only be set by the testhooks-only WithDeterministicNonce.
+	nonceSource func() io.Reader
 }
 
 // Option defines functional options for encryption/decryption (chunk size, progress, checksum, algorithm, etc.)
@@ -66,23 +192,12 @@ const (
 	DefaultChunkSize = 1 * 1024 * 1024 // 1MB default chunk size
 )
 
-// WithChunkSize sets the chunk size for streaming operations.
+// WithChunkSize sets the chunk size for streaming operations. Sizes outside
+// the format limits are rejected here; a lower WithMaxChunkSizeLimit is
+// enforced when the Encryptor or Decryptor is created.
 func WithChunkSize(size int) (Option, error) {
-	// Check for environment variable override; default to the format-level MaxChunkSize
-	maxChunkSize := MaxChunkSize
-	if envLimit, exists := os.LookupEnv("FILEENCRYPT_CHUNKSIZE_LIMIT"); exists {
-		if limit, err := humanize.ParseBytes(envLimit); err == nil && limit > 0 {
-			// G115: Prevent integer overflow conversion uint64 -> int
-			if limit > uint64(math.MaxInt) {
-				return nil, errors.New("FILEENCRYPT_CHUNKSIZE_LIMIT too large: exceeds int max value")
-			}
-			maxChunkSize = int(limit)
-		}
-	}
-
-	// Validate chunk size
-	if size < MinChunkSize || size > maxChunkSize {
-		return nil, errors.New("invalid chunk size: must be between 1 byte and the maximum limit")
+	if size < MinChunkSize || size > MaxChunkSize {
+		return nil, fmt.Errorf("invalid chunk size: must be between %d and %d bytes, got %d", MinChunkSize, MaxChunkSize, size)
 	}
 
 	return func(cfg *Config) {
@@ -90,28 +205,473 @@ func WithChunkSize(size int) (Option, error) {
 	}, nil
 }
 
-// WithProgress sets a progress callback (called at every 20% interval).
+// WithMaxChunkSizeLimit lowers the largest chunk size accepted from
+// WithChunkSize below the format maximum (MaxChunkSize), e.g. to bound the
+// memory used per stream in a constrained service. Decryptors also reject
+// files with larger chunks with ErrChunkSize before allocating for them, so
+// hostile files cannot force the worst case on many concurrent decryptions.
+// Zero, the default, keeps MaxChunkSize; larger limits have no effect, since
+// chunks above MaxChunkSize cannot be decrypted.
+func WithMaxChunkSizeLimit(limit int) Option {
+	return func(cfg *Config) {
+		cfg.MaxChunkSizeLimit = limit
+	}
+}
+
+// WithMaxAcceptedChunkSize caps the chunk size a Decryptor accepts from the
+// files it reads, independent of the format maximum and of the chunk sizes
+// allowed for encryption. Records holding more than size plaintext bytes
+// fail with ErrChunkSize as soon as their length prefix is read, before
+// anything is allocated for them, so an untrusted file written with 10 MiB
+// chunks cannot force 10 MiB buffers on a memory-constrained service. The
+// cap applies to streams, IndexedReader and Follow, and without an explicit
+// WithChunkSize it also shrinks the decryptor's default buffers. Zero, the
+// default, accepts every chunk size up to WithMaxChunkSizeLimit or
+// MaxChunkSize.
+func WithMaxAcceptedChunkSize(size int) Option {
+	return func(cfg *Config) {
+		cfg.MaxAcceptedChunkSize = size
+	}
+}
+
+// WithMaxChunks limits a Decryptor to n chunk records per operation: a
+// stream with more fails with ErrLimitExceeded before the next record is
+// read. Together with WithMaxInputSize and WithMaxAcceptedChunkSize it lets
+// services decrypting user uploads bound the work each upload can cause,
+// whatever its header claims. Zero, the default, sets no limit.
+func WithMaxChunks(n int64) Option {
+	return func(cfg *Config) {
+		cfg.MaxChunks = n
+	}
+}
+
+// WithMaxInputSize limits a Decryptor to size encrypted bytes per operation,
+// counting the header, records, index and trailer: an input that would take
+// it past the limit fails with ErrLimitExceeded before the record that would
+// cross it is read. Zero, the default, sets no limit.
+func WithMaxInputSize(size int64) Option {
+	return func(cfg *Config) {
+		cfg.MaxInputSize = size
+	}
+}
+
+// WithProgress sets a progress callback.
 //
 // The callback receives a fraction between 0.0 and 1.0 (inclusive), where
 // 0.0 means no progress and 1.0 means complete. Examples and documentation
-// should use fractional progress (not percentages).
+// should use fractional progress (not percentages). Encryption, decryption
+// and the other operations report alike: values never decrease, rise by at
+// least 1% between calls, and 1.0 is reported exactly once, when the
+// operation succeeds. A header recording the wrong size cannot push the
+// value past 1.0. Streams of unknown size report only completion.
 func WithProgress(cb func(float64)) Option {
 	return func(cfg *Config) {
 		cfg.Progress = cb
 	}
 }
 
-// WithChecksum enables checksum calculation/verification.
+// WithChunkCallback sets a callback called after every chunk, for
+// fine-grained dashboards or to adapt, for example backing off when chunk
+// latency rises. Unlike WithProgress it does not depend on the size being
+// known. The callback runs on the goroutine doing the I/O, so it should return
+// quickly; like the progress callback, it must be safe for concurrent use
+// when one Encryptor or Decryptor runs several operations at once.
+func WithChunkCallback(cb func(ChunkInfo)) Option {
+	return func(cfg *Config) {
+		cfg.ChunkCallback = cb
+	}
+}
+
+// WithChecksum enables checksum calculation/verification. EncryptFile and
+// EncryptFileInPlace hash the output as it is written and return the digest
+// in the OperationReport, so large files are not read a second time.
 func WithChecksum(enable bool) Option {
 	return func(cfg *Config) {
 		cfg.Checksum = enable
 	}
 }
 
-// WithAlgorithm sets the encryption algorithm (default: AES-256-GCM).
-// Currently only AlgorithmAESGCM is supported; others return an error.
+// WithChecksumHash selects the hash used for WithChecksum output checksums
+// (default: SHA-256, which uses the SHA instructions of CPUs that have them).
+// NewBLAKE2b256 is a faster choice on CPUs without SHA extensions.
+func WithChecksumHash(newHash func() hash.Hash) Option {
+	return func(cfg *Config) {
+		cfg.ChecksumHash = newHash
+	}
+}
+
+// WithChecksumSidecar makes EncryptFile and EncryptFiles write the SHA-256
+// of the plaintext or of the encrypted output to dstPath + ".sha256", hashed
+// while the file is encrypted rather than in a second pass. The sidecar is
+// in the format of sha256sum, naming the source or the output file, and is
+// written only when encryption succeeds.
+func WithChecksumSidecar(source SidecarSource) Option {
+	return func(cfg *Config) {
+		cfg.Sidecar = source
+	}
+}
+
+// WithChunkIndex makes encryption append an authenticated index of every
+// chunk record's offset and length, so NewIndexedReader can seek to any
+// position without scanning the file. The index costs 12 bytes per chunk on
+// disk and in memory while encrypting, and files that use it need a reader
+// that supports the chunk-index capability.
+func WithChunkIndex(enable bool) Option {
+	return func(cfg *Config) {
+		cfg.ChunkIndex = enable
+	}
+}
+
+// WithChunkDigests adds a chunk index, as WithChunkIndex does, whose entries
+// also carry the SHA-256 of each chunk record as stored. A copy of the file
+// can then be verified chunk by chunk by comparing the digests of its byte
+// ranges with IndexedReader.ChunkDigests, without downloading or decrypting
+// it (see CompareChunkDigests). The digests cost 32 bytes per chunk on top of
+// the index, and files that use them need a reader that supports the
+// chunk-digests capability.
+func WithChunkDigests(enable bool) Option {
+	return func(cfg *Config) {
+		cfg.ChunkDigests = enable
+	}
+}
+
+// WithPipeline makes encryption read the source, seal chunks and write the
+// output in separate goroutines, with up to depth chunks queued between each
+// stage, so slow disks and network filesystems are kept busy while sealing.
+// Output is identical to sequential encryption. Each stream then uses up to
+// 2*depth+3 chunk buffers. Depth 0 (the default) encrypts sequentially in the
+// calling goroutine; 2 is usually enough to double-buffer. Decryption and
+// EncryptReader, which encrypts as it is read, are not affected.
+func WithPipeline(depth int) Option {
+	return func(cfg *Config) {
+		cfg.Pipeline = depth
+	}
+}
+
+// ParallelismAuto makes WithParallelism size the pool of sealing goroutines
+// by itself.
+const ParallelismAuto = -1
+
+// WithParallelism seals the chunks of a pipelined encryption (see
+// WithPipeline) in workers goroutines instead of one, so that one stream
+// can use several cores when the source and destination are faster than a
+// single core seals. Output is identical whatever the count.
+//
+// With ParallelismAuto, each stream starts with one worker and measures
+// where chunks wait: while chunks read from the source queue up waiting to
+// be sealed, sealing is the bottleneck and the workers are doubled, up to
+// GOMAXPROCS or one per CPU given to WithCPUAffinity; while the workers wait
+// for the source or for the output to be written, one is retired. The count follows the bottleneck as it moves,
+// such as when a network destination slows down, and
+// OperationReport.SealWorkers records where it ended.
+func WithParallelism(workers int) Option {
+	return func(cfg *Config) {
+		cfg.Parallelism = workers
+	}
+}
+
+// WithPriority lowers the CPU and I/O priority of operations so background
+// jobs do not slow down foreground services on the same host. It uses
+// per-thread nice and ioprio_set(2) on Linux, the background band on macOS
+// and background mode on Windows; other platforms ignore it. Each operation
+// runs on its own OS thread, which is discarded afterwards, so the priority
+// never leaks to other goroutines. Streams read through EncryptReader and
+// DecryptReader are not affected.
+func WithPriority(p Priority) Option {
+	return func(cfg *Config) {
+		cfg.Priority = p
+	}
+}
+
+// WithChunkDelay pauses for d after each chunk is written, spreading the I/O
+// of long-running operations over time. Cancelling the context ends a pause
+// early.
+func WithChunkDelay(d time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.ChunkDelay = d
+	}
+}
+
+// WithTimeout fails each operation that takes longer than d with ErrTimeout.
+// Every file of EncryptFiles and DecryptFiles gets its own timeout; a
+// directory operation shares one. The caller's context still applies.
+func WithTimeout(d time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.Timeout = d
+	}
+}
+
+// WithChunkDeadline fails an operation with ErrTimeout when no chunk is
+// completed within d, detecting stalled disks and network mounts without
+// limiting how long a large file may take. Pauses from WithChunkDelay do not
+// count towards it.
+func WithChunkDeadline(d time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.ChunkDeadline = d
+	}
+}
+
+// WithPadding pads the plaintext of every file and stream with zero bytes
+// according to scheme, PaddingPadme or PaddingBucket, so that the size of
+// the encrypted output does not reveal the exact plaintext size. The header
+// marks the file as padded and records size 0; the true size is only stored
+// in the authenticated trailer, and decryption removes the padding. Padded
+// files cannot have a chunk index and are not readable by versions that do
+// not know the padded flag.
+func WithPadding(scheme PaddingScheme) Option {
+	return func(cfg *Config) {
+		cfg.Padding = scheme
+	}
+}
+
+// WithBackupHeader appends a copy of the header after the trailer of every
+// encrypted file and stream, so that a file whose first sector is damaged
+// remains readable. DecryptFile and VerifyFile fall back to the copy when the
+// header at the start of the file is unreadable or does not match it, using
+// whichever one authenticates the trailer. The copy costs HeaderSize bytes
+// per file, and files written with it are not readable by versions that do
+// not know the backup-header flag.
+func WithBackupHeader(enable bool) Option {
+	return func(cfg *Config) {
+		cfg.BackupHeader = enable
+	}
+}
+
+// WithHeaderCRC follows the header of every encrypted file and stream with a
+// CRC-32C of its fields. Readers check it before anything else and report a
+// mismatch as ErrHeaderCorrupted, so a damaged header is told apart from a
+// wrong key (ErrWrongKey) and from damaged chunks (ErrCorruptedFile) without
+// decrypting anything. The checksum costs 4 bytes per file, and files written
+// with it are not readable by versions that do not know the header-crc flag.
+func WithHeaderCRC(enable bool) Option {
+	return func(cfg *Config) {
+		cfg.HeaderCRC = enable
+	}
+}
+
+// WithMultiSegment makes decryptors accept input that is several encrypted
+// files or streams concatenated, as produced by stitching together separately
+// encrypted parts of an upload, and decrypt them one after another into a
+// single output. Each segment is authenticated on its own and must have been
+// encrypted with the decryptor's key. A segment ends after its trailer or, for
+// files without one, where the header of the next segment starts.
+//
+// Size hints and the size look-ahead of DecryptFile apply to single files and
+// are ignored, the backup header of WithBackupHeader is not used for
+// recovery, and progress is reported for the current segment.
+func WithMultiSegment(enable bool) Option {
+	return func(cfg *Config) {
+		cfg.MultiSegment = enable
+	}
+}
+
+// streamFlags returns the header flags of the layout options of cfg, which
+// are added to headerFlags.
+func (cfg *Config) streamFlags() format.Flags {
+	flags := cfg.Algorithm.id().Flags()
+	if cfg.ChunkIndex {
+		flags |= format.FlagChunkIndex
+	}
+	if cfg.ChunkDigests {
+		flags |= format.FlagChunkIndex | format.FlagChunkDigests
+	}
+	if cfg.Padding != nil {
+		flags |= format.FlagPadded
+	}
+	if cfg.BackupHeader {
+		flags |= format.FlagBackupHeader
+	}
+	if cfg.HeaderCRC {
+		flags |= format.FlagHeaderCRC
+	}
+	return flags
+}
+
+// WithPreallocate reserves the predicted size of each output file before
+// writing it, so that a full disk fails with ErrNoSpace before any work is
+// done rather than part way through. The reservation uses fallocate on Linux
+// and F_PREALLOCATE on macOS and is skipped on other platforms and on
+// filesystems that do not support it. Decryption reserves space only for
+// files whose plaintext size is recorded in the header or trailer.
+func WithPreallocate(enable bool) Option {
+	return func(cfg *Config) {
+		cfg.Preallocate = enable
+	}
+}
+
+// WithAlgorithm sets the encryption algorithm (default: AES-256-GCM), which
+// is recorded in the header of every file written. A Decryptor takes the
+// algorithm from each file instead, so for decryption alg only restricts the
+// files accepted, as WithAllowedAlgorithms does with alg alone. Currently only AlgorithmAESGCM is supported; others
+// return an error.
 func WithAlgorithm(alg Algorithm) Option {
 	return func(cfg *Config) {
 		cfg.Algorithm = alg
+		cfg.Algorithms = []Algorithm{alg}
+	}
+}
+
+// WithAllowedAlgorithms restricts a Decryptor to files sealed with one of
+// algs, as recorded in their headers. Any other file fails with an
+// *AlgorithmError matching ErrAlgorithmNotAllowed before a record is
+// opened, so consumers can enforce an algorithm policy on untrusted input.
+// It replaces the restriction set by WithAlgorithm; encryption ignores it.
+// algs must name at least one algorithm.
+func WithAllowedAlgorithms(algs []Algorithm) Option {
+	return func(cfg *Config) {
+		cfg.Algorithms = append([]Algorithm{}, algs...)
+	}
+}
+
+// WithErrorDetail sets how much context returned errors carry: standard
+// (default), sanitized user-safe messages, or verbose diagnostics including
+// the file path and chunk number.
+func WithErrorDetail(level ErrorDetail) Option {
+	return func(cfg *Config) {
+		cfg.ErrorDetail = level
+	}
+}
+
+// WithReport fills r with an OperationReport each time an EncryptFile,
+// EncryptStream, DecryptFile or DecryptStream call returns. The report is
+// overwritten by every call. When calls run concurrently, each leaves a
+// whole report and the last to finish wins; read r directly only once they
+// have returned, and use Encryptor.Report or Decryptor.Report while they
+// run. An Encryptor and a Decryptor must not share one report.
+func WithReport(r *OperationReport) Option {
+	return func(cfg *Config) {
+		cfg.Report = r
+	}
+}
+
+// WithPlaintextHash computes a digest of the plaintext while it is encrypted
+// or decrypted, using a hash created by newHash (e.g. sha256.New), and
+// returns it in OperationReport.PlaintextHash. This avoids a second read of
+// the source for checksum sidecars. Combine it with WithReport.
+func WithPlaintextHash(newHash func() hash.Hash) Option {
+	return func(cfg *Config) {
+		cfg.PlaintextHash = newHash
+	}
+}
+
+// WithManifest makes EncryptDir write a manifest to path listing each file's
+// relative path, size, plaintext hash and ciphertext hash. The manifest is
+// signed with HMAC-SHA256 using a key derived from the encryption key, and can
+// be checked later with Decryptor.VerifyManifest. On a Decryptor, DecryptDir
+// reads the manifest at path to restore names obfuscated with
+// WithObfuscatedNames.
+func WithManifest(path string) Option {
+	return func(cfg *Config) {
+		cfg.Manifest = path
+	}
+}
+
+// WithNonceManager draws the base nonce of every stream, log and record from
+// m instead of crypto/rand, so nonces are unique by construction across all
+// Encryptors and processes sharing m's counter file, and encryption fails
+// with ErrKeyExhausted once m's limit is reached. m must only be used with
+// one key.
+func WithNonceManager(m *NonceManager) Option {
+	return func(cfg *Config) {
+		cfg.NonceManager = m
+	}
+}
+
+// WithRand draws the base nonce of every stream, log and record, and the IV
+// of masked output, from r instead of crypto/rand, for hardware RNGs, FIPS
+// DRBGs or deterministic tests. Reads are serialized, so r need not be safe
+// for concurrent use. WithNonceManager takes precedence over it for nonces.
+//
+// Every nonce must be unique under a key: a reader that can repeat its
+// output, such as a seeded test generator shared by two encryptors, reuses
+// nonces and destroys the confidentiality and integrity of the files
+// involved. Use only cryptographically secure sources for real data.
+func WithRand(r io.Reader) Option {
+	return func(cfg *Config) {
+		cfg.Rand = r
+	}
+}
+
+// WithKeyLimits makes an Encryptor refuse to start new messages once the key
+// has encrypted limits.Messages messages or limits.Bytes bytes (the AES-GCM
+// defaults when zero), calling limits.Warn as the limits are approached.
+// Usage is always counted and can be queried with Encryptor.Usage; with
+// limits.Path it is persisted and shared across Encryptors and processes.
+func WithKeyLimits(limits KeyLimits) Option {
+	return func(cfg *Config) {
+		cfg.KeyLimits = &limits
+	}
+}
+
+// WithAuditSink sends an AuditEvent to sink when each encrypt, decrypt,
+// verify or migrate operation finishes, successfully or not. Events identify
+// the file by a hash of its path and the key by a fingerprint, and carry the
+// actor attached to the context with ContextWithActor.
+func WithAuditSink(sink AuditSink) Option {
+	return func(cfg *Config) {
+		cfg.AuditSink = sink
+	}
+}
+
+// WithDryRun makes EncryptFile, EncryptFiles and EncryptDir add the files
+// they would encrypt to plan, with their sizes, estimated encrypted sizes and
+// whether each destination already exists, without creating, modifying or
+// encrypting anything. Sources must exist and be regular files. Plans
+// accumulate across calls; no report or audit event is produced.
+func WithDryRun(plan *DryRunPlan) Option {
+	return func(cfg *Config) {
+		cfg.DryRun = plan
+	}
+}
+
+// WithObfuscatedNames makes EncryptDir replace every file and directory name
+// with a deterministic name derived from the key with HMAC-SHA256, so
+// directory listings do not reveal document titles. The real names are kept
+// only in the manifest, which is then encrypted rather than merely signed;
+// WithManifest is required. Decrypt with a Decryptor configured with the same
+// manifest path to restore the names. Links kept with SymlinkPreserve are not
+// listed in the manifest and keep their obfuscated names.
+func WithObfuscatedNames(enable bool) Option {
+	return func(cfg *Config) {
+		cfg.ObfuscateNames = enable
+	}
+}
+
+// WithInclude restricts batch and directory operations to files matching at
+// least one pattern. Patterns are slash-separated globs matched against the
+// path relative to the directory root (or the item's source path for batch
+// operations). A pattern without a slash matches the base name at any depth,
+// and "**" matches any number of directories, e.g. "*.pdf" or "docs/**/*.md".
+func WithInclude(patterns ...string) Option {
+	return func(cfg *Config) {
+		cfg.Include = append(cfg.Include, patterns...)
+	}
+}
+
+// WithExclude skips files matching any pattern, using the same syntax as
+// WithInclude. Directories matching an exclude pattern are skipped entirely.
+// Exclusion takes precedence over inclusion.
+func WithExclude(patterns ...string) Option {
+	return func(cfg *Config) {
+		cfg.Exclude = append(cfg.Exclude, patterns...)
+	}
+}
+
+// WithFilter skips files for which pred returns false, e.g. to only encrypt
+// files above a size threshold. It is applied after WithInclude and
+// WithExclude.
+func WithFilter(pred func(fs.FileInfo) bool) Option {
+	return func(cfg *Config) {
+		cfg.Filter = pred
+	}
+}
+
+// WithSymlinkPolicy sets how EncryptDir and DecryptDir treat symbolic links:
+// skip them (default), follow them, or preserve them as links. Filters are
+// matched against the link's path; with SymlinkFollow, WithFilter receives the
+// target's file info.
+func WithSymlinkPolicy(policy SymlinkPolicy) Option {
+	return func(cfg *Config) {
+		cfg.Symlinks = policy
 	}
 }
@@ -7,7 +7,6 @@
 package core
 
 import (
-	"os"
 	"testing"
 )
 
@@ -80,40 +79,67 @@ func TestWithChunkSize(t *testing.T) {
 	}
 }
 
-func TestWithChunkSize_EnvOverride(t *testing.T) {
+func TestWithMaxChunkSizeLimit(t *testing.T) {
 	tests := []struct {
-		name          string
-		envValue      string
-		chunkSize     int
-		expectedLimit int
-		expectError   bool
+		name        string
+		limit       int
+		chunkSize   int
+		expectError bool
 	}{
-		{"Valid 50MB override", "50MB", 1024 * 1024, 50 * 1024 * 1024, false},
-		{"Invalid override", "invalid", 1024 * 1024, 10 * 1024 * 1024, true},
-		{"Unset environment", "", 1024 * 1024, 10 * 1024 * 1024, false},
+		{"Within limit", 1024 * 1024, 1024 * 1024, false},
+		{"Above limit", 64 * 1024, 1024 * 1024, true},
+		{"Limit above format maximum", 50 * 1024 * 1024, MaxChunkSize, false},
+		{"No limit", 0, MaxChunkSize, false},
+		{"Negative limit", -1, 1024, true},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if tt.envValue != "" {
-				os.Setenv("FILEENCRYPT_CHUNKSIZE_LIMIT", tt.envValue)
-				defer os.Unsetenv("FILEENCRYPT_CHUNKSIZE_LIMIT")
-			}
-
-			cfg := &Config{}
-			topt, err := WithChunkSize(tt.chunkSize)
+			opt, err := WithChunkSize(tt.chunkSize)
 			if err != nil {
 				t.Fatalf("WithChunkSize returned an error: %v", err)
 			}
-			topt(cfg)
+			cfg := &Config{Algorithm: AlgorithmAESGCM}
+			opt(cfg)
+			WithMaxChunkSizeLimit(tt.limit)(cfg)
 
-			if cfg.ChunkSize > tt.expectedLimit {
-				t.Errorf("ChunkSize exceeded limit: got %d, expected %d", cfg.ChunkSize, tt.expectedLimit)
+			if err := cfg.Validate(); (err != nil) != tt.expectError {
+				t.Errorf("Validate() error = %v, expectError %v", err, tt.expectError)
 			}
 		})
 	}
 }
 
+func TestWithChunkSize_IgnoresEnv(t *testing.T) {
+	t.Setenv("FILEENCRYPT_CHUNKSIZE_LIMIT", "64KiB")
+
+	opt, err := WithChunkSize(1024 * 1024)
+	if err != nil {
+		t.Fatalf("WithChunkSize read the environment: %v", err)
+	}
+	cfg := &Config{Algorithm: AlgorithmAESGCM}
+	opt(cfg)
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate read the environment: %v", err)
+	}
+
+	// The limit only applies once loaded with FromEnv.
+	if err := cfg.FromEnv(); err != nil {
+		t.Fatalf("FromEnv failed: %v", err)
+	}
+	if cfg.MaxChunkSizeLimit != 64*1024 {
+		t.Errorf("limit not loaded: got %d", cfg.MaxChunkSizeLimit)
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected chunk size above the loaded limit to be rejected")
+	}
+
+	t.Setenv("FILEENCRYPT_CHUNKSIZE_LIMIT", "invalid")
+	if err := cfg.FromEnv(); err == nil {
+		t.Error("expected error for malformed FILEENCRYPT_CHUNKSIZE_LIMIT")
+	}
+}
+
 func TestAlgorithm_String(t *testing.T) {
 	tests := []struct {
 		algo     Algorithm
@@ -165,3 +191,28 @@ func TestWithAlgorithm(t *testing.T) {
 		t.Errorf("Algorithm not set correctly: expected %v, got %v", AlgorithmChaCha20Poly1305, cfg.Algorithm)
 	}
 }
+
+func TestRecommendedAlgorithm(t *testing.T) {
+	caps := Capabilities()
+	if caps.Arch == "" {
+		t.Error("Capabilities did not report an architecture")
+	}
+	if caps.AESGCMAccelerated && caps.Arch != "s390x" && !(caps.AES && caps.CarrylessMultiply) {
+		t.Errorf("AES-GCM reported accelerated without AES and carry-less multiply: %+v", caps)
+	}
+	if alg := RecommendedAlgorithm(); !alg.IsSupported() {
+		t.Errorf("RecommendedAlgorithm returned unsupported %v", alg)
+	}
+
+	// ChaCha20-Poly1305 is only recommended once it is implemented.
+	want := AlgorithmAESGCM
+	if AlgorithmChaCha20Poly1305.IsSupported() {
+		want = AlgorithmChaCha20Poly1305
+	}
+	if got := recommendAlgorithm(CPUCapabilities{}); got != want {
+		t.Errorf("without acceleration: expected %v, got %v", want, got)
+	}
+	if got := recommendAlgorithm(CPUCapabilities{AES: true, CarrylessMultiply: true, AESGCMAccelerated: true}); got != AlgorithmAESGCM {
+		t.Errorf("with acceleration: expected %v, got %v", AlgorithmAESGCM, got)
+	}
+}
@@ -0,0 +1,198 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// padding.go: Plaintext padding that hides exact file sizes
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"sync/atomic"
+)
+
+// PaddingScheme chooses how much padding WithPadding adds.
+type PaddingScheme interface {
+	// PaddedSize returns the size, at least size, that size plaintext bytes
+	// are padded to. It must depend on nothing but size.
+	PaddedSize(size int64) int64
+}
+
+// PaddingPadme is the Padmé scheme of Nikitin et al. ("Reducing Metadata
+// Leakage from Encrypted Files and Communication with PURBs", 2019). It
+// rounds sizes to a floating-point-like representation, adding at most 12%
+// and leaking O(log log size) bits of the size.
+var PaddingPadme PaddingScheme = padme{}
+
+type padme struct{}
+
+func (padme) PaddedSize(size int64) int64 {
+	if size < 2 {
+		return size
+	}
+	e := bits.Len64(uint64(size)) - 1 // #nosec G115 -- size is positive
+	s := bits.Len(uint(e))
+	mask := int64(1)<<(e-s) - 1
+	if size > math.MaxInt64-mask {
+		return size
+	}
+	return (size + mask) &^ mask
+}
+
+// PaddingBucket pads sizes up to the next multiple of size bytes, so files
+// in the same bucket cannot be told apart. Empty files are padded to one
+// bucket. size must be positive.
+func PaddingBucket(size int64) PaddingScheme {
+	return bucketPadding(size)
+}
+
+type bucketPadding int64
+
+func (b bucketPadding) PaddedSize(size int64) int64 {
+	bucket := int64(b)
+	if bucket <= 0 || size > math.MaxInt64-bucket {
+		return size
+	}
+	return max(bucket, (size+bucket-1)/bucket*bucket)
+}
+
+// checkPadding reports a padding scheme that cannot be used.
+func checkPadding(p PaddingScheme) error {
+	if b, ok := p.(bucketPadding); ok && b <= 0 {
+		return fmt.Errorf("invalid padding bucket size %d", b)
+	}
+	return nil
+}
+
+// paddedSize returns size padded with p, or size when p is nil.
+func paddedSize(p PaddingScheme, size int64) int64 {
+	if p == nil {
+		return size
+	}
+	return max(size, p.PaddedSize(size))
+}
+
+// paddingReader appends the padding of scheme to src as zero bytes. Every
+// Read fills p completely until the padded end, so the last chunk of data
+// is never cut short, which would reveal the exact size through its record
+// length.
+type paddingReader struct {
+	src    io.Reader
+	scheme PaddingScheme
+	read   int64
+	pad    int64
+	// size is the data size once src has ended, and -1 before. It is read
+	// by the goroutine consuming chunks while a pipeline reads ahead.
+	size atomic.Int64
+}
+
+func newPaddingReader(src io.Reader, scheme PaddingScheme) *paddingReader {
+	r := &paddingReader{src: src, scheme: scheme}
+	r.size.Store(-1)
+	return r
+}
+
+func (r *paddingReader) Read(p []byte) (int, error) {
+	var n int
+	if r.size.Load() < 0 {
+		m, err := io.ReadFull(r.src, p)
+		r.read += int64(m)
+		n = m
+		if err == nil {
+			return n, nil
+		}
+		if err != io.EOF && err != io.ErrUnexpectedEOF {
+			return n, err
+		}
+		r.pad = paddedSize(r.scheme, r.read) - r.read
+		r.size.Store(r.read)
+	}
+	fill := int(min(r.pad, int64(len(p)-n)))
+	clear(p[n : n+fill])
+	r.pad -= int64(fill)
+	n += fill
+	if r.pad == 0 {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// dataLen returns how many of the n padded bytes starting at offset are data
+// rather than padding. It may only be called for bytes already read.
+func (r *paddingReader) dataLen(offset int64, n int) int {
+	size := r.size.Load()
+	if size < 0 {
+		return n
+	}
+	return int(min(int64(n), max(0, size-offset)))
+}
+
+// paddingFilter removes the padding from the plaintext of a padded stream.
+// The padding is a run of zero bytes after the data, so zero bytes at the
+// end of each chunk are held back until other data follows them or the
+// trailer tells how many of them are data. Only their number is kept.
+type paddingFilter struct {
+	// zeros counts the held-back zero bytes, which come before held; tail
+	// counts the zero bytes that end the chunk held is from.
+	zeros int64
+	held  []byte
+	tail  int64
+	// size is the data size from the trailer, set by end.
+	size  int64
+	ended bool
+	zero  []byte
+}
+
+// next returns the next data from the chunks returned by record, valid until
+// the following call, or io.EOF after the data.
+func (f *paddingFilter) next(record func() ([]byte, error)) ([]byte, error) {
+	for {
+		if f.zeros > 0 && (f.held != nil || f.ended) {
+			if f.zero == nil {
+				f.zero = make([]byte, 64*1024)
+			}
+			n := min(f.zeros, int64(len(f.zero)))
+			f.zeros -= n
+			return f.zero[:n], nil
+		}
+		if f.held != nil {
+			p := f.held
+			f.held, f.zeros, f.tail = nil, f.tail, 0
+			return p, nil
+		}
+		if f.ended {
+			return nil, io.EOF
+		}
+		p, err := record()
+		if err == io.EOF && f.ended {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		data := bytes.TrimRight(p, "\x00")
+		if len(data) == 0 {
+			f.zeros += int64(len(p))
+			continue
+		}
+		f.held, f.tail = data, int64(len(p)-len(data))
+	}
+}
+
+// end accepts the data size recorded in the trailer if everything after it
+// in the opened plaintext bytes is held-back zeros, and reports whether it
+// did.
+func (f *paddingFilter) end(size, opened int64) bool {
+	data := opened - f.zeros
+	if size < data || size > opened {
+		return false
+	}
+	f.zeros = size - data
+	f.size, f.ended = size, true
+	return true
+}
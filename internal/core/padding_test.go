@@ -0,0 +1,223 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+
+	"github.com/gitrgoliveira/go-fileencrypt/format"
+)
+
+func TestPaddingSchemes(t *testing.T) {
+	padme := map[int64]int64{0: 0, 1: 1, 2: 2, 9: 10, 1000: 1024, 1 << 20: 1 << 20, 1<<20 + 1: 1<<20 + 1<<15}
+	for size, want := range padme {
+		if got := PaddingPadme.PaddedSize(size); got != want {
+			t.Errorf("Padmé(%d) = %d, want %d", size, got, want)
+		}
+	}
+	for size := int64(1); size < 1<<16; size += 997 {
+		got := PaddingPadme.PaddedSize(size)
+		if got < size || float64(got-size) > 0.12*float64(size) {
+			t.Errorf("Padmé(%d) = %d: outside [size, size+12%%]", size, got)
+		}
+	}
+
+	bucket := map[int64]int64{0: 4096, 1: 4096, 4096: 4096, 4097: 8192}
+	for size, want := range bucket {
+		if got := PaddingBucket(4096).PaddedSize(size); got != want {
+			t.Errorf("PaddingBucket(4096)(%d) = %d, want %d", size, got, want)
+		}
+	}
+
+	key := make([]byte, 32)
+	if _, err := NewEncryptor(key, WithPadding(PaddingBucket(0))); err == nil {
+		t.Error("expected error for an empty bucket")
+	}
+	if _, err := NewEncryptor(key, WithPadding(PaddingPadme), WithChunkIndex(true)); err == nil {
+		t.Error("expected error for padding with a chunk index")
+	}
+}
+
+func TestWithPadding_RoundTrip(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	const chunkSize = 100
+	chunkOpt, err := WithChunkSize(chunkSize)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	tmpDir := t.TempDir()
+	src := filepath.Join(tmpDir, "src")
+	encrypted := filepath.Join(tmpDir, "src.enc")
+	decrypted := filepath.Join(tmpDir, "src.dec")
+
+	for _, scheme := range []PaddingScheme{PaddingPadme, PaddingBucket(1000)} {
+		for _, pipeline := range []int{0, 2} {
+			opts := []Option{chunkOpt, WithPadding(scheme), WithPipeline(pipeline)}
+			enc, err := NewEncryptor(key, opts...)
+			if err != nil {
+				t.Fatalf("NewEncryptor failed: %v", err)
+			}
+			defer enc.Destroy()
+			dec, err := NewDecryptor(key, opts...)
+			if err != nil {
+				t.Fatalf("NewDecryptor failed: %v", err)
+			}
+			defer dec.Destroy()
+
+			for _, size := range []int{0, 1, 99, 100, 101, 950, 5000} {
+				// Data ending in zeros, with an all-zero chunk in the middle,
+				// must not lose bytes to the padding.
+				data := make([]byte, size)
+				if _, err := rand.Read(data); err != nil {
+					t.Fatalf("failed to generate data: %v", err)
+				}
+				clear(data[size/2 : min(size, size/2+2*chunkSize)])
+				clear(data[size-size/10:])
+				if err := os.WriteFile(src, data, 0600); err != nil {
+					t.Fatalf("failed to write source: %v", err)
+				}
+
+				var report OperationReport
+				enc.report = &report
+				enc.plainHash = sha256.New
+				if err := enc.EncryptFile(context.Background(), src, encrypted); err != nil {
+					t.Fatalf("EncryptFile failed: %v", err)
+				}
+				enc.report, enc.plainHash = nil, nil
+				if report.PlaintextBytes != int64(size) {
+					t.Errorf("%T size %d: report counts %d plaintext bytes", scheme, size, report.PlaintextBytes)
+				}
+				if sum := sha256.Sum256(data); !bytes.Equal(report.PlaintextHash, sum[:]) {
+					t.Errorf("%T size %d: plaintext hash covers the padding", scheme, size)
+				}
+
+				ciphertext, err := os.ReadFile(encrypted)
+				if err != nil {
+					t.Fatalf("ReadFile failed: %v", err)
+				}
+				if want := encryptedSize(scheme.PaddedSize(int64(size)), chunkSize, false); int64(len(ciphertext)) != want {
+					t.Errorf("%T size %d: encrypted size %d, want %d", scheme, size, len(ciphertext), want)
+				}
+				h, err := format.ParseHeader(ciphertext)
+				if err != nil {
+					t.Fatalf("ParseHeader failed: %v", err)
+				}
+				if h.Flags&format.FlagPadded == 0 || h.Size != 0 {
+					t.Errorf("%T size %d: header has flags %v and size %d", scheme, size, h.Flags, h.Size)
+				}
+
+				if err := dec.DecryptFile(context.Background(), encrypted, decrypted); err != nil {
+					t.Fatalf("%T size %d: DecryptFile failed: %v", scheme, size, err)
+				}
+				got, err := os.ReadFile(decrypted)
+				if err != nil {
+					t.Fatalf("ReadFile failed: %v", err)
+				}
+				if !bytes.Equal(got, data) {
+					t.Errorf("%T size %d, pipeline %d: decrypted %d bytes, want %d", scheme, size, pipeline, len(got), size)
+				}
+
+				r, err := dec.DecryptReader(context.Background(), iotest.HalfReader(bytes.NewReader(ciphertext)))
+				if err != nil {
+					t.Fatalf("DecryptReader failed: %v", err)
+				}
+				if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, data) {
+					t.Errorf("%T size %d: DecryptReader returned %d bytes, %v", scheme, size, len(got), err)
+				}
+			}
+		}
+	}
+}
+
+func TestWithPadding_Streams(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	chunkOpt, err := WithChunkSize(64)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	enc, err := NewEncryptor(key, chunkOpt, WithPadding(PaddingBucket(500)))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+
+	want := encryptedSize(500, 64, false)
+	for _, size := range []int{1, 200, 499} {
+		data := bytes.Repeat([]byte{1, 0}, size)[:size]
+
+		// Short reads from the source must not leave a short chunk behind.
+		var stream bytes.Buffer
+		if err := enc.EncryptStream(context.Background(), iotest.HalfReader(bytes.NewReader(data)), &stream, int64(size)); err != nil {
+			t.Fatalf("EncryptStream failed: %v", err)
+		}
+		r, err := enc.EncryptReader(context.Background(), iotest.OneByteReader(bytes.NewReader(data)))
+		if err != nil {
+			t.Fatalf("EncryptReader failed: %v", err)
+		}
+		viaReader, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("EncryptReader failed: %v", err)
+		}
+
+		for name, ciphertext := range map[string][]byte{"EncryptStream": stream.Bytes(), "EncryptReader": viaReader} {
+			if int64(len(ciphertext)) != want {
+				t.Errorf("%s size %d: encrypted size %d, want %d", name, size, len(ciphertext), want)
+			}
+			var out bytes.Buffer
+			if err := dec.DecryptStream(context.Background(), bytes.NewReader(ciphertext), &out); err != nil {
+				t.Fatalf("%s size %d: DecryptStream failed: %v", name, size, err)
+			}
+			if !bytes.Equal(out.Bytes(), data) {
+				t.Errorf("%s size %d: decrypted %d bytes, want %d", name, size, out.Len(), size)
+			}
+		}
+	}
+}
+
+func TestWithPadding_IndexedReaderRejects(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	enc, err := NewEncryptor(key, WithPadding(PaddingPadme))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	var buf bytes.Buffer
+	if err := enc.EncryptStream(context.Background(), bytes.NewReader([]byte("padded")), &buf); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	if _, err := dec.NewIndexedReader(bytes.NewReader(buf.Bytes()), int64(buf.Len())); !errors.Is(err, ErrUnsupportedFeature) {
+		t.Errorf("expected ErrUnsupportedFeature, got %v", err)
+	}
+}
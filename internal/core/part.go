@@ -0,0 +1,139 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// part.go: Splitting a plaintext into independently decryptable parts
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/gitrgoliveira/go-fileencrypt/format"
+)
+
+// PartSet describes the split of a plaintext of Size bytes into parts of
+// PartSize plaintext bytes, the last one possibly shorter. Each part is
+// encrypted on its own into a complete file whose header records the set ID,
+// the part's index and the number of parts, so parts can be encrypted and
+// uploaded in parallel and a failed one retried alone. Any part decrypts with
+// DecryptFile or DecryptStream; JoinParts decrypts a whole set and rejects
+// parts that are missing, out of order or from another split.
+type PartSet struct {
+	// ID is the random identifier shared by the parts.
+	ID [16]byte
+	// Size is the plaintext size.
+	Size int64
+	// PartSize is the plaintext size of every part but the last.
+	PartSize int64
+}
+
+// NewPartSet returns a PartSet with a new random ID for splitting size bytes
+// into parts of partSize bytes. An empty plaintext has one empty part.
+func NewPartSet(size, partSize int64) (PartSet, error) {
+	if size < 0 {
+		return PartSet{}, fmt.Errorf("invalid size %d", size)
+	}
+	if partSize <= 0 {
+		return PartSet{}, fmt.Errorf("invalid part size %d: must be positive", partSize)
+	}
+	set := PartSet{Size: size, PartSize: partSize}
+	if set.count() > math.MaxUint32 {
+		return PartSet{}, fmt.Errorf("part size %d too small: %d parts, maximum %d", partSize, set.count(), uint32(math.MaxUint32))
+	}
+	if _, err := rand.Read(set.ID[:]); err != nil {
+		return PartSet{}, fmt.Errorf("failed to generate part set ID: %w", err)
+	}
+	return set, nil
+}
+
+// Count returns the number of parts.
+func (s PartSet) Count() int {
+	return int(s.count())
+}
+
+func (s PartSet) count() int64 {
+	if s.PartSize <= 0 {
+		return 0
+	}
+	n := s.Size / s.PartSize
+	if s.Size%s.PartSize != 0 {
+		n++
+	}
+	return max(n, 1)
+}
+
+// Part returns the offset and plaintext size of part index.
+func (s PartSet) Part(index int) (offset, size int64) {
+	offset = int64(index) * s.PartSize
+	return offset, min(s.PartSize, s.Size-offset)
+}
+
+// EncryptPart encrypts part index of set, read from src, to dst. Each call
+// uses a fresh nonce, so a part can be encrypted again to retry its upload.
+//
+// set need not come from NewPartSet, so it is checked again here.
+func (e *Encryptor) EncryptPart(ctx context.Context, set PartSet, src io.ReaderAt, index int, dst io.Writer) error {
+	if set.Size < 0 || set.PartSize <= 0 {
+		return fmt.Errorf("invalid part set: size %d, part size %d", set.Size, set.PartSize)
+	}
+	count := set.count()
+	if count > math.MaxUint32 {
+		return fmt.Errorf("invalid part set: %d parts, maximum %d", count, uint32(math.MaxUint32))
+	}
+	if index < 0 || int64(index) >= count {
+		return fmt.Errorf("part index %d out of range: set has %d parts", index, count)
+	}
+	offset, size := set.Part(index)
+	part := &format.Part{
+		Set:   set.ID,
+		Index: uint32(index), // #nosec G115 -- below count
+		Count: uint32(count), // #nosec G115 -- checked above
+	}
+	return e.runEncryptStream(ctx, io.NewSectionReader(src, offset, size), dst, size, part)
+}
+
+// JoinParts decrypts the parts of one set, given in index order, to dst.
+// Before decrypting a part it checks that the part belongs to the same set as
+// the first and has the expected index, and that the set has len(parts)
+// parts; otherwise it fails with ErrPartMismatch. The part descriptors are
+// authenticated with the data, so they cannot be altered. Use
+// format.ReadHeader to find the index of a part whose name has been lost.
+func (d *Decryptor) JoinParts(ctx context.Context, parts []io.Reader, dst io.Writer) error {
+	if len(parts) == 0 {
+		return fmt.Errorf("%w: no parts", ErrPartMismatch)
+	}
+	var set [16]byte
+	for i, src := range parts {
+		src = d.Unmask(src)
+		var buf headerBuf
+		h, header, err := readHeader(src, &buf)
+		if err != nil {
+			return fmt.Errorf("part %d: %w", i, err)
+		}
+		if h.Flags&format.FlagPart == 0 {
+			return fmt.Errorf("%w: part %d is not part of a split", ErrPartMismatch, i)
+		}
+		if i == 0 {
+			set = h.Part.Set
+		}
+		switch {
+		case h.Part.Set != set:
+			return fmt.Errorf("%w: part %d is from another set", ErrPartMismatch, i)
+		case int64(h.Part.Count) != int64(len(parts)):
+			return fmt.Errorf("%w: set has %d parts, got %d", ErrPartMismatch, h.Part.Count, len(parts))
+		case int64(h.Part.Index) != int64(i):
+			return fmt.Errorf("%w: part %d given as part %d", ErrPartMismatch, h.Part.Index, i)
+		}
+		if err := d.DecryptStream(ctx, io.MultiReader(bytes.NewReader(header), src), dst); err != nil {
+			return fmt.Errorf("part %d: %w", i, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// part_test.go: Tests for splitting a plaintext into parts
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/gitrgoliveira/go-fileencrypt/format"
+)
+
+func TestEncryptPart(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	enc, err := NewEncryptor(key)
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+
+	data := make([]byte, 250*1024)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("failed to generate data: %v", err)
+	}
+	set, err := NewPartSet(int64(len(data)), 100*1024)
+	if err != nil {
+		t.Fatalf("NewPartSet failed: %v", err)
+	}
+	if set.Count() != 3 {
+		t.Fatalf("Count = %d, want 3", set.Count())
+	}
+
+	ctx := context.Background()
+	parts := make([][]byte, set.Count())
+	for i := range parts {
+		var buf bytes.Buffer
+		if err := enc.EncryptPart(ctx, set, bytes.NewReader(data), i, &buf); err != nil {
+			t.Fatalf("EncryptPart(%d) failed: %v", i, err)
+		}
+		parts[i] = buf.Bytes()
+	}
+
+	// Each part is a complete file.
+	var plain bytes.Buffer
+	if err := dec.DecryptStream(ctx, bytes.NewReader(parts[2]), &plain); err != nil {
+		t.Fatalf("DecryptStream of a part failed: %v", err)
+	}
+	if !bytes.Equal(plain.Bytes(), data[200*1024:]) {
+		t.Error("last part does not decrypt to the end of the data")
+	}
+	h, err := format.ReadHeader(bytes.NewReader(parts[1]))
+	if err != nil || h.Part != (format.Part{Set: set.ID, Index: 1, Count: 3}) {
+		t.Errorf("part header = %+v, %v", h.Part, err)
+	}
+
+	join := func(parts ...[]byte) ([]byte, error) {
+		readers := make([]io.Reader, len(parts))
+		for i, p := range parts {
+			readers[i] = bytes.NewReader(p)
+		}
+		var out bytes.Buffer
+		err := dec.JoinParts(ctx, readers, &out)
+		return out.Bytes(), err
+	}
+	got, err := join(parts...)
+	if err != nil {
+		t.Fatalf("JoinParts failed: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("joined parts do not match the data")
+	}
+
+	// A retried part has a new nonce but joins the same.
+	var retry bytes.Buffer
+	if err := enc.EncryptPart(ctx, set, bytes.NewReader(data), 1, &retry); err != nil {
+		t.Fatalf("EncryptPart retry failed: %v", err)
+	}
+	if _, err := join(parts[0], retry.Bytes(), parts[2]); err != nil {
+		t.Errorf("JoinParts with a retried part failed: %v", err)
+	}
+
+	other, err := NewPartSet(int64(len(data)), 100*1024)
+	if err != nil {
+		t.Fatalf("NewPartSet failed: %v", err)
+	}
+	var foreign bytes.Buffer
+	if err := enc.EncryptPart(ctx, other, bytes.NewReader(data), 1, &foreign); err != nil {
+		t.Fatalf("EncryptPart failed: %v", err)
+	}
+	for name, set := range map[string][][]byte{
+		"missing":   {parts[0], parts[1]},
+		"reordered": {parts[0], parts[2], parts[1]},
+		"foreign":   {parts[0], foreign.Bytes(), parts[2]},
+	} {
+		if _, err := join(set...); !errors.Is(err, ErrPartMismatch) {
+			t.Errorf("%s: JoinParts error = %v, want ErrPartMismatch", name, err)
+		}
+	}
+
+	// The descriptor is authenticated with the header.
+	tampered := bytes.Clone(parts[1])
+	tampered[HeaderSize] ^= 0x01
+	if _, err := join(parts[0], tampered, parts[2]); !errors.Is(err, ErrPartMismatch) {
+		t.Errorf("tampered set ID: JoinParts error = %v, want ErrPartMismatch", err)
+	}
+	var sink bytes.Buffer
+	if err := dec.DecryptStream(ctx, bytes.NewReader(tampered), &sink); !errors.Is(err, ErrAuthenticationFailed) {
+		t.Errorf("tampered set ID: DecryptStream error = %v, want ErrAuthenticationFailed", err)
+	}
+
+	if err := enc.EncryptPart(ctx, set, bytes.NewReader(data), 3, io.Discard); err == nil {
+		t.Error("EncryptPart accepted an index outside the set")
+	}
+}
+
+// TestEncryptPart_HandBuiltSet checks that EncryptPart rejects part sets
+// that NewPartSet would not have returned.
+func TestEncryptPart_HandBuiltSet(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	enc, err := NewEncryptor(key)
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+
+	for name, set := range map[string]PartSet{
+		"zero part size":     {Size: 1024},
+		"negative part size": {Size: 1024, PartSize: -1},
+		"negative size":      {Size: -1, PartSize: 1024},
+		"too many parts":     {Size: 1 << 40, PartSize: 1},
+		"maximum size":       {Size: math.MaxInt64, PartSize: 2},
+	} {
+		if err := enc.EncryptPart(context.Background(), set, bytes.NewReader(nil), 0, io.Discard); err == nil {
+			t.Errorf("%s: EncryptPart accepted %+v", name, set)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// pipeline.go: Overlapping source reads, sealing and output writes
+package core
+
+import (
+	"context"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// autoTuneWindow is the number of chunks between adjustments of the worker
+// count under ParallelismAuto.
+const autoTuneWindow = 16
+
+// sealedChunk is one unit of work passing through a sealPipeline.
+type sealedChunk struct {
+	buf    []byte
+	n      int    // plaintext bytes in buf
+	record []byte // sealed record for buf[:n]
+	err    error  // read or seal error following the data, if any
+	// counter is the nonce counter reserved for the record; ready is
+	// signalled once the record is sealed.
+	counter uint32
+	nonce   []byte
+	ready   chan struct{}
+}
+
+// sealPipeline reads src in one goroutine and seals chunks in one or more
+// workers, connected by bounded queues, so the caller's writes overlap the
+// next reads and seals. Chunks come out in order; at most
+// 2*depth+2+maxWorkers chunk buffers are in use.
+type sealPipeline struct {
+	sealer   *chunkSealer
+	priority Priority
+	pinner   *cpuPinner
+	free     chan *sealedChunk
+	// read queues chunks for the workers; order holds every chunk read, in
+	// stream order.
+	read    chan *sealedChunk
+	order   chan *sealedChunk
+	done    chan struct{}
+	wg      sync.WaitGroup
+	stop    sync.Once
+	current *sealedChunk
+	// workers is the number of workers and retire asks one of them to exit.
+	// With auto set, next adjusts workers between 1 and maxWorkers every
+	// autoTuneWindow chunks, counting in cpuWaits how often it waited for
+	// a chunk while others were queued for sealing, and in idle the
+	// windows in a row where it did not.
+	workers    int
+	maxWorkers int
+	retire     chan struct{}
+	auto       bool
+	window     int
+	cpuWaits   int
+	idle       int
+}
+
+// newSealPipeline starts reading chunkSize chunks from src and sealing them
+// with sealer, keeping up to depth chunks queued between stages. Chunks are
+// sealed by parallelism workers, one if it is 0, or by as many as
+// ParallelismAuto finds useful, pinned to cpus if any. All goroutines run at
+// the given priority.
+func newSealPipeline(ctx context.Context, src io.Reader, sealer *chunkSealer, chunkSize, depth, parallelism int, cpus []int, priority Priority) *sealPipeline {
+	workers, maxWorkers := max(parallelism, 1), max(parallelism, 1)
+	if parallelism == ParallelismAuto {
+		workers, maxWorkers = 1, runtime.GOMAXPROCS(0)
+		if len(cpus) > 0 {
+			maxWorkers = min(maxWorkers, len(cpus))
+		}
+	}
+	buffers := 2*depth + 2 + maxWorkers
+	p := &sealPipeline{
+		sealer:     sealer,
+		priority:   priority,
+		pinner:     newCPUPinner(cpus),
+		free:       make(chan *sealedChunk, buffers),
+		read:       make(chan *sealedChunk, depth),
+		order:      make(chan *sealedChunk, buffers),
+		done:       make(chan struct{}),
+		maxWorkers: maxWorkers,
+		retire:     make(chan struct{}, maxWorkers),
+		auto:       parallelism == ParallelismAuto,
+	}
+	for range buffers {
+		p.free <- &sealedChunk{buf: make([]byte, chunkSize), nonce: make([]byte, NonceSize), ready: make(chan struct{}, 1)}
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer close(p.read)
+		defer close(p.order)
+		lowerPipelinePriority(priority)
+		var chunks int
+		for {
+			var c *sealedChunk
+			select {
+			case c = <-p.free:
+			case <-p.done:
+				return
+			}
+			c.n, c.err = 0, nil
+			if ctx.Err() != nil {
+				c.err = contextError(ctx)
+			} else {
+				var err error
+				c.n, err = src.Read(c.buf)
+				if c.n > 0 {
+					chunks++
+				}
+				if err != nil && err != io.EOF {
+					c.err = atChunk(chunks, WrapError("read source stream", err))
+				} else if err == io.EOF {
+					c.err = io.EOF
+				}
+			}
+			if c.n == 0 && c.err == nil {
+				p.free <- c
+				continue
+			}
+			if c.n > 0 {
+				var err error
+				if c.counter, err = sealer.reserve(); err != nil {
+					c.n, c.err = 0, err
+				}
+			}
+			// order has room for every chunk, so this never blocks.
+			p.order <- c
+			if c.n > 0 {
+				select {
+				case p.read <- c:
+				case <-p.done:
+					return
+				}
+			} else {
+				c.ready <- struct{}{}
+			}
+			if c.err != nil {
+				return
+			}
+		}
+	}()
+	p.grow(workers)
+	return p
+}
+
+// worker seals the chunks queued in read until the pipeline stops or it
+// is retired.
+func (p *sealPipeline) worker() {
+	defer p.wg.Done()
+	lowerPipelinePriority(p.priority)
+	defer p.pinner.pin()()
+	for {
+		select {
+		case c, ok := <-p.read:
+			if !ok {
+				return
+			}
+			c.record = p.sealer.sealAt(c.record[:0], c.nonce, c.buf[:c.n], c.counter)
+			c.ready <- struct{}{}
+		case <-p.retire:
+			return
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// grow starts n more workers.
+func (p *sealPipeline) grow(n int) {
+	p.wg.Add(n)
+	for range n {
+		go p.worker()
+	}
+	p.workers += n
+}
+
+// next returns the next plaintext chunk and its sealed record, both valid
+// until the following call. The error, if any, follows the returned data;
+// io.EOF marks the end of src.
+func (p *sealPipeline) next() (plaintext, record []byte, err error) {
+	if p.current != nil {
+		p.free <- p.current
+		p.current = nil
+	}
+	c, ok := <-p.order
+	if !ok {
+		return nil, nil, io.EOF
+	}
+	cpuWait := false
+	select {
+	case <-c.ready:
+	default:
+		// Chunks waiting in read mean the source keeps up and sealing does
+		// not; an empty read means the workers wait for the source.
+		cpuWait = len(p.read) > 0
+		<-c.ready
+	}
+	p.current = c
+	if c.n == 0 {
+		return nil, nil, c.err
+	}
+	p.sealer.account(c.record)
+	if p.auto {
+		p.tune(cpuWait)
+	}
+	return c.buf[:c.n], c.record, c.err
+}
+
+// tune counts a chunk towards the current window and adjusts the number of
+// workers at its end: it doubles them while sealing is the bottleneck, and
+// retires one after two windows in which reading or writing was, so that
+// idle workers do not hold CPUs another stream could use.
+func (p *sealPipeline) tune(cpuWait bool) {
+	p.window++
+	if cpuWait {
+		p.cpuWaits++
+	}
+	if p.window < autoTuneWindow {
+		return
+	}
+	switch {
+	case p.cpuWaits > autoTuneWindow/4:
+		p.idle = 0
+		p.grow(min(2*p.workers, p.maxWorkers) - p.workers)
+	case p.cpuWaits == 0:
+		p.idle++
+		if p.idle < 2 || p.workers == 1 {
+			break
+		}
+		select {
+		case p.retire <- struct{}{}:
+			p.idle = 0
+			p.workers--
+		default:
+		}
+	default:
+		p.idle = 0
+	}
+	p.window, p.cpuWaits = 0, 0
+}
+
+// sealWorkers returns the number of workers sealing chunks.
+func (p *sealPipeline) sealWorkers() int {
+	return p.workers
+}
+
+// close stops all goroutines and waits for them, so src and the sealer are
+// no longer in use when it returns.
+func (p *sealPipeline) close() {
+	p.stop.Do(func() {
+		close(p.done)
+		p.wg.Wait()
+	})
+}
+
+// lowerPipelinePriority lowers the priority of a pipeline goroutine. Failures
+// are ignored: the caller's thread was already lowered the same way.
+func lowerPipelinePriority(p Priority) {
+	if p != PriorityNormal {
+		_ = lockLowPriority(p)
+	}
+}
@@ -0,0 +1,197 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"runtime"
+	"testing"
+	"testing/iotest"
+)
+
+func TestWithPipeline_MatchesSequential(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	chunkOpt, err := WithChunkSize(100)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	encrypt := func(data []byte, opts ...Option) []byte {
+		t.Helper()
+		enc, err := NewEncryptor(key, append([]Option{chunkOpt, WithChunkIndex(true)}, opts...)...)
+		if err != nil {
+			t.Fatalf("NewEncryptor failed: %v", err)
+		}
+		defer enc.Destroy()
+		enc.nonceSource = &deterministicReader{seed: []byte("pipeline")}
+		var buf bytes.Buffer
+		if err := enc.EncryptStream(context.Background(), iotest.HalfReader(bytes.NewReader(data)), &buf, int64(len(data))); err != nil {
+			t.Fatalf("EncryptStream failed: %v", err)
+		}
+		return buf.Bytes()
+	}
+
+	for _, size := range []int{0, 1, 100, 101, 10000} {
+		data := make([]byte, size)
+		if _, err := rand.Read(data); err != nil {
+			t.Fatalf("failed to generate data: %v", err)
+		}
+		want := encrypt(data)
+		for _, depth := range []int{1, 4} {
+			var progress []float64
+			got := encrypt(data, WithPipeline(depth), WithProgress(func(p float64) { progress = append(progress, p) }))
+			if !bytes.Equal(got, want) {
+				t.Errorf("size %d, depth %d: pipelined output differs from sequential", size, depth)
+			}
+			if len(progress) == 0 || progress[len(progress)-1] != 1.0 {
+				t.Errorf("size %d, depth %d: unexpected progress %v", size, depth, progress)
+			}
+		}
+		for _, workers := range []int{3, ParallelismAuto} {
+			if got := encrypt(data, WithPipeline(2), WithParallelism(workers)); !bytes.Equal(got, want) {
+				t.Errorf("size %d, parallelism %d: output differs from sequential", size, workers)
+			}
+		}
+	}
+}
+
+type failAfterWriter struct {
+	n int
+}
+
+func (w *failAfterWriter) Write(p []byte) (int, error) {
+	if w.n <= 0 {
+		return 0, errors.New("disk full")
+	}
+	w.n--
+	return len(p), nil
+}
+
+func TestWithPipeline_Errors(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	chunkOpt, err := WithChunkSize(100)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	var report OperationReport
+	enc, err := NewEncryptor(key, chunkOpt, WithPipeline(2), WithReport(&report), WithErrorDetail(ErrorDetailVerbose))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	data := make([]byte, 1000)
+
+	// A read error is reported after the chunks read before it.
+	src := io.MultiReader(bytes.NewReader(data[:250]), iotest.ErrReader(errors.New("bad sector")))
+	err = enc.EncryptStream(context.Background(), src, io.Discard)
+	var encErr *EncryptionError
+	if !errors.As(err, &encErr) || encErr.ChunkNum != 3 {
+		t.Errorf("read error: expected chunk 3, got %v", err)
+	}
+	if report.Chunks != 3 || report.PlaintextBytes != 250 {
+		t.Errorf("read error: unexpected report %+v", report)
+	}
+
+	// A write error stops the pipeline.
+	err = enc.EncryptStream(context.Background(), bytes.NewReader(data), &failAfterWriter{n: 3})
+	if !errors.As(err, &encErr) || encErr.ChunkNum != 2 {
+		t.Errorf("write error: expected chunk 2, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := enc.EncryptStream(ctx, bytes.NewReader(data), io.Discard); !errors.Is(err, ErrContextCanceled) {
+		t.Errorf("expected ErrContextCanceled, got %v", err)
+	}
+
+	if _, err := NewEncryptor(key, WithPipeline(-1)); err == nil {
+		t.Error("expected error for negative pipeline depth")
+	}
+	if _, err := NewEncryptor(key, WithParallelism(4)); err == nil {
+		t.Error("expected error for parallelism without a pipeline")
+	}
+	if _, err := NewEncryptor(key, WithPipeline(2), WithParallelism(-2)); err == nil {
+		t.Error("expected error for invalid parallelism")
+	}
+}
+
+func TestWithParallelism_Report(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	var report OperationReport
+	enc, err := NewEncryptor(key, WithPipeline(2), WithParallelism(ParallelismAuto), WithReport(&report))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	data := make([]byte, 4*1024*1024)
+	if err := enc.EncryptStream(context.Background(), bytes.NewReader(data), io.Discard); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+	if report.SealWorkers < 1 || report.SealWorkers > runtime.GOMAXPROCS(0) {
+		t.Errorf("SealWorkers = %d, want 1 to GOMAXPROCS", report.SealWorkers)
+	}
+}
+
+func TestSealPipeline_Tune(t *testing.T) {
+	p := &sealPipeline{
+		read:       make(chan *sealedChunk),
+		done:       make(chan struct{}),
+		retire:     make(chan struct{}, 8),
+		maxWorkers: 8,
+		auto:       true,
+	}
+	defer func() {
+		close(p.done)
+		p.wg.Wait()
+	}()
+	p.grow(1)
+	window := func(cpuWaits int) {
+		for i := range autoTuneWindow {
+			p.tune(i < cpuWaits)
+		}
+	}
+
+	// Sealing is the bottleneck: workers double up to the maximum.
+	for _, want := range []int{2, 4, 8, 8} {
+		window(autoTuneWindow / 2)
+		if p.workers != want {
+			t.Fatalf("CPU-bound: workers = %d, want %d", p.workers, want)
+		}
+	}
+	// A window with some waits keeps the count.
+	window(1)
+	if p.workers != 8 {
+		t.Errorf("mixed window: workers = %d, want 8", p.workers)
+	}
+	// I/O is the bottleneck: one worker retires every two windows.
+	window(0)
+	if p.workers != 8 {
+		t.Errorf("one idle window: workers = %d, want 8", p.workers)
+	}
+	window(0)
+	if p.workers != 7 {
+		t.Errorf("two idle windows: workers = %d, want 7", p.workers)
+	}
+	for range 20 {
+		window(0)
+	}
+	if p.workers != 1 {
+		t.Errorf("I/O-bound: workers = %d, want 1", p.workers)
+	}
+}
@@ -0,0 +1,27 @@
+//go:build darwin
+
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// allocate reserves size bytes of disk space for f with F_PREALLOCATE without
+// changing its size. Filesystems that cannot preallocate are not an error.
+func allocate(f *os.File, size int64) error {
+	store := &unix.Fstore_t{Flags: unix.F_ALLOCATEALL, Posmode: unix.F_PEOFPOSMODE, Length: size}
+	err := unix.FcntlFstore(f.Fd(), unix.F_PREALLOCATE, store)
+	if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EINVAL) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,17 @@
+//go:build !linux && !darwin
+
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import "os"
+
+// allocate is a no-op on platforms without a preallocation call; running out
+// of space is then detected while writing.
+func allocate(f *os.File, size int64) error {
+	return nil
+}
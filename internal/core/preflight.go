@@ -0,0 +1,67 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// preflight.go: Cross-checking a file's length against its header
+package core
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gitrgoliveira/go-fileencrypt/format"
+)
+
+// preflight checks, before any chunk is decrypted, that the length of f is
+// possible for the plaintext size recorded in header, so a truncated file or
+// one with data appended fails at once with ErrCorruptedFile instead of
+// after streaming most of it. The chunk size is not recorded, so the file
+// must lie between the layouts with the fewest chunks the decryptor accepts
+// and with one byte per chunk. Files whose header does not record the size,
+// append-only logs and inputs that are not regular files are not checked;
+// the stream checks still apply to them.
+func (d *Decryptor) preflight(f *os.File, header []byte) error {
+	if header == nil || d.multiSegment {
+		return nil
+	}
+	h, err := format.ParseHeader(header)
+	if err != nil || h.Size == 0 || h.Size > maxPlausibleSize || h.Flags&format.FlagLog != 0 {
+		return nil
+	}
+	stat, err := f.Stat()
+	if err != nil || !stat.Mode().IsRegular() {
+		return nil
+	}
+	size := int64(h.Size)
+	fewest := (size + int64(d.maxChunk) - 1) / int64(d.maxChunk)
+	minLen, maxLen := layoutSize(h, fewest), layoutSize(h, size)
+	switch length := stat.Size(); {
+	case length < minLen:
+		return fmt.Errorf("%w: file is %d bytes, but %d bytes of plaintext need at least %d: the file is truncated", ErrCorruptedFile, length, size, minLen)
+	case length > maxLen:
+		return fmt.Errorf("%w: file is %d bytes, but %d bytes of plaintext take at most %d: data follows the encrypted stream", ErrCorruptedFile, length, size, maxLen)
+	}
+	return nil
+}
+
+// maxPlausibleSize bounds the plaintext sizes preflight computes layouts
+// for, so that the one-byte-per-chunk layout cannot overflow.
+const maxPlausibleSize = 1 << 56
+
+// layoutSize returns the length of a file with header h holding h.Size
+// plaintext bytes in chunks records.
+func layoutSize(h format.Header, chunks int64) int64 {
+	n := int64(h.Len()) + int64(h.Size) + chunks*(format.LengthSize+TagSize) // #nosec G115 -- bounded by maxPlausibleSize
+	if h.HasTrailer() {
+		n += TrailerSize
+		if h.Flags&format.FlagChunkIndex != 0 {
+			n += h.IndexSize(uint64(chunks)) // #nosec G115 -- chunk counts are never negative
+		}
+	}
+	if h.Flags&format.FlagBackupHeader != 0 {
+		n += int64(h.Len())
+	}
+	return n
+}
@@ -0,0 +1,97 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPreflight(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	ctx := context.Background()
+	dir := t.TempDir()
+	content := make([]byte, 3000)
+	if _, err := rand.Read(content); err != nil {
+		t.Fatalf("failed to generate content: %v", err)
+	}
+	src := filepath.Join(dir, "plain")
+	if err := os.WriteFile(src, content, 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	// Files at both ends of the plausible range, and with every layout
+	// flag, pass the check and decrypt.
+	oneByte, err := WithChunkSize(1)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	layouts := map[string][]Option{
+		"default":       nil,
+		"one-byte":      {oneByte},
+		"indexed":       {WithChunkIndex(true), WithChunkDigests(true)},
+		"backup-header": {WithBackupHeader(true), WithHeaderCRC(true)},
+	}
+	for name, opts := range layouts {
+		enc, err := NewEncryptor(key, opts...)
+		if err != nil {
+			t.Fatalf("%s: NewEncryptor failed: %v", name, err)
+		}
+		encrypted := filepath.Join(dir, name+".enc")
+		err = enc.EncryptFile(ctx, src, encrypted)
+		enc.Destroy()
+		if err != nil {
+			t.Fatalf("%s: EncryptFile failed: %v", name, err)
+		}
+		if err := dec.DecryptFile(ctx, encrypted, filepath.Join(dir, name+".dec")); err != nil {
+			t.Errorf("%s: DecryptFile failed: %v", name, err)
+		}
+	}
+
+	// A truncated file and one with data appended fail before decrypting.
+	data, err := os.ReadFile(filepath.Join(dir, "default.enc"))
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	cases := map[string]struct {
+		data []byte
+		want string
+	}{
+		"truncated": {data[:len(data)/2], "truncated"},
+		"appended":  {append(bytes.Clone(data), make([]byte, 100*len(content))...), "data follows"},
+	}
+	for name, c := range cases {
+		path := filepath.Join(dir, name+".enc")
+		if err := os.WriteFile(path, c.data, 0o600); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		if err := dec.VerifyFile(ctx, path); !errors.Is(err, ErrCorruptedFile) || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: VerifyFile error = %v, want ErrCorruptedFile saying %q", name, err, c.want)
+		}
+		dst := filepath.Join(dir, name+".dec")
+		if err := dec.DecryptFile(ctx, path, dst); !errors.Is(err, ErrCorruptedFile) || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: DecryptFile error = %v, want ErrCorruptedFile saying %q", name, err, c.want)
+		}
+		if _, err := os.Stat(dst); !os.IsNotExist(err) {
+			t.Errorf("%s: DecryptFile created the output before failing the preflight", name)
+		}
+	}
+}
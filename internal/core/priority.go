@@ -0,0 +1,89 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// priority.go: Scheduling priority and pacing for background operations
+package core
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// Priority controls how an operation competes with other work on the host.
+type Priority uint8
+
+const (
+	// PriorityNormal leaves scheduling unchanged (default).
+	PriorityNormal Priority = iota
+	// PriorityLow runs the operation at the lowest CPU priority and the
+	// lowest best-effort I/O priority.
+	PriorityLow
+	// PriorityIdle is PriorityLow, but I/O is only served when no other
+	// process needs the disk (Linux idle I/O class). Elsewhere it is the same
+	// as PriorityLow.
+	PriorityIdle
+)
+
+// String returns the priority name.
+func (p Priority) String() string {
+	switch p {
+	case PriorityNormal:
+		return "normal"
+	case PriorityLow:
+		return "low"
+	case PriorityIdle:
+		return "idle"
+	default:
+		return fmt.Sprintf("Priority(%d)", uint8(p))
+	}
+}
+
+// runAtPriority runs fn at priority p. A lowered priority is applied to a
+// dedicated OS thread that is discarded when fn returns, because an
+// unprivileged process cannot raise a thread's priority back, and the
+// thread must not return to the pool serving other goroutines.
+func runAtPriority(p Priority, fn func() error) error {
+	if p == PriorityNormal {
+		return fn()
+	}
+	done := make(chan error, 1)
+	go func() {
+		if err := lockLowPriority(p); err != nil {
+			done <- err
+			return
+		}
+		done <- fn()
+	}()
+	return <-done
+}
+
+// lockLowPriority wires the calling goroutine to its OS thread for the rest
+// of its life and lowers the thread's priority.
+func lockLowPriority(p Priority) error {
+	// Never unlocked: the thread exits together with the goroutine.
+	runtime.LockOSThread()
+	if err := lowerThreadPriority(p); err != nil {
+		return fmt.Errorf("lower %s priority: %w", p, err)
+	}
+	return nil
+}
+
+// pause waits d between chunks, returning early with the context error.
+func pause(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return contextError(ctx)
+	}
+}
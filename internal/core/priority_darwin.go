@@ -0,0 +1,25 @@
+//go:build darwin
+
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// Darwin-specific setpriority(2) arguments from <sys/resource.h>.
+const (
+	prioDarwinThread = 3
+	prioDarwinBG     = 0x1000
+)
+
+// lowerThreadPriority moves the calling thread to the background band, which
+// lowers its CPU priority and throttles its disk and network I/O.
+func lowerThreadPriority(p Priority) error {
+	return unix.Setpriority(prioDarwinThread, 0, prioDarwinBG)
+}
@@ -0,0 +1,40 @@
+//go:build linux
+
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// I/O priority encoding of ioprio_set(2).
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+	ioprioClassBE    = 2
+	ioprioClassIdle  = 3
+	ioprioLowestBE   = 7
+)
+
+// lowerThreadPriority sets the calling thread to nice 19 and the lowest
+// best-effort (or idle) I/O priority. On Linux both apply to a single thread
+// when given its thread ID.
+func lowerThreadPriority(p Priority) error {
+	tid := unix.Gettid()
+	if err := unix.Setpriority(unix.PRIO_PROCESS, tid, 19); err != nil {
+		return err
+	}
+	prio := ioprioClassBE<<ioprioClassShift | ioprioLowestBE
+	if p == PriorityIdle {
+		prio = ioprioClassIdle << ioprioClassShift
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), uintptr(prio)); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+//go:build linux
+
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// threadNice returns the nice value of the calling thread. The raw
+// getpriority(2) system call returns 20 - nice.
+func threadNice(t *testing.T) int {
+	t.Helper()
+	prio, err := unix.Getpriority(unix.PRIO_PROCESS, unix.Gettid())
+	if err != nil {
+		t.Fatalf("getpriority failed: %v", err)
+	}
+	return 20 - prio
+}
+
+func TestWithPriority_LowersOperationThreadOnly(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	before := threadNice(t)
+
+	// The progress callback runs on the operation's thread.
+	var during int
+	enc, err := NewEncryptor(key, WithPriority(PriorityLow), WithProgress(func(float64) { during = threadNice(t) }))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	if err := enc.EncryptStream(context.Background(), bytes.NewReader(make([]byte, 100)), &bytes.Buffer{}, 100); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+	if during != 19 {
+		t.Errorf("expected nice 19 during the operation, got %d", during)
+	}
+	if after := threadNice(t); after != before {
+		t.Errorf("caller's nice changed from %d to %d", before, after)
+	}
+}
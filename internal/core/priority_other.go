@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !windows
+
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+// lowerThreadPriority is a no-op on platforms without per-thread priorities.
+func lowerThreadPriority(p Priority) error {
+	return nil
+}
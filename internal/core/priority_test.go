@@ -0,0 +1,102 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWithPriority_RoundTrip(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	chunkOpt, err := WithChunkSize(100)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	data := make([]byte, 1000)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("failed to generate data: %v", err)
+	}
+
+	for _, p := range []Priority{PriorityNormal, PriorityLow, PriorityIdle} {
+		for _, pipeline := range []int{0, 2} {
+			enc, err := NewEncryptor(key, chunkOpt, WithPriority(p), WithPipeline(pipeline))
+			if err != nil {
+				t.Fatalf("NewEncryptor failed: %v", err)
+			}
+			dec, err := NewDecryptor(key, WithPriority(p))
+			if err != nil {
+				t.Fatalf("NewDecryptor failed: %v", err)
+			}
+			var ciphertext, plaintext bytes.Buffer
+			if err := enc.EncryptStream(context.Background(), bytes.NewReader(data), &ciphertext); err != nil {
+				t.Fatalf("%s: EncryptStream failed: %v", p, err)
+			}
+			if err := dec.DecryptStream(context.Background(), &ciphertext, &plaintext); err != nil {
+				t.Fatalf("%s: DecryptStream failed: %v", p, err)
+			}
+			if !bytes.Equal(plaintext.Bytes(), data) {
+				t.Errorf("%s: round trip mismatch", p)
+			}
+			enc.Destroy()
+			dec.Destroy()
+		}
+	}
+
+	if _, err := NewEncryptor(key, WithPriority(PriorityIdle+1)); err == nil {
+		t.Error("expected error for invalid priority")
+	}
+	if _, err := NewDecryptor(key, WithChunkDelay(-time.Second)); err == nil {
+		t.Error("expected error for negative chunk delay")
+	}
+}
+
+func TestWithChunkDelay(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	chunkOpt, err := WithChunkSize(100)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	data := make([]byte, 500)
+	const delay = 10 * time.Millisecond
+
+	enc, err := NewEncryptor(key, chunkOpt, WithChunkDelay(delay))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	var ciphertext bytes.Buffer
+	start := time.Now()
+	if err := enc.EncryptStream(context.Background(), bytes.NewReader(data), &ciphertext); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 5*delay {
+		t.Errorf("encrypting 5 chunks took %v, expected at least %v", elapsed, 5*delay)
+	}
+
+	dec, err := NewDecryptor(key, WithChunkDelay(time.Hour))
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	// Cancellation ends a pause early.
+	ctx, cancel := context.WithTimeout(context.Background(), delay)
+	defer cancel()
+	if err := dec.DecryptStream(ctx, &ciphertext, &bytes.Buffer{}); !errors.Is(err, ErrContextCanceled) {
+		t.Errorf("expected ErrContextCanceled, got %v", err)
+	}
+}
@@ -0,0 +1,27 @@
+//go:build windows
+
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// threadModeBackgroundBegin is THREAD_MODE_BACKGROUND_BEGIN for SetThreadPriority.
+const threadModeBackgroundBegin = 0x00010000
+
+var procSetThreadPriority = windows.NewLazySystemDLL("kernel32.dll").NewProc("SetThreadPriority")
+
+// lowerThreadPriority enters background processing mode for the calling
+// thread, which lowers its CPU, I/O and memory priority.
+func lowerThreadPriority(p Priority) error {
+	if r, _, err := procSetThreadPriority.Call(uintptr(windows.CurrentThread()), threadModeBackgroundBegin); r == 0 {
+		return err
+	}
+	return nil
+}
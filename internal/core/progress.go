@@ -0,0 +1,67 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// progress.go: Progress reporting shared by every operation
+package core
+
+// progressStep is the smallest increase reported to a WithProgress
+// callback between two calls, so a file of many small chunks does not call
+// it thousands of times.
+const progressStep = 0.01
+
+// progressReporter reports the progress of one operation to a WithProgress
+// callback; without one it does nothing. Every operation, in either
+// direction, reports through it, so the callback sees the same semantics
+// everywhere: values are clamped to [0, 1], never decrease, rise by at
+// least progressStep between calls, and 1.0 is reported exactly once, when
+// the operation completes.
+type progressReporter struct {
+	cb    func(float64)
+	total int64
+	last  float64
+	// reported is set once the callback has been called.
+	reported bool
+	finished bool
+}
+
+// newProgressReporter returns a reporter for an operation of total bytes,
+// or of unknown size if total is zero or negative.
+func newProgressReporter(cb func(float64), total int64) progressReporter {
+	return progressReporter{cb: cb, total: total}
+}
+
+// update reports that done bytes out of the total have been processed.
+// Nothing is reported when the total is unknown. A value that reaches 1.0,
+// because the header size was wrong or data follows, is held back until
+// finish, so 1.0 always means the operation succeeded.
+func (p *progressReporter) update(done int64) {
+	if p.cb == nil || p.total <= 0 || p.finished {
+		return
+	}
+	f := progressFraction(done, p.total)
+	if f >= 1 || (p.reported && f < p.last+progressStep) {
+		return
+	}
+	p.last, p.reported = f, true
+	p.cb(f)
+}
+
+// finish reports completion.
+func (p *progressReporter) finish() {
+	if p.cb == nil || p.finished {
+		return
+	}
+	p.finished = true
+	p.cb(1.0)
+}
+
+// progressFraction returns done out of total clamped to [0, 1].
+func progressFraction(done, total int64) float64 {
+	if total <= 0 || done <= 0 {
+		return 0
+	}
+	return min(float64(done)/float64(total), 1)
+}
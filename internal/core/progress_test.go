@@ -0,0 +1,95 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"slices"
+	"testing"
+)
+
+func TestProgressReporter(t *testing.T) {
+	var got []float64
+	p := newProgressReporter(func(f float64) { got = append(got, f) }, 1000)
+	for _, done := range []int64{-5, 0, 3, 5, 20, 15, 999, 1500, 1000} {
+		p.update(done)
+	}
+	p.finish()
+	p.finish()
+	p.update(500)
+	want := []float64{0, 0.02, 0.999, 1}
+	if !slices.Equal(got, want) {
+		t.Errorf("reported %v, want %v", got, want)
+	}
+
+	got = nil
+	p = newProgressReporter(func(f float64) { got = append(got, f) }, 0)
+	p.update(10)
+	p.finish()
+	if !slices.Equal(got, []float64{1}) {
+		t.Errorf("unknown total: reported %v, want only completion", got)
+	}
+
+	var none progressReporter
+	none.update(1)
+	none.finish()
+}
+
+// TestProgressSemantics checks that encryption and decryption report
+// progress the same way for the same data.
+func TestProgressSemantics(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	data := make([]byte, 1000*1024)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("failed to generate data: %v", err)
+	}
+	chunk, err := WithChunkSize(1024)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	ctx := context.Background()
+
+	var encProgress, decProgress []float64
+	enc, err := NewEncryptor(key, chunk, WithProgress(func(f float64) { encProgress = append(encProgress, f) }))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	var encrypted bytes.Buffer
+	if err := enc.EncryptStream(ctx, bytes.NewReader(data), &encrypted, int64(len(data))); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+	dec, err := NewDecryptor(key, WithProgress(func(f float64) { decProgress = append(decProgress, f) }))
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	if err := dec.DecryptStream(ctx, &encrypted, &bytes.Buffer{}); err != nil {
+		t.Fatalf("DecryptStream failed: %v", err)
+	}
+
+	if !slices.Equal(encProgress, decProgress) {
+		t.Errorf("encryption reported %d values, decryption %d: %v, %v", len(encProgress), len(decProgress), encProgress, decProgress)
+	}
+	// A thousand chunks are reported in 1% steps, ending with one 1.0.
+	if n := len(decProgress); n < 90 || n > 101 {
+		t.Errorf("reported %d values for 1000 chunks, want about 100", n)
+	}
+	for i, f := range decProgress {
+		if f < 0 || f > 1 || (i > 0 && f < decProgress[i-1]+progressStep && i != len(decProgress)-1) {
+			t.Fatalf("value %d of %v breaks clamping or throttling", i, decProgress)
+		}
+		if f == 1 && i != len(decProgress)-1 {
+			t.Fatalf("1.0 reported before completion: %v", decProgress)
+		}
+	}
+}
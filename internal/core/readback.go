@@ -0,0 +1,248 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// readback.go: Read-your-writes verification of uploaded streams
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"math/rand/v2"
+
+	"github.com/gitrgoliveira/go-fileencrypt/format"
+)
+
+// readBackEdge is the number of bytes at each end of the output that
+// read-back verification always compares: the header at the start, and the
+// trailer, index and backup header at the end.
+const readBackEdge = 4096
+
+// ReadBackOpener opens the object an encrypted stream was uploaded to and
+// returns a reader of its contents and its size. If the reader is also an
+// io.Closer it is closed once verified.
+type ReadBackOpener func(ctx context.Context) (io.ReaderAt, int64, error)
+
+// readBack configures read-back verification.
+type readBack struct {
+	open    ReadBackOpener
+	samples int
+}
+
+// WithReadBack makes EncryptStream and EncryptStreamTo read the output back
+// with open once it has been written, such as from the object store it was
+// uploaded to, and fail with ErrReadBack unless the object has the size
+// written and holds exactly the bytes written at its start, at its end and
+// in samples records chosen at random across the stream. It catches
+// truncated, corrupted or misplaced uploads before the source is deleted,
+// at the cost of downloading a few records. Only the chosen records are
+// hashed while writing.
+//
+// open is called after the last write, so if the upload only completes when
+// its writer is closed, open must close it first. With EncryptStreamTo, the
+// object read back is one of the destinations.
+func WithReadBack(open ReadBackOpener, samples int) Option {
+	return func(cfg *Config) {
+		cfg.ReadBack = &readBack{open: open, samples: samples}
+	}
+}
+
+// checkReadBack reports whether rb is usable.
+func checkReadBack(rb *readBack) error {
+	if rb == nil {
+		return nil
+	}
+	if rb.open == nil || rb.samples < 0 {
+		return fmt.Errorf("invalid read-back configuration: opener must be set and samples must not be negative")
+	}
+	return nil
+}
+
+// sampledRange is the digest of one range of the output.
+type sampledRange struct {
+	offset int64
+	length int64
+	sum    []byte
+}
+
+// readBackWriter passes the output through to w and records what
+// verification compares: the first and last readBackEdge bytes and a
+// reservoir sample of records.
+type readBackWriter struct {
+	w         io.Writer
+	rb        *readBack
+	blockSize int64
+	offset    int64
+	head      []byte
+	// tail ends with the last readBackEdge bytes written.
+	tail    []byte
+	samples []sampledRange
+	// block counts the records begun; cur and hash are the sample being
+	// hashed, if any.
+	block int64
+	cur   int
+	hash  hash.Hash
+}
+
+// wrap returns a writer recording the output of records of chunkSize
+// plaintext bytes on its way to w, and the recorder to verify it with. It
+// returns w and nil when rb is nil.
+func (rb *readBack) wrap(w io.Writer, chunkSize int) (io.Writer, *readBackWriter) {
+	if rb == nil {
+		return w, nil
+	}
+	r := &readBackWriter{
+		w:         w,
+		rb:        rb,
+		blockSize: int64(chunkSize) + format.LengthSize + TagSize,
+		head:      make([]byte, 0, readBackEdge),
+		tail:      make([]byte, 0, 2*readBackEdge),
+		cur:       -1,
+	}
+	return r, r
+}
+
+func (r *readBackWriter) Write(p []byte) (int, error) {
+	n, err := r.w.Write(p)
+	r.record(p[:n])
+	return n, err
+}
+
+// record accounts data written at r.offset.
+func (r *readBackWriter) record(data []byte) {
+	if room := cap(r.head) - len(r.head); room > 0 {
+		r.head = append(r.head, data[:min(room, len(data))]...)
+	}
+	r.keepTail(data)
+	for len(data) > 0 {
+		pos := r.offset % r.blockSize
+		if pos == 0 {
+			r.beginBlock()
+		}
+		n := min(int64(len(data)), r.blockSize-pos)
+		if r.hash != nil {
+			r.hash.Write(data[:n])
+		}
+		r.offset += n
+		data = data[n:]
+		if r.offset%r.blockSize == 0 {
+			r.endBlock()
+		}
+	}
+}
+
+// keepTail appends data to the tail, dropping bytes before the last
+// readBackEdge when the buffer is full.
+func (r *readBackWriter) keepTail(data []byte) {
+	if len(data) >= readBackEdge {
+		r.tail = append(r.tail[:0], data[len(data)-readBackEdge:]...)
+		return
+	}
+	if len(r.tail)+len(data) > cap(r.tail) {
+		r.tail = append(r.tail[:0], r.tail[len(r.tail)-(readBackEdge-len(data)):]...)
+	}
+	r.tail = append(r.tail, data...)
+}
+
+// beginBlock decides whether the record starting at r.offset is sampled,
+// replacing an earlier sample with the probability that keeps the sample
+// uniform over all records.
+func (r *readBackWriter) beginBlock() {
+	slot := -1
+	switch {
+	case r.block < int64(r.rb.samples):
+		slot = len(r.samples)
+		r.samples = append(r.samples, sampledRange{})
+	default:
+		if j := rand.Int64N(r.block + 1); j < int64(r.rb.samples) {
+			slot = int(j)
+		}
+	}
+	r.block++
+	if slot >= 0 {
+		r.cur = slot
+		r.samples[slot] = sampledRange{offset: r.offset}
+		r.hash = sha256.New()
+	}
+}
+
+// endBlock stores the digest of the record being sampled, if any.
+func (r *readBackWriter) endBlock() {
+	if r.hash == nil {
+		return
+	}
+	s := &r.samples[r.cur]
+	s.length = r.offset - s.offset
+	s.sum = r.hash.Sum(nil)
+	r.hash = nil
+	r.cur = -1
+}
+
+// verify opens the written object and compares it with what was written.
+func (r *readBackWriter) verify(ctx context.Context) error {
+	r.endBlock()
+	src, size, err := r.rb.open(ctx)
+	if err != nil {
+		return WrapError("open object for read-back", err)
+	}
+	if c, ok := src.(io.Closer); ok {
+		defer c.Close()
+	}
+	if size != r.offset {
+		return fmt.Errorf("%w: object is %d bytes, %d were written", ErrReadBack, size, r.offset)
+	}
+
+	tail := r.tail[max(0, len(r.tail)-readBackEdge):]
+	tailLen := int64(len(tail))
+	buf := make([]byte, readBackEdge)
+	for _, edge := range []struct {
+		offset int64
+		want   []byte
+	}{{0, r.head}, {r.offset - tailLen, tail}} {
+		got := buf[:len(edge.want)]
+		if err := readBackAt(ctx, src, got, edge.offset); err != nil {
+			return err
+		}
+		if !bytes.Equal(got, edge.want) {
+			return fmt.Errorf("%w: bytes at offset %d differ", ErrReadBack, edge.offset)
+		}
+	}
+
+	for _, s := range r.samples {
+		if s.sum == nil {
+			continue
+		}
+		if int64(cap(buf)) < s.length {
+			buf = make([]byte, s.length)
+		}
+		got := buf[:s.length]
+		if err := readBackAt(ctx, src, got, s.offset); err != nil {
+			return err
+		}
+		if sum := sha256.Sum256(got); !bytes.Equal(sum[:], s.sum) {
+			return fmt.Errorf("%w: record at offset %d differs", ErrReadBack, s.offset)
+		}
+	}
+	return nil
+}
+
+// readBackAt fills p from src at off.
+func readBackAt(ctx context.Context, src io.ReaderAt, p []byte, off int64) error {
+	if err := ctx.Err(); err != nil {
+		return contextError(ctx)
+	}
+	n, err := src.ReadAt(p, off)
+	if n == len(p) {
+		return nil
+	}
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return WrapError("read object for read-back", err)
+}
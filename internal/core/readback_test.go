@@ -0,0 +1,103 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestReadBack(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	plaintext := make([]byte, 200*1024+17)
+	if _, err := rand.Read(plaintext); err != nil {
+		t.Fatalf("failed to generate plaintext: %v", err)
+	}
+	chunkOpt, err := WithChunkSize(16 * 1024)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	ctx := context.Background()
+
+	// damage alters the uploaded object before it is read back.
+	tests := []struct {
+		name   string
+		damage func(b []byte) []byte
+		ok     bool
+	}{
+		{"intact", func(b []byte) []byte { return b }, true},
+		{"truncated", func(b []byte) []byte { return b[:len(b)-1] }, false},
+		{"head", func(b []byte) []byte { b[10] ^= 1; return b }, false},
+		{"tail", func(b []byte) []byte { b[len(b)-10] ^= 1; return b }, false},
+		// With every record sampled, a flip anywhere is caught.
+		{"middle", func(b []byte) []byte { b[len(b)/2] ^= 1; return b }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var object bytes.Buffer
+			opened := false
+			open := func(context.Context) (io.ReaderAt, int64, error) {
+				opened = true
+				b := tt.damage(bytes.Clone(object.Bytes()))
+				return bytes.NewReader(b), int64(len(b)), nil
+			}
+			enc, err := NewEncryptor(key, chunkOpt, WithReadBack(open, 100))
+			if err != nil {
+				t.Fatalf("NewEncryptor failed: %v", err)
+			}
+			defer enc.Destroy()
+			err = enc.EncryptStream(ctx, bytes.NewReader(plaintext), &object)
+			if !opened {
+				t.Fatal("object was not read back")
+			}
+			if tt.ok && err != nil {
+				t.Errorf("EncryptStream failed: %v", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrReadBack) {
+				t.Errorf("EncryptStream error = %v, want ErrReadBack", err)
+			}
+		})
+	}
+
+	// EncryptStreamTo reads back one of its destinations.
+	var local, upload bytes.Buffer
+	open := func(context.Context) (io.ReaderAt, int64, error) {
+		return bytes.NewReader(upload.Bytes()), int64(upload.Len()), nil
+	}
+	enc, err := NewEncryptor(key, WithReadBack(open, 0))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	if err := enc.EncryptStreamTo(ctx, bytes.NewReader(plaintext), []io.Writer{&local, &upload}); err != nil {
+		t.Errorf("EncryptStreamTo failed: %v", err)
+	}
+
+	openErr := errors.New("no such object")
+	enc, err = NewEncryptor(key, WithReadBack(func(context.Context) (io.ReaderAt, int64, error) { return nil, 0, openErr }, 1))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	if err := enc.EncryptStream(ctx, bytes.NewReader(plaintext), io.Discard); !errors.Is(err, openErr) {
+		t.Errorf("EncryptStream error = %v, want the opener's error", err)
+	}
+
+	if _, err := NewEncryptor(key, WithReadBack(nil, 1)); err == nil {
+		t.Error("NewEncryptor accepted a nil opener")
+	}
+	if _, err := NewEncryptor(key, WithReadBack(open, -1)); err == nil {
+		t.Error("NewEncryptor accepted negative samples")
+	}
+}
@@ -0,0 +1,310 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// reader.go: Pull-based io.Reader wrappers for encryption and decryption
+package core
+
+import (
+	"context"
+	"crypto/cipher"
+	"fmt"
+	"io"
+	"time"
+)
+
+// EncryptReader returns an io.Reader that yields the encrypted form of src,
+// for APIs that consume readers such as http.Request bodies or object storage
+// uploads. Encryption happens lazily as the result is read, one chunk at a
+// time, without background goroutines. If sizeHint > 0 it is recorded in the
+// header and src must contain exactly that many bytes.
+//
+// A reader that has been created keeps working if the Encryptor is destroyed
+// while it is in use.
+func (e *Encryptor) EncryptReader(ctx context.Context, src io.Reader, sizeHint ...int64) (io.Reader, error) {
+	if !e.algorithm.IsSupported() {
+		return nil, withDetail(e.errDetail, "encrypt", "stream", fmt.Errorf("unsupported algorithm: %s (only AES-256-GCM is currently supported)", e.algorithm))
+	}
+	var totalSize int64
+	if len(sizeHint) > 0 {
+		totalSize = sizeHint[0]
+	}
+	gcm, err := e.newAEAD()
+	if err != nil {
+		return nil, withDetail(e.errDetail, "encrypt", "stream", err)
+	}
+	sealer, header, err := newChunkSealer(gcm, totalSize, e.startChunkCounter, e.nonceSource, e.flags, nil)
+	if err != nil {
+		return nil, withDetail(e.errDetail, "encrypt", "stream", err)
+	}
+	r := &encryptReader{
+		st:        newStreamStats(e.plainHash),
+		ctx:       ctx,
+		e:         e,
+		src:       src,
+		sealer:    sealer,
+		buf:       make([]byte, e.chunkSize),
+		out:       header,
+		totalSize: totalSize,
+		start:     time.Now(),
+		timer:     newChunkTimer(e.chunkCallback, "encrypt"),
+		progress:  newProgressReporter(e.progress, totalSize),
+	}
+	if e.padding != nil {
+		r.padding = newPaddingReader(src, e.padding)
+		r.src = r.padding
+	}
+	r.st.ciphertext = int64(len(header))
+	if e.mask != nil {
+		iv, stream, err := e.mask.newStream()
+		if err != nil {
+			return nil, withDetail(e.errDetail, "encrypt", "stream", err)
+		}
+		stream.XORKeyStream(header, header)
+		r.out = append(iv, header...)
+		r.mask = stream
+		r.st.ciphertext += MaskIVSize
+	}
+	return r, nil
+}
+
+type encryptReader struct {
+	ctx       context.Context
+	e         *Encryptor
+	src       io.Reader
+	sealer    *chunkSealer
+	buf       []byte
+	out       []byte // pending output
+	pos       int
+	totalSize int64
+	written   int64
+	// padding, if set, pads src; padded counts the padded bytes read.
+	padding  *paddingReader
+	padded   int64
+	err      error // returned once out is drained
+	st       streamStats
+	start    time.Time
+	timer    chunkTimer
+	progress progressReporter
+	// mask, if set, masks the output.
+	mask cipher.Stream
+}
+
+func (r *encryptReader) Read(p []byte) (int, error) {
+	for r.pos >= len(r.out) {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.fill()
+	}
+	n := copy(p, r.out[r.pos:])
+	r.pos += n
+	return n, nil
+}
+
+// WriteTo implements io.WriterTo. It writes the rest of the encrypted stream
+// to w one sealed chunk at a time, so io.Copy hands each chunk to w as it is
+// sealed instead of copying it through an intermediate buffer.
+func (r *encryptReader) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	for {
+		if r.pos < len(r.out) {
+			n, err := w.Write(r.out[r.pos:])
+			r.pos += n
+			written += int64(n)
+			if err == nil && r.pos < len(r.out) {
+				err = io.ErrShortWrite
+			}
+			if err != nil {
+				return written, err
+			}
+		}
+		if r.err == io.EOF {
+			return written, nil
+		}
+		if r.err != nil {
+			return written, r.err
+		}
+		r.fill()
+	}
+}
+
+// fill seals the next chunk, and the trailer at the end of src, into out,
+// masking it if enabled.
+func (r *encryptReader) fill() {
+	r.seal()
+	if r.mask != nil {
+		r.mask.XORKeyStream(r.out, r.out)
+	}
+}
+
+// seal seals the next chunk, and the trailer at the end of src, into out.
+func (r *encryptReader) seal() {
+	r.out, r.pos = r.out[:0], 0
+	if r.ctx.Err() != nil {
+		r.fail(contextError(r.ctx))
+		return
+	}
+
+	r.timer.begin()
+	n, err := io.ReadFull(r.src, r.buf)
+	if n > 0 {
+		var sealErr error
+		r.out, sealErr = r.sealer.seal(r.out, r.buf[:n])
+		if sealErr != nil {
+			r.out = r.out[:0]
+			r.fail(sealErr)
+			return
+		}
+		data := r.buf[:n]
+		if r.padding != nil {
+			data = data[:r.padding.dataLen(r.padded, n)]
+			r.padded += int64(n)
+		}
+		r.st.addPlaintext(data)
+		r.written += int64(len(data))
+		r.st.plaintext = r.written
+		r.st.ciphertext += int64(len(r.out))
+		r.st.chunks++
+		r.progress.update(r.written)
+		r.timer.done(len(data), len(r.out))
+	}
+
+	switch err {
+	case nil:
+	case io.EOF, io.ErrUnexpectedEOF:
+		if r.totalSize > 0 && r.written != r.totalSize {
+			r.out = r.out[:0]
+			r.fail(fmt.Errorf("source size changed during encryption: read %d bytes, expected %d", r.written, r.totalSize))
+			return
+		}
+		trailer := r.sealer.trailer(nil, r.written)
+		r.out = append(r.out, trailer...)
+		r.st.ciphertext += int64(len(trailer))
+		r.st.complete = true
+		r.err = io.EOF
+		r.e.fillReport(r.ctx, "", r.st, r.start, nil)
+		r.progress.finish()
+	default:
+		r.out = r.out[:0]
+		r.fail(atChunk(int(r.sealer.chunks()), WrapError("read source stream", err)))
+	}
+}
+
+func (r *encryptReader) fail(err error) {
+	r.e.fillReport(r.ctx, "", r.st, r.start, err)
+	r.err = withDetail(r.e.errDetail, "encrypt", "stream", err)
+}
+
+// DecryptReader returns an io.Reader that yields the decrypted form of src.
+// The header is read immediately; chunks are decrypted and authenticated as
+// the result is read. Data returned before an error has been authenticated,
+// but only io.EOF proves the stream was complete and untruncated, so callers
+// must treat any other error as invalidating everything read so far.
+//
+// A reader that has been created keeps working if the Decryptor is destroyed
+// while it is in use.
+func (d *Decryptor) DecryptReader(ctx context.Context, src io.Reader, sizeHint ...int64) (io.Reader, error) {
+	r := &decryptReader{ctx: ctx, d: d, st: newStreamStats(d.plainHash), start: time.Now(), timer: newChunkTimer(d.chunkCallback, "decrypt")}
+	gcm, err := d.newAEAD()
+	if err != nil {
+		return nil, withDetail(d.errDetail, "decrypt", "stream", err)
+	}
+	r.opener, err = d.newOpener(gcm, src, &r.st, sizeHint...)
+	if err != nil {
+		d.fillReport(ctx, "decrypt", "", r.st, r.start, err)
+		return nil, withDetail(d.errDetail, "decrypt", "stream", err)
+	}
+	r.progress = newProgressReporter(d.progress, r.opener.totalSize)
+	return r, nil
+}
+
+type decryptReader struct {
+	ctx      context.Context
+	d        *Decryptor
+	opener   *chunkOpener
+	out      []byte // pending plaintext, aliases the opener's buffer
+	err      error
+	st       streamStats
+	start    time.Time
+	timer    chunkTimer
+	progress progressReporter
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.fill()
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// WriteTo implements io.WriterTo. It writes the rest of the plaintext to w
+// one authenticated chunk at a time, straight from the buffer it was
+// decrypted into, so io.Copy needs no intermediate buffer. As with Read, only
+// a nil error proves the stream was complete.
+func (r *decryptReader) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	for {
+		if len(r.out) > 0 {
+			n, err := w.Write(r.out)
+			r.out = r.out[n:]
+			written += int64(n)
+			if err == nil && len(r.out) > 0 {
+				err = io.ErrShortWrite
+			}
+			if err != nil {
+				return written, err
+			}
+		}
+		if r.err == io.EOF {
+			return written, nil
+		}
+		if r.err != nil {
+			return written, r.err
+		}
+		r.fill()
+	}
+}
+
+// fill decrypts the next chunk into out, or sets err at the end of the
+// stream or on failure.
+func (r *decryptReader) fill() {
+	if r.ctx.Err() != nil {
+		r.finish(contextError(r.ctx))
+		return
+	}
+	r.timer.begin()
+	read := r.st.ciphertext
+	out, err := r.opener.next()
+	if err != nil {
+		r.finish(err)
+		return
+	}
+	r.out = out
+	r.st.addPlaintext(out)
+	r.st.plaintext += int64(len(out))
+	r.progress.update(r.opener.written)
+	r.timer.done(len(out), int(r.st.ciphertext-read))
+}
+
+func (r *decryptReader) finish(err error) {
+	r.st.complete = err == io.EOF
+	var failure error
+	if err != io.EOF {
+		failure = err
+	}
+	r.d.fillReport(r.ctx, "decrypt", "", r.st, r.start, failure)
+	if err == io.EOF {
+		r.progress.finish()
+		r.err = io.EOF
+		return
+	}
+	r.err = withDetail(r.d.errDetail, "decrypt", "stream", err)
+}
@@ -0,0 +1,189 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func newReaderTestPair(t *testing.T, chunkSize int) (*Encryptor, *Decryptor) {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	opt, err := WithChunkSize(chunkSize)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	enc, err := NewEncryptor(key, opt)
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	t.Cleanup(enc.Destroy)
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	t.Cleanup(dec.Destroy)
+	return enc, dec
+}
+
+func TestEncryptReader_RoundTrip(t *testing.T) {
+	enc, dec := newReaderTestPair(t, 1000)
+	ctx := context.Background()
+
+	for _, size := range []int{0, 1, 999, 1000, 1001, 12345} {
+		data := make([]byte, size)
+		if _, err := rand.Read(data); err != nil {
+			t.Fatalf("failed to generate data: %v", err)
+		}
+
+		// Short reads from the source must not change the result.
+		er, err := enc.EncryptReader(ctx, iotest.HalfReader(bytes.NewReader(data)), int64(size))
+		if err != nil {
+			t.Fatalf("EncryptReader failed: %v", err)
+		}
+		ciphertext, err := io.ReadAll(iotest.OneByteReader(er))
+		if err != nil {
+			t.Fatalf("size %d: reading ciphertext failed: %v", size, err)
+		}
+
+		// The output is an ordinary encrypted stream.
+		var viaStream bytes.Buffer
+		if err := dec.DecryptStream(ctx, bytes.NewReader(ciphertext), &viaStream); err != nil {
+			t.Fatalf("size %d: DecryptStream failed: %v", size, err)
+		}
+		if !bytes.Equal(viaStream.Bytes(), data) {
+			t.Fatalf("size %d: DecryptStream output does not match", size)
+		}
+
+		dr, err := dec.DecryptReader(ctx, bytes.NewReader(ciphertext))
+		if err != nil {
+			t.Fatalf("DecryptReader failed: %v", err)
+		}
+		plaintext, err := io.ReadAll(dr)
+		if err != nil {
+			t.Fatalf("size %d: reading plaintext failed: %v", size, err)
+		}
+		if !bytes.Equal(plaintext, data) {
+			t.Fatalf("size %d: DecryptReader output does not match", size)
+		}
+	}
+}
+
+func TestDecryptReader_DetectsTruncation(t *testing.T) {
+	enc, dec := newReaderTestPair(t, 16)
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	if err := enc.EncryptStream(ctx, bytes.NewReader(make([]byte, 100)), &buf); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+	truncated := buf.Bytes()[:buf.Len()-TrailerSize]
+
+	dr, err := dec.DecryptReader(ctx, bytes.NewReader(truncated))
+	if err != nil {
+		t.Fatalf("DecryptReader failed: %v", err)
+	}
+	if _, err := io.ReadAll(dr); !errors.Is(err, ErrCorruptedFile) {
+		t.Fatalf("expected ErrCorruptedFile for truncated stream, got %v", err)
+	}
+}
+
+func TestEncryptReader_Canceled(t *testing.T) {
+	enc, _ := newReaderTestPair(t, 16)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	er, err := enc.EncryptReader(ctx, bytes.NewReader(make([]byte, 100)))
+	if err != nil {
+		t.Fatalf("EncryptReader failed: %v", err)
+	}
+	cancel()
+	if _, err := io.ReadAll(er); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+// readerOnly hides the io.WriterTo of a reader from io.Copy.
+type readerOnly struct {
+	io.Reader
+}
+
+func TestStreamReaders_WriteTo(t *testing.T) {
+	enc, dec := newReaderTestPair(t, 1000)
+	ctx := context.Background()
+	nonceSource := enc.nonceSource
+
+	for _, size := range []int{0, 1, 1000, 12345} {
+		data := make([]byte, size)
+		if _, err := rand.Read(data); err != nil {
+			t.Fatalf("failed to generate data: %v", err)
+		}
+		// encrypt copies an EncryptReader to a buffer, after reading prefix
+		// bytes with Read.
+		encrypt := func(c func(io.Writer, io.Reader) (int64, error), prefix int) []byte {
+			t.Helper()
+			enc.nonceSource = &deterministicReader{seed: []byte("writeto")}
+			er, err := enc.EncryptReader(ctx, bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("EncryptReader failed: %v", err)
+			}
+			var buf bytes.Buffer
+			if _, err := io.CopyN(&buf, readerOnly{er}, int64(prefix)); err != nil {
+				t.Fatalf("size %d: reading prefix failed: %v", size, err)
+			}
+			n, err := c(&buf, er)
+			if err != nil || n != int64(buf.Len()-prefix) {
+				t.Fatalf("size %d: copy returned %d, %v", size, n, err)
+			}
+			return buf.Bytes()
+		}
+		want := encrypt(func(w io.Writer, r io.Reader) (int64, error) { return io.Copy(w, readerOnly{r}) }, 0)
+		for _, prefix := range []int{0, 7} {
+			if got := encrypt(io.Copy, prefix); !bytes.Equal(got, want) {
+				t.Errorf("size %d, prefix %d: WriteTo output differs from Read", size, prefix)
+			}
+		}
+
+		dr, err := dec.DecryptReader(ctx, bytes.NewReader(want))
+		if err != nil {
+			t.Fatalf("DecryptReader failed: %v", err)
+		}
+		var plaintext bytes.Buffer
+		if n, err := io.Copy(&plaintext, dr); err != nil || n != int64(size) || !bytes.Equal(plaintext.Bytes(), data) {
+			t.Errorf("size %d: DecryptReader WriteTo returned %d, %v", size, n, err)
+		}
+	}
+	enc.nonceSource = nonceSource
+
+	// WriteTo reports failures of the stream and of the writer.
+	var buf bytes.Buffer
+	if err := enc.EncryptStream(ctx, bytes.NewReader(make([]byte, 3000)), &buf); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+	dr, err := dec.DecryptReader(ctx, bytes.NewReader(buf.Bytes()[:buf.Len()-TrailerSize]))
+	if err != nil {
+		t.Fatalf("DecryptReader failed: %v", err)
+	}
+	if _, err := io.Copy(io.Discard, dr); !errors.Is(err, ErrCorruptedFile) {
+		t.Errorf("expected ErrCorruptedFile for truncated stream, got %v", err)
+	}
+	er, err := enc.EncryptReader(ctx, bytes.NewReader(make([]byte, 3000)))
+	if err != nil {
+		t.Fatalf("EncryptReader failed: %v", err)
+	}
+	if _, err := io.Copy(&failAfterWriter{n: 1}, er); err == nil || err.Error() != "disk full" {
+		t.Errorf("expected the writer's error, got %v", err)
+	}
+}
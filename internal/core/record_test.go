@@ -0,0 +1,80 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestEncryptRecord_RoundTrip(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	enc, err := NewEncryptor(key)
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+
+	aad := []byte("users/42/email")
+	for _, msg := range [][]byte{{}, []byte("alice@example.com"), bytes.Repeat([]byte{7}, 5000)} {
+		record, err := enc.EncryptRecord(msg, aad)
+		if err != nil {
+			t.Fatalf("EncryptRecord failed: %v", err)
+		}
+		if len(record) != len(msg)+RecordOverhead {
+			t.Errorf("record is %d bytes, want %d", len(record), len(msg)+RecordOverhead)
+		}
+		got, err := dec.DecryptRecord(record, aad)
+		if err != nil {
+			t.Fatalf("DecryptRecord failed: %v", err)
+		}
+		if !bytes.Equal(got, msg) {
+			t.Errorf("decrypted record does not match")
+		}
+	}
+
+	record, err := enc.EncryptRecord([]byte("alice@example.com"), aad)
+	if err != nil {
+		t.Fatalf("EncryptRecord failed: %v", err)
+	}
+	// A record moved to another row fails to authenticate.
+	if _, err := dec.DecryptRecord(record, []byte("users/43/email")); !errors.Is(err, ErrAuthenticationFailed) {
+		t.Errorf("expected ErrAuthenticationFailed for other aad, got %v", err)
+	}
+	tampered := bytes.Clone(record)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := dec.DecryptRecord(tampered, aad); !errors.Is(err, ErrAuthenticationFailed) {
+		t.Errorf("expected ErrAuthenticationFailed for tampered record, got %v", err)
+	}
+	if _, err := dec.DecryptRecord(record[:len(record)-1], aad); !errors.Is(err, ErrCorruptedFile) {
+		t.Errorf("expected ErrCorruptedFile for truncated record, got %v", err)
+	}
+
+	// Records and streams are not interchangeable.
+	if err := dec.DecryptStream(context.Background(), bytes.NewReader(record), io.Discard); !errors.Is(err, ErrUnsupportedFeature) {
+		t.Errorf("expected ErrUnsupportedFeature decrypting a record as a stream, got %v", err)
+	}
+	var stream bytes.Buffer
+	if err := enc.EncryptStream(context.Background(), bytes.NewReader([]byte("data")), &stream); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+	if _, err := dec.DecryptRecord(stream.Bytes(), nil); !errors.Is(err, ErrCorruptedFile) {
+		t.Errorf("expected ErrCorruptedFile decrypting a stream as a record, got %v", err)
+	}
+}
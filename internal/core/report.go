@@ -0,0 +1,175 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// report.go: Machine-readable operation reports for go-fileencrypt
+package core
+
+import (
+	"hash"
+	"io"
+	"time"
+)
+
+// OperationReport summarizes a completed encryption or decryption so callers
+// can log and audit the work without re-stating it. Counts reflect the work
+// actually done, so they are partial when the operation fails.
+type OperationReport struct {
+	// Operation is "encrypt", "decrypt", "verify" or "migrate".
+	Operation string
+	// Algorithm is the cipher used.
+	Algorithm Algorithm
+	// PlaintextBytes is the number of plaintext bytes read (encrypt) or written (decrypt).
+	PlaintextBytes int64
+	// CiphertextBytes is the number of encrypted bytes written (encrypt) or read (decrypt),
+	// including header and trailer.
+	CiphertextBytes int64
+	// Chunks is the number of chunks processed.
+	Chunks uint64
+	// Duration is the wall-clock time of the operation.
+	Duration time.Duration
+	// Checksum is the SHA-256 of the output file when WithChecksum is enabled
+	// for a file operation; nil otherwise.
+	Checksum []byte
+	// PlaintextHash is the digest of the plaintext computed in the same pass
+	// when WithPlaintextHash is set; nil otherwise or if the operation failed.
+	PlaintextHash []byte
+	// SealWorkers is the number of goroutines sealing chunks at the end of
+	// a pipelined encryption, as chosen by ParallelismAuto or set with
+	// WithParallelism; 0 without WithPipeline.
+	SealWorkers int
+}
+
+// ChunkInfo describes one chunk processed by an Encryptor or Decryptor, as
+// passed to a WithChunkCallback callback.
+type ChunkInfo struct {
+	// Operation is "encrypt" or "decrypt".
+	Operation string
+	// Index counts the chunks of the operation from 0.
+	Index int
+	// PlaintextSize is the number of plaintext bytes in the chunk, excluding
+	// padding.
+	PlaintextSize int
+	// CiphertextSize is the number of encrypted bytes written or read for
+	// the chunk, including its length prefix and tag.
+	CiphertextSize int
+	// Duration is the time spent reading, sealing or opening, and writing
+	// the chunk. It excludes WithChunkDelay pauses.
+	Duration time.Duration
+}
+
+// chunkTimer reports the chunks of one operation to a WithChunkCallback
+// callback; without one it does nothing.
+type chunkTimer struct {
+	cb    func(ChunkInfo)
+	op    string
+	index int
+	start time.Time
+}
+
+func newChunkTimer(cb func(ChunkInfo), op string) chunkTimer {
+	return chunkTimer{cb: cb, op: op}
+}
+
+// begin marks the start of the next chunk.
+func (t *chunkTimer) begin() {
+	if t.cb != nil {
+		t.start = time.Now()
+	}
+}
+
+// done reports the chunk begun last.
+func (t *chunkTimer) done(plaintext, ciphertext int) {
+	if t.cb == nil {
+		return
+	}
+	t.cb(ChunkInfo{Operation: t.op, Index: t.index, PlaintextSize: plaintext, CiphertextSize: ciphertext, Duration: time.Since(t.start)})
+	t.index++
+}
+
+// streamStats accumulates the counters behind an OperationReport.
+type streamStats struct {
+	plaintext  int64
+	ciphertext int64
+	chunks     uint64
+	checksum   []byte
+	plainHash  hash.Hash
+	complete   bool
+	// sealWorkers is the final number of pipeline workers.
+	sealWorkers int
+	// plainSum and cipherSum hash the plaintext or the output for a
+	// checksum sidecar.
+	plainSum  hash.Hash
+	cipherSum hash.Hash
+	// outSum hashes the output for the WithChecksum checksum.
+	outSum hash.Hash
+	// algorithm is the algorithm recorded in the header read, if any; it
+	// is reported for decryption instead of the configured one.
+	algorithm Algorithm
+}
+
+// newStreamStats returns stats that hash plaintext with newHash, if non-nil.
+func newStreamStats(newHash func() hash.Hash) streamStats {
+	var st streamStats
+	if newHash != nil {
+		st.plainHash = newHash()
+	}
+	return st
+}
+
+// add adds the counters of o, a single file of a batch, to st. st keeps
+// the algorithm of the first file that recorded one.
+func (st *streamStats) add(o streamStats) {
+	st.plaintext += o.plaintext
+	st.ciphertext += o.ciphertext
+	st.chunks += o.chunks
+	if st.algorithm == 0 {
+		st.algorithm = o.algorithm
+	}
+}
+
+// addPlaintext feeds plaintext into the plaintext hashes, if any.
+func (st *streamStats) addPlaintext(p []byte) {
+	if st.plainHash != nil {
+		st.plainHash.Write(p)
+	}
+	if st.plainSum != nil {
+		st.plainSum.Write(p)
+	}
+}
+
+// outputWriter returns w, writing also to the hashes of the output, if any.
+func (st *streamStats) outputWriter(w io.Writer) io.Writer {
+	writers := []io.Writer{w}
+	for _, h := range []hash.Hash{st.cipherSum, st.outSum} {
+		if h != nil {
+			writers = append(writers, h)
+		}
+	}
+	if len(writers) == 1 {
+		return w
+	}
+	return io.MultiWriter(writers...)
+}
+
+// fill copies stats into r, if r is non-nil.
+func (st streamStats) fill(r *OperationReport, op string, alg Algorithm, start time.Time) {
+	if r == nil {
+		return
+	}
+	*r = OperationReport{
+		Operation:       op,
+		Algorithm:       alg,
+		PlaintextBytes:  st.plaintext,
+		CiphertextBytes: st.ciphertext,
+		Chunks:          st.chunks,
+		Duration:        time.Since(start),
+		Checksum:        st.checksum,
+		SealWorkers:     st.sealWorkers,
+	}
+	if st.complete && st.plainHash != nil {
+		r.PlaintextHash = st.plainHash.Sum(nil)
+	}
+}
@@ -0,0 +1,343 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithReport_FileRoundTrip(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	data := make([]byte, 10*1024+7)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("failed to generate data: %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	srcPath := filepath.Join(tmpDir, "plain.bin")
+	encPath := filepath.Join(tmpDir, "plain.enc")
+	decPath := filepath.Join(tmpDir, "plain.dec")
+	if err := os.WriteFile(srcPath, data, 0600); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+
+	chunkOpt, err := WithChunkSize(4096)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+
+	var encReport OperationReport
+	enc, err := NewEncryptor(key, chunkOpt, WithChecksum(true), WithReport(&encReport))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	if err := enc.EncryptFile(context.Background(), srcPath, encPath); err != nil {
+		t.Fatalf("EncryptFile failed: %v", err)
+	}
+
+	encStat, err := os.Stat(encPath)
+	if err != nil {
+		t.Fatalf("failed to stat encrypted file: %v", err)
+	}
+	wantSum, err := CalculateChecksum(encPath)
+	if err != nil {
+		t.Fatalf("CalculateChecksum failed: %v", err)
+	}
+
+	if encReport.Operation != "encrypt" || encReport.Algorithm != AlgorithmAESGCM {
+		t.Errorf("unexpected operation/algorithm: %q/%v", encReport.Operation, encReport.Algorithm)
+	}
+	if encReport.PlaintextBytes != int64(len(data)) {
+		t.Errorf("PlaintextBytes = %d, want %d", encReport.PlaintextBytes, len(data))
+	}
+	if encReport.CiphertextBytes != encStat.Size() {
+		t.Errorf("CiphertextBytes = %d, want %d", encReport.CiphertextBytes, encStat.Size())
+	}
+	if encReport.Chunks != 3 {
+		t.Errorf("Chunks = %d, want 3", encReport.Chunks)
+	}
+	if !bytes.Equal(encReport.Checksum, wantSum) {
+		t.Errorf("Checksum does not match the encrypted file")
+	}
+	if encReport.Duration <= 0 {
+		t.Errorf("expected positive duration, got %v", encReport.Duration)
+	}
+
+	var decReport OperationReport
+	dec, err := NewDecryptor(key, WithReport(&decReport))
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	if err := dec.DecryptFile(context.Background(), encPath, decPath); err != nil {
+		t.Fatalf("DecryptFile failed: %v", err)
+	}
+
+	if decReport.Operation != "decrypt" {
+		t.Errorf("Operation = %q, want decrypt", decReport.Operation)
+	}
+	if decReport.PlaintextBytes != int64(len(data)) || decReport.CiphertextBytes != encStat.Size() || decReport.Chunks != 3 {
+		t.Errorf("unexpected decrypt report: %+v", decReport)
+	}
+	if decReport.Checksum != nil {
+		t.Errorf("expected no checksum without WithChecksum, got %x", decReport.Checksum)
+	}
+}
+
+func TestWithReport_PartialOnFailure(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	data := []byte("0123456789abcdef01234567")
+	ciphertext := encryptUnsized(t, key, data, 8)
+
+	// Corrupt the second chunk so only the first one is decrypted.
+	ciphertext[HeaderSize+(4+8+TagSize)+10] ^= 0x01
+
+	var report OperationReport
+	dec, err := NewDecryptor(key, WithReport(&report))
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	if err := dec.DecryptStream(context.Background(), bytes.NewReader(ciphertext), &bytes.Buffer{}); err == nil {
+		t.Fatal("expected error for corrupted chunk")
+	}
+
+	if report.Chunks != 1 || report.PlaintextBytes != 8 {
+		t.Errorf("expected partial report of 1 chunk / 8 bytes, got %+v", report)
+	}
+	if report.CiphertextBytes != int64(HeaderSize+4+8+TagSize) {
+		t.Errorf("CiphertextBytes = %d, want %d", report.CiphertextBytes, HeaderSize+4+8+TagSize)
+	}
+}
+
+func TestWithPlaintextHash(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	data := make([]byte, 70*1024)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("failed to generate data: %v", err)
+	}
+	want := sha256.Sum256(data)
+	ctx := context.Background()
+
+	var encReport OperationReport
+	enc, err := NewEncryptor(key, WithReport(&encReport), WithPlaintextHash(sha256.New))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	var ciphertext bytes.Buffer
+	if err := enc.EncryptStream(ctx, bytes.NewReader(data), &ciphertext); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+	if !bytes.Equal(encReport.PlaintextHash, want[:]) {
+		t.Errorf("encrypt PlaintextHash = %x, want %x", encReport.PlaintextHash, want)
+	}
+
+	var decReport OperationReport
+	dec, err := NewDecryptor(key, WithReport(&decReport), WithPlaintextHash(sha256.New))
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	dr, err := dec.DecryptReader(ctx, bytes.NewReader(ciphertext.Bytes()))
+	if err != nil {
+		t.Fatalf("DecryptReader failed: %v", err)
+	}
+	if _, err := io.Copy(io.Discard, dr); err != nil {
+		t.Fatalf("reading plaintext failed: %v", err)
+	}
+	if !bytes.Equal(decReport.PlaintextHash, want[:]) {
+		t.Errorf("decrypt PlaintextHash = %x, want %x", decReport.PlaintextHash, want)
+	}
+
+	// A failed operation must not report a digest of partial plaintext.
+	truncated := ciphertext.Bytes()[:ciphertext.Len()-TrailerSize]
+	if err := dec.VerifyStream(ctx, bytes.NewReader(truncated)); err == nil {
+		t.Fatal("expected error for truncated stream")
+	}
+	if decReport.PlaintextHash != nil {
+		t.Errorf("expected no PlaintextHash after failure, got %x", decReport.PlaintextHash)
+	}
+}
+
+func TestWithChunkCallback(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	const chunkSize = 1024
+	data := make([]byte, 2*chunkSize+100)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("failed to generate data: %v", err)
+	}
+	chunkOpt, err := WithChunkSize(chunkSize)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	var chunks []ChunkInfo
+	record := func(c ChunkInfo) { chunks = append(chunks, c) }
+	wantSizes := []int{chunkSize, chunkSize, 100}
+
+	check := func(op string) {
+		t.Helper()
+		if len(chunks) != len(wantSizes) {
+			t.Fatalf("%s: got %d chunk callbacks, want %d", op, len(chunks), len(wantSizes))
+		}
+		for i, c := range chunks {
+			if c.Operation != op || c.Index != i || c.PlaintextSize != wantSizes[i] ||
+				c.CiphertextSize != wantSizes[i]+4+TagSize || c.Duration < 0 {
+				t.Errorf("%s: chunk %d: %+v", op, i, c)
+			}
+		}
+		chunks = nil
+	}
+
+	enc, err := NewEncryptor(key, chunkOpt, WithChunkCallback(record))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	dec, err := NewDecryptor(key, chunkOpt, WithChunkCallback(record))
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	ctx := context.Background()
+
+	var ct bytes.Buffer
+	if err := enc.EncryptStream(ctx, bytes.NewReader(data), &ct); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+	check("encrypt")
+	if err := dec.DecryptStream(ctx, bytes.NewReader(ct.Bytes()), io.Discard); err != nil {
+		t.Fatalf("DecryptStream failed: %v", err)
+	}
+	check("decrypt")
+
+	r, err := enc.EncryptReader(ctx, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("EncryptReader failed: %v", err)
+	}
+	ciphertext, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading EncryptReader failed: %v", err)
+	}
+	check("encrypt")
+	r, err = dec.DecryptReader(ctx, bytes.NewReader(ciphertext))
+	if err != nil {
+		t.Fatalf("DecryptReader failed: %v", err)
+	}
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		t.Fatalf("reading DecryptReader failed: %v", err)
+	}
+	check("decrypt")
+}
+
+// countingHash counts the bytes hashed.
+type countingHash struct {
+	hash.Hash
+	n *int64
+}
+
+func (h countingHash) Write(p []byte) (int, error) {
+	*h.n += int64(len(p))
+	return h.Hash.Write(p)
+}
+
+func TestWithChecksum_HashesOutputOnce(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	tmpDir := t.TempDir()
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		name    string
+		size    int
+		inPlace bool
+		opts    []Option
+	}{
+		{"small", 100, false, nil},
+		{"chunked", 3*1024*1024 + 5, false, nil},
+		{"masked", 1024*1024 + 5, false, []Option{WithMasking(true), WithChecksumSidecar(SidecarCiphertext)}},
+		{"in place", 1024*1024 + 5, true, nil},
+	} {
+		data := make([]byte, tt.size)
+		if _, err := rand.Read(data); err != nil {
+			t.Fatalf("failed to generate data: %v", err)
+		}
+		srcPath := filepath.Join(tmpDir, tt.name+".bin")
+		encPath := srcPath + ".enc"
+		if err := os.WriteFile(srcPath, data, 0600); err != nil {
+			t.Fatalf("failed to write source: %v", err)
+		}
+		if tt.inPlace {
+			encPath = srcPath
+		}
+		// The hash is created before the output is written, not once the
+		// output is complete and can be read back.
+		var hashed int64
+		early := false
+		newHash := func() hash.Hash {
+			content, err := os.ReadFile(encPath)
+			early = errors.Is(err, fs.ErrNotExist) || bytes.Equal(content, data)
+			return countingHash{sha256.New(), &hashed}
+		}
+		var report OperationReport
+		opts := append([]Option{
+			WithChecksum(true),
+			WithChecksumHash(newHash),
+			WithReport(&report),
+		}, tt.opts...)
+		enc, err := NewEncryptor(key, opts...)
+		if err != nil {
+			t.Fatalf("NewEncryptor failed: %v", err)
+		}
+		if tt.inPlace {
+			err = enc.EncryptFileInPlace(ctx, srcPath)
+		} else {
+			err = enc.EncryptFile(ctx, srcPath, encPath)
+		}
+		enc.Destroy()
+		if err != nil {
+			t.Fatalf("%s: encryption failed: %v", tt.name, err)
+		}
+
+		ciphertext, err := os.ReadFile(encPath)
+		if err != nil {
+			t.Fatalf("failed to read output: %v", err)
+		}
+		want := sha256.Sum256(ciphertext)
+		if !bytes.Equal(report.Checksum, want[:]) {
+			t.Errorf("%s: checksum does not match the output", tt.name)
+		}
+		if !early || hashed != int64(len(ciphertext)) {
+			t.Errorf("%s: hashed %d bytes of %d, before writing: %v", tt.name, hashed, len(ciphertext), early)
+		}
+	}
+}
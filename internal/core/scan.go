@@ -0,0 +1,280 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// scan.go: Per-chunk damage reports for encrypted files
+package core
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/gitrgoliveira/go-fileencrypt/format"
+)
+
+// ChunkStatus is the state of one chunk record found by ScanFile.
+type ChunkStatus uint8
+
+const (
+	// ChunkOK marks a record that authenticated; its plaintext is recoverable.
+	ChunkOK ChunkStatus = iota
+	// ChunkAuthFailed marks a record that is present but failed
+	// authentication because it was damaged or modified.
+	ChunkAuthFailed
+	// ChunkTruncated marks a record cut short by the end of the file.
+	ChunkTruncated
+)
+
+// String returns "ok", "auth-failed" or "truncated".
+func (s ChunkStatus) String() string {
+	switch s {
+	case ChunkOK:
+		return "ok"
+	case ChunkAuthFailed:
+		return "auth-failed"
+	case ChunkTruncated:
+		return "truncated"
+	default:
+		return fmt.Sprintf("ChunkStatus(%d)", uint8(s))
+	}
+}
+
+// ChunkScan describes one chunk record of a scanned file.
+type ChunkScan struct {
+	// Index is the chunk number, starting at 0.
+	Index  int
+	Status ChunkStatus
+	// Offset and Length give the byte range of the record in the encrypted
+	// file, including its length prefix and tag.
+	Offset int64
+	Length int64
+	// PlaintextOffset and PlaintextLength give the byte range the chunk
+	// holds in the decrypted file. For padded files they include padding.
+	PlaintextOffset int64
+	PlaintextLength int64
+	// Repaired reports that the length prefix of the record was damaged and
+	// the record authenticated with the length of the file's full chunks.
+	Repaired bool
+}
+
+// ScanReport is the result of ScanFile.
+type ScanReport struct {
+	// HeaderRecovered reports that the header at the start of the file was
+	// damaged and the backup copy written with WithBackupHeader was used.
+	HeaderRecovered bool
+	// Chunks lists every chunk record in file order.
+	Chunks []ChunkScan
+	// Trailer is the status of the trailer of version 2 files: ChunkOK if it
+	// authenticated, ChunkTruncated if the file ends before it. It is
+	// ChunkOK for files without a trailer.
+	Trailer ChunkStatus
+	// Size is the plaintext size recorded in the header or trailer, or -1
+	// if neither is readable.
+	Size int64
+	// Recoverable is the number of plaintext bytes in chunks that
+	// authenticated.
+	Recoverable int64
+}
+
+// OK reports whether the file is undamaged: its header is intact and every
+// chunk and the trailer authenticated as recorded.
+func (r *ScanReport) OK() bool {
+	if r.HeaderRecovered {
+		return false
+	}
+	for _, c := range r.Chunks {
+		if c.Status != ChunkOK || c.Repaired {
+			return false
+		}
+	}
+	return r.Trailer == ChunkOK
+}
+
+// ScanFile authenticates every chunk of the encrypted file at path and reports
+// the status and byte ranges of each one, so that the recoverable parts of a
+// damaged file can be shown. Unlike VerifyFile it does not stop at the first
+// damaged chunk: a record that fails authentication is skipped using its
+// length, or the length of the file's full chunks if its length prefix is
+// damaged too. A damaged header is taken from the backup copy if the file has
+// one.
+//
+// The error is nil for damaged files; it is reserved for files that cannot be
+// scanned at all (unreadable, not an encrypted file, unsupported features,
+// or a damaged header without a backup) and for files in which nothing
+// authenticates, which are reported with ErrWrongKey alongside the report.
+func (d *Decryptor) ScanFile(ctx context.Context, path string) (*ScanReport, error) {
+	ctx, release := d.deadlines(ctx)
+	defer release()
+	start := time.Now()
+	st := newStreamStats(nil)
+	report, err := d.scanFile(ctx, path, &st)
+	d.fillReport(ctx, "scan", path, st, start, err)
+	return report, withDetail(d.errDetail, "scan", path, err)
+}
+
+func (d *Decryptor) scanFile(ctx context.Context, path string, st *streamStats) (*ScanReport, error) {
+	gcm, err := d.newAEAD()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path) // #nosec G304 -- File path provided by caller, library purpose is file decryption
+	if err != nil {
+		return nil, WrapError("open encrypted file", err)
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, WrapError("stat encrypted file", err)
+	}
+	size := stat.Size()
+
+	report := &ScanReport{Size: -1}
+	header := d.backupHeader(f)
+	report.HeaderRecovered = header != nil
+	if header == nil {
+		h, err := format.ReadHeader(io.NewSectionReader(f, 0, size))
+		if err != nil {
+			return nil, err
+		}
+		header = h.Marshal()
+	}
+	h, err := format.ParseHeader(header)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAlgorithm(h, d.algorithms); err != nil {
+		return nil, err
+	}
+	st.algorithm = algorithmOf(h.Flags)
+	if err := h.Flags.Check(supportedFlags); err != nil {
+		return nil, err
+	}
+	if h.Size > 0 {
+		report.Size = int64(h.Size)
+	}
+	aad := h.AAD()
+
+	// Without a trailer the records run to the end of the file. With one,
+	// the trailer is read from its fixed position at the end and, if it
+	// authenticates, bounds the records even when the end marker is damaged.
+	end, limit := size, size
+	if h.Flags&format.FlagBackupHeader != 0 {
+		end -= int64(len(header))
+	}
+	if h.HasTrailer() {
+		report.Trailer = ChunkAuthFailed
+		sealed := make([]byte, TrailerSize-format.LengthSize)
+		if end-int64(len(sealed)) < int64(len(header)) {
+			report.Trailer = ChunkTruncated
+		} else if _, err := f.ReadAt(sealed, end-int64(len(sealed))); err != nil {
+			return nil, readError("read trailer", err)
+		} else if total, chunks, err := openTrailer(gcm, h.Nonce[:], aad, sealed); err == nil {
+			report.Trailer = ChunkOK
+			report.Size = total
+			limit = end - TrailerSize
+			if h.Flags&format.FlagChunkIndex != 0 && chunks <= uint64(size) {
+				limit -= h.IndexSize(chunks)
+			}
+		}
+	}
+
+	var buf []byte
+	var full int64 // record length of full chunks, once known
+	offset, plain := int64(len(header)), int64(0)
+	progress := newProgressReporter(d.progress, size)
+	for index := 0; offset < limit; index++ {
+		if ctx.Err() != nil {
+			return nil, contextError(ctx)
+		}
+		c := ChunkScan{Index: index, Offset: offset, PlaintextOffset: plain}
+		if offset+format.LengthSize > limit {
+			c.Length, c.Status = limit-offset, ChunkTruncated
+			report.Chunks = append(report.Chunks, c)
+			break
+		}
+		var prefix [format.LengthSize]byte
+		if _, err := f.ReadAt(prefix[:], offset); err != nil {
+			return nil, readError("read chunk size", err)
+		}
+		n := int64(binary.BigEndian.Uint32(prefix[:]))
+		if n == 0 && h.HasTrailer() {
+			break
+		}
+
+		// Try the recorded length, then the length of full chunks in case
+		// the prefix itself is damaged.
+		var lengths []int64
+		if n >= TagSize && n <= MaxChunkSize+TagSize {
+			lengths = append(lengths, n)
+		}
+		if full > 0 && full != n {
+			lengths = append(lengths, full)
+		}
+		if len(lengths) == 0 {
+			// Nothing tells where the next record starts.
+			c.Length, c.Status = limit-offset, ChunkAuthFailed
+			if offset+format.LengthSize+n > limit {
+				c.Status = ChunkTruncated
+			}
+			report.Chunks = append(report.Chunks, c)
+			break
+		}
+		c.Status = ChunkAuthFailed
+		if offset+format.LengthSize+lengths[0] > limit {
+			c.Status = ChunkTruncated
+		}
+		c.Length = format.LengthSize + lengths[0]
+		for _, length := range lengths {
+			if offset+format.LengthSize+length > limit {
+				continue
+			}
+			if int64(cap(buf)) < length {
+				buf = make([]byte, length)
+			}
+			sealed := buf[:length]
+			if _, err := f.ReadAt(sealed, offset+format.LengthSize); err != nil {
+				return nil, readError("read encrypted chunk", err)
+			}
+			if _, err := gcm.Open(sealed[:0], h.ChunkNonce(uint32(index)), sealed, aad); err == nil { // #nosec G115 -- records are bounded by the file size
+				c.Status, c.Length, c.Repaired = ChunkOK, format.LengthSize+length, length != n
+				if full == 0 {
+					full = length
+				}
+				break
+			}
+		}
+		if c.Status == ChunkTruncated {
+			c.Length = limit - offset
+		}
+		c.PlaintextLength = max(c.Length-format.LengthSize-TagSize, 0)
+		report.Chunks = append(report.Chunks, c)
+
+		st.chunks++
+		if c.Status == ChunkOK {
+			report.Recoverable += c.PlaintextLength
+		}
+		offset += c.Length
+		plain += c.PlaintextLength
+		progress.update(offset)
+		chunkDone(ctx)
+	}
+	if h.HasTrailer() && report.Trailer != ChunkOK && offset >= size {
+		report.Trailer = ChunkTruncated
+	}
+	st.plaintext = report.Recoverable
+	st.ciphertext = size
+	st.complete = true
+	progress.finish()
+
+	if report.Recoverable == 0 && report.Trailer != ChunkOK && len(report.Chunks) > 0 {
+		return report, authError("scan", true)
+	}
+	return report, nil
+}
@@ -0,0 +1,155 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/gitrgoliveira/go-fileencrypt/format"
+)
+
+func TestScanFile(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	const chunkSize = 1000
+	chunkOpt, err := WithChunkSize(chunkSize)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	enc, err := NewEncryptor(key, chunkOpt, WithChunkIndex(true))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+
+	data := make([]byte, 4500)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("failed to generate data: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := enc.EncryptStream(context.Background(), bytes.NewReader(data), &buf, int64(len(data))); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+	original := buf.Bytes()
+	const record = format.LengthSize + chunkSize + TagSize
+
+	scan := func(t *testing.T, ciphertext []byte) (*ScanReport, error) {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "file.enc")
+		if err := os.WriteFile(path, ciphertext, 0o600); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+		return dec.ScanFile(context.Background(), path)
+	}
+	statuses := func(r *ScanReport) []ChunkStatus {
+		var s []ChunkStatus
+		for _, c := range r.Chunks {
+			s = append(s, c.Status)
+		}
+		return s
+	}
+
+	t.Run("intact", func(t *testing.T) {
+		r, err := scan(t, original)
+		if err != nil {
+			t.Fatalf("ScanFile failed: %v", err)
+		}
+		if !r.OK() || len(r.Chunks) != 5 || r.Recoverable != int64(len(data)) || r.Size != int64(len(data)) {
+			t.Fatalf("report = %+v", r)
+		}
+		for i, c := range r.Chunks {
+			if c.Offset != int64(HeaderSize+i*record) || c.PlaintextOffset != int64(i*chunkSize) {
+				t.Errorf("chunk %d: offsets %d and %d", i, c.Offset, c.PlaintextOffset)
+			}
+			if want := min(chunkSize, len(data)-i*chunkSize); c.PlaintextLength != int64(want) {
+				t.Errorf("chunk %d: plaintext length %d, want %d", i, c.PlaintextLength, want)
+			}
+		}
+	})
+
+	t.Run("damaged chunks", func(t *testing.T) {
+		damaged := bytes.Clone(original)
+		damaged[HeaderSize+record+100] ^= 0xFF // chunk 1 data
+		damaged[HeaderSize+3*record+1] ^= 0xFF // chunk 3 length prefix
+		r, err := scan(t, damaged)
+		if err != nil {
+			t.Fatalf("ScanFile failed: %v", err)
+		}
+		want := []ChunkStatus{ChunkOK, ChunkAuthFailed, ChunkOK, ChunkOK, ChunkOK}
+		if got := statuses(r); !slices.Equal(got, want) {
+			t.Fatalf("statuses = %v, want %v", got, want)
+		}
+		if r.OK() || !r.Chunks[3].Repaired || r.Chunks[2].Repaired || r.Trailer != ChunkOK {
+			t.Errorf("report = %+v", r)
+		}
+		if r.Recoverable != int64(len(data)-chunkSize) {
+			t.Errorf("recoverable = %d, want %d", r.Recoverable, len(data)-chunkSize)
+		}
+		if c := r.Chunks[1]; c.Offset != int64(HeaderSize+record) || c.Length != record || c.PlaintextOffset != chunkSize {
+			t.Errorf("damaged chunk range = %+v", c)
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		r, err := scan(t, original[:HeaderSize+2*record+500])
+		if err != nil {
+			t.Fatalf("ScanFile failed: %v", err)
+		}
+		want := []ChunkStatus{ChunkOK, ChunkOK, ChunkTruncated}
+		if got := statuses(r); !slices.Equal(got, want) {
+			t.Fatalf("statuses = %v, want %v", got, want)
+		}
+		if r.Trailer != ChunkTruncated || r.Recoverable != 2*chunkSize || r.Chunks[2].Length != 500 {
+			t.Errorf("report = %+v", r)
+		}
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		otherKey := make([]byte, 32)
+		if _, err := rand.Read(otherKey); err != nil {
+			t.Fatalf("failed to generate key: %v", err)
+		}
+		other, err := NewDecryptor(otherKey)
+		if err != nil {
+			t.Fatalf("NewDecryptor failed: %v", err)
+		}
+		defer other.Destroy()
+		path := filepath.Join(t.TempDir(), "file.enc")
+		if err := os.WriteFile(path, original, 0o600); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+		r, err := other.ScanFile(context.Background(), path)
+		if !errors.Is(err, ErrWrongKey) {
+			t.Fatalf("expected ErrWrongKey, got %v", err)
+		}
+		if r == nil || len(r.Chunks) != 5 || r.Recoverable != 0 {
+			t.Errorf("report = %+v", r)
+		}
+	})
+
+	t.Run("damaged header", func(t *testing.T) {
+		damaged := bytes.Clone(original)
+		damaged[0] = 'X'
+		if _, err := scan(t, damaged); !errors.Is(err, ErrCorruptedFile) {
+			t.Errorf("expected ErrCorruptedFile, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// secret.go: Short secrets sealed as strings with an expiry
+package core
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gitrgoliveira/go-fileencrypt/secure"
+)
+
+// secretAAD separates sealed secrets from records sealed with EncryptRecord
+// under the same key, so neither opens as the other.
+const secretAAD = "fileencrypt secret\x00"
+
+// secretExpirySize is the size of the expiry stored before a secret.
+const secretExpirySize = 8
+
+// secretEncoding encodes sealed secrets as text safe in URLs, JSON and
+// clipboards.
+var secretEncoding = base64.RawURLEncoding
+
+// EncryptString seals a short secret, such as a password or a token, as a
+// string that expires ttl from now, for applications that keep secrets in
+// text fields or on the clipboard rather than in files. A ttl of zero never
+// expires. The expiry is encrypted and authenticated with the secret, so it
+// cannot be extended. aad binds the string to its context, as for
+// EncryptRecord.
+//
+// secret is zeroed before EncryptString returns, whether or not it
+// succeeds, so the caller holds no plaintext copy afterwards.
+func (e *Encryptor) EncryptString(secret []byte, ttl time.Duration, aad []byte) (string, error) {
+	defer secure.Zero(secret)
+	if len(secret) == 0 {
+		return "", errors.New("secret must not be empty")
+	}
+	if ttl < 0 {
+		return "", fmt.Errorf("invalid secret ttl %v: must not be negative", ttl)
+	}
+	if len(secret) > MaxChunkSize-secretExpirySize {
+		return "", fmt.Errorf("secret of %d bytes exceeds the maximum of %d", len(secret), MaxChunkSize-secretExpirySize)
+	}
+	var expires int64
+	if ttl > 0 {
+		expires = time.Now().Add(ttl).UnixMilli()
+	}
+	plaintext := make([]byte, secretExpirySize+len(secret))
+	defer secure.Zero(plaintext)
+	binary.BigEndian.PutUint64(plaintext, uint64(expires)) // #nosec G115 -- a time after 1970
+	copy(plaintext[secretExpirySize:], secret)
+	record, err := e.EncryptRecord(plaintext, append([]byte(secretAAD), aad...))
+	if err != nil {
+		return "", err
+	}
+	return secretEncoding.EncodeToString(record), nil
+}
+
+// DecryptString opens a string sealed by EncryptString with the same aad.
+// It fails with ErrSecretExpired once the string has expired, and with
+// ErrAuthenticationFailed for a wrong key, a different aad or a modified
+// string. The secret is returned in a SecureBuffer, and the decrypted copy
+// is zeroed; the caller must Destroy the buffer.
+func (d *Decryptor) DecryptString(s string, aad []byte) (*secure.SecureBuffer, error) {
+	record, err := secretEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: sealed secret: %v", ErrCorruptedFile, err)
+	}
+	plaintext, err := d.DecryptRecord(record, append([]byte(secretAAD), aad...))
+	if err != nil {
+		return nil, err
+	}
+	defer secure.Zero(plaintext)
+	if len(plaintext) <= secretExpirySize {
+		return nil, fmt.Errorf("%w: sealed secret is empty", ErrCorruptedFile)
+	}
+	if expires := int64(binary.BigEndian.Uint64(plaintext)); expires != 0 && time.Now().UnixMilli() >= expires { // #nosec G115 -- written from an int64
+		return nil, fmt.Errorf("%w at %s", ErrSecretExpired, time.UnixMilli(expires).UTC().Format(time.RFC3339))
+	}
+	return secure.NewSecureBufferFromBytes(plaintext[secretExpirySize:])
+}
@@ -0,0 +1,99 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEncryptString(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	enc, err := NewEncryptor(key)
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	aad := []byte("vault/github-token")
+
+	secret := []byte("ghp_0123456789abcdef")
+	want := bytes.Clone(secret)
+	sealed, err := enc.EncryptString(secret, time.Hour, aad)
+	if err != nil {
+		t.Fatalf("EncryptString failed: %v", err)
+	}
+	if !bytes.Equal(secret, make([]byte, len(secret))) {
+		t.Error("EncryptString did not zero the secret")
+	}
+	buf, err := dec.DecryptString(sealed, aad)
+	if err != nil {
+		t.Fatalf("DecryptString failed: %v", err)
+	}
+	if !bytes.Equal(buf.Data(), want) {
+		t.Error("decrypted secret does not match")
+	}
+	buf.Destroy()
+
+	if _, err := dec.DecryptString(sealed, []byte("vault/other")); !errors.Is(err, ErrAuthenticationFailed) {
+		t.Errorf("DecryptString with another aad: error = %v, want ErrAuthenticationFailed", err)
+	}
+	// A sealed secret is not a record, and a record is not a sealed secret.
+	record, err := secretEncoding.DecodeString(sealed)
+	if err != nil {
+		t.Fatalf("decode sealed secret: %v", err)
+	}
+	if _, err := dec.DecryptRecord(record, aad); !errors.Is(err, ErrAuthenticationFailed) {
+		t.Errorf("DecryptRecord of a sealed secret: error = %v, want ErrAuthenticationFailed", err)
+	}
+	record, err = enc.EncryptRecord(append(make([]byte, secretExpirySize), want...), aad)
+	if err != nil {
+		t.Fatalf("EncryptRecord failed: %v", err)
+	}
+	if _, err := dec.DecryptString(secretEncoding.EncodeToString(record), aad); !errors.Is(err, ErrAuthenticationFailed) {
+		t.Errorf("DecryptString of a record: error = %v, want ErrAuthenticationFailed", err)
+	}
+
+	// Expired secrets fail; a zero ttl never expires.
+	sealed, err = enc.EncryptString([]byte("one-time code"), time.Millisecond, aad)
+	if err != nil {
+		t.Fatalf("EncryptString failed: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err := dec.DecryptString(sealed, aad); !errors.Is(err, ErrSecretExpired) {
+		t.Errorf("DecryptString after expiry: error = %v, want ErrSecretExpired", err)
+	}
+	sealed, err = enc.EncryptString([]byte("recovery code"), 0, aad)
+	if err != nil {
+		t.Fatalf("EncryptString failed: %v", err)
+	}
+	if buf, err := dec.DecryptString(sealed, aad); err != nil {
+		t.Errorf("DecryptString of a secret without expiry failed: %v", err)
+	} else {
+		buf.Destroy()
+	}
+
+	if _, err := enc.EncryptString(nil, time.Hour, aad); err == nil {
+		t.Error("EncryptString accepted an empty secret")
+	}
+	if _, err := enc.EncryptString([]byte("x"), -time.Second, aad); err == nil {
+		t.Error("EncryptString accepted a negative ttl")
+	}
+	if _, err := dec.DecryptString("not base64!", aad); !errors.Is(err, ErrCorruptedFile) {
+		t.Errorf("DecryptString of invalid text: error = %v, want ErrCorruptedFile", err)
+	}
+}
@@ -11,8 +11,12 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 
 	"github.com/gitrgoliveira/go-fileencrypt/secure"
@@ -160,6 +164,81 @@ func TestChunkSizeValidation_Decryption(t *testing.T) {
 	t.Logf("Got expected error for invalid chunk size: %v", err)
 }
 
+func TestChunkSizeValidation_Bounds(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	chunkOpt, err := WithChunkSize(256 * 1024)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	enc, err := NewEncryptor(key, chunkOpt)
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	data := make([]byte, 300*1024)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("failed to generate data: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := enc.EncryptStream(context.Background(), bytes.NewReader(data), &buf, int64(len(data))); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+	ciphertext := buf.Bytes()
+
+	// A decryptor limited below the file's chunk size refuses it; the limit
+	// alone is enough to create one.
+	limited, err := NewDecryptor(key, WithMaxChunkSizeLimit(64*1024))
+	if err != nil {
+		t.Fatalf("NewDecryptor with a limit failed: %v", err)
+	}
+	defer limited.Destroy()
+	err = limited.DecryptStream(context.Background(), bytes.NewReader(ciphertext), io.Discard)
+	if !errors.Is(err, ErrChunkSize) || errors.Is(err, ErrCorruptedFile) {
+		t.Errorf("expected ErrChunkSize for a chunk above the limit, got %v", err)
+	}
+	dec, err := NewDecryptor(key, WithMaxChunkSizeLimit(256*1024))
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	if err := dec.DecryptStream(context.Background(), bytes.NewReader(ciphertext), io.Discard); err != nil {
+		t.Errorf("DecryptStream within the limit failed: %v", err)
+	}
+
+	unlimited, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer unlimited.Destroy()
+
+	// With the size in the header, no record may exceed the bytes missing.
+	forged := bytes.Clone(ciphertext[:HeaderSize+4])
+	binary.BigEndian.PutUint64(forged[HeaderSize-8:], 100)
+	binary.BigEndian.PutUint32(forged[HeaderSize:], MaxChunkSize+TagSize)
+	err = unlimited.DecryptStream(context.Background(), bytes.NewReader(forged), io.Discard)
+	if !errors.Is(err, ErrChunkSize) || !errors.Is(err, ErrCorruptedFile) {
+		t.Errorf("expected ErrChunkSize for a record above the header size, got %v", err)
+	}
+
+	// Without it, a forged length on a short stream allocates only for the
+	// bytes actually present.
+	binary.BigEndian.PutUint64(forged[HeaderSize-8:], 0)
+	forged = append(forged, make([]byte, 1000)...)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	err = unlimited.DecryptStream(context.Background(), bytes.NewReader(forged), io.Discard)
+	runtime.ReadMemStats(&after)
+	if !errors.Is(err, ErrCorruptedFile) {
+		t.Errorf("expected ErrCorruptedFile for a forged length, got %v", err)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > MaxChunkSize/2 {
+		t.Errorf("forged record length allocated %d bytes", allocated)
+	}
+}
+
 func TestMemoryLocking(t *testing.T) {
 	key := make([]byte, 32)
 	if _, err := rand.Read(key); err != nil {
@@ -467,3 +546,139 @@ func TestCoverageTracking(t *testing.T) {
 
 	t.Logf("Critical test coverage includes %d tests", len(criticalTests))
 }
+
+func TestWithMaxAcceptedChunkSize(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	chunkOpt, err := WithChunkSize(256 * 1024)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	// The cap does not restrict encryption.
+	enc, err := NewEncryptor(key, chunkOpt, WithChunkIndex(true), WithMaxAcceptedChunkSize(64*1024))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	data := make([]byte, 300*1024)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("failed to generate data: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := enc.EncryptStream(context.Background(), bytes.NewReader(data), &buf, int64(len(data))); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+	ciphertext := buf.Bytes()
+
+	limited, err := NewDecryptor(key, WithMaxAcceptedChunkSize(64*1024))
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer limited.Destroy()
+	if limited.chunkSize != 64*1024 {
+		t.Errorf("default buffer size = %d, want the accepted chunk size", limited.chunkSize)
+	}
+	err = limited.DecryptStream(context.Background(), bytes.NewReader(ciphertext), io.Discard)
+	if !errors.Is(err, ErrChunkSize) || errors.Is(err, ErrCorruptedFile) {
+		t.Errorf("DecryptStream: expected ErrChunkSize for a chunk above the cap, got %v", err)
+	}
+	_, err = limited.NewIndexedReader(bytes.NewReader(ciphertext), int64(len(ciphertext)))
+	if !errors.Is(err, ErrChunkSize) {
+		t.Errorf("NewIndexedReader: expected ErrChunkSize for a chunk above the cap, got %v", err)
+	}
+
+	// The lower of the cap and WithMaxChunkSizeLimit applies.
+	dec, err := NewDecryptor(key, WithMaxAcceptedChunkSize(256*1024), WithMaxChunkSizeLimit(128*1024))
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	if err := dec.DecryptStream(context.Background(), bytes.NewReader(ciphertext), io.Discard); !errors.Is(err, ErrChunkSize) {
+		t.Errorf("expected ErrChunkSize below WithMaxChunkSizeLimit, got %v", err)
+	}
+	dec, err = NewDecryptor(key, WithMaxAcceptedChunkSize(256*1024))
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	if err := dec.DecryptStream(context.Background(), bytes.NewReader(ciphertext), io.Discard); err != nil {
+		t.Errorf("DecryptStream within the cap failed: %v", err)
+	}
+
+	if _, err := NewDecryptor(key, WithMaxAcceptedChunkSize(-1)); err == nil {
+		t.Error("NewDecryptor accepted a negative cap")
+	}
+}
+
+func TestInputLimits(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	chunkOpt, err := WithChunkSize(64 * 1024)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	enc, err := NewEncryptor(key, chunkOpt, WithChunkIndex(true))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	data := make([]byte, 300*1024)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("failed to generate data: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := enc.EncryptStream(context.Background(), bytes.NewReader(data), &buf); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+	ciphertext := buf.Bytes()
+	size := int64(len(ciphertext))
+
+	tests := []struct {
+		name string
+		opt  Option
+		ok   bool
+	}{
+		{"chunks", WithMaxChunks(5), true},
+		{"too many chunks", WithMaxChunks(4), false},
+		{"size", WithMaxInputSize(size), true},
+		// The last byte belongs to the trailer.
+		{"too large", WithMaxInputSize(size - 1), false},
+		{"first record", WithMaxInputSize(100), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec, err := NewDecryptor(key, tt.opt)
+			if err != nil {
+				t.Fatalf("NewDecryptor failed: %v", err)
+			}
+			defer dec.Destroy()
+			var out bytes.Buffer
+			err = dec.DecryptStream(context.Background(), bytes.NewReader(ciphertext), &out)
+			if tt.ok && err != nil {
+				t.Errorf("DecryptStream failed: %v", err)
+			}
+			if !tt.ok && (!errors.Is(err, ErrLimitExceeded) || errors.Is(err, ErrCorruptedFile)) {
+				t.Errorf("DecryptStream error = %v, want ErrLimitExceeded", err)
+			}
+
+			r, err := dec.DecryptReader(context.Background(), bytes.NewReader(ciphertext))
+			if err != nil {
+				t.Fatalf("DecryptReader failed: %v", err)
+			}
+			if _, err := io.Copy(io.Discard, r); tt.ok != (err == nil) || (!tt.ok && !errors.Is(err, ErrLimitExceeded)) {
+				t.Errorf("DecryptReader error = %v, ok = %v", err, tt.ok)
+			}
+		})
+	}
+
+	if _, err := NewDecryptor(key, WithMaxChunks(-1)); err == nil {
+		t.Error("NewDecryptor accepted a negative chunk limit")
+	}
+	if _, err := NewDecryptor(key, WithMaxInputSize(-1)); err == nil {
+		t.Error("NewDecryptor accepted a negative size limit")
+	}
+}
@@ -0,0 +1,134 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWithMultiSegment(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	chunkOpt, err := WithChunkSize(1024)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+
+	var input, want []byte
+	add := func(data, ciphertext []byte) {
+		input = append(input, ciphertext...)
+		want = append(want, data...)
+	}
+	random := func(n int) []byte {
+		data := make([]byte, n)
+		if _, err := rand.Read(data); err != nil {
+			t.Fatalf("failed to generate data: %v", err)
+		}
+		return data
+	}
+	encrypt := func(data []byte, sized bool, opts ...Option) []byte {
+		enc, err := NewEncryptor(key, append([]Option{chunkOpt}, opts...)...)
+		if err != nil {
+			t.Fatalf("NewEncryptor failed: %v", err)
+		}
+		defer enc.Destroy()
+		var sizeHint []int64
+		if sized {
+			sizeHint = append(sizeHint, int64(len(data)))
+		}
+		var buf bytes.Buffer
+		if err := enc.EncryptStream(context.Background(), bytes.NewReader(data), &buf, sizeHint...); err != nil {
+			t.Fatalf("EncryptStream failed: %v", err)
+		}
+		return buf.Bytes()
+	}
+
+	// Segments with different layouts, one without a trailer, and an empty one.
+	data := random(3000)
+	add(data, encrypt(data, true))
+	data = random(2500)
+	add(data, encrypt(data, false, WithPadding(PaddingBucket(4096)), WithBackupHeader(true)))
+	data = random(2000)
+	add(data, encrypt(data, true, WithChunkIndex(true)))
+	data = random(1500)
+	add(data, encryptV1(t, key, data, 512))
+	add(nil, encrypt(nil, true, WithHeaderCRC(true)))
+	data = random(700)
+	add(data, encryptV1(t, key, data, 256))
+
+	dec, err := NewDecryptor(key, WithMultiSegment(true))
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+
+	var out bytes.Buffer
+	if err := dec.DecryptStream(context.Background(), bytes.NewReader(input), &out); err != nil {
+		t.Fatalf("DecryptStream failed: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), want) {
+		t.Fatalf("DecryptStream returned %d bytes, want the %d bytes of all segments", out.Len(), len(want))
+	}
+
+	r, err := dec.DecryptReader(context.Background(), bytes.NewReader(input), int64(len(want)))
+	if err != nil {
+		t.Fatalf("DecryptReader failed: %v", err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil || !bytes.Equal(got, want) {
+		t.Fatalf("DecryptReader returned %d bytes, %v; want %d bytes", len(got), err, len(want))
+	}
+
+	dir := t.TempDir()
+	srcPath, dstPath := filepath.Join(dir, "joined.enc"), filepath.Join(dir, "joined")
+	if err := os.WriteFile(srcPath, input, 0o600); err != nil {
+		t.Fatalf("failed to write input: %v", err)
+	}
+	if err := dec.DecryptFile(context.Background(), srcPath, dstPath); err != nil {
+		t.Fatalf("DecryptFile failed: %v", err)
+	}
+	if got, err := os.ReadFile(dstPath); err != nil || !bytes.Equal(got, want) {
+		t.Fatalf("DecryptFile output does not match: %v", err)
+	}
+
+	// Without the option only the first segment is accepted.
+	single, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer single.Destroy()
+	if err := single.DecryptStream(context.Background(), bytes.NewReader(input), io.Discard); !errors.Is(err, ErrCorruptedFile) {
+		t.Errorf("DecryptStream without WithMultiSegment = %v, want ErrCorruptedFile", err)
+	}
+
+	// Damage in a later segment names the segment, and trailing garbage is
+	// not a segment.
+	damaged := bytes.Clone(input)
+	damaged[len(damaged)-10] ^= 0x01
+	err = dec.DecryptStream(context.Background(), bytes.NewReader(damaged), io.Discard)
+	if !errors.Is(err, ErrCorruptedFile) || !strings.Contains(err.Error(), "segment 5") {
+		t.Errorf("damaged last segment: got %v, want ErrCorruptedFile in segment 5", err)
+	}
+	err = dec.DecryptStream(context.Background(), io.MultiReader(bytes.NewReader(input), strings.NewReader("junk")), io.Discard)
+	if !errors.Is(err, ErrCorruptedFile) {
+		t.Errorf("trailing garbage: got %v, want ErrCorruptedFile", err)
+	}
+	err = dec.DecryptStream(context.Background(), io.MultiReader(bytes.NewReader(encrypt(random(100), true)), strings.NewReader("junk")), io.Discard)
+	if !errors.Is(err, ErrCorruptedFile) {
+		t.Errorf("garbage after a segment: got %v, want ErrCorruptedFile", err)
+	}
+}
@@ -0,0 +1,172 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// sfx.go: Self-extracting files for recipients without tooling
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+
+	"github.com/gitrgoliveira/go-fileencrypt/secure"
+)
+
+const (
+	// SelfExtractingMagic ends a self-extracting file, after its footer.
+	SelfExtractingMagic = "GFSFX\x00\x00\x01"
+	// sfxFooterSize is the size of the footer: the lengths of the key
+	// container and of the encrypted payload, and the magic.
+	sfxFooterSize = 4 + 8 + len(SelfExtractingMagic)
+)
+
+// WriteSelfExtracting writes a self-extracting file to dst: the executable
+// stub, followed by src encrypted under a random key, sealed in a key
+// container under password, and a footer locating them. The recipient runs
+// the file and types the password; nothing else needs to be installed. The
+// stub is cmd/fileencrypt-sfx built for the recipient's system, for example
+// with GOOS=windows. name is the file name the stub decrypts to; only its
+// base name is kept. opts configure encryption, as for NewEncryptor.
+//
+// The password protects the file as in SaveKeyFile, with Argon2id, so
+// choose it as for a key file and send it by another channel.
+func WriteSelfExtracting(ctx context.Context, dst io.Writer, stub, src io.Reader, name string, password []byte, opts ...Option) error {
+	name = filepath.Base(name)
+	if name == "." || name == ".." || name == string(filepath.Separator) {
+		return fmt.Errorf("invalid self-extracting file name %q", name)
+	}
+	if len(password) == 0 {
+		return errors.New("self-extracting file password must not be empty")
+	}
+	key, err := GenerateKey()
+	if err != nil {
+		return err
+	}
+	defer secure.Zero(key)
+	container, err := MarshalKeyFile(key, password, KeyFileInfo{Label: name})
+	if err != nil {
+		return err
+	}
+	enc, err := NewEncryptor(key, opts...)
+	if err != nil {
+		return err
+	}
+	defer enc.Destroy()
+
+	if _, err := io.Copy(dst, stub); err != nil {
+		return fmt.Errorf("write self-extracting stub: %w", err)
+	}
+	if _, err := dst.Write(container); err != nil {
+		return fmt.Errorf("write self-extracting key: %w", err)
+	}
+	payload := &countingWriter{w: dst}
+	if err := enc.EncryptStream(ctx, src, payload); err != nil {
+		return err
+	}
+	var footer [sfxFooterSize]byte
+	binary.BigEndian.PutUint32(footer[0:], uint32(len(container))) // #nosec G115 -- bounded by maxKeyFileSize
+	binary.BigEndian.PutUint64(footer[4:], uint64(payload.n))      // #nosec G115 -- a byte count
+	copy(footer[12:], SelfExtractingMagic)
+	if _, err := dst.Write(footer[:]); err != nil {
+		return fmt.Errorf("write self-extracting footer: %w", err)
+	}
+	return nil
+}
+
+// SelfExtracting is a self-extracting file opened with OpenSelfExtracting.
+type SelfExtracting struct {
+	// Name is the base name of the encrypted file.
+	Name      string
+	container []byte
+	payload   *io.SectionReader
+}
+
+// OpenSelfExtracting reads the footer and key container of a
+// self-extracting file of size bytes, such as the running stub's own
+// executable. Files without the footer fail with ErrCorruptedFile.
+func OpenSelfExtracting(r io.ReaderAt, size int64) (*SelfExtracting, error) {
+	if size < int64(sfxFooterSize) {
+		return nil, fmt.Errorf("%w: not a self-extracting file: %d bytes", ErrCorruptedFile, size)
+	}
+	var footer [sfxFooterSize]byte
+	if _, err := r.ReadAt(footer[:], size-int64(sfxFooterSize)); err != nil {
+		return nil, fmt.Errorf("read self-extracting footer: %w", err)
+	}
+	if !bytes.Equal(footer[12:], []byte(SelfExtractingMagic)) {
+		return nil, fmt.Errorf("%w: not a self-extracting file", ErrCorruptedFile)
+	}
+	containerLen := int64(binary.BigEndian.Uint32(footer[0:]))
+	payloadLen := binary.BigEndian.Uint64(footer[4:])
+	available := size - int64(sfxFooterSize)
+	if containerLen > maxKeyFileSize || payloadLen > math.MaxInt64 || containerLen+int64(payloadLen) > available {
+		return nil, fmt.Errorf("%w: self-extracting footer: key of %d bytes and payload of %d bytes exceed the file", ErrCorruptedFile, containerLen, payloadLen)
+	}
+	payloadStart := available - int64(payloadLen)
+	container := make([]byte, containerLen)
+	if _, err := r.ReadAt(container, payloadStart-containerLen); err != nil {
+		return nil, fmt.Errorf("read self-extracting key: %w", err)
+	}
+	info, _, _, err := parseKeyFile(container)
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.Base(info.Label)
+	if name != info.Label || name == "." || name == ".." {
+		return nil, fmt.Errorf("%w: self-extracting file name %q is not a base name", ErrCorruptedFile, info.Label)
+	}
+	return &SelfExtracting{
+		Name:      name,
+		container: container,
+		payload:   io.NewSectionReader(r, payloadStart, int64(payloadLen)),
+	}, nil
+}
+
+// Unlock decrypts the file's key with password. A wrong password fails
+// with ErrAuthenticationFailed, so Unlock can be passed to an Unlocker.
+// The caller must Destroy the returned buffer.
+func (s *SelfExtracting) Unlock(password []byte) (*secure.SecureBuffer, error) {
+	key, _, err := UnmarshalKeyFile(s.container, password)
+	return key, err
+}
+
+// Payload returns the encrypted file, for DecryptStream with the key from
+// Unlock.
+func (s *SelfExtracting) Payload() io.Reader {
+	return io.NewSectionReader(s.payload, 0, s.payload.Size())
+}
+
+// Decrypt unlocks the key with password and decrypts the file to dst. opts
+// configure decryption, as for NewDecryptor.
+func (s *SelfExtracting) Decrypt(ctx context.Context, dst io.Writer, password []byte, opts ...Option) error {
+	key, err := s.Unlock(password)
+	if err != nil {
+		return err
+	}
+	defer key.Destroy()
+	dec, err := NewDecryptorFromSecureBuffer(key, opts...)
+	if err != nil {
+		return err
+	}
+	defer dec.Destroy()
+	return dec.DecryptStream(ctx, s.Payload(), dst)
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,69 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// sfx_test.go: Tests for self-extracting files
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func TestSelfExtracting(t *testing.T) {
+	ctx := context.Background()
+	stub := []byte("\x7fELF stub executable")
+	content := make([]byte, 50000)
+	if _, err := rand.Read(content); err != nil {
+		t.Fatalf("failed to generate content: %v", err)
+	}
+	password := []byte("correct horse battery staple")
+
+	var out bytes.Buffer
+	err := WriteSelfExtracting(ctx, &out, bytes.NewReader(stub), bytes.NewReader(content), "/tmp/reports/q3.pdf", password)
+	if err != nil {
+		t.Fatalf("WriteSelfExtracting failed: %v", err)
+	}
+	file := out.Bytes()
+	if !bytes.HasPrefix(file, stub) {
+		t.Fatal("self-extracting file does not start with the stub")
+	}
+
+	sfx, err := OpenSelfExtracting(bytes.NewReader(file), int64(len(file)))
+	if err != nil {
+		t.Fatalf("OpenSelfExtracting failed: %v", err)
+	}
+	if sfx.Name != "q3.pdf" {
+		t.Errorf("Name = %q, want the base name q3.pdf", sfx.Name)
+	}
+	var got bytes.Buffer
+	if err := sfx.Decrypt(ctx, &got, password); err != nil {
+		t.Fatalf("Decrypt failed: %v", err)
+	}
+	if !bytes.Equal(got.Bytes(), content) {
+		t.Error("decrypted content differs")
+	}
+	if err := sfx.Decrypt(ctx, &got, []byte("wrong password")); !errors.Is(err, ErrAuthenticationFailed) {
+		t.Errorf("Decrypt with a wrong password: error = %v, want ErrAuthenticationFailed", err)
+	}
+
+	// The stub alone, and files whose footer points outside them, are
+	// rejected.
+	if _, err := OpenSelfExtracting(bytes.NewReader(stub), int64(len(stub))); !errors.Is(err, ErrCorruptedFile) {
+		t.Errorf("OpenSelfExtracting of the stub: error = %v, want ErrCorruptedFile", err)
+	}
+	bad := bytes.Clone(file)
+	bad[len(bad)-sfxFooterSize+4] = 0xff
+	if _, err := OpenSelfExtracting(bytes.NewReader(bad), int64(len(bad))); !errors.Is(err, ErrCorruptedFile) {
+		t.Errorf("OpenSelfExtracting with an oversized payload: error = %v, want ErrCorruptedFile", err)
+	}
+
+	if err := WriteSelfExtracting(ctx, &out, bytes.NewReader(stub), bytes.NewReader(content), "q3.pdf", nil); err == nil {
+		t.Error("WriteSelfExtracting accepted an empty password")
+	}
+}
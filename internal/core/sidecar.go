@@ -0,0 +1,103 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// sidecar.go: Checksum sidecar files written during encryption
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// SidecarExt is the extension appended to the output path for checksum
+// sidecars.
+const SidecarExt = ".sha256"
+
+// maxSidecarSize bounds the sidecar ReadChecksumFile reads: a digest, a file
+// name and some slack.
+const maxSidecarSize = 64 * 1024
+
+// SidecarSource selects the data a checksum sidecar covers.
+type SidecarSource int
+
+const (
+	// SidecarNone writes no sidecar (default).
+	SidecarNone SidecarSource = iota
+	// SidecarPlaintext records the SHA-256 of the source file, to check a
+	// decrypted copy against.
+	SidecarPlaintext
+	// SidecarCiphertext records the SHA-256 of the encrypted file, to check
+	// transfers and backups without the key.
+	SidecarCiphertext
+)
+
+func (s SidecarSource) String() string {
+	switch s {
+	case SidecarNone:
+		return "none"
+	case SidecarPlaintext:
+		return "plaintext"
+	case SidecarCiphertext:
+		return "ciphertext"
+	default:
+		return fmt.Sprintf("SidecarSource(%d)", int(s))
+	}
+}
+
+// addSidecar sets up the hash of the data source covers.
+func (st *streamStats) addSidecar(source SidecarSource) {
+	switch source {
+	case SidecarPlaintext:
+		st.plainSum = sha256.New()
+	case SidecarCiphertext:
+		st.cipherSum = sha256.New()
+	}
+}
+
+// writeSidecar writes the digest hashed during the encryption of srcPath to
+// dstPath to the sidecar of dstPath, naming the file it covers.
+func (st *streamStats) writeSidecar(srcPath, dstPath string) error {
+	sum, name := st.plainSum, filepath.Base(srcPath)
+	if st.cipherSum != nil {
+		sum, name = st.cipherSum, filepath.Base(dstPath)
+	}
+	line := fmt.Sprintf("%x  %s\n", sum.Sum(nil), name)
+	return writeFileAtomic(dstPath+SidecarExt, 0o600, func(f *os.File) error {
+		if _, err := io.WriteString(f, line); err != nil {
+			return WrapError("write checksum sidecar", err)
+		}
+		return nil
+	})
+}
+
+// ReadChecksumFile returns the digest in a checksum sidecar: either a bare
+// hex digest or the first line of sha256sum output, "<hex>  <name>".
+func ReadChecksumFile(path string) ([]byte, error) {
+	f, err := os.Open(path) // #nosec G304 -- Sidecar path provided by caller
+	if err != nil {
+		return nil, WrapError("open checksum file", err)
+	}
+	defer func() { _ = f.Close() }()
+	data, err := io.ReadAll(io.LimitReader(f, maxSidecarSize))
+	if err != nil {
+		return nil, WrapError("read checksum file", err)
+	}
+	line, _, _ := bytes.Cut(data, []byte("\n"))
+	fields := bytes.Fields(line)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("invalid checksum file %s: empty", path)
+	}
+	sum, err := hex.DecodeString(string(fields[0]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid checksum file %s: %w", path, err)
+	}
+	return sum, nil
+}
@@ -0,0 +1,84 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// sidecar_test.go: Tests for checksum sidecars
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithChecksumSidecar(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "data.bin")
+	data := make([]byte, 300*1024)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("failed to generate data: %v", err)
+	}
+	if err := os.WriteFile(src, data, 0o600); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+
+	for _, source := range []SidecarSource{SidecarPlaintext, SidecarCiphertext} {
+		t.Run(source.String(), func(t *testing.T) {
+			dst := filepath.Join(dir, source.String()+".enc")
+			enc, err := NewEncryptor(key, WithChecksumSidecar(source))
+			if err != nil {
+				t.Fatalf("NewEncryptor failed: %v", err)
+			}
+			defer enc.Destroy()
+			if err := enc.EncryptFile(context.Background(), src, dst); err != nil {
+				t.Fatalf("EncryptFile failed: %v", err)
+			}
+
+			covered, name := data, "data.bin"
+			if source == SidecarCiphertext {
+				if covered, err = os.ReadFile(dst); err != nil {
+					t.Fatalf("failed to read output: %v", err)
+				}
+				name = filepath.Base(dst)
+			}
+			want := sha256.Sum256(covered)
+			line, err := os.ReadFile(dst + SidecarExt)
+			if err != nil {
+				t.Fatalf("failed to read sidecar: %v", err)
+			}
+			if string(line) != fmt.Sprintf("%x  %s\n", want, name) {
+				t.Errorf("sidecar = %q", line)
+			}
+			sum, err := ReadChecksumFile(dst + SidecarExt)
+			if err != nil || !bytes.Equal(sum, want[:]) {
+				t.Errorf("ReadChecksumFile = %x, %v; want %x", sum, err, want)
+			}
+		})
+	}
+
+	// No sidecar is written when encryption fails.
+	enc, err := NewEncryptor(key, WithChecksumSidecar(SidecarPlaintext))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	dst := filepath.Join(dir, "missing.enc")
+	if err := enc.EncryptFile(context.Background(), filepath.Join(dir, "missing"), dst); err == nil {
+		t.Fatal("EncryptFile of a missing file succeeded")
+	}
+	if _, err := os.Stat(dst + SidecarExt); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("sidecar written for a failed encryption: %v", err)
+	}
+}
@@ -0,0 +1,206 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// signing.go: Public-key signatures of directory manifests
+package core
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ManifestTrust selects the public-key signatures a manifest must carry to
+// be accepted. The HMAC of the manifest proves it was written by a holder of
+// the file key; a signature also proves who wrote it, and can be checked
+// without the key with VerifyManifestSignature.
+type ManifestTrust struct {
+	// PublicKey, if set, must have made the signature: an
+	// ed25519.PublicKey, *ecdsa.PublicKey or *rsa.PublicKey.
+	PublicKey crypto.PublicKey
+	// Roots, if set, must anchor the certificate chain stored in the
+	// manifest, whose leaf must have made the signature.
+	Roots *x509.CertPool
+	// CurrentTime, if set, is the time the chain is checked at instead of
+	// now, so a backup signed with a since expired certificate can still be
+	// restored.
+	CurrentTime time.Time
+}
+
+// manifestSigner signs the manifests an Encryptor writes.
+type manifestSigner struct {
+	signer crypto.Signer
+	chain  []*x509.Certificate
+}
+
+// WithManifestSigner makes EncryptDir sign its manifest with signer, an
+// Ed25519, ECDSA or RSA private key (or a crypto.Signer backed by an HSM), in
+// addition to the HMAC. With a certificate chain, leaf first, the chain is
+// stored in the manifest so it can be verified against trusted roots; the
+// leaf must certify signer's public key. Ed25519 signs the manifest itself,
+// ECDSA and RSA (PKCS #1 v1.5) its SHA-256 digest.
+func WithManifestSigner(signer crypto.Signer, chain ...*x509.Certificate) Option {
+	return func(cfg *Config) {
+		cfg.ManifestSigner = signer
+		cfg.ManifestChain = chain
+	}
+}
+
+// WithManifestTrust makes ReadManifest, DecryptDir and VerifyManifest reject
+// manifests without a signature that trust accepts.
+func WithManifestTrust(trust ManifestTrust) Option {
+	return func(cfg *Config) {
+		cfg.ManifestTrust = &trust
+	}
+}
+
+// newManifestSigner returns the signer configured in cfg, or nil.
+func newManifestSigner(cfg *Config) *manifestSigner {
+	if cfg.ManifestSigner == nil {
+		return nil
+	}
+	return &manifestSigner{signer: cfg.ManifestSigner, chain: cfg.ManifestChain}
+}
+
+// checkManifestSigner reports whether signer and chain can sign manifests.
+func checkManifestSigner(signer crypto.Signer, chain []*x509.Certificate) error {
+	if signer == nil {
+		if len(chain) > 0 {
+			return fmt.Errorf("manifest certificate chain without a signer")
+		}
+		return nil
+	}
+	switch signer.Public().(type) {
+	case ed25519.PublicKey, *ecdsa.PublicKey, *rsa.PublicKey:
+	default:
+		return fmt.Errorf("unsupported manifest signer key type %T", signer.Public())
+	}
+	if len(chain) > 0 {
+		leaf, ok := chain[0].PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+		if !ok || !leaf.Equal(signer.Public()) {
+			return fmt.Errorf("manifest signer does not match the leaf certificate")
+		}
+	}
+	return nil
+}
+
+// sign adds the signature of body, the compact manifest, and the certificate
+// chain to signed.
+func (s *manifestSigner) sign(signed *signedManifest, body []byte) error {
+	var sig []byte
+	var err error
+	if _, ok := s.signer.Public().(ed25519.PublicKey); ok {
+		sig, err = s.signer.Sign(rand.Reader, body, crypto.Hash(0))
+	} else {
+		digest := sha256.Sum256(body)
+		sig, err = s.signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		return WrapError("sign manifest", err)
+	}
+	signed.Signature = base64.StdEncoding.EncodeToString(sig)
+	signed.Certificates = nil
+	for _, cert := range s.chain {
+		signed.Certificates = append(signed.Certificates, base64.StdEncoding.EncodeToString(cert.Raw))
+	}
+	return nil
+}
+
+// verify checks the signature of body, the compact manifest, against t.
+func (t *ManifestTrust) verify(signed *signedManifest, body []byte) error {
+	if signed.Signature == "" {
+		return fmt.Errorf("manifest: %w: not signed", ErrAuthenticationFailed)
+	}
+	sig, err := base64.StdEncoding.DecodeString(signed.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: invalid manifest signature encoding", ErrCorruptedFile)
+	}
+	var certs []*x509.Certificate
+	for _, c := range signed.Certificates {
+		der, err := base64.StdEncoding.DecodeString(c)
+		if err != nil {
+			return fmt.Errorf("%w: invalid manifest certificate encoding", ErrCorruptedFile)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return fmt.Errorf("%w: invalid manifest certificate: %w", ErrCorruptedFile, err)
+		}
+		certs = append(certs, cert)
+	}
+
+	var pub crypto.PublicKey
+	if len(certs) > 0 {
+		pub = certs[0].PublicKey
+	}
+	if t.Roots != nil {
+		if len(certs) == 0 {
+			return fmt.Errorf("manifest: %w: no certificate chain", ErrAuthenticationFailed)
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		if _, err := certs[0].Verify(x509.VerifyOptions{
+			Roots:         t.Roots,
+			Intermediates: intermediates,
+			CurrentTime:   t.CurrentTime,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		}); err != nil {
+			return fmt.Errorf("manifest: %w: %w", ErrAuthenticationFailed, err)
+		}
+	}
+	if t.PublicKey != nil {
+		if key, ok := pub.(interface{ Equal(crypto.PublicKey) bool }); ok && !key.Equal(t.PublicKey) {
+			return fmt.Errorf("manifest: %w: certificate does not match the trusted key", ErrAuthenticationFailed)
+		}
+		pub = t.PublicKey
+	}
+	if pub == nil {
+		return fmt.Errorf("manifest: %w: no key to verify the signature with", ErrAuthenticationFailed)
+	}
+
+	digest := sha256.Sum256(body)
+	var ok bool
+	switch pub := pub.(type) {
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(pub, body, sig)
+	case *ecdsa.PublicKey:
+		ok = ecdsa.VerifyASN1(pub, digest[:], sig)
+	case *rsa.PublicKey:
+		ok = rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) == nil
+	default:
+		return fmt.Errorf("manifest: unsupported signature key type %T", pub)
+	}
+	if !ok {
+		return fmt.Errorf("manifest: %w: bad signature", ErrAuthenticationFailed)
+	}
+	return nil
+}
+
+// VerifyManifestSignature reads the manifest at path and checks its public
+// key signature against trust, without the file key: the HMAC is not
+// checked. Restore tooling can use it to prove a backup catalog is authentic
+// before fetching anything. Manifests encrypted with WithObfuscatedNames
+// need the key; use a Decryptor with WithManifestTrust for them.
+func VerifyManifestSignature(path string, trust ManifestTrust) (*Manifest, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- File path provided by caller
+	if err != nil {
+		return nil, WrapError("read manifest", err)
+	}
+	if bytes.HasPrefix(data, []byte(MagicBytes)) {
+		return nil, fmt.Errorf("%w: manifest is encrypted and needs the key", ErrUnsupportedFeature)
+	}
+	return openManifest(nil, data, &trust)
+}
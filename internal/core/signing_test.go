@@ -0,0 +1,181 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// signing_test.go: Tests for public-key signatures of directory manifests
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestManifestSigner_Ed25519(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate signing key: %v", err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate signing key: %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	manifestPath := filepath.Join(tmpDir, "manifest.json")
+	writeTree(t, srcDir, map[string][]byte{"a.txt": []byte("alpha"), "sub/b.txt": []byte("beta")})
+
+	enc, err := NewEncryptor(key, WithManifest(manifestPath), WithManifestSigner(priv))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	if err := enc.EncryptDir(context.Background(), srcDir, filepath.Join(tmpDir, "enc")); err != nil {
+		t.Fatalf("EncryptDir failed: %v", err)
+	}
+
+	// Restore tooling can check the signature without the file key.
+	m, err := VerifyManifestSignature(manifestPath, ManifestTrust{PublicKey: pub})
+	if err != nil {
+		t.Fatalf("VerifyManifestSignature failed: %v", err)
+	}
+	if len(m.Files) != 2 {
+		t.Errorf("manifest lists %d files, want 2", len(m.Files))
+	}
+	if _, err := VerifyManifestSignature(manifestPath, ManifestTrust{PublicKey: otherPub}); !errors.Is(err, ErrAuthenticationFailed) {
+		t.Errorf("wrong public key: error = %v, want ErrAuthenticationFailed", err)
+	}
+
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatalf("failed to read manifest: %v", err)
+	}
+	tampered := bytes.Replace(data, []byte(`"size": 5`), []byte(`"size": 6`), 1)
+	if bytes.Equal(tampered, data) {
+		t.Fatal("test did not modify the manifest")
+	}
+	tamperedPath := filepath.Join(tmpDir, "tampered.json")
+	if err := os.WriteFile(tamperedPath, tampered, 0o600); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+	if _, err := VerifyManifestSignature(tamperedPath, ManifestTrust{PublicKey: pub}); !errors.Is(err, ErrAuthenticationFailed) {
+		t.Errorf("tampered manifest: error = %v, want ErrAuthenticationFailed", err)
+	}
+
+	// A decryptor that trusts the key checks both the HMAC and the signature.
+	dec, err := NewDecryptor(key, WithManifestTrust(ManifestTrust{PublicKey: pub}))
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	if _, err := dec.ReadManifest(manifestPath); err != nil {
+		t.Errorf("ReadManifest failed: %v", err)
+	}
+
+	// An unsigned manifest is rejected once a signature is required.
+	unsigned, err := signManifest(key, m, nil)
+	if err != nil {
+		t.Fatalf("signManifest failed: %v", err)
+	}
+	if err := os.WriteFile(tamperedPath, unsigned, 0o600); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+	if _, err := dec.ReadManifest(tamperedPath); !errors.Is(err, ErrAuthenticationFailed) {
+		t.Errorf("unsigned manifest: error = %v, want ErrAuthenticationFailed", err)
+	}
+}
+
+func TestManifestSigner_X509(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	now := time.Now()
+	newCert := func(template, parent *x509.Certificate, pub any, signer any) *x509.Certificate {
+		t.Helper()
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, signer)
+		if err != nil {
+			t.Fatalf("CreateCertificate failed: %v", err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatalf("ParseCertificate failed: %v", err)
+		}
+		return cert
+	}
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate CA key: %v", err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "backup CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	ca := newCert(caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate leaf key: %v", err)
+	}
+	leaf := newCert(&x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "backup signer"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}, ca, &leafKey.PublicKey, caKey)
+
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	manifestPath := filepath.Join(tmpDir, "manifest.json")
+	writeTree(t, srcDir, map[string][]byte{"a.txt": []byte("alpha")})
+
+	// The chain must certify the signer.
+	if _, err := NewEncryptor(key, WithManifest(manifestPath), WithManifestSigner(caKey, leaf)); err == nil {
+		t.Error("NewEncryptor accepted a signer that does not match the leaf certificate")
+	}
+
+	enc, err := NewEncryptor(key, WithManifest(manifestPath), WithManifestSigner(leafKey, leaf))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	if err := enc.EncryptDir(context.Background(), srcDir, filepath.Join(tmpDir, "enc")); err != nil {
+		t.Fatalf("EncryptDir failed: %v", err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	if _, err := VerifyManifestSignature(manifestPath, ManifestTrust{Roots: roots}); err != nil {
+		t.Fatalf("VerifyManifestSignature failed: %v", err)
+	}
+	if _, err := VerifyManifestSignature(manifestPath, ManifestTrust{Roots: x509.NewCertPool()}); !errors.Is(err, ErrAuthenticationFailed) {
+		t.Errorf("untrusted root: error = %v, want ErrAuthenticationFailed", err)
+	}
+	later := ManifestTrust{Roots: roots, CurrentTime: now.Add(2 * time.Hour)}
+	if _, err := VerifyManifestSignature(manifestPath, later); !errors.Is(err, ErrAuthenticationFailed) {
+		t.Errorf("expired chain: error = %v, want ErrAuthenticationFailed", err)
+	}
+}
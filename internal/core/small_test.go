@@ -0,0 +1,76 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptFile_SmallMatchesStream(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	chunkOpt, err := WithChunkSize(100)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "plain")
+	dst := filepath.Join(dir, "enc")
+
+	for _, indexed := range []bool{false, true} {
+		// Sizes below the chunk size take the single-Seal path for files;
+		// the stream is always encrypted chunk by chunk.
+		for _, size := range []int{0, 1, 99, 100, 250} {
+			data := make([]byte, size)
+			if _, err := rand.Read(data); err != nil {
+				t.Fatalf("failed to generate data: %v", err)
+			}
+			if err := os.WriteFile(src, data, 0600); err != nil {
+				t.Fatalf("failed to write source: %v", err)
+			}
+			var report OperationReport
+			var progress []float64
+			enc, err := NewEncryptor(key, chunkOpt, WithChunkIndex(indexed), WithReport(&report),
+				WithProgress(func(p float64) { progress = append(progress, p) }))
+			if err != nil {
+				t.Fatalf("NewEncryptor failed: %v", err)
+			}
+			enc.nonceSource = &deterministicReader{seed: []byte("small")}
+			if err := enc.EncryptFile(context.Background(), src, dst); err != nil {
+				t.Fatalf("size %d: EncryptFile failed: %v", size, err)
+			}
+			fileReport := report
+			enc.nonceSource = &deterministicReader{seed: []byte("small")}
+			var want bytes.Buffer
+			if err := enc.EncryptStream(context.Background(), bytes.NewReader(data), &want, int64(size)); err != nil {
+				t.Fatalf("size %d: EncryptStream failed: %v", size, err)
+			}
+			enc.Destroy()
+
+			got, err := os.ReadFile(dst)
+			if err != nil {
+				t.Fatalf("failed to read output: %v", err)
+			}
+			if !bytes.Equal(got, want.Bytes()) {
+				t.Errorf("size %d, indexed %v: file output differs from stream output", size, indexed)
+			}
+			if fileReport.PlaintextBytes != int64(size) || fileReport.CiphertextBytes != int64(len(got)) || fileReport.Chunks != report.Chunks {
+				t.Errorf("size %d: report %+v, stream report %+v", size, fileReport, report)
+			}
+			if len(progress) == 0 || progress[len(progress)-1] != 1.0 {
+				t.Errorf("size %d: unexpected progress %v", size, progress)
+			}
+		}
+	}
+}
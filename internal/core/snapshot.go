@@ -0,0 +1,188 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// snapshot.go: Snapshot metadata and retention for directory manifests
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SnapshotManifestExt is the extension of the manifests ListSnapshots and
+// PruneSnapshots read from a directory.
+const SnapshotManifestExt = ".manifest"
+
+// snapshotIDLayout formats the IDs of snapshots created without one.
+const snapshotIDLayout = "20060102T150405Z"
+
+// SnapshotInfo identifies the run of EncryptDir or SyncDir that wrote a
+// manifest. It is stored in the manifest, covered by its signature.
+type SnapshotInfo struct {
+	ID string `json:"id"`
+	// Time is when the manifest was written, in UTC.
+	Time   time.Time         `json:"time"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Snapshot is a snapshot found by ListSnapshots.
+type Snapshot struct {
+	SnapshotInfo
+	// Manifest is the path of the snapshot's manifest.
+	Manifest string
+	// Files and Size count the files the manifest lists, and their plaintext
+	// bytes, excluding tombstones.
+	Files int
+	Size  int64
+}
+
+// RetentionPolicy selects the snapshots PruneSnapshots keeps. A snapshot is
+// kept if any rule keeps it; a policy with no rules keeps everything. Days,
+// weeks (ISO 8601) and months are counted in UTC, and keep the newest
+// snapshot of each of the most recent periods that have one.
+type RetentionPolicy struct {
+	// KeepLast keeps the newest snapshots.
+	KeepLast int
+	// KeepWithin keeps the snapshots taken within this duration of the
+	// newest one.
+	KeepWithin time.Duration
+	// KeepDaily, KeepWeekly and KeepMonthly keep one snapshot per period.
+	KeepDaily   int
+	KeepWeekly  int
+	KeepMonthly int
+	// KeepLabels keeps the snapshots carrying any of these labels, such as
+	// "pinned".
+	KeepLabels []string
+}
+
+// WithSnapshot makes EncryptDir and SyncDir record a snapshot ID, the time
+// and labels in the manifest, so that ListSnapshots and PruneSnapshots can
+// manage rotating backups. An empty id is replaced by the UTC time, as in
+// "20261016T120000Z". WithManifest is required.
+func WithSnapshot(id string, labels map[string]string) Option {
+	return func(cfg *Config) {
+		cfg.Snapshot = &SnapshotInfo{ID: id, Labels: maps.Clone(labels)}
+	}
+}
+
+// at returns the snapshot information of a manifest written at t.
+func (s *SnapshotInfo) at(t time.Time) *SnapshotInfo {
+	info := &SnapshotInfo{ID: s.ID, Time: t.UTC(), Labels: maps.Clone(s.Labels)}
+	if info.ID == "" {
+		info.ID = info.Time.Format(snapshotIDLayout)
+	}
+	return info
+}
+
+// ListSnapshots reads every manifest ending in SnapshotManifestExt in dir
+// and returns the snapshots they record, oldest first. Each manifest is
+// verified as ReadManifest does, and any that fails is an error; manifests
+// written without WithSnapshot are skipped.
+func (d *Decryptor) ListSnapshots(dir string) ([]Snapshot, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, WrapError("read snapshot directory", err)
+	}
+	var snaps []Snapshot
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !strings.HasSuffix(entry.Name(), SnapshotManifestExt) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		m, err := d.ReadManifest(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if m.Snapshot == nil {
+			continue
+		}
+		snap := Snapshot{SnapshotInfo: *m.Snapshot, Manifest: path}
+		for _, file := range m.Files {
+			if file.DeletedAt.IsZero() {
+				snap.Files++
+				snap.Size += file.Size
+			}
+		}
+		snaps = append(snaps, snap)
+	}
+	slices.SortStableFunc(snaps, func(a, b Snapshot) int { return a.Time.Compare(b.Time) })
+	return snaps, nil
+}
+
+// PruneSnapshots lists the snapshots in dir as ListSnapshots does, removes
+// the manifests of those policy does not keep and returns them. The
+// encrypted files of a pruned snapshot are left for the caller to delete.
+func (d *Decryptor) PruneSnapshots(dir string, policy RetentionPolicy) ([]Snapshot, error) {
+	snaps, err := d.ListSnapshots(dir)
+	if err != nil {
+		return nil, err
+	}
+	_, prune := ApplyRetention(snaps, policy)
+	for i, snap := range prune {
+		if err := os.Remove(snap.Manifest); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return prune[:i], WrapError("remove manifest", err)
+		}
+	}
+	return prune, nil
+}
+
+// ApplyRetention splits snaps into those policy keeps and those it prunes,
+// each oldest first.
+func ApplyRetention(snaps []Snapshot, policy RetentionPolicy) (keep, prune []Snapshot) {
+	if policy.KeepLast <= 0 && policy.KeepWithin <= 0 && policy.KeepDaily <= 0 &&
+		policy.KeepWeekly <= 0 && policy.KeepMonthly <= 0 && len(policy.KeepLabels) == 0 {
+		return slices.Clone(snaps), nil
+	}
+	// Walk from the newest snapshot so that each period keeps its newest.
+	newest := slices.Clone(snaps)
+	slices.SortStableFunc(newest, func(a, b Snapshot) int { return b.Time.Compare(a.Time) })
+	kept := make([]bool, len(newest))
+	periods := []struct {
+		n   int
+		key func(t time.Time) string
+	}{
+		{policy.KeepDaily, func(t time.Time) string { return t.Format(time.DateOnly) }},
+		{policy.KeepWeekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{policy.KeepMonthly, func(t time.Time) string { return t.Format("2006-01") }},
+	}
+	for _, p := range periods {
+		seen := make(map[string]bool)
+		for i := range newest {
+			if len(seen) >= p.n {
+				break
+			}
+			if key := p.key(newest[i].Time.UTC()); !seen[key] {
+				seen[key] = true
+				kept[i] = true
+			}
+		}
+	}
+	for i, snap := range newest {
+		if i < policy.KeepLast ||
+			policy.KeepWithin > 0 && newest[0].Time.Sub(snap.Time) <= policy.KeepWithin ||
+			slices.ContainsFunc(policy.KeepLabels, func(label string) bool { _, ok := snap.Labels[label]; return ok }) {
+			kept[i] = true
+		}
+	}
+	for i := len(newest) - 1; i >= 0; i-- {
+		if kept[i] {
+			keep = append(keep, newest[i])
+		} else {
+			prune = append(prune, newest[i])
+		}
+	}
+	return keep, prune
+}
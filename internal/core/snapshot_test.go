@@ -0,0 +1,137 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSnapshots(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	manifests := filepath.Join(tmpDir, "manifests")
+	writeTree(t, srcDir, map[string][]byte{"a.txt": []byte("alpha"), "b/c.txt": []byte("gamma")})
+	if err := os.Mkdir(manifests, 0700); err != nil {
+		t.Fatalf("Mkdir failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(manifests, "notes.txt"), []byte("not a manifest"), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	ctx := context.Background()
+
+	for _, id := range []string{"monday", "tuesday", ""} {
+		labels := map[string]string{"host": "db1"}
+		if id == "monday" {
+			labels["pinned"] = "yes"
+		}
+		name := id
+		if name == "" {
+			name = "auto"
+		}
+		enc, err := NewEncryptor(key, WithManifest(filepath.Join(manifests, name+SnapshotManifestExt)), WithSnapshot(id, labels))
+		if err != nil {
+			t.Fatalf("NewEncryptor failed: %v", err)
+		}
+		err = enc.EncryptDir(ctx, srcDir, filepath.Join(tmpDir, "enc-"+name))
+		enc.Destroy()
+		if err != nil {
+			t.Fatalf("EncryptDir failed: %v", err)
+		}
+	}
+
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	snaps, err := dec.ListSnapshots(manifests)
+	if err != nil {
+		t.Fatalf("ListSnapshots failed: %v", err)
+	}
+	if len(snaps) != 3 || snaps[0].ID != "monday" || snaps[1].ID != "tuesday" {
+		t.Fatalf("ListSnapshots = %+v", snaps)
+	}
+	if _, err := time.Parse(snapshotIDLayout, snaps[2].ID); err != nil {
+		t.Errorf("generated ID %q: %v", snaps[2].ID, err)
+	}
+	if s := snaps[0]; s.Files != 2 || s.Size != 10 || s.Labels["host"] != "db1" || s.Time.IsZero() {
+		t.Errorf("snapshot = %+v", s)
+	}
+
+	// The newest and the pinned snapshot are kept.
+	pruned, err := dec.PruneSnapshots(manifests, RetentionPolicy{KeepLast: 1, KeepLabels: []string{"pinned"}})
+	if err != nil {
+		t.Fatalf("PruneSnapshots failed: %v", err)
+	}
+	if len(pruned) != 1 || pruned[0].ID != "tuesday" {
+		t.Errorf("pruned = %+v", pruned)
+	}
+	if _, err := os.Stat(filepath.Join(manifests, "tuesday"+SnapshotManifestExt)); !os.IsNotExist(err) {
+		t.Errorf("pruned manifest still exists: %v", err)
+	}
+
+	// A manifest that fails verification is reported, not skipped.
+	if err := os.WriteFile(filepath.Join(manifests, "bad"+SnapshotManifestExt), []byte("{}"), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if _, err := dec.ListSnapshots(manifests); err == nil {
+		t.Error("ListSnapshots accepted an invalid manifest")
+	}
+
+	if _, err := NewEncryptor(key, WithSnapshot("x", nil)); err == nil {
+		t.Error("NewEncryptor accepted a snapshot without a manifest")
+	}
+}
+
+func TestApplyRetention(t *testing.T) {
+	base := time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC)
+	var snaps []Snapshot
+	// One snapshot every 12 hours for 60 days, oldest first.
+	for i := 119; i >= 0; i-- {
+		snaps = append(snaps, Snapshot{SnapshotInfo: SnapshotInfo{Time: base.Add(-time.Duration(i) * 12 * time.Hour)}})
+	}
+	times := func(s []Snapshot) []time.Time {
+		var out []time.Time
+		for _, snap := range s {
+			out = append(out, snap.Time)
+		}
+		return out
+	}
+
+	keep, prune := ApplyRetention(snaps, RetentionPolicy{})
+	if len(keep) != len(snaps) || prune != nil {
+		t.Errorf("empty policy pruned %d snapshots", len(prune))
+	}
+
+	keep, prune = ApplyRetention(snaps, RetentionPolicy{KeepDaily: 3})
+	want := []time.Time{base.Add(-48 * time.Hour), base.Add(-24 * time.Hour), base}
+	if !slices.Equal(times(keep), want) || len(prune) != len(snaps)-3 {
+		t.Errorf("KeepDaily kept %v", times(keep))
+	}
+
+	keep, _ = ApplyRetention(snaps, RetentionPolicy{KeepMonthly: 2, KeepWithin: 12 * time.Hour})
+	// The newest of March (base) and February, and the one 12h before base.
+	want = []time.Time{time.Date(2026, 2, 28, 12, 0, 0, 0, time.UTC), base.Add(-12 * time.Hour), base}
+	if !slices.Equal(times(keep), want) {
+		t.Errorf("KeepMonthly and KeepWithin kept %v", times(keep))
+	}
+
+	keep, _ = ApplyRetention(snaps, RetentionPolicy{KeepWeekly: 1, KeepLast: 2})
+	if !slices.Equal(times(keep), []time.Time{base.Add(-12 * time.Hour), base}) {
+		t.Errorf("KeepWeekly and KeepLast kept %v", times(keep))
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// space.go: Output file creation, preallocation and out-of-space handling
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// createOutput creates the output file at path for the input src. With
+// preallocate set, size bytes are reserved up front, so that a disk without
+// room for the output fails with ErrNoSpace before anything is written.
+//
+// If path names src itself, under the same or another name or through a
+// link, it fails with ErrSameFile before truncating it.
+func createOutput(src *os.File, path string, size int64, preallocate bool) (*os.File, error) {
+	if err := checkSameFile(src, path); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(path) // #nosec G304 -- File path provided by caller
+	if err != nil {
+		return nil, noSpace(WrapError("create destination file", err))
+	}
+	if preallocate && size > 0 {
+		if err := allocate(f, size); err != nil {
+			return nil, closeOutput(f, WrapError("preallocate destination file", err))
+		}
+	}
+	return f, nil
+}
+
+// checkSameFile returns ErrSameFile if path names the regular file src.
+// Devices such as /dev/stdin and /dev/stdout may be the same terminal and
+// are not checked.
+func checkSameFile(src *os.File, path string) error {
+	srcInfo, err := src.Stat()
+	if err != nil || !srcInfo.Mode().IsRegular() {
+		return nil
+	}
+	dstInfo, err := os.Stat(path)
+	if err != nil || !os.SameFile(srcInfo, dstInfo) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s is %s", ErrSameFile, path, src.Name())
+}
+
+// closeOutput closes an output file made by createOutput. If err is set, or
+// closing fails, the partial output is removed so that a failed operation
+// leaves nothing behind; only regular files are removed, never devices such
+// as /dev/stdout. The returned error matches ErrNoSpace when the disk or
+// quota filled up.
+func closeOutput(f *os.File, err error) error {
+	if err == nil {
+		if err = f.Close(); err == nil {
+			return nil
+		}
+		err = WrapError("close destination file", err)
+	}
+	info, statErr := f.Stat()
+	_ = f.Close()
+	if statErr == nil && info.Mode().IsRegular() {
+		_ = os.Remove(f.Name())
+	}
+	return noSpace(err)
+}
+
+// noSpace marks err with ErrNoSpace if it was caused by a full disk or an
+// exhausted quota.
+func noSpace(err error) error {
+	if err == nil || errors.Is(err, ErrNoSpace) || !isNoSpace(err) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrNoSpace, err)
+}
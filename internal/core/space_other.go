@@ -0,0 +1,15 @@
+//go:build !unix && !windows
+
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+// isNoSpace reports false on platforms where out-of-space errors cannot be
+// recognized.
+func isNoSpace(err error) bool {
+	return false
+}
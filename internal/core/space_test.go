@@ -0,0 +1,201 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithPreallocate(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	tmpDir := t.TempDir()
+	src := filepath.Join(tmpDir, "src")
+	encrypted := filepath.Join(tmpDir, "src.enc")
+	decrypted := filepath.Join(tmpDir, "src.dec")
+	data := make([]byte, 3*DefaultChunkSize+17)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("failed to generate data: %v", err)
+	}
+	if err := os.WriteFile(src, data, 0600); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+
+	enc, err := NewEncryptor(key, WithPreallocate(true))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	if err := enc.EncryptFile(context.Background(), src, encrypted); err != nil {
+		t.Fatalf("EncryptFile failed: %v", err)
+	}
+	info, err := os.Stat(encrypted)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if want := encryptedSize(int64(len(data)), DefaultChunkSize, false); info.Size() != want {
+		t.Errorf("preallocated output has size %d, want %d", info.Size(), want)
+	}
+
+	dec, err := NewDecryptor(key, WithPreallocate(true))
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	if err := dec.DecryptFile(context.Background(), encrypted, decrypted); err != nil {
+		t.Fatalf("DecryptFile failed: %v", err)
+	}
+	got, err := os.ReadFile(decrypted)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("decrypted data does not match")
+	}
+}
+
+func TestDecryptFile_RemovesPartialOutput(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	tmpDir := t.TempDir()
+	src := filepath.Join(tmpDir, "src")
+	encrypted := filepath.Join(tmpDir, "src.enc")
+	decrypted := filepath.Join(tmpDir, "src.dec")
+	if err := os.WriteFile(src, make([]byte, 3*DefaultChunkSize), 0600); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+	enc, err := NewEncryptor(key)
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	if err := enc.EncryptFile(context.Background(), src, encrypted); err != nil {
+		t.Fatalf("EncryptFile failed: %v", err)
+	}
+
+	// Corrupt the last chunk so that earlier chunks are written out first.
+	data, err := os.ReadFile(encrypted)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	data[len(data)-TrailerSize-1] ^= 1
+	if err := os.WriteFile(encrypted, data, 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	err = dec.DecryptFile(context.Background(), encrypted, decrypted)
+	if !errors.Is(err, ErrAuthenticationFailed) {
+		t.Fatalf("expected ErrAuthenticationFailed, got %v", err)
+	}
+	if _, err := os.Stat(decrypted); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("partial output left behind: %v", err)
+	}
+}
+
+func TestEncryptFile_NoSpace(t *testing.T) {
+	// Writes to /dev/full fail with ENOSPC.
+	const full = "/dev/full"
+	if _, err := os.Stat(full); err != nil {
+		t.Skipf("%s not available: %v", full, err)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	src := filepath.Join(t.TempDir(), "src")
+	if err := os.WriteFile(src, make([]byte, 2*DefaultChunkSize), 0600); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+
+	enc, err := NewEncryptor(key)
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	err = enc.EncryptFile(context.Background(), src, full)
+	if !errors.Is(err, ErrNoSpace) {
+		t.Fatalf("expected ErrNoSpace, got %v", err)
+	}
+	if !errors.Is(SanitizeError(err), ErrNoSpace) {
+		t.Errorf("sanitized error lost ErrNoSpace: %v", SanitizeError(err))
+	}
+	if _, err := os.Stat(full); err != nil {
+		t.Errorf("device removed after failure: %v", err)
+	}
+}
+
+func TestEncryptFile_SameFile(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	enc, err := NewEncryptor(key)
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	ctx := context.Background()
+
+	tmpDir := t.TempDir()
+	src := filepath.Join(tmpDir, "src")
+	data := []byte("must survive being its own destination")
+	if err := os.WriteFile(src, data, 0600); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+	encrypted := filepath.Join(tmpDir, "src.enc")
+	if err := enc.EncryptFile(ctx, src, encrypted); err != nil {
+		t.Fatalf("EncryptFile failed: %v", err)
+	}
+	ciphertext, err := os.ReadFile(encrypted)
+	if err != nil {
+		t.Fatalf("failed to read encrypted file: %v", err)
+	}
+
+	// The same path, another spelling of it and a hard link all name the
+	// source, which is left untouched.
+	link := filepath.Join(tmpDir, "link")
+	if err := os.Link(src, link); err != nil {
+		t.Fatalf("failed to link source: %v", err)
+	}
+	for _, dst := range []string{src, filepath.Join(tmpDir, ".", "src"), link} {
+		if err := enc.EncryptFile(ctx, src, dst); !errors.Is(err, ErrSameFile) {
+			t.Errorf("EncryptFile to %s: error = %v, want ErrSameFile", dst, err)
+		}
+	}
+	if got, err := os.ReadFile(src); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("source changed by a failed EncryptFile: %q, %v", got, err)
+	}
+	if err := dec.DecryptFile(ctx, encrypted, encrypted); !errors.Is(err, ErrSameFile) {
+		t.Errorf("DecryptFile onto itself: error = %v, want ErrSameFile", err)
+	}
+	if got, err := os.ReadFile(encrypted); err != nil || !bytes.Equal(got, ciphertext) {
+		t.Errorf("input changed by a failed DecryptFile: %v", err)
+	}
+	if !errors.Is(SanitizeError(ErrSameFile), ErrSameFile) {
+		t.Error("SanitizeError lost ErrSameFile")
+	}
+}
@@ -0,0 +1,532 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// stream.go: Record framing shared by the writer- and reader-based APIs
+package core
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"slices"
+
+	"github.com/gitrgoliveira/go-fileencrypt/format"
+)
+
+// chunkSealer produces the framed records of one encrypted stream.
+type chunkSealer struct {
+	gcm       cipher.AEAD
+	baseNonce []byte
+	aad       []byte
+	nonce     []byte
+	counter   uint32
+	start     uint32
+	// index holds the encoded chunk index when indexed is set, with record
+	// digests when digests is set; offset is the file position of the next
+	// record.
+	indexed bool
+	digests bool
+	index   []byte
+	offset  int64
+	// backup is the header copied after the trailer; nil without
+	// format.FlagBackupHeader.
+	backup []byte
+}
+
+// newChunkSealer reads a fresh base nonce from random and returns a sealer
+// together with the stream header recording totalSize and flags in addition
+// to headerFlags. With format.FlagChunkIndex, the sealer records a chunk index
+// and writes it before the trailer. With format.FlagBackupHeader, it writes a
+// copy of the header after the trailer. With format.FlagPadded, the header records
+// size 0 so that it does not reveal the size the padding hides. A non-nil part
+// is recorded in the header with format.FlagPart.
+func newChunkSealer(gcm cipher.AEAD, totalSize int64, startCounter uint32, random io.Reader, flags format.Flags, part *format.Part) (*chunkSealer, []byte, error) {
+	h := format.Header{
+		Version: Version,
+		Flags:   headerFlags | flags,
+		Size:    uint64(totalSize), // #nosec G115 -- int64 to uint64 conversion safe for file sizes
+	}
+	if part != nil {
+		h.Flags |= format.FlagPart
+		h.Part = *part
+	}
+	if flags&format.FlagPadded != 0 {
+		h.Size = 0
+	}
+	indexed := flags&format.FlagChunkIndex != 0
+	if _, err := io.ReadFull(random, h.Nonce[:]); err != nil {
+		return nil, nil, WrapError("generate nonce", err)
+	}
+
+	s := &chunkSealer{
+		gcm:       gcm,
+		baseNonce: h.Nonce[:],
+		aad:       h.AAD(),
+		nonce:     make([]byte, NonceSize),
+		counter:   startCounter,
+		start:     startCounter,
+		indexed:   indexed,
+		digests:   flags&format.FlagChunkDigests != 0,
+		offset:    int64(h.Len()),
+	}
+	if flags&format.FlagBackupHeader != 0 {
+		s.backup = h.Marshal()
+	}
+	return s, h.Marshal(), nil
+}
+
+// chunks returns the number of chunks sealed so far.
+func (s *chunkSealer) chunks() uint64 {
+	return uint64(s.counter - s.start)
+}
+
+// seal appends the record for plaintext (4-byte length, ciphertext and tag) to dst.
+func (s *chunkSealer) seal(dst, plaintext []byte) ([]byte, error) {
+	counter, err := s.reserve()
+	if err != nil {
+		return dst, err
+	}
+	start := len(dst)
+	dst = s.sealAt(dst, s.nonce, plaintext, counter)
+	s.account(dst[start:])
+	return dst, nil
+}
+
+// reserve returns the nonce counter of the next record. Records can then be
+// sealed out of order with sealAt, as long as account sees them in order.
+func (s *chunkSealer) reserve() (uint32, error) {
+	chunk := int(s.counter - s.start)
+	counter := s.counter
+	s.counter++
+	if s.counter == 0 {
+		return 0, atChunk(chunk, fmt.Errorf("nonce overflow: stream too large for single encryption"))
+	}
+	return counter, nil
+}
+
+// sealAt appends the record for plaintext under the nonce counter to dst,
+// building the nonce in the NonceSize scratch buffer nonce. It does not
+// change the sealer, so records can be sealed concurrently with their own
+// nonce buffers.
+func (s *chunkSealer) sealAt(dst, nonce, plaintext []byte, counter uint32) []byte {
+	copy(nonce, s.baseNonce)
+	binary.BigEndian.PutUint32(nonce[8:], counter)
+	length := uint32(len(plaintext) + s.gcm.Overhead()) // #nosec G115 -- fits in uint32 (max chunk is 10MB)
+	dst = binary.BigEndian.AppendUint32(dst, length)
+	return s.gcm.Seal(dst, nonce, plaintext, s.aad) // #nosec G407 -- Nonce is randomly generated per file, not hardcoded
+}
+
+// account records the next record, as returned by sealAt, in the chunk index.
+func (s *chunkSealer) account(record []byte) {
+	length := uint32(len(record) - format.LengthSize) // #nosec G115 -- fits in uint32 (max chunk is 10MB)
+	if s.indexed {
+		s.index = format.AppendIndexEntry(s.index, format.IndexEntry{Offset: s.offset, Length: length})
+		if s.digests {
+			digest := format.ChunkDigest(record)
+			s.index = append(s.index, digest[:]...)
+		}
+	}
+	s.offset += int64(len(record))
+}
+
+// trailer appends the end marker, the sealed chunk index if enabled, the
+// sealed trailer for written plaintext bytes and the backup header if enabled
+// to dst.
+func (s *chunkSealer) trailer(dst []byte, written int64) []byte {
+	out := slices.Grow(dst, TrailerSize+len(s.index)+TagSize+len(s.backup))
+	out = append(out, make([]byte, format.LengthSize)...)
+	if s.indexed {
+		out = s.gcm.Seal(out, metadataNonce(s.baseNonce, format.RecordIndex), s.index, s.aad)
+	}
+	out = sealTrailer(out, s.gcm, s.baseNonce, s.aad, written, s.chunks())
+	return append(out, s.backup...)
+}
+
+// chunkOpener reads and authenticates the records of one encrypted stream.
+type chunkOpener struct {
+	src        io.Reader
+	gcm        cipher.AEAD
+	baseNonce  []byte
+	aad        []byte
+	nonce      []byte
+	buf        []byte
+	hasTrailer bool
+	totalSize  int64
+	// written counts the plaintext bytes returned by next and opened those
+	// decrypted, which include the padding of padded streams.
+	written int64
+	opened  int64
+	counter uint32
+	done    bool
+	st      *streamStats
+	// index hashes the entries expected in the chunk index when the file has
+	// one, and digest the records when its entries carry digests; offset is
+	// the file position of the next record.
+	index  hash.Hash
+	digest hash.Hash
+	offset int64
+	// header is the parsed stream header.
+	header format.Header
+	// padding holds back the zero bytes that may be padding; nil unless the
+	// stream is padded.
+	padding *paddingFilter
+	// backup is the header the copy after the trailer must match; nil
+	// without format.FlagBackupHeader.
+	backup []byte
+	// maxChunk, if positive, is the largest record plaintext accepted.
+	maxChunk int
+	// maxChunks and maxInput, if positive, bound the records and the bytes
+	// read over all segments, as counted in st.
+	maxChunks int64
+	maxInput  int64
+	// algorithms, if set, are the algorithms accepted in segment headers.
+	algorithms []Algorithm
+	// multiSegment continues with the next encrypted stream when one ends.
+	// segment numbers the current stream from 0, and pending holds bytes
+	// already read from the next one.
+	multiSegment bool
+	segment      int
+	pending      []byte
+}
+
+// newChunkOpener reads and validates the stream header, refusing streams
+// sealed with an algorithm outside algorithms (any if nil). totalSize is
+// taken from the header, or from sizeHint when the header does not record it.
+func newChunkOpener(gcm cipher.AEAD, src io.Reader, st *streamStats, algorithms []Algorithm, sizeHint ...int64) (*chunkOpener, error) {
+	var buf headerBuf
+	h, header, err := readHeader(src, &buf)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAlgorithm(h, algorithms); err != nil {
+		return nil, err
+	}
+	st.algorithm = algorithmOf(h.Flags)
+	if err := h.Flags.Check(supportedFlags); err != nil {
+		return nil, err
+	}
+	st.ciphertext += int64(len(header))
+
+	var totalSize int64
+	if h.Size > 0 {
+		totalSize = int64(h.Size) // #nosec G115 -- uint64 to int64 conversion safe for file sizes (validated in header)
+	} else if len(sizeHint) > 0 {
+		totalSize = sizeHint[0]
+	}
+
+	o := &chunkOpener{
+		src:        src,
+		gcm:        gcm,
+		baseNonce:  h.Nonce[:],
+		aad:        h.AAD(),
+		nonce:      make([]byte, NonceSize),
+		hasTrailer: h.HasTrailer(),
+		offset:     int64(h.Len()),
+		totalSize:  totalSize,
+		st:         st,
+		header:     h,
+		algorithms: algorithms,
+	}
+	if h.Flags&format.FlagChunkIndex != 0 {
+		if !o.hasTrailer {
+			return nil, fmt.Errorf("%w: invalid file format: chunk index without trailer", ErrCorruptedFile)
+		}
+		o.index = sha256.New()
+		if h.Flags&format.FlagChunkDigests != 0 {
+			o.digest = sha256.New()
+		}
+	} else if h.Flags&format.FlagChunkDigests != 0 {
+		return nil, fmt.Errorf("%w: invalid file format: chunk digests without chunk index", ErrCorruptedFile)
+	}
+	if h.Flags&format.FlagPadded != 0 {
+		if !o.hasTrailer {
+			return nil, fmt.Errorf("%w: invalid file format: padding without trailer", ErrCorruptedFile)
+		}
+		o.padding = &paddingFilter{}
+	}
+	if h.Flags&format.FlagBackupHeader != 0 {
+		if !o.hasTrailer {
+			return nil, fmt.Errorf("%w: invalid file format: backup header without trailer", ErrCorruptedFile)
+		}
+		o.backup = bytes.Clone(header)
+	}
+	return o, nil
+}
+
+// next returns the next plaintext chunk, valid until the following call, or
+// io.EOF once the stream has ended and its length has been authenticated.
+// The padding of padded streams is removed. With multiSegment, a stream that
+// ends is followed by the next one until the input ends.
+func (o *chunkOpener) next() ([]byte, error) {
+	for {
+		var plaintext []byte
+		var err error
+		if o.padding != nil {
+			plaintext, err = o.padding.next(o.nextRecord)
+		} else {
+			plaintext, err = o.nextRecord()
+		}
+		o.written += int64(len(plaintext))
+		if err == io.EOF && o.multiSegment {
+			more, err := o.nextSegment()
+			if more {
+				continue
+			}
+			return nil, err
+		}
+		if err != nil && err != io.EOF && o.segment > 0 {
+			err = fmt.Errorf("segment %d: %w", o.segment, err)
+		}
+		return plaintext, err
+	}
+}
+
+// nextSegment replaces the finished stream of o with the one that follows it
+// in the input. It reports false with io.EOF at the end of the input.
+func (o *chunkOpener) nextSegment() (bool, error) {
+	if len(o.pending) == 0 {
+		var b [1]byte
+		if _, err := io.ReadFull(o.src, b[:]); err == io.EOF {
+			return false, io.EOF
+		} else if err != nil {
+			return false, readError("read segment header", err)
+		}
+		o.pending = b[:]
+	}
+	segment := o.segment + 1
+	next, err := newChunkOpener(o.gcm, io.MultiReader(bytes.NewReader(o.pending), o.src), o.st, o.algorithms)
+	if err != nil {
+		return false, fmt.Errorf("segment %d: %w", segment, err)
+	}
+	next.buf, next.maxChunk, next.multiSegment, next.segment = o.buf, o.maxChunk, true, segment
+	next.maxChunks, next.maxInput = o.maxChunks, o.maxInput
+	*o = *next
+	return true, nil
+}
+
+// nextRecord returns the plaintext of the next chunk record, or io.EOF once
+// the trailer has been checked.
+func (o *chunkOpener) nextRecord() ([]byte, error) {
+	if o.done {
+		return nil, io.EOF
+	}
+
+	var chunkSizeBytes [4]byte
+	_, err := io.ReadFull(o.src, chunkSizeBytes[:])
+	if err == io.EOF {
+		return nil, o.finish(false)
+	}
+	if err != nil {
+		return nil, atChunk(int(o.counter), readError("read chunk size", err))
+	}
+
+	// Without a trailer a stream runs to the end of the input, so the next
+	// segment is recognised by its magic bytes, which are never a valid
+	// record length.
+	if o.multiSegment && !o.hasTrailer && string(chunkSizeBytes[:len(MagicBytes)]) == MagicBytes {
+		o.pending = bytes.Clone(chunkSizeBytes[:])
+		return nil, o.finish(false)
+	}
+
+	chunkSize := binary.BigEndian.Uint32(chunkSizeBytes[:])
+
+	if chunkSize == 0 && o.hasTrailer {
+		end := int64(TrailerSize + len(o.backup))
+		if o.index != nil {
+			end += o.header.IndexSize(uint64(o.counter))
+		}
+		if err := o.consume(end); err != nil {
+			return nil, err
+		}
+		if o.index != nil {
+			if err := o.readIndex(); err != nil {
+				return nil, err
+			}
+		}
+		if err := o.readTrailer(); err != nil {
+			return nil, err
+		}
+		o.st.ciphertext += TrailerSize
+		return nil, o.finish(true)
+	}
+
+	// #nosec G115 -- int to uint32 conversion safe (MaxChunkSize is 10MB)
+	if chunkSize < uint32(o.gcm.Overhead()) || chunkSize > uint32(MaxChunkSize+o.gcm.Overhead()) {
+		return nil, atChunk(int(o.counter), fmt.Errorf("%w: %w: %d bytes", ErrCorruptedFile, ErrChunkSize, chunkSize))
+	}
+	// The length prefix is not authenticated until the record is, so it is
+	// held to the configured limit and, when the size is known, to the
+	// plaintext still missing before anything is allocated for it.
+	n := int64(chunkSize) - int64(o.gcm.Overhead())
+	if o.maxChunk > 0 && n > int64(o.maxChunk) {
+		return nil, atChunk(int(o.counter), fmt.Errorf("%w: record of %d bytes exceeds the limit of %d", ErrChunkSize, n, o.maxChunk))
+	}
+	if o.totalSize > 0 && o.padding == nil && n > o.totalSize-o.opened {
+		return nil, atChunk(int(o.counter), fmt.Errorf("%w: %w: record of %d bytes exceeds the %d bytes remaining", ErrCorruptedFile, ErrChunkSize, n, o.totalSize-o.opened))
+	}
+
+	if o.maxChunks > 0 && o.st.chunks >= uint64(o.maxChunks) {
+		return nil, atChunk(int(o.counter), fmt.Errorf("%w: more than %d chunks", ErrLimitExceeded, o.maxChunks))
+	}
+	if err := o.consume(int64(len(chunkSizeBytes)) + int64(chunkSize)); err != nil {
+		return nil, atChunk(int(o.counter), err)
+	}
+
+	// Chunks are decrypted in place in a reused buffer; io.Writer
+	// implementations must not retain the slice passed to Write.
+	ciphertext, err := readRecord(o.src, o.buf, int(chunkSize))
+	o.buf = ciphertext
+	if err != nil {
+		return nil, atChunk(int(o.counter), readError("read encrypted chunk", err))
+	}
+
+	// The record is digested before it is decrypted in place.
+	var digest []byte
+	if o.digest != nil {
+		o.digest.Reset()
+		o.digest.Write(chunkSizeBytes[:])
+		o.digest.Write(ciphertext)
+		digest = o.digest.Sum(nil)
+	}
+
+	copy(o.nonce, o.baseNonce)
+	binary.BigEndian.PutUint32(o.nonce[8:], o.counter)
+	o.counter++
+
+	plaintext, err := o.gcm.Open(ciphertext[:0], o.nonce, ciphertext, o.aad)
+	if err != nil {
+		return nil, atChunk(int(o.counter-1), authError(fmt.Sprintf("decrypt chunk %d", o.counter-1), o.counter == 1))
+	}
+
+	if o.index != nil {
+		var entry [format.IndexEntrySize]byte
+		o.index.Write(format.AppendIndexEntry(entry[:0], format.IndexEntry{Offset: o.offset, Length: chunkSize}))
+		if o.digest != nil {
+			o.index.Write(digest)
+		}
+	}
+	o.offset += int64(len(chunkSizeBytes)) + int64(chunkSize)
+	o.opened += int64(len(plaintext))
+	o.st.ciphertext += int64(len(chunkSizeBytes)) + int64(chunkSize)
+	o.st.chunks++
+	return plaintext, nil
+}
+
+// consume fails with ErrLimitExceeded if reading n more bytes would take the
+// input past maxInput.
+func (o *chunkOpener) consume(n int64) error {
+	if o.maxInput > 0 && o.st.ciphertext+n > o.maxInput {
+		return fmt.Errorf("%w: input exceeds %d bytes", ErrLimitExceeded, o.maxInput)
+	}
+	return nil
+}
+
+// recordGrowth is the step by which readRecord grows buffers for records
+// larger than any read before.
+const recordGrowth = 64 * 1024
+
+// readRecord reads an n-byte record from r into buf, which it returns with
+// length n. A larger buffer is grown only as data arrives, so a forged length
+// prefix on a short stream cannot make it allocate the whole record.
+func readRecord(r io.Reader, buf []byte, n int) ([]byte, error) {
+	if cap(buf) >= n {
+		buf = buf[:n]
+		_, err := io.ReadFull(r, buf)
+		return buf, err
+	}
+	buf = buf[:0]
+	for len(buf) < n {
+		step := min(n-len(buf), max(len(buf), recordGrowth))
+		buf = slices.Grow(buf, step)
+		m, err := io.ReadFull(r, buf[len(buf):len(buf)+step])
+		buf = buf[:len(buf)+m]
+		if err == io.EOF && len(buf) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return buf, err
+		}
+	}
+	return buf, nil
+}
+
+// finish performs the end-of-stream checks and returns io.EOF if they pass.
+func (o *chunkOpener) finish(trailerSeen bool) error {
+	if o.hasTrailer && !trailerSeen {
+		return fmt.Errorf("%w: unexpected EOF: missing trailer after %d decrypted bytes", ErrCorruptedFile, o.opened)
+	}
+	size := o.opened
+	if o.padding != nil {
+		size = o.padding.size
+	}
+	if o.totalSize > 0 && size != o.totalSize {
+		return fmt.Errorf("%w: unexpected EOF: decrypted %d bytes, expected %d", ErrCorruptedFile, size, o.totalSize)
+	}
+	o.done = true
+	return io.EOF
+}
+
+// readIndex reads and authenticates the chunk index that follows the end
+// marker and checks it against the records actually read.
+func (o *chunkOpener) readIndex() error {
+	sealed := make([]byte, o.header.IndexSize(uint64(o.counter)))
+	if _, err := io.ReadFull(o.src, sealed); err != nil {
+		return readError("read chunk index", err)
+	}
+	index, err := o.gcm.Open(sealed[:0], metadataNonce(o.baseNonce, format.RecordIndex), sealed, o.aad)
+	if err != nil {
+		return authError("decrypt chunk index", o.counter == 0)
+	}
+	if sum := sha256.Sum256(index); !bytes.Equal(sum[:], o.index.Sum(nil)) {
+		return fmt.Errorf("%w: chunk index does not match the chunk records", ErrCorruptedFile)
+	}
+	o.st.ciphertext += int64(len(sealed))
+	return nil
+}
+
+// readTrailer reads and authenticates the v2 trailer that follows the end marker
+// and checks it against what was actually decrypted. The trailer must be the
+// last record in the stream, followed only by the backup header if the stream
+// has one, unless further segments may follow.
+func (o *chunkOpener) readTrailer() error {
+	sealed := make([]byte, TrailerSize-4)
+	if _, err := io.ReadFull(o.src, sealed); err != nil {
+		return readError("read trailer", err)
+	}
+	size, count, err := openTrailer(o.gcm, o.baseNonce, o.aad, sealed)
+	if err != nil {
+		return authError("decrypt trailer", o.counter == 0)
+	}
+	if o.padding != nil {
+		if count != uint64(o.counter) || !o.padding.end(size, o.opened) {
+			return fmt.Errorf("%w: decrypted %d padded bytes in %d chunks, trailer records %d bytes in %d chunks", ErrCorruptedFile, o.opened, o.counter, size, count)
+		}
+	} else if size != o.opened || count != uint64(o.counter) {
+		return fmt.Errorf("%w: unexpected EOF: decrypted %d bytes in %d chunks, trailer records %d bytes in %d chunks", ErrCorruptedFile, o.opened, o.counter, size, count)
+	}
+	if o.backup != nil {
+		backup := make([]byte, len(o.backup))
+		if _, err := io.ReadFull(o.src, backup); err != nil {
+			return readError("read backup header", err)
+		}
+		if !bytes.Equal(backup, o.backup) {
+			return fmt.Errorf("%w: backup header does not match the header", ErrCorruptedFile)
+		}
+		o.st.ciphertext += int64(len(backup))
+	}
+	if o.multiSegment {
+		return nil
+	}
+	var extra [1]byte
+	if _, err := io.ReadFull(o.src, extra[:]); err == nil {
+		return fmt.Errorf("%w: invalid file format: unexpected data after trailer", ErrCorruptedFile)
+	}
+	return nil
+}
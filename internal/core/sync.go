@@ -0,0 +1,226 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// sync.go: Incremental encrypted mirroring of directory trees
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SyncResult lists what SyncDir did, by slash-separated plaintext path.
+type SyncResult struct {
+	// Added and Updated are the files encrypted because they were new or
+	// their size or modification time changed.
+	Added   []string
+	Updated []string
+	// Unchanged counts the files left as they were.
+	Unchanged int
+	// Removed are the files no longer in the source whose encrypted files
+	// were deleted, or tombstoned with WithTombstones.
+	Removed []string
+}
+
+// WithTombstones makes SyncDir keep the encrypted files of sources that
+// were removed, marking their manifest entries with DeletedAt instead of
+// deleting them, so that an accidental deletion can still be restored from
+// the mirror. DecryptDir skips tombstoned files when given the manifest.
+func WithTombstones(enable bool) Option {
+	return func(cfg *Config) {
+		cfg.Tombstones = enable
+	}
+}
+
+// SyncDir mirrors srcDir into dstDir as EncryptDir does, but incrementally:
+// the manifest written by the previous EncryptDir or SyncDir, which
+// WithManifest must name, is compared with the source so that only new
+// files and files whose size or modification time changed are encrypted.
+// The encrypted files of sources that were removed, or are now excluded by
+// filters, are deleted, or kept as tombstones with WithTombstones. The
+// manifest is rewritten to describe the mirror once it is up to date. With
+// WithDryRun, the plan lists the files that would be encrypted and nothing
+// is written or deleted.
+func (e *Encryptor) SyncDir(ctx context.Context, srcDir, dstDir string) (*SyncResult, error) {
+	ctx, release := e.deadlines(ctx)
+	defer release()
+	start := time.Now()
+	total := newStreamStats(nil)
+	res, err := e.syncDir(ctx, srcDir, dstDir, &total)
+	total.complete = err == nil
+	e.fillReport(ctx, srcDir, total, start, err)
+	return res, withDetail(e.errDetail, "encrypt", srcDir, err)
+}
+
+func (e *Encryptor) syncDir(ctx context.Context, srcDir, dstDir string, total *streamStats) (*SyncResult, error) {
+	if e.manifest == "" {
+		return nil, fmt.Errorf("SyncDir requires WithManifest")
+	}
+	prev, err := e.readManifest()
+	if err != nil {
+		return nil, err
+	}
+	if prev.suffix() != e.naming.suffix {
+		return nil, fmt.Errorf("manifest suffix %q differs from %q", prev.suffix(), e.naming.suffix)
+	}
+	dstName := func(rel string) string { return rel }
+	if e.obfuscateNames {
+		names, err := e.newNameObfuscator()
+		if err != nil {
+			return nil, err
+		}
+		defer names.destroy()
+		dstName = names.name
+	}
+
+	outputs := e.naming.newOutputNames()
+	output := func(name string) string { return filepath.Join(dstDir, dstName(name)) + e.naming.suffix }
+	previous := make(map[string]ManifestEntry, len(prev.Files))
+	for _, entry := range prev.Files {
+		name := filepath.FromSlash(entry.encryptedFile(e.naming.suffix))
+		if !filepath.IsLocal(name) {
+			return nil, fmt.Errorf("%w: manifest path escapes directory", ErrCorruptedFile)
+		}
+		previous[entry.Path] = entry
+		outputs.reserve(filepath.Join(dstDir, name))
+	}
+
+	res := &SyncResult{}
+	var entries []ManifestEntry
+	seen := make(map[string]bool)
+	w, err := newTreeWalker(ctx, srcDir, dstDir, e.filter, e.symlinks, func(path, rel string, d fs.DirEntry) error {
+		slash := filepath.ToSlash(rel)
+		if ok, err := e.filter.allowsEntry(slash, d); err != nil || !ok {
+			return err
+		}
+		seen[slash] = true
+		old, known := previous[slash]
+		var dst, name string
+		if known {
+			dst = filepath.Join(dstDir, filepath.FromSlash(old.encryptedFile(e.naming.suffix)))
+			if old.DeletedAt.IsZero() && unchanged(path, dst, old) {
+				res.Unchanged++
+				entries = append(entries, old)
+				return nil
+			}
+			name = old.EncryptedPath
+		} else {
+			var err error
+			if dst, name, err = outputs.assign(rel, output); err != nil {
+				return fmt.Errorf("%s: %w", slash, err)
+			}
+			if e.obfuscateNames || name != rel {
+				name = filepath.ToSlash(dstName(name))
+			} else {
+				name = ""
+			}
+		}
+		if e.plan != nil {
+			return e.planFile(path, dst)
+		}
+		entry, err := e.encryptDirFile(ctx, path, dst, total)
+		if err != nil {
+			return fmt.Errorf("%s: %w", slash, err)
+		}
+		entry.Path = slash
+		entry.EncryptedPath = name
+		entries = append(entries, entry)
+		if known && old.DeletedAt.IsZero() {
+			res.Updated = append(res.Updated, slash)
+		} else {
+			res.Added = append(res.Added, slash)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	w.dstName = dstName
+	w.dryRun = e.plan != nil
+	if err := w.run(srcDir); err != nil {
+		return nil, err
+	}
+	if e.plan != nil {
+		return res, nil
+	}
+
+	now := time.Now()
+	for _, entry := range prev.Files {
+		if seen[entry.Path] {
+			continue
+		}
+		if e.tombstones {
+			if entry.DeletedAt.IsZero() {
+				entry.DeletedAt = now
+				res.Removed = append(res.Removed, entry.Path)
+			}
+			entries = append(entries, entry)
+			continue
+		}
+		dst := filepath.Join(dstDir, filepath.FromSlash(entry.encryptedFile(e.naming.suffix)))
+		if err := os.Remove(dst); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%s: %w", entry.Path, WrapError("remove encrypted file", err))
+		}
+		removeEmptyParents(dstDir, dst)
+		if entry.DeletedAt.IsZero() {
+			res.Removed = append(res.Removed, entry.Path)
+		}
+	}
+
+	m := &Manifest{Version: ManifestVersion, Files: entries}
+	if e.naming.suffix != EncryptedFileSuffix {
+		m.Suffix = e.naming.suffix
+	}
+	return res, e.writeManifest(m)
+}
+
+// unchanged reports whether the source file at path still has the size and
+// modification time recorded in entry and its encrypted file dst exists.
+func unchanged(path, dst string, entry ManifestEntry) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() != entry.Size || !info.ModTime().Equal(entry.ModTime) {
+		return false
+	}
+	_, err = os.Lstat(dst)
+	return err == nil
+}
+
+// removeEmptyParents removes the directories between path and root that
+// are left empty.
+func removeEmptyParents(root, path string) {
+	root = filepath.Clean(root)
+	for dir := filepath.Dir(path); dir != root && dir != "." && len(dir) > len(root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+// readManifest reads the manifest the Encryptor writes, verifying it with
+// the Encryptor's key. A missing manifest reads as an empty one.
+func (e *Encryptor) readManifest() (*Manifest, error) {
+	e.mu.RLock()
+	if e.destroyed {
+		e.mu.RUnlock()
+		return nil, e.errDestroyed()
+	}
+	dec, err := NewDecryptorFromSecureBuffer(e.keyBuf)
+	e.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	defer dec.Destroy()
+	m, err := dec.ReadManifest(e.manifest)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Manifest{Version: ManifestVersion}, nil
+	}
+	return m, err
+}
@@ -0,0 +1,171 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSyncDir(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	encDir := filepath.Join(tmpDir, "enc")
+	manifestPath := filepath.Join(tmpDir, "manifest.json")
+	writeTree(t, srcDir, map[string][]byte{
+		"keep.txt":     []byte("keep"),
+		"change.txt":   []byte("before"),
+		"gone/old.txt": []byte("old"),
+	})
+	ctx := context.Background()
+
+	enc, err := NewEncryptor(key, WithManifest(manifestPath))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	res, err := enc.SyncDir(ctx, srcDir, encDir)
+	if err != nil {
+		t.Fatalf("first SyncDir failed: %v", err)
+	}
+	if len(res.Added) != 3 || res.Unchanged != 0 {
+		t.Fatalf("first SyncDir = %+v, want 3 added", res)
+	}
+	keepInfo, err := os.Stat(filepath.Join(encDir, "keep.txt.enc"))
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+
+	// Change one file, add one and remove a directory.
+	writeTree(t, srcDir, map[string][]byte{"change.txt": []byte("after!!"), "new.txt": []byte("new")})
+	if err := os.Chtimes(filepath.Join(srcDir, "change.txt"), time.Now(), time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+	if err := os.RemoveAll(filepath.Join(srcDir, "gone")); err != nil {
+		t.Fatalf("RemoveAll failed: %v", err)
+	}
+	res, err = enc.SyncDir(ctx, srcDir, encDir)
+	if err != nil {
+		t.Fatalf("second SyncDir failed: %v", err)
+	}
+	if !slices.Equal(res.Added, []string{"new.txt"}) || !slices.Equal(res.Updated, []string{"change.txt"}) ||
+		!slices.Equal(res.Removed, []string{"gone/old.txt"}) || res.Unchanged != 1 {
+		t.Errorf("second SyncDir = %+v", res)
+	}
+	if info, err := os.Stat(filepath.Join(encDir, "keep.txt.enc")); err != nil || !info.ModTime().Equal(keepInfo.ModTime()) {
+		t.Errorf("unchanged file was rewritten: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(encDir, "gone")); !os.IsNotExist(err) {
+		t.Errorf("emptied directory was kept: %v", err)
+	}
+
+	dec, err := NewDecryptor(key, WithManifest(manifestPath))
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	if err := dec.VerifyManifest(ctx, manifestPath, encDir); err != nil {
+		t.Fatalf("VerifyManifest failed: %v", err)
+	}
+	decDir := filepath.Join(tmpDir, "dec")
+	if err := dec.DecryptDir(ctx, encDir, decDir); err != nil {
+		t.Fatalf("DecryptDir failed: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(decDir, "change.txt")); err != nil || !bytes.Equal(got, []byte("after!!")) {
+		t.Errorf("change.txt = %q, %v", got, err)
+	}
+
+	// A third run has nothing to do.
+	res, err = enc.SyncDir(ctx, srcDir, encDir)
+	if err != nil || len(res.Added)+len(res.Updated)+len(res.Removed) != 0 || res.Unchanged != 3 {
+		t.Errorf("third SyncDir = %+v, %v", res, err)
+	}
+
+	plain, err := NewEncryptor(key)
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer plain.Destroy()
+	if _, err := plain.SyncDir(ctx, srcDir, encDir); err == nil {
+		t.Error("SyncDir without a manifest succeeded")
+	}
+}
+
+func TestSyncDir_Tombstones(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	encDir := filepath.Join(tmpDir, "enc")
+	manifestPath := filepath.Join(tmpDir, "manifest.json")
+	writeTree(t, srcDir, map[string][]byte{"a.txt": []byte("alpha"), "b.txt": []byte("beta")})
+	ctx := context.Background()
+
+	enc, err := NewEncryptor(key, WithManifest(manifestPath), WithObfuscatedNames(true), WithTombstones(true))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	if _, err := enc.SyncDir(ctx, srcDir, encDir); err != nil {
+		t.Fatalf("first SyncDir failed: %v", err)
+	}
+	if err := os.Remove(filepath.Join(srcDir, "b.txt")); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	res, err := enc.SyncDir(ctx, srcDir, encDir)
+	if err != nil || !slices.Equal(res.Removed, []string{"b.txt"}) {
+		t.Fatalf("second SyncDir = %+v, %v", res, err)
+	}
+	name, err := enc.EncryptedName("b.txt")
+	if err != nil {
+		t.Fatalf("EncryptedName failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(encDir, name)); err != nil {
+		t.Errorf("tombstoned file was deleted: %v", err)
+	}
+
+	dec, err := NewDecryptor(key, WithManifest(manifestPath))
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+	m, err := dec.ReadManifest(manifestPath)
+	if err != nil {
+		t.Fatalf("ReadManifest failed: %v", err)
+	}
+	for _, entry := range m.Files {
+		if tombstone := !entry.DeletedAt.IsZero(); tombstone != (entry.Path == "b.txt") {
+			t.Errorf("entry %s: DeletedAt = %v", entry.Path, entry.DeletedAt)
+		}
+	}
+	decDir := filepath.Join(tmpDir, "dec")
+	if err := dec.DecryptDir(ctx, encDir, decDir); err != nil {
+		t.Fatalf("DecryptDir failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(decDir, "b.txt")); !os.IsNotExist(err) {
+		t.Errorf("tombstoned file was restored: %v", err)
+	}
+
+	// A file that comes back replaces its tombstone.
+	writeTree(t, srcDir, map[string][]byte{"b.txt": []byte("beta again")})
+	res, err = enc.SyncDir(ctx, srcDir, encDir)
+	if err != nil || !slices.Equal(res.Added, []string{"b.txt"}) {
+		t.Errorf("third SyncDir = %+v, %v", res, err)
+	}
+}
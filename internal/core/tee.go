@@ -0,0 +1,106 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// tee.go: Writing one ciphertext to several destinations
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// DestinationError reports the failure of one writer passed to
+// EncryptStreamTo.
+type DestinationError struct {
+	// Index is the position of the writer in the destinations.
+	Index int
+	Err   error
+}
+
+func (e *DestinationError) Error() string {
+	return fmt.Sprintf("destination %d: %v", e.Index, e.Err)
+}
+
+func (e *DestinationError) Unwrap() error {
+	return e.Err
+}
+
+// EncryptStreamTo encrypts src once and writes the ciphertext to every writer
+// in dsts, such as a local file, an upload and a checksum sink, so that
+// fanning a backup out does not require encrypting it again.
+//
+// A destination whose Write fails is dropped and the others continue to
+// receive the complete ciphertext. Its failure is returned once encryption
+// has finished, as a *DestinationError carrying its index; failures of
+// several destinations are joined. Encryption stops early only when every
+// destination has failed. Whatever a failed destination received is
+// incomplete and must be discarded.
+func (e *Encryptor) EncryptStreamTo(ctx context.Context, src io.Reader, dsts []io.Writer, sizeHint ...int64) error {
+	if len(dsts) == 0 {
+		return errors.New("no destinations")
+	}
+	var totalSize int64
+	if len(sizeHint) > 0 {
+		totalSize = sizeHint[0]
+	}
+	ctx, release := e.deadlines(ctx)
+	defer release()
+	start := time.Now()
+	st := newStreamStats(e.plainHash)
+	tee := newTeeWriter(dsts)
+	dst, rb := e.readBack.wrap(tee, e.chunkSize)
+	err := runAtPriority(e.priority, func() error {
+		return e.encryptStream(ctx, newCtxReader(ctx, src), newCtxWriter(ctx, dst), totalSize, nil, &st)
+	})
+	if err == nil {
+		err = tee.err()
+	}
+	if err == nil && rb != nil {
+		err = rb.verify(ctx)
+	}
+	e.fillReport(ctx, "", st, start, err)
+	return withDetail(e.errDetail, "encrypt", "stream", err)
+}
+
+// teeWriter writes to several writers, dropping each one at its first
+// failure. Write fails only once every writer has failed.
+type teeWriter struct {
+	dsts []io.Writer
+	errs []error
+	live int
+}
+
+func newTeeWriter(dsts []io.Writer) *teeWriter {
+	return &teeWriter{dsts: dsts, errs: make([]error, len(dsts)), live: len(dsts)}
+}
+
+func (t *teeWriter) Write(p []byte) (int, error) {
+	for i, w := range t.dsts {
+		if t.errs[i] != nil {
+			continue
+		}
+		n, err := w.Write(p)
+		if err == nil && n != len(p) {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			t.errs[i] = &DestinationError{Index: i, Err: err}
+			t.live--
+		}
+	}
+	if t.live == 0 {
+		return 0, t.err()
+	}
+	return len(p), nil
+}
+
+// err returns the failures of the writers so far, or nil.
+func (t *teeWriter) err() error {
+	return errors.Join(t.errs...)
+}
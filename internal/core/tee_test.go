@@ -0,0 +1,106 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"testing"
+)
+
+// failingWriter accepts n bytes and then fails every write.
+type failingWriter struct {
+	n   int
+	err error
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		written := w.n
+		w.n = 0
+		return written, w.err
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestEncryptStreamTo(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	chunkOpt, err := WithChunkSize(1024)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	enc, err := NewEncryptor(key, chunkOpt)
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+
+	data := make([]byte, 10000)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("failed to generate data: %v", err)
+	}
+
+	var file, upload bytes.Buffer
+	sum := sha256.New()
+	if err := enc.EncryptStreamTo(context.Background(), bytes.NewReader(data), []io.Writer{&file, &upload, sum}, int64(len(data))); err != nil {
+		t.Fatalf("EncryptStreamTo failed: %v", err)
+	}
+	if !bytes.Equal(file.Bytes(), upload.Bytes()) {
+		t.Fatal("destinations received different ciphertexts")
+	}
+	if want := sha256.Sum256(file.Bytes()); !bytes.Equal(sum.Sum(nil), want[:]) {
+		t.Error("checksum sink does not match the ciphertext")
+	}
+	var out bytes.Buffer
+	if err := dec.DecryptStream(context.Background(), &file, &out); err != nil || !bytes.Equal(out.Bytes(), data) {
+		t.Fatalf("decrypting the copy failed: %v", err)
+	}
+
+	// A failing destination is reported by index; the others complete.
+	errUpload := errors.New("upload failed")
+	file.Reset()
+	var backup bytes.Buffer
+	err = enc.EncryptStreamTo(context.Background(), bytes.NewReader(data), []io.Writer{&file, &failingWriter{n: 3000, err: errUpload}, &backup})
+	var destErr *DestinationError
+	if !errors.As(err, &destErr) || destErr.Index != 1 || !errors.Is(err, errUpload) {
+		t.Fatalf("EncryptStreamTo with a failing destination = %v, want destination 1 to fail", err)
+	}
+	for i, dst := range []*bytes.Buffer{&file, &backup} {
+		out.Reset()
+		if err := dec.DecryptStream(context.Background(), dst, &out); err != nil || !bytes.Equal(out.Bytes(), data) {
+			t.Errorf("destination %d: decrypting failed: %v", []int{0, 2}[i], err)
+		}
+	}
+
+	// Encryption stops once every destination has failed.
+	errDisk := errors.New("disk full")
+	src := bytes.NewReader(data)
+	err = enc.EncryptStreamTo(context.Background(), src, []io.Writer{&failingWriter{n: 100, err: errDisk}, &failingWriter{n: 2000, err: errUpload}})
+	if !errors.Is(err, errDisk) || !errors.Is(err, errUpload) {
+		t.Errorf("EncryptStreamTo with only failing destinations = %v, want both failures", err)
+	}
+	if src.Len() == 0 {
+		t.Error("encryption continued after every destination failed")
+	}
+
+	if err := enc.EncryptStreamTo(context.Background(), bytes.NewReader(data), nil); err == nil {
+		t.Error("EncryptStreamTo without destinations succeeded")
+	}
+}
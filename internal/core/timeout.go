@@ -0,0 +1,70 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// timeout.go: Operation timeouts and per-chunk deadlines
+package core
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// chunkWatchKey carries the chunkWatch of an operation in its context.
+type chunkWatchKey struct{}
+
+// chunkWatch cancels an operation when no chunk completes within d.
+type chunkWatch struct {
+	timer *time.Timer
+	d     time.Duration
+}
+
+// withDeadlines returns ctx limited by timeout and chunkDeadline (zero
+// disables either) and a function releasing them, which must be called when
+// the operation returns. Expiry cancels the context with an ErrTimeout cause,
+// which contextError returns.
+func withDeadlines(ctx context.Context, timeout, chunkDeadline time.Duration) (context.Context, func()) {
+	release := func() {}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, timeout, fmt.Errorf("%w after %v: %w", ErrTimeout, timeout, context.DeadlineExceeded))
+		release = cancel
+	}
+	if chunkDeadline > 0 {
+		var cancel context.CancelCauseFunc
+		ctx, cancel = context.WithCancelCause(ctx)
+		w := &chunkWatch{d: chunkDeadline}
+		w.timer = time.AfterFunc(chunkDeadline, func() {
+			cancel(fmt.Errorf("%w: no chunk completed within %v: %w", ErrTimeout, chunkDeadline, context.DeadlineExceeded))
+		})
+		ctx = context.WithValue(ctx, chunkWatchKey{}, w)
+		outer := release
+		release = func() {
+			w.timer.Stop()
+			cancel(nil)
+			outer()
+		}
+	}
+	return ctx, release
+}
+
+// chunkDone restarts the chunk deadline of ctx, if any, after a chunk has
+// been processed.
+func chunkDone(ctx context.Context) {
+	if w, ok := ctx.Value(chunkWatchKey{}).(*chunkWatch); ok {
+		w.timer.Reset(w.d)
+	}
+}
+
+// deadlines applies the encryptor's timeout and chunk deadline to ctx.
+func (e *Encryptor) deadlines(ctx context.Context) (context.Context, func()) {
+	return withDeadlines(ctx, e.timeout, e.chunkDeadline)
+}
+
+// deadlines applies the decryptor's timeout and chunk deadline to ctx.
+func (d *Decryptor) deadlines(ctx context.Context) (context.Context, func()) {
+	return withDeadlines(ctx, d.timeout, d.chunkDeadline)
+}
@@ -0,0 +1,100 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// stallingReader serves data quickly until stall, then blocks each read for
+// delay, like a hung network mount.
+type stallingReader struct {
+	r     io.Reader
+	stall int
+	delay time.Duration
+	read  int
+}
+
+func (r *stallingReader) Read(p []byte) (int, error) {
+	if r.read >= r.stall {
+		time.Sleep(r.delay)
+	}
+	n, err := r.r.Read(p)
+	r.read += n
+	return n, err
+}
+
+func TestWithTimeoutAndChunkDeadline(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	chunkOpt, err := WithChunkSize(1024)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	data := make([]byte, 64*1024)
+
+	tests := []struct {
+		name string
+		opt  Option
+	}{
+		{"timeout", WithTimeout(50 * time.Millisecond)},
+		{"chunk deadline", WithChunkDeadline(50 * time.Millisecond)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, err := NewEncryptor(key, chunkOpt, tt.opt)
+			if err != nil {
+				t.Fatalf("NewEncryptor failed: %v", err)
+			}
+			defer enc.Destroy()
+
+			// Generous limits let a healthy stream through.
+			if err := enc.EncryptStream(context.Background(), bytes.NewReader(data), io.Discard); err != nil {
+				t.Fatalf("EncryptStream failed: %v", err)
+			}
+
+			src := &stallingReader{r: bytes.NewReader(data), stall: 8 * 1024, delay: 100 * time.Millisecond}
+			err = enc.EncryptStream(context.Background(), src, io.Discard)
+			if !errors.Is(err, ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("expected ErrTimeout, got %v", err)
+			}
+			if errors.Is(err, ErrContextCanceled) {
+				t.Errorf("timeout reported as a cancellation: %v", err)
+			}
+			if !errors.Is(SanitizeError(err), ErrTimeout) {
+				t.Errorf("sanitized error lost its category: %v", SanitizeError(err))
+			}
+		})
+	}
+
+	// The chunk deadline restarts with every chunk, so a long operation of
+	// steady chunks is not cut short.
+	enc, err := NewEncryptor(key, chunkOpt, WithChunkDeadline(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	src := &stallingReader{r: bytes.NewReader(make([]byte, 8*1024)), delay: 10 * time.Millisecond}
+	if err := enc.EncryptStream(context.Background(), src, io.Discard); err != nil {
+		t.Errorf("steady stream failed: %v", err)
+	}
+
+	// A caller's cancellation is still reported as such.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := enc.EncryptStream(ctx, bytes.NewReader(data), io.Discard); !errors.Is(err, ErrContextCanceled) || errors.Is(err, ErrTimeout) {
+		t.Errorf("expected ErrContextCanceled, got %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// trailer.go: Authenticated end-of-stream trailer for format v2
+package core
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// recordTrailer identifies the end-of-stream trailer in the metadata nonce space.
+const recordTrailer uint32 = 1
+
+// metadataNonce derives the nonce for a metadata record (trailer, etc.) from the
+// base nonce. The most significant bit of the first byte is inverted so metadata
+// nonces can never collide with chunk nonces of the same file, which always share
+// the first 8 bytes of the base nonce.
+func metadataNonce(baseNonce []byte, record uint32) []byte {
+	nonce := make([]byte, NonceSize)
+	copy(nonce, baseNonce)
+	nonce[0] ^= 0x80
+	binary.BigEndian.PutUint32(nonce[8:], record)
+	return nonce
+}
+
+// sealTrailer appends the sealed trailer recording the true plaintext size and
+// chunk count of the stream to dst, which must already hold the end marker.
+func sealTrailer(dst []byte, aead cipher.AEAD, baseNonce, aad []byte, totalSize int64, chunks uint64) []byte {
+	payload := make([]byte, TrailerPayloadSize)
+	binary.BigEndian.PutUint64(payload[0:8], uint64(totalSize)) // #nosec G115 -- written byte counts are never negative
+	binary.BigEndian.PutUint64(payload[8:16], chunks)
+
+	return aead.Seal(dst, metadataNonce(baseNonce, recordTrailer), payload, aad)
+}
+
+// openTrailer authenticates a sealed trailer (without the 4-byte end marker)
+// and returns the recorded plaintext size and chunk count.
+func openTrailer(aead cipher.AEAD, baseNonce, aad, sealed []byte) (int64, uint64, error) {
+	payload, err := aead.Open(nil, metadataNonce(baseNonce, recordTrailer), sealed, aad)
+	if err != nil {
+		return 0, 0, err
+	}
+	size := binary.BigEndian.Uint64(payload[0:8])
+	if size > math.MaxInt64 {
+		return 0, 0, fmt.Errorf("%w: invalid trailer: size %d out of range", ErrCorruptedFile, size)
+	}
+	return int64(size), binary.BigEndian.Uint64(payload[8:16]), nil
+}
@@ -0,0 +1,156 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// encryptUnsized encrypts data as a stream without a size hint, mimicking a
+// pipe source whose header records size 0.
+func encryptUnsized(t *testing.T, key, data []byte, chunkSize int) []byte {
+	t.Helper()
+	opt, err := WithChunkSize(chunkSize)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	enc, err := NewEncryptor(key, opt)
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+
+	var buf bytes.Buffer
+	if err := enc.EncryptStream(context.Background(), bytes.NewReader(data), &buf); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestTrailer_UnsizedStreamTruncationDetected(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	data := []byte("piped input gets the same integrity guarantees as regular files")
+	ciphertext := encryptUnsized(t, key, data, 16)
+
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+
+	var out bytes.Buffer
+	if err := dec.DecryptStream(context.Background(), bytes.NewReader(ciphertext), &out); err != nil {
+		t.Fatalf("DecryptStream failed: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Fatal("decrypted data does not match")
+	}
+
+	// Cut exactly before the trailer: every chunk is intact but the end of the
+	// stream is no longer authenticated.
+	withoutTrailer := ciphertext[:len(ciphertext)-TrailerSize]
+	out.Reset()
+	if err := dec.DecryptStream(context.Background(), bytes.NewReader(withoutTrailer), &out); err == nil {
+		t.Fatal("expected error for stream without trailer")
+	}
+
+	// Cut at a chunk boundary: header plus the first full chunk only.
+	firstChunk := HeaderSize + 4 + 16 + TagSize
+	out.Reset()
+	if err := dec.DecryptStream(context.Background(), bytes.NewReader(ciphertext[:firstChunk]), &out); err == nil {
+		t.Fatal("expected error for stream truncated at chunk boundary")
+	}
+}
+
+func TestTrailer_TamperingDetected(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	ciphertext := encryptUnsized(t, key, []byte("trailer tampering"), 1024)
+
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+
+	tampered := append([]byte(nil), ciphertext...)
+	tampered[len(tampered)-1] ^= 0x01
+	if err := dec.DecryptStream(context.Background(), bytes.NewReader(tampered), &bytes.Buffer{}); err == nil {
+		t.Fatal("expected authentication failure for tampered trailer")
+	}
+
+	appended := append(append([]byte(nil), ciphertext...), 0x00)
+	if err := dec.DecryptStream(context.Background(), bytes.NewReader(appended), &bytes.Buffer{}); err == nil {
+		t.Fatal("expected error for data appended after trailer")
+	}
+}
+
+func TestTrailer_VersionOneStillDecrypts(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	data := []byte("legacy v1 file without trailer")
+	v1 := encryptV1(t, key, data, 8)
+
+	dec, err := NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	var out bytes.Buffer
+	if err := dec.DecryptStream(context.Background(), bytes.NewReader(v1), &out); err != nil {
+		t.Fatalf("DecryptStream of v1 file failed: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Fatal("decrypted v1 data does not match")
+	}
+}
+
+func TestTrailer_DecryptFileProgressForUnsizedSource(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	data := make([]byte, 64*1024)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("failed to generate data: %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	encPath := filepath.Join(tmpDir, "unsized.enc")
+	decPath := filepath.Join(tmpDir, "unsized.dec")
+	if err := os.WriteFile(encPath, encryptUnsized(t, key, data, 4096), 0600); err != nil {
+		t.Fatalf("failed to write encrypted file: %v", err)
+	}
+
+	var calls []float64
+	dec, err := NewDecryptor(key, WithProgress(func(p float64) { calls = append(calls, p) }))
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+
+	if err := dec.DecryptFile(context.Background(), encPath, decPath); err != nil {
+		t.Fatalf("DecryptFile failed: %v", err)
+	}
+	if len(calls) < 2 {
+		t.Fatalf("expected intermediate progress updates, got %v", calls)
+	}
+	if calls[0] <= 0 || calls[0] >= 1 {
+		t.Errorf("expected first progress value in (0, 1), got %v", calls[0])
+	}
+}
@@ -0,0 +1,109 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// tune.go: Benchmark-driven chunk size selection
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"github.com/gitrgoliveira/go-fileencrypt/secure"
+)
+
+// tuneCandidates are the chunk sizes TuneChunkSize compares.
+var tuneCandidates = []int{64 * 1024, 256 * 1024, 1024 * 1024, 4 * 1024 * 1024}
+
+// tuneRounds is how many times each candidate is measured; the fastest round
+// counts, which filters out scheduler and GC noise.
+const tuneRounds = 3
+
+// TuneChunkSize runs a short in-memory micro-benchmark, encrypting and
+// decrypting sampleSize bytes with each candidate chunk size (64KB to 4MB),
+// and returns the size with the best throughput on this machine. Candidates
+// larger than the sample or above a WithMaxChunkSizeLimit in opts are
+// skipped; if none remain, DefaultChunkSize is returned. A sample of 8-16MB
+// is usually enough and takes well under a second on modern hardware.
+//
+// The result can be passed to WithChunkSize. It only reflects CPU and memory
+// throughput, not the storage the real files live on.
+func TuneChunkSize(ctx context.Context, sampleSize int, opts ...Option) (int, error) {
+	if sampleSize <= 0 {
+		return 0, fmt.Errorf("invalid sample size %d", sampleSize)
+	}
+	cfg := &Config{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	var candidates []int
+	for _, size := range tuneCandidates {
+		if size <= cfg.maxChunkSize() && size <= sampleSize {
+			candidates = append(candidates, size)
+		}
+	}
+	if len(candidates) == 0 {
+		return DefaultChunkSize, nil
+	}
+
+	key := make([]byte, 32)
+	defer secure.Zero(key)
+	if _, err := rand.Read(key); err != nil {
+		return 0, fmt.Errorf("failed to generate key: %w", err)
+	}
+	sample := make([]byte, sampleSize)
+	var ciphertext, plaintext bytes.Buffer
+
+	best := make([]time.Duration, len(candidates))
+	for round := 0; round < tuneRounds; round++ {
+		// Interleave the candidates so a slow moment affects them all alike.
+		for i, size := range candidates {
+			elapsed, err := tuneRound(ctx, key, size, sample, &ciphertext, &plaintext)
+			if err != nil {
+				return 0, err
+			}
+			if round == 0 || elapsed < best[i] {
+				best[i] = elapsed
+			}
+		}
+	}
+
+	fastest := 0
+	for i := range best {
+		if best[i] < best[fastest] {
+			fastest = i
+		}
+	}
+	return candidates[fastest], nil
+}
+
+// tuneRound times one encryption and decryption of sample with chunkSize.
+func tuneRound(ctx context.Context, key []byte, chunkSize int, sample []byte, ciphertext, plaintext *bytes.Buffer) (time.Duration, error) {
+	opts := []Option{func(cfg *Config) { cfg.ChunkSize = chunkSize }}
+	enc, err := NewEncryptor(key, opts...)
+	if err != nil {
+		return 0, err
+	}
+	defer enc.Destroy()
+	dec, err := NewDecryptor(key, opts...)
+	if err != nil {
+		return 0, err
+	}
+	defer dec.Destroy()
+
+	ciphertext.Reset()
+	plaintext.Reset()
+	start := time.Now()
+	if err := enc.EncryptStream(ctx, bytes.NewReader(sample), ciphertext, int64(len(sample))); err != nil {
+		return 0, err
+	}
+	if err := dec.DecryptStream(ctx, bytes.NewReader(ciphertext.Bytes()), plaintext); err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
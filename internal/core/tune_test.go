@@ -0,0 +1,43 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestTuneChunkSize(t *testing.T) {
+	size, err := TuneChunkSize(context.Background(), 1024*1024)
+	if err != nil {
+		t.Fatalf("TuneChunkSize failed: %v", err)
+	}
+	if !slices.Contains(tuneCandidates, size) || size > 1024*1024 {
+		t.Errorf("unexpected chunk size %d", size)
+	}
+
+	// Every candidate is larger than the sample.
+	if size, err := TuneChunkSize(context.Background(), 1000); err != nil || size != DefaultChunkSize {
+		t.Errorf("small sample: expected %d, got %d (%v)", DefaultChunkSize, size, err)
+	}
+
+	// The chunk size limit rules out larger candidates.
+	if size, err := TuneChunkSize(context.Background(), 1024*1024, WithMaxChunkSizeLimit(64*1024)); err != nil || size != 64*1024 {
+		t.Errorf("with limit: expected %d, got %d (%v)", 64*1024, size, err)
+	}
+
+	if _, err := TuneChunkSize(context.Background(), 0); err == nil {
+		t.Error("expected error for zero sample size")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := TuneChunkSize(ctx, 1024*1024); !errors.Is(err, ErrContextCanceled) {
+		t.Errorf("expected ErrContextCanceled, got %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// unlock.go: Password prompts with attempt limiting
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gitrgoliveira/go-fileencrypt/secure"
+)
+
+const (
+	// DefaultUnlockAttempts is the number of passwords an Unlocker tries by
+	// default.
+	DefaultUnlockAttempts = 3
+	// DefaultUnlockDelay is the default pause after the first wrong password.
+	DefaultUnlockDelay = time.Second
+	// DefaultUnlockMaxDelay is the default upper bound of the pause.
+	DefaultUnlockMaxDelay = 30 * time.Second
+)
+
+// Unlocker runs a password retry flow: it prompts for a password, tries it,
+// and after a wrong one waits before prompting again, doubling the wait each
+// time, until an attempt succeeds or the attempts run out. CLI and GUI
+// applications share the same brute-force friction this way instead of each
+// writing its own loop. The zero value with Prompt set uses the defaults.
+type Unlocker struct {
+	// Prompt asks for the password of the given attempt, counted from 1.
+	// The password is zeroed once it has been tried. An error, such as the
+	// user dismissing the dialog, ends the flow and is returned.
+	Prompt func(ctx context.Context, attempt int) ([]byte, error)
+	// MaxAttempts is the number of passwords tried (DefaultUnlockAttempts
+	// if zero).
+	MaxAttempts int
+	// Delay is the pause after the first wrong password (DefaultUnlockDelay
+	// if zero, none if negative). It doubles after each further one.
+	Delay time.Duration
+	// MaxDelay caps the pause (DefaultUnlockMaxDelay if zero).
+	MaxDelay time.Duration
+	// OnFailure, if set, is called after each wrong password with the
+	// attempt number, the attempts left and the pause before the next
+	// prompt, for example to show "2 attempts left".
+	OnFailure func(attempt, remaining int, delay time.Duration)
+}
+
+// Unlock prompts for passwords and passes each to open until open succeeds.
+// Only failures matching ErrAuthenticationFailed count as wrong passwords and
+// are retried; any other error from open is returned at once. When every
+// attempt has failed, the error matches ErrTooManyAttempts and the last
+// authentication failure.
+func (u *Unlocker) Unlock(ctx context.Context, open func(password []byte) error) error {
+	if u.Prompt == nil {
+		return errors.New("unlocker has no prompt")
+	}
+	attempts := u.MaxAttempts
+	if attempts <= 0 {
+		attempts = DefaultUnlockAttempts
+	}
+	delay := u.Delay
+	if delay == 0 {
+		delay = DefaultUnlockDelay
+	}
+	maxDelay := u.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = DefaultUnlockMaxDelay
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if ctx.Err() != nil {
+			return contextError(ctx)
+		}
+		password, err := u.Prompt(ctx, attempt)
+		if err != nil {
+			return err
+		}
+		err = open(password)
+		secure.Zero(password)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, ErrAuthenticationFailed) {
+			return err
+		}
+		lastErr = err
+		if attempt == attempts {
+			break
+		}
+
+		wait := max(min(delay, maxDelay), 0)
+		if u.OnFailure != nil {
+			u.OnFailure(attempt, attempts-attempt, wait)
+		}
+		if wait > 0 {
+			t := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return contextError(ctx)
+			case <-t.C:
+			}
+			delay = min(delay*2, maxDelay)
+		}
+	}
+	if u.OnFailure != nil {
+		u.OnFailure(attempts, 0, 0)
+	}
+	return fmt.Errorf("%w after %d attempts: %w", ErrTooManyAttempts, attempts, lastErr)
+}
+
+// LoadKeyFile loads the key container at path, prompting for its password
+// with the retry flow of Unlock.
+func (u *Unlocker) LoadKeyFile(ctx context.Context, path string) (*secure.SecureBuffer, KeyFileInfo, error) {
+	var key *secure.SecureBuffer
+	var info KeyFileInfo
+	err := u.Unlock(ctx, func(password []byte) error {
+		var err error
+		key, info, err = LoadKeyFile(path, password)
+		return err
+	})
+	if err != nil {
+		return nil, KeyFileInfo{}, err
+	}
+	return key, info, nil
+}
@@ -0,0 +1,105 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// unlock_test.go: Tests for the password retry flow
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUnlocker_LoadKeyFile(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "app.key")
+	if err := SaveKeyFile(path, key, []byte("right"), fastKeyFile); err != nil {
+		t.Fatalf("SaveKeyFile failed: %v", err)
+	}
+
+	passwords := [][]byte{[]byte("wrong"), []byte("also wrong"), []byte("right")}
+	var prompted []int
+	var delays []time.Duration
+	u := &Unlocker{
+		Prompt: func(_ context.Context, attempt int) ([]byte, error) {
+			prompted = append(prompted, attempt)
+			return passwords[attempt-1], nil
+		},
+		Delay:    time.Millisecond,
+		MaxDelay: 3 * time.Millisecond,
+		OnFailure: func(attempt, remaining int, delay time.Duration) {
+			delays = append(delays, delay)
+		},
+	}
+	buf, info, err := u.LoadKeyFile(context.Background(), path)
+	if err != nil {
+		t.Fatalf("LoadKeyFile failed: %v", err)
+	}
+	defer buf.Destroy()
+	if !bytes.Equal(buf.Data(), key) || info.Label != fastKeyFile.Label {
+		t.Error("unlocked the wrong key")
+	}
+	if len(prompted) != 3 || len(delays) != 2 || delays[0] != time.Millisecond || delays[1] != 2*time.Millisecond {
+		t.Errorf("prompted %v with delays %v", prompted, delays)
+	}
+	for _, p := range passwords {
+		if !bytes.Equal(p, make([]byte, len(p))) {
+			t.Errorf("password %q was not zeroed", p)
+		}
+	}
+}
+
+func TestUnlocker_Limits(t *testing.T) {
+	wrong := func([]byte) error { return ErrAuthenticationFailed }
+	prompt := func(context.Context, int) ([]byte, error) { return []byte("guess"), nil }
+
+	var delays []time.Duration
+	u := &Unlocker{Prompt: prompt, MaxAttempts: 5, Delay: time.Millisecond, MaxDelay: 3 * time.Millisecond,
+		OnFailure: func(_, _ int, d time.Duration) { delays = append(delays, d) }}
+	err := u.Unlock(context.Background(), wrong)
+	if !errors.Is(err, ErrTooManyAttempts) || !errors.Is(err, ErrAuthenticationFailed) {
+		t.Errorf("Unlock = %v, want ErrTooManyAttempts", err)
+	}
+	want := []time.Duration{1, 2, 3, 3, 0}
+	for i := range want {
+		want[i] *= time.Millisecond
+	}
+	if len(delays) != len(want) {
+		t.Fatalf("delays %v, want %v", delays, want)
+	}
+	for i := range want {
+		if delays[i] != want[i] {
+			t.Errorf("delays %v, want %v", delays, want)
+			break
+		}
+	}
+
+	// Errors other than a wrong password end the flow at once.
+	calls := 0
+	u = &Unlocker{Prompt: prompt, Delay: -1}
+	ioErr := errors.New("disk on fire")
+	if err := u.Unlock(context.Background(), func([]byte) error { calls++; return ioErr }); !errors.Is(err, ioErr) || calls != 1 {
+		t.Errorf("Unlock = %v after %d calls, want the open error after 1", err, calls)
+	}
+	cancelled := errors.New("dialog dismissed")
+	u = &Unlocker{Prompt: func(context.Context, int) ([]byte, error) { return nil, cancelled }}
+	if err := u.Unlock(context.Background(), wrong); !errors.Is(err, cancelled) {
+		t.Errorf("Unlock = %v, want the prompt error", err)
+	}
+
+	// Cancellation interrupts the pause.
+	ctx, cancel := context.WithCancel(context.Background())
+	u = &Unlocker{Prompt: prompt, Delay: time.Hour, OnFailure: func(int, int, time.Duration) { cancel() }}
+	if err := u.Unlock(ctx, wrong); !errors.Is(err, ErrContextCanceled) {
+		t.Errorf("Unlock = %v, want ErrContextCanceled", err)
+	}
+}
@@ -0,0 +1,234 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// usage.go: Key usage accounting and limits
+package core
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	// DefaultMessageLimit is the default number of messages (streams, logs
+	// and records, each with its own random base nonce) per key: the 2^32
+	// invocations NIST SP 800-38D allows for AES-GCM with random nonces.
+	DefaultMessageLimit uint64 = 1 << 32
+	// DefaultByteLimit is the default number of bytes sealed per key, 4PiB
+	// (2^48 AES blocks), which keeps the confidentiality bound of AES-GCM
+	// below 2^-32.
+	DefaultByteLimit uint64 = 1 << 52
+)
+
+// keyUsageWarnFraction is the share of a limit at which KeyLimits.Warn is
+// called.
+const keyUsageWarnFraction = 0.9
+
+// keyUsageSize is the size of a persisted usage file: the message and byte
+// counts, big-endian.
+const keyUsageSize = 16
+
+// KeyUsage is the amount of data encrypted under a key.
+type KeyUsage struct {
+	// Messages is the number of streams, logs and records started.
+	Messages uint64
+	// Bytes is the number of bytes sealed, including the small metadata
+	// records (trailers and chunk indexes) of each stream.
+	Bytes uint64
+}
+
+// KeyLimits configures the usage limits of a key for WithKeyLimits.
+type KeyLimits struct {
+	// Messages and Bytes are the limits; 0 selects DefaultMessageLimit and
+	// DefaultByteLimit. Once either is reached, starting a new message fails
+	// with ErrKeyExhausted. A message already started is finished, so Bytes
+	// can be exceeded by up to one message.
+	Messages uint64
+	Bytes    uint64
+	// Warn, if set, is called once per Encryptor when usage first reaches
+	// 90% of either limit, so the key can be rotated before it runs out.
+	Warn func(KeyUsage)
+	// Path, if set, persists the usage in a file that all Encryptors and
+	// processes using the key share, under an exclusive file lock. It is
+	// updated whenever a message starts and on Destroy.
+	Path string
+}
+
+// keyUsage accounts the usage of one Encryptor's key.
+type keyUsage struct {
+	mu     sync.Mutex
+	limits KeyLimits
+	file   *os.File
+	// used is the total usage as last known; pending is the part not yet
+	// added to the file.
+	used    KeyUsage
+	pending KeyUsage
+	warned  bool
+}
+
+// newKeyUsage returns the accounting for limits, loading the usage file if
+// one is configured. With enforce unset, usage is counted but not limited.
+func newKeyUsage(limits KeyLimits, enforce bool) (*keyUsage, error) {
+	if !enforce {
+		limits = KeyLimits{Messages: ^uint64(0), Bytes: ^uint64(0)}
+	}
+	if limits.Messages == 0 {
+		limits.Messages = DefaultMessageLimit
+	}
+	if limits.Bytes == 0 {
+		limits.Bytes = DefaultByteLimit
+	}
+	u := &keyUsage{limits: limits}
+	if limits.Path == "" {
+		return u, nil
+	}
+	f, err := os.OpenFile(limits.Path, os.O_RDWR|os.O_CREATE, 0600) // #nosec G304 -- File path provided by caller
+	if err != nil {
+		return nil, WrapError("open key usage", err)
+	}
+	u.file = f
+	if err := u.sync(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return u, nil
+}
+
+// startMessage accounts a new message, failing with ErrKeyExhausted once a
+// limit has been reached.
+func (u *keyUsage) startMessage() error {
+	u.mu.Lock()
+	if u.file != nil {
+		if err := u.sync(); err != nil {
+			u.mu.Unlock()
+			return err
+		}
+	}
+	if u.used.Messages >= u.limits.Messages || u.used.Bytes >= u.limits.Bytes {
+		used := u.used
+		u.mu.Unlock()
+		return fmt.Errorf("%w: %d messages and %d bytes encrypted, limits are %d and %d", ErrKeyExhausted, used.Messages, used.Bytes, u.limits.Messages, u.limits.Bytes)
+	}
+	u.used.Messages++
+	u.pending.Messages++
+	warn := u.crossedWarning()
+	u.mu.Unlock()
+	warn()
+	return nil
+}
+
+// addBytes accounts n sealed bytes.
+func (u *keyUsage) addBytes(n int) {
+	u.mu.Lock()
+	u.used.Bytes += uint64(n) // #nosec G115 -- Seal lengths are non-negative
+	u.pending.Bytes += uint64(n)
+	warn := u.crossedWarning()
+	u.mu.Unlock()
+	warn()
+}
+
+// usage returns the total usage as last known.
+func (u *keyUsage) usage() KeyUsage {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.used
+}
+
+// crossedWarning returns a function calling Warn if usage has just reached
+// the warning threshold, to be run after u.mu is released.
+func (u *keyUsage) crossedWarning() func() {
+	if u.warned || u.limits.Warn == nil {
+		return func() {}
+	}
+	if float64(u.used.Messages) < keyUsageWarnFraction*float64(u.limits.Messages) &&
+		float64(u.used.Bytes) < keyUsageWarnFraction*float64(u.limits.Bytes) {
+		return func() {}
+	}
+	u.warned = true
+	used, warn := u.used, u.limits.Warn
+	return func() { warn(used) }
+}
+
+// sync adds the pending usage to the file and reloads the totals, which
+// include other users of the file. u.mu must be held.
+func (u *keyUsage) sync() error {
+	if err := lockFile(u.file); err != nil {
+		return WrapError("lock key usage", err)
+	}
+	defer unlockFile(u.file)
+
+	var buf [keyUsageSize]byte
+	n, err := u.file.ReadAt(buf[:], 0)
+	if err != nil && err != io.EOF {
+		return WrapError("read key usage", err)
+	}
+	if n != 0 && n != keyUsageSize {
+		return fmt.Errorf("%w: key usage file %s is %d bytes", ErrCorruptedFile, u.limits.Path, n)
+	}
+	total := KeyUsage{
+		Messages: binary.BigEndian.Uint64(buf[:8]) + u.pending.Messages,
+		Bytes:    binary.BigEndian.Uint64(buf[8:]) + u.pending.Bytes,
+	}
+	if u.pending != (KeyUsage{}) {
+		binary.BigEndian.PutUint64(buf[:8], total.Messages)
+		binary.BigEndian.PutUint64(buf[8:], total.Bytes)
+		if _, err := u.file.WriteAt(buf[:], 0); err != nil {
+			return WrapError("write key usage", err)
+		}
+	}
+	u.used, u.pending = total, KeyUsage{}
+	return nil
+}
+
+// close writes the pending usage and closes the usage file.
+func (u *keyUsage) close() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.file == nil {
+		return nil
+	}
+	err := u.sync()
+	if cerr := u.file.Close(); err == nil {
+		err = WrapError("close key usage", cerr)
+	}
+	u.file = nil
+	return err
+}
+
+// usageNonces accounts a new message for every base nonce drawn.
+type usageNonces struct {
+	src   io.Reader
+	usage *keyUsage
+}
+
+func (r usageNonces) Read(p []byte) (int, error) {
+	if err := r.usage.startMessage(); err != nil {
+		return 0, err
+	}
+	return io.ReadFull(r.src, p)
+}
+
+// usageAEAD accounts the bytes of every Seal.
+type usageAEAD struct {
+	cipher.AEAD
+	usage *keyUsage
+}
+
+func (a usageAEAD) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	a.usage.addBytes(len(plaintext))
+	return a.AEAD.Seal(dst, nonce, plaintext, additionalData)
+}
+
+// Usage returns the amount of data encrypted under the key: by this
+// Encryptor, or by all users of the usage file configured with
+// WithKeyLimits as of the last message started.
+func (e *Encryptor) Usage() KeyUsage {
+	return e.usage.usage()
+}
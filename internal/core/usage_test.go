@@ -0,0 +1,99 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptor_Usage(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	var warnings []KeyUsage
+	enc, err := NewEncryptor(key, WithKeyLimits(KeyLimits{
+		Messages: 3,
+		Warn:     func(u KeyUsage) { warnings = append(warnings, u) },
+	}))
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+
+	data := make([]byte, 1000)
+	if err := enc.EncryptStream(context.Background(), bytes.NewReader(data), io.Discard); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+	// The trailer payload is sealed too.
+	if got, want := enc.Usage(), (KeyUsage{Messages: 1, Bytes: 1000 + TrailerPayloadSize}); got != want {
+		t.Errorf("Usage() = %+v, want %+v", got, want)
+	}
+	if _, err := enc.EncryptRecord([]byte("field"), nil); err != nil {
+		t.Fatalf("EncryptRecord failed: %v", err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("warned early: %+v", warnings)
+	}
+	if _, err := enc.EncryptRecord([]byte("field"), nil); err != nil {
+		t.Fatalf("EncryptRecord failed: %v", err)
+	}
+	if len(warnings) != 1 || warnings[0].Messages != 3 {
+		t.Errorf("expected one warning at 3 messages, got %+v", warnings)
+	}
+
+	if _, err := enc.EncryptRecord([]byte("field"), nil); !errors.Is(err, ErrKeyExhausted) {
+		t.Errorf("expected ErrKeyExhausted, got %v", err)
+	}
+	if err := enc.EncryptStream(context.Background(), bytes.NewReader(data), io.Discard); !errors.Is(err, ErrKeyExhausted) {
+		t.Errorf("expected ErrKeyExhausted, got %v", err)
+	}
+	if got := enc.Usage().Messages; got != 3 {
+		t.Errorf("refused messages were counted: %d", got)
+	}
+}
+
+func TestWithKeyLimits_Persisted(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	limits := KeyLimits{Bytes: 100, Path: filepath.Join(t.TempDir(), "key.usage")}
+	newEncryptor := func() *Encryptor {
+		t.Helper()
+		enc, err := NewEncryptor(key, WithKeyLimits(limits))
+		if err != nil {
+			t.Fatalf("NewEncryptor failed: %v", err)
+		}
+		return enc
+	}
+
+	a := newEncryptor()
+	if _, err := a.EncryptRecord(make([]byte, 60), nil); err != nil {
+		t.Fatalf("EncryptRecord failed: %v", err)
+	}
+	a.Destroy()
+
+	// A second user of the file sees the usage and hits the shared limit.
+	b := newEncryptor()
+	defer b.Destroy()
+	if got, want := b.Usage(), (KeyUsage{Messages: 1, Bytes: 60}); got != want {
+		t.Errorf("Usage() = %+v, want %+v", got, want)
+	}
+	if _, err := b.EncryptRecord(make([]byte, 60), nil); err != nil {
+		t.Fatalf("EncryptRecord failed: %v", err)
+	}
+	if _, err := b.EncryptRecord(make([]byte, 1), nil); !errors.Is(err, ErrKeyExhausted) {
+		t.Errorf("expected ErrKeyExhausted past the shared byte limit, got %v", err)
+	}
+}
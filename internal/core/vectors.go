@@ -0,0 +1,273 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// vectors.go: Canonical test vectors for other implementations of the format
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/gitrgoliveira/go-fileencrypt/format"
+)
+
+// deterministicNonceDomain separates the nonce stream from other uses of a seed.
+const deterministicNonceDomain = "go-fileencrypt deterministic nonce v1"
+
+// deterministicReader is SHA-256 in counter mode over a seed: block i is
+// SHA-256(domain || seed || uint64be(i)). It backs the canonical test vectors
+// and the testhooks-only WithDeterministicNonce.
+type deterministicReader struct {
+	mu      sync.Mutex
+	seed    []byte
+	counter uint64
+	buf     []byte
+}
+
+func (r *deterministicReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for n < len(p) {
+		if len(r.buf) == 0 {
+			h := sha256.New()
+			h.Write([]byte(deterministicNonceDomain))
+			h.Write(r.seed)
+			h.Write(binary.BigEndian.AppendUint64(nil, r.counter))
+			r.counter++
+			r.buf = h.Sum(nil)
+		}
+		c := copy(p[n:], r.buf)
+		r.buf = r.buf[c:]
+		n += c
+	}
+	return n, nil
+}
+
+// TestVector is one canonical encryption with every field of the resulting
+// file broken out, so readers written in other languages can be checked field
+// by field. All byte fields are hex-encoded.
+type TestVector struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Key         string `json:"key"`
+	// NonceSeed is the seed the base nonce was derived from (see
+	// docs/FORMAT.md); implementations can use Fields.Nonce directly.
+	NonceSeed  string           `json:"nonce_seed"`
+	ChunkSize  int              `json:"chunk_size"`
+	Sized      bool             `json:"sized"`
+	Plaintext  string           `json:"plaintext"`
+	Ciphertext string           `json:"ciphertext"`
+	Fields     TestVectorFields `json:"fields"`
+}
+
+// TestVectorFields is the per-field breakdown of a TestVector's ciphertext.
+type TestVectorFields struct {
+	Magic   string `json:"magic"`
+	Version int    `json:"version"`
+	Flags   uint32 `json:"flags"`
+	Nonce   string `json:"nonce"`
+	Size    uint64 `json:"size"`
+	// AAD is the encoded header, authenticated with every record.
+	AAD     string            `json:"aad"`
+	Chunks  []TestVectorChunk `json:"chunks"`
+	Trailer TestVectorTrailer `json:"trailer"`
+}
+
+// TestVectorChunk describes one chunk record.
+type TestVectorChunk struct {
+	Offset     int    `json:"offset"`
+	Length     uint32 `json:"length"`
+	Nonce      string `json:"nonce"`
+	Plaintext  string `json:"plaintext"`
+	Ciphertext string `json:"ciphertext"`
+	Tag        string `json:"tag"`
+}
+
+// TestVectorTrailer describes the end-of-stream trailer.
+type TestVectorTrailer struct {
+	Offset     int    `json:"offset"`
+	Nonce      string `json:"nonce"`
+	Plaintext  string `json:"plaintext"`
+	Ciphertext string `json:"ciphertext"`
+	Tag        string `json:"tag"`
+}
+
+// testVectorCase is the input of one canonical vector.
+type testVectorCase struct {
+	name        string
+	description string
+	chunkSize   int
+	sized       bool
+	plaintext   []byte
+}
+
+func testVectorCases() []testVectorCase {
+	sequence := func(n int) []byte {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = byte(i)
+		}
+		return b
+	}
+	return []testVectorCase{
+		{"empty", "Empty plaintext: header and trailer only", 16, true, nil},
+		{"single-chunk", "Short plaintext in one chunk with the default chunk size", DefaultChunkSize, true, []byte("hello, world\n")},
+		{"multi-chunk", "Three chunks, the last one partial", 16, true, sequence(40)},
+		{"exact-multiple", "Plaintext that is an exact multiple of the chunk size", 16, true, sequence(32)},
+		{"unsized-stream", "Stream of unknown size: the header size field is zero", 16, false, sequence(40)},
+	}
+}
+
+// testVectorKey is the fixed key of all canonical vectors: bytes 0x00..0x1f.
+func testVectorKey() []byte {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	return key
+}
+
+// GenerateTestVectors returns the canonical test vector suite for the current
+// format version. The suite is fixed: keys, nonces and plaintexts are
+// constants, so every call returns the same vectors.
+func GenerateTestVectors() ([]TestVector, error) {
+	key := testVectorKey()
+	var vectors []TestVector
+	for _, c := range testVectorCases() {
+		v, err := generateTestVector(key, c)
+		if err != nil {
+			return nil, fmt.Errorf("test vector %s: %w", c.name, err)
+		}
+		vectors = append(vectors, v)
+	}
+	return vectors, nil
+}
+
+// WriteTestVectors writes the canonical test vector suite to w as indented
+// JSON.
+func WriteTestVectors(w io.Writer) error {
+	vectors, err := GenerateTestVectors()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(struct {
+		Description   string       `json:"description"`
+		FormatVersion int          `json:"format_version"`
+		Vectors       []TestVector `json:"vectors"`
+	}{
+		Description:   "Known-answer test vectors for the go-fileencrypt format. Byte fields are hex-encoded; see docs/FORMAT.md.",
+		FormatVersion: Version,
+		Vectors:       vectors,
+	}, "", "  ")
+	if err != nil {
+		return WrapError("encode test vectors", err)
+	}
+	_, err = w.Write(append(data, '\n'))
+	return WrapError("write test vectors", err)
+}
+
+func generateTestVector(key []byte, c testVectorCase) (TestVector, error) {
+	chunkOpt, err := WithChunkSize(c.chunkSize)
+	if err != nil {
+		return TestVector{}, err
+	}
+	enc, err := NewEncryptor(key, chunkOpt)
+	if err != nil {
+		return TestVector{}, err
+	}
+	defer enc.Destroy()
+	seed := []byte("kat-" + c.name)
+	enc.nonceSource = &deterministicReader{seed: seed}
+
+	var sizeHint []int64
+	if c.sized {
+		sizeHint = append(sizeHint, int64(len(c.plaintext)))
+	}
+	var out bytes.Buffer
+	if err := enc.EncryptStream(context.Background(), bytes.NewReader(c.plaintext), &out, sizeHint...); err != nil {
+		return TestVector{}, err
+	}
+
+	fields, err := testVectorBreakdown(out.Bytes(), c.plaintext, c.chunkSize)
+	if err != nil {
+		return TestVector{}, err
+	}
+	return TestVector{
+		Name:        c.name,
+		Description: c.description,
+		Key:         hex.EncodeToString(key),
+		NonceSeed:   hex.EncodeToString(seed),
+		ChunkSize:   c.chunkSize,
+		Sized:       c.sized,
+		Plaintext:   hex.EncodeToString(c.plaintext),
+		Ciphertext:  hex.EncodeToString(out.Bytes()),
+		Fields:      fields,
+	}, nil
+}
+
+// testVectorBreakdown splits a v2 ciphertext into its fields.
+func testVectorBreakdown(data, plaintext []byte, chunkSize int) (TestVectorFields, error) {
+	h, err := format.ParseHeader(data)
+	if err != nil {
+		return TestVectorFields{}, err
+	}
+	baseNonce := h.Nonce[:]
+	f := TestVectorFields{
+		Magic:   hex.EncodeToString(data[:len(MagicBytes)]),
+		Version: int(h.Version),
+		Flags:   uint32(h.Flags),
+		Nonce:   hex.EncodeToString(baseNonce),
+		Size:    h.Size,
+		AAD:     hex.EncodeToString(h.AAD()),
+		Chunks:  []TestVectorChunk{},
+	}
+
+	off := h.Len()
+	nonce := make([]byte, NonceSize)
+	for counter := uint32(0); ; counter++ {
+		if off+4 > len(data) {
+			return f, fmt.Errorf("%w: missing trailer", ErrCorruptedFile)
+		}
+		length := binary.BigEndian.Uint32(data[off:])
+		if length == 0 {
+			break
+		}
+		record := data[off+4 : off+4+int(length)]
+		copy(nonce, baseNonce)
+		binary.BigEndian.PutUint32(nonce[8:], counter)
+		start := int(counter) * chunkSize
+		f.Chunks = append(f.Chunks, TestVectorChunk{
+			Offset:     off,
+			Length:     length,
+			Nonce:      hex.EncodeToString(nonce),
+			Plaintext:  hex.EncodeToString(plaintext[start : start+int(length)-TagSize]),
+			Ciphertext: hex.EncodeToString(record[:len(record)-TagSize]),
+			Tag:        hex.EncodeToString(record[len(record)-TagSize:]),
+		})
+		off += 4 + int(length)
+	}
+
+	sealed := data[off+4:]
+	payload := make([]byte, TrailerPayloadSize)
+	binary.BigEndian.PutUint64(payload[0:8], uint64(len(plaintext)))
+	binary.BigEndian.PutUint64(payload[8:16], uint64(len(f.Chunks)))
+	f.Trailer = TestVectorTrailer{
+		Offset:     off,
+		Nonce:      hex.EncodeToString(metadataNonce(baseNonce, recordTrailer)),
+		Plaintext:  hex.EncodeToString(payload),
+		Ciphertext: hex.EncodeToString(sealed[:len(sealed)-TagSize]),
+		Tag:        hex.EncodeToString(sealed[len(sealed)-TagSize:]),
+	}
+	return f, nil
+}
@@ -0,0 +1,63 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// verify.go: Integrity-only decryption for go-fileencrypt
+package core
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+)
+
+// VerifyFile checks that the encrypted file at path decrypts and authenticates
+// with the decryptor's key, without writing any plaintext. Every chunk and the
+// trailer are authenticated exactly as DecryptFile would, so a nil result means
+// DecryptFile will succeed. Progress is reported as with DecryptFile, and the
+// report's PlaintextBytes counts the bytes that would have been written.
+func (d *Decryptor) VerifyFile(ctx context.Context, path string) error {
+	ctx, release := d.deadlines(ctx)
+	defer release()
+	start := time.Now()
+	st := newStreamStats(d.plainHash)
+	err := d.verifyFile(ctx, path, &st)
+	d.fillReport(ctx, "verify", path, st, start, err)
+	return withDetail(d.errDetail, "verify", path, err)
+}
+
+func (d *Decryptor) verifyFile(ctx context.Context, path string, st *streamStats) error {
+	srcFile, err := os.Open(path) // #nosec G304 -- File path provided by caller, library purpose is file decryption
+	if err != nil {
+		return WrapError("open source file", err)
+	}
+	defer srcFile.Close()
+
+	src, header := d.fileSource(srcFile)
+	if err := d.preflight(srcFile, header); err != nil {
+		return err
+	}
+	bufferedReader := d.ioPools.reader(ctx, src)
+	defer d.ioPools.putReader(bufferedReader)
+
+	var sizeHint []int64
+	if size, ok := d.trailerSize(srcFile, header); ok {
+		sizeHint = append(sizeHint, size)
+	}
+	return d.decryptStream(ctx, bufferedReader, io.Discard, st, sizeHint...)
+}
+
+// VerifyStream checks that src decrypts and authenticates without producing
+// any plaintext. It follows the same rules as VerifyFile.
+func (d *Decryptor) VerifyStream(ctx context.Context, src io.Reader, sizeHint ...int64) error {
+	ctx, release := d.deadlines(ctx)
+	defer release()
+	start := time.Now()
+	st := newStreamStats(d.plainHash)
+	err := d.decryptStream(ctx, newCtxReader(ctx, src), io.Discard, &st, sizeHint...)
+	d.fillReport(ctx, "verify", "", st, start, err)
+	return withDetail(d.errDetail, "verify", "stream", err)
+}
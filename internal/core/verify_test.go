@@ -0,0 +1,84 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyFile(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	data := make([]byte, 50*1024)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("failed to generate data: %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	srcPath := filepath.Join(tmpDir, "plain.bin")
+	encPath := filepath.Join(tmpDir, "plain.enc")
+	if err := os.WriteFile(srcPath, data, 0600); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+	chunkOpt, err := WithChunkSize(8 * 1024)
+	if err != nil {
+		t.Fatalf("WithChunkSize failed: %v", err)
+	}
+	enc, err := NewEncryptor(key, chunkOpt)
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	defer enc.Destroy()
+	if err := enc.EncryptFile(context.Background(), srcPath, encPath); err != nil {
+		t.Fatalf("EncryptFile failed: %v", err)
+	}
+
+	var progress []float64
+	var report OperationReport
+	dec, err := NewDecryptor(key, WithProgress(func(p float64) { progress = append(progress, p) }), WithReport(&report))
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer dec.Destroy()
+
+	if err := dec.VerifyFile(context.Background(), encPath); err != nil {
+		t.Fatalf("VerifyFile failed: %v", err)
+	}
+	if len(progress) == 0 || progress[len(progress)-1] != 1.0 {
+		t.Errorf("expected progress ending at 1.0, got %v", progress)
+	}
+	if report.Operation != "verify" || report.PlaintextBytes != int64(len(data)) {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	ciphertext, err := os.ReadFile(encPath)
+	if err != nil {
+		t.Fatalf("failed to read encrypted file: %v", err)
+	}
+	ciphertext[len(ciphertext)/2] ^= 0x01
+	if err := dec.VerifyStream(context.Background(), bytes.NewReader(ciphertext)); !errors.Is(err, ErrCorruptedFile) {
+		t.Errorf("expected ErrCorruptedFile for tampered data, got %v", err)
+	}
+
+	wrongKey := make([]byte, 32)
+	other, err := NewDecryptor(wrongKey)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	defer other.Destroy()
+	if err := other.VerifyFile(context.Background(), encPath); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("expected ErrWrongKey, got %v", err)
+	}
+}
@@ -0,0 +1,204 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// walk.go: Source tree walking for directory operations
+package core
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// treeWalker walks a source tree for EncryptDir and DecryptDir. It mirrors
+// directories into dstDir, prunes excluded directories and a nested
+// destination, applies the symlink policy and hands regular files to file.
+type treeWalker struct {
+	ctx      context.Context
+	dstDir   string
+	filter   fileFilter
+	symlinks SymlinkPolicy
+	// skip is the destination path when it lies inside the source tree.
+	skip string
+	// active holds the resolved root and the followed directory links being
+	// walked, so that links leading back into them are not followed.
+	active []string
+	file   func(path, rel string, d fs.DirEntry) error
+	// plainName maps a source path to the name filters match, and dstName
+	// maps it to its destination path. Both default to the source path;
+	// they differ when names are obfuscated.
+	plainName func(rel string) string
+	dstName   func(rel string) string
+	// dryRun skips creating directories and links in the destination.
+	dryRun bool
+}
+
+func newTreeWalker(ctx context.Context, srcDir, dstDir string, filter fileFilter, symlinks SymlinkPolicy, file func(path, rel string, d fs.DirEntry) error) (*treeWalker, error) {
+	skip, err := nestedDir(srcDir, dstDir)
+	if err != nil {
+		return nil, err
+	}
+	return &treeWalker{ctx: ctx, dstDir: dstDir, filter: filter, symlinks: symlinks, skip: skip, file: file}, nil
+}
+
+func (w *treeWalker) run(srcDir string) error {
+	if w.symlinks == SymlinkFollow {
+		root, err := realPath(srcDir)
+		if err != nil {
+			return WrapError("resolve source directory", err)
+		}
+		w.active = []string{root}
+	}
+	return w.walk(srcDir, ".")
+}
+
+func (w *treeWalker) walk(root, relRoot string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if w.ctx.Err() != nil {
+			return contextError(w.ctx)
+		}
+		if d.IsDir() && path == w.skip {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.Join(relRoot, rel)
+
+		switch {
+		case d.IsDir():
+			if rel != "." && w.filter.excludes(filepath.ToSlash(w.plain(rel))) {
+				return filepath.SkipDir
+			}
+			if w.dryRun {
+				return nil
+			}
+			return WrapError("create destination directory", os.MkdirAll(w.dst(rel), 0700))
+		case d.Type()&fs.ModeSymlink != 0:
+			if err := w.symlink(path, rel, d); err != nil {
+				return fmt.Errorf("%s: %w", filepath.ToSlash(rel), err)
+			}
+			return nil
+		case d.Type().IsRegular():
+			return w.file(path, rel, d)
+		}
+		return nil
+	})
+}
+
+func (w *treeWalker) symlink(path, rel string, d fs.DirEntry) error {
+	// Excluded links are not resolved, so they may dangle.
+	if w.filter.excludes(filepath.ToSlash(w.plain(rel))) {
+		return nil
+	}
+	switch w.symlinks {
+	case SymlinkFollow:
+		return w.follow(path, rel)
+	case SymlinkPreserve:
+		if ok, err := w.filter.allowsEntry(filepath.ToSlash(w.plain(rel)), d); err != nil || !ok {
+			return err
+		}
+		if w.dryRun {
+			return nil
+		}
+		return copySymlink(path, w.dst(rel))
+	}
+	return nil
+}
+
+// plain returns the name filters match for the source path rel.
+func (w *treeWalker) plain(rel string) string {
+	if w.plainName == nil {
+		return rel
+	}
+	return w.plainName(rel)
+}
+
+// dst returns the destination path for the source path rel.
+func (w *treeWalker) dst(rel string) string {
+	if w.dstName == nil {
+		return filepath.Join(w.dstDir, rel)
+	}
+	return filepath.Join(w.dstDir, w.dstName(rel))
+}
+
+// follow processes the target of the link at path. Directory targets are
+// walked unless they contain the link, a directory already being walked or
+// the destination, which would recurse forever or encrypt our own output.
+func (w *treeWalker) follow(path, rel string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return WrapError("resolve symlink", err)
+	}
+	if info.Mode().IsRegular() {
+		return w.file(path, rel, fs.FileInfoToDirEntry(info))
+	}
+	if !info.IsDir() {
+		return nil
+	}
+
+	target, err := realPath(path)
+	if err != nil {
+		return WrapError("resolve symlink", err)
+	}
+	parent, err := realPath(filepath.Dir(path))
+	if err != nil {
+		return WrapError("resolve symlink", err)
+	}
+	dst, err := realPath(w.dstDir)
+	if err != nil {
+		return WrapError("resolve destination directory", err)
+	}
+	if within(parent, target) || within(target, dst) || within(dst, target) {
+		return nil
+	}
+	for _, dir := range w.active {
+		if within(dir, target) {
+			return nil
+		}
+	}
+
+	w.active = append(w.active, target)
+	defer func() { w.active = w.active[:len(w.active)-1] }()
+	// The trailing separator makes WalkDir descend into the link's target.
+	return w.walk(path+string(filepath.Separator), rel)
+}
+
+// copySymlink creates a link at dst with the same target as the link at src,
+// replacing a link left by a previous run.
+func copySymlink(src, dst string) error {
+	target, err := os.Readlink(src)
+	if err != nil {
+		return WrapError("read symlink", err)
+	}
+	if info, err := os.Lstat(dst); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+		if err := os.Remove(dst); err != nil {
+			return WrapError("replace symlink", err)
+		}
+	}
+	return WrapError("create symlink", os.Symlink(target, dst))
+}
+
+// realPath returns the absolute path of p with all symlinks resolved.
+func realPath(p string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(resolved)
+}
+
+// within reports whether path is dir or lies inside it.
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && filepath.IsLocal(rel)
+}
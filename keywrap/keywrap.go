@@ -0,0 +1,217 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// Package keywrap implements the AES key wrap algorithms of RFC 3394 (AES-KW)
+// and RFC 5649 (AES-KWP), for applications that protect data encryption keys
+// under a key encryption key in their own envelope schemes. Both are standard
+// constructions, so keys wrapped here can be unwrapped by other
+// implementations, such as cloud KMS import APIs and PKCS#11 tokens, and the
+// other way round.
+//
+// The key encryption key may be 16, 24 or 32 bytes (AES-128, AES-192 or
+// AES-256). Unwrapped keys are returned in ordinary slices, which callers
+// should zero with secure.Zero when done; intermediate values are zeroed
+// here.
+package keywrap
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/gitrgoliveira/go-fileencrypt/secure"
+)
+
+const (
+	// semiblock is the unit the algorithms work in: half an AES block.
+	semiblock = 8
+	// maxKWPSize is the largest key AES-KWP can wrap, limited by its 32-bit
+	// length indicator.
+	maxKWPSize = math.MaxUint32
+)
+
+var (
+	// ErrUnwrapFailed is returned when a wrapped key fails its integrity
+	// check: it was wrapped under another key encryption key, or modified.
+	ErrUnwrapFailed = errors.New("keywrap: integrity check failed")
+	// ErrInvalidLength is returned for keys or wrapped keys whose length the
+	// algorithm does not accept.
+	ErrInvalidLength = errors.New("keywrap: invalid length")
+)
+
+// defaultIV is the initial value of RFC 3394 section 2.2.3.1.
+var defaultIV = [semiblock]byte{0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6}
+
+// kwpICV is the constant half of the alternative initial value of RFC 5649
+// section 3; the other half is the key length.
+var kwpICV = [4]byte{0xA6, 0x59, 0x59, 0xA6}
+
+// Wrap wraps key under kek with AES-KW (RFC 3394). The key must be a multiple
+// of 8 bytes and at least 16; the result is 8 bytes longer.
+func Wrap(kek, key []byte) ([]byte, error) {
+	if len(key) < 2*semiblock || len(key)%semiblock != 0 {
+		return nil, fmt.Errorf("%w: AES-KW key must be a multiple of 8 bytes and at least 16, got %d", ErrInvalidLength, len(key))
+	}
+	block, err := newCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, semiblock+len(key))
+	copy(out[semiblock:], key)
+	wrap(block, defaultIV, out)
+	return out, nil
+}
+
+// Unwrap unwraps an AES-KW (RFC 3394) wrapped key under kek. It returns
+// ErrUnwrapFailed if the integrity check fails.
+func Unwrap(kek, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < 3*semiblock || len(wrapped)%semiblock != 0 {
+		return nil, fmt.Errorf("%w: AES-KW wrapped key must be a multiple of 8 bytes and at least 24, got %d", ErrInvalidLength, len(wrapped))
+	}
+	block, err := newCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, len(wrapped))
+	copy(buf, wrapped)
+	iv := unwrap(block, buf)
+	if subtle.ConstantTimeCompare(iv[:], defaultIV[:]) != 1 {
+		secure.Zero(buf)
+		return nil, ErrUnwrapFailed
+	}
+	return buf[semiblock:], nil
+}
+
+// WrapPad wraps key under kek with AES-KWP (RFC 5649), which accepts keys of
+// any length from 1 byte; the result is the key padded to a multiple of 8
+// bytes, plus 8.
+func WrapPad(kek, key []byte) ([]byte, error) {
+	if len(key) == 0 || uint64(len(key)) > maxKWPSize {
+		return nil, fmt.Errorf("%w: AES-KWP key must be 1 to %d bytes, got %d", ErrInvalidLength, uint64(maxKWPSize), len(key))
+	}
+	block, err := newCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	padded := (len(key) + semiblock - 1) / semiblock * semiblock
+	out := make([]byte, semiblock+padded)
+	var iv [semiblock]byte
+	copy(iv[:], kwpICV[:])
+	binary.BigEndian.PutUint32(iv[4:], uint32(len(key))) // #nosec G115 -- bounded by maxKWPSize above
+	copy(out[semiblock:], key)
+	if padded == semiblock {
+		// A single semiblock is encrypted as one AES block (section 4.1).
+		copy(out, iv[:])
+		block.Encrypt(out, out)
+		return out, nil
+	}
+	wrap(block, iv, out)
+	return out, nil
+}
+
+// UnwrapPad unwraps an AES-KWP (RFC 5649) wrapped key under kek. It returns
+// ErrUnwrapFailed if the integrity check fails.
+func UnwrapPad(kek, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < 2*semiblock || len(wrapped)%semiblock != 0 {
+		return nil, fmt.Errorf("%w: AES-KWP wrapped key must be a multiple of 8 bytes and at least 16, got %d", ErrInvalidLength, len(wrapped))
+	}
+	block, err := newCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, len(wrapped))
+	var iv [semiblock]byte
+	if len(wrapped) == 2*semiblock {
+		block.Decrypt(buf, wrapped)
+		copy(iv[:], buf)
+	} else {
+		copy(buf, wrapped)
+		iv = unwrap(block, buf)
+	}
+	padded := buf[semiblock:]
+
+	// Check the constant, the length and the padding together, so that which
+	// of them is wrong is not revealed (section 3).
+	ok := subtle.ConstantTimeCompare(iv[:4], kwpICV[:])
+	mli := uint64(binary.BigEndian.Uint32(iv[4:]))
+	n := uint64(len(padded))
+	ok &= lessOrEq(n-semiblock+1, mli) & lessOrEq(mli, n)
+	pad := byte(0)
+	for i := range padded {
+		// Bytes at or past mli are padding and must be zero.
+		inPad := lessOrEq(mli, uint64(i))
+		pad |= padded[i] & byte(-inPad)
+	}
+	ok &= subtle.ConstantTimeByteEq(pad, 0)
+	if ok != 1 {
+		secure.Zero(buf)
+		return nil, ErrUnwrapFailed
+	}
+	return padded[:mli], nil
+}
+
+func newCipher(kek []byte) (cipher.Block, error) {
+	switch len(kek) {
+	case 16, 24, 32:
+	default:
+		return nil, fmt.Errorf("%w: key encryption key must be 16, 24 or 32 bytes, got %d", ErrInvalidLength, len(kek))
+	}
+	return aes.NewCipher(kek)
+}
+
+// wrap applies the wrapping process W of RFC 3394 section 2.2.1 to the
+// semiblocks of buf after the first, with iv as the initial value, and writes
+// the integrity value to the first semiblock.
+func wrap(block cipher.Block, iv [semiblock]byte, buf []byte) {
+	n := len(buf)/semiblock - 1
+	var b [aes.BlockSize]byte
+	copy(b[:semiblock], iv[:])
+	for j := range 6 {
+		for i := 1; i <= n; i++ {
+			r := buf[i*semiblock : (i+1)*semiblock]
+			copy(b[semiblock:], r)
+			block.Encrypt(b[:], b[:])
+			t := uint64(n*j + i) // #nosec G115 -- positive
+			binary.BigEndian.PutUint64(b[:semiblock], binary.BigEndian.Uint64(b[:semiblock])^t)
+			copy(r, b[semiblock:])
+		}
+	}
+	copy(buf, b[:semiblock])
+	secure.Zero(b[:])
+}
+
+// unwrap applies the unwrapping process W^-1 of RFC 3394 section 2.2.2 to
+// buf and returns the recovered initial value, leaving the key in the
+// semiblocks after the first.
+func unwrap(block cipher.Block, buf []byte) [semiblock]byte {
+	n := len(buf)/semiblock - 1
+	var b [aes.BlockSize]byte
+	copy(b[:semiblock], buf)
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			r := buf[i*semiblock : (i+1)*semiblock]
+			t := uint64(n*j + i) // #nosec G115 -- positive
+			binary.BigEndian.PutUint64(b[:semiblock], binary.BigEndian.Uint64(b[:semiblock])^t)
+			copy(b[semiblock:], r)
+			block.Decrypt(b[:], b[:])
+			copy(r, b[semiblock:])
+		}
+	}
+	var iv [semiblock]byte
+	copy(iv[:], b[:semiblock])
+	secure.Zero(b[:])
+	return iv
+}
+
+// lessOrEq returns 1 if x <= y and 0 otherwise, in constant time. Both must
+// be below 2^63.
+func lessOrEq(x, y uint64) int {
+	return int((y-x)>>63) ^ 1 // #nosec G115 -- 0 or 1
+}
@@ -0,0 +1,125 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package keywrap_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/gitrgoliveira/go-fileencrypt/keywrap"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("bad hex %q: %v", s, err)
+	}
+	return b
+}
+
+// The vectors are from RFC 3394 section 4 and RFC 5649 section 6.
+func TestVectors(t *testing.T) {
+	tests := []struct {
+		name           string
+		pad            bool
+		kek, key, want string
+	}{
+		{"KW 128/128", false, "000102030405060708090A0B0C0D0E0F", "00112233445566778899AABBCCDDEEFF", "1FA68B0A8112B447AEF34BD8FB5A7B829D3E862371D2CFE5"},
+		{"KW 192/128", false, "000102030405060708090A0B0C0D0E0F1011121314151617", "00112233445566778899AABBCCDDEEFF", "96778B25AE6CA435F92B5B97C050AED2468AB8A17AD84E5D"},
+		{"KW 256/128", false, "000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F", "00112233445566778899AABBCCDDEEFF", "64E8C3F9CE0F5BA263E9777905818A2A93C8191E7D6E8AE7"},
+		{"KW 256/256", false, "000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F", "00112233445566778899AABBCCDDEEFF000102030405060708090A0B0C0D0E0F", "28C9F404C4B810F4CBCCB35CFB87F8263F5786E2D80ED326CBC7F0E71A99F43BFB988B9B7A02DD21"},
+		{"KWP 20 bytes", true, "5840df6e29b02af1ab493b705bf16ea1ae8338f4dcc176a8", "c37b7e6492584340bed12207808941155068f738", "138bdeaa9b8fa7fc61f97742e72248ee5ae6ae5360d1ae6a5f54f373fa543b6a"},
+		{"KWP 7 bytes", true, "5840df6e29b02af1ab493b705bf16ea1ae8338f4dcc176a8", "466f7250617369", "afbeb0f07dfbf5419200f2ccb50bb24f"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kek, key, want := unhex(t, tt.kek), unhex(t, tt.key), unhex(t, tt.want)
+			wrap, unwrap := keywrap.Wrap, keywrap.Unwrap
+			if tt.pad {
+				wrap, unwrap = keywrap.WrapPad, keywrap.UnwrapPad
+			}
+			got, err := wrap(kek, key)
+			if err != nil {
+				t.Fatalf("wrap failed: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("wrap = %x, want %x", got, want)
+			}
+			back, err := unwrap(kek, got)
+			if err != nil {
+				t.Fatalf("unwrap failed: %v", err)
+			}
+			if !bytes.Equal(back, key) {
+				t.Fatalf("unwrap = %x, want %x", back, key)
+			}
+		})
+	}
+}
+
+func TestUnwrap_Rejects(t *testing.T) {
+	kek := make([]byte, 32)
+	if _, err := rand.Read(kek); err != nil {
+		t.Fatal(err)
+	}
+	other := bytes.Clone(kek)
+	other[0] ^= 1
+
+	for _, size := range []int{1, 7, 8, 9, 16, 31, 32, 33} {
+		key := make([]byte, size)
+		if _, err := rand.Read(key); err != nil {
+			t.Fatal(err)
+		}
+		wrapped, err := keywrap.WrapPad(kek, key)
+		if err != nil {
+			t.Fatalf("WrapPad(%d bytes) failed: %v", size, err)
+		}
+		if len(wrapped) != (size+7)/8*8+8 {
+			t.Errorf("WrapPad(%d bytes) returned %d bytes", size, len(wrapped))
+		}
+		if _, err := keywrap.UnwrapPad(other, wrapped); !errors.Is(err, keywrap.ErrUnwrapFailed) {
+			t.Errorf("UnwrapPad(%d bytes) under another KEK = %v, want ErrUnwrapFailed", size, err)
+		}
+		wrapped[len(wrapped)-1] ^= 1
+		if _, err := keywrap.UnwrapPad(kek, wrapped); !errors.Is(err, keywrap.ErrUnwrapFailed) {
+			t.Errorf("UnwrapPad(%d bytes) of a modified key = %v, want ErrUnwrapFailed", size, err)
+		}
+		// AES-KW output is not a valid AES-KWP input, and the other way round.
+		if size%8 == 0 && size >= 16 {
+			kw, err := keywrap.Wrap(kek, key)
+			if err != nil {
+				t.Fatalf("Wrap(%d bytes) failed: %v", size, err)
+			}
+			if _, err := keywrap.UnwrapPad(kek, kw); !errors.Is(err, keywrap.ErrUnwrapFailed) {
+				t.Errorf("UnwrapPad of an AES-KW key = %v, want ErrUnwrapFailed", err)
+			}
+			kw[0] ^= 1
+			if _, err := keywrap.Unwrap(kek, kw); !errors.Is(err, keywrap.ErrUnwrapFailed) {
+				t.Errorf("Unwrap of a modified key = %v, want ErrUnwrapFailed", err)
+			}
+		}
+	}
+
+	for _, tc := range []struct {
+		name string
+		err  error
+	}{
+		{"short KEK", func() error { _, err := keywrap.Wrap(kek[:15], make([]byte, 16)); return err }()},
+		{"KW 8-byte key", func() error { _, err := keywrap.Wrap(kek, make([]byte, 8)); return err }()},
+		{"KW 20-byte key", func() error { _, err := keywrap.Wrap(kek, make([]byte, 20)); return err }()},
+		{"KW 16-byte input", func() error { _, err := keywrap.Unwrap(kek, make([]byte, 16)); return err }()},
+		{"KWP empty key", func() error { _, err := keywrap.WrapPad(kek, nil); return err }()},
+		{"KWP 12-byte input", func() error { _, err := keywrap.UnwrapPad(kek, make([]byte, 12)); return err }()},
+	} {
+		if !errors.Is(tc.err, keywrap.ErrInvalidLength) {
+			t.Errorf("%s: got %v, want ErrInvalidLength", tc.name, tc.err)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// Package kmsv2 implements the cryptography of a Kubernetes KMS v2 provider
+// plugin. The API server sends a plugin small payloads, its data encryption
+// key seeds, to encrypt under a key encryption key, and stores the
+// ciphertext with the key ID and annotations the plugin returned, passing all
+// three back to decrypt. Service does this with key encryption keys held in
+// memory, such as keys unwrapped from a hardware module at startup; a plugin
+// only needs to serve its methods over the KMS v2 gRPC API:
+//
+//	func (p *plugin) Encrypt(ctx context.Context, req *pb.EncryptRequest) (*pb.EncryptResponse, error) {
+//		resp, err := p.svc.Encrypt(ctx, &kmsv2.EncryptRequest{Plaintext: req.Plaintext, UID: req.Uid})
+//		if err != nil {
+//			return nil, err
+//		}
+//		return &pb.EncryptResponse{Ciphertext: resp.Ciphertext, KeyId: resp.KeyID, Annotations: resp.Annotations}, nil
+//	}
+//
+// Each payload is sealed with fileencrypt.EncryptRecord and bound to the ID
+// of the key that sealed it, so a ciphertext presented with another key ID
+// fails to decrypt. Responses are checked against the limits the API server
+// enforces before they are returned.
+package kmsv2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/gitrgoliveira/go-fileencrypt"
+)
+
+// APIVersion is the KMS API version reported by Status.
+const APIVersion = "v2"
+
+// HealthOK is the health reported by Status when the service can encrypt.
+const HealthOK = "ok"
+
+const (
+	// MaxCiphertextSize is the largest ciphertext the API server accepts.
+	MaxCiphertextSize = 1024
+	// MaxKeyIDSize is the longest key ID the API server accepts.
+	MaxKeyIDSize = 1024
+	// MaxAnnotationsSize is the largest total size of the annotation keys
+	// and values the API server accepts.
+	MaxAnnotationsSize = 32 * 1024
+	// maxDomainName is the longest annotation key.
+	maxDomainName = 253
+)
+
+// aadPrefix separates the payloads of this package from other records sealed
+// with the same key.
+const aadPrefix = "go-fileencrypt kms v2\x00"
+
+var (
+	// ErrUnknownKeyID is returned when a payload names a key ID the service
+	// does not hold.
+	ErrUnknownKeyID = errors.New("kmsv2: unknown key ID")
+	// ErrInvalidResponse is returned for responses the API server would
+	// reject.
+	ErrInvalidResponse = errors.New("kmsv2: invalid response")
+)
+
+// EncryptRequest is the KMS v2 EncryptRequest message.
+type EncryptRequest struct {
+	// Plaintext is the payload to encrypt.
+	Plaintext []byte
+	// UID identifies the request in the API server's logs. It is not bound
+	// to the ciphertext.
+	UID string
+}
+
+// EncryptResponse is the KMS v2 EncryptResponse message.
+type EncryptResponse struct {
+	Ciphertext []byte
+	// KeyID identifies the key that sealed Ciphertext.
+	KeyID string
+	// Annotations are stored by the API server with Ciphertext. Their keys
+	// must be fully qualified domain names.
+	Annotations map[string][]byte
+}
+
+// DecryptRequest is the KMS v2 DecryptRequest message: a ciphertext with the
+// key ID and annotations returned when it was encrypted.
+type DecryptRequest struct {
+	Ciphertext  []byte
+	UID         string
+	KeyID       string
+	Annotations map[string][]byte
+}
+
+// DecryptResponse is the KMS v2 DecryptResponse message.
+type DecryptResponse struct {
+	Plaintext []byte
+}
+
+// StatusResponse is the KMS v2 StatusResponse message.
+type StatusResponse struct {
+	Version string
+	// Healthz is HealthOK, or why the service cannot encrypt.
+	Healthz string
+	// KeyID is the ID of the key Encrypt uses. The API server generates a
+	// new data encryption key when it changes.
+	KeyID string
+}
+
+// Service encrypts payloads under its current key and decrypts them under
+// any key it holds. It is safe for concurrent use.
+type Service struct {
+	mu    sync.RWMutex
+	keyID string
+	enc   *fileencrypt.Encryptor
+	decs  map[string]*fileencrypt.Decryptor
+}
+
+// NewService returns a service encrypting under kek, identified by keyID.
+// Options are passed to the Encryptor and Decryptor, e.g. to set a key
+// deadline with fileencrypt.WithKeyDeadline.
+func NewService(keyID string, kek []byte, opts ...fileencrypt.Option) (*Service, error) {
+	s := &Service{decs: make(map[string]*fileencrypt.Decryptor)}
+	if err := s.Rotate(keyID, kek, opts...); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Rotate makes kek, identified by keyID, the key Encrypt uses. Earlier keys
+// are kept to decrypt the payloads they sealed until removed with RemoveKey.
+func (s *Service) Rotate(keyID string, kek []byte, opts ...fileencrypt.Option) error {
+	if err := checkKeyID(keyID); err != nil {
+		return err
+	}
+	enc, err := fileencrypt.NewEncryptor(kek, opts...)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.addKey(keyID, kek, opts); err != nil {
+		enc.Destroy()
+		return err
+	}
+	if s.enc != nil {
+		s.enc.Destroy()
+	}
+	s.keyID, s.enc = keyID, enc
+	return nil
+}
+
+// AddKey adds kek, identified by keyID, for decryption only, such as a key
+// retired before the plugin restarted.
+func (s *Service) AddKey(keyID string, kek []byte, opts ...fileencrypt.Option) error {
+	if err := checkKeyID(keyID); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addKey(keyID, kek, opts)
+}
+
+func (s *Service) addKey(keyID string, kek []byte, opts []fileencrypt.Option) error {
+	if _, ok := s.decs[keyID]; ok {
+		return fmt.Errorf("kmsv2: key ID %q is already in use", keyID)
+	}
+	dec, err := fileencrypt.NewDecryptor(kek, opts...)
+	if err != nil {
+		return err
+	}
+	s.decs[keyID] = dec
+	return nil
+}
+
+// RemoveKey destroys the key identified by keyID once no payload sealed with
+// it remains, such as after the API server has re-encrypted its secrets. The
+// current key cannot be removed.
+func (s *Service) RemoveKey(keyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if keyID == s.keyID {
+		return fmt.Errorf("kmsv2: key ID %q is the current key", keyID)
+	}
+	dec, ok := s.decs[keyID]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownKeyID, keyID)
+	}
+	dec.Destroy()
+	delete(s.decs, keyID)
+	return nil
+}
+
+// Status reports the service's health and current key ID. It is unhealthy
+// once the current key has been destroyed or has expired.
+func (s *Service) Status(ctx context.Context) (*StatusResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	resp := &StatusResponse{Version: APIVersion, Healthz: HealthOK, KeyID: s.keyID}
+	if _, err := s.enc.KeyFingerprint(); err != nil {
+		resp.Healthz = err.Error()
+	}
+	return resp, nil
+}
+
+// Encrypt seals req.Plaintext under the current key.
+func (s *Service) Encrypt(ctx context.Context, req *EncryptRequest) (*EncryptResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ciphertext, err := s.enc.EncryptRecord(req.Plaintext, recordAAD(s.keyID))
+	if err != nil {
+		return nil, err
+	}
+	resp := &EncryptResponse{Ciphertext: ciphertext, KeyID: s.keyID}
+	if err := ValidateEncryptResponse(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Decrypt opens req.Ciphertext with the key identified by req.KeyID. It
+// fails with ErrUnknownKeyID if the service does not hold that key, and with
+// fileencrypt.ErrAuthenticationFailed if the ciphertext was not sealed by
+// this package under it or has been modified.
+func (s *Service) Decrypt(ctx context.Context, req *DecryptRequest) (*DecryptResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	dec, ok := s.decs[req.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKeyID, req.KeyID)
+	}
+	plaintext, err := dec.DecryptRecord(req.Ciphertext, recordAAD(req.KeyID))
+	if err != nil {
+		return nil, err
+	}
+	return &DecryptResponse{Plaintext: plaintext}, nil
+}
+
+// Destroy destroys every key the service holds. The service cannot be used
+// afterwards.
+func (s *Service) Destroy() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.enc.Destroy()
+	for _, dec := range s.decs {
+		dec.Destroy()
+	}
+}
+
+// ValidateEncryptResponse reports whether the API server accepts resp: its
+// ciphertext and key ID must be set and at most MaxCiphertextSize and
+// MaxKeyIDSize bytes, and its annotations must be keyed by fully qualified
+// domain names and total at most MaxAnnotationsSize bytes. Plugins adding
+// their own annotations can check the result with it.
+func ValidateEncryptResponse(resp *EncryptResponse) error {
+	if len(resp.Ciphertext) == 0 || len(resp.Ciphertext) > MaxCiphertextSize {
+		return fmt.Errorf("%w: ciphertext of %d bytes, want 1 to %d", ErrInvalidResponse, len(resp.Ciphertext), MaxCiphertextSize)
+	}
+	if err := checkKeyID(resp.KeyID); err != nil {
+		return err
+	}
+	size := 0
+	for key, value := range resp.Annotations {
+		if !isDomainName(key) {
+			return fmt.Errorf("%w: annotation key %q is not a fully qualified domain name", ErrInvalidResponse, key)
+		}
+		size += len(key) + len(value)
+	}
+	if size > MaxAnnotationsSize {
+		return fmt.Errorf("%w: annotations of %d bytes exceed %d", ErrInvalidResponse, size, MaxAnnotationsSize)
+	}
+	return nil
+}
+
+// checkKeyID reports whether the API server accepts keyID.
+func checkKeyID(keyID string) error {
+	if keyID == "" || len(keyID) > MaxKeyIDSize {
+		return fmt.Errorf("%w: key ID of %d bytes, want 1 to %d", ErrInvalidResponse, len(keyID), MaxKeyIDSize)
+	}
+	return nil
+}
+
+// isDomainName reports whether name is a fully qualified domain name: at
+// least two dot-separated labels of lowercase letters, digits and inner
+// hyphens.
+func isDomainName(name string) bool {
+	if len(name) > maxDomainName {
+		return false
+	}
+	labels := strings.Split(name, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range []byte(label) {
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// recordAAD binds a payload to the ID of the key that sealed it.
+func recordAAD(keyID string) []byte {
+	return []byte(aadPrefix + keyID)
+}
@@ -0,0 +1,115 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package kmsv2_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/gitrgoliveira/go-fileencrypt"
+	"github.com/gitrgoliveira/go-fileencrypt/kmsv2"
+)
+
+func newKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	return key
+}
+
+func TestService(t *testing.T) {
+	ctx := context.Background()
+	svc, err := kmsv2.NewService("key-1", newKey(t))
+	if err != nil {
+		t.Fatalf("NewService failed: %v", err)
+	}
+	defer svc.Destroy()
+
+	status, err := svc.Status(ctx)
+	if err != nil || *status != (kmsv2.StatusResponse{Version: "v2", Healthz: "ok", KeyID: "key-1"}) {
+		t.Errorf("Status = %+v, %v", status, err)
+	}
+
+	seed := newKey(t)
+	resp, err := svc.Encrypt(ctx, &kmsv2.EncryptRequest{Plaintext: seed, UID: "request-1"})
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	if resp.KeyID != "key-1" || len(resp.Ciphertext) > kmsv2.MaxCiphertextSize {
+		t.Errorf("Encrypt = key ID %q, %d bytes", resp.KeyID, len(resp.Ciphertext))
+	}
+
+	// After rotation, new payloads use the new key and old ones still open.
+	if err := svc.Rotate("key-2", newKey(t)); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if status, _ := svc.Status(ctx); status.KeyID != "key-2" {
+		t.Errorf("Status key ID after rotation = %q", status.KeyID)
+	}
+	got, err := svc.Decrypt(ctx, &kmsv2.DecryptRequest{Ciphertext: resp.Ciphertext, KeyID: resp.KeyID, UID: "request-2"})
+	if err != nil || !bytes.Equal(got.Plaintext, seed) {
+		t.Errorf("Decrypt after rotation = %v", err)
+	}
+
+	// A ciphertext presented with another key ID does not open.
+	if _, err := svc.Decrypt(ctx, &kmsv2.DecryptRequest{Ciphertext: resp.Ciphertext, KeyID: "key-2"}); !errors.Is(err, fileencrypt.ErrAuthenticationFailed) {
+		t.Errorf("Decrypt under another key ID: error = %v, want ErrAuthenticationFailed", err)
+	}
+	if _, err := svc.Decrypt(ctx, &kmsv2.DecryptRequest{Ciphertext: resp.Ciphertext, KeyID: "key-3"}); !errors.Is(err, kmsv2.ErrUnknownKeyID) {
+		t.Errorf("Decrypt under an unknown key ID: error = %v, want ErrUnknownKeyID", err)
+	}
+
+	if err := svc.RemoveKey("key-2"); err == nil {
+		t.Error("RemoveKey removed the current key")
+	}
+	if err := svc.RemoveKey("key-1"); err != nil {
+		t.Fatalf("RemoveKey failed: %v", err)
+	}
+	if _, err := svc.Decrypt(ctx, &kmsv2.DecryptRequest{Ciphertext: resp.Ciphertext, KeyID: "key-1"}); !errors.Is(err, kmsv2.ErrUnknownKeyID) {
+		t.Errorf("Decrypt under a removed key: error = %v, want ErrUnknownKeyID", err)
+	}
+	if err := svc.Rotate("key-2", newKey(t)); err == nil {
+		t.Error("Rotate reused a key ID")
+	}
+	if _, err := kmsv2.NewService("", newKey(t)); err == nil {
+		t.Error("NewService accepted an empty key ID")
+	}
+}
+
+func TestValidateEncryptResponse(t *testing.T) {
+	tests := []struct {
+		name string
+		resp kmsv2.EncryptResponse
+		ok   bool
+	}{
+		{"valid", kmsv2.EncryptResponse{Ciphertext: []byte("c"), KeyID: "k", Annotations: map[string][]byte{"version.example.com": []byte("1")}}, true},
+		{"no ciphertext", kmsv2.EncryptResponse{KeyID: "k"}, false},
+		{"large ciphertext", kmsv2.EncryptResponse{Ciphertext: make([]byte, kmsv2.MaxCiphertextSize+1), KeyID: "k"}, false},
+		{"no key ID", kmsv2.EncryptResponse{Ciphertext: []byte("c")}, false},
+		{"long key ID", kmsv2.EncryptResponse{Ciphertext: []byte("c"), KeyID: strings.Repeat("k", kmsv2.MaxKeyIDSize+1)}, false},
+		{"single label", kmsv2.EncryptResponse{Ciphertext: []byte("c"), KeyID: "k", Annotations: map[string][]byte{"version": nil}}, false},
+		{"uppercase", kmsv2.EncryptResponse{Ciphertext: []byte("c"), KeyID: "k", Annotations: map[string][]byte{"Version.example.com": nil}}, false},
+		{"large annotations", kmsv2.EncryptResponse{Ciphertext: []byte("c"), KeyID: "k", Annotations: map[string][]byte{"a.example.com": make([]byte, kmsv2.MaxAnnotationsSize)}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := kmsv2.ValidateEncryptResponse(&tt.resp)
+			if tt.ok && err != nil {
+				t.Errorf("ValidateEncryptResponse failed: %v", err)
+			}
+			if !tt.ok && !errors.Is(err, kmsv2.ErrInvalidResponse) {
+				t.Errorf("ValidateEncryptResponse error = %v, want ErrInvalidResponse", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// Package paper encodes keys and small payloads for offline paper backups,
+// and decodes them back once typed in or scanned. Keys become word lists,
+// BIP39 mnemonics over the standard English list, which are easy to write
+// down and check: a 32-byte key is 24 words with a checksum in the last.
+// Any small payload, such as a key file from fileencrypt.MarshalKeyFile or
+// a short encrypted record, becomes checksummed text that is printed as is
+// or as a QR code:
+//
+//	words, err := paper.Words(key)          // "legal winner thank ..."
+//	key, err := paper.FromWords(words)
+//	png, err := paper.QRPNG(container)      // scanned back to the text
+//	container, err := paper.FromText(text)
+//
+// A paper copy of a raw key is the key: store it as you would the data it
+// protects, or back up a password-protected key file instead. Words and
+// text are Go strings, which cannot be zeroed; byte slices returned here
+// should be zeroed with secure.Zero when done.
+package paper
+
+import (
+	"crypto/sha256"
+	_ "embed"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gitrgoliveira/go-fileencrypt/secure"
+	"rsc.io/qr"
+)
+
+const (
+	// TextPrefix starts the text form of a payload and identifies its
+	// version.
+	TextPrefix = "GFP1"
+	// textChecksumLen is the length of the checksum after a payload.
+	textChecksumLen = 4
+	// textGroup is the number of characters between spaces in text.
+	textGroup = 4
+	// bitsPerWord is the number of bits a BIP39 word encodes.
+	bitsPerWord = 11
+)
+
+var (
+	// ErrChecksum is returned when words or text decode but their checksum
+	// does not match, usually because of a copying mistake.
+	ErrChecksum = errors.New("paper: checksum mismatch")
+	// ErrInvalidWord is returned for words that are not in the word list.
+	ErrInvalidWord = errors.New("paper: invalid word")
+	// ErrInvalidLength is returned for keys, word lists and payloads of a
+	// length that cannot be encoded or decoded.
+	ErrInvalidLength = errors.New("paper: invalid length")
+	// ErrInvalidText is returned for text that is not a payload's text form.
+	ErrInvalidText = errors.New("paper: invalid text")
+)
+
+//go:embed english.txt
+var englishList string
+
+var (
+	// english is the BIP39 English word list, and wordIndex maps each word
+	// and its four-letter prefix, unique within the list, to its index.
+	english   = strings.Fields(englishList)
+	wordIndex = func() map[string]int {
+		m := make(map[string]int, 2*len(english))
+		for i, w := range english {
+			m[w] = i
+			if len(w) > 4 {
+				m[w[:4]] = i
+			}
+		}
+		return m
+	}()
+)
+
+// textEncoding is base32 without padding, whose alphabet is within the
+// alphanumeric mode of QR codes.
+var textEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Words returns the BIP39 mnemonic of key, which must be 16, 20, 24, 28 or
+// 32 bytes: 12 to 24 words, the last one carrying a checksum.
+func Words(key []byte) ([]string, error) {
+	if len(key) < 16 || len(key) > 32 || len(key)%4 != 0 {
+		return nil, fmt.Errorf("%w: key of %d bytes, want 16, 20, 24, 28 or 32", ErrInvalidLength, len(key))
+	}
+	sum := sha256.Sum256(key)
+	bits := append(append([]byte(nil), key...), sum[0])
+	defer secure.Zero(bits)
+	n := (len(key)*8 + len(key)/4) / bitsPerWord
+	words := make([]string, n)
+	for i := range words {
+		words[i] = english[readBits(bits, i*bitsPerWord)]
+	}
+	return words, nil
+}
+
+// FromWords decodes a BIP39 mnemonic written by Words, or by another BIP39
+// tool over the English list, back to the key. Words are matched ignoring
+// case, and the first four letters of a word are enough. A mistyped word
+// fails with ErrInvalidWord naming its position, and swapped or wrong
+// words with ErrChecksum in most cases.
+func FromWords(words []string) ([]byte, error) {
+	n := len(words)
+	if n < 12 || n > 24 || n%3 != 0 {
+		return nil, fmt.Errorf("%w: %d words, want 12, 15, 18, 21 or 24", ErrInvalidLength, n)
+	}
+	total := n * bitsPerWord
+	checksumBits := total / 33
+	bits := make([]byte, (total+7)/8)
+	defer secure.Zero(bits)
+	for i, w := range words {
+		index, ok := wordIndex[strings.ToLower(strings.TrimSpace(w))]
+		if !ok {
+			return nil, fmt.Errorf("%w: word %d, %q", ErrInvalidWord, i+1, w)
+		}
+		writeBits(bits, i*bitsPerWord, index)
+	}
+	key := make([]byte, (total-checksumBits)/8)
+	copy(key, bits)
+	sum := sha256.Sum256(key)
+	mask := byte(0xff) << (8 - checksumBits)
+	if bits[len(key)]&mask != sum[0]&mask {
+		secure.Zero(key)
+		return nil, ErrChecksum
+	}
+	return key, nil
+}
+
+// readBits returns the 11 bits of b starting at bit off, most significant
+// first.
+func readBits(b []byte, off int) int {
+	v := 0
+	for i := 0; i < bitsPerWord; i++ {
+		bit := off + i
+		v = v<<1 | int(b[bit/8]>>(7-bit%8)&1)
+	}
+	return v
+}
+
+// writeBits sets the 11 bits of b starting at bit off to v.
+func writeBits(b []byte, off, v int) {
+	for i := 0; i < bitsPerWord; i++ {
+		if v>>(bitsPerWord-1-i)&1 == 1 {
+			bit := off + i
+			b[bit/8] |= 1 << (7 - bit%8)
+		}
+	}
+}
+
+// Text returns the text form of data: TextPrefix followed by data and a
+// checksum in base32, in groups of four characters. It uses only
+// characters of the QR alphanumeric mode, which keeps QR codes small.
+func Text(data []byte) string {
+	sum := sha256.Sum256(data)
+	payload := append(append([]byte(nil), data...), sum[:textChecksumLen]...)
+	defer secure.Zero(payload)
+	encoded := textEncoding.EncodeToString(payload)
+	var b strings.Builder
+	b.WriteString(TextPrefix)
+	for i := 0; i < len(encoded); i += textGroup {
+		b.WriteByte(' ')
+		b.WriteString(encoded[i:min(i+textGroup, len(encoded))])
+	}
+	return b.String()
+}
+
+// FromText decodes text written by Text. Case, spaces, line breaks and
+// dashes are ignored, so the text can be typed back from paper as it was
+// printed.
+func FromText(text string) ([]byte, error) {
+	compact := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\r', '\n', '-':
+			return -1
+		}
+		return r
+	}, strings.ToUpper(text))
+	encoded, ok := strings.CutPrefix(compact, TextPrefix)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing %s prefix", ErrInvalidText, TextPrefix)
+	}
+	payload, err := textEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidText, err)
+	}
+	defer secure.Zero(payload)
+	if len(payload) < textChecksumLen {
+		return nil, fmt.Errorf("%w: text too short", ErrInvalidLength)
+	}
+	data := append([]byte(nil), payload[:len(payload)-textChecksumLen]...)
+	sum := sha256.Sum256(data)
+	if string(sum[:textChecksumLen]) != string(payload[len(data):]) {
+		secure.Zero(data)
+		return nil, ErrChecksum
+	}
+	return data, nil
+}
+
+// encodeQR returns the QR code of the text form of data, at error
+// correction level M so that a creased or smudged print still scans.
+func encodeQR(data []byte) (*qr.Code, error) {
+	code, err := qr.Encode(Text(data), qr.M)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %d bytes do not fit in a QR code: %v", ErrInvalidLength, len(data), err)
+	}
+	return code, nil
+}
+
+// QRPNG returns a PNG image of the QR code of data's text form, which
+// scanners read back as the text for FromText. A QR code holds up to about
+// 1600 bytes of data.
+func QRPNG(data []byte) ([]byte, error) {
+	code, err := encodeQR(data)
+	if err != nil {
+		return nil, err
+	}
+	return code.PNG(), nil
+}
+
+// QRString returns the QR code of data's text form drawn with block
+// characters, two modules per character, for printing from a terminal.
+// Print it in a monospaced font with dark text on a light background.
+func QRString(data []byte) (string, error) {
+	code, err := encodeQR(data)
+	if err != nil {
+		return "", err
+	}
+	// A quiet zone of four modules surrounds the code.
+	const quiet = 4
+	var b strings.Builder
+	for y := -quiet; y < code.Size+quiet; y += 2 {
+		for x := -quiet; x < code.Size+quiet; x++ {
+			top, bottom := code.Black(x, y), code.Black(x, y+1)
+			switch {
+			case top && bottom:
+				b.WriteString("█")
+			case top:
+				b.WriteString("▀")
+			case bottom:
+				b.WriteString("▄")
+			default:
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,137 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package paper
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestWordsVectors checks mnemonics against the BIP39 reference vectors.
+func TestWordsVectors(t *testing.T) {
+	vectors := []struct{ entropy, mnemonic string }{
+		{"00000000000000000000000000000000", "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"},
+		{"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f", "legal winner thank year wave sausage worth useful legal winner thank yellow"},
+		{"ffffffffffffffffffffffffffffffffffffffffffffffff", "zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo when"},
+		{"0000000000000000000000000000000000000000000000000000000000000000", "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon art"},
+		{"9e885d952ad362caeb4efe34a8e91bd2", "ozone drill grab fiber curtain grace pudding thank cruise elder eight picnic"},
+	}
+	for _, v := range vectors {
+		key, _ := hex.DecodeString(v.entropy)
+		words, err := Words(key)
+		if err != nil {
+			t.Fatalf("Words(%s) failed: %v", v.entropy, err)
+		}
+		if got := strings.Join(words, " "); got != v.mnemonic {
+			t.Errorf("Words(%s) = %q, want %q", v.entropy, got, v.mnemonic)
+		}
+		back, err := FromWords(strings.Fields(v.mnemonic))
+		if err != nil || !bytes.Equal(back, key) {
+			t.Errorf("FromWords(%q) = %x, %v", v.mnemonic, back, err)
+		}
+	}
+}
+
+func TestFromWords(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	words, err := Words(key)
+	if err != nil {
+		t.Fatalf("Words failed: %v", err)
+	}
+	if len(words) != 24 {
+		t.Fatalf("Words returned %d words for a 32-byte key, want 24", len(words))
+	}
+
+	// Case and four-letter prefixes are accepted.
+	typed := make([]string, len(words))
+	for i, w := range words {
+		typed[i] = strings.ToUpper(w[:min(4, len(w))])
+	}
+	if got, err := FromWords(typed); err != nil || !bytes.Equal(got, key) {
+		t.Errorf("FromWords of prefixes = %x, %v", got, err)
+	}
+
+	bad := append([]string(nil), words...)
+	bad[3] = "notaword"
+	if _, err := FromWords(bad); !errors.Is(err, ErrInvalidWord) || !strings.Contains(err.Error(), "word 4") {
+		t.Errorf("FromWords with an unknown word: error = %v, want ErrInvalidWord for word 4", err)
+	}
+	if _, err := FromWords(words[:23]); !errors.Is(err, ErrInvalidLength) {
+		t.Errorf("FromWords of 23 words: error = %v, want ErrInvalidLength", err)
+	}
+	if _, err := FromWords(strings.Fields("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon")); !errors.Is(err, ErrChecksum) {
+		t.Errorf("FromWords with a wrong checksum: error = %v, want ErrChecksum", err)
+	}
+	if _, err := Words(make([]byte, 31)); !errors.Is(err, ErrInvalidLength) {
+		t.Errorf("Words of 31 bytes: error = %v, want ErrInvalidLength", err)
+	}
+}
+
+func TestText(t *testing.T) {
+	for _, size := range []int{0, 1, 32, 200} {
+		data := make([]byte, size)
+		if _, err := rand.Read(data); err != nil {
+			t.Fatalf("failed to generate data: %v", err)
+		}
+		text := Text(data)
+		if !strings.HasPrefix(text, TextPrefix+" ") {
+			t.Errorf("Text = %q, want the %s prefix", text, TextPrefix)
+		}
+		// Typed back in lower case, on several lines.
+		typed := strings.ToLower(strings.ReplaceAll(text, " ", "\n"))
+		got, err := FromText(typed)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("FromText of %d bytes = %x, %v", size, got, err)
+		}
+	}
+
+	text := []byte(Text([]byte("recovery key container")))
+	i := len(TextPrefix) + 2
+	if text[i] == 'A' {
+		text[i] = 'B'
+	} else {
+		text[i] = 'A'
+	}
+	if _, err := FromText(string(text)); !errors.Is(err, ErrChecksum) {
+		t.Errorf("FromText with a wrong character: error = %v, want ErrChecksum", err)
+	}
+	if _, err := FromText("ABCD EFGH"); !errors.Is(err, ErrInvalidText) {
+		t.Errorf("FromText without the prefix: error = %v, want ErrInvalidText", err)
+	}
+}
+
+func TestQR(t *testing.T) {
+	data := make([]byte, 300)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("failed to generate data: %v", err)
+	}
+	png, err := QRPNG(data)
+	if err != nil {
+		t.Fatalf("QRPNG failed: %v", err)
+	}
+	if !bytes.HasPrefix(png, []byte("\x89PNG")) {
+		t.Error("QRPNG did not return a PNG image")
+	}
+	s, err := QRString(data)
+	if err != nil {
+		t.Fatalf("QRString failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	if len(lines) < 10 || len([]rune(lines[0])) < 2*len(lines)-2 {
+		t.Errorf("QRString has %d lines of %d characters", len(lines), len([]rune(lines[0])))
+	}
+	if _, err := QRPNG(make([]byte, 4000)); !errors.Is(err, ErrInvalidLength) {
+		t.Errorf("QRPNG of 4000 bytes: error = %v, want ErrInvalidLength", err)
+	}
+}
@@ -11,14 +11,21 @@
 //   - Securely zeroes memory when destroyed
 //   - Provides a safe API for accessing sensitive bytes
 //
+// TempFile provides temporary files encrypted with an ephemeral key, for
+// sensitive intermediate data that must be spilled to disk.
+//
 // This package is designed to minimize the risk of sensitive data (like encryption keys)
 // leaking to disk or remaining in memory longer than necessary.
 package secure
 
 import (
 	"fmt"
+	"sync/atomic"
 )
 
+// live counts the SecureBuffers created and not yet destroyed.
+var live atomic.Int64
+
 // SecureBuffer wraps a byte slice containing sensitive data with automatic
 // memory protection and cleanup. It ensures that:
 // 1. The buffer is locked in memory (preventing swap to disk)
@@ -61,6 +68,7 @@ func NewSecureBuffer(size int) (*SecureBuffer, error) {
 		}
 	}
 
+	live.Add(1)
 	return &SecureBuffer{
 		data:   data,
 		unlock: unlock,
@@ -99,6 +107,7 @@ func (sb *SecureBuffer) Destroy() {
 	if sb.data != nil {
 		Zero(sb.data)
 		sb.data = nil
+		live.Add(-1)
 	}
 
 	if sb.unlock != nil {
@@ -106,3 +115,10 @@ func (sb *SecureBuffer) Destroy() {
 		sb.unlock = nil
 	}
 }
+
+// LiveBuffers returns the number of SecureBuffers created and not yet
+// destroyed in the process. A count that keeps growing in a long-running
+// program means buffers are dropped without Destroy.
+func LiveBuffers() int64 {
+	return live.Load()
+}
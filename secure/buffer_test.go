@@ -89,3 +89,25 @@ func TestSecureBufferMultipleDestroy(t *testing.T) {
 		}
 	}
 }
+
+func TestLiveBuffers(t *testing.T) {
+	before := secure.LiveBuffers()
+	a, err := secure.NewSecureBuffer(16)
+	if err != nil {
+		t.Fatalf("NewSecureBuffer failed: %v", err)
+	}
+	b, err := secure.NewSecureBuffer(16)
+	if err != nil {
+		t.Fatalf("NewSecureBuffer failed: %v", err)
+	}
+	if got := secure.LiveBuffers() - before; got != 2 {
+		t.Errorf("LiveBuffers grew by %d, want 2", got)
+	}
+
+	a.Destroy()
+	a.Destroy() // counted once
+	b.Destroy()
+	if got := secure.LiveBuffers(); got != before {
+		t.Errorf("LiveBuffers = %d after Destroy, want %d", got, before)
+	}
+}
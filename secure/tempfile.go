@@ -0,0 +1,282 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// tempfile.go: Temporary files encrypted with an ephemeral key
+package secure
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	// tempBlockSize is the plaintext size of each encrypted block of a
+	// TempFile. Blocks are sealed separately so any offset can be read or
+	// rewritten without touching the rest of the file.
+	tempBlockSize = 4096
+	tempNonceSize = 12
+	tempTagSize   = 16
+	// tempRecordSize is the on-disk size of a block: nonce, ciphertext, tag.
+	tempRecordSize = tempNonceSize + tempBlockSize + tempTagSize
+)
+
+// EncryptedFile is a temporary file whose contents are encrypted with a
+// random AES-256-GCM key held only in locked memory, returned by TempFile.
+// Data spilled through it is unreadable once the process exits or the file is
+// closed, even if the file itself is left behind by a crash.
+//
+// It supports Read, Write, Seek, ReadAt and WriteAt like an *os.File and is
+// safe for concurrent use. The contents are stored in 4 KiB blocks, each
+// sealed with a fresh nonce and bound to its position, so a block that is
+// altered or moved on disk fails to read.
+type EncryptedFile struct {
+	mu     sync.Mutex
+	f      *os.File
+	key    *SecureBuffer
+	aead   cipher.AEAD
+	block  *SecureBuffer // plaintext of the block being read or written
+	record []byte
+	size   int64
+	offset int64
+}
+
+// TempFile creates a new temporary file in dir, as os.CreateTemp does with
+// dir and pattern, and returns it wrapped in an EncryptedFile with a newly
+// generated key. Close deletes the file and destroys the key.
+func TempFile(dir, pattern string) (*EncryptedFile, error) {
+	key, err := NewSecureBuffer(32)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(key.Data()); err != nil {
+		key.Destroy()
+		return nil, fmt.Errorf("failed to generate temp file key: %w", err)
+	}
+	block, err := aes.NewCipher(key.Data())
+	if err != nil {
+		key.Destroy()
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		key.Destroy()
+		return nil, err
+	}
+	plain, err := NewSecureBuffer(tempBlockSize)
+	if err != nil {
+		key.Destroy()
+		return nil, err
+	}
+	f, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		key.Destroy()
+		plain.Destroy()
+		return nil, err
+	}
+	return &EncryptedFile{
+		f:      f,
+		key:    key,
+		aead:   aead,
+		block:  plain,
+		record: make([]byte, tempRecordSize),
+	}, nil
+}
+
+// Name returns the path of the underlying file.
+func (t *EncryptedFile) Name() string {
+	return t.f.Name()
+}
+
+// Size returns the plaintext size of the file.
+func (t *EncryptedFile) Size() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.size
+}
+
+// Read reads from the current offset.
+func (t *EncryptedFile) Read(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n, err := t.readAt(p, t.offset)
+	t.offset += int64(n)
+	return n, err
+}
+
+// Write writes at the current offset.
+func (t *EncryptedFile) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n, err := t.writeAt(p, t.offset)
+	t.offset += int64(n)
+	return n, err
+}
+
+// ReadAt reads len(p) bytes at offset off. It does not move the offset
+// used by Read and Write.
+func (t *EncryptedFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n, err := t.readAt(p, off)
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// WriteAt writes p at offset off. Writing past the end fills the gap with
+// zeros. It does not move the offset used by Read and Write.
+func (t *EncryptedFile) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.writeAt(p, off)
+}
+
+// Seek sets the offset for the next Read or Write, as io.Seeker describes.
+func (t *EncryptedFile) Seek(offset int64, whence int) (int64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.key == nil {
+		return 0, os.ErrClosed
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += t.offset
+	case io.SeekEnd:
+		offset += t.size
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+	t.offset = offset
+	return offset, nil
+}
+
+// Close destroys the key, closes the file and deletes it. It is safe to
+// call more than once.
+func (t *EncryptedFile) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.key == nil {
+		return nil
+	}
+	t.key.Destroy()
+	t.key = nil
+	t.block.Destroy()
+	err := t.f.Close()
+	if rmErr := os.Remove(t.f.Name()); rmErr != nil && !errors.Is(rmErr, os.ErrNotExist) && err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+// readAt reads up to len(p) bytes at off; t.mu must be held.
+func (t *EncryptedFile) readAt(p []byte, off int64) (int, error) {
+	if t.key == nil {
+		return 0, os.ErrClosed
+	}
+	if off >= t.size {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	p = p[:min(int64(len(p)), t.size-off)]
+	n := 0
+	for n < len(p) {
+		index, in := off/tempBlockSize, int(off%tempBlockSize)
+		if err := t.load(index); err != nil {
+			return n, err
+		}
+		k := copy(p[n:], t.block.Data()[in:])
+		n += k
+		off += int64(k)
+	}
+	return n, nil
+}
+
+// writeAt writes p at off; t.mu must be held.
+func (t *EncryptedFile) writeAt(p []byte, off int64) (int, error) {
+	if t.key == nil {
+		return 0, os.ErrClosed
+	}
+	if off > t.size {
+		// Seal the gap so every block up to the end can be read back.
+		zeros := make([]byte, min(off-t.size, tempBlockSize))
+		for t.size < off {
+			if _, err := t.writeAt(zeros[:min(off-t.size, int64(len(zeros)))], t.size); err != nil {
+				return 0, err
+			}
+		}
+	}
+	n := 0
+	for n < len(p) {
+		index, in := off/tempBlockSize, int(off%tempBlockSize)
+		k := min(tempBlockSize-in, len(p)-n)
+		// Keep the existing bytes of a block that is only partly rewritten.
+		if index*tempBlockSize < t.size && (in > 0 || k < tempBlockSize) {
+			if err := t.load(index); err != nil {
+				return n, err
+			}
+		} else {
+			Zero(t.block.Data())
+		}
+		copy(t.block.Data()[in:], p[n:n+k])
+		if err := t.store(index); err != nil {
+			return n, err
+		}
+		n += k
+		off += int64(k)
+		t.size = max(t.size, off)
+	}
+	return n, nil
+}
+
+// load decrypts block index into t.block.
+func (t *EncryptedFile) load(index int64) error {
+	if _, err := t.f.ReadAt(t.record, index*tempRecordSize); err != nil {
+		return fmt.Errorf("read temp file block %d: %w", index, err)
+	}
+	nonce, sealed := t.record[:tempNonceSize], t.record[tempNonceSize:]
+	if _, err := t.aead.Open(t.block.Data()[:0], nonce, sealed, blockAAD(index)); err != nil {
+		return fmt.Errorf("temp file block %d failed authentication", index)
+	}
+	return nil
+}
+
+// store encrypts t.block as block index under a fresh nonce.
+func (t *EncryptedFile) store(index int64) error {
+	nonce := t.record[:tempNonceSize]
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	t.aead.Seal(t.record[:tempNonceSize], nonce, t.block.Data(), blockAAD(index))
+	if _, err := t.f.WriteAt(t.record, index*tempRecordSize); err != nil {
+		return fmt.Errorf("write temp file block %d: %w", index, err)
+	}
+	return nil
+}
+
+// blockAAD binds a block to its position in the file.
+func blockAAD(index int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(index)) // #nosec G115 -- offsets are non-negative
+}
@@ -0,0 +1,111 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// tempfile_test.go: EncryptedFile tests for go-fileencrypt
+package secure_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/gitrgoliveira/go-fileencrypt/secure"
+)
+
+func TestTempFile(t *testing.T) {
+	tmp, err := secure.TempFile(t.TempDir(), "spill-*")
+	if err != nil {
+		t.Fatalf("TempFile failed: %v", err)
+	}
+	defer func() { _ = tmp.Close() }()
+
+	// Several blocks, ending in a partial one.
+	want := make([]byte, 3*4096+100)
+	if _, err := rand.Read(want); err != nil {
+		t.Fatalf("failed to generate data: %v", err)
+	}
+	if _, err := tmp.Write(want); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if tmp.Size() != int64(len(want)) {
+		t.Fatalf("Size = %d, want %d", tmp.Size(), len(want))
+	}
+
+	onDisk, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		t.Fatalf("failed to read temp file: %v", err)
+	}
+	if bytes.Contains(onDisk, want[:64]) {
+		t.Fatal("temp file contains plaintext")
+	}
+
+	// Rewrite across a block boundary and past the end.
+	patch := bytes.Repeat([]byte{0xAB}, 200)
+	if _, err := tmp.WriteAt(patch, 4000); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+	copy(want[4000:], patch)
+	if _, err := tmp.WriteAt([]byte("tail"), int64(len(want))+10); err != nil {
+		t.Fatalf("WriteAt past end failed: %v", err)
+	}
+	want = append(want, make([]byte, 10)...)
+	want = append(want, "tail"...)
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	got, err := io.ReadAll(tmp)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatal("read back data does not match")
+	}
+
+	buf := make([]byte, 10)
+	if n, err := tmp.ReadAt(buf, int64(len(want))-4); n != 4 || err != io.EOF {
+		t.Errorf("ReadAt at end = %d, %v; want 4, io.EOF", n, err)
+	}
+
+	name := tmp.Name()
+	if err := tmp.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := os.Stat(name); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("temp file still exists after Close: %v", err)
+	}
+	if _, err := tmp.Write([]byte("x")); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Write after Close = %v, want os.ErrClosed", err)
+	}
+}
+
+func TestTempFile_Tampered(t *testing.T) {
+	tmp, err := secure.TempFile(t.TempDir(), "spill-*")
+	if err != nil {
+		t.Fatalf("TempFile failed: %v", err)
+	}
+	defer func() { _ = tmp.Close() }()
+
+	if _, err := tmp.Write(make([]byte, 2*4096)); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	onDisk, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		t.Fatalf("failed to read temp file: %v", err)
+	}
+	// Swap the two blocks: each is bound to its position.
+	half := len(onDisk) / 2
+	swapped := append(append([]byte(nil), onDisk[half:]...), onDisk[:half]...)
+	if err := os.WriteFile(tmp.Name(), swapped, 0o600); err != nil {
+		t.Fatalf("failed to rewrite temp file: %v", err)
+	}
+	if _, err := tmp.ReadAt(make([]byte, 1), 0); err == nil {
+		t.Fatal("ReadAt succeeded on a moved block")
+	}
+}
@@ -93,7 +93,8 @@ func TestEncryptFile_WithPipe(t *testing.T) {
 		done <- err
 	}()
 
-	// Encrypt from pipe (will write size 0 in header since pipes have no size)
+	// Encrypt from pipe (header records size 0 since pipes have no size; the
+	// true size is authenticated in the trailer)
 	if err := fileencrypt.EncryptFile(context.Background(), pipePath, encPath, key); err != nil {
 		t.Fatalf("EncryptFile with pipe failed: %v", err)
 	}
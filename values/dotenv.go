@@ -0,0 +1,124 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// dotenv.go: Values of dotenv files
+package values
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// parseDotenv returns the values of a dotenv file: KEY=value lines,
+// optionally prefixed with export, with # comments and blank lines between
+// them. Quoted values must end on their line.
+func parseDotenv(data []byte) ([]field, error) {
+	var fields []field
+	for lineNo, off := 1, 0; off < len(data); lineNo++ {
+		line := lineAt(data, off)
+		lineStart := off
+		off += len(line) + 1
+
+		i := skipSpace(line, 0)
+		if i == len(line) || line[i] == '#' {
+			continue
+		}
+		if rest := line[i:]; bytes.HasPrefix(rest, []byte("export ")) {
+			i = skipSpace(line, i+len("export "))
+		}
+		eq := bytes.IndexByte(line[i:], '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("%w: line %d: missing =", ErrSyntax, lineNo)
+		}
+		key := string(bytes.TrimRight(line[i:i+eq], " \t"))
+		if !isEnvName(key) {
+			return nil, fmt.Errorf("%w: line %d: invalid variable name %q", ErrSyntax, lineNo, key)
+		}
+		start, end, err := scalarAt(line, skipSpace(line, i+eq+1))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		fields = append(fields, field{start: lineStart + start, end: lineStart + end, path: key})
+	}
+	return fields, nil
+}
+
+// isEnvName reports whether name can name a variable.
+func isEnvName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range []byte(name) {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '_' && c != '.' && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// lineAt returns the line starting at off, without its line ending.
+func lineAt(data []byte, off int) []byte {
+	line := data[off:]
+	if n := bytes.IndexByte(line, '\n'); n >= 0 {
+		line = line[:n]
+	}
+	return line
+}
+
+// skipSpace returns the index of the first byte of line at or after i that
+// is not a space or tab.
+func skipSpace(line []byte, i int) int {
+	for i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+		i++
+	}
+	return i
+}
+
+// quotedEnd returns the index after the string quoted by line[i], and
+// whether it ends on the line.
+func quotedEnd(line []byte, i int) (int, bool) {
+	quote := line[i]
+	for j := i + 1; j < len(line); j++ {
+		switch {
+		case line[j] == '\\' && quote == '"':
+			j++
+		case line[j] == quote && quote == '\'' && j+1 < len(line) && line[j+1] == '\'':
+			// A doubled single quote is an escaped quote in YAML.
+			j++
+		case line[j] == quote:
+			return j + 1, true
+		}
+	}
+	return 0, false
+}
+
+// scalarAt returns the bounds of the value starting at line[i]: a quoted
+// string up to its closing quote, or the text before a comment or the end
+// of the line, without trailing white space. Only a comment may follow a
+// quoted string.
+func scalarAt(line []byte, i int) (start, end int, err error) {
+	if i < len(line) && (line[i] == '"' || line[i] == '\'') {
+		end, ok := quotedEnd(line, i)
+		if !ok {
+			return 0, 0, fmt.Errorf("%w: quoted value continues on the next line", ErrUnsupported)
+		}
+		if k := skipSpace(line, end); k < len(line) && line[k] != '#' && line[k] != '\r' {
+			return 0, 0, fmt.Errorf("%w: text after quoted value", ErrSyntax)
+		}
+		return i, end, nil
+	}
+	end = len(line)
+	for j := i; j < len(line); j++ {
+		if line[j] == '#' && j > i && (line[j-1] == ' ' || line[j-1] == '\t') {
+			end = j
+			break
+		}
+	}
+	for end > i && (line[end-1] == ' ' || line[end-1] == '\t' || line[end-1] == '\r') {
+		end--
+	}
+	return i, end, nil
+}
@@ -0,0 +1,88 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// json.go: Values of JSON documents
+package values
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// jsonFrame is an object or array being parsed.
+type jsonFrame struct {
+	path   string
+	object bool
+	// key is the key of the next value in an object, and index the index
+	// of the next value in an array.
+	key   string
+	isKey bool
+	index int
+}
+
+// next returns the path of the next value in the frame and moves past it.
+func (f *jsonFrame) next() string {
+	if f.object {
+		f.isKey = true
+		return joinKey(f.path, f.key)
+	}
+	f.index++
+	return joinIndex(f.path, f.index-1)
+}
+
+// parseJSON returns the scalar values of a JSON document. It uses the
+// decoder's offsets to find each value in the input, so the layout around
+// it is kept.
+func parseJSON(data []byte) ([]field, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	var fields []field
+	var stack []*jsonFrame
+	for {
+		start := int(dec.InputOffset())
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil, fmt.Errorf("%w: %v", ErrSyntax, err)
+			}
+			return nil, err
+		}
+		end := int(dec.InputOffset())
+		var top *jsonFrame
+		if len(stack) > 0 {
+			top = stack[len(stack)-1]
+		}
+		if d, ok := tok.(json.Delim); ok && (d == '}' || d == ']') {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		if top != nil && top.object && top.isKey {
+			top.key, top.isKey = tok.(string), false
+			continue
+		}
+		path := ""
+		if top != nil {
+			path = top.next()
+		}
+		if d, ok := tok.(json.Delim); ok {
+			stack = append(stack, &jsonFrame{path: path, object: d == '{', isKey: d == '{'})
+			continue
+		}
+		// The offset before the token is where the previous one ended, so
+		// skip the separators between them.
+		for start < end && bytes.IndexByte([]byte(" \t\r\n,:"), data[start]) >= 0 {
+			start++
+		}
+		fields = append(fields, field{start: start, end: end, path: path})
+	}
+	return fields, nil
+}
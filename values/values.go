@@ -0,0 +1,221 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// Package values encrypts the values of structured configuration files,
+// JSON, YAML and dotenv, leaving their keys, layout and comments readable,
+// so that files holding secrets can be kept in Git and reviewed as diffs.
+// Each value is replaced with ENC[fileencrypt:...], a record sealed with
+// fileencrypt.EncryptRecord and bound to the value's path in the file, so an
+// encrypted value cannot be moved to another key:
+//
+//	enc, _ := fileencrypt.NewEncryptor(key)
+//	defer enc.Destroy()
+//	sealed, err := values.Encrypt(enc, values.YAML, data, nil)
+//
+// A value is encrypted exactly as written, including quotes, and decrypts
+// back to the same text, so a round trip leaves the file unchanged. Values
+// that are already encrypted are kept, so a file can be decrypted, edited
+// and encrypted again with only the edited values changing. Encryption hides
+// values, not structure: keys, the number of values and their lengths stay
+// visible, and removing a key is not detected.
+//
+// YAML support covers the block mappings and sequences of configuration
+// files; block scalars, flow collections, anchors, tags and multiple
+// documents fail with ErrUnsupported.
+package values
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/gitrgoliveira/go-fileencrypt"
+)
+
+// Format is the syntax of a structured file.
+type Format int
+
+const (
+	// JSON is a JSON document (RFC 8259).
+	JSON Format = iota
+	// YAML is a YAML document of block mappings and sequences.
+	YAML
+	// Dotenv is a file of KEY=value lines, as read by docker compose and
+	// the dotenv libraries.
+	Dotenv
+)
+
+// String returns the name of the format.
+func (f Format) String() string {
+	switch f {
+	case JSON:
+		return "JSON"
+	case YAML:
+		return "YAML"
+	case Dotenv:
+		return "dotenv"
+	default:
+		return fmt.Sprintf("Format(%d)", int(f))
+	}
+}
+
+// FormatOf returns the format of a file from its name: .json, .yaml or .yml,
+// and .env or a name starting with .env (such as .env.production).
+func FormatOf(path string) (Format, error) {
+	base := filepath.Base(path)
+	switch strings.ToLower(filepath.Ext(base)) {
+	case ".json":
+		return JSON, nil
+	case ".yaml", ".yml":
+		return YAML, nil
+	case ".env":
+		return Dotenv, nil
+	}
+	if strings.HasPrefix(base, ".env") {
+		return Dotenv, nil
+	}
+	return 0, fmt.Errorf("values: unknown format of %s", base)
+}
+
+const (
+	// prefix and suffix delimit an encrypted value.
+	prefix = "ENC[fileencrypt:"
+	suffix = "]"
+	// aadPrefix separates the values of this package from other records
+	// sealed with the same key.
+	aadPrefix = "go-fileencrypt values\x00"
+)
+
+var (
+	// ErrSyntax is returned for input that is not valid in its format.
+	ErrSyntax = errors.New("values: syntax error")
+	// ErrUnsupported is returned for valid input using syntax this package
+	// does not handle.
+	ErrUnsupported = errors.New("values: unsupported syntax")
+)
+
+// field is a value in a file: the bytes data[start:end] at path.
+type field struct {
+	start, end int
+	path       string
+}
+
+// parse returns the values of data in f, in order.
+func parse(f Format, data []byte) ([]field, error) {
+	switch f {
+	case JSON:
+		return parseJSON(data)
+	case YAML:
+		return parseYAML(data)
+	case Dotenv:
+		return parseDotenv(data)
+	default:
+		return nil, fmt.Errorf("values: unknown format %v", f)
+	}
+}
+
+// Encrypt encrypts the values of data, a file in format f, with enc. If
+// match is not nil, only the values whose path it accepts are encrypted.
+// Paths join mapping keys with dots and add sequence indexes in brackets,
+// such as "db.hosts[0]"; in dotenv files they are the variable names.
+// Empty values are left as they are.
+func Encrypt(enc *fileencrypt.Encryptor, f Format, data []byte, match func(path string) bool) ([]byte, error) {
+	fields, err := parse(f, data)
+	if err != nil {
+		return nil, err
+	}
+	return rewrite(data, fields, func(fd field, text []byte) ([]byte, error) {
+		if len(text) == 0 || isEncrypted(f, text) || (match != nil && !match(fd.path)) {
+			return text, nil
+		}
+		record, err := enc.EncryptRecord(text, aad(fd.path))
+		if err != nil {
+			return nil, fmt.Errorf("values: encrypt %s: %w", fd.path, err)
+		}
+		sealed := prefix + base64.RawStdEncoding.EncodeToString(record) + suffix
+		if f == JSON {
+			sealed = `"` + sealed + `"`
+		}
+		return []byte(sealed), nil
+	})
+}
+
+// Decrypt decrypts the values of data, a file in format f, encrypted with
+// Encrypt, and leaves other values as they are. A value that was modified,
+// encrypted with another key or moved to another path fails with
+// fileencrypt.ErrAuthenticationFailed.
+func Decrypt(dec *fileencrypt.Decryptor, f Format, data []byte) ([]byte, error) {
+	fields, err := parse(f, data)
+	if err != nil {
+		return nil, err
+	}
+	return rewrite(data, fields, func(fd field, text []byte) ([]byte, error) {
+		if !isEncrypted(f, text) {
+			return text, nil
+		}
+		if f == JSON {
+			text = text[1 : len(text)-1]
+		}
+		encoded := text[len(prefix) : len(text)-len(suffix)]
+		record, err := base64.RawStdEncoding.AppendDecode(nil, encoded)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: malformed encrypted value", ErrSyntax, fd.path)
+		}
+		plaintext, err := dec.DecryptRecord(record, aad(fd.path))
+		if err != nil {
+			return nil, fmt.Errorf("values: decrypt %s: %w", fd.path, err)
+		}
+		return plaintext, nil
+	})
+}
+
+// isEncrypted reports whether text is a value sealed by Encrypt.
+func isEncrypted(f Format, text []byte) bool {
+	if f == JSON {
+		if len(text) < 2 || text[0] != '"' || text[len(text)-1] != '"' {
+			return false
+		}
+		text = text[1 : len(text)-1]
+	}
+	return bytes.HasPrefix(text, []byte(prefix)) && bytes.HasSuffix(text, []byte(suffix))
+}
+
+// aad binds a value to its path.
+func aad(path string) []byte {
+	return []byte(aadPrefix + path)
+}
+
+// rewrite returns data with each field replaced by the result of fn.
+func rewrite(data []byte, fields []field, fn func(fd field, text []byte) ([]byte, error)) ([]byte, error) {
+	out := make([]byte, 0, len(data))
+	last := 0
+	for _, fd := range fields {
+		text, err := fn(fd, data[fd.start:fd.end])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, data[last:fd.start]...)
+		out = append(out, text...)
+		last = fd.end
+	}
+	return append(out, data[last:]...), nil
+}
+
+// joinKey returns the path of key in the mapping at path.
+func joinKey(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// joinIndex returns the path of item i in the sequence at path.
+func joinIndex(path string, i int) string {
+	return fmt.Sprintf("%s[%d]", path, i)
+}
@@ -0,0 +1,202 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package values_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/gitrgoliveira/go-fileencrypt"
+	"github.com/gitrgoliveira/go-fileencrypt/values"
+)
+
+func newCodec(t *testing.T) (*fileencrypt.Encryptor, *fileencrypt.Decryptor) {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	enc, err := fileencrypt.NewEncryptor(key)
+	if err != nil {
+		t.Fatalf("NewEncryptor failed: %v", err)
+	}
+	t.Cleanup(enc.Destroy)
+	dec, err := fileencrypt.NewDecryptor(key)
+	if err != nil {
+		t.Fatalf("NewDecryptor failed: %v", err)
+	}
+	t.Cleanup(dec.Destroy)
+	return enc, dec
+}
+
+func TestRoundTrip(t *testing.T) {
+	enc, dec := newCodec(t)
+	tests := []struct {
+		name    string
+		format  values.Format
+		input   string
+		secrets []string
+		keys    []string
+	}{
+		{
+			name:   "json",
+			format: values.JSON,
+			input: `{
+  "db": {"user": "admin", "password": "hunter2", "port": 5432},
+  "hosts": ["alpha.internal", "beta.internal"],
+  "debug": false,
+  "empty": ""
+}
+`,
+			secrets: []string{"admin", "hunter2", "5432", "alpha.internal", "beta.internal"},
+			keys:    []string{`"db"`, `"password"`, `"hosts"`},
+		},
+		{
+			name:   "yaml",
+			format: values.YAML,
+			input: `---
+# Database settings
+db:
+  user: admin
+  password: "hunter 2" # rotated monthly
+  port: 5432
+hosts:
+- alpha.internal
+- name: beta
+  token: 'it''s secret'
+url: https://example.com/path
+`,
+			secrets: []string{"admin", "hunter 2", "5432", "alpha.internal", "it''s secret", "example.com"},
+			keys:    []string{"db:", "password:", "# rotated monthly", "# Database settings", "- name:", "token:"},
+		},
+		{
+			name:   "dotenv",
+			format: values.Dotenv,
+			input: `# Service credentials
+export API_KEY=abc123
+DB_PASSWORD="p@ss word" # rotated monthly
+EMPTY=
+`,
+			secrets: []string{"abc123", "p@ss word"},
+			keys:    []string{"export API_KEY=", "DB_PASSWORD=", "# rotated monthly", "EMPTY=\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sealed, err := values.Encrypt(enc, tt.format, []byte(tt.input), nil)
+			if err != nil {
+				t.Fatalf("Encrypt failed: %v", err)
+			}
+			for _, s := range tt.secrets {
+				if bytes.Contains(sealed, []byte(s)) {
+					t.Errorf("encrypted file contains %q", s)
+				}
+			}
+			for _, k := range tt.keys {
+				if !bytes.Contains(sealed, []byte(k)) {
+					t.Errorf("encrypted file lost %q:\n%s", k, sealed)
+				}
+			}
+			if tt.format == values.JSON && !json.Valid(sealed) {
+				t.Errorf("encrypted JSON is not valid:\n%s", sealed)
+			}
+
+			// Encrypting again keeps the encrypted values.
+			again, err := values.Encrypt(enc, tt.format, sealed, nil)
+			if err != nil || !bytes.Equal(again, sealed) {
+				t.Errorf("Encrypt of an encrypted file changed it: %v", err)
+			}
+
+			opened, err := values.Decrypt(dec, tt.format, sealed)
+			if err != nil {
+				t.Fatalf("Decrypt failed: %v", err)
+			}
+			if string(opened) != tt.input {
+				t.Errorf("Decrypt = %q, want %q", opened, tt.input)
+			}
+		})
+	}
+}
+
+func TestBoundToPath(t *testing.T) {
+	enc, dec := newCodec(t)
+	sealed, err := values.Encrypt(enc, values.Dotenv, []byte("A=first\nB=second\n"), nil)
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	lines := strings.Split(string(sealed), "\n")
+	swapped := "A=" + strings.TrimPrefix(lines[1], "B=") + "\nB=" + strings.TrimPrefix(lines[0], "A=") + "\n"
+	if _, err := values.Decrypt(dec, values.Dotenv, []byte(swapped)); !errors.Is(err, fileencrypt.ErrAuthenticationFailed) {
+		t.Errorf("Decrypt of swapped values: error = %v, want ErrAuthenticationFailed", err)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	enc, dec := newCodec(t)
+	input := "db:\n  host: db.internal\n  password: hunter2\n"
+	sealed, err := values.Encrypt(enc, values.YAML, []byte(input), func(path string) bool {
+		return strings.HasSuffix(path, "password")
+	})
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	if !bytes.Contains(sealed, []byte("host: db.internal")) || bytes.Contains(sealed, []byte("hunter2")) {
+		t.Errorf("Encrypt with a match:\n%s", sealed)
+	}
+	if opened, err := values.Decrypt(dec, values.YAML, sealed); err != nil || string(opened) != input {
+		t.Errorf("Decrypt = %q, %v", opened, err)
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	enc, _ := newCodec(t)
+	tests := []struct {
+		name   string
+		format values.Format
+		input  string
+		want   error
+	}{
+		{"yaml block scalar", values.YAML, "key: |\n  text\n", values.ErrUnsupported},
+		{"yaml flow mapping", values.YAML, "key: {a: 1}\n", values.ErrUnsupported},
+		{"yaml anchor", values.YAML, "key: &anchor value\n", values.ErrUnsupported},
+		{"yaml documents", values.YAML, "a: 1\n---\nb: 2\n", values.ErrUnsupported},
+		{"yaml multi-line", values.YAML, "key: one\n  two\n", values.ErrUnsupported},
+		{"dotenv multi-line", values.Dotenv, "KEY=\"one\ntwo\"\n", values.ErrUnsupported},
+		{"dotenv missing =", values.Dotenv, "KEY\n", values.ErrSyntax},
+		{"json", values.JSON, `{"a": }`, values.ErrSyntax},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := values.Encrypt(enc, tt.format, []byte(tt.input), nil); !errors.Is(err, tt.want) {
+				t.Errorf("Encrypt error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	tests := map[string]values.Format{
+		"config.json":          values.JSON,
+		"values.yaml":          values.YAML,
+		"deploy/app.YML":       values.YAML,
+		".env":                 values.Dotenv,
+		"service/.env.staging": values.Dotenv,
+		"secrets.env":          values.Dotenv,
+	}
+	for name, want := range tests {
+		if got, err := values.FormatOf(name); err != nil || got != want {
+			t.Errorf("FormatOf(%q) = %v, %v, want %v", name, got, err, want)
+		}
+	}
+	if _, err := values.FormatOf("notes.txt"); err == nil {
+		t.Error("FormatOf accepted a .txt file")
+	}
+}
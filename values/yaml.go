@@ -0,0 +1,137 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// yaml.go: Values of YAML documents
+package values
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// yamlNode is a mapping key or sequence item whose children are being
+// parsed: the lines indented more than it.
+type yamlNode struct {
+	indent int
+	path   string
+	item   bool
+}
+
+// parseYAML returns the scalar values of a YAML document made of block
+// mappings and sequences, one key or item per line. Lines are matched to
+// their parent by indentation.
+func parseYAML(data []byte) ([]field, error) {
+	var fields []field
+	var stack []yamlNode
+	items := make(map[string]int)
+	content := false
+	parent := func() string {
+		if len(stack) == 0 {
+			return ""
+		}
+		return stack[len(stack)-1].path
+	}
+
+	for lineNo, off := 1, 0; off < len(data); lineNo++ {
+		line := lineAt(data, off)
+		lineStart := off
+		off += len(line) + 1
+		line = bytes.TrimSuffix(line, []byte("\r"))
+
+		i := skipSpace(line, 0)
+		if i == len(line) || line[i] == '#' {
+			continue
+		}
+		if bytes.IndexByte(line[:i], '\t') >= 0 {
+			return nil, fmt.Errorf("%w: line %d: tab in indentation", ErrSyntax, lineNo)
+		}
+		if i == 0 && (bytes.HasPrefix(line, []byte("---")) || bytes.HasPrefix(line, []byte("..."))) && (len(line) == 3 || line[3] == ' ') {
+			if content || line[0] == '.' {
+				return nil, fmt.Errorf("%w: line %d: multiple documents", ErrUnsupported, lineNo)
+			}
+			continue
+		}
+		if line[i] == '%' {
+			return nil, fmt.Errorf("%w: line %d: directive", ErrUnsupported, lineNo)
+		}
+		content = true
+
+		// Sequence items, possibly nested on one line.
+		item := false
+		for line[i] == '-' && (i+1 == len(line) || line[i+1] == ' ') {
+			for len(stack) > 0 && (stack[len(stack)-1].indent > i || stack[len(stack)-1].indent == i && stack[len(stack)-1].item) {
+				stack = stack[:len(stack)-1]
+			}
+			p := parent()
+			stack = append(stack, yamlNode{indent: i, path: joinIndex(p, items[p]), item: true})
+			items[p]++
+			item = true
+			i = skipSpace(line, i+1)
+			if i == len(line) || line[i] == '#' {
+				break
+			}
+		}
+		if i == len(line) || line[i] == '#' {
+			continue
+		}
+
+		path := ""
+		valueAt := i
+		if key, next, ok := yamlKeyAt(line, i); ok {
+			for len(stack) > 0 && stack[len(stack)-1].indent >= i {
+				stack = stack[:len(stack)-1]
+			}
+			path = joinKey(parent(), key)
+			valueAt = skipSpace(line, next)
+			if valueAt == len(line) || line[valueAt] == '#' {
+				stack = append(stack, yamlNode{indent: i, path: path})
+				continue
+			}
+		} else if item {
+			path = parent()
+		} else {
+			return nil, fmt.Errorf("%w: line %d: expected a key or sequence item", ErrUnsupported, lineNo)
+		}
+
+		if bytes.IndexByte([]byte("|>&*!{[?"), line[valueAt]) >= 0 {
+			return nil, fmt.Errorf("%w: line %d: %q value", ErrUnsupported, lineNo, line[valueAt])
+		}
+		start, end, err := scalarAt(line, valueAt)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		fields = append(fields, field{start: lineStart + start, end: lineStart + end, path: path})
+	}
+	return fields, nil
+}
+
+// yamlKeyAt parses a mapping key at line[i], plain or quoted and followed by
+// a colon and a space or the end of the line. It returns the key, without
+// quotes, and the index after the colon.
+func yamlKeyAt(line []byte, i int) (key string, next int, ok bool) {
+	if c := line[i]; c == '"' || c == '\'' {
+		end, ok := quotedEnd(line, i)
+		if !ok || end >= len(line) || line[end] != ':' {
+			return "", 0, false
+		}
+		if end+1 < len(line) && line[end+1] != ' ' {
+			return "", 0, false
+		}
+		return string(line[i+1 : end-1]), end + 1, true
+	}
+	for j := i; j < len(line); j++ {
+		switch {
+		case line[j] == '#' && j > i && line[j-1] == ' ':
+			return "", 0, false
+		case line[j] == ':' && (j+1 == len(line) || line[j+1] == ' '):
+			if j == i {
+				return "", 0, false
+			}
+			return string(bytes.TrimRight(line[i:j], " ")), j + 1, true
+		}
+	}
+	return "", 0, false
+}
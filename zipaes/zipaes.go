@@ -0,0 +1,555 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+// Package zipaes writes password-protected ZIP archives in the WinZip AES
+// format, AE-2 with AES-256, for sharing files with recipients who open
+// them with 7-Zip, WinZip or another archive tool rather than this
+// library. It builds on archive/zip, and archives it writes are read with
+// zip.NewReader and Open:
+//
+//	zw, err := zipaes.NewWriter(out, password)
+//	f, err := zw.Create("report.pdf")
+//	io.Copy(f, report)
+//	err = zw.Close()
+//
+// The format is weaker than the library's own: keys are derived from the
+// password with PBKDF2-HMAC-SHA1 at 1000 iterations, as the format fixes,
+// so the archive is only as strong as its password against guessing, and
+// names, sizes and timestamps of entries are not encrypted. Use it with
+// long generated passwords, and the library's own format where both ends
+// run this library.
+package zipaes
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gitrgoliveira/go-fileencrypt/secure"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// methodAES is the compression method of WinZip AES entries; the
+	// actual method is recorded in the AES extra field.
+	methodAES = 99
+	// aesExtraID identifies the AES extra field, of aesExtraLen bytes.
+	aesExtraID  = 0x9901
+	aesExtraLen = 7
+	// extTimeExtraID identifies the extended timestamp extra field, as
+	// archive/zip writes it.
+	extTimeExtraID = 0x5455
+	// versionAE1 entries carry the CRC of their contents, versionAE2 ones
+	// do not.
+	versionAE1 = 1
+	versionAE2 = 2
+	// strengthAES256 is the strength byte of AES-256 entries.
+	strengthAES256 = 3
+	// zipVersion51 is the version needed to extract AES entries.
+	zipVersion51 = 51
+	// flagEncrypted, flagDataDescriptor and flagUTF8 are general purpose
+	// flags of entries.
+	flagEncrypted      = 0x1
+	flagDataDescriptor = 0x8
+	flagUTF8           = 0x800
+	// iterations is the PBKDF2 iteration count fixed by the format.
+	iterations = 1000
+	// verifierLen is the length of the password verifier and macLen that
+	// of the authentication code.
+	verifierLen = 2
+	macLen      = 10
+)
+
+var (
+	// ErrPassword is returned by Open when the password does not match the
+	// entry's password verifier.
+	ErrPassword = errors.New("zipaes: wrong password")
+	// ErrAuthentication is returned when an entry's authentication code
+	// does not match its contents: the entry was modified, or the password
+	// was wrong and passed the short verifier by chance.
+	ErrAuthentication = errors.New("zipaes: authentication failed")
+	// ErrFormat is returned by Open for entries that are not WinZip AES
+	// entries or use a variant it does not support.
+	ErrFormat = errors.New("zipaes: not a WinZip AES entry")
+)
+
+// saltLen returns the salt length for a strength byte, and keyLen the key
+// length, or zero for unknown strengths.
+func saltLen(strength byte) int {
+	switch strength {
+	case 1, 2, 3:
+		return 4 + 4*int(strength)
+	}
+	return 0
+}
+
+func keyLen(strength byte) int {
+	return 2 * saltLen(strength)
+}
+
+// deriveKeys derives the encryption key, the authentication key and the
+// password verifier of an entry. The caller zeroes them when done.
+func deriveKeys(password, salt []byte, strength byte) (encKey, macKey, verifier []byte) {
+	n := keyLen(strength)
+	dk := pbkdf2.Key(password, salt, iterations, 2*n+verifierLen, sha1.New)
+	return dk[:n], dk[n : 2*n], dk[2*n:]
+}
+
+// ctrStream is the AES-CTR mode of the format, whose counter is
+// little-endian and starts at 1, unlike cipher.NewCTR.
+type ctrStream struct {
+	block   cipher.Block
+	counter [aes.BlockSize]byte
+	stream  [aes.BlockSize]byte
+	used    int
+}
+
+func newCTR(key []byte) (*ctrStream, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &ctrStream{block: block, used: aes.BlockSize}, nil
+}
+
+// xor encrypts or decrypts p in place.
+func (s *ctrStream) xor(p []byte) {
+	for len(p) > 0 {
+		if s.used == aes.BlockSize {
+			for i := range s.counter {
+				s.counter[i]++
+				if s.counter[i] != 0 {
+					break
+				}
+			}
+			s.block.Encrypt(s.stream[:], s.counter[:])
+			s.used = 0
+		}
+		n := subtle.XORBytes(p, p, s.stream[s.used:])
+		s.used += n
+		p = p[n:]
+	}
+}
+
+// destroy zeroes the key stream.
+func (s *ctrStream) destroy() {
+	secure.Zero(s.stream[:])
+}
+
+// Writer writes a ZIP archive whose files are encrypted with AES-256 under
+// a password. Its methods follow zip.Writer's, and as with zip.Writer a
+// file's contents must be written before the next call to Create,
+// CreateHeader or Close.
+type Writer struct {
+	zw       *zip.Writer
+	password []byte
+	last     *fileWriter
+	closed   bool
+}
+
+// NewWriter returns a Writer writing an archive to w, encrypting each file
+// under password. The password is copied, and zeroed by Close.
+func NewWriter(w io.Writer, password []byte) (*Writer, error) {
+	if len(password) == 0 {
+		return nil, errors.New("zipaes: password must not be empty")
+	}
+	return &Writer{zw: zip.NewWriter(w), password: append([]byte(nil), password...)}, nil
+}
+
+// SetComment sets the archive comment, which is not encrypted.
+func (w *Writer) SetComment(comment string) error {
+	return w.zw.SetComment(comment)
+}
+
+// Create adds a file to the archive, compressed with Deflate and
+// modified now, and returns a writer for its contents.
+func (w *Writer) Create(name string) (io.Writer, error) {
+	return w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+}
+
+// CreateHeader adds a file to the archive with the metadata in fh, whose
+// Method must be zip.Store or zip.Deflate, and returns a writer for its
+// contents. As with zip.Writer, the Writer takes ownership of fh. Names
+// ending in a slash add directories, which have no contents to encrypt.
+func (w *Writer) CreateHeader(fh *zip.FileHeader) (io.Writer, error) {
+	if w.closed {
+		return nil, errors.New("zipaes: writer is closed")
+	}
+	if err := w.finishLast(); err != nil {
+		return nil, err
+	}
+	if len(fh.Name) > 0 && fh.Name[len(fh.Name)-1] == '/' {
+		return w.zw.CreateHeader(fh)
+	}
+	method := fh.Method
+	if method != zip.Store && method != zip.Deflate {
+		return nil, fmt.Errorf("zipaes: unsupported compression method %d", method)
+	}
+
+	// CreateRaw writes the header as given, so it is filled in here as
+	// CreateHeader would, with the sizes and a zero CRC written by the data
+	// descriptor once the contents are known.
+	fh.Method = methodAES
+	fh.Flags |= flagEncrypted | flagDataDescriptor
+	if !fh.NonUTF8 && !isASCII(fh.Name+fh.Comment) && utf8.ValidString(fh.Name+fh.Comment) {
+		fh.Flags |= flagUTF8
+	}
+	fh.CreatorVersion = fh.CreatorVersion&0xff00 | zipVersion51
+	fh.ReaderVersion = zipVersion51
+	fh.CRC32 = 0
+	fh.CompressedSize64, fh.UncompressedSize64 = 0, 0
+	if !fh.Modified.IsZero() {
+		fh.ModifiedDate, fh.ModifiedTime = msDosTime(fh.Modified)
+		var ext [9]byte
+		binary.LittleEndian.PutUint16(ext[0:], extTimeExtraID)
+		binary.LittleEndian.PutUint16(ext[2:], 5)
+		ext[4] = 1 // modification time only
+		binary.LittleEndian.PutUint32(ext[5:], uint32(fh.Modified.Unix()))
+		fh.Extra = append(fh.Extra, ext[:]...)
+	}
+	var extra [4 + aesExtraLen]byte
+	binary.LittleEndian.PutUint16(extra[0:], aesExtraID)
+	binary.LittleEndian.PutUint16(extra[2:], aesExtraLen)
+	binary.LittleEndian.PutUint16(extra[4:], versionAE2)
+	copy(extra[6:], "AE")
+	extra[8] = strengthAES256
+	binary.LittleEndian.PutUint16(extra[9:], method)
+	fh.Extra = append(fh.Extra, extra[:]...)
+
+	raw, err := w.zw.CreateRaw(fh)
+	if err != nil {
+		return nil, err
+	}
+	fw, err := newFileWriter(fh, raw, w.password, method)
+	if err != nil {
+		return nil, err
+	}
+	w.last = fw
+	return fw, nil
+}
+
+// Close finishes the last file and writes the central directory. It does
+// not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return errors.New("zipaes: writer is closed")
+	}
+	w.closed = true
+	defer secure.Zero(w.password)
+	if err := w.finishLast(); err != nil {
+		return err
+	}
+	return w.zw.Close()
+}
+
+// finishLast finishes the file being written, if any, before zip.Writer
+// writes its data descriptor.
+func (w *Writer) finishLast() error {
+	if w.last == nil {
+		return nil
+	}
+	fw := w.last
+	w.last = nil
+	return fw.finish()
+}
+
+// fileWriter compresses and encrypts the contents of one file.
+type fileWriter struct {
+	fh     *zip.FileHeader
+	raw    io.Writer
+	comp   io.WriteCloser
+	ctr    *ctrStream
+	mac    hash.Hash
+	buf    []byte
+	size   uint64
+	sealed uint64
+	err    error
+}
+
+func newFileWriter(fh *zip.FileHeader, raw io.Writer, password []byte, method uint16) (*fileWriter, error) {
+	salt := make([]byte, saltLen(strengthAES256))
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("zipaes: failed to generate salt: %w", err)
+	}
+	encKey, macKey, verifier := deriveKeys(password, salt, strengthAES256)
+	defer secure.Zero(encKey)
+	defer secure.Zero(macKey)
+	ctr, err := newCTR(encKey)
+	if err != nil {
+		return nil, err
+	}
+	fw := &fileWriter{fh: fh, raw: raw, ctr: ctr, mac: hmac.New(sha1.New, macKey)}
+	if _, err := raw.Write(append(salt, verifier...)); err != nil {
+		return nil, err
+	}
+	if method == zip.Deflate {
+		// NewWriter only fails for invalid levels.
+		fw.comp, _ = flate.NewWriter(sealer{fw}, flate.DefaultCompression)
+	} else {
+		fw.comp = nopCloser{sealer{fw}}
+	}
+	return fw, nil
+}
+
+// Write compresses and encrypts p.
+func (fw *fileWriter) Write(p []byte) (int, error) {
+	if fw.err != nil {
+		return 0, fw.err
+	}
+	n, err := fw.comp.Write(p)
+	fw.size += uint64(n)
+	if err != nil {
+		fw.err = err
+	}
+	return n, err
+}
+
+// seal encrypts compressed data and writes it to the archive.
+func (fw *fileWriter) seal(p []byte) (int, error) {
+	if fw.buf == nil {
+		fw.buf = make([]byte, 32*1024)
+	}
+	written := 0
+	for len(p) > 0 {
+		chunk := fw.buf[:min(len(p), len(fw.buf))]
+		copy(chunk, p)
+		fw.ctr.xor(chunk)
+		fw.mac.Write(chunk)
+		n, err := fw.raw.Write(chunk)
+		written += n
+		fw.sealed += uint64(n)
+		if err != nil {
+			return written, err
+		}
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+// finish flushes the compressor, writes the authentication code and
+// records the sizes for the data descriptor and the central directory.
+func (fw *fileWriter) finish() error {
+	defer fw.ctr.destroy()
+	defer secure.Zero(fw.buf)
+	if fw.err != nil {
+		return fw.err
+	}
+	if err := fw.comp.Close(); err != nil {
+		return err
+	}
+	if _, err := fw.raw.Write(fw.mac.Sum(nil)[:macLen]); err != nil {
+		return err
+	}
+	fw.fh.CompressedSize64 = uint64(saltLen(strengthAES256)+verifierLen+macLen) + fw.sealed
+	fw.fh.UncompressedSize64 = fw.size
+	fw.fh.CompressedSize = uint32(min(fw.fh.CompressedSize64, 1<<32-1))
+	fw.fh.UncompressedSize = uint32(min(fw.fh.UncompressedSize64, 1<<32-1))
+	return nil
+}
+
+// sealer is the io.Writer the compressor writes to.
+type sealer struct{ fw *fileWriter }
+
+func (s sealer) Write(p []byte) (int, error) { return s.fw.seal(p) }
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// IsEncrypted reports whether f is a WinZip AES entry.
+func IsEncrypted(f *zip.File) bool {
+	_, ok := aesExtra(f.Extra)
+	return ok && f.Method == methodAES
+}
+
+// aesParams is the content of an AES extra field.
+type aesParams struct {
+	version  uint16
+	strength byte
+	method   uint16
+}
+
+// aesExtra finds the AES extra field in extra.
+func aesExtra(extra []byte) (aesParams, bool) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if len(extra) < 4+size {
+			break
+		}
+		field := extra[4 : 4+size]
+		if id == aesExtraID && size == aesExtraLen && string(field[2:4]) == "AE" {
+			return aesParams{
+				version:  binary.LittleEndian.Uint16(field),
+				strength: field[4],
+				method:   binary.LittleEndian.Uint16(field[5:]),
+			}, true
+		}
+		extra = extra[4+size:]
+	}
+	return aesParams{}, false
+}
+
+// Open decrypts a WinZip AES entry of an archive read with zip.NewReader,
+// written by Writer or another tool, with AES-128, AES-192 or AES-256 and
+// Store or Deflate compression. It returns ErrPassword if the password is
+// wrong. The authentication code is checked when the contents have been
+// read: the final Read returns ErrAuthentication instead of io.EOF if the
+// entry was modified, so read to the end before trusting any of it.
+func Open(f *zip.File, password []byte) (io.ReadCloser, error) {
+	params, ok := aesExtra(f.Extra)
+	if !ok || f.Method != methodAES {
+		return nil, fmt.Errorf("%w: %s", ErrFormat, f.Name)
+	}
+	if (params.version != versionAE1 && params.version != versionAE2) || saltLen(params.strength) == 0 {
+		return nil, fmt.Errorf("%w: %s: unsupported version %d or strength %d", ErrFormat, f.Name, params.version, params.strength)
+	}
+	if params.method != zip.Store && params.method != zip.Deflate {
+		return nil, fmt.Errorf("%w: %s: unsupported compression method %d", ErrFormat, f.Name, params.method)
+	}
+	overhead := uint64(saltLen(params.strength) + verifierLen + macLen)
+	if f.CompressedSize64 < overhead {
+		return nil, fmt.Errorf("%w: %s: entry too short", ErrFormat, f.Name)
+	}
+	raw, err := f.OpenRaw()
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, saltLen(params.strength)+verifierLen)
+	if _, err := io.ReadFull(raw, header); err != nil {
+		return nil, err
+	}
+	salt, stored := header[:len(header)-verifierLen], header[len(header)-verifierLen:]
+	encKey, macKey, verifier := deriveKeys(password, salt, params.strength)
+	defer secure.Zero(encKey)
+	defer secure.Zero(macKey)
+	if subtle.ConstantTimeCompare(verifier, stored) != 1 {
+		return nil, fmt.Errorf("%w: %s", ErrPassword, f.Name)
+	}
+	ctr, err := newCTR(encKey)
+	if err != nil {
+		return nil, err
+	}
+	dr := &decryptReader{
+		data: io.LimitReader(raw, int64(f.CompressedSize64-overhead)),
+		raw:  raw,
+		ctr:  ctr,
+		mac:  hmac.New(sha1.New, macKey),
+	}
+	er := &entryReader{dr: dr, crc: crc32.NewIEEE()}
+	if params.version == versionAE1 {
+		er.wantCRC = &f.CRC32
+	}
+	if params.method == zip.Deflate {
+		er.rc = flate.NewReader(dr)
+	} else {
+		er.rc = io.NopCloser(dr)
+	}
+	return er, nil
+}
+
+// decryptReader decrypts an entry's data and checks its authentication
+// code at the end.
+type decryptReader struct {
+	data io.Reader
+	raw  io.Reader
+	ctr  *ctrStream
+	mac  hash.Hash
+	err  error
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err := r.data.Read(p)
+	r.mac.Write(p[:n])
+	r.ctr.xor(p[:n])
+	if err == io.EOF {
+		err = r.verify()
+	}
+	r.err = err
+	return n, err
+}
+
+// verify reads the authentication code after the data and compares it.
+func (r *decryptReader) verify() error {
+	r.ctr.destroy()
+	stored := make([]byte, macLen)
+	if _, err := io.ReadFull(r.raw, stored); err != nil {
+		return err
+	}
+	if !hmac.Equal(r.mac.Sum(nil)[:macLen], stored) {
+		return ErrAuthentication
+	}
+	return io.EOF
+}
+
+// entryReader decompresses an entry, and makes sure its data is read to
+// the authentication code before reporting the end.
+type entryReader struct {
+	dr      *decryptReader
+	rc      io.ReadCloser
+	crc     hash.Hash32
+	wantCRC *uint32
+	err     error
+}
+
+func (r *entryReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err := r.rc.Read(p)
+	r.crc.Write(p[:n])
+	if err != nil {
+		// A compressed stream can end, or fail on modified data, before
+		// all of the data has been read; the rest must still be
+		// authenticated, and a failed authentication takes precedence.
+		if _, derr := io.Copy(io.Discard, r.dr); derr != nil {
+			err = derr
+		} else if err == io.EOF && r.wantCRC != nil && r.crc.Sum32() != *r.wantCRC {
+			err = ErrAuthentication
+		}
+	}
+	r.err = err
+	return n, err
+}
+
+// Close releases the decompressor.
+func (r *entryReader) Close() error {
+	return r.rc.Close()
+}
+
+// msDosTime returns the MS-DOS date and time of t, as archive/zip writes
+// them for FileHeader.Modified.
+func msDosTime(t time.Time) (date, tm uint16) {
+	date = uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	tm = uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+	return date, tm
+}
+
+// isASCII reports whether s is plain ASCII.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
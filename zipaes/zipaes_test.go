@@ -0,0 +1,191 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0.
+ * If a copy of the MPL was not distributed with this file, You can obtain one at
+ * https://mozilla.org/MPL/2.0/.
+ */
+
+package zipaes
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/aes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	password := []byte("correct horse battery staple")
+	random := make([]byte, 100000)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatalf("failed to generate content: %v", err)
+	}
+	files := []struct {
+		name    string
+		method  uint16
+		content []byte
+	}{
+		{"report.txt", zip.Deflate, bytes.Repeat([]byte("quarterly figures\n"), 5000)},
+		{"random.bin", zip.Store, random},
+		{"empty.txt", zip.Deflate, nil},
+		{"café.txt", zip.Store, []byte("unicode name")},
+	}
+
+	var buf bytes.Buffer
+	zw, err := NewWriter(&buf, password)
+	if err != nil {
+		t.Fatalf("NewWriter failed: %v", err)
+	}
+	if _, err := zw.CreateHeader(&zip.FileHeader{Name: "docs/"}); err != nil {
+		t.Fatalf("CreateHeader for a directory failed: %v", err)
+	}
+	for _, f := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: f.method})
+		if err != nil {
+			t.Fatalf("CreateHeader(%s) failed: %v", f.name, err)
+		}
+		if _, err := w.Write(f.content); err != nil {
+			t.Fatalf("Write(%s) failed: %v", f.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if !bytes.Equal(zw.password, make([]byte, len(password))) {
+		t.Error("Close did not zero the password")
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("zip.NewReader failed: %v", err)
+	}
+	if len(zr.File) != len(files)+1 {
+		t.Fatalf("archive has %d entries, want %d", len(zr.File), len(files)+1)
+	}
+	if IsEncrypted(zr.File[0]) {
+		t.Error("directory entry reported as encrypted")
+	}
+	for i, f := range files {
+		zf := zr.File[i+1]
+		if zf.Name != f.name || !IsEncrypted(zf) {
+			t.Fatalf("entry %d = %q, encrypted %v", i+1, zf.Name, IsEncrypted(zf))
+		}
+		// AE-2 entries do not reveal the CRC of their contents.
+		if zf.CRC32 != 0 || zf.Flags&flagEncrypted == 0 || zf.UncompressedSize64 != uint64(len(f.content)) {
+			t.Errorf("%s: CRC %#x, flags %#x, size %d", f.name, zf.CRC32, zf.Flags, zf.UncompressedSize64)
+		}
+		params, _ := aesExtra(zf.Extra)
+		if params != (aesParams{version: versionAE2, strength: strengthAES256, method: f.method}) {
+			t.Errorf("%s: AES extra field = %+v", f.name, params)
+		}
+		if _, err := zf.Open(); !errors.Is(err, zip.ErrAlgorithm) {
+			t.Errorf("%s: zip Open error = %v, want zip.ErrAlgorithm", f.name, err)
+		}
+		rc, err := Open(zf, password)
+		if err != nil {
+			t.Fatalf("Open(%s) failed: %v", f.name, err)
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil || !bytes.Equal(got, f.content) {
+			t.Errorf("%s: read %d bytes, %v; want %d bytes", f.name, len(got), err, len(f.content))
+		}
+	}
+
+	if _, err := Open(zr.File[1], []byte("wrong")); !errors.Is(err, ErrPassword) && !errors.Is(err, ErrAuthentication) {
+		t.Errorf("Open with a wrong password: error = %v, want ErrPassword", err)
+	}
+	if _, err := Open(zr.File[0], password); !errors.Is(err, ErrFormat) {
+		t.Errorf("Open of a directory: error = %v, want ErrFormat", err)
+	}
+}
+
+func TestTamperedEntry(t *testing.T) {
+	password := []byte("password")
+	content := bytes.Repeat([]byte("payload "), 1000)
+	for _, method := range []uint16{zip.Store, zip.Deflate} {
+		var buf bytes.Buffer
+		zw, err := NewWriter(&buf, password)
+		if err != nil {
+			t.Fatalf("NewWriter failed: %v", err)
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: "a", Method: method})
+		if err != nil {
+			t.Fatalf("CreateHeader failed: %v", err)
+		}
+		if _, err := w.Write(content); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+
+		data := buf.Bytes()
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("zip.NewReader failed: %v", err)
+		}
+		off, err := zr.File[0].DataOffset()
+		if err != nil {
+			t.Fatalf("DataOffset failed: %v", err)
+		}
+		// Flip a bit after the salt and the password verifier.
+		data[off+int64(saltLen(strengthAES256)+verifierLen)+5] ^= 0x01
+		rc, err := Open(zr.File[0], password)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		if _, err := io.ReadAll(rc); !errors.Is(err, ErrAuthentication) {
+			t.Errorf("method %d: reading a modified entry: error = %v, want ErrAuthentication", method, err)
+		}
+	}
+}
+
+func TestCTRCounter(t *testing.T) {
+	// The counter is little-endian and carries across bytes.
+	s, err := newCTR(make([]byte, 32))
+	if err != nil {
+		t.Fatalf("newCTR failed: %v", err)
+	}
+	binary.LittleEndian.PutUint64(s.counter[:], 0xff)
+	s.xor(make([]byte, 1))
+	if s.counter[0] != 0 || s.counter[1] != 1 {
+		t.Errorf("counter after carry = %x", s.counter)
+	}
+
+	// The first block of key stream encrypts a counter of 1, and
+	// encrypting in pieces gives the same result as at once.
+	key := make([]byte, 32)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatalf("aes.NewCipher failed: %v", err)
+	}
+	first := make([]byte, aes.BlockSize)
+	first[0] = 1
+	block.Encrypt(first, first)
+	whole := make([]byte, 100)
+	w, _ := newCTR(key)
+	w.xor(whole)
+	if !bytes.Equal(whole[:aes.BlockSize], first) {
+		t.Error("first key stream block does not encrypt a counter of 1")
+	}
+	var got []byte
+	p, _ := newCTR(key)
+	for _, n := range []int{1, 15, 17, 32, 35} {
+		piece := make([]byte, n)
+		p.xor(piece)
+		got = append(got, piece...)
+	}
+	if !bytes.Equal(got, whole) {
+		t.Error("key stream in pieces differs from the whole")
+	}
+}
+
+func TestNewWriterEmptyPassword(t *testing.T) {
+	if _, err := NewWriter(io.Discard, nil); err == nil {
+		t.Error("NewWriter accepted an empty password")
+	}
+}